@@ -0,0 +1,261 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package aci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+)
+
+const (
+	defaultSyncPeriod = time.Minute
+	requestTimeout    = 30 * time.Second
+)
+
+// Config of the Azure Container Instances provider
+type Config struct {
+	// SubscriptionID of the container groups
+	SubscriptionID string `config:"subscription_id"`
+
+	// ResourceGroups of the container groups, all the groups of the subscription by default
+	ResourceGroups []string `config:"resource_groups"`
+
+	// ClientID of a user-assigned managed identity, or of a service principal if TenantID and
+	// ClientSecret are set. The system-assigned managed identity is used by default.
+	ClientID     string `config:"client_id"`
+	TenantID     string `config:"tenant_id"`
+	ClientSecret string `config:"client_secret"`
+
+	// ResourceManagerEndpoint is the Azure Resource Manager endpoint, the one of the public cloud
+	// by default
+	ResourceManagerEndpoint string `config:"resource_manager_endpoint"`
+
+	// SyncPeriod is the time waited between listings of the container groups
+	SyncPeriod time.Duration `config:"sync_period"`
+}
+
+// Validate the config
+func (c *Config) Validate() error {
+	if c.SubscriptionID == "" {
+		return errors.New("azure subscription id is required")
+	}
+	if (c.TenantID == "") != (c.ClientSecret == "") {
+		return errors.New("azure tenant id and client secret must be set together")
+	}
+	if c.ClientSecret != "" && c.ClientID == "" {
+		return errors.New("azure client id is required with a client secret")
+	}
+	if c.ResourceManagerEndpoint != "" {
+		if _, err := url.Parse(c.ResourceManagerEndpoint); err != nil {
+			return fmt.Errorf("invalid azure resource manager endpoint: %w", err)
+		}
+	}
+	if c.SyncPeriod < 0 {
+		return fmt.Errorf("invalid azure sync period %v", c.SyncPeriod)
+	}
+	return nil
+}
+
+// API is the subset of the Azure Container Instances API used by the watcher
+type API interface {
+	// ContainerGroups returns the container groups with the state of their containers
+	ContainerGroups(ctx context.Context) ([]ContainerGroup, error)
+}
+
+type client struct {
+	groups         *armcontainerinstance.ContainerGroupsClient
+	resourceGroups []string
+}
+
+// NewClient returns a client of the Azure Container Instances API, authenticated with a managed
+// identity or a service principal
+func NewClient(cfg Config) (API, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	options := policy.ClientOptions{Cloud: cloud.AzurePublic}
+	if cfg.ResourceManagerEndpoint != "" {
+		options.Cloud = cloud.Configuration{
+			ActiveDirectoryAuthorityHost: cloud.AzurePublic.ActiveDirectoryAuthorityHost,
+			Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
+				cloud.ResourceManager: {Endpoint: cfg.ResourceManagerEndpoint, Audience: cfg.ResourceManagerEndpoint},
+			},
+		}
+	}
+	options.Retry.TryTimeout = requestTimeout
+
+	var credential azcore.TokenCredential
+	var err error
+	if cfg.ClientSecret != "" {
+		credential, err = azidentity.NewClientSecretCredential(cfg.TenantID, cfg.ClientID, cfg.ClientSecret,
+			&azidentity.ClientSecretCredentialOptions{ClientOptions: options})
+	} else {
+		identity := &azidentity.ManagedIdentityCredentialOptions{ClientOptions: options}
+		if cfg.ClientID != "" {
+			identity.ID = azidentity.ClientID(cfg.ClientID)
+		}
+		credential, err = azidentity.NewManagedIdentityCredential(identity)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create azure credential: %w", err)
+	}
+	return newClient(cfg, credential, &arm.ClientOptions{ClientOptions: options})
+}
+
+func newClient(cfg Config, credential azcore.TokenCredential, options *arm.ClientOptions) (*client, error) {
+	groups, err := armcontainerinstance.NewContainerGroupsClient(cfg.SubscriptionID, credential, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create azure container groups client: %w", err)
+	}
+	return &client{groups: groups, resourceGroups: cfg.ResourceGroups}, nil
+}
+
+// ContainerGroups returns the container groups with the state of their containers. Listings
+// don't include the state of the containers, every group is requested to get it.
+func (c *client) ContainerGroups(ctx context.Context) ([]ContainerGroup, error) {
+	var listed []*armcontainerinstance.ContainerGroup
+	if len(c.resourceGroups) == 0 {
+		page := func(r armcontainerinstance.ContainerGroupsClientListResponse) []*armcontainerinstance.ContainerGroup {
+			return r.Value
+		}
+		groups, err := listAll(ctx, c.groups.NewListPager(nil), page)
+		if err != nil {
+			return nil, err
+		}
+		listed = groups
+	}
+	for _, rg := range c.resourceGroups {
+		page := func(r armcontainerinstance.ContainerGroupsClientListByResourceGroupResponse) []*armcontainerinstance.ContainerGroup {
+			return r.Value
+		}
+		groups, err := listAll(ctx, c.groups.NewListByResourceGroupPager(rg, nil), page)
+		if err != nil {
+			return nil, err
+		}
+		listed = append(listed, groups...)
+	}
+
+	groups := make([]ContainerGroup, 0, len(listed))
+	for _, g := range listed {
+		name := value(g.Name)
+		resp, err := c.groups.Get(ctx, resourceGroup(value(g.ID)), name, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get azure container group %s: %w", name, err)
+		}
+		groups = append(groups, newContainerGroup(&resp.ContainerGroup))
+	}
+	return groups, nil
+}
+
+// listAll returns the container groups of all the pages of a listing
+func listAll[T any](ctx context.Context, pager *runtime.Pager[T], page func(T) []*armcontainerinstance.ContainerGroup) ([]*armcontainerinstance.ContainerGroup, error) {
+	var groups []*armcontainerinstance.ContainerGroup
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list azure container groups: %w", err)
+		}
+		groups = append(groups, page(resp)...)
+	}
+	return groups, nil
+}
+
+func newContainerGroup(g *armcontainerinstance.ContainerGroup) ContainerGroup {
+	id := value(g.ID)
+	group := ContainerGroup{
+		ID:            id,
+		Name:          value(g.Name),
+		ResourceGroup: resourceGroup(id),
+		Location:      value(g.Location),
+	}
+	if len(g.Tags) > 0 {
+		group.Tags = make(map[string]string, len(g.Tags))
+		for k, v := range g.Tags {
+			group.Tags[k] = value(v)
+		}
+	}
+	props := g.Properties
+	if props == nil {
+		return group
+	}
+	group.OSType = string(value(props.OSType))
+	group.ProvisioningState = value(props.ProvisioningState)
+	if ip := props.IPAddress; ip != nil {
+		group.IP = value(ip.IP)
+		group.FQDN = value(ip.Fqdn)
+	}
+	if view := props.InstanceView; view != nil {
+		group.State = value(view.State)
+	}
+	for _, c := range props.Containers {
+		if c == nil {
+			continue
+		}
+		container := Container{Name: value(c.Name)}
+		if p := c.Properties; p != nil {
+			container.Image = value(p.Image)
+			for _, port := range p.Ports {
+				if port != nil {
+					container.Ports = append(container.Ports, Port{Port: int(value(port.Port)), Protocol: string(value(port.Protocol))})
+				}
+			}
+			if view := p.InstanceView; view != nil {
+				container.RestartCount = int(value(view.RestartCount))
+				if state := view.CurrentState; state != nil {
+					container.State = value(state.State)
+					container.StartTime = value(state.StartTime)
+				}
+			}
+		}
+		group.Containers = append(group.Containers, container)
+	}
+	return group
+}
+
+// value returns the value of an optional field of the API, or its zero value if it is not set
+func value[T any](p *T) T {
+	if p == nil {
+		var zero T
+		return zero
+	}
+	return *p
+}
+
+// resourceGroup returns the resource group of an ID like
+// /subscriptions/<id>/resourceGroups/<group>/providers/...
+func resourceGroup(id string) string {
+	parts := strings.Split(id, "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if strings.EqualFold(parts[i], "resourceGroups") {
+			return parts[i+1]
+		}
+	}
+	return ""
+}
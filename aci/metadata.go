@@ -0,0 +1,85 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package aci
+
+import (
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// GenerateMetadata returns the metadata of a container, with the cloud and container fields, and
+// its container group under `azure.container_group`
+func GenerateMetadata(c *Container) mapstr.M {
+	meta := mapstr.M{
+		"container": mapstr.M{
+			"name": c.Name,
+			"image": mapstr.M{
+				"name": c.Image,
+			},
+		},
+		"cloud": mapstr.M{
+			"provider": "azure",
+			"service": mapstr.M{
+				"name": "Container Instances",
+			},
+		},
+	}
+	group := c.Group
+	if group == nil {
+		return meta
+	}
+
+	groupMeta := mapstr.M{
+		"id":   group.ID,
+		"name": group.Name,
+	}
+	if group.IP != "" {
+		groupMeta["ip"] = group.IP
+	}
+	if group.FQDN != "" {
+		groupMeta["fqdn"] = group.FQDN
+	}
+	if len(group.Tags) > 0 {
+		tags := mapstr.M{}
+		for k, v := range group.Tags {
+			tags[k] = v
+		}
+		groupMeta["tags"] = tags
+	}
+	meta["azure"] = mapstr.M{
+		"resource_group":  group.ResourceGroup,
+		"container_group": groupMeta,
+	}
+	if group.Location != "" {
+		_, _ = meta.Put("cloud.region", group.Location)
+	}
+	if subscription := subscriptionID(group.ID); subscription != "" {
+		_, _ = meta.Put("cloud.account.id", subscription)
+	}
+	return meta
+}
+
+// subscriptionID returns the subscription of an ID like /subscriptions/<id>/resourceGroups/...
+func subscriptionID(id string) string {
+	parts := strings.Split(strings.TrimPrefix(id, "/"), "/")
+	if len(parts) > 1 && strings.EqualFold(parts[0], "subscriptions") {
+		return parts[1]
+	}
+	return ""
+}
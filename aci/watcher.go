@@ -0,0 +1,208 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package aci discovers the containers running in Azure Container Instances, polling the container
+// groups of a subscription with the armcontainerinstance client of the Azure SDK.
+package aci
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+	"github.com/elastic/elastic-agent-autodiscover/internal/poll"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+const (
+	// StateRunning is the state of running containers
+	StateRunning = "Running"
+
+	maxBackoff = 10 * time.Minute
+)
+
+// ContainerGroup is a container group of Azure Container Instances
+type ContainerGroup struct {
+	ID                string
+	Name              string
+	ResourceGroup     string
+	Location          string
+	Tags              map[string]string
+	OSType            string
+	ProvisioningState string
+	State             string
+	IP                string
+	FQDN              string
+	Containers        []Container
+}
+
+// Container of a container group
+type Container struct {
+	Name         string
+	Image        string
+	State        string
+	StartTime    time.Time
+	RestartCount int
+	Ports        []Port
+
+	// Group the container belongs to, set by the watcher
+	Group *ContainerGroup
+}
+
+// Port exposed by a container
+type Port struct {
+	Port     int
+	Protocol string
+}
+
+// Watcher polls the API and keeps a list of the running containers of the container groups
+type Watcher interface {
+	// Start watching the container groups
+	Start() error
+
+	// Stop watching the container groups
+	Stop()
+
+	// Containers returns the running containers by their group ID and name, like <group ID>/<name>
+	Containers() map[string]*Container
+
+	// ListenStart returns a bus listener to receive the running containers of the container
+	// groups, with a `container` key holding them. Restarted containers are started again.
+	ListenStart() bus.Listener
+
+	// ListenStop returns a bus listener to receive the containers that stop running or restart,
+	// with a `container` key holding their previous state
+	ListenStop() bus.Listener
+}
+
+type watcher struct {
+	sync.RWMutex
+	log        *logp.Logger
+	api        API
+	period     time.Duration
+	ctx        context.Context
+	stop       context.CancelFunc
+	containers map[string]*Container
+	stopped    sync.WaitGroup
+	bus        bus.Bus
+}
+
+// NewWatcher creates a new Watcher of the container groups of the API
+func NewWatcher(log *logp.Logger, api API, cfg Config) (Watcher, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	period := cfg.SyncPeriod
+	if period == 0 {
+		period = defaultSyncPeriod
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &watcher{
+		log:        log,
+		api:        api,
+		period:     period,
+		ctx:        ctx,
+		stop:       cancel,
+		containers: make(map[string]*Container),
+		bus:        bus.New(log, "aci"),
+	}, nil
+}
+
+// Containers returns the running containers
+func (w *watcher) Containers() map[string]*Container {
+	w.RLock()
+	defer w.RUnlock()
+	res := make(map[string]*Container, len(w.containers))
+	for k, v := range w.containers {
+		res[k] = v
+	}
+	return res
+}
+
+// Start watching the container groups, the first listing is done synchronously so errors
+// authenticating or reaching the API are returned
+func (w *watcher) Start() error {
+	w.log.Debug("Start Azure Container Instances watcher")
+	if err := w.sync(); err != nil {
+		return err
+	}
+
+	w.stopped.Add(1)
+	go w.watch()
+	return nil
+}
+
+// Stop watching the container groups
+func (w *watcher) Stop() {
+	w.stop()
+	w.stopped.Wait()
+}
+
+func (w *watcher) watch() {
+	defer w.stopped.Done()
+
+	poll.Loop(w.ctx, w.log, poll.Config{
+		Period:      w.period,
+		MaxBackoff:  maxBackoff,
+		Description: "listing Azure container groups",
+	}, w.sync)
+	w.log.Debug("Watcher stopped")
+}
+
+// sync lists the container groups and publishes the events of the containers that started or
+// stopped since the last listing. Restarted containers are stopped and started again.
+func (w *watcher) sync() error {
+	ctx, cancel := context.WithTimeout(w.ctx, w.period+requestTimeout)
+	defer cancel()
+
+	groups, err := w.api.ContainerGroups(ctx)
+	if err != nil {
+		return err
+	}
+
+	running := make(map[string]*Container)
+	for i := range groups {
+		group := &groups[i]
+		for j := range group.Containers {
+			c := &group.Containers[j]
+			if c.State != StateRunning {
+				continue
+			}
+			c.Group = group
+			running[group.ID+"/"+c.Name] = c
+		}
+	}
+
+	w.Lock()
+	started, stopped := poll.Diff(w.containers, running, func(old, c *Container) bool {
+		return old.RestartCount != c.RestartCount || !old.StartTime.Equal(c.StartTime)
+	})
+	w.containers = running
+	w.Unlock()
+
+	poll.Publish(w.bus, "container", started, stopped)
+	return nil
+}
+
+func (w *watcher) ListenStart() bus.Listener {
+	return w.bus.Subscribe("start")
+}
+
+func (w *watcher) ListenStop() bus.Listener {
+	return w.bus.Subscribe("stop")
+}
@@ -0,0 +1,214 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package aci
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	azfake "github.com/Azure/azure-sdk-for-go/sdk/azcore/fake"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-autodiscover/internal/polltest"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const groupID = "/subscriptions/sub1/resourceGroups/rg1/providers/Microsoft.ContainerInstance/containerGroups/web"
+
+// mockAPI serves a container group with the containers set
+type mockAPI struct {
+	polltest.Source[Container]
+}
+
+func (m *mockAPI) ContainerGroups(ctx context.Context) ([]ContainerGroup, error) {
+	containers, _, err := m.List()
+	return []ContainerGroup{{ID: groupID, Name: "web", ResourceGroup: "rg1", Containers: containers}}, err
+}
+
+func TestWatcher(t *testing.T) {
+	api := &mockAPI{}
+	api.Set(Container{Name: "nginx", State: StateRunning}, Container{Name: "init", State: "Terminated"})
+
+	w, err := NewWatcher(logp.L(), api, Config{SubscriptionID: "sub1", SyncPeriod: 10 * time.Millisecond})
+	require.NoError(t, err)
+	start, stop := polltest.Start(t, w)
+
+	c := polltest.NextEvent(t, start)["container"].(*Container)
+	assert.Equal(t, "nginx", c.Name)
+	assert.Equal(t, "web", c.Group.Name)
+	assert.Contains(t, w.Containers(), groupID+"/nginx")
+
+	// Restarted container
+	api.Set(Container{Name: "nginx", State: StateRunning, RestartCount: 1})
+	assert.Equal(t, 0, polltest.NextEvent(t, stop)["container"].(*Container).RestartCount)
+	assert.Equal(t, 1, polltest.NextEvent(t, start)["container"].(*Container).RestartCount)
+
+	api.Set()
+	assert.Equal(t, "nginx", polltest.NextEvent(t, stop)["container"].(*Container).Name)
+}
+
+func TestWatcherStartError(t *testing.T) {
+	polltest.StartError(t, func(err error) (polltest.Watcher, error) {
+		api := &mockAPI{}
+		api.Fail(err)
+		return NewWatcher(logp.L(), api, Config{SubscriptionID: "sub1"})
+	})
+
+	_, err := NewWatcher(logp.L(), &mockAPI{}, Config{})
+	assert.Error(t, err)
+}
+
+func TestConfigValidate(t *testing.T) {
+	assert.NoError(t, (&Config{SubscriptionID: "sub1"}).Validate())
+	assert.NoError(t, (&Config{SubscriptionID: "sub1", ClientID: "c", TenantID: "t", ClientSecret: "s"}).Validate())
+	assert.Error(t, (&Config{SubscriptionID: "sub1", ClientSecret: "s"}).Validate())
+	assert.Error(t, (&Config{SubscriptionID: "sub1", TenantID: "t", ClientSecret: "s"}).Validate())
+}
+
+func TestClient(t *testing.T) {
+	gets := 0
+	server := &fake.ContainerGroupsServer{
+		NewListByResourceGroupPager: func(resourceGroup string, _ *armcontainerinstance.ContainerGroupsClientListByResourceGroupOptions) (resp azfake.PagerResponder[armcontainerinstance.ContainerGroupsClientListByResourceGroupResponse]) {
+			assert.Equal(t, "rg1", resourceGroup)
+			resp.AddPage(http.StatusOK, armcontainerinstance.ContainerGroupsClientListByResourceGroupResponse{
+				ContainerGroupListResult: armcontainerinstance.ContainerGroupListResult{
+					Value: []*armcontainerinstance.ContainerGroup{{ID: to.Ptr(groupID), Name: to.Ptr("web")}},
+				},
+			}, nil)
+			return
+		},
+		Get: func(_ context.Context, resourceGroup, name string, _ *armcontainerinstance.ContainerGroupsClientGetOptions) (resp azfake.Responder[armcontainerinstance.ContainerGroupsClientGetResponse], errResp azfake.ErrorResponder) {
+			assert.Equal(t, "rg1", resourceGroup)
+			assert.Equal(t, "web", name)
+			gets++
+			resp.SetResponse(http.StatusOK, armcontainerinstance.ContainerGroupsClientGetResponse{
+				ContainerGroup: armcontainerinstance.ContainerGroup{
+					ID:       to.Ptr(groupID),
+					Name:     to.Ptr("web"),
+					Location: to.Ptr("westeurope"),
+					Tags:     map[string]*string{"team": to.Ptr("payments")},
+					Properties: &armcontainerinstance.ContainerGroupPropertiesProperties{
+						OSType:    to.Ptr(armcontainerinstance.OperatingSystemTypesLinux),
+						IPAddress: &armcontainerinstance.IPAddress{IP: to.Ptr("20.1.2.3")},
+						Containers: []*armcontainerinstance.Container{{
+							Name: to.Ptr("nginx"),
+							Properties: &armcontainerinstance.ContainerProperties{
+								Image: to.Ptr("nginx:latest"),
+								Ports: []*armcontainerinstance.ContainerPort{{Port: to.Ptr[int32](80), Protocol: to.Ptr(armcontainerinstance.ContainerNetworkProtocolTCP)}},
+								InstanceView: &armcontainerinstance.ContainerPropertiesInstanceView{
+									RestartCount: to.Ptr[int32](2),
+									CurrentState: &armcontainerinstance.ContainerState{
+										State:     to.Ptr(StateRunning),
+										StartTime: to.Ptr(time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)),
+									},
+								},
+							},
+						}},
+					},
+				},
+			}, nil)
+			return
+		},
+	}
+
+	api, err := newClient(Config{SubscriptionID: "sub1", ResourceGroups: []string{"rg1"}}, &azfake.TokenCredential{},
+		&arm.ClientOptions{ClientOptions: azcore.ClientOptions{Transport: fake.NewContainerGroupsServerTransport(server)}})
+	require.NoError(t, err)
+
+	groups, err := api.ContainerGroups(context.Background())
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	assert.Equal(t, "rg1", groups[0].ResourceGroup)
+	assert.Equal(t, "20.1.2.3", groups[0].IP)
+	assert.Equal(t, "Linux", groups[0].OSType)
+	assert.Equal(t, map[string]string{"team": "payments"}, groups[0].Tags)
+	require.Len(t, groups[0].Containers, 1)
+	assert.Equal(t, Container{
+		Name:         "nginx",
+		Image:        "nginx:latest",
+		State:        StateRunning,
+		StartTime:    time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC),
+		RestartCount: 2,
+		Ports:        []Port{{Port: 80, Protocol: "TCP"}},
+	}, groups[0].Containers[0])
+	assert.Equal(t, 1, gets)
+}
+
+func TestClientErrors(t *testing.T) {
+	server := &fake.ContainerGroupsServer{
+		NewListPager: func(_ *armcontainerinstance.ContainerGroupsClientListOptions) (resp azfake.PagerResponder[armcontainerinstance.ContainerGroupsClientListResponse]) {
+			resp.AddResponseError(http.StatusForbidden, "AuthorizationFailed")
+			return
+		},
+	}
+	api, err := newClient(Config{SubscriptionID: "sub1"}, &azfake.TokenCredential{},
+		&arm.ClientOptions{ClientOptions: azcore.ClientOptions{Transport: fake.NewContainerGroupsServerTransport(server)}})
+	require.NoError(t, err)
+
+	_, err = api.ContainerGroups(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "AuthorizationFailed")
+}
+
+func TestNewClient(t *testing.T) {
+	for _, cfg := range []Config{
+		{SubscriptionID: "sub1"},
+		{SubscriptionID: "sub1", ClientID: "identity-id"},
+		{SubscriptionID: "sub1", ClientID: "app", TenantID: "tenant1", ClientSecret: "secret", ResourceManagerEndpoint: "https://management.usgovcloudapi.net"},
+	} {
+		_, err := NewClient(cfg)
+		assert.NoError(t, err)
+	}
+
+	_, err := NewClient(Config{})
+	assert.Error(t, err)
+}
+
+func TestGenerateMetadata(t *testing.T) {
+	group := &ContainerGroup{ID: groupID, Name: "web", ResourceGroup: "rg1", Location: "westeurope", IP: "20.1.2.3", Tags: map[string]string{"team": "payments"}}
+	assert.Equal(t, mapstr.M{
+		"container": mapstr.M{
+			"name":  "nginx",
+			"image": mapstr.M{"name": "nginx:latest"},
+		},
+		"cloud": mapstr.M{
+			"provider": "azure",
+			"service":  mapstr.M{"name": "Container Instances"},
+			"region":   "westeurope",
+			"account":  mapstr.M{"id": "sub1"},
+		},
+		"azure": mapstr.M{
+			"resource_group": "rg1",
+			"container_group": mapstr.M{
+				"id":   groupID,
+				"name": "web",
+				"ip":   "20.1.2.3",
+				"tags": mapstr.M{"team": "payments"},
+			},
+		},
+	}, GenerateMetadata(&Container{Name: "nginx", Image: "nginx:latest", Group: group}))
+}
@@ -18,7 +18,10 @@
 package bus
 
 import (
+	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/elastic/elastic-agent-libs/keystore"
 	"github.com/elastic/elastic-agent-libs/logp"
@@ -37,6 +40,15 @@ type Bus interface {
 	Subscribe(filter ...string) Listener
 }
 
+// MatchSubscriber is a Bus that can filter events with predicates, the buses created by this
+// package implement it
+type MatchSubscriber interface {
+	Bus
+
+	// SubscribeMatch subscribes to all events, filter them to the ones matching *all* the predicates
+	SubscribeMatch(predicates ...Predicate) Listener
+}
+
 // Provider for keystore
 type KeystoreProvider interface {
 	GetKeystore(event Event) keystore.Keystore
@@ -53,33 +65,86 @@ type Listener interface {
 
 type bus struct {
 	sync.RWMutex
-	log       *logp.Logger
-	listeners []*listener
-	store     chan Event
+	name       string
+	log        *logp.Logger
+	listeners  []*listener
+	named      map[string]*listener
+	store      chan Event
+	replay     *replay
+	journal    *journal
+	expiration *expiration
+	topics     []string
+	metrics    BusMetrics
+	onDrop     DropHandler
+	queueSize  int
+	overflow   OverflowPolicy
+	priority   PriorityOptions
+	lastID     int
 }
 
 type listener struct {
-	filter  []string
-	channel chan Event
-	bus     *bus
+	id         string
+	name       string
+	filter     []string
+	predicates []Predicate
+	channel    chan Event
+	queue      *orderedQueue // queue of prioritized events, if enabled
+	bus        *bus
+	paused     atomic.Bool
+	stopOnce   sync.Once
 }
 
 // New initializes a new bus with the given name and returns it
 func New(log *logp.Logger, name string) Bus {
-	return &bus{
-		log:       createLogger(log, name),
-		listeners: make([]*listener, 0),
-	}
+	return newBus(log, name, Options{})
 }
 
 // NewBusWithStore allows to create a buffered bus when producers send data without
 // listeners being subscribed to them. size determines the size of the buffer.
 func NewBusWithStore(log *logp.Logger, name string, size int) Bus {
-	return &bus{
-		log:       createLogger(log, name),
+	b := newBus(log, name, Options{})
+	b.store = make(chan Event, size)
+	return b
+}
+
+// NewWithOptions initializes a new bus with the given name and options and returns it
+func NewWithOptions(log *logp.Logger, name string, opts Options) Bus {
+	return newBus(log, name, opts)
+}
+
+func newBus(log *logp.Logger, name string, opts Options) *bus {
+	metrics := opts.Metrics
+	if metrics == nil {
+		metrics = noopMetrics{}
+	}
+	queueSize := opts.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	logger := createLogger(log, name)
+	journal, err := newJournal(logger, opts.Journal)
+	if err != nil {
+		logger.Errorf("Journal of bus disabled: %v", err)
+	}
+	if len(opts.Priority.Topics) > 0 && opts.Priority.Key == nil {
+		logger.Error("Priorities of bus disabled: key is required")
+	}
+	b := &bus{
+		name:      name,
+		journal:   journal,
+		log:       logger,
 		listeners: make([]*listener, 0),
-		store:     make(chan Event, size),
+		named:     make(map[string]*listener),
+		replay:    newReplay(opts.Replay),
+		topics:    opts.Topics,
+		metrics:   metrics,
+		onDrop:    opts.OnDrop,
+		queueSize: queueSize,
+		overflow:  opts.Overflow,
+		priority:  opts.Priority,
 	}
+	b.expiration = newExpiration(opts.Expiration, b.Publish)
+	return b
 }
 
 func createLogger(log *logp.Logger, name string) *logp.Logger {
@@ -92,6 +157,26 @@ func (b *bus) Publish(e Event) {
 	defer b.RUnlock()
 
 	b.log.Debugf("%+v", e)
+	topics := b.eventTopics(e)
+	if tap := currentTap(); tap != nil {
+		// Copied before delivering it, listeners may modify the event
+		tapped := TapEvent{
+			Bus:         b.name,
+			Topics:      topics,
+			Event:       Event(mapstr.M(e).Clone()),
+			PublishedAt: time.Now(),
+		}
+		defer func() {
+			tapped.DeliveredAt = time.Now()
+			tap.Tap(tapped)
+		}()
+	}
+	for _, topic := range topics {
+		b.metrics.Published(topic)
+	}
+	b.replay.add(e)
+	b.journal.record(e)
+	b.expiration.record(e)
 	if len(b.listeners) == 0 && b.store != nil {
 		b.store <- e
 		return
@@ -102,43 +187,173 @@ func (b *bus) Publish(e Event) {
 		for !doBreak {
 			select {
 			case eve := <-b.store:
-				for _, listener := range b.listeners {
-					if listener.interested(eve) {
-						listener.channel <- eve
-					}
-				}
+				b.deliver(eve, b.eventTopics(eve))
 			default:
 				doBreak = true
 			}
 		}
 	}
 
+	b.deliver(e, topics)
+}
+
+// deliver an event to the interested listeners
+func (b *bus) deliver(e Event, topics []string) {
+	interested := false
 	for _, listener := range b.listeners {
-		if listener.interested(e) {
-			listener.channel <- e
+		if listener.Paused() || !listener.interested(e) {
+			continue
+		}
+		interested = true
+		if reason, ok := b.send(listener, e); ok {
+			for _, topic := range topics {
+				b.metrics.Delivered(topic)
+			}
+		} else {
+			b.dropped(e, topics, listener.id, reason)
+		}
+		b.metrics.QueueDepth(listener.id, listener.depth(), listener.capacity())
+	}
+	if !interested {
+		for _, topic := range topics {
+			b.metrics.Filtered(topic)
 		}
 	}
 }
 
-func (b *bus) Subscribe(filter ...string) Listener {
-	listener := &listener{
-		filter:  filter,
-		bus:     b,
-		channel: make(chan Event, 100),
+// send an event to a listener following the overflow policy if its queue is full, returns false
+// with the reason if the event is dropped
+func (b *bus) send(l *listener, e Event) (DropReason, bool) {
+	if l.queue != nil {
+		return b.sendOrdered(l, e)
+	}
+	switch b.overflow {
+	case OverflowDropNewest:
+		select {
+		case l.channel <- e:
+			return "", true
+		default:
+			b.log.Debugf("Queue of %s is full, dropping event", l.id)
+			return DropQueueFull, false
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case l.channel <- e:
+				return "", true
+			default:
+			}
+			// The listener may consume the oldest event meanwhile
+			select {
+			case oldest := <-l.channel:
+				b.log.Debugf("Queue of %s is full, dropping its oldest event", l.id)
+				b.dropped(oldest, b.eventTopics(oldest), l.id, DropEvicted)
+			default:
+			}
+		}
+	default:
+		l.channel <- e
+		return "", true
+	}
+}
+
+// sendOrdered queues an event for a listener with prioritized events
+func (b *bus) sendOrdered(l *listener, e Event) (DropReason, bool) {
+	queued := queuedEvent{event: e, key: b.priority.Key(e), priority: b.priority.prioritized(e)}
+	dropped, ok := l.queue.push(queued, b.overflow)
+	for _, oldest := range dropped {
+		b.log.Debugf("Queue of %s is full, dropping its oldest event", l.id)
+		b.dropped(oldest, b.eventTopics(oldest), l.id, DropEvicted)
+	}
+	if !ok {
+		if l.queue.isClosed() {
+			return DropListenerStopped, false
+		}
+		b.log.Debugf("Queue of %s is full, dropping event", l.id)
+		return DropQueueFull, false
 	}
+	return "", true
+}
+
+// eventTopics returns the topics of an event for the metrics
+func (b *bus) eventTopics(e Event) []string {
+	var topics []string
+	for _, topic := range b.topics {
+		if _, ok := e[topic]; ok {
+			topics = append(topics, topic)
+		}
+	}
+	if len(topics) == 0 {
+		return []string{NoTopic}
+	}
+	return topics
+}
 
+func (b *bus) Subscribe(filter ...string) Listener {
+	return b.subscribe(&listener{filter: filter})
+}
+
+func (b *bus) SubscribeMatch(predicates ...Predicate) Listener {
+	return b.subscribe(&listener{predicates: predicates})
+}
+
+func (b *bus) subscribe(listener *listener) Listener {
 	b.Lock()
 	defer b.Unlock()
-	b.listeners = append(b.listeners, listener)
 
+	b.addListener(listener)
 	return listener
 }
 
+// addListener initializes a listener and adds it to the bus, it must be called with the lock held
+func (b *bus) addListener(listener *listener) {
+	listener.bus = b
+	b.lastID++
+	listener.id = listener.name
+	if listener.id == "" {
+		listener.id = fmt.Sprintf("listener-%d", b.lastID)
+	}
+
+	// Events recovered from the journal and kept for replay are delivered before any new event,
+	// the channel is big enough to hold them so subscribing doesn't block
+	replayed := append(b.journal.events(listener), b.replay.events(listener)...)
+	size := b.queueSize
+	if len(replayed) > size {
+		size = len(replayed)
+	}
+	if b.priority.enabled() {
+		// Events are queued and moved to an unbuffered channel, so they can be reordered
+		listener.queue = newOrderedQueue(b.queueSize)
+		for _, e := range replayed {
+			listener.queue.insert(queuedEvent{event: e, key: b.priority.Key(e), priority: b.priority.prioritized(e)})
+		}
+		listener.channel = make(chan Event)
+		go listener.queue.pump(listener.channel)
+	} else {
+		listener.channel = make(chan Event, size)
+		for _, e := range replayed {
+			listener.channel <- e
+		}
+	}
+
+	b.listeners = append(b.listeners, listener)
+	b.metrics.QueueDepth(listener.id, listener.depth(), listener.capacity())
+}
+
 func (l *listener) Events() <-chan Event {
 	return l.channel
 }
 
 func (l *listener) Stop() {
+	l.stopOnce.Do(l.stop)
+}
+
+func (l *listener) stop() {
+	// The queue is closed first to unblock the publishers waiting for room in it
+	if l.queue != nil {
+		l.queue.close()
+	}
+
 	l.bus.Lock()
 	defer l.bus.Unlock()
 
@@ -147,8 +362,31 @@ func (l *listener) Stop() {
 			l.bus.listeners = append(l.bus.listeners[:i], l.bus.listeners[i+1:]...)
 		}
 	}
+	if l.name != "" {
+		delete(l.bus.named, l.name)
+	}
+	l.bus.metrics.Unsubscribed(l.id)
 
-	close(l.channel)
+	// With a queue the channel is closed by its pump
+	if l.queue == nil {
+		close(l.channel)
+	}
+}
+
+// depth returns the number of events queued for the listener
+func (l *listener) depth() int {
+	if l.queue != nil {
+		return l.queue.len()
+	}
+	return len(l.channel)
+}
+
+// capacity returns the number of events that can be queued for the listener
+func (l *listener) capacity() int {
+	if l.queue != nil {
+		return l.queue.size
+	}
+	return cap(l.channel)
 }
 
 // Return true if listener is interested on the given event
@@ -158,5 +396,10 @@ func (l *listener) interested(e Event) bool {
 			return false
 		}
 	}
+	for _, predicate := range l.predicates {
+		if !predicate(e) {
+			return false
+		}
+	}
 	return true
 }
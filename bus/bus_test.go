@@ -19,6 +19,7 @@ package bus
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -119,3 +120,51 @@ func TestUnsubscribedBus(t *testing.T) {
 	event2 := <-listener.Events()
 	assert.Equal(t, event2, Event{"a": 1, "b": 2})
 }
+
+func TestOverflowDropNewest(t *testing.T) {
+	metrics := NewMetrics()
+	bus := NewWithOptions(logp.L(), "name", Options{QueueSize: 2, Overflow: OverflowDropNewest, Metrics: metrics})
+	slow := bus.Subscribe()
+	fast := bus.Subscribe()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 4; i++ {
+			bus.Publish(Event{"n": i})
+			assert.Equal(t, Event{"n": i}, <-fast.Events())
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("publish blocked by a slow listener")
+	}
+
+	assert.Equal(t, Event{"n": 0}, <-slow.Events())
+	assert.Equal(t, Event{"n": 1}, <-slow.Events())
+	assert.Empty(t, slow.Events())
+	assert.Equal(t, TopicStats{Published: 4, Delivered: 6, Dropped: 2}, metrics.Stats().Topics[NoTopic])
+}
+
+func TestOverflowDropOldest(t *testing.T) {
+	metrics := NewMetrics()
+	bus := NewWithOptions(logp.L(), "name", Options{QueueSize: 2, Overflow: OverflowDropOldest, Metrics: metrics})
+	slow := bus.Subscribe()
+
+	for i := 0; i < 4; i++ {
+		bus.Publish(Event{"n": i})
+	}
+
+	assert.Equal(t, Event{"n": 2}, <-slow.Events())
+	assert.Equal(t, Event{"n": 3}, <-slow.Events())
+	assert.Equal(t, TopicStats{Published: 4, Delivered: 4, Dropped: 2}, metrics.Stats().Topics[NoTopic])
+}
+
+func TestOverflowPolicyUnpack(t *testing.T) {
+	var p OverflowPolicy
+	assert.NoError(t, p.Unpack("drop_oldest"))
+	assert.Equal(t, OverflowDropOldest, p)
+	assert.Equal(t, "drop_oldest", p.String())
+	assert.Error(t, p.Unpack("discard"))
+}
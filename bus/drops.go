@@ -0,0 +1,56 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bus
+
+// DropReason is the reason why an event was not delivered to a listener
+type DropReason string
+
+const (
+	// DropQueueFull is the reason of the events not queued because the queue of the listener is
+	// full, with the OverflowDropNewest policy
+	DropQueueFull DropReason = "queue_full"
+	// DropEvicted is the reason of the queued events evicted to make room for newer events, with
+	// the OverflowDropOldest policy
+	DropEvicted DropReason = "evicted"
+	// DropListenerStopped is the reason of the events not queued because the listener stopped
+	// while the publisher waited for room in its queue
+	DropListenerStopped DropReason = "listener_stopped"
+)
+
+// DroppedEvent is an event that was not delivered to a listener
+type DroppedEvent struct {
+	Event  Event
+	Reason DropReason
+	// Listener is the ID of the listener, as in the queue depth metrics
+	Listener string
+}
+
+// DropHandler is called for every event lost by a listener, events no listener is interested in
+// are filtered and not reported. It is called by the publisher with the bus locked, so it must
+// not block, publish or subscribe to the same bus.
+type DropHandler func(DroppedEvent)
+
+// dropped reports an event not delivered to a listener
+func (b *bus) dropped(e Event, topics []string, listener string, reason DropReason) {
+	for _, topic := range topics {
+		b.metrics.Dropped(topic)
+	}
+	if b.onDrop != nil {
+		b.onDrop(DroppedEvent{Event: e, Reason: reason, Listener: listener})
+	}
+}
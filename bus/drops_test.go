@@ -0,0 +1,66 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+func TestDropHandler(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		overflow OverflowPolicy
+		expected []DroppedEvent
+	}{
+		{
+			name:     "drop newest",
+			overflow: OverflowDropNewest,
+			expected: []DroppedEvent{
+				{Event: Event{"n": 3}, Reason: DropQueueFull, Listener: "listener-1"},
+			},
+		},
+		{
+			name:     "drop oldest",
+			overflow: OverflowDropOldest,
+			expected: []DroppedEvent{
+				{Event: Event{"n": 1}, Reason: DropEvicted, Listener: "listener-1"},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var dropped []DroppedEvent
+			bus := NewWithOptions(logp.L(), "drops", Options{
+				QueueSize: 2,
+				Overflow:  test.overflow,
+				OnDrop:    func(e DroppedEvent) { dropped = append(dropped, e) },
+			})
+
+			bus.Publish(Event{"n": 0})
+			listener := bus.Subscribe()
+			defer listener.Stop()
+			for i := 1; i <= 3; i++ {
+				bus.Publish(Event{"n": i})
+			}
+			assert.Equal(t, test.expected, dropped)
+		})
+	}
+}
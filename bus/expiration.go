@@ -0,0 +1,157 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bus
+
+import (
+	"sync"
+	"time"
+)
+
+// ExpiredKey is set in the stop events synthesized when an event expires
+const ExpiredKey = "expired"
+
+// ExpirationOptions configures the expiration of the started events not refreshed in time, for
+// providers that can't reliably detect that something stopped. When a started event expires, the
+// bus publishes a copy of it as a stop event.
+type ExpirationOptions struct {
+	// TTL is the time after which a started event expires if no event with the same key is
+	// published, events don't expire by default
+	TTL time.Duration
+
+	// TTLKey is the key of events overriding the TTL, with a duration or a duration string
+	// value, "ttl" by default. Events with a TTL expire even if there is no default TTL. The TTL
+	// of a start event is kept when it is refreshed by events that don't override it.
+	TTLKey string
+
+	// Key returns the key of an event, e.g. the address of an endpoint, it is required to
+	// expire events. Events without key never expire.
+	Key func(Event) string
+
+	// StartTopic and StopTopic are the keys of the start and stop events, "start" and "stop" by
+	// default
+	StartTopic string
+	StopTopic  string
+}
+
+type expiringEvent struct {
+	event Event
+	ttl   time.Duration
+	timer *time.Timer
+}
+
+type expiration struct {
+	sync.Mutex
+	ExpirationOptions
+	events  map[string]*expiringEvent
+	publish func(Event)
+}
+
+// newExpiration returns nil if events don't expire
+func newExpiration(opts ExpirationOptions, publish func(Event)) *expiration {
+	if opts.Key == nil {
+		return nil
+	}
+	if opts.TTLKey == "" {
+		opts.TTLKey = "ttl"
+	}
+	if opts.StartTopic == "" {
+		opts.StartTopic = "start"
+	}
+	if opts.StopTopic == "" {
+		opts.StopTopic = "stop"
+	}
+	return &expiration{
+		ExpirationOptions: opts,
+		events:            make(map[string]*expiringEvent),
+		publish:           publish,
+	}
+}
+
+// record starts, refreshes or stops the expiration of the event key. Start events are tracked,
+// any other event with the key of a tracked event refreshes it, and stop events untrack it.
+func (x *expiration) record(e Event) {
+	if x == nil {
+		return
+	}
+	key := x.Key(e)
+	if key == "" {
+		return
+	}
+
+	x.Lock()
+	defer x.Unlock()
+
+	current, tracked := x.events[key]
+	if tracked {
+		current.timer.Stop()
+		delete(x.events, key)
+	}
+	if _, ok := e[x.StopTopic]; ok {
+		return
+	}
+
+	started := current
+	if _, ok := e[x.StartTopic]; ok {
+		started = &expiringEvent{event: e, ttl: x.TTL}
+	} else if !tracked {
+		return
+	}
+
+	ttl := started.ttl
+	if override, ok := x.ttl(e); ok {
+		ttl = override
+	}
+	if ttl <= 0 {
+		return
+	}
+	expiring := &expiringEvent{event: started.event, ttl: ttl}
+	expiring.timer = time.AfterFunc(ttl, func() { x.expire(key, expiring) })
+	x.events[key] = expiring
+}
+
+// ttl returns the TTL set in an event, false if it doesn't override it
+func (x *expiration) ttl(e Event) (time.Duration, bool) {
+	switch ttl := e[x.TTLKey].(type) {
+	case time.Duration:
+		return ttl, true
+	case string:
+		if d, err := time.ParseDuration(ttl); err == nil {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// expire publishes the stop of an event if it is still the last one of its key
+func (x *expiration) expire(key string, expiring *expiringEvent) {
+	x.Lock()
+	if x.events[key] != expiring {
+		x.Unlock()
+		return
+	}
+	delete(x.events, key)
+	x.Unlock()
+
+	stop := Event{x.StopTopic: true, ExpiredKey: true}
+	for k, v := range expiring.event {
+		if k != x.StartTopic && k != x.TTLKey {
+			stop[k] = v
+		}
+	}
+	x.publish(stop)
+}
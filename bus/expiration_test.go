@@ -0,0 +1,106 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+func TestExpiration(t *testing.T) {
+	bus := NewWithOptions(logp.L(), "expiration", Options{
+		Expiration: ExpirationOptions{
+			TTL: 50 * time.Millisecond,
+			Key: func(e Event) string { id, _ := e["id"].(string); return id },
+		},
+	})
+	listener := bus.Subscribe()
+
+	bus.Publish(Event{"start": true, "id": "a", "host": "10.0.0.1"})
+	bus.Publish(Event{"start": true, "id": "b", "ttl": "5s"})
+	bus.Publish(Event{"start": true, "id": "c"})
+	bus.Publish(Event{"stop": true, "id": "c"})
+	receiveN(listener, 4)
+
+	// Refreshed before expiring
+	time.Sleep(30 * time.Millisecond)
+	bus.Publish(Event{"update": true, "id": "a"})
+	receiveN(listener, 1)
+
+	select {
+	case e := <-listener.Events():
+		assert.Equal(t, Event{"stop": true, ExpiredKey: true, "id": "a", "host": "10.0.0.1"}, e)
+	case <-time.After(time.Second):
+		t.Fatal("expired stop event not published")
+	}
+
+	// Stopped and long lived events don't expire
+	select {
+	case e := <-listener.Events():
+		t.Fatalf("unexpected event %v", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestExpirationPerEventTTL(t *testing.T) {
+	bus := NewWithOptions(logp.L(), "expiration", Options{
+		Expiration: ExpirationOptions{
+			Key: func(e Event) string { id, _ := e["id"].(string); return id },
+		},
+	})
+	listener := bus.Subscribe("stop")
+
+	start := time.Now()
+	bus.Publish(Event{"start": true, "id": "a"})
+	bus.Publish(Event{"start": true, "id": "b", "ttl": 20 * time.Millisecond})
+
+	e := <-listener.Events()
+	assert.Equal(t, Event{"stop": true, ExpiredKey: true, "id": "b"}, e)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	assert.Empty(t, listener.Events())
+}
+
+func TestExpirationRefreshKeepsTTL(t *testing.T) {
+	bus := NewWithOptions(logp.L(), "expiration", Options{
+		Expiration: ExpirationOptions{
+			TTL: 20 * time.Millisecond,
+			Key: func(e Event) string { id, _ := e["id"].(string); return id },
+		},
+	})
+	listener := bus.Subscribe("stop")
+
+	start := time.Now()
+	bus.Publish(Event{"start": true, "id": "a", "ttl": "5s"})
+	bus.Publish(Event{"update": true, "id": "a"})
+	bus.Publish(Event{"start": true, "id": "b", "ttl": "5s"})
+	bus.Publish(Event{"update": true, "id": "b", "ttl": 50 * time.Millisecond})
+
+	// Refreshed events keep the TTL of their start unless they override it
+	e := <-listener.Events()
+	assert.Equal(t, Event{"stop": true, ExpiredKey: true, "id": "b"}, e)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	select {
+	case e := <-listener.Events():
+		t.Fatalf("unexpected event %v", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
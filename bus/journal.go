@@ -0,0 +1,361 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bus
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// JournaledKey is set in the events recovered from the journal. Recovered events contain the
+// values decoded from their JSON encoding, not the published ones: numbers are float64, nested
+// maps are map[string]interface{}, lists are []interface{}, and values like times are strings.
+const JournaledKey = "journaled"
+
+// JournalOptions configures a disk-backed journal of start and stop events. The journal keeps
+// the last start event of every key not stopped yet, and delivers them to the listeners when the
+// bus is created again, e.g. after a restart, so they know the discovered state without waiting
+// for new events. Only the events that can be encoded as JSON are journaled, recovered events
+// contain the decoded JSON values, see JournaledKey.
+//
+// Events are written to the journal in the background. Buses created with NewWithOptions
+// implement io.Closer, Close writes the pending events and closes the journal.
+type JournalOptions struct {
+	// Path of the journal file, journaling is disabled if empty
+	Path string
+
+	// Key returns the key of an event, e.g. the ID of a container. Events without key are not
+	// journaled.
+	Key func(Event) string
+
+	// StartTopic and StopTopic are the keys of the start and stop events, "start" and "stop" by
+	// default
+	StartTopic string
+	StopTopic  string
+
+	// MaxAge of the journaled events recovered, older events are discarded. All events are
+	// recovered if zero.
+	MaxAge time.Duration
+}
+
+type journalRecord struct {
+	Stop  bool      `json:"stop,omitempty"`
+	Key   string    `json:"key"`
+	Time  time.Time `json:"time"`
+	Event Event     `json:"event,omitempty"`
+}
+
+type journal struct {
+	sync.Mutex
+	log        *logp.Logger
+	path       string
+	key        func(Event) string
+	startTopic string
+	stopTopic  string
+	state      map[string]journalRecord // key -> last start
+	recovered  map[string]journalRecord // key -> start recovered and not updated since
+	pending    [][]byte                 // records not written yet
+	closed     bool
+
+	// The file is only written by the writer goroutine once the journal is open
+	file    *os.File
+	records int // records in the file
+
+	written   chan struct{}
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// newJournal opens the journal of the options and recovers its state, it returns nil if
+// journaling is disabled
+func newJournal(log *logp.Logger, opts JournalOptions) (*journal, error) {
+	if opts.Path == "" {
+		return nil, nil
+	}
+	if opts.Key == nil {
+		return nil, fmt.Errorf("journal key is required")
+	}
+	j := &journal{
+		log:        log,
+		path:       opts.Path,
+		key:        opts.Key,
+		startTopic: opts.StartTopic,
+		stopTopic:  opts.StopTopic,
+		state:      make(map[string]journalRecord),
+		written:    make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	if j.startTopic == "" {
+		j.startTopic = "start"
+	}
+	if j.stopTopic == "" {
+		j.stopTopic = "stop"
+	}
+
+	if err := j.load(opts.MaxAge); err != nil {
+		return nil, err
+	}
+	j.recovered = make(map[string]journalRecord, len(j.state))
+	for key, record := range j.state {
+		j.recovered[key] = record
+	}
+	if err := j.compact(j.sortedState(j.state)); err != nil {
+		return nil, err
+	}
+	go j.writer()
+	return j, nil
+}
+
+// load the state from the journal file, corrupted records, like the last one if the process
+// crashed while writing it, are skipped
+func (j *journal) load(maxAge time.Duration) error {
+	f, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open bus journal: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var record journalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			j.log.Warnf("Skipping corrupted bus journal record: %v", err)
+			continue
+		}
+		j.apply(record)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read bus journal: %w", err)
+	}
+
+	if maxAge > 0 {
+		oldest := time.Now().Add(-maxAge)
+		for key, record := range j.state {
+			if record.Time.Before(oldest) {
+				j.state[key] = journalRecord{}
+			}
+		}
+	}
+	for key, record := range j.state {
+		if record.Key == "" {
+			delete(j.state, key)
+		}
+	}
+	return nil
+}
+
+func (j *journal) apply(record journalRecord) {
+	if record.Stop {
+		delete(j.state, record.Key)
+		return
+	}
+	j.state[record.Key] = record
+}
+
+// record journals a start or stop event, it is written by the writer goroutine
+func (j *journal) record(e Event) {
+	if j == nil {
+		return
+	}
+	_, start := e[j.startTopic]
+	_, stop := e[j.stopTopic]
+	if start == stop {
+		return
+	}
+	key := j.key(e)
+	if key == "" {
+		return
+	}
+
+	record := journalRecord{Stop: stop, Key: key, Time: time.Now()}
+	if start {
+		record.Event = e
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		j.log.Warnf("Event of %s cannot be journaled: %v", key, err)
+		return
+	}
+
+	j.Lock()
+	if j.closed {
+		j.Unlock()
+		return
+	}
+	delete(j.recovered, key)
+	j.apply(record)
+	j.pending = append(j.pending, append(line, '\n'))
+	j.Unlock()
+
+	select {
+	case j.written <- struct{}{}:
+	default:
+	}
+}
+
+// writer writes the pending records until the journal is closed
+func (j *journal) writer() {
+	defer close(j.stopped)
+	for {
+		select {
+		case <-j.written:
+			j.flush()
+		case <-j.done:
+			j.flush()
+			j.file.Close()
+			return
+		}
+	}
+}
+
+// flush writes the pending records, or rewrites the journal when most of its records would be
+// outdated
+func (j *journal) flush() {
+	j.Lock()
+	pending := j.pending
+	j.pending = nil
+	var state []journalRecord
+	if j.records+len(pending) > 2*len(j.state)+100 {
+		// The state already contains the pending records
+		state = j.sortedState(j.state)
+	}
+	j.Unlock()
+
+	if state != nil {
+		if err := j.compact(state); err != nil {
+			j.log.Errorf("Failed to compact bus journal: %v", err)
+		}
+		return
+	}
+	for _, line := range pending {
+		if _, err := j.file.Write(line); err != nil {
+			j.log.Errorf("Failed to write bus journal: %v", err)
+			return
+		}
+		j.records++
+	}
+}
+
+// close writes the pending records and closes the journal
+func (j *journal) close() {
+	if j == nil {
+		return
+	}
+	j.closeOnce.Do(func() {
+		j.Lock()
+		j.closed = true
+		j.Unlock()
+		close(j.done)
+		<-j.stopped
+	})
+}
+
+// compact rewrites the journal with only the records of the current state
+func (j *journal) compact(state []journalRecord) error {
+	tmp := j.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create bus journal: %w", err)
+	}
+
+	w := bufio.NewWriter(f)
+	for _, record := range state {
+		line, err := json.Marshal(record)
+		if err != nil {
+			continue
+		}
+		_, _ = w.Write(append(line, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write bus journal: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write bus journal: %w", err)
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		return fmt.Errorf("failed to replace bus journal: %w", err)
+	}
+
+	if j.file != nil {
+		j.file.Close()
+	}
+	j.file, err = os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open bus journal %s: %w", filepath.Base(j.path), err)
+	}
+	j.records = len(state)
+	return nil
+}
+
+// events returns the recovered start events the listener is interested in, in the order they
+// were journaled
+func (j *journal) events(l *listener) []Event {
+	if j == nil {
+		return nil
+	}
+
+	j.Lock()
+	defer j.Unlock()
+
+	var events []Event
+	for _, record := range j.sortedState(j.recovered) {
+		e := Event{JournaledKey: true}
+		for k, v := range record.Event {
+			e[k] = v
+		}
+		if l.interested(e) {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+func (j *journal) sortedState(state map[string]journalRecord) []journalRecord {
+	records := make([]journalRecord, 0, len(state))
+	for _, record := range state {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(a, b int) bool {
+		if records[a].Time.Equal(records[b].Time) {
+			return records[a].Key < records[b].Key
+		}
+		return records[a].Time.Before(records[b].Time)
+	})
+	return records
+}
+
+// Close writes the pending events of the journal of the bus and closes it
+func (b *bus) Close() error {
+	b.journal.close()
+	return nil
+}
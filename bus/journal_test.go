@@ -0,0 +1,150 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bus
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+func TestJournal(t *testing.T) {
+	opts := Options{
+		Journal: JournalOptions{
+			Path: filepath.Join(t.TempDir(), "bus.journal"),
+			Key:  func(e Event) string { id, _ := e["id"].(string); return id },
+		},
+	}
+
+	bus := NewWithOptions(logp.L(), "journal", opts)
+	bus.Publish(Event{"start": true, "id": "a", "meta": map[string]interface{}{"name": "nginx"}})
+	bus.Publish(Event{"start": true, "id": "b"})
+	bus.Publish(Event{"start": true, "id": "c", "port": 8080, "hosts": []string{"10.0.0.1"}})
+	bus.Publish(Event{"stop": true, "id": "b"})
+	bus.Publish(Event{"update": true, "id": "c"})
+	bus.Publish(Event{"start": true, "id": "d", "func": func() {}})
+	require.NoError(t, bus.(io.Closer).Close())
+
+	// Bus is created again after a restart, with the decoded JSON values of the events
+	bus = NewWithOptions(logp.L(), "journal", opts)
+	listener := bus.Subscribe()
+	c := Event{"start": true, "id": "c", "port": float64(8080), "hosts": []interface{}{"10.0.0.1"}, JournaledKey: true}
+	assert.Equal(t, []Event{
+		{"start": true, "id": "a", "meta": map[string]interface{}{"name": "nginx"}, JournaledKey: true},
+		c,
+	}, receiveN(listener, 2))
+
+	// Recovered events updated since the restart are not delivered anymore
+	bus.Publish(Event{"stop": true, "id": "a"})
+	assert.Equal(t, []Event{{"stop": true, "id": "a"}}, receiveN(listener, 1))
+	assert.Equal(t, []Event{c}, receiveN(bus.Subscribe("start"), 1))
+	assert.Empty(t, bus.Subscribe("stop").Events())
+	require.NoError(t, bus.(io.Closer).Close())
+
+	// State survives another restart
+	bus = NewWithOptions(logp.L(), "journal", opts)
+	defer bus.(io.Closer).Close()
+	assert.Equal(t, []Event{c}, receiveN(bus.Subscribe(), 1))
+}
+
+func TestJournalMaxAge(t *testing.T) {
+	opts := Options{
+		Journal: JournalOptions{
+			Path: filepath.Join(t.TempDir(), "bus.journal"),
+			Key:  func(e Event) string { id, _ := e["id"].(string); return id },
+		},
+	}
+	bus := NewWithOptions(logp.L(), "journal", opts)
+	bus.Publish(Event{"start": true, "id": "a"})
+	require.NoError(t, bus.(io.Closer).Close())
+
+	time.Sleep(10 * time.Millisecond)
+	opts.Journal.MaxAge = 5 * time.Millisecond
+	bus = NewWithOptions(logp.L(), "journal", opts)
+	defer bus.(io.Closer).Close()
+	assert.Empty(t, bus.Subscribe().Events())
+}
+
+func TestJournalCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bus.journal")
+	j, err := newJournal(logp.L(), JournalOptions{
+		Path: path,
+		Key:  func(e Event) string { id, _ := e["id"].(string); return id },
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 200; i++ {
+		j.record(Event{"start": true, "id": "a"})
+		j.record(Event{"stop": true, "id": "a"})
+	}
+	j.record(Event{"start": true, "id": "b"})
+	j.close()
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Count(string(content), "\n")
+	assert.Less(t, lines, 200)
+
+	// Corrupted records are skipped
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"key":"c","event":`)
+	require.NoError(t, err)
+	f.Close()
+
+	j, err = newJournal(logp.L(), JournalOptions{
+		Path: path,
+		Key:  func(e Event) string { id, _ := e["id"].(string); return id },
+	})
+	require.NoError(t, err)
+	defer j.close()
+	assert.Len(t, j.recovered, 1)
+	assert.Contains(t, j.recovered, "b")
+}
+
+func TestJournalClosed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bus.journal")
+	bus := NewWithOptions(logp.L(), "journal", Options{
+		Journal: JournalOptions{
+			Path: path,
+			Key:  func(e Event) string { id, _ := e["id"].(string); return id },
+		},
+	})
+	bus.Publish(Event{"start": true, "id": "a"})
+	require.NoError(t, bus.(io.Closer).Close())
+	require.NoError(t, bus.(io.Closer).Close())
+
+	// Events published after closing are not journaled
+	bus.Publish(Event{"start": true, "id": "b"})
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(content), "\n"))
+}
+
+func TestJournalRequiresKey(t *testing.T) {
+	_, err := newJournal(logp.L(), JournalOptions{Path: filepath.Join(t.TempDir(), "bus.journal")})
+	assert.Error(t, err)
+}
@@ -0,0 +1,166 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bus
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// Predicate returns true if an event matches it
+type Predicate func(Event) bool
+
+// HasKeys returns a predicate matching the events containing all the keys
+func HasKeys(keys ...string) Predicate {
+	return func(e Event) bool {
+		for _, key := range keys {
+			if _, err := mapstr.M(e).GetValue(key); err != nil {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Equals returns a predicate matching the events with the given value in a key, keys can be
+// dotted paths of nested values
+func Equals(key string, value interface{}) Predicate {
+	return func(e Event) bool {
+		v, err := mapstr.M(e).GetValue(key)
+		return err == nil && reflect.DeepEqual(v, value)
+	}
+}
+
+// Match returns a predicate for a simple match expression on the values of events, e.g.
+// `provider == kubernetes && start == true`. Expressions are conditions joined by `&&` and `||`,
+// with `&&` taking precedence. Conditions are one of:
+//
+//	key == value   the value of the key, formatted as string, is equal to value
+//	key != value   the key is not present or its value is not equal to value
+//	key            the key is present
+//	!key           the key is not present
+//
+// Values can be quoted to include spaces or operators. Keys can be dotted paths of nested values.
+func Match(expr string) (Predicate, error) {
+	var alternatives []Predicate
+	for _, alternative := range splitOutsideQuotes(expr, "||") {
+		var conditions []Predicate
+		for _, condition := range splitOutsideQuotes(alternative, "&&") {
+			p, err := parseCondition(strings.TrimSpace(condition))
+			if err != nil {
+				return nil, fmt.Errorf("invalid match expression %q: %w", expr, err)
+			}
+			conditions = append(conditions, p)
+		}
+		alternatives = append(alternatives, all(conditions))
+	}
+
+	return func(e Event) bool {
+		for _, p := range alternatives {
+			if p(e) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// MustMatch is like Match but panics if the expression is invalid, for static expressions
+func MustMatch(expr string) Predicate {
+	p, err := Match(expr)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func parseCondition(condition string) (Predicate, error) {
+	for _, op := range []string{"==", "!="} {
+		parts := splitOutsideQuotes(condition, op)
+		if len(parts) == 1 {
+			continue
+		}
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("condition %q has more than one %s", condition, op)
+		}
+		key := strings.TrimSpace(parts[0])
+		if key == "" {
+			return nil, fmt.Errorf("condition %q has no key", condition)
+		}
+		value := unquote(strings.TrimSpace(parts[1]))
+		equals := func(e Event) bool {
+			v, err := mapstr.M(e).GetValue(key)
+			return err == nil && fmt.Sprint(v) == value
+		}
+		if op == "!=" {
+			return func(e Event) bool { return !equals(e) }, nil
+		}
+		return equals, nil
+	}
+
+	if condition == "" || condition == "!" {
+		return nil, fmt.Errorf("empty condition")
+	}
+	if key := strings.TrimPrefix(condition, "!"); key != condition {
+		has := HasKeys(strings.TrimSpace(key))
+		return func(e Event) bool { return !has(e) }, nil
+	}
+	if strings.ContainsAny(condition, " \t") {
+		return nil, fmt.Errorf("condition %q has no operator", condition)
+	}
+	return HasKeys(condition), nil
+}
+
+func all(predicates []Predicate) Predicate {
+	return func(e Event) bool {
+		for _, p := range predicates {
+			if !p(e) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// splitOutsideQuotes splits s by sep, ignoring the separators between double quotes
+func splitOutsideQuotes(s, sep string) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '"':
+			quoted = !quoted
+		case !quoted && strings.HasPrefix(s[i:], sep):
+			parts = append(parts, s[start:i])
+			start = i + len(sep)
+			i += len(sep) - 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
@@ -0,0 +1,91 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestMatch(t *testing.T) {
+	event := Event{
+		"provider":   "kubernetes",
+		"start":      true,
+		"kubernetes": mapstr.M{"namespace": "kube-system", "annotations": mapstr.M{"team": "a b"}},
+	}
+
+	for expr, expected := range map[string]bool{
+		"provider == kubernetes":                             true,
+		"provider == kubernetes && start == true":            true,
+		"provider == docker && start == true":                false,
+		"provider == docker || start == true":                true,
+		"provider==kubernetes&&start==true":                  true,
+		"kubernetes.namespace == kube-system":                true,
+		`kubernetes.annotations.team == "a b"`:               true,
+		"provider != docker":                                 true,
+		"stop != true":                                       true,
+		"start":                                              true,
+		"stop":                                               false,
+		"!stop && start":                                     true,
+		"!start":                                             false,
+		`provider == "kubernetes && docker"`:                 false,
+		"provider == docker && stop || kubernetes.namespace": true,
+	} {
+		p, err := Match(expr)
+		require.NoError(t, err, expr)
+		assert.Equal(t, expected, p(event), expr)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"provider == kubernetes &&",
+		"== kubernetes",
+		"provider kubernetes",
+		"provider == a == b",
+		"!",
+	} {
+		_, err := Match(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestPredicates(t *testing.T) {
+	event := Event{"start": true, "container": mapstr.M{"id": "a"}}
+	assert.True(t, HasKeys("start", "container.id")(event))
+	assert.False(t, HasKeys("start", "container.name")(event))
+	assert.True(t, Equals("container.id", "a")(event))
+	assert.False(t, Equals("start", "true")(event))
+	assert.False(t, Equals("container", mapstr.M{"id": "b"})(event))
+}
+
+func TestSubscribeMatch(t *testing.T) {
+	bus := New(logp.L(), "match").(MatchSubscriber)
+	listener := bus.SubscribeMatch(MustMatch("provider == kubernetes && start == true"))
+
+	bus.Publish(Event{"provider": "docker", "start": true})
+	bus.Publish(Event{"provider": "kubernetes", "stop": true})
+	bus.Publish(Event{"provider": "kubernetes", "start": true})
+
+	assert.Equal(t, Event{"provider": "kubernetes", "start": true}, <-listener.Events())
+	assert.Empty(t, listener.Events())
+}
@@ -0,0 +1,205 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bus
+
+import (
+	"sync"
+
+	"github.com/elastic/elastic-agent-autodiscover/metrics"
+)
+
+// NoTopic is the topic of the events without any of the topics of the bus in the metrics
+const NoTopic = "none"
+
+// BusMetrics receives the metrics of a bus, implementations must be safe for concurrent use
+type BusMetrics interface {
+	// Published is called for every event published, once per topic of the event
+	Published(topic string)
+
+	// Delivered is called for every event delivered to a listener, once per topic of the event
+	Delivered(topic string)
+
+	// Dropped is called for every event lost by a listener, because its queue is full or the
+	// event expired, once per topic of the event
+	Dropped(topic string)
+
+	// Filtered is called for every event no listener is interested in, once per topic of the
+	// event, these events are not lost
+	Filtered(topic string)
+
+	// QueueDepth is called with the number of events queued for a listener, a depth close to
+	// the capacity means that the listener is not consuming its events
+	QueueDepth(listener string, depth, capacity int)
+
+	// Unsubscribed is called when a listener stops
+	Unsubscribed(listener string)
+}
+
+// TopicStats are the counters of the events of a topic
+type TopicStats struct {
+	Published int64
+	Delivered int64
+	Dropped   int64
+	Filtered  int64
+}
+
+// QueueStats are the last reported queue depth of a listener
+type QueueStats struct {
+	Depth    int
+	Capacity int
+}
+
+// Stats are the counters of a bus
+type Stats struct {
+	Topics    map[string]TopicStats
+	Listeners map[string]QueueStats
+}
+
+// Metrics is a BusMetrics keeping the counters in memory
+type Metrics struct {
+	sync.Mutex
+	topics    map[string]*TopicStats
+	listeners map[string]QueueStats
+}
+
+// NewMetrics creates an empty Metrics
+func NewMetrics() *Metrics {
+	return &Metrics{
+		topics:    make(map[string]*TopicStats),
+		listeners: make(map[string]QueueStats),
+	}
+}
+
+// Stats returns a snapshot of the counters
+func (m *Metrics) Stats() Stats {
+	m.Lock()
+	defer m.Unlock()
+
+	stats := Stats{
+		Topics:    make(map[string]TopicStats, len(m.topics)),
+		Listeners: make(map[string]QueueStats, len(m.listeners)),
+	}
+	for topic, s := range m.topics {
+		stats.Topics[topic] = *s
+	}
+	for listener, s := range m.listeners {
+		stats.Listeners[listener] = s
+	}
+	return stats
+}
+
+// Published counts a published event of the topic
+func (m *Metrics) Published(topic string) {
+	m.Lock()
+	defer m.Unlock()
+	m.topic(topic).Published++
+}
+
+// Delivered counts a delivered event of the topic
+func (m *Metrics) Delivered(topic string) {
+	m.Lock()
+	defer m.Unlock()
+	m.topic(topic).Delivered++
+}
+
+// Dropped counts a dropped event of the topic
+func (m *Metrics) Dropped(topic string) {
+	m.Lock()
+	defer m.Unlock()
+	m.topic(topic).Dropped++
+}
+
+// Filtered counts an event of the topic no listener is interested in
+func (m *Metrics) Filtered(topic string) {
+	m.Lock()
+	defer m.Unlock()
+	m.topic(topic).Filtered++
+}
+
+// QueueDepth sets the queue depth of the listener
+func (m *Metrics) QueueDepth(listener string, depth, capacity int) {
+	m.Lock()
+	defer m.Unlock()
+	m.listeners[listener] = QueueStats{Depth: depth, Capacity: capacity}
+}
+
+// Unsubscribed removes the queue depth of the listener
+func (m *Metrics) Unsubscribed(listener string) {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.listeners, listener)
+}
+
+func (m *Metrics) topic(topic string) *TopicStats {
+	s, ok := m.topics[topic]
+	if !ok {
+		s = &TopicStats{}
+		m.topics[topic] = s
+	}
+	return s
+}
+
+// registryMetrics is a BusMetrics reporting to a metrics registry
+type registryMetrics struct {
+	bus           string
+	published     metrics.Counter
+	delivered     metrics.Counter
+	dropped       metrics.Counter
+	filtered      metrics.Counter
+	queueDepth    metrics.Gauge
+	queueCapacity metrics.Gauge
+}
+
+// NewRegistryMetrics creates a BusMetrics reporting the metrics of the bus with the given name to
+// a metrics registry, several buses can report to the same registry
+func NewRegistryMetrics(r metrics.Registry, bus string) BusMetrics {
+	return &registryMetrics{
+		bus:           bus,
+		published:     r.Counter("autodiscover_bus_events_published_total", "Events published to the bus, per topic.", "bus", "topic"),
+		delivered:     r.Counter("autodiscover_bus_events_delivered_total", "Events delivered to the listeners of the bus, per topic.", "bus", "topic"),
+		dropped:       r.Counter("autodiscover_bus_events_dropped_total", "Events lost by the listeners of the bus, because their queue is full or they expired, per topic.", "bus", "topic"),
+		filtered:      r.Counter("autodiscover_bus_events_filtered_total", "Events no listener of the bus is interested in, per topic.", "bus", "topic"),
+		queueDepth:    r.Gauge("autodiscover_bus_listener_queue_depth", "Events queued for a listener of the bus.", "bus", "listener"),
+		queueCapacity: r.Gauge("autodiscover_bus_listener_queue_capacity", "Capacity of the queue of a listener of the bus.", "bus", "listener"),
+	}
+}
+
+func (m *registryMetrics) Published(topic string) { m.published.Add(1, m.bus, topic) }
+func (m *registryMetrics) Delivered(topic string) { m.delivered.Add(1, m.bus, topic) }
+func (m *registryMetrics) Dropped(topic string)   { m.dropped.Add(1, m.bus, topic) }
+func (m *registryMetrics) Filtered(topic string)  { m.filtered.Add(1, m.bus, topic) }
+
+func (m *registryMetrics) QueueDepth(listener string, depth, capacity int) {
+	m.queueDepth.Set(float64(depth), m.bus, listener)
+	m.queueCapacity.Set(float64(capacity), m.bus, listener)
+}
+
+func (m *registryMetrics) Unsubscribed(listener string) {
+	m.queueDepth.Delete(m.bus, listener)
+	m.queueCapacity.Delete(m.bus, listener)
+}
+
+// noopMetrics is used when no metrics are configured
+type noopMetrics struct{}
+
+func (noopMetrics) Published(string)            {}
+func (noopMetrics) Delivered(string)            {}
+func (noopMetrics) Dropped(string)              {}
+func (noopMetrics) Filtered(string)             {}
+func (noopMetrics) QueueDepth(string, int, int) {}
+func (noopMetrics) Unsubscribed(string)         {}
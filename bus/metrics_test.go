@@ -0,0 +1,98 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/elastic-agent-autodiscover/metrics"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+func TestBusMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	bus := NewWithOptions(logp.L(), "metrics", Options{
+		Topics:  []string{"start", "stop"},
+		Metrics: metrics,
+	})
+
+	// No listeners
+	bus.Publish(Event{"start": true})
+
+	starts := bus.Subscribe("start")
+	all := bus.Subscribe()
+	bus.Publish(Event{"start": true})
+	bus.Publish(Event{"stop": true})
+	bus.Publish(Event{"other": true})
+
+	stats := metrics.Stats()
+	assert.Equal(t, map[string]TopicStats{
+		"start": {Published: 2, Delivered: 2, Filtered: 1},
+		"stop":  {Published: 1, Delivered: 1},
+		NoTopic: {Published: 1, Delivered: 1},
+	}, stats.Topics)
+	assert.Equal(t, map[string]QueueStats{
+		"listener-1": {Depth: 1, Capacity: 100},
+		"listener-2": {Depth: 3, Capacity: 100},
+	}, stats.Listeners)
+
+	<-starts.Events()
+	starts.Stop()
+	all.Stop()
+	assert.Empty(t, metrics.Stats().Listeners)
+}
+
+func TestRegistryMetrics(t *testing.T) {
+	registry := metrics.NewInMemory()
+	bus := NewWithOptions(logp.L(), "metrics", Options{
+		Topics:  []string{"start"},
+		Metrics: NewRegistryMetrics(registry, "metrics"),
+	})
+
+	listener := bus.Subscribe()
+	bus.Publish(Event{"start": true})
+	bus.Publish(Event{"other": true})
+
+	for name, expected := range map[string]float64{
+		"autodiscover_bus_events_published_total": 1,
+		"autodiscover_bus_events_delivered_total": 1,
+	} {
+		value, ok := registry.Value(name, "metrics", "start")
+		assert.True(t, ok, name)
+		assert.Equal(t, expected, value, name)
+	}
+	value, _ := registry.Value("autodiscover_bus_events_published_total", "metrics", NoTopic)
+	assert.Equal(t, float64(1), value)
+	value, _ = registry.Value("autodiscover_bus_listener_queue_depth", "metrics", "listener-1")
+	assert.Equal(t, float64(2), value)
+	value, _ = registry.Value("autodiscover_bus_listener_queue_capacity", "metrics", "listener-1")
+	assert.Equal(t, float64(100), value)
+
+	listener.Stop()
+	_, ok := registry.Value("autodiscover_bus_listener_queue_depth", "metrics", "listener-1")
+	assert.False(t, ok)
+
+	// Without listeners events are filtered, not dropped
+	bus.Publish(Event{"start": true})
+	value, _ = registry.Value("autodiscover_bus_events_filtered_total", "metrics", "start")
+	assert.Equal(t, float64(1), value)
+	_, ok = registry.Value("autodiscover_bus_events_dropped_total", "metrics", "start")
+	assert.False(t, ok)
+}
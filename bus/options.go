@@ -0,0 +1,101 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bus
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultQueueSize is the number of events queued per listener by default
+const defaultQueueSize = 100
+
+// OverflowPolicy decides what to do when publishing to a listener whose queue is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the publisher until the listener consumes its events, a slow listener
+	// delays the delivery to all the other listeners
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the events published while the queue of the listener is full
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest event queued for the listener to make room for the new one
+	OverflowDropOldest
+)
+
+var overflowPolicies = map[string]OverflowPolicy{
+	"block":       OverflowBlock,
+	"drop_newest": OverflowDropNewest,
+	"drop_oldest": OverflowDropOldest,
+}
+
+// String returns the name of the policy
+func (p OverflowPolicy) String() string {
+	for name, policy := range overflowPolicies {
+		if policy == p {
+			return name
+		}
+	}
+	return fmt.Sprintf("unknown(%d)", int(p))
+}
+
+// Unpack sets the policy from its name, to use it in configurations
+func (p *OverflowPolicy) Unpack(name string) error {
+	policy, ok := overflowPolicies[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("unknown overflow policy %q", name)
+	}
+	*p = policy
+	return nil
+}
+
+// Options configures a bus
+type Options struct {
+	// Replay keeps the last events published to some topics, to deliver them to the listeners
+	// that subscribe after they were published
+	Replay ReplayOptions
+
+	// Journal keeps the discovered state on disk, to recover it when the bus is created again
+	Journal JournalOptions
+
+	// Topics are the event keys identifying the kinds of events, e.g. "start" or "stop", events
+	// are counted per topic in the metrics
+	Topics []string
+
+	// Metrics receives the metrics of the bus, if set
+	Metrics BusMetrics
+
+	// OnDrop is called with every event lost by an interested listener and the reason, if set, so
+	// the loss of events can be reported
+	OnDrop DropHandler
+
+	// QueueSize is the number of events queued per listener, 100 by default
+	QueueSize int
+
+	// Overflow is the policy applied when the queue of a listener is full, publishing blocks by
+	// default. With the drop policies publishing never blocks and slow listeners lose events
+	// instead of delaying the delivery to the other listeners.
+	Overflow OverflowPolicy
+
+	// Priority configures the events delivered before the other queued events
+	Priority PriorityOptions
+
+	// Expiration configures the stop events published for the started events not refreshed in
+	// time
+	Expiration ExpirationOptions
+}
@@ -0,0 +1,181 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bus
+
+import (
+	"sync"
+)
+
+// PriorityOptions configures the events delivered before the other events queued for a listener
+type PriorityOptions struct {
+	// Topics are the event keys of the high priority events, e.g. "stop". Events containing any
+	// of them are delivered before the normal events queued for a listener.
+	Topics []string
+
+	// Key returns the key of an event, e.g. the ID of a container, it is required to prioritize
+	// events. A high priority event is never delivered before the events queued with the same key,
+	// so a lagging listener never receives the stop of a container before its start.
+	Key func(Event) string
+}
+
+func (o PriorityOptions) enabled() bool {
+	return len(o.Topics) > 0 && o.Key != nil
+}
+
+func (o PriorityOptions) prioritized(e Event) bool {
+	for _, topic := range o.Topics {
+		if _, ok := e[topic]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+type queuedEvent struct {
+	event    Event
+	key      string
+	priority bool
+}
+
+// orderedQueue holds the events of a listener when events are prioritized, they are moved to the
+// channel of the listener by a pump goroutine
+type orderedQueue struct {
+	sync.Mutex
+	cond   *sync.Cond
+	events []queuedEvent
+	size   int
+	closed bool
+	done   chan struct{}
+}
+
+func newOrderedQueue(size int) *orderedQueue {
+	q := &orderedQueue{size: size, done: make(chan struct{})}
+	q.cond = sync.NewCond(q)
+	return q
+}
+
+// push queues an event following the overflow policy if the queue is full. High priority events
+// are never dropped, they wait for room in the queue if there are no normal events to drop. The
+// dropped events are returned, and false if the event is not queued.
+func (q *orderedQueue) push(e queuedEvent, overflow OverflowPolicy) ([]Event, bool) {
+	q.Lock()
+	defer q.Unlock()
+
+	var dropped []Event
+	for len(q.events) >= q.size && !q.closed {
+		if overflow == OverflowDropNewest && !e.priority {
+			return nil, false
+		}
+		if overflow == OverflowDropOldest {
+			if i := q.oldestNormal(); i >= 0 {
+				dropped = append(dropped, q.events[i].event)
+				q.events = append(q.events[:i], q.events[i+1:]...)
+				continue
+			}
+		}
+		q.cond.Wait()
+	}
+	if q.closed {
+		return dropped, false
+	}
+	q.insert(e)
+	q.cond.Broadcast()
+	return dropped, true
+}
+
+// insert an event in the queue, high priority events are placed after the last high priority
+// event and the last event with the same key queued, normal events at the end
+func (q *orderedQueue) insert(e queuedEvent) {
+	if !e.priority {
+		q.events = append(q.events, e)
+		return
+	}
+	i := 0
+	for j, queued := range q.events {
+		if queued.priority || queued.key == e.key {
+			i = j + 1
+		}
+	}
+	q.events = append(q.events, queuedEvent{})
+	copy(q.events[i+1:], q.events[i:])
+	q.events[i] = e
+}
+
+func (q *orderedQueue) oldestNormal() int {
+	for i, queued := range q.events {
+		if !queued.priority {
+			return i
+		}
+	}
+	return -1
+}
+
+// pop waits for the next event, returns false once the queue is closed
+func (q *orderedQueue) pop() (Event, bool) {
+	q.Lock()
+	defer q.Unlock()
+
+	for len(q.events) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return nil, false
+	}
+	e := q.events[0]
+	q.events = q.events[1:]
+	q.cond.Broadcast()
+	return e.event, true
+}
+
+func (q *orderedQueue) len() int {
+	q.Lock()
+	defer q.Unlock()
+	return len(q.events)
+}
+
+func (q *orderedQueue) isClosed() bool {
+	q.Lock()
+	defer q.Unlock()
+	return q.closed
+}
+
+func (q *orderedQueue) close() {
+	q.Lock()
+	defer q.Unlock()
+	if !q.closed {
+		q.closed = true
+		close(q.done)
+		q.cond.Broadcast()
+	}
+}
+
+// pump moves the queued events to the channel until the queue is closed
+func (q *orderedQueue) pump(channel chan Event) {
+	defer close(channel)
+	for {
+		e, ok := q.pop()
+		if !ok {
+			return
+		}
+		select {
+		case channel <- e:
+		case <-q.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+func priorityOptions() PriorityOptions {
+	return PriorityOptions{
+		Topics: []string{"stop"},
+		Key:    func(e Event) string { id, _ := e["id"].(string); return id },
+	}
+}
+
+func TestPriority(t *testing.T) {
+	bus := NewWithOptions(logp.L(), "priority", Options{Priority: priorityOptions()})
+	l := bus.Subscribe()
+
+	// Lagging listener, events are queued before it reads them
+	bus.Publish(Event{"start": true, "id": "a"})
+	waitPumped(t, l)
+	bus.Publish(Event{"start": true, "id": "b"})
+	bus.Publish(Event{"start": true, "id": "c"})
+	bus.Publish(Event{"stop": true, "id": "z"})
+	bus.Publish(Event{"stop": true, "id": "b"})
+	bus.Publish(Event{"start": true, "id": "d"})
+
+	assert.Equal(t, []Event{
+		{"start": true, "id": "a"},
+		{"stop": true, "id": "z"},
+		{"start": true, "id": "b"},
+		{"stop": true, "id": "b"},
+		{"start": true, "id": "c"},
+		{"start": true, "id": "d"},
+	}, receiveN(l, 6))
+
+	l.Stop()
+	_, ok := <-l.Events()
+	assert.False(t, ok)
+}
+
+func TestPriorityOverflow(t *testing.T) {
+	bus := NewWithOptions(logp.L(), "priority", Options{
+		Priority:  priorityOptions(),
+		QueueSize: 3,
+		Overflow:  OverflowDropOldest,
+	})
+	l := bus.Subscribe()
+
+	bus.Publish(Event{"start": true, "id": "a"})
+	waitPumped(t, l)
+
+	bus.Publish(Event{"start": true, "id": "b"})
+	bus.Publish(Event{"stop": true, "id": "x"})
+	bus.Publish(Event{"stop": true, "id": "y"})
+	// Start of b is dropped, high priority events are kept
+	bus.Publish(Event{"start": true, "id": "c"})
+
+	assert.Equal(t, []Event{
+		{"start": true, "id": "a"},
+		{"stop": true, "id": "x"},
+		{"stop": true, "id": "y"},
+		{"start": true, "id": "c"},
+	}, receiveN(l, 4))
+}
+
+func TestPriorityUnblocksOnStop(t *testing.T) {
+	bus := NewWithOptions(logp.L(), "priority", Options{Priority: priorityOptions(), QueueSize: 1})
+	listener := bus.Subscribe()
+
+	published := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			bus.Publish(Event{"start": true})
+		}
+		close(published)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	listener.Stop()
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("publisher blocked after stopping the listener")
+	}
+}
+
+// waitPumped waits for the first event to be moved to the channel of the listener
+func waitPumped(t *testing.T, l Listener) {
+	require.Eventually(t, func() bool { return l.(*listener).depth() == 0 }, time.Second, time.Millisecond)
+}
@@ -0,0 +1,138 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bus
+
+import (
+	"sort"
+	"sync"
+)
+
+// ReplayOptions configures the events kept per topic for late subscribers. The topics of an event
+// are the keys it contains, e.g. "start" or "stop".
+type ReplayOptions struct {
+	// Topics to keep events for, an event is kept if it contains any of them
+	Topics []string
+
+	// Size is the number of events kept per topic, or of keys if Key is set
+	Size int
+
+	// Key returns the key of an event, if set only the last event of every key is kept per
+	// topic, e.g. the last start event of every container
+	Key func(Event) string
+}
+
+// replay keeps the last events published to the configured topics
+type replay struct {
+	sync.Mutex
+	size    int
+	key     func(Event) string
+	topics  map[string][]replayEntry
+	lastSeq uint64
+}
+
+type replayEntry struct {
+	seq   uint64 // publication order
+	key   string
+	event Event
+}
+
+// newReplay returns the replay of the given options, or nil if no events are kept
+func newReplay(opts ReplayOptions) *replay {
+	if opts.Size <= 0 || len(opts.Topics) == 0 {
+		return nil
+	}
+	r := &replay{
+		size:   opts.Size,
+		key:    opts.Key,
+		topics: make(map[string][]replayEntry, len(opts.Topics)),
+	}
+	for _, topic := range opts.Topics {
+		r.topics[topic] = nil
+	}
+	return r
+}
+
+// add keeps the event in the buffers of its topics
+func (r *replay) add(e Event) {
+	if r == nil {
+		return
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	r.lastSeq++
+	entry := replayEntry{seq: r.lastSeq, event: e}
+	if r.key != nil {
+		entry.key = r.key(e)
+	}
+	for topic, entries := range r.topics {
+		if _, ok := e[topic]; !ok {
+			continue
+		}
+		if r.key != nil {
+			entries = removeKey(entries, entry.key)
+		}
+		entries = append(entries, entry)
+		if len(entries) > r.size {
+			entries = entries[len(entries)-r.size:]
+		}
+		r.topics[topic] = entries
+	}
+}
+
+// events returns the kept events the listener is interested in, in the order they were published
+func (r *replay) events(l *listener) []Event {
+	if r == nil {
+		return nil
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	// Events of several topics are kept once per topic
+	entries := make(map[uint64]replayEntry)
+	for _, topicEntries := range r.topics {
+		for _, entry := range topicEntries {
+			if l.interested(entry.event) {
+				entries[entry.seq] = entry
+			}
+		}
+	}
+
+	seqs := make([]uint64, 0, len(entries))
+	for seq := range entries {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	events := make([]Event, len(seqs))
+	for i, seq := range seqs {
+		events[i] = entries[seq].event
+	}
+	return events
+}
+
+func removeKey(entries []replayEntry, key string) []replayEntry {
+	for i, entry := range entries {
+		if entry.key == key {
+			return append(entries[:i:i], entries[i+1:]...)
+		}
+	}
+	return entries
+}
@@ -0,0 +1,107 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+func TestReplay(t *testing.T) {
+	bus := NewWithOptions(logp.L(), "replay", Options{
+		Replay: ReplayOptions{Topics: []string{"start", "stop"}, Size: 2},
+	})
+
+	bus.Publish(Event{"start": true, "id": "a"})
+	bus.Publish(Event{"start": true, "id": "b"})
+	bus.Publish(Event{"stop": true, "id": "a"})
+	bus.Publish(Event{"start": true, "id": "c"})
+	bus.Publish(Event{"update": true, "id": "c"})
+
+	// Last 2 events of every topic, in publication order
+	listener := bus.Subscribe()
+	assert.Equal(t, []Event{
+		{"start": true, "id": "b"},
+		{"stop": true, "id": "a"},
+		{"start": true, "id": "c"},
+	}, receiveN(listener, 3))
+
+	// Replayed events are filtered
+	stops := bus.Subscribe("stop")
+	assert.Equal(t, []Event{{"stop": true, "id": "a"}}, receiveN(stops, 1))
+
+	// New events are delivered after the replayed ones
+	bus.Publish(Event{"stop": true, "id": "b"})
+	assert.Equal(t, []Event{{"stop": true, "id": "b"}}, receiveN(stops, 1))
+	assert.Equal(t, []Event{{"stop": true, "id": "b"}}, receiveN(listener, 1))
+	assert.Empty(t, stops.Events())
+}
+
+func TestReplayLastPerKey(t *testing.T) {
+	bus := NewWithOptions(logp.L(), "replay", Options{
+		Replay: ReplayOptions{
+			Topics: []string{"start"},
+			Size:   2,
+			Key:    func(e Event) string { return e["id"].(string) },
+		},
+	})
+
+	bus.Publish(Event{"start": true, "id": "a", "version": 1})
+	bus.Publish(Event{"start": true, "id": "b", "version": 1})
+	bus.Publish(Event{"start": true, "id": "a", "version": 2})
+
+	assert.Equal(t, []Event{
+		{"start": true, "id": "b", "version": 1},
+		{"start": true, "id": "a", "version": 2},
+	}, receiveN(bus.Subscribe("start"), 2))
+
+	// The least recently published key is evicted
+	bus.Publish(Event{"start": true, "id": "c", "version": 1})
+	assert.Equal(t, []Event{
+		{"start": true, "id": "a", "version": 2},
+		{"start": true, "id": "c", "version": 1},
+	}, receiveN(bus.Subscribe("start"), 2))
+}
+
+func TestReplayBiggerThanListenerBuffer(t *testing.T) {
+	bus := NewWithOptions(logp.L(), "replay", Options{
+		Replay: ReplayOptions{Topics: []string{"start"}, Size: 500},
+	})
+	for i := 0; i < 500; i++ {
+		bus.Publish(Event{"start": true, "n": i})
+	}
+	listener := bus.Subscribe()
+	assert.Len(t, listener.Events(), 500)
+}
+
+func TestNoReplay(t *testing.T) {
+	bus := New(logp.L(), "replay")
+	bus.Publish(Event{"start": true})
+	assert.Empty(t, bus.Subscribe().Events())
+}
+
+func receiveN(l Listener, n int) []Event {
+	events := make([]Event, n)
+	for i := range events {
+		events[i] = <-l.Events()
+	}
+	return events
+}
@@ -0,0 +1,108 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bus
+
+import (
+	"fmt"
+)
+
+// NamedSubscriber is a Bus with named subscriptions, the buses created by this package implement
+// it
+type NamedSubscriber interface {
+	Bus
+
+	// SubscribeNamed subscribes to all events matching *all* the predicates with a named
+	// subscription that can be paused, it fails if the name is already in use
+	SubscribeNamed(name string, predicates ...Predicate) (Subscription, error)
+
+	// Unsubscribe removes a named subscription, returns false if it doesn't exist
+	Unsubscribe(name string) bool
+}
+
+// Subscription is the handle of a named subscription, it can be paused and unsubscribed by
+// whoever holds it, or unsubscribed by its name from the bus
+type Subscription interface {
+	Listener
+
+	// Name of the subscription
+	Name() string
+
+	// Unsubscribe removes the subscription from the bus and closes its channel, it can be called
+	// more than once
+	Unsubscribe()
+
+	// Pause the delivery of events, events published while paused are not delivered
+	Pause()
+
+	// Resume the delivery of events
+	Resume()
+
+	// Paused returns true if the delivery of events is paused
+	Paused() bool
+}
+
+// SubscribeNamed subscribes to all events matching *all* the predicates with a subscription
+// identified by its name in the bus, it fails if the name is already in use
+func (b *bus) SubscribeNamed(name string, predicates ...Predicate) (Subscription, error) {
+	if name == "" {
+		return nil, fmt.Errorf("subscription name is required")
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	if _, ok := b.named[name]; ok {
+		return nil, fmt.Errorf("subscription %q already exists in bus %s", name, b.name)
+	}
+	listener := &listener{name: name, predicates: predicates}
+	b.addListener(listener)
+	b.named[name] = listener
+	return listener, nil
+}
+
+// Unsubscribe removes a named subscription from the bus, returns false if it doesn't exist
+func (b *bus) Unsubscribe(name string) bool {
+	b.RLock()
+	listener, ok := b.named[name]
+	b.RUnlock()
+
+	if ok {
+		listener.Stop()
+	}
+	return ok
+}
+
+func (l *listener) Name() string {
+	return l.name
+}
+
+func (l *listener) Unsubscribe() {
+	l.Stop()
+}
+
+func (l *listener) Pause() {
+	l.paused.Store(true)
+}
+
+func (l *listener) Resume() {
+	l.paused.Store(false)
+}
+
+func (l *listener) Paused() bool {
+	return l.paused.Load()
+}
@@ -0,0 +1,65 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+func TestSubscribeNamed(t *testing.T) {
+	metrics := NewMetrics()
+	bus := NewWithOptions(logp.L(), "named", Options{Metrics: metrics}).(NamedSubscriber)
+
+	sub, err := bus.SubscribeNamed("provider", HasKeys("start"))
+	require.NoError(t, err)
+	assert.Equal(t, "provider", sub.Name())
+
+	_, err = bus.SubscribeNamed("provider")
+	assert.Error(t, err)
+	_, err = bus.SubscribeNamed("")
+	assert.Error(t, err)
+
+	bus.Publish(Event{"start": true, "id": "a"})
+	bus.Publish(Event{"stop": true, "id": "a"})
+	assert.Equal(t, []Event{{"start": true, "id": "a"}}, receiveN(sub, 1))
+	assert.Contains(t, metrics.Stats().Listeners, "provider")
+
+	// Events published while paused are not delivered
+	sub.Pause()
+	assert.True(t, sub.Paused())
+	bus.Publish(Event{"start": true, "id": "b"})
+	sub.Resume()
+	bus.Publish(Event{"start": true, "id": "c"})
+	assert.Equal(t, []Event{{"start": true, "id": "c"}}, receiveN(sub, 1))
+
+	assert.True(t, bus.Unsubscribe("provider"))
+	assert.False(t, bus.Unsubscribe("provider"))
+	_, ok := <-sub.Events()
+	assert.False(t, ok)
+
+	// Unsubscribing more than once is safe, and the name can be reused
+	sub.Unsubscribe()
+	sub.Stop()
+	_, err = bus.SubscribeNamed("provider")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,101 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bus
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// Tap receives a copy of every event published to any bus, for debugging and tests
+type Tap interface {
+	// Tap is called once the event has been delivered to the listeners, it must not block
+	Tap(TapEvent)
+}
+
+// TapEvent is a copy of a published event
+type TapEvent struct {
+	// Bus is the name of the bus the event was published to
+	Bus string
+	// Topics of the event in the bus
+	Topics []string
+	// Event is a copy of the event taken before delivering it
+	Event Event
+	// PublishedAt is the time the event was published
+	PublishedAt time.Time
+	// DeliveredAt is the time the event was delivered to all the listeners
+	DeliveredAt time.Time
+}
+
+// TapFunc is a function implementing Tap
+type TapFunc func(TapEvent)
+
+// Tap calls the function
+func (f TapFunc) Tap(e TapEvent) { f(e) }
+
+type tapHolder struct {
+	tap Tap
+}
+
+var globalTap atomic.Value
+
+// SetTap sets the tap receiving the events of all the buses, replacing the previous one. A nil
+// tap disables it.
+func SetTap(tap Tap) {
+	globalTap.Store(tapHolder{tap: tap})
+}
+
+func currentTap() Tap {
+	holder, _ := globalTap.Load().(tapHolder)
+	return holder.tap
+}
+
+// LogTap returns a tap logging all the events at debug level
+func LogTap(log *logp.Logger) Tap {
+	return TapFunc(func(e TapEvent) {
+		log.Debugw("Bus event",
+			"bus", e.Bus,
+			"topics", e.Topics,
+			"event", e.Event,
+			"latency", e.DeliveredAt.Sub(e.PublishedAt),
+		)
+	})
+}
+
+// RecordingTap keeps the tapped events, for test assertions
+type RecordingTap struct {
+	sync.Mutex
+	events []TapEvent
+}
+
+// Tap records the event
+func (r *RecordingTap) Tap(e TapEvent) {
+	r.Lock()
+	defer r.Unlock()
+	r.events = append(r.events, e)
+}
+
+// Events returns the recorded events
+func (r *RecordingTap) Events() []TapEvent {
+	r.Lock()
+	defer r.Unlock()
+	return append([]TapEvent(nil), r.events...)
+}
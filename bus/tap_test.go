@@ -0,0 +1,58 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestTap(t *testing.T) {
+	recorder := &RecordingTap{}
+	SetTap(recorder)
+	t.Cleanup(func() { SetTap(nil) })
+
+	bus := NewWithOptions(logp.L(), "tapped", Options{Topics: []string{"start"}})
+	listener := bus.Subscribe()
+	bus.Publish(Event{"start": true, "meta": mapstr.M{"id": "a"}})
+
+	// Listeners modifying events don't modify the tapped copy
+	e := <-listener.Events()
+	e["meta"].(mapstr.M)["id"] = "b"
+
+	events := recorder.Events()
+	require.Len(t, events, 1)
+	assert.Equal(t, "tapped", events[0].Bus)
+	assert.Equal(t, []string{"start"}, events[0].Topics)
+	assert.Equal(t, Event{"start": true, "meta": mapstr.M{"id": "a"}}, events[0].Event)
+	assert.False(t, events[0].PublishedAt.IsZero())
+	assert.False(t, events[0].DeliveredAt.Before(events[0].PublishedAt))
+
+	// Disabled at runtime
+	SetTap(nil)
+	bus.Publish(Event{"start": true})
+	assert.Len(t, recorder.Events(), 1)
+
+	SetTap(LogTap(logp.L()))
+	bus.Publish(Event{"start": true})
+}
@@ -0,0 +1,72 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bus
+
+import (
+	"strings"
+)
+
+// TopicKey is the key of the hierarchical topic of an event, a dotted path from the most generic
+// to the most specific segment, e.g. `kubernetes.pod.start`
+const TopicKey = "topic"
+
+// topicWildcard matches any segment of a topic
+const topicWildcard = "*"
+
+// Topic returns a predicate matching the events whose topic matches any of the patterns
+func Topic(patterns ...string) Predicate {
+	return func(e Event) bool {
+		topic, ok := e[TopicKey].(string)
+		if !ok {
+			return false
+		}
+		for _, pattern := range patterns {
+			if MatchTopic(pattern, topic) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchTopic returns true if the topic matches the pattern. Patterns are topics whose segments
+// can be `*` to match any segment, a `*` in the last segment matches all the remaining segments
+// of the topic, so `kubernetes.*` matches `kubernetes.pod` and `kubernetes.pod.start`, and
+// `kubernetes.*.start` matches the start of any kubernetes resource.
+func MatchTopic(pattern, topic string) bool {
+	if pattern == "" || topic == "" {
+		return false
+	}
+	patternSegments := strings.Split(pattern, ".")
+	topicSegments := strings.Split(topic, ".")
+	for i, segment := range patternSegments {
+		if i >= len(topicSegments) {
+			return false
+		}
+		if segment == topicWildcard {
+			if i == len(patternSegments)-1 {
+				return true
+			}
+			continue
+		}
+		if segment != topicSegments[i] {
+			return false
+		}
+	}
+	return len(patternSegments) == len(topicSegments)
+}
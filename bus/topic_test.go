@@ -0,0 +1,69 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		pattern string
+		topic   string
+		matches bool
+	}{
+		{"kubernetes.pod.start", "kubernetes.pod.start", true},
+		{"kubernetes.pod.start", "kubernetes.pod.stop", false},
+		{"kubernetes.pod", "kubernetes.pod.start", false},
+		{"kubernetes.*", "kubernetes.pod", true},
+		{"kubernetes.*", "kubernetes.pod.start", true},
+		{"kubernetes.*", "kubernetes", false},
+		{"kubernetes.*", "docker.start", false},
+		{"kubernetes.*.start", "kubernetes.node.start", true},
+		{"kubernetes.*.start", "kubernetes.node.stop", false},
+		{"kubernetes.*.start", "kubernetes.pod.container.start", false},
+		{"*.start", "docker.start", true},
+		{"*", "docker", true},
+		{"", "docker", false},
+		{"docker", "", false},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.matches, MatchTopic(test.pattern, test.topic), "%s matching %s", test.pattern, test.topic)
+	}
+}
+
+func TestSubscribeTopic(t *testing.T) {
+	bus := New(logp.L(), "topics").(MatchSubscriber)
+	listener := bus.SubscribeMatch(Topic("kubernetes.*.start", "docker.*"))
+
+	bus.Publish(Event{TopicKey: "kubernetes.pod.start", "id": "a"})
+	bus.Publish(Event{TopicKey: "kubernetes.pod.stop", "id": "a"})
+	bus.Publish(Event{TopicKey: "docker.stop", "id": "b"})
+	bus.Publish(Event{"start": true, "id": "c"})
+
+	assert.Equal(t, []Event{
+		{TopicKey: "kubernetes.pod.start", "id": "a"},
+		{TopicKey: "docker.stop", "id": "b"},
+	}, receiveN(listener, 2))
+	assert.Empty(t, listener.Events())
+}
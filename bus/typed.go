@@ -0,0 +1,125 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bus
+
+import (
+	"sync"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// typedEventKey is the key holding the value of the events published through a TypedBus
+const typedEventKey = "bus.typed_event"
+
+// TypedBus is a Bus exchanging events of a concrete type instead of maps, so mistakes in the
+// schema of the events are caught at compile time
+type TypedBus[T any] interface {
+	// Publish an event to the bus
+	Publish(T)
+
+	// Subscribe to all events of the bus, filter them to the ones matching *all* the predicates
+	Subscribe(predicates ...func(T) bool) TypedListener[T]
+}
+
+// TypedListener retrieves events from a TypedBus subscription until Stop is called
+type TypedListener[T any] interface {
+	// Events channel
+	Events() <-chan T
+
+	// Stop listening and removes itself from the bus
+	Stop()
+}
+
+type typedBus[T any] struct {
+	bus Bus
+}
+
+type typedListener[T any] struct {
+	listener Listener
+	channel  chan T
+	done     chan struct{}
+	stop     sync.Once
+}
+
+// NewTyped initializes a new typed bus with the given name and returns it
+func NewTyped[T any](log *logp.Logger, name string) TypedBus[T] {
+	return &typedBus[T]{bus: New(log, name)}
+}
+
+// NewTypedFrom returns a typed bus publishing to an existing bus, its subscribers only receive
+// the events of type T published through a typed bus
+func NewTypedFrom[T any](b Bus) TypedBus[T] {
+	return &typedBus[T]{bus: b}
+}
+
+func (b *typedBus[T]) Publish(e T) {
+	b.bus.Publish(Event{typedEventKey: e})
+}
+
+func (b *typedBus[T]) Subscribe(predicates ...func(T) bool) TypedListener[T] {
+	l := &typedListener[T]{
+		listener: b.bus.Subscribe(typedEventKey),
+		channel:  make(chan T, 100),
+		done:     make(chan struct{}),
+	}
+	go l.forward(predicates)
+	return l
+}
+
+// forward the events of the underlying listener that are of type T and match the predicates
+func (l *typedListener[T]) forward(predicates []func(T) bool) {
+	defer close(l.channel)
+
+	for e := range l.listener.Events() {
+		value, ok := e[typedEventKey].(T)
+		if !ok || !matchAll(value, predicates) {
+			continue
+		}
+		select {
+		case l.channel <- value:
+		case <-l.done:
+			return
+		}
+	}
+}
+
+func (l *typedListener[T]) Events() <-chan T {
+	return l.channel
+}
+
+func (l *typedListener[T]) Stop() {
+	l.stop.Do(func() {
+		close(l.done)
+		l.listener.Stop()
+	})
+}
+
+func matchAll[T any](value T, predicates []func(T) bool) bool {
+	for _, predicate := range predicates {
+		if !predicate(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Get returns the value of a key of an event if it is present and of type T
+func Get[T any](e Event, key string) (T, bool) {
+	value, ok := e[key].(T)
+	return value, ok
+}
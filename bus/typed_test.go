@@ -0,0 +1,102 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+type containerEvent struct {
+	ID    string
+	Start bool
+}
+
+func TestTypedBus(t *testing.T) {
+	bus := NewTyped[containerEvent](logp.L(), "typed")
+	all := bus.Subscribe()
+	defer all.Stop()
+	started := bus.Subscribe(func(e containerEvent) bool { return e.Start })
+	defer started.Stop()
+
+	bus.Publish(containerEvent{ID: "a", Start: true})
+	bus.Publish(containerEvent{ID: "a"})
+
+	assert.Equal(t, containerEvent{ID: "a", Start: true}, <-all.Events())
+	assert.Equal(t, containerEvent{ID: "a"}, <-all.Events())
+	assert.Equal(t, containerEvent{ID: "a", Start: true}, <-started.Events())
+
+	select {
+	case e := <-started.Events():
+		t.Fatalf("unexpected event %v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestTypedBusFrom(t *testing.T) {
+	untyped := New(logp.L(), "shared")
+	bus := NewTypedFrom[containerEvent](untyped)
+	listener := bus.Subscribe()
+	defer listener.Stop()
+	raw := untyped.Subscribe("start")
+	defer raw.Stop()
+
+	// Events of other types are not received by typed listeners
+	untyped.Publish(Event{"start": true})
+	NewTypedFrom[string](untyped).Publish("other")
+	bus.Publish(containerEvent{ID: "b"})
+
+	assert.Equal(t, containerEvent{ID: "b"}, <-listener.Events())
+	assert.Equal(t, Event{"start": true}, <-raw.Events())
+}
+
+func TestTypedListenerStop(t *testing.T) {
+	bus := NewTyped[int](logp.L(), "typed")
+	listener := bus.Subscribe()
+
+	// Stopping doesn't block on events not consumed
+	for i := 0; i < 150; i++ {
+		bus.Publish(i)
+	}
+	listener.Stop()
+	listener.Stop()
+
+	require.Eventually(t, func() bool {
+		for range listener.Events() {
+		}
+		return true
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestGet(t *testing.T) {
+	e := Event{"id": "a", "start": true}
+
+	id, ok := Get[string](e, "id")
+	assert.True(t, ok)
+	assert.Equal(t, "a", id)
+
+	_, ok = Get[int](e, "id")
+	assert.False(t, ok)
+	_, ok = Get[bool](e, "stop")
+	assert.False(t, ok)
+}
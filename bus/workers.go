@@ -0,0 +1,136 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bus
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/elastic/elastic-agent-autodiscover/utils"
+)
+
+// defaultWorkers is the number of workers of a pool by default
+const defaultWorkers = 4
+
+// WorkerPoolOptions configures a pool of workers handling the events of a listener
+type WorkerPoolOptions struct {
+	// Workers is the number of events handled in parallel, 4 by default
+	Workers int
+
+	// Key returns the key of an event, e.g. the ID of a container. Events with the same key are
+	// handled by the same worker in the order they were published, events without key are
+	// distributed between the workers.
+	Key func(Event) string
+
+	// QueueSize is the number of events queued per worker, 100 by default
+	QueueSize int
+
+	// Watchdog logs the handlers of the events that take too long, if set
+	Watchdog *utils.Watchdog
+}
+
+// WorkerPool handles the events of a listener in parallel, serializing the events with the same
+// key
+type WorkerPool struct {
+	listener Listener
+	workers  []chan Event
+	key      func(Event) string
+	watchdog *utils.Watchdog
+	next     int
+	wg       sync.WaitGroup
+}
+
+// NewWorkerPool starts handling the events of the listener with a pool of workers, until the
+// listener is stopped
+func NewWorkerPool(listener Listener, opts WorkerPoolOptions, handler func(Event)) *WorkerPool {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	queueSize := opts.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+
+	p := &WorkerPool{
+		listener: listener,
+		workers:  make([]chan Event, workers),
+		key:      opts.Key,
+		watchdog: opts.Watchdog,
+	}
+	for i := range p.workers {
+		p.workers[i] = make(chan Event, queueSize)
+		p.wg.Add(1)
+		go func(events <-chan Event) {
+			defer p.wg.Done()
+			for e := range events {
+				done := p.watchdog.Watch(p.handlerName(e))
+				handler(e)
+				done()
+			}
+		}(p.workers[i])
+	}
+
+	p.wg.Add(1)
+	go p.dispatch()
+	return p
+}
+
+// dispatch the events of the listener to the workers, once the listener is stopped the workers
+// finish with the events queued
+func (p *WorkerPool) dispatch() {
+	defer p.wg.Done()
+	for e := range p.listener.Events() {
+		p.workers[p.worker(e)] <- e
+	}
+	for _, worker := range p.workers {
+		close(worker)
+	}
+}
+
+// worker returns the index of the worker assigned to an event
+func (p *WorkerPool) worker(e Event) int {
+	if p.key != nil {
+		if key := p.key(e); key != "" {
+			h := fnv.New32a()
+			_, _ = h.Write([]byte(key))
+			return int(h.Sum32() % uint32(len(p.workers)))
+		}
+	}
+	p.next = (p.next + 1) % len(p.workers)
+	return p.next
+}
+
+// Wait for the workers to handle all the events, after the listener is stopped
+func (p *WorkerPool) Wait() {
+	p.wg.Wait()
+}
+
+// Stop the listener and wait for the workers to handle the events already received
+func (p *WorkerPool) Stop() {
+	p.listener.Stop()
+	p.Wait()
+}
+
+// handlerName describes the handling of an event in the logs of the watchdog
+func (p *WorkerPool) handlerName(e Event) string {
+	if p.watchdog == nil || p.key == nil {
+		return "event handler"
+	}
+	return "event handler of " + p.key(e)
+}
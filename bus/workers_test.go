@@ -0,0 +1,89 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bus
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+func TestWorkerPool(t *testing.T) {
+	bus := New(logp.L(), "workers")
+
+	var mutex sync.Mutex
+	handled := make(map[string][]int)
+	var running, maxRunning int32
+	pool := NewWorkerPool(bus.Subscribe(), WorkerPoolOptions{
+		Workers: 4,
+		Key:     func(e Event) string { id, _ := e["id"].(string); return id },
+	}, func(e Event) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		id := e["id"].(string)
+		handled[id] = append(handled[id], e["seq"].(int))
+	})
+
+	for seq := 0; seq < 20; seq++ {
+		for i := 0; i < 8; i++ {
+			bus.Publish(Event{"id": fmt.Sprintf("key-%d", i), "seq": seq})
+		}
+	}
+	pool.Stop()
+
+	// Events of every key are handled in order
+	assert.Len(t, handled, 8)
+	for id, seqs := range handled {
+		assert.Len(t, seqs, 20, id)
+		for i, seq := range seqs {
+			assert.Equal(t, i, seq, id)
+		}
+	}
+	assert.Greater(t, atomic.LoadInt32(&maxRunning), int32(1))
+	assert.LessOrEqual(t, atomic.LoadInt32(&maxRunning), int32(4))
+}
+
+func TestWorkerPoolWithoutKey(t *testing.T) {
+	bus := New(logp.L(), "workers")
+
+	var count int32
+	pool := NewWorkerPool(bus.Subscribe(), WorkerPoolOptions{}, func(e Event) {
+		atomic.AddInt32(&count, 1)
+	})
+	for i := 0; i < 50; i++ {
+		bus.Publish(Event{"start": true})
+	}
+	pool.Stop()
+	assert.Equal(t, int32(50), atomic.LoadInt32(&count))
+}
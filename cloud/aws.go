@@ -0,0 +1,74 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const awsTokenTTL = "60"
+
+// fetchAWS reads the instance identity document of EC2, with a session token of IMDSv2 if
+// available, falling back to IMDSv1
+func fetchAWS(ctx context.Context, c *client) (mapstr.M, error) {
+	headers := map[string]string{}
+	if resp, err := c.do(ctx, http.MethodPut, "/latest/api/token", map[string]string{"X-aws-ec2-metadata-token-ttl-seconds": awsTokenTTL}); err == nil {
+		token, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		if err == nil {
+			headers["X-aws-ec2-metadata-token"] = string(token)
+		}
+	}
+
+	resp, err := c.do(ctx, http.MethodGet, "/latest/dynamic/instance-identity/document", headers)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var doc struct {
+		AccountID        string `json:"accountId"`
+		AvailabilityZone string `json:"availabilityZone"`
+		Region           string `json:"region"`
+		InstanceID       string `json:"instanceId"`
+		InstanceType     string `json:"instanceType"`
+		ImageID          string `json:"imageId"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	meta := mapstr.M{
+		"provider": AWS,
+		"service": mapstr.M{
+			"name": "EC2",
+		},
+	}
+	put(meta, "account.id", doc.AccountID)
+	put(meta, "availability_zone", doc.AvailabilityZone)
+	put(meta, "region", doc.Region)
+	put(meta, "instance.id", doc.InstanceID)
+	put(meta, "machine.type", doc.InstanceType)
+	put(meta, "image.id", doc.ImageID)
+	return mapstr.M{"cloud": meta}, nil
+}
@@ -0,0 +1,65 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const azureAPIVersion = "2021-02-01"
+
+// fetchAzure reads the compute metadata of Azure virtual machines
+func fetchAzure(ctx context.Context, c *client) (mapstr.M, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/metadata/instance/compute?api-version="+azureAPIVersion, map[string]string{"Metadata": "true"})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var doc struct {
+		VMID              string `json:"vmId"`
+		Name              string `json:"name"`
+		Location          string `json:"location"`
+		Zone              string `json:"zone"`
+		SubscriptionID    string `json:"subscriptionId"`
+		ResourceGroupName string `json:"resourceGroupName"`
+		VMSize            string `json:"vmSize"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	meta := mapstr.M{
+		"provider": Azure,
+		"service": mapstr.M{
+			"name": "Virtual Machines",
+		},
+	}
+	put(meta, "instance.id", doc.VMID)
+	put(meta, "instance.name", doc.Name)
+	put(meta, "machine.type", doc.VMSize)
+	put(meta, "region", doc.Location)
+	put(meta, "availability_zone", doc.Zone)
+	put(meta, "account.id", doc.SubscriptionID)
+	put(meta, "resource_group.name", doc.ResourceGroupName)
+	return mapstr.M{"cloud": meta}, nil
+}
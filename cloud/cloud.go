@@ -0,0 +1,178 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package cloud queries the instance metadata services of cloud providers to generate the ECS
+// `cloud.*` fields of the host the agent runs in.
+package cloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const (
+	// Providers
+	AWS       = "aws"
+	GCP       = "gcp"
+	Azure     = "azure"
+	OpenStack = "openstack"
+
+	// defaultEndpoint is the link-local address of the metadata services of all the providers
+	defaultEndpoint = "http://169.254.169.254"
+	defaultTimeout  = 3 * time.Second
+)
+
+// provider fetches the metadata of the instance from a metadata service, the `cloud.*` fields
+// under the `cloud` key and other provider specific fields
+type provider func(ctx context.Context, c *client) (mapstr.M, error)
+
+var providers = map[string]provider{
+	AWS:       fetchAWS,
+	GCP:       fetchGCP,
+	Azure:     fetchAzure,
+	OpenStack: fetchOpenStack,
+}
+
+// DefaultProviders are the providers probed by default
+var DefaultProviders = []string{AWS, GCP, Azure, OpenStack}
+
+// Options of the metadata queries
+type Options struct {
+	// Providers to probe, DefaultProviders by default
+	Providers []string `config:"providers"`
+
+	// Timeout of the queries to the metadata services
+	Timeout time.Duration `config:"timeout"`
+
+	// Endpoint of the metadata services, http://169.254.169.254 by default
+	Endpoint string `config:"endpoint"`
+
+	// ConfigDrive is the path where the OpenStack config drive is mounted, if set the metadata is
+	// read from it instead of the metadata service
+	ConfigDrive string `config:"config_drive"`
+}
+
+// Validate the options
+func (o *Options) Validate() error {
+	for _, p := range o.Providers {
+		if _, ok := providers[p]; !ok {
+			return fmt.Errorf("unknown cloud provider %q", p)
+		}
+	}
+	if o.Timeout < 0 {
+		return fmt.Errorf("invalid cloud metadata timeout %v", o.Timeout)
+	}
+	return nil
+}
+
+// ErrNotFound is returned when no metadata service answers
+var ErrNotFound = errors.New("no cloud metadata service found")
+
+type client struct {
+	http        *http.Client
+	endpoint    string
+	configDrive string
+}
+
+// Fetch probes the metadata services of the providers concurrently and returns the `cloud.*`
+// fields of the first one that answers, under the `cloud` key, with the provider specific fields
+// like the tags of OpenStack instances. ErrNotFound is returned, wrapping
+// the errors of the providers, if none answers.
+func Fetch(ctx context.Context, opts Options) (mapstr.M, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	names := opts.Providers
+	if len(names) == 0 {
+		names = DefaultProviders
+	}
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		endpoint = defaultEndpoint
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	c := &client{
+		// Metadata services are never behind proxies
+		http:        &http.Client{Transport: &http.Transport{Proxy: nil}},
+		endpoint:    strings.TrimSuffix(endpoint, "/"),
+		configDrive: opts.ConfigDrive,
+	}
+
+	type result struct {
+		name string
+		meta mapstr.M
+		err  error
+	}
+	results := make(chan result, len(names))
+	for _, name := range names {
+		go func(name string) {
+			meta, err := providers[name](ctx, c)
+			results <- result{name: name, meta: meta, err: err}
+		}(name)
+	}
+
+	var errs []string
+	for range names {
+		r := <-results
+		if r.err == nil {
+			return r.meta, nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", r.name, r.err))
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotFound, strings.Join(errs, "; "))
+}
+
+// do requests a path of the metadata service with some headers, and returns the response if its
+// status is OK
+func (c *client) do(ctx context.Context, method, path string, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.endpoint+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp, nil
+}
+
+// put sets a value in meta if it is not empty
+func put(meta mapstr.M, key string, value string) {
+	if value != "" {
+		_, _ = meta.Put(key, value)
+	}
+}
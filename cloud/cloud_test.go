@@ -0,0 +1,266 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestFetchAWS(t *testing.T) {
+	for _, imdsv2 := range []bool{true, false} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/latest/api/token":
+				if !imdsv2 || r.Method != http.MethodPut {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				assert.Equal(t, awsTokenTTL, r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds"))
+				_, _ = w.Write([]byte("token"))
+			case "/latest/dynamic/instance-identity/document":
+				if imdsv2 && r.Header.Get("X-aws-ec2-metadata-token") != "token" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				_, _ = w.Write([]byte(`{"accountId":"111122223333","availabilityZone":"us-east-1a","region":"us-east-1","instanceId":"i-0abc","instanceType":"m5.large","imageId":"ami-0123"}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		meta, err := Fetch(context.Background(), Options{Endpoint: server.URL})
+		server.Close()
+		require.NoError(t, err)
+		assert.Equal(t, mapstr.M{
+			"cloud": mapstr.M{
+				"provider":          "aws",
+				"service":           mapstr.M{"name": "EC2"},
+				"account":           mapstr.M{"id": "111122223333"},
+				"availability_zone": "us-east-1a",
+				"region":            "us-east-1",
+				"instance":          mapstr.M{"id": "i-0abc"},
+				"machine":           mapstr.M{"type": "m5.large"},
+				"image":             mapstr.M{"id": "ami-0123"},
+			},
+		}, meta, "imdsv2: %v", imdsv2)
+	}
+}
+
+func TestFetchGCP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/computeMetadata/v1/" || r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		assert.Equal(t, "true", r.URL.Query().Get("recursive"))
+		w.Header().Set("Metadata-Flavor", "Google")
+		_, _ = w.Write([]byte(`{
+			"instance": {
+				"id": 4520031799277581759,
+				"name": "node-1",
+				"zone": "projects/123456/zones/europe-west1-b",
+				"machineType": "projects/123456/machineTypes/e2-standard-4",
+				"image": "projects/cos-cloud/global/images/cos-97"
+			},
+			"project": {"projectId": "my-project", "numericProjectId": 123456}
+		}`))
+	}))
+	defer server.Close()
+
+	meta, err := Fetch(context.Background(), Options{Endpoint: server.URL})
+	require.NoError(t, err)
+	assert.Equal(t, mapstr.M{
+		"cloud": mapstr.M{
+			"provider":          "gcp",
+			"service":           mapstr.M{"name": "GCE"},
+			"instance":          mapstr.M{"id": "4520031799277581759", "name": "node-1"},
+			"machine":           mapstr.M{"type": "e2-standard-4"},
+			"availability_zone": "europe-west1-b",
+			"region":            "europe-west1",
+			"project":           mapstr.M{"id": "my-project"},
+			"account":           mapstr.M{"id": "my-project"},
+			"image":             mapstr.M{"id": "cos-97"},
+		},
+	}, meta)
+}
+
+func TestFetchAzure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metadata/instance/compute" || r.Header.Get("Metadata") != "true" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		assert.Equal(t, azureAPIVersion, r.URL.Query().Get("api-version"))
+		_, _ = w.Write([]byte(`{"vmId":"02aab8a4-74ef","name":"vm-1","location":"westeurope","zone":"2","subscriptionId":"8d10da13","resourceGroupName":"rg","vmSize":"Standard_D2s_v3"}`))
+	}))
+	defer server.Close()
+
+	meta, err := Fetch(context.Background(), Options{Endpoint: server.URL, Providers: []string{Azure}})
+	require.NoError(t, err)
+	assert.Equal(t, mapstr.M{
+		"cloud": mapstr.M{
+			"provider":          "azure",
+			"service":           mapstr.M{"name": "Virtual Machines"},
+			"instance":          mapstr.M{"id": "02aab8a4-74ef", "name": "vm-1"},
+			"machine":           mapstr.M{"type": "Standard_D2s_v3"},
+			"region":            "westeurope",
+			"availability_zone": "2",
+			"account":           mapstr.M{"id": "8d10da13"},
+			"resource_group":    mapstr.M{"name": "rg"},
+		},
+	}, meta)
+}
+
+const openStackMetadataJSON = `{
+	"uuid": "83679162-1378-4288-a2d4-70e13ec132aa",
+	"name": "web-1",
+	"hostname": "web-1.novalocal",
+	"availability_zone": "nova",
+	"project_id": "f7ac731cc11f40efbc03a9f9e1d1d21f",
+	"meta": {"role": "web", "env": "prod"}
+}`
+
+func TestFetchOpenStack(t *testing.T) {
+	expected := mapstr.M{
+		"cloud": mapstr.M{
+			"provider":          "openstack",
+			"instance":          mapstr.M{"id": "83679162-1378-4288-a2d4-70e13ec132aa", "name": "web-1"},
+			"availability_zone": "nova",
+			"project":           mapstr.M{"id": "f7ac731cc11f40efbc03a9f9e1d1d21f"},
+			"account":           mapstr.M{"id": "f7ac731cc11f40efbc03a9f9e1d1d21f"},
+			"machine":           mapstr.M{"type": "m1.small"},
+		},
+		"openstack": mapstr.M{
+			"instance": mapstr.M{
+				"tags": mapstr.M{"role": "web", "env": "prod"},
+			},
+		},
+	}
+
+	// Metadata service, it also serves an EC2 compatible API without identity documents
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/openstack/latest/meta_data.json":
+			_, _ = w.Write([]byte(openStackMetadataJSON))
+		case "/latest/meta-data/instance-type":
+			_, _ = w.Write([]byte("m1.small"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	meta, err := Fetch(context.Background(), Options{Endpoint: server.URL})
+	require.NoError(t, err)
+	assert.Equal(t, expected, meta)
+
+	// Config drive
+	drive := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(drive, "openstack", "latest"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(drive, "ec2", "latest"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(drive, "openstack", "latest", "meta_data.json"), []byte(openStackMetadataJSON), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(drive, "ec2", "latest", "meta-data.json"), []byte(`{"instance-type": "m1.small"}`), 0644))
+
+	meta, err = Fetch(context.Background(), Options{Providers: []string{OpenStack}, ConfigDrive: drive})
+	require.NoError(t, err)
+	assert.Equal(t, expected, meta)
+
+	_, err = Fetch(context.Background(), Options{Providers: []string{OpenStack}, ConfigDrive: t.TempDir()})
+	assert.True(t, errors.Is(err, ErrNotFound), err)
+}
+
+func TestFetchNotFound(t *testing.T) {
+	// A GCE like server without the flavor header is not a GCE metadata server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/computeMetadata/v1/" {
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	_, err := Fetch(context.Background(), Options{Endpoint: server.URL})
+	assert.True(t, errors.Is(err, ErrNotFound), err)
+
+	// Unreachable services time out
+	blocking := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer blocking.Close()
+
+	start := time.Now()
+	_, err = Fetch(context.Background(), Options{Endpoint: blocking.URL, Timeout: 100 * time.Millisecond})
+	assert.True(t, errors.Is(err, ErrNotFound), err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestOptionsValidate(t *testing.T) {
+	assert.NoError(t, (&Options{Providers: []string{AWS, GCP}}).Validate())
+	assert.Error(t, (&Options{Providers: []string{"unknown"}}).Validate())
+	assert.Error(t, (&Options{Timeout: -time.Second}).Validate())
+}
+
+func TestFromProviderID(t *testing.T) {
+	tests := map[string]mapstr.M{
+		"aws:///us-west-2b/i-0123456789": {
+			"provider":          "aws",
+			"availability_zone": "us-west-2b",
+			"region":            "us-west-2",
+			"instance":          mapstr.M{"id": "i-0123456789"},
+		},
+		"gce://my-project/us-central1-a/gke-node-1": {
+			"provider":          "gcp",
+			"project":           mapstr.M{"id": "my-project"},
+			"account":           mapstr.M{"id": "my-project"},
+			"availability_zone": "us-central1-a",
+			"region":            "us-central1",
+			"instance":          mapstr.M{"name": "gke-node-1"},
+		},
+		"azure:///subscriptions/8d10da13/resourceGroups/mc_rg/providers/Microsoft.Compute/virtualMachineScaleSets/aks-pool/virtualMachines/0": {
+			"provider":       "azure",
+			"account":        mapstr.M{"id": "8d10da13"},
+			"resource_group": mapstr.M{"name": "mc_rg"},
+			"instance":       mapstr.M{"name": "0"},
+		},
+		"kind://docker/kind/kind-control-plane": nil,
+		"aws:///i-0123456789":                   nil,
+		"":                                      nil,
+	}
+
+	for providerID, expected := range tests {
+		meta := FromProviderID(providerID)
+		if expected == nil {
+			assert.Nil(t, meta, providerID)
+			continue
+		}
+		assert.Equal(t, mapstr.M{"cloud": expected}, meta, providerID)
+	}
+}
@@ -0,0 +1,90 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// fetchGCP reads the instance and project metadata of GCE
+func fetchGCP(ctx context.Context, c *client) (mapstr.M, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/computeMetadata/v1/?recursive=true", map[string]string{"Metadata-Flavor": "Google"})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Other services in the same address don't answer with the flavor
+	if resp.Header.Get("Metadata-Flavor") != "Google" {
+		return nil, errors.New("not a GCE metadata server")
+	}
+
+	var doc struct {
+		Instance struct {
+			ID          json.Number `json:"id"`
+			Name        string      `json:"name"`
+			Zone        string      `json:"zone"`
+			MachineType string      `json:"machineType"`
+			Image       string      `json:"image"`
+		} `json:"instance"`
+		Project struct {
+			ProjectID        string      `json:"projectId"`
+			NumericProjectID json.Number `json:"numericProjectId"`
+		} `json:"project"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode GCE metadata: %w", err)
+	}
+
+	// Zones and machine types are given as projects/<number>/zones/<zone>
+	zone := lastSegment(doc.Instance.Zone)
+	meta := mapstr.M{
+		"provider": GCP,
+		"service": mapstr.M{
+			"name": "GCE",
+		},
+	}
+	put(meta, "instance.id", doc.Instance.ID.String())
+	put(meta, "instance.name", doc.Instance.Name)
+	put(meta, "machine.type", lastSegment(doc.Instance.MachineType))
+	put(meta, "availability_zone", zone)
+	put(meta, "region", gcpRegion(zone))
+	put(meta, "project.id", doc.Project.ProjectID)
+	put(meta, "account.id", doc.Project.ProjectID)
+	put(meta, "image.id", lastSegment(doc.Instance.Image))
+	return mapstr.M{"cloud": meta}, nil
+}
+
+// gcpRegion returns the region of a zone, e.g. us-central1 for us-central1-a
+func gcpRegion(zone string) string {
+	if i := strings.LastIndex(zone, "-"); i > 0 {
+		return zone[:i]
+	}
+	return ""
+}
+
+func lastSegment(s string) string {
+	return s[strings.LastIndex(s, "/")+1:]
+}
@@ -0,0 +1,123 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const openStackMetadataPath = "openstack/latest/meta_data.json"
+
+// openStackMetadata is the metadata of an instance, as found in meta_data.json
+type openStackMetadata struct {
+	UUID             string            `json:"uuid"`
+	Name             string            `json:"name"`
+	AvailabilityZone string            `json:"availability_zone"`
+	ProjectID        string            `json:"project_id"`
+	Meta             map[string]string `json:"meta"`
+}
+
+// fetchOpenStack reads the metadata of OpenStack instances from the config drive if configured,
+// or from the metadata service. The user metadata of the instance is added as its tags under
+// `openstack.instance.tags`.
+func fetchOpenStack(ctx context.Context, c *client) (mapstr.M, error) {
+	var doc openStackMetadata
+	var machineType string
+	if c.configDrive != "" {
+		data, err := os.ReadFile(filepath.Join(c.configDrive, filepath.FromSlash(openStackMetadataPath)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config drive: %w", err)
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to decode config drive metadata: %w", err)
+		}
+		machineType = openStackConfigDriveInstanceType(c.configDrive)
+	} else {
+		resp, err := c.do(ctx, http.MethodGet, "/"+openStackMetadataPath, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode openstack metadata: %w", err)
+		}
+		machineType = openStackInstanceType(ctx, c)
+	}
+	if doc.UUID == "" {
+		return nil, fmt.Errorf("not an openstack instance")
+	}
+
+	meta := mapstr.M{
+		"provider": OpenStack,
+	}
+	put(meta, "instance.id", doc.UUID)
+	put(meta, "instance.name", doc.Name)
+	put(meta, "availability_zone", doc.AvailabilityZone)
+	put(meta, "project.id", doc.ProjectID)
+	put(meta, "account.id", doc.ProjectID)
+	put(meta, "machine.type", machineType)
+
+	fields := mapstr.M{"cloud": meta}
+	if len(doc.Meta) > 0 {
+		tags := mapstr.M{}
+		for k, v := range doc.Meta {
+			tags[k] = v
+		}
+		_, _ = fields.Put("openstack.instance.tags", tags)
+	}
+	return fields, nil
+}
+
+// openStackInstanceType returns the flavor of the instance from the EC2 compatible API of the
+// metadata service, the OpenStack metadata doesn't include it
+func openStackInstanceType(ctx context.Context, c *client) string {
+	resp, err := c.do(ctx, http.MethodGet, "/latest/meta-data/instance-type", nil)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// openStackConfigDriveInstanceType returns the flavor of the instance from the EC2 compatible
+// metadata of the config drive
+func openStackConfigDriveInstanceType(configDrive string) string {
+	data, err := os.ReadFile(filepath.Join(configDrive, "ec2", "latest", "meta-data.json"))
+	if err != nil {
+		return ""
+	}
+	var doc struct {
+		InstanceType string `json:"instance-type"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return ""
+	}
+	return doc.InstanceType
+}
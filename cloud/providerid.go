@@ -0,0 +1,79 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cloud
+
+import (
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// FromProviderID returns the `cloud.*` fields that can be derived from the provider ID of a
+// Kubernetes node, under the `cloud` key, so nodes can be enriched without querying the metadata
+// services. Nil is returned for unknown provider IDs. Supported formats are:
+//   - aws:///<zone>/<instance-id>
+//   - gce://<project>/<zone>/<instance-name>
+//   - azure:///subscriptions/<id>/resourceGroups/<group>/providers/Microsoft.Compute/virtualMachines/<name>
+func FromProviderID(providerID string) mapstr.M {
+	scheme, path, ok := strings.Cut(providerID, "://")
+	if !ok {
+		return nil
+	}
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+
+	meta := mapstr.M{}
+	switch scheme {
+	case "aws":
+		if len(parts) != 2 {
+			return nil
+		}
+		meta["provider"] = AWS
+		put(meta, "availability_zone", parts[0])
+		if len(parts[0]) > 1 {
+			// Availability zones are the region followed by a letter
+			put(meta, "region", parts[0][:len(parts[0])-1])
+		}
+		put(meta, "instance.id", parts[1])
+	case "gce":
+		if len(parts) != 3 {
+			return nil
+		}
+		meta["provider"] = GCP
+		put(meta, "project.id", parts[0])
+		put(meta, "account.id", parts[0])
+		put(meta, "availability_zone", parts[1])
+		put(meta, "region", gcpRegion(parts[1]))
+		put(meta, "instance.name", parts[2])
+	case "azure":
+		// Keys are case insensitive
+		values := map[string]string{}
+		for i := 0; i+1 < len(parts); i += 2 {
+			values[strings.ToLower(parts[i])] = parts[i+1]
+		}
+		if values["subscriptions"] == "" {
+			return nil
+		}
+		meta["provider"] = Azure
+		put(meta, "account.id", values["subscriptions"])
+		put(meta, "resource_group.name", values["resourcegroups"])
+		put(meta, "instance.name", values["virtualmachines"])
+	default:
+		return nil
+	}
+	return mapstr.M{"cloud": meta}
+}
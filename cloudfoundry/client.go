@@ -0,0 +1,312 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cloudfoundry
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSyncPeriod = 30 * time.Second
+	requestTimeout    = 30 * time.Second
+
+	// Tokens are renewed this time before they expire
+	tokenExpiryMargin = time.Minute
+)
+
+// Config of the connection to the Cloud Foundry API
+type Config struct {
+	// APIAddress is the address of the Cloud Controller API, e.g. https://api.example.com
+	APIAddress string `config:"api_address"`
+
+	// UAAAddress is the address of the UAA server issuing the tokens, discovered from the API
+	// by default
+	UAAAddress string `config:"uaa_address"`
+
+	// ClientID and ClientSecret of the UAA client, it needs the `cloud_controller.admin_read_only`
+	// or `cloud_controller.global_auditor` authority to list the applications of all the spaces
+	ClientID     string `config:"client_id"`
+	ClientSecret string `config:"client_secret"`
+
+	// SkipVerify disables the verification of the TLS certificates of the servers
+	SkipVerify bool `config:"ssl.insecure_skip_verify"`
+
+	// SyncPeriod is the time waited between listings of the applications
+	SyncPeriod time.Duration `config:"sync_period"`
+}
+
+// Validate the config
+func (c *Config) Validate() error {
+	if c.APIAddress == "" {
+		return errors.New("cloud foundry api address is required")
+	}
+	if _, err := url.Parse(c.APIAddress); err != nil {
+		return fmt.Errorf("invalid cloud foundry api address: %w", err)
+	}
+	if c.ClientID == "" {
+		return errors.New("cloud foundry client id is required")
+	}
+	if c.SyncPeriod < 0 {
+		return fmt.Errorf("invalid cloud foundry sync period %v", c.SyncPeriod)
+	}
+	return nil
+}
+
+// API is the subset of the Cloud Foundry API used by the watcher
+type API interface {
+	// Apps returns the applications of all the spaces visible to the client, with their space
+	// and organization
+	Apps(ctx context.Context) ([]App, error)
+}
+
+type client struct {
+	http         *http.Client
+	api          string
+	uaa          string
+	clientID     string
+	clientSecret string
+
+	mutex  sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// NewClient returns a client of the Cloud Controller v3 API, authenticated with the client
+// credentials grant of UAA
+func NewClient(cfg Config) (API, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.SkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} //nolint:gosec // explicitly configured
+	}
+	return &client{
+		http:         &http.Client{Transport: transport, Timeout: requestTimeout},
+		api:          strings.TrimSuffix(cfg.APIAddress, "/"),
+		uaa:          strings.TrimSuffix(cfg.UAAAddress, "/"),
+		clientID:     cfg.ClientID,
+		clientSecret: cfg.ClientSecret,
+	}, nil
+}
+
+// page of resources of the v3 API
+type page struct {
+	Pagination struct {
+		Next *struct {
+			Href string `json:"href"`
+		} `json:"next"`
+	} `json:"pagination"`
+	Resources []struct {
+		GUID      string    `json:"guid"`
+		Name      string    `json:"name"`
+		State     string    `json:"state"`
+		CreatedAt time.Time `json:"created_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+		Metadata  Metadata  `json:"metadata"`
+		Relations struct {
+			Space relation `json:"space"`
+		} `json:"relationships"`
+	} `json:"resources"`
+	Included struct {
+		Spaces []struct {
+			GUID      string   `json:"guid"`
+			Name      string   `json:"name"`
+			Metadata  Metadata `json:"metadata"`
+			Relations struct {
+				Organization relation `json:"organization"`
+			} `json:"relationships"`
+		} `json:"spaces"`
+		Organizations []struct {
+			GUID     string   `json:"guid"`
+			Name     string   `json:"name"`
+			Metadata Metadata `json:"metadata"`
+		} `json:"organizations"`
+	} `json:"included"`
+}
+
+type relation struct {
+	Data struct {
+		GUID string `json:"guid"`
+	} `json:"data"`
+}
+
+// Apps returns the applications of all the spaces visible to the client
+func (c *client) Apps(ctx context.Context) ([]App, error) {
+	var apps []App
+	spaces := make(map[string]*Space)
+	orgs := make(map[string]*Org)
+	spaceOrgs := make(map[string]string)
+
+	next := c.api + "/v3/apps?per_page=5000&include=space.organization"
+	for next != "" {
+		var p page
+		if err := c.get(ctx, next, &p); err != nil {
+			return nil, fmt.Errorf("failed to list cloud foundry apps: %w", err)
+		}
+		for _, o := range p.Included.Organizations {
+			orgs[o.GUID] = &Org{GUID: o.GUID, Name: o.Name, Metadata: o.Metadata}
+		}
+		for _, s := range p.Included.Spaces {
+			spaces[s.GUID] = &Space{GUID: s.GUID, Name: s.Name, Metadata: s.Metadata}
+			spaceOrgs[s.GUID] = s.Relations.Organization.Data.GUID
+		}
+		for _, r := range p.Resources {
+			apps = append(apps, App{
+				GUID:      r.GUID,
+				Name:      r.Name,
+				State:     r.State,
+				CreatedAt: r.CreatedAt,
+				UpdatedAt: r.UpdatedAt,
+				Metadata:  r.Metadata,
+				Space:     &Space{GUID: r.Relations.Space.Data.GUID},
+			})
+		}
+		next = ""
+		if p.Pagination.Next != nil {
+			next = p.Pagination.Next.Href
+		}
+	}
+
+	// Spaces and organizations are included once in the pages, they are linked at the end
+	for i := range apps {
+		space, ok := spaces[apps[i].Space.GUID]
+		if !ok {
+			continue
+		}
+		if space.Org == nil {
+			space.Org = orgs[spaceOrgs[space.GUID]]
+		}
+		apps[i].Space = space
+	}
+	return apps, nil
+}
+
+func (c *client) get(ctx context.Context, href string, v interface{}) error {
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, href, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "bearer "+token)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		// Token revoked or expired earlier than expected, get a new one in the next request
+		c.mutex.Lock()
+		c.token = ""
+		c.mutex.Unlock()
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// accessToken returns the last token of the client, requesting a new one if it is about to expire
+func (c *client) accessToken(ctx context.Context) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.token != "" && time.Now().Before(c.expiry) {
+		return c.token, nil
+	}
+
+	if c.uaa == "" {
+		uaa, err := c.discoverUAA(ctx)
+		if err != nil {
+			return "", err
+		}
+		c.uaa = uaa
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.uaa+"/oauth/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(c.clientID, c.clientSecret)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get cloud foundry token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("failed to get cloud foundry token: unexpected status %s: %s", resp.Status, body)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode cloud foundry token: %w", err)
+	}
+	c.token = token.AccessToken
+	c.expiry = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - tokenExpiryMargin)
+	return c.token, nil
+}
+
+// discoverUAA returns the address of the UAA server from the links of the root of the API
+func (c *client) discoverUAA(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.api+"/", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to discover cloud foundry uaa: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var root struct {
+		Links struct {
+			UAA *struct {
+				Href string `json:"href"`
+			} `json:"uaa"`
+		} `json:"links"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&root); err != nil {
+		return "", fmt.Errorf("failed to discover cloud foundry uaa: %w", err)
+	}
+	if root.Links.UAA == nil || root.Links.UAA.Href == "" {
+		return "", errors.New("failed to discover cloud foundry uaa: no uaa link in the api root")
+	}
+	return strings.TrimSuffix(root.Links.UAA.Href, "/"), nil
+}
@@ -0,0 +1,56 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cloudfoundry
+
+import (
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// GenerateMetadata returns the metadata of an application, with its space and organization, under
+// `cloudfoundry`. The labels of the application are added under `cloudfoundry.app.labels`.
+func GenerateMetadata(app *App) mapstr.M {
+	appMeta := mapstr.M{
+		"id":   app.GUID,
+		"name": app.Name,
+	}
+	if len(app.Metadata.Labels) > 0 {
+		labels := mapstr.M{}
+		for k, v := range app.Metadata.Labels {
+			labels[k] = v
+		}
+		appMeta["labels"] = labels
+	}
+	meta := mapstr.M{
+		"app": appMeta,
+	}
+	if space := app.Space; space != nil {
+		meta["space"] = mapstr.M{
+			"id":   space.GUID,
+			"name": space.Name,
+		}
+		if org := space.Org; org != nil {
+			meta["org"] = mapstr.M{
+				"id":   org.GUID,
+				"name": org.Name,
+			}
+		}
+	}
+	return mapstr.M{
+		"cloudfoundry": meta,
+	}
+}
@@ -0,0 +1,202 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package cloudfoundry discovers the applications started in Cloud Foundry, polling the Cloud
+// Controller v3 API for the applications of all the spaces visible to the client.
+package cloudfoundry
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+	"github.com/elastic/elastic-agent-autodiscover/internal/poll"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+const (
+	// StateStarted is the state of started applications
+	StateStarted = "STARTED"
+
+	maxBackoff = 5 * time.Minute
+)
+
+// App is a Cloud Foundry application
+type App struct {
+	GUID      string
+	Name      string
+	State     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Metadata  Metadata
+	Space     *Space
+}
+
+// Space of an application
+type Space struct {
+	GUID     string
+	Name     string
+	Metadata Metadata
+	Org      *Org
+}
+
+// Org is the organization of a space
+type Org struct {
+	GUID     string
+	Name     string
+	Metadata Metadata
+}
+
+// Metadata are the labels and annotations of a resource
+type Metadata struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// Watcher polls the Cloud Foundry API and keeps a list of the started applications
+type Watcher interface {
+	// Start watching the applications
+	Start() error
+
+	// Stop watching the applications
+	Stop()
+
+	// Apps returns the started applications by their GUID
+	Apps() map[string]*App
+
+	// ListenStart returns a bus listener to receive the applications in the STARTED state, with
+	// an `app` key holding them. Applications updated while started are started again.
+	ListenStart() bus.Listener
+
+	// ListenStop returns a bus listener to receive the applications stopped, deleted or updated,
+	// with an `app` key holding their previous state
+	ListenStop() bus.Listener
+}
+
+type watcher struct {
+	sync.RWMutex
+	log     *logp.Logger
+	api     API
+	period  time.Duration
+	ctx     context.Context
+	stop    context.CancelFunc
+	apps    map[string]*App
+	stopped sync.WaitGroup
+	bus     bus.Bus
+}
+
+// NewWatcher creates a new Watcher of the applications of the API
+func NewWatcher(log *logp.Logger, api API, cfg Config) (Watcher, error) {
+	if cfg.SyncPeriod < 0 {
+		return nil, fmt.Errorf("invalid cloud foundry sync period %v", cfg.SyncPeriod)
+	}
+	period := cfg.SyncPeriod
+	if period == 0 {
+		period = defaultSyncPeriod
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &watcher{
+		log:    log,
+		api:    api,
+		period: period,
+		ctx:    ctx,
+		stop:   cancel,
+		apps:   make(map[string]*App),
+		bus:    bus.New(log, "cloudfoundry"),
+	}, nil
+}
+
+// Apps returns the started applications
+func (w *watcher) Apps() map[string]*App {
+	w.RLock()
+	defer w.RUnlock()
+	res := make(map[string]*App, len(w.apps))
+	for k, v := range w.apps {
+		res[k] = v
+	}
+	return res
+}
+
+// Start watching the applications, the first listing is done synchronously so errors connecting
+// to the API are returned
+func (w *watcher) Start() error {
+	w.log.Debug("Start Cloud Foundry applications watcher")
+	if err := w.sync(); err != nil {
+		return err
+	}
+
+	w.stopped.Add(1)
+	go w.watch()
+	return nil
+}
+
+// Stop watching the applications
+func (w *watcher) Stop() {
+	w.stop()
+	w.stopped.Wait()
+}
+
+func (w *watcher) watch() {
+	defer w.stopped.Done()
+
+	poll.Loop(w.ctx, w.log, poll.Config{
+		Period:      w.period,
+		MaxBackoff:  maxBackoff,
+		Description: "listing Cloud Foundry applications",
+	}, w.sync)
+	w.log.Debug("Watcher stopped")
+}
+
+// sync lists the applications and publishes the events of the ones that started or stopped since
+// the last listing. Applications updated while started, e.g. restaged or relabeled, are stopped
+// and started again so their metadata is refreshed.
+func (w *watcher) sync() error {
+	ctx, cancel := context.WithTimeout(w.ctx, requestTimeout)
+	defer cancel()
+
+	apps, err := w.api.Apps(ctx)
+	if err != nil {
+		return err
+	}
+
+	started := make(map[string]*App)
+	for i := range apps {
+		if apps[i].State == StateStarted {
+			started[apps[i].GUID] = &apps[i]
+		}
+	}
+
+	w.Lock()
+	starts, stops := poll.Diff(w.apps, started, func(old, app *App) bool {
+		return !old.UpdatedAt.Equal(app.UpdatedAt)
+	})
+	w.apps = started
+	w.Unlock()
+
+	poll.Publish(w.bus, "app", starts, stops)
+	return nil
+}
+
+func (w *watcher) ListenStart() bus.Listener {
+	return w.bus.Subscribe("start")
+}
+
+func (w *watcher) ListenStop() bus.Listener {
+	return w.bus.Subscribe("stop")
+}
@@ -0,0 +1,168 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cloudfoundry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-autodiscover/internal/polltest"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type mockAPI struct {
+	polltest.Source[App]
+}
+
+func (m *mockAPI) Apps(ctx context.Context) ([]App, error) {
+	apps, _, err := m.List()
+	return apps, err
+}
+
+var space = &Space{GUID: "s1", Name: "dev", Org: &Org{GUID: "o1", Name: "acme"}}
+
+func app(guid, name, state string, updated time.Time) App {
+	return App{GUID: guid, Name: name, State: state, UpdatedAt: updated, Space: space}
+}
+
+func TestWatcher(t *testing.T) {
+	t0 := time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)
+	api := &mockAPI{}
+	api.Set(app("a1", "web", StateStarted, t0), app("a2", "worker", "STOPPED", t0))
+
+	w, err := NewWatcher(logp.L(), api, Config{SyncPeriod: 10 * time.Millisecond})
+	require.NoError(t, err)
+	start, stop := polltest.Start(t, w)
+
+	assert.Equal(t, "web", polltest.NextEvent(t, start)["app"].(*App).Name)
+	assert.Len(t, w.Apps(), 1)
+
+	// Started app, and web updated
+	api.Set(app("a1", "web", StateStarted, t0.Add(time.Minute)), app("a2", "worker", StateStarted, t0))
+	stopped := polltest.NextEvent(t, stop)["app"].(*App)
+	assert.Equal(t, "a1", stopped.GUID)
+	assert.Equal(t, t0, stopped.UpdatedAt)
+
+	guids := []string{polltest.NextEvent(t, start)["app"].(*App).GUID, polltest.NextEvent(t, start)["app"].(*App).GUID}
+	assert.ElementsMatch(t, []string{"a1", "a2"}, guids)
+
+	// Stopped app
+	api.Set(app("a1", "web", StateStarted, t0.Add(time.Minute)))
+	assert.Equal(t, "a2", polltest.NextEvent(t, stop)["app"].(*App).GUID)
+}
+
+func TestWatcherStartError(t *testing.T) {
+	polltest.StartError(t, func(err error) (polltest.Watcher, error) {
+		api := &mockAPI{}
+		api.Fail(err)
+		return NewWatcher(logp.L(), api, Config{})
+	})
+
+	_, err := NewWatcher(logp.L(), &mockAPI{}, Config{SyncPeriod: -time.Second})
+	assert.Error(t, err)
+}
+
+func TestConfigValidate(t *testing.T) {
+	assert.Error(t, (&Config{ClientID: "agent"}).Validate())
+	assert.Error(t, (&Config{APIAddress: "https://api.example.com"}).Validate())
+	assert.NoError(t, (&Config{APIAddress: "https://api.example.com", ClientID: "agent"}).Validate())
+}
+
+func TestClient(t *testing.T) {
+	tokens := 0
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			_ = json.NewEncoder(w).Encode(mapstr.M{"links": mapstr.M{"uaa": mapstr.M{"href": server.URL + "/uaa"}}})
+		case "/uaa/oauth/token":
+			user, password, _ := r.BasicAuth()
+			assert.Equal(t, "agent", user)
+			assert.Equal(t, "secret", password)
+			assert.NoError(t, r.ParseForm())
+			assert.Equal(t, "client_credentials", r.Form.Get("grant_type"))
+			tokens++
+			_ = json.NewEncoder(w).Encode(mapstr.M{"access_token": "token", "expires_in": 3600})
+		case "/v3/apps":
+			assert.Equal(t, "bearer token", r.Header.Get("Authorization"))
+			if r.URL.Query().Get("page") == "" {
+				_, _ = w.Write([]byte(`{
+					"pagination": {"next": {"href": "` + server.URL + `/v3/apps?page=2"}},
+					"resources": [{"guid": "a1", "name": "web", "state": "STARTED",
+						"metadata": {"labels": {"team": "payments"}},
+						"relationships": {"space": {"data": {"guid": "s1"}}}}],
+					"included": {
+						"spaces": [{"guid": "s1", "name": "dev", "relationships": {"organization": {"data": {"guid": "o1"}}}}],
+						"organizations": [{"guid": "o1", "name": "acme"}]
+					}
+				}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{
+				"pagination": {"next": null},
+				"resources": [{"guid": "a2", "name": "worker", "state": "STOPPED",
+					"relationships": {"space": {"data": {"guid": "s1"}}}}]
+			}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	api, err := NewClient(Config{APIAddress: server.URL, ClientID: "agent", ClientSecret: "secret"})
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		apps, err := api.Apps(context.Background())
+		require.NoError(t, err)
+		require.Len(t, apps, 2)
+		assert.Equal(t, "web", apps[0].Name)
+		assert.Equal(t, "payments", apps[0].Metadata.Labels["team"])
+		assert.Equal(t, "dev", apps[1].Space.Name)
+		assert.Equal(t, "acme", apps[1].Space.Org.Name)
+	}
+	// The token is reused
+	assert.Equal(t, 1, tokens)
+
+	_, err = NewClient(Config{ClientID: "agent"})
+	assert.Error(t, err)
+}
+
+func TestGenerateMetadata(t *testing.T) {
+	a := app("a1", "web", StateStarted, time.Time{})
+	a.Metadata.Labels = map[string]string{"team.example.com/name": "payments"}
+	assert.Equal(t, mapstr.M{
+		"cloudfoundry": mapstr.M{
+			"app": mapstr.M{
+				"id":     "a1",
+				"name":   "web",
+				"labels": mapstr.M{"team.example.com/name": "payments"},
+			},
+			"space": mapstr.M{"id": "s1", "name": "dev"},
+			"org":   mapstr.M{"id": "o1", "name": "acme"},
+		},
+	}, GenerateMetadata(&a))
+}
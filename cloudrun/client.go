@@ -0,0 +1,259 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cloudrun
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultEndpoint     = "https://run.googleapis.com"
+	defaultMetadataHost = "metadata.google.internal"
+	defaultSyncPeriod   = time.Minute
+
+	requestTimeout = 30 * time.Second
+
+	// Tokens are renewed this time before they expire
+	tokenExpiryMargin = time.Minute
+)
+
+// Config of the Cloud Run provider
+type Config struct {
+	// Projects whose services are discovered
+	Projects []string `config:"projects"`
+
+	// Regions of the services, like `europe-west1`
+	Regions []string `config:"regions"`
+
+	// Endpoint of the Cloud Run Admin API, the public one by default
+	Endpoint string `config:"endpoint"`
+
+	// SyncPeriod is the time waited between listings of the services
+	SyncPeriod time.Duration `config:"sync_period"`
+}
+
+// Validate the config
+func (c *Config) Validate() error {
+	if len(c.Projects) == 0 {
+		return errors.New("at least one cloud run project is required")
+	}
+	if len(c.Regions) == 0 {
+		return errors.New("at least one cloud run region is required")
+	}
+	if c.Endpoint != "" {
+		if _, err := url.Parse(c.Endpoint); err != nil {
+			return fmt.Errorf("invalid cloud run endpoint: %w", err)
+		}
+	}
+	if c.SyncPeriod < 0 {
+		return fmt.Errorf("invalid cloud run sync period %v", c.SyncPeriod)
+	}
+	return nil
+}
+
+// API is the subset of the Cloud Run Admin API used by the watcher
+type API interface {
+	// Services returns the services of a project in a region
+	Services(ctx context.Context, project, region string) ([]Service, error)
+}
+
+type client struct {
+	http     *http.Client
+	endpoint string
+	metadata string
+
+	mutex  sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// NewClient returns a client of the Cloud Run Admin API v2, authenticated with the service
+// account of the instance, from the metadata server. GCE_METADATA_HOST can be set to use another
+// metadata server, like the one of the GKE workload identity.
+func NewClient(cfg Config) (API, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = defaultEndpoint
+	}
+	metadataHost := os.Getenv("GCE_METADATA_HOST")
+	if metadataHost == "" {
+		metadataHost = defaultMetadataHost
+	}
+	return &client{
+		http:     &http.Client{Timeout: requestTimeout},
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		metadata: "http://" + metadataHost,
+	}, nil
+}
+
+// accessToken returns the last token of the client, requesting a new one if it is about to expire
+func (c *client) accessToken(ctx context.Context) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.token != "" && time.Now().Before(c.expiry) {
+		return c.token, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.metadata+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get gcp token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("failed to get gcp token: unexpected status %s: %s", resp.Status, body)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode gcp token: %w", err)
+	}
+	c.token = token.AccessToken
+	c.expiry = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - tokenExpiryMargin)
+	return c.token, nil
+}
+
+// service as returned by the API
+type service struct {
+	Name                  string            `json:"name"`
+	UID                   string            `json:"uid"`
+	Generation            string            `json:"generation"`
+	Labels                map[string]string `json:"labels"`
+	Annotations           map[string]string `json:"annotations"`
+	UpdateTime            time.Time         `json:"updateTime"`
+	URI                   string            `json:"uri"`
+	LatestReadyRevision   string            `json:"latestReadyRevision"`
+	LatestCreatedRevision string            `json:"latestCreatedRevision"`
+	TrafficStatuses       []struct {
+		Type     string `json:"type"`
+		Revision string `json:"revision"`
+		Percent  int    `json:"percent"`
+		Tag      string `json:"tag"`
+	} `json:"trafficStatuses"`
+}
+
+// Services returns the services of a project in a region
+func (c *client) Services(ctx context.Context, project, region string) ([]Service, error) {
+	var services []Service
+	pageToken := ""
+	for {
+		query := url.Values{}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		href := c.endpoint + "/v2/projects/" + url.PathEscape(project) + "/locations/" + url.PathEscape(region) + "/services?" + query.Encode()
+
+		var page struct {
+			Services      []service `json:"services"`
+			NextPageToken string    `json:"nextPageToken"`
+		}
+		if err := c.get(ctx, href, &page); err != nil {
+			return nil, fmt.Errorf("failed to list cloud run services of %s in %s: %w", project, region, err)
+		}
+		for _, s := range page.Services {
+			services = append(services, newService(s, project, region))
+		}
+		if page.NextPageToken == "" {
+			return services, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+func (c *client) get(ctx context.Context, href string, v interface{}) error {
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, href, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		c.mutex.Lock()
+		c.token = ""
+		c.mutex.Unlock()
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, body)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func newService(s service, project, region string) Service {
+	svc := Service{
+		ID:                    s.Name,
+		Name:                  lastSegment(s.Name),
+		Project:               project,
+		Region:                region,
+		UID:                   s.UID,
+		Generation:            s.Generation,
+		URI:                   s.URI,
+		Labels:                s.Labels,
+		Annotations:           s.Annotations,
+		UpdateTime:            s.UpdateTime,
+		LatestReadyRevision:   lastSegment(s.LatestReadyRevision),
+		LatestCreatedRevision: lastSegment(s.LatestCreatedRevision),
+	}
+	for _, t := range s.TrafficStatuses {
+		revision := lastSegment(t.Revision)
+		if revision == "" && t.Type == "TRAFFIC_TARGET_ALLOCATION_TYPE_LATEST" {
+			revision = svc.LatestReadyRevision
+		}
+		svc.Traffic = append(svc.Traffic, Traffic{Revision: revision, Percent: t.Percent, Tag: t.Tag})
+	}
+	return svc
+}
+
+// lastSegment returns the short name of a resource name like projects/p/locations/l/services/s
+func lastSegment(name string) string {
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
@@ -0,0 +1,75 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cloudrun
+
+import (
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// GenerateMetadata returns the metadata of a service, with the cloud fields and the service and
+// its latest ready revision under `gcp.cloudrun`
+func GenerateMetadata(s *Service) mapstr.M {
+	service := mapstr.M{
+		"name": s.Name,
+		"uid":  s.UID,
+	}
+	if s.URI != "" {
+		service["uri"] = s.URI
+	}
+	if len(s.Labels) > 0 {
+		labels := mapstr.M{}
+		for k, v := range s.Labels {
+			labels[k] = v
+		}
+		service["labels"] = labels
+	}
+
+	cloudrun := mapstr.M{
+		"service": service,
+		"revision": mapstr.M{
+			"name": s.LatestReadyRevision,
+		},
+	}
+	// A revision can receive traffic from several targets, like tagged ones
+	percent, serving := 0, false
+	for _, t := range s.Traffic {
+		if t.Revision == s.LatestReadyRevision {
+			percent += t.Percent
+			serving = true
+		}
+	}
+	if serving {
+		_, _ = cloudrun.Put("revision.traffic_percent", percent)
+	}
+
+	return mapstr.M{
+		"cloud": mapstr.M{
+			"provider": "gcp",
+			"project": mapstr.M{
+				"id": s.Project,
+			},
+			"region": s.Region,
+			"service": mapstr.M{
+				"name": "Cloud Run",
+			},
+		},
+		"gcp": mapstr.M{
+			"cloudrun": cloudrun,
+		},
+	}
+}
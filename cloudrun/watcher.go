@@ -0,0 +1,202 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package cloudrun discovers the services deployed in Google Cloud Run, polling the Cloud Run
+// Admin API for the services of some projects and regions, and following their revisions.
+package cloudrun
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+	"github.com/elastic/elastic-agent-autodiscover/internal/poll"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+const maxBackoff = 10 * time.Minute
+
+// Service of Cloud Run
+type Service struct {
+	// ID is the full resource name, like projects/<project>/locations/<region>/services/<name>
+	ID                    string
+	Name                  string
+	Project               string
+	Region                string
+	UID                   string
+	Generation            string
+	URI                   string
+	Labels                map[string]string
+	Annotations           map[string]string
+	UpdateTime            time.Time
+	LatestReadyRevision   string
+	LatestCreatedRevision string
+	Traffic               []Traffic
+}
+
+// Traffic sent to a revision of a service
+type Traffic struct {
+	Revision string
+	Percent  int
+	Tag      string
+}
+
+// Watcher polls the API and keeps a list of the services with a ready revision
+type Watcher interface {
+	// Start watching the services
+	Start() error
+
+	// Stop watching the services
+	Stop()
+
+	// Services returns the services with a ready revision by their ID
+	Services() map[string]*Service
+
+	// ListenStart returns a bus listener to receive service started events, with a `service` key
+	// holding it. Services are started again when their latest ready revision changes.
+	ListenStart() bus.Listener
+
+	// ListenStop returns a bus listener to receive service stopped events, with a `service` key
+	// holding it. Events of revision changes include the new revision in the `revision` key.
+	ListenStop() bus.Listener
+}
+
+type watcher struct {
+	sync.RWMutex
+	log      *logp.Logger
+	api      API
+	projects []string
+	regions  []string
+	period   time.Duration
+	ctx      context.Context
+	stop     context.CancelFunc
+	services map[string]*Service
+	stopped  sync.WaitGroup
+	bus      bus.Bus
+}
+
+// NewWatcher creates a new Watcher of the services of the projects and regions of the config
+func NewWatcher(log *logp.Logger, api API, cfg Config) (Watcher, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	period := cfg.SyncPeriod
+	if period == 0 {
+		period = defaultSyncPeriod
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &watcher{
+		log:      log,
+		api:      api,
+		projects: cfg.Projects,
+		regions:  cfg.Regions,
+		period:   period,
+		ctx:      ctx,
+		stop:     cancel,
+		services: make(map[string]*Service),
+		bus:      bus.New(log, "cloudrun"),
+	}, nil
+}
+
+// Services returns the services with a ready revision
+func (w *watcher) Services() map[string]*Service {
+	w.RLock()
+	defer w.RUnlock()
+	res := make(map[string]*Service, len(w.services))
+	for k, v := range w.services {
+		res[k] = v
+	}
+	return res
+}
+
+// Start watching the services, the first listing is done synchronously so errors authenticating
+// or reaching the API are returned
+func (w *watcher) Start() error {
+	w.log.Debug("Start Cloud Run services watcher")
+	if err := w.sync(); err != nil {
+		return err
+	}
+
+	w.stopped.Add(1)
+	go w.watch()
+	return nil
+}
+
+// Stop watching the services
+func (w *watcher) Stop() {
+	w.stop()
+	w.stopped.Wait()
+}
+
+func (w *watcher) watch() {
+	defer w.stopped.Done()
+
+	poll.Loop(w.ctx, w.log, poll.Config{
+		Period:      w.period,
+		MaxBackoff:  maxBackoff,
+		Description: "listing Cloud Run services",
+	}, w.sync)
+	w.log.Debug("Watcher stopped")
+}
+
+// sync lists the services and publishes the events of the services that were deployed or deleted
+// since the last listing, and of the ones whose latest ready revision changed
+func (w *watcher) sync() error {
+	ready := make(map[string]*Service)
+	for _, project := range w.projects {
+		for _, region := range w.regions {
+			services, err := w.api.Services(w.ctx, project, region)
+			if err != nil {
+				return err
+			}
+			for i := range services {
+				if services[i].LatestReadyRevision != "" {
+					ready[services[i].ID] = &services[i]
+				}
+			}
+		}
+	}
+
+	w.Lock()
+	started, stopped := poll.Diff(w.services, ready, func(old, s *Service) bool {
+		return old.LatestReadyRevision != s.LatestReadyRevision
+	})
+	w.services = ready
+	w.Unlock()
+
+	for _, s := range stopped {
+		e := bus.Event{
+			"stop":    true,
+			"service": s,
+		}
+		if new, ok := ready[s.ID]; ok {
+			e["revision"] = new.LatestReadyRevision
+		}
+		w.bus.Publish(e)
+	}
+	poll.Publish(w.bus, "service", started, nil)
+	return nil
+}
+
+func (w *watcher) ListenStart() bus.Listener {
+	return w.bus.Subscribe("start")
+}
+
+func (w *watcher) ListenStop() bus.Listener {
+	return w.bus.Subscribe("stop")
+}
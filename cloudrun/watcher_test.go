@@ -0,0 +1,171 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cloudrun
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-autodiscover/internal/polltest"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// mockAPI serves the services of the locations set
+type mockAPI struct {
+	polltest.Source[Service]
+}
+
+func (m *mockAPI) Services(ctx context.Context, project, region string) ([]Service, error) {
+	all, _, err := m.List()
+	var services []Service
+	for _, s := range all {
+		if strings.HasPrefix(s.ID, "projects/"+project+"/locations/"+region+"/") {
+			services = append(services, s)
+		}
+	}
+	return services, err
+}
+
+func readyService(name, revision string) Service {
+	return Service{ID: "projects/p1/locations/europe-west1/services/" + name, Name: name, LatestReadyRevision: revision}
+}
+
+func TestWatcher(t *testing.T) {
+	api := &mockAPI{}
+	api.Set(readyService("web", "web-00001-abc"), readyService("broken", ""))
+
+	w, err := NewWatcher(logp.L(), api, Config{Projects: []string{"p1"}, Regions: []string{"europe-west1", "us-central1"}, SyncPeriod: 10 * time.Millisecond})
+	require.NoError(t, err)
+	start, stop := polltest.Start(t, w)
+
+	assert.Equal(t, "web", polltest.NextEvent(t, start)["service"].(*Service).Name)
+	assert.Len(t, w.Services(), 1)
+
+	// New revision
+	api.Set(readyService("web", "web-00002-def"))
+	e := polltest.NextEvent(t, stop)
+	assert.Equal(t, "web-00001-abc", e["service"].(*Service).LatestReadyRevision)
+	assert.Equal(t, "web-00002-def", e["revision"])
+	assert.Equal(t, "web-00002-def", polltest.NextEvent(t, start)["service"].(*Service).LatestReadyRevision)
+
+	// Deleted service
+	api.Set()
+	e = polltest.NextEvent(t, stop)
+	assert.Equal(t, "web", e["service"].(*Service).Name)
+	assert.NotContains(t, e, "revision")
+}
+
+func TestWatcherStartError(t *testing.T) {
+	polltest.StartError(t, func(err error) (polltest.Watcher, error) {
+		api := &mockAPI{}
+		api.Fail(err)
+		return NewWatcher(logp.L(), api, Config{Projects: []string{"p1"}, Regions: []string{"europe-west1"}})
+	})
+
+	_, err := NewWatcher(logp.L(), &mockAPI{}, Config{Projects: []string{"p1"}})
+	assert.Error(t, err)
+}
+
+func TestClient(t *testing.T) {
+	tokens := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/computeMetadata/v1/instance/service-accounts/default/token":
+			assert.Equal(t, "Google", r.Header.Get("Metadata-Flavor"))
+			tokens++
+			_ = json.NewEncoder(w).Encode(mapstr.M{"access_token": "token", "expires_in": 3599, "token_type": "Bearer"})
+		case r.URL.Path == "/v2/projects/p1/locations/europe-west1/services":
+			assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+			if r.URL.Query().Get("pageToken") == "" {
+				_, _ = w.Write([]byte(`{
+					"services": [{
+						"name": "projects/p1/locations/europe-west1/services/web",
+						"uid": "8e3b",
+						"uri": "https://web-abc-ew.a.run.app",
+						"labels": {"team": "payments"},
+						"latestReadyRevision": "projects/p1/locations/europe-west1/services/web/revisions/web-00002-def",
+						"trafficStatuses": [
+							{"type": "TRAFFIC_TARGET_ALLOCATION_TYPE_LATEST", "percent": 90},
+							{"type": "TRAFFIC_TARGET_ALLOCATION_TYPE_REVISION", "revision": "web-00001-abc", "percent": 10, "tag": "old"}
+						]
+					}],
+					"nextPageToken": "next"
+				}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"services": [{"name": "projects/p1/locations/europe-west1/services/api"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+	api, err := NewClient(Config{Projects: []string{"p1"}, Regions: []string{"europe-west1"}, Endpoint: server.URL})
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		services, err := api.Services(context.Background(), "p1", "europe-west1")
+		require.NoError(t, err)
+		require.Len(t, services, 2)
+		assert.Equal(t, "web", services[0].Name)
+		assert.Equal(t, "p1", services[0].Project)
+		assert.Equal(t, "web-00002-def", services[0].LatestReadyRevision)
+		assert.Equal(t, []Traffic{
+			{Revision: "web-00002-def", Percent: 90},
+			{Revision: "web-00001-abc", Percent: 10, Tag: "old"},
+		}, services[0].Traffic)
+		assert.Equal(t, "api", services[1].Name)
+	}
+	assert.Equal(t, 1, tokens)
+
+	_, err = api.Services(context.Background(), "p2", "europe-west1")
+	assert.Error(t, err)
+}
+
+func TestGenerateMetadata(t *testing.T) {
+	s := readyService("web", "web-00002-def")
+	s.Project = "p1"
+	s.Region = "europe-west1"
+	s.UID = "8e3b"
+	s.Labels = map[string]string{"team": "payments"}
+	s.Traffic = []Traffic{{Revision: "web-00002-def", Percent: 90}, {Revision: "web-00002-def", Percent: 5, Tag: "latest"}}
+	assert.Equal(t, mapstr.M{
+		"cloud": mapstr.M{
+			"provider": "gcp",
+			"project":  mapstr.M{"id": "p1"},
+			"region":   "europe-west1",
+			"service":  mapstr.M{"name": "Cloud Run"},
+		},
+		"gcp": mapstr.M{
+			"cloudrun": mapstr.M{
+				"service":  mapstr.M{"name": "web", "uid": "8e3b", "labels": mapstr.M{"team": "payments"}},
+				"revision": mapstr.M{"name": "web-00002-def", "traffic_percent": 95},
+			},
+		},
+	}, GenerateMetadata(&s))
+}
@@ -0,0 +1,339 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// autodiscover-inspect prints the metadata that the metadata generators would produce for a pod
+// or a service of a live cluster with a given config, to debug the filtering of labels and
+// annotations:
+//
+//	autodiscover-inspect -kubeconfig ~/.kube/config -config metadata.yml -namespace default pod web
+//
+// The config file has the settings of the metadata generators, like include_labels, and the
+// add_resource_metadata settings of the related resources. Unknown settings are rejected.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8s "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes/metadata"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const usage = `Usage: autodiscover-inspect [flags] pod|service <name>
+
+Prints the metadata generated for a pod or a service as JSON.
+
+Flags:
+`
+
+// options are the options of an inspection
+type options struct {
+	kind       string
+	namespace  string
+	name       string
+	kubeconfig string
+	showConfig bool
+
+	// config has the settings of the metadata generators, and resourceMetadata the settings
+	// of the related resources
+	config           *config.C
+	resourceMetadata *metadata.AddResourceMetadataConfig
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, "autodiscover-inspect:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("autodiscover-inspect", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	kubeconfig := flags.String("kubeconfig", "", "path of the kubeconfig, the KUBECONFIG environment variable or the in-cluster config are used if empty")
+	configPath := flags.String("config", "", "path of a YAML file with the metadata config, the defaults are used if empty")
+	namespace := flags.String("namespace", "default", "namespace of the pod or service")
+	showConfig := flags.Bool("show-config", false, "print the effective metadata config to stderr")
+	timeout := flags.Duration("timeout", 30*time.Second, "timeout of the requests to the API server")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errors.New("a kind and a name are required")
+	}
+
+	opts := options{
+		kind:       flags.Arg(0),
+		name:       flags.Arg(1),
+		namespace:  *namespace,
+		kubeconfig: *kubeconfig,
+		showConfig: *showConfig,
+	}
+	if err := opts.loadConfig(*configPath); err != nil {
+		return err
+	}
+
+	client, err := kubernetes.GetKubernetesClient(opts.kubeconfig, kubernetes.KubeClientOptions{})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	return inspect(ctx, client, opts, stdout, stderr)
+}
+
+// loadConfig loads the metadata config from a YAML file, or the defaults if path is empty
+func (o *options) loadConfig(path string) error {
+	o.config = config.NewConfig()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if o.config, err = config.NewConfigWithYAML(data, path); err != nil {
+			return fmt.Errorf("unable to parse config %s: %w", path, err)
+		}
+	}
+
+	// The node and namespace configs of the defaults are the same config, they are unpacked into
+	// different ones so that they can be configured separately
+	o.resourceMetadata = metadata.GetDefaultResourceMetadataConfig()
+	o.resourceMetadata.Namespace = metadata.GetDefaultResourceMetadataConfig().Namespace
+	if o.config.HasField("add_resource_metadata") {
+		related := struct {
+			AddResourceMetadata *metadata.AddResourceMetadataConfig `config:"add_resource_metadata"`
+		}{o.resourceMetadata}
+		if err := o.config.Unpack(&related); err != nil {
+			return fmt.Errorf("invalid add_resource_metadata config: %w", err)
+		}
+		if _, err := o.config.Remove("add_resource_metadata", -1); err != nil {
+			return err
+		}
+	}
+	if o.kubeconfig != "" && !o.config.HasField("kube_config") {
+		// The cluster is identified from the kubeconfig too
+		if err := o.config.SetString("kube_config", -1, o.kubeconfig); err != nil {
+			return err
+		}
+	}
+	if err := metadata.ValidateConfig(o.config); err != nil {
+		return fmt.Errorf("invalid metadata config: %w", err)
+	}
+	return nil
+}
+
+// inspect prints the metadata generated for the resource of the options
+func inspect(ctx context.Context, client k8s.Interface, opts options, stdout, stderr io.Writer) error {
+	if opts.showConfig {
+		if err := printEffectiveConfig(opts, stderr); err != nil {
+			return err
+		}
+	}
+
+	stores := newStores(ctx, client)
+	var (
+		metaGen metadata.MetaGen
+		obj     kubernetes.Resource
+		err     error
+	)
+	switch opts.kind {
+	case "pod":
+		var pod *kubernetes.Pod
+		if pod, err = client.CoreV1().Pods(opts.namespace).Get(ctx, opts.name, metav1.GetOptions{}); err != nil {
+			return err
+		}
+		obj = pod
+		metaGen = stores.podMetaGen(pod, opts)
+	case "service":
+		var svc *kubernetes.Service
+		if svc, err = client.CoreV1().Services(opts.namespace).Get(ctx, opts.name, metav1.GetOptions{}); err != nil {
+			return err
+		}
+		obj = svc
+		metaGen = stores.serviceMetaGen(svc, opts)
+	default:
+		return fmt.Errorf("unsupported kind %q, use pod or service", opts.kind)
+	}
+	if stores.err != nil {
+		return stores.err
+	}
+	return printJSON(stdout, metaGen.Generate(obj))
+}
+
+// stores are the stores of the related resources of the inspected resource, with only the
+// resources found, as they would be in the stores of the watchers
+type stores struct {
+	ctx    context.Context
+	client k8s.Interface
+	err    error
+}
+
+func newStores(ctx context.Context, client k8s.Interface) *stores {
+	return &stores{ctx: ctx, client: client}
+}
+
+func (s *stores) podMetaGen(pod *kubernetes.Pod, opts options) metadata.MetaGen {
+	conf := opts.resourceMetadata
+	var nodeGen, namespaceGen, rsGen, jobGen metadata.MetaGen
+	if conf.Node.Enabled() {
+		nodeGen = metadata.NewNodeMetadataGenerator(conf.Node, s.node(pod.Spec.NodeName), s.client)
+	}
+	if conf.Namespace.Enabled() {
+		namespaceGen = metadata.NewNamespaceMetadataGenerator(conf.Namespace, s.namespace(pod.Namespace), s.client)
+	}
+
+	replicasets, jobs := newStore(), newStore()
+	for _, ref := range pod.OwnerReferences {
+		switch ref.Kind {
+		case "ReplicaSet":
+			rs, err := s.client.AppsV1().ReplicaSets(pod.Namespace).Get(s.ctx, ref.Name, metav1.GetOptions{})
+			s.add(replicasets, rs, err)
+		case "Job":
+			job, err := s.client.BatchV1().Jobs(pod.Namespace).Get(s.ctx, ref.Name, metav1.GetOptions{})
+			s.add(jobs, job, err)
+		}
+	}
+	if conf.Deployment {
+		rsGen = metadata.NewReplicasetMetadataGenerator(opts.config, replicasets, s.client)
+	}
+	if conf.CronJob {
+		jobGen = metadata.NewJobMetadataGenerator(opts.config, jobs, s.client)
+	}
+
+	pods := newStore()
+	_ = pods.Add(pod)
+	return metadata.NewPodMetadataGenerator(opts.config, pods, s.client, nodeGen, namespaceGen, rsGen, jobGen, conf)
+}
+
+func (s *stores) serviceMetaGen(svc *kubernetes.Service, opts options) metadata.MetaGen {
+	var namespaceGen metadata.MetaGen
+	if opts.resourceMetadata.Namespace.Enabled() {
+		namespaceGen = metadata.NewNamespaceMetadataGenerator(opts.resourceMetadata.Namespace, s.namespace(svc.Namespace), s.client)
+	}
+	services := newStore()
+	_ = services.Add(svc)
+	return metadata.NewServiceMetadataGenerator(opts.config, services, namespaceGen, s.client)
+}
+
+func (s *stores) node(name string) cache.Store {
+	store := newStore()
+	if name != "" {
+		node, err := s.client.CoreV1().Nodes().Get(s.ctx, name, metav1.GetOptions{})
+		s.add(store, node, err)
+	}
+	return store
+}
+
+func (s *stores) namespace(name string) cache.Store {
+	store := newStore()
+	namespace, err := s.client.CoreV1().Namespaces().Get(s.ctx, name, metav1.GetOptions{})
+	s.add(store, namespace, err)
+	return store
+}
+
+// add adds a related resource to a store, related resources not found are missing in the
+// metadata, other errors are kept
+func (s *stores) add(store cache.Store, obj kubernetes.Resource, err error) {
+	switch {
+	case err == nil:
+		_ = store.Add(obj)
+	case apierrors.IsNotFound(err):
+	case s.err == nil:
+		s.err = err
+	}
+}
+
+func newStore() cache.Store {
+	return cache.NewStore(cache.MetaNamespaceKeyFunc)
+}
+
+// printEffectiveConfig prints the configs resolved with the defaults, with the names of their
+// settings
+func printEffectiveConfig(opts options, w io.Writer) error {
+	effective, err := metadata.EffectiveConfig(opts.config)
+	if err != nil {
+		return err
+	}
+	related, err := opts.resourceMetadata.Effective()
+	if err != nil {
+		return err
+	}
+	relatedSettings := map[string]interface{}{
+		"deployment": related.Deployment,
+		"cronjob":    related.CronJob,
+	}
+	for name, c := range map[string]*metadata.Config{"node": related.Node, "namespace": related.Namespace} {
+		if c == nil {
+			relatedSettings[name] = map[string]interface{}{"enabled": false}
+			continue
+		}
+		if relatedSettings[name], err = settings(c); err != nil {
+			return err
+		}
+	}
+	metadataSettings, err := settings(&effective)
+	if err != nil {
+		return err
+	}
+	metadataSettings["add_resource_metadata"] = relatedSettings
+
+	data, err := json.MarshalIndent(metadataSettings, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// settings returns the settings of a metadata config
+func settings(c *metadata.Config) (map[string]interface{}, error) {
+	cfg, err := config.NewConfigFrom(c)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]interface{}{}
+	if err := cfg.Unpack(&out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// printJSON prints metadata as indented JSON, with sorted keys
+func printJSON(w io.Writer, meta mapstr.M) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(metadata.Canonical(meta))
+}
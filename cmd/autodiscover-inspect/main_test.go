@@ -0,0 +1,124 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes/kubernetestest"
+)
+
+func TestInspectPod(t *testing.T) {
+	boolean := true
+	replicaset := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "web-7d9f8c6b5",
+			Namespace:       "default",
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "web", Controller: &boolean}},
+		},
+	}
+	client := k8sfake.NewSimpleClientset(
+		kubernetestest.Pod("default", "web",
+			kubernetestest.WithLabels(map[string]string{"app": "web", "tier": "frontend"}),
+			kubernetestest.WithAnnotations(map[string]string{"kubectl.kubernetes.io/last-applied-configuration": "{}"}),
+			kubernetestest.WithOwner("apps/v1", "ReplicaSet", "web-7d9f8c6b5"),
+		),
+		kubernetestest.Node(kubernetestest.DefaultNode, kubernetestest.WithLabels(map[string]string{"zone": "a"})),
+		kubernetestest.Namespace("default", kubernetestest.WithLabels(map[string]string{"team": "web"})),
+		replicaset,
+	)
+
+	opts := options{kind: "pod", namespace: "default", name: "web", showConfig: true}
+	require.NoError(t, opts.loadConfig(writeConfig(t, `
+include_labels: [app]
+include_annotations: ["kubectl.kubernetes.io/*"]
+annotations.max_value_length: 1
+add_resource_metadata:
+  namespace.enabled: false
+`)))
+
+	var stdout, stderr bytes.Buffer
+	require.NoError(t, inspect(context.Background(), client, opts, &stdout, &stderr))
+
+	var meta map[string]interface{}
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &meta))
+	k8sMeta := meta["kubernetes"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"app": "web"}, k8sMeta["labels"])
+	assert.Equal(t, map[string]interface{}{"kubectl_kubernetes_io/last-applied-configuration": "{...(truncated)"}, k8sMeta["annotations"])
+	assert.Equal(t, map[string]interface{}{"name": "web"}, k8sMeta["deployment"])
+	assert.Equal(t, "a", k8sMeta["node"].(map[string]interface{})["labels"].(map[string]interface{})["zone"])
+	assert.NotContains(t, k8sMeta, "namespace_labels")
+
+	var effective map[string]interface{}
+	require.NoError(t, json.Unmarshal(stderr.Bytes(), &effective))
+	assert.Equal(t, []interface{}{"app"}, effective["include_labels"])
+	assert.Equal(t, map[string]interface{}{"enabled": false}, effective["add_resource_metadata"].(map[string]interface{})["namespace"])
+}
+
+func TestInspectService(t *testing.T) {
+	client := k8sfake.NewSimpleClientset(
+		&v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Labels: map[string]string{"app": "web"}}},
+		kubernetestest.Namespace("default", kubernetestest.WithLabels(map[string]string{"team": "web"})),
+	)
+	opts := options{kind: "service", namespace: "default", name: "web"}
+	require.NoError(t, opts.loadConfig(""))
+
+	var stdout bytes.Buffer
+	require.NoError(t, inspect(context.Background(), client, opts, &stdout, nil))
+	var meta map[string]interface{}
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &meta))
+	k8sMeta := meta["kubernetes"].(map[string]interface{})
+	assert.Equal(t, "web", k8sMeta["service"].(map[string]interface{})["name"])
+	assert.Equal(t, map[string]interface{}{"team": "web", "kubernetes_io/metadata_name": "default"}, k8sMeta["namespace_labels"])
+}
+
+func TestInspectErrors(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+
+	opts := options{kind: "pod", namespace: "default", name: "unknown"}
+	require.NoError(t, opts.loadConfig(""))
+	assert.Error(t, inspect(context.Background(), client, opts, &bytes.Buffer{}, nil))
+
+	opts.kind = "deployment"
+	assert.Error(t, inspect(context.Background(), client, opts, &bytes.Buffer{}, nil))
+
+	// Misspelled settings are rejected
+	err := opts.loadConfig(writeConfig(t, "include_label: [app]\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "include_label")
+
+	assert.Error(t, run([]string{"pod"}, &bytes.Buffer{}, &bytes.Buffer{}))
+}
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "metadata.yml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
@@ -0,0 +1,459 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package conditions evaluates conditions over the metadata of discovered resources, so
+// providers can filter their events before publishing them.
+//
+// Conditions are configured like:
+//
+//	equals:
+//	  kubernetes.namespace: web
+//	regexp:
+//	  kubernetes.pod.name: "^nginx-"
+//	range:
+//	  data.port.gte: 8000
+//	  data.port.lt: 9000
+//	not:
+//	  has_fields: ["kubernetes.labels.canary"]
+//
+// All the conditions of a configuration must be met, `and`, `or` and `not` combine them.
+package conditions
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// Condition is met or not by some metadata
+type Condition interface {
+	// Check returns true if the metadata meets the condition
+	Check(mapstr.M) bool
+
+	String() string
+}
+
+// Config of a condition
+type Config struct {
+	// Equals is met if the fields have the given values
+	Equals mapstr.M `config:"equals"`
+
+	// Contains is met if the fields contain the given substrings
+	Contains mapstr.M `config:"contains"`
+
+	// Regexp is met if the fields match the given regular expressions
+	Regexp mapstr.M `config:"regexp"`
+
+	// Range is met if the numeric fields are in the range, keys are fields suffixed by one of
+	// `.gt`, `.gte`, `.lt` or `.lte`
+	Range mapstr.M `config:"range"`
+
+	// HasFields is met if all the fields exist
+	HasFields []string `config:"has_fields"`
+
+	And []Config `config:"and"`
+	Or  []Config `config:"or"`
+	Not *Config  `config:"not"`
+}
+
+// Validate the config, conditions are validated by building them
+func (c *Config) Validate() error {
+	_, err := NewCondition(c)
+	return err
+}
+
+// NewCondition builds a condition from its config
+func NewCondition(c *Config) (Condition, error) {
+	if c == nil {
+		return nil, errors.New("missing condition")
+	}
+
+	var conditions []Condition
+	add := func(condition Condition, err error) error {
+		if err != nil {
+			return err
+		}
+		conditions = append(conditions, condition)
+		return nil
+	}
+
+	if len(c.Equals) > 0 {
+		if err := add(newEquals(c.Equals)); err != nil {
+			return nil, err
+		}
+	}
+	if len(c.Contains) > 0 {
+		if err := add(newContains(c.Contains)); err != nil {
+			return nil, err
+		}
+	}
+	if len(c.Regexp) > 0 {
+		if err := add(newRegexp(c.Regexp)); err != nil {
+			return nil, err
+		}
+	}
+	if len(c.Range) > 0 {
+		if err := add(newRange(c.Range)); err != nil {
+			return nil, err
+		}
+	}
+	if len(c.HasFields) > 0 {
+		conditions = append(conditions, hasFields(c.HasFields))
+	}
+	if len(c.And) > 0 {
+		if err := add(newList(c.And, "and")); err != nil {
+			return nil, err
+		}
+	}
+	if len(c.Or) > 0 {
+		if err := add(newList(c.Or, "or")); err != nil {
+			return nil, err
+		}
+	}
+	if c.Not != nil {
+		inner, err := NewCondition(c.Not)
+		if err != nil {
+			return nil, fmt.Errorf("not: %w", err)
+		}
+		conditions = append(conditions, not{inner})
+	}
+
+	switch len(conditions) {
+	case 0:
+		return nil, errors.New("missing condition")
+	case 1:
+		return conditions[0], nil
+	default:
+		return and(conditions), nil
+	}
+}
+
+func newList(configs []Config, operator string) (Condition, error) {
+	conditions := make([]Condition, len(configs))
+	for i := range configs {
+		condition, err := NewCondition(&configs[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operator, err)
+		}
+		conditions[i] = condition
+	}
+	if operator == "or" {
+		return or(conditions), nil
+	}
+	return and(conditions), nil
+}
+
+type and []Condition
+
+func (c and) Check(m mapstr.M) bool {
+	for _, condition := range c {
+		if !condition.Check(m) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c and) String() string {
+	return join(c, " and ")
+}
+
+type or []Condition
+
+func (c or) Check(m mapstr.M) bool {
+	for _, condition := range c {
+		if condition.Check(m) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c or) String() string {
+	return join(c, " or ")
+}
+
+type not struct {
+	condition Condition
+}
+
+func (c not) Check(m mapstr.M) bool {
+	return !c.condition.Check(m)
+}
+
+func (c not) String() string {
+	return "not " + c.condition.String()
+}
+
+func join(conditions []Condition, sep string) string {
+	parts := make([]string, len(conditions))
+	for i, condition := range conditions {
+		parts[i] = condition.String()
+	}
+	return "(" + strings.Join(parts, sep) + ")"
+}
+
+// equals compares the values of fields, numbers are compared by value and anything else by its
+// string representation
+type equals map[string]interface{}
+
+func newEquals(fields mapstr.M) (Condition, error) {
+	c := equals{}
+	for field, value := range fields.Flatten() {
+		switch value.(type) {
+		case string, bool, int, int64, uint64, float64:
+		default:
+			return nil, fmt.Errorf("equals: unsupported value %v of field %s", value, field)
+		}
+		c[field] = value
+	}
+	return c, nil
+}
+
+func (c equals) Check(m mapstr.M) bool {
+	for field, expected := range c {
+		value, err := m.GetValue(field)
+		if err != nil || !equal(value, expected) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c equals) String() string {
+	return describe("equals", c)
+}
+
+func equal(value, expected interface{}) bool {
+	if a, ok := toFloat(value); ok {
+		if b, ok := toFloat(expected); ok {
+			return a == b
+		}
+	}
+	return fmt.Sprint(value) == fmt.Sprint(expected)
+}
+
+// contains checks if string fields, or any of the strings of list fields, contain substrings
+type contains map[string]string
+
+func newContains(fields mapstr.M) (Condition, error) {
+	c := contains{}
+	for field, value := range fields.Flatten() {
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("contains: value of field %s must be a string", field)
+		}
+		c[field] = s
+	}
+	return c, nil
+}
+
+func (c contains) Check(m mapstr.M) bool {
+	for field, substring := range c {
+		value, err := m.GetValue(field)
+		if err != nil || !anyString(value, func(s string) bool { return strings.Contains(s, substring) }) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c contains) String() string {
+	return describe("contains", c)
+}
+
+// regexps checks if string fields, or any of the strings of list fields, match expressions
+type regexps map[string]*regexp.Regexp
+
+func newRegexp(fields mapstr.M) (Condition, error) {
+	c := regexps{}
+	for field, value := range fields.Flatten() {
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("regexp: value of field %s must be a string", field)
+		}
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("regexp: invalid expression of field %s: %w", field, err)
+		}
+		c[field] = re
+	}
+	return c, nil
+}
+
+func (c regexps) Check(m mapstr.M) bool {
+	for field, re := range c {
+		value, err := m.GetValue(field)
+		if err != nil || !anyString(value, re.MatchString) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c regexps) String() string {
+	return describe("regexp", c)
+}
+
+// ranges checks numeric fields against bounds
+type ranges map[string]bound
+
+type bound struct {
+	gt, gte, lt, lte *float64
+}
+
+func newRange(fields mapstr.M) (Condition, error) {
+	c := ranges{}
+	for key, value := range fields.Flatten() {
+		i := strings.LastIndex(key, ".")
+		if i <= 0 {
+			return nil, fmt.Errorf("range: %s must be a field with an operator suffix", key)
+		}
+		field, operator := key[:i], key[i+1:]
+		limit, ok := toFloat(value)
+		if !ok {
+			return nil, fmt.Errorf("range: value of %s must be a number", key)
+		}
+
+		b := c[field]
+		switch operator {
+		case "gt":
+			b.gt = &limit
+		case "gte":
+			b.gte = &limit
+		case "lt":
+			b.lt = &limit
+		case "lte":
+			b.lte = &limit
+		default:
+			return nil, fmt.Errorf("range: unknown operator %q of field %s", operator, field)
+		}
+		c[field] = b
+	}
+	return c, nil
+}
+
+func (c ranges) Check(m mapstr.M) bool {
+	for field, b := range c {
+		raw, err := m.GetValue(field)
+		if err != nil {
+			return false
+		}
+		value, ok := toFloat(raw)
+		if !ok {
+			return false
+		}
+		if (b.gt != nil && value <= *b.gt) || (b.gte != nil && value < *b.gte) ||
+			(b.lt != nil && value >= *b.lt) || (b.lte != nil && value > *b.lte) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c ranges) String() string {
+	return describe("range", c)
+}
+
+type hasFields []string
+
+func (c hasFields) Check(m mapstr.M) bool {
+	for _, field := range c {
+		if _, err := m.GetValue(field); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (c hasFields) String() string {
+	return fmt.Sprintf("has_fields: %v", []string(c))
+}
+
+// describe formats a condition with its fields sorted
+func describe[T any](name string, fields map[string]T) string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = fmt.Sprintf("%s: %v", key, fields[key])
+	}
+	return name + ": {" + strings.Join(parts, ", ") + "}"
+}
+
+func (b bound) String() string {
+	var parts []string
+	for _, p := range []struct {
+		op    string
+		value *float64
+	}{{"gt", b.gt}, {"gte", b.gte}, {"lt", b.lt}, {"lte", b.lte}} {
+		if p.value != nil {
+			parts = append(parts, p.op+" "+strconv.FormatFloat(*p.value, 'g', -1, 64))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func anyString(value interface{}, f func(string) bool) bool {
+	switch v := value.(type) {
+	case string:
+		return f(v)
+	case []string:
+		for _, s := range v {
+			if f(s) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok && f(s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
@@ -0,0 +1,112 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package conditions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+var metadata = mapstr.M{
+	"data": mapstr.M{
+		"port": 8080,
+		"host": "10.0.0.7",
+	},
+	"kubernetes": mapstr.M{
+		"namespace": "web",
+		"pod":       mapstr.M{"name": "nginx-6d4cf56db6-tl2xp"},
+		"labels":    mapstr.M{"app": "nginx", "tier": "frontend"},
+		"container": mapstr.M{"ports": []interface{}{"http", "metrics"}},
+	},
+	"ready": true,
+}
+
+func TestConditions(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		met    bool
+	}{
+		{"equals", `equals.kubernetes.namespace: web`, true},
+		{"equals number", `equals.data.port: 8080`, true},
+		{"equals bool", `equals.ready: true`, true},
+		{"equals mismatch", `equals: {kubernetes.namespace: web, data.port: 80}`, false},
+		{"equals missing", `equals.kubernetes.node: web`, false},
+		{"contains", `contains.kubernetes.pod.name: nginx`, true},
+		{"contains list", `contains.kubernetes.container.ports: metric`, true},
+		{"contains mismatch", `contains.kubernetes.pod.name: redis`, false},
+		{"regexp", `regexp.kubernetes.pod.name: "^nginx-[a-z0-9]+-"`, true},
+		{"regexp mismatch", `regexp.kubernetes.pod.name: "^redis"`, false},
+		{"range", `range: {data.port.gte: 8000, data.port.lt: 9000}`, true},
+		{"range out", `range.data.port.gt: 8080`, false},
+		{"range not numeric", `range.kubernetes.namespace.gt: 1`, false},
+		{"has fields", `has_fields: [kubernetes.labels.app, data.host]`, true},
+		{"has fields missing", `has_fields: [kubernetes.labels.canary]`, false},
+		{"not", `not.equals.kubernetes.labels.tier: backend`, true},
+		{"and", `and: [{equals.kubernetes.labels.app: nginx}, {range.data.port.lte: 8080}]`, true},
+		{"or", `or: [{equals.kubernetes.labels.app: redis}, {contains.kubernetes.pod.name: nginx}]`, true},
+		{"or mismatch", `or: [{equals.kubernetes.labels.app: redis}, {not.has_fields: [data.port]}]`, false},
+		{"all conditions of a config", `{equals.kubernetes.namespace: web, has_fields: [kubernetes.labels.canary]}`, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := config.NewConfigWithYAML([]byte(test.config), test.name)
+			require.NoError(t, err)
+
+			var c Config
+			require.NoError(t, cfg.Unpack(&c))
+			condition, err := NewCondition(&c)
+			require.NoError(t, err)
+			assert.Equal(t, test.met, condition.Check(metadata), condition.String())
+		})
+	}
+}
+
+func TestConditionsValidation(t *testing.T) {
+	for _, raw := range []string{
+		`{}`,
+		`regexp.kubernetes.pod.name: "(nginx"`,
+		`range.data.port.between: 10`,
+		`range.data.port.gt: ten`,
+		`contains.kubernetes.pod.name: [nginx]`,
+		`not: {}`,
+		`or: [{equals.a: b}, {}]`,
+	} {
+		cfg, err := config.NewConfigWithYAML([]byte(raw), raw)
+		require.NoError(t, err)
+
+		var c Config
+		assert.Error(t, cfg.Unpack(&c), raw)
+	}
+}
+
+func TestConditionString(t *testing.T) {
+	condition, err := NewCondition(&Config{
+		Equals: mapstr.M{"kubernetes.namespace": "web"},
+		Range:  mapstr.M{"data.port.gte": 8000, "data.port.lt": 9000},
+		Not:    &Config{HasFields: []string{"kubernetes.labels.canary"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "(equals: {kubernetes.namespace: web} and range: {data.port: gte 8000 lt 9000} and not has_fields: [kubernetes.labels.canary])", condition.String())
+}
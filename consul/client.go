@@ -0,0 +1,265 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAddress  = "http://127.0.0.1:8500"
+	defaultWaitTime = 30 * time.Second
+
+	indexHeader = "X-Consul-Index"
+	tokenHeader = "X-Consul-Token"
+)
+
+// Config of the connection to the Consul API
+type Config struct {
+	// Address of the Consul agent, CONSUL_HTTP_ADDR or http://127.0.0.1:8500 by default
+	Address string `config:"address"`
+
+	// Datacenter of the services, the one of the agent by default
+	Datacenter string `config:"datacenter"`
+
+	// Token is the ACL token, CONSUL_HTTP_TOKEN by default
+	Token string `config:"token"`
+
+	// Services are the names of the services to discover, all by default
+	Services []string `config:"services"`
+
+	// Tags the service instances need to have to be discovered
+	Tags []string `config:"tags"`
+
+	// Node is the name of the node whose service instances are discovered, all the nodes by default
+	Node string `config:"node"`
+
+	// WaitTime is the maximum time blocking queries wait for changes in the catalog or in the
+	// health of the instances
+	WaitTime time.Duration `config:"wait_time"`
+
+	// SyncPeriod is the time waited between queries
+	SyncPeriod time.Duration `config:"sync_period"`
+}
+
+// Validate the config
+func (c *Config) Validate() error {
+	if c.WaitTime < 0 {
+		return fmt.Errorf("invalid consul wait time %v", c.WaitTime)
+	}
+	if c.SyncPeriod < 0 {
+		return fmt.Errorf("invalid consul sync period %v", c.SyncPeriod)
+	}
+	if c.Address != "" {
+		if _, err := url.Parse(c.Address); err != nil {
+			return fmt.Errorf("invalid consul address: %w", err)
+		}
+	}
+	return nil
+}
+
+// API is the subset of the Consul API used by the watcher
+type API interface {
+	// Services returns the names of the services of the catalog with their tags, and the index of
+	// the last change, blocking until there are changes after the given index if it is not zero
+	Services(ctx context.Context, index uint64) (map[string][]string, uint64, error)
+
+	// Instances returns the instances of a service with their health, and the index of the last
+	// change, blocking until there are changes after the given index if it is not zero
+	Instances(ctx context.Context, service string, index uint64) ([]Instance, uint64, error)
+}
+
+type client struct {
+	http    *http.Client
+	address string
+	query   url.Values
+	token   string
+	wait    time.Duration
+}
+
+// NewClient returns a client of the Consul HTTP API
+func NewClient(cfg Config) (API, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	address := cfg.Address
+	if address == "" {
+		address = os.Getenv("CONSUL_HTTP_ADDR")
+	}
+	if address == "" {
+		address = defaultAddress
+	}
+	if !strings.Contains(address, "://") {
+		// CONSUL_HTTP_ADDR is usually given without scheme
+		address = "http://" + address
+	}
+	token := cfg.Token
+	if token == "" {
+		token = os.Getenv("CONSUL_HTTP_TOKEN")
+	}
+	wait := cfg.WaitTime
+	if wait == 0 {
+		wait = defaultWaitTime
+	}
+
+	query := url.Values{}
+	if cfg.Datacenter != "" {
+		query.Set("dc", cfg.Datacenter)
+	}
+	return &client{
+		// Blocking queries can take up to the wait time plus a jitter of wait/16
+		http:    &http.Client{Timeout: wait + wait/16 + 10*time.Second},
+		address: strings.TrimSuffix(address, "/"),
+		query:   query,
+		token:   token,
+		wait:    wait,
+	}, nil
+}
+
+// Services returns the names of the services of the catalog with their tags
+func (c *client) Services(ctx context.Context, index uint64) (map[string][]string, uint64, error) {
+	var services map[string][]string
+	lastIndex, err := c.get(ctx, "/v1/catalog/services", c.blockingQuery(index), &services)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list consul services: %w", err)
+	}
+	return services, lastIndex, nil
+}
+
+// healthEntry as returned by the health endpoints
+type healthEntry struct {
+	Node struct {
+		ID         string
+		Node       string
+		Address    string
+		Datacenter string
+	}
+	Service struct {
+		ID          string
+		Service     string
+		Tags        []string
+		Address     string
+		Port        int
+		Meta        map[string]string
+		ModifyIndex uint64
+	}
+	Checks []struct {
+		Status string
+	}
+}
+
+// Instances returns the instances of a service with their health
+func (c *client) Instances(ctx context.Context, service string, index uint64) ([]Instance, uint64, error) {
+	var entries []healthEntry
+	lastIndex, err := c.get(ctx, "/v1/health/service/"+url.PathEscape(service), c.blockingQuery(index), &entries)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list instances of consul service %s: %w", service, err)
+	}
+
+	instances := make([]Instance, len(entries))
+	for i, e := range entries {
+		checks := make([]string, len(e.Checks))
+		for j, check := range e.Checks {
+			checks[j] = check.Status
+		}
+		address := e.Service.Address
+		if address == "" {
+			address = e.Node.Address
+		}
+		instances[i] = Instance{
+			ID:          e.Service.ID,
+			Service:     e.Service.Service,
+			Tags:        e.Service.Tags,
+			Address:     address,
+			Port:        e.Service.Port,
+			Meta:        e.Service.Meta,
+			Status:      aggregatedStatus(checks),
+			ModifyIndex: e.Service.ModifyIndex,
+			Node: Node{
+				ID:         e.Node.ID,
+				Name:       e.Node.Node,
+				Address:    e.Node.Address,
+				Datacenter: e.Node.Datacenter,
+			},
+		}
+	}
+	return instances, lastIndex, nil
+}
+
+// blockingQuery returns the query of a request, waiting for changes after the index if it is
+// not zero
+func (c *client) blockingQuery(index uint64) url.Values {
+	query := url.Values{}
+	for k, v := range c.query {
+		query[k] = v
+	}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", c.wait.String())
+	}
+	return query
+}
+
+// get requests a path of the API, returning the index of the response
+func (c *client) get(ctx context.Context, path string, query url.Values, v interface{}) (uint64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.address+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+	if c.token != "" {
+		req.Header.Set(tokenHeader, c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+	index, _ := strconv.ParseUint(resp.Header.Get(indexHeader), 10, 64)
+	return index, nil
+}
+
+// aggregatedStatus returns the worst status of the checks of an instance
+func aggregatedStatus(checks []string) string {
+	status := HealthPassing
+	for _, check := range checks {
+		switch check {
+		case HealthCritical, HealthMaintenance:
+			return HealthCritical
+		case HealthWarning:
+			status = HealthWarning
+		}
+	}
+	return status
+}
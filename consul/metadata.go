@@ -0,0 +1,55 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package consul
+
+import (
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// GenerateMetadata returns the metadata of a service instance under the `consul` key
+func GenerateMetadata(instance *Instance) mapstr.M {
+	service := mapstr.M{
+		"name":    instance.Service,
+		"id":      instance.ID,
+		"address": instance.Address,
+		"port":    instance.Port,
+		"health":  instance.Status,
+	}
+	if len(instance.Tags) > 0 {
+		service["tags"] = append([]string(nil), instance.Tags...)
+	}
+	if len(instance.Meta) > 0 {
+		meta := mapstr.M{}
+		for k, v := range instance.Meta {
+			meta[k] = v
+		}
+		service["meta"] = meta
+	}
+
+	return mapstr.M{
+		"consul": mapstr.M{
+			"datacenter": instance.Node.Datacenter,
+			"service":    service,
+			"node": mapstr.M{
+				"id":      instance.Node.ID,
+				"name":    instance.Node.Name,
+				"address": instance.Node.Address,
+			},
+		},
+	}
+}
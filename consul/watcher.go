@@ -0,0 +1,360 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package consul discovers the instances of the services registered in the Consul catalog,
+// watching it with blocking queries to the Consul API.
+package consul
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+	"github.com/elastic/elastic-agent-autodiscover/internal/poll"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+const (
+	// Health status of the instances
+	HealthPassing     = "passing"
+	HealthWarning     = "warning"
+	HealthCritical    = "critical"
+	HealthMaintenance = "maintenance"
+
+	defaultSyncPeriod = time.Second
+	maxBackoff        = 30 * time.Second
+)
+
+// Instance of a service
+type Instance struct {
+	ID      string
+	Service string
+	Tags    []string
+	Address string
+	Port    int
+	Meta    map[string]string
+
+	// Status is the aggregated status of the checks of the instance, passing, warning or critical
+	Status string
+
+	ModifyIndex uint64
+	Node        Node
+}
+
+// Node of a service instance
+type Node struct {
+	ID         string
+	Name       string
+	Address    string
+	Datacenter string
+}
+
+// Watcher watches the Consul catalog and keeps a list of the service instances
+type Watcher interface {
+	// Start watching the catalog
+	Start() error
+
+	// Stop watching the catalog
+	Stop()
+
+	// Instances returns the service instances by their node and ID, like <node>/<id>
+	Instances() map[string]*Instance
+
+	// ListenStart returns a bus listener to receive the service instances registered in the
+	// catalog, with an `instance` key holding them. Instances are started again when their
+	// health or tags change.
+	ListenStart() bus.Listener
+
+	// ListenStop returns a bus listener to receive the service instances deregistered or
+	// changed, with an `instance` key holding their previous state
+	ListenStop() bus.Listener
+}
+
+type watcher struct {
+	sync.RWMutex
+	log       *logp.Logger
+	api       API
+	services  map[string]bool
+	tags      []string
+	node      string
+	period    time.Duration
+	ctx       context.Context
+	stop      context.CancelFunc
+	index     uint64
+	watches   map[string]*serviceWatch
+	instances map[string]map[string]*Instance
+	stopped   sync.WaitGroup
+	bus       bus.Bus
+}
+
+// serviceWatch is the goroutine watching the instances of a service
+type serviceWatch struct {
+	stop    context.CancelFunc
+	stopped chan struct{}
+}
+
+// NewWatcher creates a new Watcher of the service instances of the API, filtered by the services,
+// tags and node of the config
+func NewWatcher(log *logp.Logger, api API, cfg Config) (Watcher, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	var services map[string]bool
+	if len(cfg.Services) > 0 {
+		services = make(map[string]bool, len(cfg.Services))
+		for _, s := range cfg.Services {
+			services[s] = true
+		}
+	}
+	period := cfg.SyncPeriod
+	if period == 0 {
+		period = defaultSyncPeriod
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &watcher{
+		log:       log,
+		api:       api,
+		services:  services,
+		tags:      cfg.Tags,
+		node:      cfg.Node,
+		period:    period,
+		ctx:       ctx,
+		stop:      cancel,
+		watches:   make(map[string]*serviceWatch),
+		instances: make(map[string]map[string]*Instance),
+		bus:       bus.New(log, "consul"),
+	}, nil
+}
+
+// Instances returns the service instances
+func (w *watcher) Instances() map[string]*Instance {
+	w.RLock()
+	defer w.RUnlock()
+	res := make(map[string]*Instance)
+	for _, instances := range w.instances {
+		for k, v := range instances {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// Start watching the catalog, the first listing is done synchronously so errors connecting to
+// the API are returned
+func (w *watcher) Start() error {
+	w.log.Debug("Start Consul catalog watcher")
+	services, index, err := w.api.Services(w.ctx, 0)
+	if err != nil {
+		return err
+	}
+	instances := make(map[string][]Instance)
+	indexes := make(map[string]uint64)
+	for service, tags := range services {
+		if !w.watched(service, tags) {
+			continue
+		}
+		instances[service], indexes[service], err = w.api.Instances(w.ctx, service, 0)
+		if err != nil {
+			return err
+		}
+	}
+	w.index = index
+
+	for service, index := range indexes {
+		w.update(w.ctx, service, instances[service])
+		w.watchService(service, index)
+	}
+	w.stopped.Add(1)
+	go w.watch()
+	return nil
+}
+
+// Stop watching the catalog
+func (w *watcher) Stop() {
+	w.stop()
+	w.stopped.Wait()
+}
+
+// watch the services of the catalog with blocking queries, starting and stopping the watches
+// of their instances
+func (w *watcher) watch() {
+	defer w.stopped.Done()
+
+	poll.Loop(w.ctx, w.log, w.pollConfig("listing Consul services"), func() error {
+		services, index, err := w.api.Services(w.ctx, w.index)
+		if err != nil {
+			// Start over with a full listing
+			w.index = 0
+			return err
+		}
+		w.index = nextIndex(w.index, index)
+		w.syncServices(services)
+		return nil
+	})
+	w.log.Debug("Watcher stopped")
+}
+
+// syncServices starts watching the instances of the new services and stops the instances of the
+// services that are not watched anymore
+func (w *watcher) syncServices(services map[string][]string) {
+	for service, tags := range services {
+		if _, ok := w.watches[service]; !ok && w.watched(service, tags) {
+			w.watchService(service, 0)
+		}
+	}
+	for service, watch := range w.watches {
+		if tags, ok := services[service]; ok && w.watched(service, tags) {
+			continue
+		}
+		// Wait for the watch to finish so its events are not published after the stops
+		watch.stop()
+		<-watch.stopped
+		delete(w.watches, service)
+		w.update(w.ctx, service, nil)
+	}
+}
+
+// watchService starts a goroutine watching the instances of a service with blocking queries
+// after the given index
+func (w *watcher) watchService(service string, index uint64) {
+	ctx, cancel := context.WithCancel(w.ctx)
+	watch := &serviceWatch{stop: cancel, stopped: make(chan struct{})}
+	w.watches[service] = watch
+
+	w.stopped.Add(1)
+	go func() {
+		defer w.stopped.Done()
+		defer close(watch.stopped)
+
+		poll.Loop(ctx, w.log, w.pollConfig("listing instances of Consul service "+service), func() error {
+			instances, lastIndex, err := w.api.Instances(ctx, service, index)
+			if err != nil {
+				index = 0
+				return err
+			}
+			index = nextIndex(index, lastIndex)
+			w.update(ctx, service, instances)
+			return nil
+		})
+	}()
+}
+
+// pollConfig returns the config of the loops of blocking queries, waiting the sync period between
+// queries
+func (w *watcher) pollConfig(description string) poll.Config {
+	return poll.Config{
+		Period:      w.period,
+		MaxBackoff:  maxBackoff,
+		Description: description,
+	}
+}
+
+// nextIndex returns the index of the next blocking query, the index can go backwards if the
+// state of the servers is restored and the listing has to start over
+func nextIndex(last, index uint64) uint64 {
+	if index < last {
+		return 0
+	}
+	return index
+}
+
+// update the instances of a service and publishes the events of the instances that were
+// registered or deregistered. Instances whose registration or health changed are stopped and
+// started again.
+func (w *watcher) update(ctx context.Context, service string, instances []Instance) {
+	current := make(map[string]*Instance)
+	for i := range instances {
+		instance := &instances[i]
+		if !hasTags(instance.Tags, w.tags) || (w.node != "" && instance.Node.Name != w.node) {
+			continue
+		}
+		current[instanceKey(instance)] = instance
+	}
+
+	w.Lock()
+	if ctx.Err() != nil {
+		w.Unlock()
+		return
+	}
+	started, stopped := poll.Diff(w.instances[service], current, changed)
+	if len(current) > 0 {
+		w.instances[service] = current
+	} else {
+		delete(w.instances, service)
+	}
+	w.Unlock()
+
+	poll.Publish(w.bus, "instance", started, stopped)
+}
+
+// watched returns true if the instances of a service have to be listed, services without the
+// required tags in any instance are not
+func (w *watcher) watched(service string, tags []string) bool {
+	if w.services != nil && !w.services[service] {
+		return false
+	}
+	return hasTags(tags, w.tags)
+}
+
+func hasTags(tags []string, required []string) bool {
+	for _, r := range required {
+		found := false
+		for _, t := range tags {
+			if t == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func changed(old, new *Instance) bool {
+	if old.ModifyIndex != new.ModifyIndex || old.Status != new.Status {
+		return true
+	}
+	// The modify index is not always set, e.g. by some proxies of the API
+	oldTags := append([]string(nil), old.Tags...)
+	newTags := append([]string(nil), new.Tags...)
+	sort.Strings(oldTags)
+	sort.Strings(newTags)
+	return old.Address != new.Address || old.Port != new.Port || !reflect.DeepEqual(oldTags, newTags)
+}
+
+// instanceKey identifies an instance, service IDs are unique per node
+func instanceKey(instance *Instance) string {
+	return instance.Node.Name + "/" + instance.ID
+}
+
+func (w *watcher) ListenStart() bus.Listener {
+	return w.bus.Subscribe("start")
+}
+
+func (w *watcher) ListenStop() bus.Listener {
+	return w.bus.Subscribe("stop")
+}
+
+func (i *Instance) String() string {
+	return fmt.Sprintf("%s[%s@%s]", i.Service, i.ID, i.Node.Name)
+}
@@ -0,0 +1,287 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-autodiscover/internal/polltest"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// mockAPI blocks the queries until there are changes after their index, the catalog index only
+// changes on registrations and the health index on any change
+type mockAPI struct {
+	sync.Mutex
+	instances    map[string][]Instance
+	catalogIndex uint64
+	healthIndex  uint64
+	changed      chan struct{}
+	err          error
+}
+
+func (m *mockAPI) Services(ctx context.Context, index uint64) (map[string][]string, uint64, error) {
+	if err := m.wait(ctx, index, func() uint64 { return m.catalogIndex }); err != nil {
+		return nil, 0, err
+	}
+	m.Lock()
+	defer m.Unlock()
+	services := make(map[string][]string)
+	for name, instances := range m.instances {
+		for _, i := range instances {
+			services[name] = append(services[name], i.Tags...)
+		}
+	}
+	return services, m.catalogIndex, m.err
+}
+
+func (m *mockAPI) Instances(ctx context.Context, service string, index uint64) ([]Instance, uint64, error) {
+	if err := m.wait(ctx, index, func() uint64 { return m.healthIndex }); err != nil {
+		return nil, 0, err
+	}
+	m.Lock()
+	defer m.Unlock()
+	return append([]Instance(nil), m.instances[service]...), m.healthIndex, nil
+}
+
+func (m *mockAPI) wait(ctx context.Context, index uint64, last func() uint64) error {
+	for {
+		m.Lock()
+		if index == 0 || last() != index {
+			m.Unlock()
+			return nil
+		}
+		if m.changed == nil {
+			m.changed = make(chan struct{})
+		}
+		changed := m.changed
+		m.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (m *mockAPI) set(instances ...Instance) {
+	m.Lock()
+	defer m.Unlock()
+	m.instances = make(map[string][]Instance)
+	for _, i := range instances {
+		m.instances[i.Service] = append(m.instances[i.Service], i)
+	}
+	m.catalogIndex++
+	m.notify()
+}
+
+// setStatus changes the health of an instance without changing the catalog
+func (m *mockAPI) setStatus(service, id, status string) {
+	m.Lock()
+	defer m.Unlock()
+	for i := range m.instances[service] {
+		if m.instances[service][i].ID == id {
+			m.instances[service][i].Status = status
+		}
+	}
+	m.notify()
+}
+
+func (m *mockAPI) notify() {
+	m.healthIndex++
+	if m.changed != nil {
+		close(m.changed)
+		m.changed = nil
+	}
+}
+
+func instance(service, id, node, status string, tags ...string) Instance {
+	return Instance{ID: id, Service: service, Tags: tags, Status: status, Node: Node{Name: node}}
+}
+
+func TestWatcher(t *testing.T) {
+	api := &mockAPI{}
+	api.set(
+		instance("web", "web-1", "n1", HealthPassing, "metrics"),
+		instance("web", "web-2", "n2", HealthPassing, "metrics"),
+		instance("db", "db-1", "n1", HealthPassing),
+	)
+
+	w, err := NewWatcher(logp.L(), api, Config{Tags: []string{"metrics"}, SyncPeriod: 10 * time.Millisecond})
+	require.NoError(t, err)
+	start, stop := polltest.Start(t, w)
+
+	ids := []string{polltest.NextEvent(t, start)["instance"].(*Instance).ID, polltest.NextEvent(t, start)["instance"].(*Instance).ID}
+	assert.ElementsMatch(t, []string{"web-1", "web-2"}, ids)
+	assert.Len(t, w.Instances(), 2)
+
+	// Health change and deregistration
+	api.set(instance("web", "web-1", "n1", HealthCritical, "metrics"))
+	stopped := []string{polltest.NextEvent(t, stop)["instance"].(*Instance).ID, polltest.NextEvent(t, stop)["instance"].(*Instance).ID}
+	assert.ElementsMatch(t, []string{"web-1", "web-2"}, stopped)
+	assert.Equal(t, HealthCritical, polltest.NextEvent(t, start)["instance"].(*Instance).Status)
+}
+
+func TestWatcherHealthChange(t *testing.T) {
+	api := &mockAPI{}
+	api.set(instance("web", "web-1", "n1", HealthPassing), instance("db", "db-1", "n1", HealthPassing))
+
+	w, err := NewWatcher(logp.L(), api, Config{SyncPeriod: 10 * time.Millisecond})
+	require.NoError(t, err)
+	start, stop := polltest.Start(t, w)
+	polltest.NextEvent(t, start)
+	polltest.NextEvent(t, start)
+
+	// The catalog does not change, only the health of the instance
+	api.setStatus("web", "web-1", HealthCritical)
+	assert.Equal(t, "web-1", polltest.NextEvent(t, stop)["instance"].(*Instance).ID)
+	e := polltest.NextEvent(t, start)["instance"].(*Instance)
+	assert.Equal(t, "web-1", e.ID)
+	assert.Equal(t, HealthCritical, e.Status)
+
+	// Deregistration of a whole service
+	api.set(instance("web", "web-1", "n1", HealthCritical))
+	assert.Equal(t, "db-1", polltest.NextEvent(t, stop)["instance"].(*Instance).ID)
+	assert.Equal(t, []string{"n1/web-1"}, keys(w.Instances()))
+}
+
+func TestWatcherNode(t *testing.T) {
+	api := &mockAPI{}
+	api.set(instance("web", "web-1", "n1", HealthPassing), instance("web", "web-2", "n2", HealthPassing), instance("db", "db-1", "n2", HealthPassing))
+
+	w, err := NewWatcher(logp.L(), api, Config{Node: "n2", Services: []string{"web"}})
+	require.NoError(t, err)
+	require.NoError(t, w.Start())
+	defer w.Stop()
+	assert.Equal(t, []string{"n2/web-2"}, keys(w.Instances()))
+}
+
+func TestWatcherStartError(t *testing.T) {
+	polltest.StartError(t, func(err error) (polltest.Watcher, error) {
+		return NewWatcher(logp.L(), &mockAPI{err: err}, Config{})
+	})
+
+	_, err := NewWatcher(logp.L(), &mockAPI{}, Config{WaitTime: -time.Second})
+	assert.Error(t, err)
+}
+
+func TestAggregatedStatus(t *testing.T) {
+	assert.Equal(t, HealthPassing, aggregatedStatus(nil))
+	assert.Equal(t, HealthWarning, aggregatedStatus([]string{HealthPassing, HealthWarning}))
+	assert.Equal(t, HealthCritical, aggregatedStatus([]string{HealthWarning, HealthMaintenance, HealthPassing}))
+}
+
+func TestClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.Header.Get(tokenHeader))
+		assert.Equal(t, "dc1", r.URL.Query().Get("dc"))
+		switch r.URL.Path {
+		case "/v1/catalog/services":
+			if r.URL.Query().Get("index") != "" {
+				assert.Equal(t, "42", r.URL.Query().Get("index"))
+				assert.Equal(t, "1m0s", r.URL.Query().Get("wait"))
+			}
+			w.Header().Set(indexHeader, "43")
+			_ = json.NewEncoder(w).Encode(map[string][]string{"web": {"metrics"}})
+		case "/v1/health/service/web":
+			if r.URL.Query().Get("index") != "" {
+				assert.Equal(t, "42", r.URL.Query().Get("index"))
+				assert.Equal(t, "1m0s", r.URL.Query().Get("wait"))
+			}
+			w.Header().Set(indexHeader, "44")
+			_, _ = w.Write([]byte(`[{
+				"Node": {"ID": "n1-id", "Node": "n1", "Address": "10.0.0.1", "Datacenter": "dc1"},
+				"Service": {"ID": "web-1", "Service": "web", "Tags": ["metrics"], "Port": 8080, "Meta": {"version": "2"}, "ModifyIndex": 40},
+				"Checks": [{"Status": "passing"}, {"Status": "warning"}]
+			}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	api, err := NewClient(Config{Address: server.URL, Datacenter: "dc1", Token: "secret", WaitTime: time.Minute})
+	require.NoError(t, err)
+
+	for _, index := range []uint64{0, 42} {
+		services, lastIndex, err := api.Services(context.Background(), index)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(43), lastIndex)
+		assert.Equal(t, map[string][]string{"web": {"metrics"}}, services)
+	}
+
+	instances, lastIndex, err := api.Instances(context.Background(), "web", 42)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(44), lastIndex)
+	assert.Equal(t, []Instance{{
+		ID:          "web-1",
+		Service:     "web",
+		Tags:        []string{"metrics"},
+		Address:     "10.0.0.1",
+		Port:        8080,
+		Meta:        map[string]string{"version": "2"},
+		Status:      HealthWarning,
+		ModifyIndex: 40,
+		Node:        Node{ID: "n1-id", Name: "n1", Address: "10.0.0.1", Datacenter: "dc1"},
+	}}, instances)
+
+	_, _, err = api.Instances(context.Background(), "unknown", 0)
+	assert.Error(t, err)
+}
+
+func TestGenerateMetadata(t *testing.T) {
+	i := instance("web", "web-1", "n1", HealthPassing, "metrics")
+	i.Address = "10.0.0.1"
+	i.Port = 8080
+	i.Meta = map[string]string{"version": "2"}
+	i.Node.Datacenter = "dc1"
+	assert.Equal(t, mapstr.M{
+		"consul": mapstr.M{
+			"datacenter": "dc1",
+			"service": mapstr.M{
+				"name":    "web",
+				"id":      "web-1",
+				"address": "10.0.0.1",
+				"port":    8080,
+				"health":  HealthPassing,
+				"tags":    []string{"metrics"},
+				"meta":    mapstr.M{"version": "2"},
+			},
+			"node": mapstr.M{"id": "", "name": "n1", "address": ""},
+		},
+	}, GenerateMetadata(&i))
+}
+
+func keys(instances map[string]*Instance) []string {
+	var res []string
+	for k := range instances {
+		res = append(res, k)
+	}
+	return res
+}
@@ -0,0 +1,156 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cri
+
+import (
+	"context"
+	"time"
+
+	v1 "k8s.io/cri-api/pkg/apis/runtime/v1"
+	"k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// runtimeAPI is a version of the CRI gRPC API served by a runtime
+type runtimeAPI interface {
+	// version returns the name and version of the runtime
+	version(ctx context.Context) (name, version string, err error)
+
+	// listContainers returns all the containers known by the runtime
+	listContainers(ctx context.Context) ([]Container, error)
+
+	// containerStatus returns the image of the status of a container, and its verbose info
+	containerStatus(ctx context.Context, id string) (image string, info map[string]string, err error)
+
+	// imageStatus returns the verbose info of an image
+	imageStatus(ctx context.Context, image string) (map[string]string, error)
+}
+
+// containerStates are the states of the ContainerState enum, the same in the v1 and v1alpha2 APIs
+var containerStates = map[int32]ContainerState{
+	0: ContainerCreated,
+	1: ContainerRunning,
+	2: ContainerExited,
+	3: ContainerUnknown,
+}
+
+// newContainer returns a Container from the fields of the CRI messages
+func newContainer(id, name, image string, state int32, createdAt int64, labels, annotations map[string]string) Container {
+	c := Container{
+		ID:          id,
+		Name:        name,
+		Image:       image,
+		State:       ContainerUnknown,
+		CreatedAt:   time.Unix(0, createdAt).UTC(),
+		Labels:      labels,
+		Annotations: annotations,
+	}
+	if s, ok := containerStates[state]; ok {
+		c.State = s
+	}
+	if c.Labels == nil {
+		c.Labels = map[string]string{}
+	}
+	if c.Annotations == nil {
+		c.Annotations = map[string]string{}
+	}
+	return c
+}
+
+// v1API is the runtime.v1 API
+type v1API struct {
+	runtime v1.RuntimeServiceClient
+	images  v1.ImageServiceClient
+}
+
+func (a *v1API) version(ctx context.Context) (string, string, error) {
+	resp, err := a.runtime.Version(ctx, &v1.VersionRequest{Version: "v1"})
+	if err != nil {
+		return "", "", err
+	}
+	return resp.RuntimeName, resp.RuntimeVersion, nil
+}
+
+func (a *v1API) listContainers(ctx context.Context) ([]Container, error) {
+	resp, err := a.runtime.ListContainers(ctx, &v1.ListContainersRequest{})
+	if err != nil {
+		return nil, err
+	}
+	containers := make([]Container, len(resp.Containers))
+	for i, c := range resp.Containers {
+		containers[i] = newContainer(c.Id, c.GetMetadata().GetName(), c.GetImage().GetImage(), int32(c.State), c.CreatedAt, c.Labels, c.Annotations)
+	}
+	return containers, nil
+}
+
+func (a *v1API) containerStatus(ctx context.Context, id string) (string, map[string]string, error) {
+	resp, err := a.runtime.ContainerStatus(ctx, &v1.ContainerStatusRequest{ContainerId: id, Verbose: true})
+	if err != nil {
+		return "", nil, err
+	}
+	return resp.GetStatus().GetImage().GetImage(), resp.Info, nil
+}
+
+func (a *v1API) imageStatus(ctx context.Context, image string) (map[string]string, error) {
+	resp, err := a.images.ImageStatus(ctx, &v1.ImageStatusRequest{Image: &v1.ImageSpec{Image: image}, Verbose: true})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Info, nil
+}
+
+// v1alpha2API is the runtime.v1alpha2 API, served by the runtimes that don't serve v1 yet
+type v1alpha2API struct {
+	runtime v1alpha2.RuntimeServiceClient
+	images  v1alpha2.ImageServiceClient
+}
+
+func (a *v1alpha2API) version(ctx context.Context) (string, string, error) {
+	resp, err := a.runtime.Version(ctx, &v1alpha2.VersionRequest{Version: "v1alpha2"})
+	if err != nil {
+		return "", "", err
+	}
+	return resp.RuntimeName, resp.RuntimeVersion, nil
+}
+
+func (a *v1alpha2API) listContainers(ctx context.Context) ([]Container, error) {
+	resp, err := a.runtime.ListContainers(ctx, &v1alpha2.ListContainersRequest{})
+	if err != nil {
+		return nil, err
+	}
+	containers := make([]Container, len(resp.Containers))
+	for i, c := range resp.Containers {
+		containers[i] = newContainer(c.Id, c.GetMetadata().GetName(), c.GetImage().GetImage(), int32(c.State), c.CreatedAt, c.Labels, c.Annotations)
+	}
+	return containers, nil
+}
+
+func (a *v1alpha2API) containerStatus(ctx context.Context, id string) (string, map[string]string, error) {
+	resp, err := a.runtime.ContainerStatus(ctx, &v1alpha2.ContainerStatusRequest{ContainerId: id, Verbose: true})
+	if err != nil {
+		return "", nil, err
+	}
+	return resp.GetStatus().GetImage().GetImage(), resp.Info, nil
+}
+
+func (a *v1alpha2API) imageStatus(ctx context.Context, image string) (map[string]string, error) {
+	resp, err := a.images.ImageStatus(ctx, &v1alpha2.ImageStatusRequest{Image: &v1alpha2.ImageSpec{Image: image}, Verbose: true})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Info, nil
+}
@@ -0,0 +1,224 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cri
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	v1 "k8s.io/cri-api/pkg/apis/runtime/v1"
+	"k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// errImageNotFound is returned by ImageStatus for images that are not known by the runtime, like
+// the removed images of running containers
+var errImageNotFound = errors.New("image not found")
+
+// Client is a RuntimeService connected to the CRI gRPC API of a runtime
+type Client struct {
+	conn           *grpc.ClientConn
+	endpoint       string
+	api            runtimeAPI
+	runtimeName    string
+	runtimeVersion string
+
+	// windows is set to fill the Windows info of the containers
+	windows     bool
+	windowsLock sync.Mutex
+	windowsInfo map[string]*WindowsInfo
+}
+
+// NewClient connects to the CRI of the first endpoint where a runtime answers. DefaultEndpoints,
+// or DefaultWindowsEndpoints in Windows hosts, are probed if no endpoint is given. Endpoints are
+// unix socket paths, with or without the unix:// scheme, or npipe:// named pipes in Windows.
+func NewClient(ctx context.Context, endpoints ...string) (*Client, error) {
+	if len(endpoints) == 0 {
+		endpoints = DefaultEndpoints
+		if runtime.GOOS == "windows" {
+			endpoints = DefaultWindowsEndpoints
+		}
+	}
+
+	var errs []string
+	for _, endpoint := range endpoints {
+		c, err := dial(ctx, endpoint)
+		if err == nil {
+			c.windows = runtime.GOOS == "windows"
+			return c, nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", endpoint, err))
+	}
+	return nil, fmt.Errorf("no CRI runtime found: %s", strings.Join(errs, "; "))
+}
+
+// dial connects to the CRI of an endpoint and checks the version of the API it serves
+func dial(ctx context.Context, endpoint string) (*Client, error) {
+	addr, dialer, err := parseEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := grpc.DialContext(ctx, "passthrough:///"+addr,
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(dialer),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{conn: conn, endpoint: endpoint, windowsInfo: make(map[string]*WindowsInfo)}
+	// v1alpha2 is used with the runtimes that don't serve v1 yet
+	for _, api := range []runtimeAPI{
+		&v1API{runtime: v1.NewRuntimeServiceClient(conn), images: v1.NewImageServiceClient(conn)},
+		&v1alpha2API{runtime: v1alpha2.NewRuntimeServiceClient(conn), images: v1alpha2.NewImageServiceClient(conn)},
+	} {
+		c.api = api
+		reqCtx, cancel := context.WithTimeout(ctx, criRequestTimeout)
+		c.runtimeName, c.runtimeVersion, err = api.version(reqCtx)
+		cancel()
+		if status.Code(err) != codes.Unimplemented {
+			break
+		}
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// parseEndpoint returns the address and the dialer of an endpoint
+func parseEndpoint(endpoint string) (string, func(context.Context, string) (net.Conn, error), error) {
+	switch {
+	case strings.HasPrefix(endpoint, "npipe://"):
+		return strings.TrimPrefix(endpoint, "npipe://"), dialPipe, nil
+	case strings.HasPrefix(endpoint, "unix://"):
+		endpoint = strings.TrimPrefix(endpoint, "unix://")
+	case strings.Contains(endpoint, "://"):
+		return "", nil, fmt.Errorf("unsupported CRI endpoint %s, expected unix:// or npipe://", endpoint)
+	}
+	return endpoint, func(ctx context.Context, addr string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", addr)
+	}, nil
+}
+
+// Endpoint returns the endpoint the client is connected to
+func (c *Client) Endpoint() string {
+	return c.endpoint
+}
+
+// Runtime returns the name and version of the runtime, like containerd and v1.7.2
+func (c *Client) Runtime() (name, version string) {
+	return c.runtimeName, c.runtimeVersion
+}
+
+// ListContainers returns all the containers known by the runtime. In Windows hosts, the Windows
+// info of the running containers is retrieved once from their verbose status.
+func (c *Client) ListContainers(ctx context.Context) ([]Container, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, criRequestTimeout)
+	defer cancel()
+	containers, err := c.api.listContainers(reqCtx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list CRI containers: %w", err)
+	}
+	if c.windows {
+		c.fillWindowsInfo(ctx, containers)
+	}
+	return containers, nil
+}
+
+// ContainerStatus returns the verbose info of a container, and the image of its status
+func (c *Client) ContainerStatus(ctx context.Context, id string) (image string, info map[string]string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, criRequestTimeout)
+	defer cancel()
+	image, info, err = c.api.containerStatus(ctx, id)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get status of CRI container %s: %w", id, err)
+	}
+	return image, info, nil
+}
+
+// ImageStatus returns the verbose info of an image
+func (c *Client) ImageStatus(ctx context.Context, image string) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, criRequestTimeout)
+	defer cancel()
+	info, err := c.api.imageStatus(ctx, image)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			err = errImageNotFound
+		}
+		return nil, fmt.Errorf("failed to get status of CRI image %s: %w", image, err)
+	}
+	return info, nil
+}
+
+// fillWindowsInfo sets the Windows info of the running containers, caching it by container ID
+func (c *Client) fillWindowsInfo(ctx context.Context, containers []Container) {
+	c.windowsLock.Lock()
+	defer c.windowsLock.Unlock()
+
+	known := make(map[string]*WindowsInfo, len(containers))
+	for i := range containers {
+		container := &containers[i]
+		if container.State != ContainerRunning {
+			continue
+		}
+		info, ok := c.windowsInfo[container.ID]
+		if !ok {
+			var err error
+			if info, err = c.windowsInfoOf(ctx, container.ID); err != nil {
+				// Retried in the next listing
+				continue
+			}
+		}
+		known[container.ID] = info
+		container.Windows = info
+	}
+	c.windowsInfo = known
+}
+
+func (c *Client) windowsInfoOf(ctx context.Context, id string) (*WindowsInfo, error) {
+	image, containerInfo, err := c.ContainerStatus(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	var imageInfo map[string]string
+	if image != "" {
+		if imageInfo, err = c.ImageStatus(ctx, image); err != nil && !errors.Is(err, errImageNotFound) {
+			return nil, err
+		}
+	}
+	return ParseWindowsInfo(containerInfo, imageInfo)
+}
+
+// Close the connection to the runtime
+func (c *Client) Close() error {
+	err := c.conn.Close()
+	if errors.Is(err, grpc.ErrClientConnClosing) {
+		return nil
+	}
+	return err
+}
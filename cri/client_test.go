@@ -0,0 +1,318 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cri
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	v1 "k8s.io/cri-api/pkg/apis/runtime/v1"
+	"k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func criContainer(id, name, image string, state v1.ContainerState, createdAt time.Time, labels map[string]string) *v1.Container {
+	return &v1.Container{
+		Id:           id,
+		PodSandboxId: "sandbox-" + id,
+		Metadata:     &v1.ContainerMetadata{Name: name},
+		Image:        &v1.ImageSpec{Image: image},
+		ImageRef:     "sha256:" + id,
+		State:        state,
+		CreatedAt:    createdAt.UnixNano(),
+		Labels:       labels,
+	}
+}
+
+func containerStatus(image string, info map[string]string) *v1.ContainerStatusResponse {
+	return &v1.ContainerStatusResponse{Status: &v1.ContainerStatus{Image: &v1.ImageSpec{Image: image}}, Info: info}
+}
+
+// fakeRuntime serves the CRI methods used by Client in a unix socket, with the v1 API or, if
+// alpha is set, the v1alpha2 one
+type fakeRuntime struct {
+	alpha      bool
+	containers []*v1.Container
+	statuses   map[string]*v1.ContainerStatusResponse
+	images     map[string]*v1.ImageStatusResponse
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func (f *fakeRuntime) served() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.requests...)
+}
+
+func (f *fakeRuntime) request(method string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, method)
+}
+
+func (f *fakeRuntime) version() *v1.VersionResponse {
+	f.request("Version")
+	return &v1.VersionResponse{Version: "0.1.0", RuntimeName: "containerd", RuntimeVersion: "v1.7.2", RuntimeApiVersion: "v1"}
+}
+
+func (f *fakeRuntime) listContainers() *v1.ListContainersResponse {
+	f.request("ListContainers")
+	return &v1.ListContainersResponse{Containers: f.containers}
+}
+
+func (f *fakeRuntime) containerStatus(id string) (*v1.ContainerStatusResponse, error) {
+	f.request("ContainerStatus")
+	s, ok := f.statuses[id]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "container not found")
+	}
+	return s, nil
+}
+
+func (f *fakeRuntime) imageStatus(image string) (*v1.ImageStatusResponse, error) {
+	f.request("ImageStatus")
+	s, ok := f.images[image]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "image not found")
+	}
+	return s, nil
+}
+
+func (f *fakeRuntime) serve(t *testing.T, socket string) {
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	server := grpc.NewServer()
+	if f.alpha {
+		v1alpha2.RegisterRuntimeServiceServer(server, &fakeV1alpha2Runtime{fake: f})
+		v1alpha2.RegisterImageServiceServer(server, &fakeV1alpha2Images{fake: f})
+	} else {
+		v1.RegisterRuntimeServiceServer(server, &fakeV1Runtime{fake: f})
+		v1.RegisterImageServiceServer(server, &fakeV1Images{fake: f})
+	}
+	go func() { _ = server.Serve(l) }()
+	t.Cleanup(server.Stop)
+}
+
+type fakeV1Runtime struct {
+	v1.UnimplementedRuntimeServiceServer
+	fake *fakeRuntime
+}
+
+func (s *fakeV1Runtime) Version(context.Context, *v1.VersionRequest) (*v1.VersionResponse, error) {
+	return s.fake.version(), nil
+}
+
+func (s *fakeV1Runtime) ListContainers(context.Context, *v1.ListContainersRequest) (*v1.ListContainersResponse, error) {
+	return s.fake.listContainers(), nil
+}
+
+func (s *fakeV1Runtime) ContainerStatus(_ context.Context, req *v1.ContainerStatusRequest) (*v1.ContainerStatusResponse, error) {
+	return s.fake.containerStatus(req.ContainerId)
+}
+
+type fakeV1Images struct {
+	v1.UnimplementedImageServiceServer
+	fake *fakeRuntime
+}
+
+func (s *fakeV1Images) ImageStatus(_ context.Context, req *v1.ImageStatusRequest) (*v1.ImageStatusResponse, error) {
+	return s.fake.imageStatus(req.GetImage().GetImage())
+}
+
+// toV1alpha2 converts a v1 message to the v1alpha2 one, their fields have the same numbers
+func toV1alpha2(from interface{ Marshal() ([]byte, error) }, to interface{ Unmarshal([]byte) error }) error {
+	b, err := from.Marshal()
+	if err != nil {
+		return err
+	}
+	return to.Unmarshal(b)
+}
+
+type fakeV1alpha2Runtime struct {
+	v1alpha2.UnimplementedRuntimeServiceServer
+	fake *fakeRuntime
+}
+
+func (s *fakeV1alpha2Runtime) Version(context.Context, *v1alpha2.VersionRequest) (*v1alpha2.VersionResponse, error) {
+	var resp v1alpha2.VersionResponse
+	return &resp, toV1alpha2(s.fake.version(), &resp)
+}
+
+func (s *fakeV1alpha2Runtime) ListContainers(context.Context, *v1alpha2.ListContainersRequest) (*v1alpha2.ListContainersResponse, error) {
+	var resp v1alpha2.ListContainersResponse
+	return &resp, toV1alpha2(s.fake.listContainers(), &resp)
+}
+
+func (s *fakeV1alpha2Runtime) ContainerStatus(_ context.Context, req *v1alpha2.ContainerStatusRequest) (*v1alpha2.ContainerStatusResponse, error) {
+	v1Resp, err := s.fake.containerStatus(req.ContainerId)
+	if err != nil {
+		return nil, err
+	}
+	var resp v1alpha2.ContainerStatusResponse
+	return &resp, toV1alpha2(v1Resp, &resp)
+}
+
+type fakeV1alpha2Images struct {
+	v1alpha2.UnimplementedImageServiceServer
+	fake *fakeRuntime
+}
+
+func (s *fakeV1alpha2Images) ImageStatus(_ context.Context, req *v1alpha2.ImageStatusRequest) (*v1alpha2.ImageStatusResponse, error) {
+	v1Resp, err := s.fake.imageStatus(req.GetImage().GetImage())
+	if err != nil {
+		return nil, err
+	}
+	var resp v1alpha2.ImageStatusResponse
+	return &resp, toV1alpha2(v1Resp, &resp)
+}
+
+func TestClient(t *testing.T) {
+	created := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	labels := map[string]string{podNameLabel: "web", podNamespaceLabel: "default", containerLabel: "nginx"}
+
+	list := []*v1.Container{
+		criContainer("a1", "nginx", "docker.io/library/nginx:latest", v1.ContainerState_CONTAINER_RUNNING, created, labels),
+		criContainer("b2", "job", "busybox", v1.ContainerState_CONTAINER_EXITED, created, nil),
+		criContainer("c3", "other", "busybox", 9, created, nil),
+	}
+
+	for name, alpha := range map[string]bool{"v1": false, "v1alpha2": true} {
+		t.Run(name, func(t *testing.T) {
+			runtime := &fakeRuntime{alpha: alpha, containers: list}
+			dir := t.TempDir()
+			socket := filepath.Join(dir, "containerd.sock")
+			runtime.serve(t, socket)
+
+			// The first endpoint where a runtime answers is used
+			ctx := context.Background()
+			c, err := NewClient(ctx, "unix://"+filepath.Join(dir, "missing.sock"), "unix://"+socket)
+			require.NoError(t, err)
+			defer c.Close()
+			assert.Equal(t, "unix://"+socket, c.Endpoint())
+			name, version := c.Runtime()
+			assert.Equal(t, "containerd", name)
+			assert.Equal(t, "v1.7.2", version)
+
+			containers, err := c.ListContainers(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []Container{
+				{
+					ID:          "a1",
+					Name:        "nginx",
+					Image:       "docker.io/library/nginx:latest",
+					State:       ContainerRunning,
+					CreatedAt:   created,
+					Labels:      labels,
+					Annotations: map[string]string{},
+				},
+				{ID: "b2", Name: "job", Image: "busybox", State: ContainerExited, CreatedAt: created, Labels: map[string]string{}, Annotations: map[string]string{}},
+				{ID: "c3", Name: "other", Image: "busybox", State: ContainerUnknown, CreatedAt: created, Labels: map[string]string{}, Annotations: map[string]string{}},
+			}, containers)
+		})
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	dir := t.TempDir()
+	_, err := NewClient(context.Background(), filepath.Join(dir, "missing.sock"), "tcp://localhost:1234", "npipe:////./pipe/missing")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no CRI runtime found")
+	assert.Contains(t, err.Error(), "unsupported CRI endpoint tcp://localhost:1234")
+}
+
+func TestClientWindowsInfo(t *testing.T) {
+	runtime := &fakeRuntime{
+		containers: []*v1.Container{
+			criContainer("a1", "iis", "mcr.microsoft.com/windows/servercore/iis", v1.ContainerState_CONTAINER_RUNNING, time.Now(), nil),
+			criContainer("b2", "exited", "busybox", v1.ContainerState_CONTAINER_EXITED, time.Now(), nil),
+		},
+		statuses: map[string]*v1.ContainerStatusResponse{
+			"a1": containerStatus("mcr.microsoft.com/windows/servercore/iis", map[string]string{
+				"info": `{"runtimeSpec":{"windows":{"hyperv":{}}}}`,
+			}),
+		},
+		images: map[string]*v1.ImageStatusResponse{
+			"mcr.microsoft.com/windows/servercore/iis": {Info: map[string]string{
+				"info": `{"imageSpec":{"os.version":"10.0.20348.1906"}}`,
+			}},
+		},
+	}
+	socket := filepath.Join(t.TempDir(), "containerd.sock")
+	runtime.serve(t, socket)
+
+	ctx := context.Background()
+	c, err := NewClient(ctx, socket)
+	require.NoError(t, err)
+	defer c.Close()
+	c.windows = true
+
+	expected := &WindowsInfo{Isolation: IsolationHyperV, OSVersion: "10.0.20348.1906", BaseImage: "ltsc2022"}
+	for i := 0; i < 2; i++ {
+		containers, err := c.ListContainers(ctx)
+		require.NoError(t, err)
+		require.Len(t, containers, 2)
+		assert.Equal(t, expected, containers[0].Windows)
+		assert.Nil(t, containers[1].Windows)
+	}
+
+	// The Windows info is retrieved once per container
+	assert.Equal(t, []string{"Version", "ListContainers", "ContainerStatus", "ImageStatus", "ListContainers"}, runtime.served())
+}
+
+func TestClientWindowsInfoImageNotFound(t *testing.T) {
+	runtime := &fakeRuntime{
+		containers: []*v1.Container{
+			criContainer("a1", "iis", "removed", v1.ContainerState_CONTAINER_RUNNING, time.Now(), nil),
+		},
+		statuses: map[string]*v1.ContainerStatusResponse{
+			"a1": containerStatus("removed", map[string]string{"info": `{"runtimeSpec":{"windows":{}}}`}),
+		},
+	}
+	socket := filepath.Join(t.TempDir(), "containerd.sock")
+	runtime.serve(t, socket)
+
+	ctx := context.Background()
+	c, err := NewClient(ctx, socket)
+	require.NoError(t, err)
+	defer c.Close()
+	c.windows = true
+
+	// The info of containers whose image was removed is cached without the OS version
+	for i := 0; i < 2; i++ {
+		containers, err := c.ListContainers(ctx)
+		require.NoError(t, err)
+		require.Len(t, containers, 1)
+		assert.Equal(t, &WindowsInfo{Isolation: IsolationProcess}, containers[0].Windows)
+	}
+	assert.Equal(t, []string{"Version", "ListContainers", "ContainerStatus", "ImageStatus", "ListContainers"}, runtime.served())
+
+	_, err = c.ImageStatus(ctx, "removed")
+	assert.True(t, errors.Is(err, errImageNotFound))
+}
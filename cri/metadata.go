@@ -0,0 +1,50 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cri
+
+import (
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// GenerateMetadata returns the ECS container fields of a container, with the isolation mode and
+// base image of Windows containers under `container.windows`
+func GenerateMetadata(c *Container) mapstr.M {
+	container := mapstr.M{
+		"id":      c.ID,
+		"name":    c.Name,
+		"runtime": "cri",
+	}
+	if c.Image != "" {
+		_, _ = container.Put("image.name", c.Image)
+	}
+	if w := c.Windows; w != nil {
+		windows := mapstr.M{
+			"isolation": w.Isolation,
+		}
+		if w.OSVersion != "" {
+			_, _ = windows.Put("os.version", w.OSVersion)
+		}
+		if w.BaseImage != "" {
+			windows["base_image"] = w.BaseImage
+		}
+		container["windows"] = windows
+	}
+	return mapstr.M{
+		"container": container,
+	}
+}
@@ -0,0 +1,250 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package cri discovers containers through the Container Runtime Interface (CRI) of runtimes like
+// containerd or CRI-O, for hosts where there is no Docker socket and the Kubernetes API should not
+// be used.
+//
+// The CRI API is served over gRPC, Client connects to it in the unix socket of the runtime,
+// probing DefaultEndpoints if none is configured, and implements the RuntimeService interface
+// used by the watcher. Consumers can also provide their own RuntimeService.
+//
+// Windows nodes are supported through the CRI of containerd, served in the named pipe of
+// DefaultWindowsEndpoints, Client fills the isolation mode and base image of the containers there,
+// other clients can do it with ParseWindowsInfo.
+package cri
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+	"github.com/elastic/elastic-agent-autodiscover/internal/poll"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+const (
+	criRequestTimeout = 10 * time.Second
+
+	// Labels set by the kubelet in the containers it creates
+	podNameLabel      = "io.kubernetes.pod.name"
+	podNamespaceLabel = "io.kubernetes.pod.namespace"
+	podUIDLabel       = "io.kubernetes.pod.uid"
+	containerLabel    = "io.kubernetes.container.name"
+)
+
+// DefaultEndpoints are the usual CRI endpoints of containerd, CRI-O and cri-dockerd, probed by
+// NewClient when no endpoint is configured
+var DefaultEndpoints = []string{
+	"unix:///run/containerd/containerd.sock",
+	"unix:///run/crio/crio.sock",
+	"unix:///var/run/cri-dockerd.sock",
+}
+
+// ContainerState is the state of a container as reported by the CRI
+type ContainerState string
+
+// Container states of the CRI
+const (
+	ContainerCreated ContainerState = "created"
+	ContainerRunning ContainerState = "running"
+	ContainerExited  ContainerState = "exited"
+	ContainerUnknown ContainerState = "unknown"
+)
+
+// Container info retrieved by the watcher
+type Container struct {
+	ID           string
+	Name         string
+	Image        string
+	State        ContainerState
+	CreatedAt    time.Time
+	PodName      string
+	PodNamespace string
+	PodUID       string
+	Labels       map[string]string
+	Annotations  map[string]string
+	// Windows info of the container, nil for containers not running in Windows hosts
+	Windows *WindowsInfo
+}
+
+// RuntimeService is the subset of the CRI runtime service used by the watcher
+type RuntimeService interface {
+	// ListContainers returns all the containers known by the runtime
+	ListContainers(ctx context.Context) ([]Container, error)
+}
+
+// Watcher polls the CRI runtime and keeps a list of known running containers
+type Watcher interface {
+	// Start watching the runtime for new containers
+	Start() error
+
+	// Stop watching the runtime for new containers
+	Stop()
+
+	// Container returns the running container with the given ID or nil if unknown
+	Container(ID string) *Container
+
+	// Containers returns the list of known running containers
+	Containers() map[string]*Container
+
+	// ListenStart returns a bus listener to receive the containers of the runtime that start
+	// running, with a `container` key holding them
+	ListenStart() bus.Listener
+
+	// ListenStop returns a bus listener to receive the containers of the runtime that stop
+	// running or are removed, with a `container` key holding their last known state
+	ListenStop() bus.Listener
+}
+
+type watcher struct {
+	sync.RWMutex
+	log        *logp.Logger
+	runtime    RuntimeService
+	period     time.Duration
+	ctx        context.Context
+	stop       context.CancelFunc
+	containers map[string]*Container
+	stopped    sync.WaitGroup
+	bus        bus.Bus
+}
+
+// NewWatcher creates a new Watcher polling the runtime every period
+func NewWatcher(log *logp.Logger, runtime RuntimeService, period time.Duration) (Watcher, error) {
+	if period <= 0 {
+		return nil, fmt.Errorf("invalid CRI poll period %v", period)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &watcher{
+		log:        log,
+		runtime:    runtime,
+		period:     period,
+		ctx:        ctx,
+		stop:       cancel,
+		containers: make(map[string]*Container),
+		bus:        bus.New(log, "cri"),
+	}, nil
+}
+
+// Container returns the running container with the given ID or nil if unknown
+func (w *watcher) Container(ID string) *Container {
+	w.RLock()
+	defer w.RUnlock()
+	return w.containers[ID]
+}
+
+// Containers returns the list of known running containers
+func (w *watcher) Containers() map[string]*Container {
+	w.RLock()
+	defer w.RUnlock()
+	res := make(map[string]*Container, len(w.containers))
+	for k, v := range w.containers {
+		res[k] = v
+	}
+	return res
+}
+
+// Start watching the runtime for new containers, the first listing is done synchronously so
+// errors connecting to the runtime are returned
+func (w *watcher) Start() error {
+	w.log.Debug("Start CRI containers scanner")
+	if err := w.sync(); err != nil {
+		return err
+	}
+
+	w.stopped.Add(1)
+	go w.watch()
+	return nil
+}
+
+// Stop watching the runtime
+func (w *watcher) Stop() {
+	w.stop()
+	w.stopped.Wait()
+}
+
+func (w *watcher) watch() {
+	defer w.stopped.Done()
+
+	poll.Loop(w.ctx, w.log, poll.Config{
+		Period:      w.period,
+		Description: "listing CRI containers",
+	}, w.sync)
+	w.log.Debug("Watcher stopped")
+}
+
+// sync lists the containers of the runtime and publishes the events of the containers that
+// started or stopped since the previous listing
+func (w *watcher) sync() error {
+	ctx, cancel := context.WithTimeout(w.ctx, criRequestTimeout)
+	defer cancel()
+
+	list, err := w.runtime.ListContainers(ctx)
+	if err != nil {
+		return err
+	}
+
+	running := make(map[string]*Container, len(list))
+	for i := range list {
+		if list[i].State != ContainerRunning {
+			continue
+		}
+		c := normalize(list[i])
+		running[c.ID] = c
+	}
+
+	w.Lock()
+	started, stopped := poll.Diff(w.containers, running, nil)
+	w.containers = running
+	w.Unlock()
+
+	poll.Publish(w.bus, "container", started, stopped)
+	return nil
+}
+
+// normalize fills the pod fields of a container from the labels set by the kubelet
+func normalize(c Container) *Container {
+	if c.Labels == nil {
+		c.Labels = map[string]string{}
+	}
+	if c.Annotations == nil {
+		c.Annotations = map[string]string{}
+	}
+	if c.PodName == "" {
+		c.PodName = c.Labels[podNameLabel]
+	}
+	if c.PodNamespace == "" {
+		c.PodNamespace = c.Labels[podNamespaceLabel]
+	}
+	if c.PodUID == "" {
+		c.PodUID = c.Labels[podUIDLabel]
+	}
+	if c.Name == "" {
+		c.Name = c.Labels[containerLabel]
+	}
+	return &c
+}
+
+func (w *watcher) ListenStart() bus.Listener {
+	return w.bus.Subscribe("start")
+}
+
+func (w *watcher) ListenStop() bus.Listener {
+	return w.bus.Subscribe("stop")
+}
@@ -0,0 +1,145 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cri
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-autodiscover/internal/polltest"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type mockRuntime struct {
+	polltest.Source[Container]
+}
+
+func (m *mockRuntime) ListContainers(ctx context.Context) ([]Container, error) {
+	containers, _, err := m.List()
+	return containers, err
+}
+
+func TestWatcher(t *testing.T) {
+	require.NoError(t, logp.TestingSetup())
+
+	runtime := &mockRuntime{}
+	runtime.Set(
+		Container{
+			ID:          "a1",
+			Image:       "nginx",
+			State:       ContainerRunning,
+			Labels:      map[string]string{podNameLabel: "web", podNamespaceLabel: "default", podUIDLabel: "uid", containerLabel: "nginx"},
+			Annotations: map[string]string{"io.kubernetes.container.restartCount": "0"},
+		},
+		Container{ID: "b2", Name: "exited", State: ContainerExited},
+	)
+
+	w, err := NewWatcher(logp.L(), runtime, 10*time.Millisecond)
+	require.NoError(t, err)
+	start, stop := polltest.Start(t, w)
+
+	event := polltest.NextEvent(t, start)
+	assert.Equal(t, &Container{
+		ID:           "a1",
+		Name:         "nginx",
+		Image:        "nginx",
+		State:        ContainerRunning,
+		PodName:      "web",
+		PodNamespace: "default",
+		PodUID:       "uid",
+		Labels:       map[string]string{podNameLabel: "web", podNamespaceLabel: "default", podUIDLabel: "uid", containerLabel: "nginx"},
+		Annotations:  map[string]string{"io.kubernetes.container.restartCount": "0"},
+	}, event["container"])
+	assert.Len(t, w.Containers(), 1)
+	assert.Nil(t, w.Container("b2"))
+
+	runtime.Set(Container{ID: "c3", Name: "redis", State: ContainerRunning})
+	event = polltest.NextEvent(t, start)
+	assert.Equal(t, "c3", event["container"].(*Container).ID)
+	event = polltest.NextEvent(t, stop)
+	assert.Equal(t, "a1", event["container"].(*Container).ID)
+	assert.NotNil(t, w.Container("c3"))
+}
+
+func TestWatcherStartError(t *testing.T) {
+	polltest.StartError(t, func(err error) (polltest.Watcher, error) {
+		runtime := &mockRuntime{}
+		runtime.Fail(err)
+		return NewWatcher(logp.NewLogger("cri"), runtime, time.Second)
+	})
+
+	_, err := NewWatcher(logp.NewLogger("cri"), &mockRuntime{}, 0)
+	assert.Error(t, err)
+}
+
+func TestParseWindowsInfo(t *testing.T) {
+	image := map[string]string{"info": `{"chainID":"sha256:abc","imageSpec":{"os":"windows","os.version":"10.0.20348.1906"}}`}
+
+	info, err := ParseWindowsInfo(map[string]string{"info": `{"pid":1234,"runtimeSpec":{"windows":{"layerFolders":["C:\\layer"]}}}`}, image)
+	require.NoError(t, err)
+	assert.Equal(t, &WindowsInfo{Isolation: IsolationProcess, OSVersion: "10.0.20348.1906", BaseImage: "ltsc2022"}, info)
+
+	info, err = ParseWindowsInfo(map[string]string{"info": `{"runtimeSpec":{"windows":{"hyperv":{}}}}`}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, &WindowsInfo{Isolation: IsolationHyperV}, info)
+
+	info, err = ParseWindowsInfo(map[string]string{"info": `{"runtimeSpec":{"annotations":{"microsoft.com/hostprocess-container":"true"},"windows":{}}}`}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, IsolationHostProcess, info.Isolation)
+
+	// Linux containers
+	info, err = ParseWindowsInfo(map[string]string{"info": `{"runtimeSpec":{"linux":{}}}`}, image)
+	require.NoError(t, err)
+	assert.Nil(t, info)
+
+	_, err = ParseWindowsInfo(map[string]string{"info": `{`}, nil)
+	assert.Error(t, err)
+}
+
+func TestWindowsBaseImage(t *testing.T) {
+	assert.Equal(t, "ltsc2019", WindowsBaseImage("10.0.17763.4974"))
+	assert.Equal(t, "ltsc2022", WindowsBaseImage("10.0.20348"))
+	assert.Equal(t, "", WindowsBaseImage("10.0.99999.1"))
+	assert.Equal(t, "", WindowsBaseImage(""))
+}
+
+func TestGenerateMetadata(t *testing.T) {
+	c := &Container{ID: "a1", Name: "iis", Image: "mcr.microsoft.com/windows/servercore/iis"}
+	assert.Equal(t, mapstr.M{
+		"container": mapstr.M{
+			"id":      "a1",
+			"name":    "iis",
+			"runtime": "cri",
+			"image":   mapstr.M{"name": "mcr.microsoft.com/windows/servercore/iis"},
+		},
+	}, GenerateMetadata(c))
+
+	c.Windows = &WindowsInfo{Isolation: IsolationHyperV, OSVersion: "10.0.17763.4974", BaseImage: "ltsc2019"}
+	windows, err := GenerateMetadata(c).GetValue("container.windows")
+	require.NoError(t, err)
+	assert.Equal(t, mapstr.M{
+		"isolation":  "hyperv",
+		"os":         mapstr.M{"version": "10.0.17763.4974"},
+		"base_image": "ltsc2019",
+	}, windows)
+}
@@ -0,0 +1,119 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cri
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Isolation modes of Windows containers
+const (
+	// IsolationProcess containers share the kernel of the host
+	IsolationProcess = "process"
+	// IsolationHyperV containers run in a utility VM
+	IsolationHyperV = "hyperv"
+	// IsolationHostProcess containers run as processes of the host, like HostProcess pods
+	IsolationHostProcess = "hostprocess"
+
+	hostProcessAnnotation = "microsoft.com/hostprocess-container"
+)
+
+// DefaultWindowsEndpoints are the usual CRI endpoints in Windows hosts, the named pipe of
+// containerd, probed by NewClient in Windows when no endpoint is configured
+var DefaultWindowsEndpoints = []string{
+	"npipe:////./pipe/containerd-containerd",
+}
+
+// windowsBaseImages are the Windows releases of the build numbers of the base images
+var windowsBaseImages = map[string]string{
+	"14393": "ltsc2016",
+	"17763": "ltsc2019",
+	"18362": "1903",
+	"18363": "1909",
+	"19041": "2004",
+	"19042": "20H2",
+	"20348": "ltsc2022",
+	"25398": "23H2",
+	"26100": "ltsc2025",
+}
+
+// WindowsInfo of containers running in Windows hosts
+type WindowsInfo struct {
+	// Isolation mode of the container, IsolationProcess, IsolationHyperV or IsolationHostProcess
+	Isolation string
+	// OSVersion of the image, like 10.0.20348.1906
+	OSVersion string
+	// BaseImage is the Windows release of the image, like ltsc2022, derived from its OSVersion
+	BaseImage string
+}
+
+// ParseWindowsInfo parses the Windows info of a container from the verbose info returned by the
+// ContainerStatus call of containerd, and the OS version of its image from the verbose info of
+// the ImageStatus call, so RuntimeService implementations can fill Container.Windows. Nil is
+// returned for containers without a Windows runtime spec.
+func ParseWindowsInfo(containerInfo, imageInfo map[string]string) (*WindowsInfo, error) {
+	var container struct {
+		RuntimeSpec struct {
+			Annotations map[string]string `json:"annotations"`
+			Windows     *struct {
+				HyperV *json.RawMessage `json:"hyperv"`
+			} `json:"windows"`
+		} `json:"runtimeSpec"`
+	}
+	if err := json.Unmarshal([]byte(containerInfo["info"]), &container); err != nil {
+		return nil, fmt.Errorf("failed to parse container info: %w", err)
+	}
+	spec := container.RuntimeSpec
+	if spec.Windows == nil {
+		return nil, nil
+	}
+
+	info := &WindowsInfo{Isolation: IsolationProcess}
+	switch {
+	case spec.Annotations[hostProcessAnnotation] == "true":
+		info.Isolation = IsolationHostProcess
+	case spec.Windows.HyperV != nil:
+		info.Isolation = IsolationHyperV
+	}
+
+	if imageInfo["info"] != "" {
+		var image struct {
+			ImageSpec struct {
+				OSVersion string `json:"os.version"`
+			} `json:"imageSpec"`
+		}
+		if err := json.Unmarshal([]byte(imageInfo["info"]), &image); err != nil {
+			return nil, fmt.Errorf("failed to parse image info: %w", err)
+		}
+		info.OSVersion = image.ImageSpec.OSVersion
+		info.BaseImage = WindowsBaseImage(info.OSVersion)
+	}
+	return info, nil
+}
+
+// WindowsBaseImage returns the Windows release of an OS version like 10.0.17763.1234, or an
+// empty string for unknown builds
+func WindowsBaseImage(osVersion string) string {
+	parts := strings.Split(osVersion, ".")
+	if len(parts) < 3 {
+		return ""
+	}
+	return windowsBaseImages[parts[2]]
+}
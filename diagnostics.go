@@ -0,0 +1,236 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package autodiscover reports the diagnostics of the autodiscover providers of this module, to
+// include them in the diagnostics bundles of Elastic Agent.
+package autodiscover
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+// redacted replaces the values of the sensitive settings in reports
+const redacted = "[redacted]"
+
+// sensitiveKeys are the parts of the names of the settings redacted from reports
+var sensitiveKeys = []string{"password", "passphrase", "token", "secret", "api_key", "credentials"}
+
+// Report is a self-diagnostics report
+type Report struct {
+	Time     time.Time                `json:"time"`
+	Watchers map[string]WatcherReport `json:"watchers,omitempty"`
+	Buses    map[string]BusReport     `json:"buses,omitempty"`
+	Config   map[string]interface{}   `json:"config,omitempty"`
+}
+
+// WatcherReport is the state of a kubernetes watcher
+type WatcherReport struct {
+	Synced bool `json:"synced"`
+	// SyncAge is the time since the store of the watcher was synced
+	SyncAge string `json:"sync_age,omitempty"`
+	// RBACFailures are the recent requests of the watcher forbidden by RBAC
+	RBACFailures []kubernetes.WatcherError `json:"rbac_failures,omitempty"`
+	// Errors are the other recent errors of the watcher
+	Errors []kubernetes.WatcherError `json:"errors,omitempty"`
+}
+
+// BusReport are the events dropped and filtered by a bus
+type BusReport struct {
+	// Dropped is the number of events lost by the listeners, per topic
+	Dropped map[string]int64 `json:"dropped"`
+	// Filtered is the number of events no listener was interested in, per topic
+	Filtered map[string]int64 `json:"filtered"`
+}
+
+// DiagnosticsSources are the watchers, buses and configurations included in the reports
+type DiagnosticsSources struct {
+	sync.RWMutex
+	watchers map[string]kubernetes.Watcher
+	buses    map[string]*bus.Metrics
+	configs  map[string]interface{}
+}
+
+// DefaultDiagnostics are the sources of the reports of Diagnostics
+var DefaultDiagnostics = NewDiagnosticsSources()
+
+// Diagnostics returns the report of the default diagnostics sources
+func Diagnostics() Report {
+	return DefaultDiagnostics.Report()
+}
+
+// NewDiagnosticsSources creates empty diagnostics sources
+func NewDiagnosticsSources() *DiagnosticsSources {
+	return &DiagnosticsSources{
+		watchers: make(map[string]kubernetes.Watcher),
+		buses:    make(map[string]*bus.Metrics),
+		configs:  make(map[string]interface{}),
+	}
+}
+
+// AddWatcher adds a kubernetes watcher to the reports
+func (s *DiagnosticsSources) AddWatcher(name string, w kubernetes.Watcher) {
+	s.Lock()
+	defer s.Unlock()
+	s.watchers[name] = w
+}
+
+// RemoveWatcher removes a kubernetes watcher from the reports, e.g. once it is stopped
+func (s *DiagnosticsSources) RemoveWatcher(name string) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.watchers, name)
+}
+
+// AddBus adds the metrics of a bus to the reports
+func (s *DiagnosticsSources) AddBus(name string, metrics *bus.Metrics) {
+	s.Lock()
+	defer s.Unlock()
+	s.buses[name] = metrics
+}
+
+// RemoveBus removes the metrics of a bus from the reports
+func (s *DiagnosticsSources) RemoveBus(name string) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.buses, name)
+}
+
+// AddConfig adds a configuration in effect to the reports, a *config.C or any value that can be
+// encoded as JSON. Passwords, tokens and other secrets are redacted.
+func (s *DiagnosticsSources) AddConfig(name string, cfg interface{}) {
+	s.Lock()
+	defer s.Unlock()
+	s.configs[name] = cfg
+}
+
+// RemoveConfig removes a configuration from the reports
+func (s *DiagnosticsSources) RemoveConfig(name string) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.configs, name)
+}
+
+// Report returns a report of the current state of the sources
+func (s *DiagnosticsSources) Report() Report {
+	s.RLock()
+	defer s.RUnlock()
+
+	now := time.Now()
+	report := Report{Time: now}
+	if len(s.watchers) > 0 {
+		report.Watchers = make(map[string]WatcherReport, len(s.watchers))
+		for name, w := range s.watchers {
+			report.Watchers[name] = watcherReport(w, now)
+		}
+	}
+	if len(s.buses) > 0 {
+		report.Buses = make(map[string]BusReport, len(s.buses))
+		for name, metrics := range s.buses {
+			busReport := BusReport{Dropped: make(map[string]int64), Filtered: make(map[string]int64)}
+			for topic, stats := range metrics.Stats().Topics {
+				if stats.Dropped > 0 {
+					busReport.Dropped[topic] = stats.Dropped
+				}
+				if stats.Filtered > 0 {
+					busReport.Filtered[topic] = stats.Filtered
+				}
+			}
+			report.Buses[name] = busReport
+		}
+	}
+	if len(s.configs) > 0 {
+		report.Config = make(map[string]interface{}, len(s.configs))
+		for name, cfg := range s.configs {
+			report.Config[name] = reportConfig(cfg)
+		}
+	}
+	return report
+}
+
+func watcherReport(w kubernetes.Watcher, now time.Time) WatcherReport {
+	state := kubernetes.InspectWatcher(w)
+	report := WatcherReport{Synced: state.Synced}
+	if !state.SyncedAt.IsZero() {
+		report.SyncAge = now.Sub(state.SyncedAt).Round(time.Second).String()
+	}
+	for _, err := range state.Errors {
+		if err.Forbidden {
+			report.RBACFailures = append(report.RBACFailures, err)
+		} else {
+			report.Errors = append(report.Errors, err)
+		}
+	}
+	return report
+}
+
+// reportConfig returns the settings of a configuration as generic values, with the sensitive
+// settings redacted
+func reportConfig(cfg interface{}) interface{} {
+	var settings interface{}
+	switch cfg := cfg.(type) {
+	case *config.C:
+		var m map[string]interface{}
+		if err := cfg.Unpack(&m); err != nil {
+			return "unable to unpack config: " + err.Error()
+		}
+		settings = m
+	default:
+		data, err := json.Marshal(cfg)
+		if err != nil {
+			return "unable to encode config: " + err.Error()
+		}
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return "unable to decode config: " + err.Error()
+		}
+	}
+	return redact(settings)
+}
+
+func redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, value := range v {
+			if isSensitive(k) {
+				v[k] = redacted
+			} else {
+				v[k] = redact(value)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redact(v[i])
+		}
+	}
+	return v
+}
+
+func isSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
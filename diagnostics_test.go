@@ -0,0 +1,100 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package autodiscover
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+func TestDiagnostics(t *testing.T) {
+	client := k8sfake.NewSimpleClientset(&kubernetes.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}})
+	watcher, err := kubernetes.NewWatcher(client, &kubernetes.Pod{}, kubernetes.WatchOptions{}, nil)
+	require.NoError(t, err)
+	require.NoError(t, watcher.Start())
+	defer watcher.Stop()
+
+	metrics := bus.NewMetrics()
+	b := bus.NewWithOptions(logp.L(), "diagnostics", bus.Options{Topics: []string{"start"}, QueueSize: 1, Overflow: bus.OverflowDropNewest, Metrics: metrics})
+	b.Publish(bus.Event{"start": true})
+	listener := b.Subscribe()
+	defer listener.Stop()
+	b.Publish(bus.Event{"start": true})
+	b.Publish(bus.Event{"start": true})
+
+	cfg, err := config.NewConfigFrom(map[string]interface{}{
+		"node":   "node-1",
+		"secret": map[string]interface{}{"token": "abc"},
+		"hosts":  []interface{}{map[string]interface{}{"url": "https://api", "password": "pass"}},
+	})
+	require.NoError(t, err)
+
+	sources := NewDiagnosticsSources()
+	sources.AddWatcher("pod", watcher)
+	sources.AddBus("diagnostics", metrics)
+	sources.AddConfig("kubernetes", cfg)
+	sources.AddConfig("docker", struct {
+		Host     string `json:"host"`
+		APIToken string `json:"api_token"`
+	}{Host: "unix:///var/run/docker.sock", APIToken: "abc"})
+	sources.AddConfig("removed", "value")
+	sources.RemoveConfig("removed")
+
+	report := sources.Report()
+	require.Contains(t, report.Watchers, "pod")
+	assert.True(t, report.Watchers["pod"].Synced)
+	assert.NotEmpty(t, report.Watchers["pod"].SyncAge)
+	assert.Empty(t, report.Watchers["pod"].RBACFailures)
+	assert.Equal(t, map[string]BusReport{"diagnostics": {
+		Dropped:  map[string]int64{"start": 1},
+		Filtered: map[string]int64{"start": 1},
+	}}, report.Buses)
+	assert.Equal(t, map[string]interface{}{
+		"kubernetes": map[string]interface{}{
+			"node":   "node-1",
+			"secret": redacted,
+			"hosts":  []interface{}{map[string]interface{}{"url": "https://api", "password": redacted}},
+		},
+		"docker": map[string]interface{}{"host": "unix:///var/run/docker.sock", "api_token": redacted},
+	}, report.Config)
+
+	_, err = json.Marshal(report)
+	assert.NoError(t, err)
+
+	sources.RemoveWatcher("pod")
+	sources.RemoveBus("diagnostics")
+	assert.Empty(t, sources.Report().Watchers)
+	assert.Empty(t, sources.Report().Buses)
+}
+
+func TestDefaultDiagnostics(t *testing.T) {
+	DefaultDiagnostics.AddConfig("test", map[string]interface{}{"enabled": true})
+	defer DefaultDiagnostics.RemoveConfig("test")
+
+	assert.Equal(t, map[string]interface{}{"enabled": true}, Diagnostics().Config["test"])
+}
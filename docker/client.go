@@ -33,8 +33,12 @@ import (
 // client will negotiate the API version with the server unless
 // DOCKER_API_VERSION is set in the environment.
 func NewClient(host string, httpClient *http.Client, httpHeaders map[string]string) (*client.Client, error) {
-	log := logp.NewLogger("docker")
+	return NewClientWithLogger(logp.NewLogger("docker"), host, httpClient, httpHeaders)
+}
 
+// NewClientWithLogger is like NewClient, logging with the given logger, e.g. the docker logger
+// of utils.Loggers
+func NewClientWithLogger(log *logp.Logger, host string, httpClient *http.Client, httpHeaders map[string]string) (*client.Client, error) {
 	opts := []client.Opt{
 		client.WithHost(host),
 		client.WithHTTPClient(httpClient),
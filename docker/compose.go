@@ -0,0 +1,57 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"strconv"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// Labels set by Docker Compose in the containers it creates
+const (
+	composeProjectLabel         = "com.docker.compose.project"
+	composeServiceLabel         = "com.docker.compose.service"
+	composeContainerNumberLabel = "com.docker.compose.container-number"
+	composeOneoffLabel          = "com.docker.compose.oneoff"
+	composeWorkingDirLabel      = "com.docker.compose.project.working_dir"
+)
+
+// ComposeMetadata returns the Docker Compose project, service and container number of a container
+// parsed from its `com.docker.compose.*` labels, to be stored under `docker.compose`. It returns nil
+// for containers not created by Compose.
+func ComposeMetadata(labels map[string]string) mapstr.M {
+	project, ok := labels[composeProjectLabel]
+	if !ok || project == "" {
+		return nil
+	}
+
+	meta := mapstr.M{"project": project}
+	putIfNotEmpty(meta, "service", labels[composeServiceLabel])
+	putIfNotEmpty(meta, "working_dir", labels[composeWorkingDirLabel])
+	if number, err := strconv.Atoi(labels[composeContainerNumberLabel]); err == nil {
+		meta["container_number"] = number
+	}
+	if oneoff, err := strconv.ParseBool(labels[composeOneoffLabel]); err == nil {
+		meta["oneoff"] = oneoff
+	}
+	return meta
+}
@@ -0,0 +1,55 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestComposeMetadata(t *testing.T) {
+	assert.Nil(t, ComposeMetadata(map[string]string{"foo": "bar"}))
+	assert.Nil(t, ComposeMetadata(nil))
+
+	assert.Equal(t, mapstr.M{
+		"project":          "shop",
+		"service":          "web",
+		"working_dir":      "/srv/shop",
+		"container_number": 2,
+		"oneoff":           false,
+	}, ComposeMetadata(map[string]string{
+		"com.docker.compose.project":             "shop",
+		"com.docker.compose.service":             "web",
+		"com.docker.compose.container-number":    "2",
+		"com.docker.compose.oneoff":              "False",
+		"com.docker.compose.project.working_dir": "/srv/shop",
+		"com.docker.compose.config-hash":         "5a1c",
+	}))
+
+	// Invalid numbers are ignored
+	assert.Equal(t, mapstr.M{"project": "shop"}, ComposeMetadata(map[string]string{
+		"com.docker.compose.project":          "shop",
+		"com.docker.compose.container-number": "x",
+	}))
+}
@@ -0,0 +1,57 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"time"
+)
+
+// DropReason is the reason why docker events may have been lost
+type DropReason string
+
+const (
+	// DropDisconnected is the reason of the events missed while the events stream was
+	// disconnected by an error, the running containers are reconciled after reconnecting, but containers
+	// started and stopped meanwhile are not discovered
+	DropDisconnected DropReason = "disconnected"
+	// DropReconcileFailed is the reason of the events missed while disconnected that could not be
+	// recovered because the containers could not be listed
+	DropReconcileFailed DropReason = "reconcile_failed"
+)
+
+// DroppedEvent describes the docker events that may have been lost
+type DroppedEvent struct {
+	Reason DropReason
+	// Since is the time of the last event received before the events were lost
+	Since time.Time
+	// Err is the error that caused the loss, if any
+	Err error
+}
+
+// DropHandler is called when docker events may have been lost, it must not block
+type DropHandler func(DroppedEvent)
+
+// dropped reports possibly lost events
+func (w *watcher) dropped(e DroppedEvent) {
+	if w.onDrop != nil {
+		w.onDrop(e)
+	}
+}
@@ -0,0 +1,131 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+func TestWatcherDrops(t *testing.T) {
+	require.NoError(t, logp.TestingSetup())
+
+	client := &MockClient{
+		containers: [][]types.Container{
+			{
+				{ID: "0332dbd79e20", Names: []string{"/web"}, Image: "nginx", NetworkSettings: &types.SummaryNetworkSettings{}},
+			},
+			{
+				{ID: "0332dbd79e20", Names: []string{"/web"}, Image: "nginx", NetworkSettings: &types.SummaryNetworkSettings{}},
+			},
+			// Reconciling list after reconnecting
+			{
+				{ID: "0332dbd79e20", Names: []string{"/web"}, Image: "nginx", NetworkSettings: &types.SummaryNetworkSettings{}},
+			},
+		},
+		events: []interface{}{
+			events.Message{Action: "start", Actor: events.Actor{ID: "0332dbd79e20"}, TimeNano: time.Unix(100, 0).UnixNano()},
+			errors.New("connection reset by peer"),
+		},
+		done: make(chan interface{}),
+	}
+
+	var mutex sync.Mutex
+	var dropped []DroppedEvent
+	w, err := NewWatcherWithClientOptions(logp.L(), client, WatcherOptions{OnDrop: func(e DroppedEvent) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		dropped = append(dropped, e)
+	}})
+	require.NoError(t, err)
+	watcher := w.(*watcher)
+	watcher.minBackoff = time.Millisecond
+
+	require.NoError(t, watcher.Start())
+	defer watcher.Stop()
+	<-client.done
+
+	assert.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(dropped) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, DropDisconnected, dropped[0].Reason)
+	assert.Equal(t, time.Unix(100, 0), dropped[0].Since)
+	assert.EqualError(t, dropped[0].Err, "connection reset by peer")
+}
+
+func TestWatcherReconnectsWithoutBackoff(t *testing.T) {
+	require.NoError(t, logp.TestingSetup())
+
+	client := &MockClient{
+		containers: [][]types.Container{
+			{},
+			{
+				{ID: "0332dbd79e20", Names: []string{"/web"}, Image: "nginx", NetworkSettings: &types.SummaryNetworkSettings{}},
+			},
+		},
+		events: []interface{}{
+			events.Message{Action: "start", Actor: events.Actor{ID: "0332dbd79e20"}, TimeNano: time.Unix(100, 0).UnixNano()},
+			io.EOF,
+		},
+		done: make(chan interface{}),
+	}
+
+	var mutex sync.Mutex
+	var dropped []DroppedEvent
+	metrics := NewMetrics()
+	w, err := NewWatcherWithClientOptions(logp.L(), client, WatcherOptions{Metrics: metrics, OnDrop: func(e DroppedEvent) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		dropped = append(dropped, e)
+	}})
+	require.NoError(t, err)
+	watcher := w.(*watcher)
+	watcher.minBackoff = time.Hour
+
+	require.NoError(t, watcher.Start())
+	<-client.done
+
+	// Benign disconnections are resumed immediately, without reporting drops nor reconciling
+	assert.Eventually(t, func() bool {
+		return client.eventsCalls() == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	watcher.Stop()
+
+	assert.Empty(t, dropped)
+	assert.Zero(t, metrics.Stats().Reconnects)
+	assert.Len(t, client.listOptions, 2, "initial and start event listings only")
+	assert.Equal(t, time.Unix(100, 0).Format(time.RFC3339Nano), client.eventsOptions[1].Since)
+}
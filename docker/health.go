@@ -0,0 +1,107 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"context"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+)
+
+const healthStatusAction = "health_status"
+
+// Health status of the healthcheck of a container
+const (
+	HealthStarting  = "starting"
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+)
+
+// ContainerHealth is the state of the healthcheck of a container
+type ContainerHealth struct {
+	// Status is one of starting, healthy or unhealthy
+	Status string
+	// FailingStreak is the number of consecutive failed checks
+	FailingStreak int
+}
+
+// healthFromStatus parses the health of a container from the status reported when listing
+// containers, e.g. "Up 2 minutes (healthy)". Containers without healthcheck have no health.
+func healthFromStatus(status string) *ContainerHealth {
+	switch {
+	case strings.HasSuffix(status, "(health: starting)"):
+		return &ContainerHealth{Status: HealthStarting}
+	case strings.HasSuffix(status, "(healthy)"):
+		return &ContainerHealth{Status: HealthHealthy}
+	case strings.HasSuffix(status, "(unhealthy)"):
+		return &ContainerHealth{Status: HealthUnhealthy}
+	default:
+		return nil
+	}
+}
+
+// healthFromState returns the health of an inspected container
+func healthFromState(state *types.ContainerState) *ContainerHealth {
+	if state == nil || state.Health == nil {
+		return nil
+	}
+	return &ContainerHealth{
+		Status:        state.Health.Status,
+		FailingStreak: state.Health.FailingStreak,
+	}
+}
+
+// containerHealth updates the health of a known container on health_status events, and publishes
+// it as a start event so consumers can re-evaluate their conditions
+func (w *watcher) containerHealth(event events.Message) {
+	container := w.Container(event.Actor.ID)
+	if container == nil {
+		return
+	}
+
+	// Event actions are like "health_status: healthy"
+	health := &ContainerHealth{
+		Status: strings.TrimSpace(strings.TrimPrefix(event.Action, healthStatusAction+":")),
+	}
+	ctx, cancel := context.WithTimeout(w.ctx, dockerRequestTimeout)
+	defer cancel()
+	info, err := w.client.ContainerInspect(ctx, event.Actor.ID)
+	if err == nil && info.ContainerJSONBase != nil {
+		if h := healthFromState(info.State); h != nil {
+			health = h
+		}
+	} else {
+		w.log.Debugf("unable to inspect container %s health, using the status of the event: %v", event.Actor.ID, err)
+	}
+
+	updated := *container
+	updated.Health = health
+	w.replaceContainer(&updated)
+
+	w.bus.Publish(bus.Event{
+		"start":     true,
+		"container": &updated,
+	})
+}
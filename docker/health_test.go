@@ -0,0 +1,78 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthFromStatus(t *testing.T) {
+	assert.Nil(t, healthFromStatus("Up 2 minutes"))
+	assert.Equal(t, &ContainerHealth{Status: HealthStarting}, healthFromStatus("Up 2 seconds (health: starting)"))
+	assert.Equal(t, &ContainerHealth{Status: HealthHealthy}, healthFromStatus("Up 2 minutes (healthy)"))
+	assert.Equal(t, &ContainerHealth{Status: HealthUnhealthy}, healthFromStatus("Up 2 minutes (unhealthy)"))
+}
+
+func TestWatcherHealthStatus(t *testing.T) {
+	w, done := testWatcher(t,
+		[][]types.Container{
+			[]types.Container{
+				types.Container{
+					ID:              "0332dbd79e20",
+					Names:           []string{"/containername"},
+					Image:           "busybox",
+					Labels:          map[string]string{},
+					Status:          "Up 3 seconds (health: starting)",
+					NetworkSettings: &types.SummaryNetworkSettings{},
+				},
+			},
+		},
+		[]interface{}{
+			events.Message{
+				Action: "health_status: unhealthy",
+				Actor:  events.Actor{ID: "0332dbd79e20"},
+			},
+		},
+	)
+	w.client.(*MockClient).inspect = map[string]types.ContainerJSON{
+		"0332dbd79e20": {
+			ContainerJSONBase: &types.ContainerJSONBase{
+				State: &types.ContainerState{
+					Health: &types.Health{Status: HealthUnhealthy, FailingStreak: 3},
+				},
+			},
+		},
+	}
+	listener := w.ListenStart()
+	defer listener.Stop()
+	runAndWait(w, done)
+
+	expected := &ContainerHealth{Status: HealthUnhealthy, FailingStreak: 3}
+	assert.Equal(t, expected, w.Container("0332dbd79e20").Health)
+
+	// Initial start event, and the one of the health change
+	assert.Equal(t, &ContainerHealth{Status: HealthStarting}, (<-listener.Events())["container"].(*Container).Health)
+	assert.Equal(t, expected, (<-listener.Events())["container"].(*Container).Health)
+}
@@ -22,7 +22,6 @@ import (
 
 	"github.com/elastic/elastic-agent-autodiscover/utils"
 	"github.com/elastic/elastic-agent-libs/mapstr"
-	"github.com/elastic/elastic-agent-libs/safemapstr"
 )
 
 // ExtractContainerName strips the `/` characters that frequently appear in container names
@@ -43,17 +42,17 @@ func ExtractContainerName(names []string) string {
 // where the dots have been converted into nested structure, avoiding
 // possible mapping errors
 func DeDotLabels(labels map[string]string, dedot bool) mapstr.M {
+	// Dedotting is necessary so that ES does not interpret '.' fields as new
+	// nested JSON objects, and also makes this compatible with ES 2.x.
+	// If we don't dedot we ensure there are no mapping errors with safemapstr
+	var dedotter *utils.Dedotter
+	if dedot {
+		dedotter = utils.DefaultDedotter
+	}
+
 	outputLabels := mapstr.M{}
 	for k, v := range labels {
-		if dedot {
-			// This is necessary so that ES does not interpret '.' fields as new
-			// nested JSON objects, and also makes this compatible with ES 2.x.
-			label := utils.DeDot(k)
-			_, _ = outputLabels.Put(label, v)
-		} else {
-			// If we don't dedot we ensure there are no mapping errors with safemapstr
-			_ = safemapstr.Put(outputLabels, k, v)
-		}
+		dedotter.Put(outputLabels, k, v)
 	}
 
 	return outputLabels
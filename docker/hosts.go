@@ -0,0 +1,98 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/docker/docker/client"
+)
+
+// RootlessHosts returns the candidate endpoints of the daemons running as the current user, the
+// rootless docker socket first and then the ones of Docker Desktop.
+func RootlessHosts() []string {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = fmt.Sprintf("/run/user/%d", os.Getuid())
+	}
+	hosts := []string{"unix://" + filepath.Join(runtimeDir, "docker.sock")}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		hosts = append(hosts,
+			"unix://"+filepath.Join(home, ".docker", "run", "docker.sock"),
+			"unix://"+filepath.Join(home, ".docker", "desktop", "docker.sock"),
+		)
+	}
+	return hosts
+}
+
+// DefaultHosts returns the endpoints probed in order when no host is configured: the default
+// docker socket, the rootless ones and the Podman ones.
+func DefaultHosts() []string {
+	if runtime.GOOS == "windows" {
+		return []string{client.DefaultDockerHost}
+	}
+	hosts := []string{client.DefaultDockerHost}
+	hosts = append(hosts, RootlessHosts()...)
+	return append(hosts, PodmanHosts()...)
+}
+
+// resolveHost returns the host to connect to. When the default host is requested, the first
+// available of the candidates is used instead, or of the DefaultHosts if there are no candidates,
+// for hosts where the daemon listens on a non-default socket.
+func resolveHost(host string, candidates []string) string {
+	if host != client.DefaultDockerHost {
+		return host
+	}
+	if len(candidates) == 0 {
+		candidates = DefaultHosts()
+	}
+	for _, candidate := range candidates {
+		candidate = normalizeHost(candidate)
+		if hostAvailable(candidate) {
+			return candidate
+		}
+	}
+	return host
+}
+
+// hostAvailable returns true if the host is a unix socket endpoint whose socket file exists, or
+// an endpoint of any other kind, that cannot be checked without connecting to it
+func hostAvailable(host string) bool {
+	if !strings.HasPrefix(host, "unix://") {
+		return true
+	}
+	return socketExists(host)
+}
+
+// socketExists returns true if host is a unix socket endpoint whose socket file exists
+func socketExists(host string) bool {
+	path := strings.TrimPrefix(host, "unix://")
+	if path == host {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode()&os.ModeSocket != 0
+}
@@ -0,0 +1,95 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/docker/docker/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRootlessHosts(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
+	assert.Equal(t, []string{
+		"unix:///run/user/1000/docker.sock",
+		"unix://" + filepath.Join(home, ".docker", "run", "docker.sock"),
+		"unix://" + filepath.Join(home, ".docker", "desktop", "docker.sock"),
+	}, RootlessHosts())
+}
+
+func TestResolveHostRootless(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets not available")
+	}
+	if socketExists(client.DefaultDockerHost) {
+		t.Skip("docker socket present in the host")
+	}
+
+	runtimeDir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+	t.Setenv("HOME", t.TempDir())
+
+	socket := filepath.Join(runtimeDir, "docker.sock")
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	defer l.Close()
+
+	assert.Equal(t, "unix://"+socket, resolveHost(client.DefaultDockerHost, nil))
+}
+
+func TestResolveHostCandidates(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets not available")
+	}
+
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "docker.sock")
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	defer l.Close()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file.sock"), nil, 0o600))
+
+	// Missing sockets and files that are not sockets are skipped
+	candidates := []string{
+		"unix://" + filepath.Join(dir, "missing.sock"),
+		"unix://" + filepath.Join(dir, "file.sock"),
+		"unix://" + socket,
+		"tcp://docker:2375",
+	}
+	assert.Equal(t, "unix://"+socket, resolveHost(client.DefaultDockerHost, candidates))
+
+	// Endpoints other than unix sockets cannot be checked without connecting
+	assert.Equal(t, "tcp://docker:2375", resolveHost(client.DefaultDockerHost, []string{candidates[0], "tcp://docker:2375"}))
+
+	// No candidate available
+	assert.Equal(t, client.DefaultDockerHost, resolveHost(client.DefaultDockerHost, candidates[:2]))
+
+	// Explicitly configured hosts are not replaced
+	assert.Equal(t, "tcp://remote:2376", resolveHost("tcp://remote:2376", candidates))
+}
@@ -0,0 +1,186 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"context"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+// ContainerMount is a volume or bind mount of a container
+type ContainerMount struct {
+	Type        string
+	Name        string // empty for bind mounts
+	Source      string
+	Destination string
+	RW          bool
+}
+
+// ContainerRestartPolicy is the restart policy of a container
+type ContainerRestartPolicy struct {
+	Name              string
+	MaximumRetryCount int
+}
+
+// ContainerResources are the resource limits of a container, zero values are not limited
+type ContainerResources struct {
+	CPUShares         int64
+	CPUQuota          int64 // CFS quota in microseconds per CPUPeriod
+	CPUPeriod         int64 // CFS period in microseconds
+	NanoCPUs          int64 // CPU limit in units of 1e-9 CPUs
+	MemoryLimit       int64 // bytes
+	MemoryReservation int64 // bytes
+	PidsLimit         int64
+}
+
+// CPULimit returns the number of CPUs the container is limited to, or 0 if it is not limited
+func (r ContainerResources) CPULimit() float64 {
+	if r.NanoCPUs > 0 {
+		return float64(r.NanoCPUs) / 1e9
+	}
+	if r.CPUQuota > 0 {
+		period := r.CPUPeriod
+		if period <= 0 {
+			// Default CFS period
+			period = 100000
+		}
+		return float64(r.CPUQuota) / float64(period)
+	}
+	return 0
+}
+
+// imageInspector is implemented by clients able to inspect images, like the docker client
+type imageInspector interface {
+	ImageInspectWithRaw(ctx context.Context, image string) (types.ImageInspect, []byte, error)
+}
+
+// imageDigest returns the digest of an image referenced by digest, e.g. "nginx@sha256:..."
+func imageDigest(image string) string {
+	if i := strings.LastIndex(image, "@"); i >= 0 {
+		return image[i+1:]
+	}
+	return ""
+}
+
+func containerMounts(mounts []types.MountPoint) []ContainerMount {
+	if len(mounts) == 0 {
+		return nil
+	}
+	result := make([]ContainerMount, len(mounts))
+	for i, m := range mounts {
+		result[i] = ContainerMount{
+			Type:        string(m.Type),
+			Name:        m.Name,
+			Source:      m.Source,
+			Destination: m.Destination,
+			RW:          m.RW,
+		}
+	}
+	return result
+}
+
+// inspectContainer returns the details of a container, or nil if it cannot be inspected
+func (w *watcher) inspectContainer(ID string) *types.ContainerJSON {
+	w.log.Debugf("Inspect container %s", ID)
+	ctx, cancel := context.WithTimeout(w.ctx, dockerRequestTimeout)
+	defer cancel()
+	info, err := w.client.ContainerInspect(ctx, ID)
+	if err != nil {
+		w.log.Warnf("unable to inspect container %s due to error %+v", ID, err)
+		return nil
+	}
+	return &info
+}
+
+// addInspectInfo adds the restart policy, the resource limits and the image digest of an inspected container
+func (w *watcher) addInspectInfo(container *Container, info *types.ContainerJSON) {
+	if info != nil && info.ContainerJSONBase != nil && info.HostConfig != nil {
+		policy := info.HostConfig.RestartPolicy
+		if policy.Name != "" {
+			container.RestartPolicy = &ContainerRestartPolicy{
+				Name:              policy.Name,
+				MaximumRetryCount: policy.MaximumRetryCount,
+			}
+		}
+		container.Resources = containerResources(info.HostConfig.Resources)
+	}
+	if container.ImageDigest == "" && container.ImageID != "" {
+		container.ImageDigest = w.imageDigest(container.ImageID)
+	}
+}
+
+// imageDigest returns the repository digest of an image, digests are cached by image ID as they
+// cannot change
+func (w *watcher) imageDigest(imageID string) string {
+	inspector, ok := w.client.(imageInspector)
+	if !ok {
+		return ""
+	}
+
+	w.digestsMutex.Lock()
+	digest, found := w.digests[imageID]
+	w.digestsMutex.Unlock()
+	if found {
+		return digest
+	}
+
+	ctx, cancel := context.WithTimeout(w.ctx, dockerRequestTimeout)
+	defer cancel()
+	image, _, err := inspector.ImageInspectWithRaw(ctx, imageID)
+	if err != nil {
+		w.log.Debugf("unable to inspect image %s: %v", imageID, err)
+		return ""
+	}
+	// Locally built images have no repository digest
+	for _, repoDigest := range image.RepoDigests {
+		if digest = imageDigest(repoDigest); digest != "" {
+			break
+		}
+	}
+
+	w.digestsMutex.Lock()
+	w.digests[imageID] = digest
+	w.digestsMutex.Unlock()
+	return digest
+}
+
+// containerResources returns the resource limits of a container, or nil if it is not limited
+func containerResources(r container.Resources) *ContainerResources {
+	resources := ContainerResources{
+		CPUShares:         r.CPUShares,
+		CPUQuota:          r.CPUQuota,
+		CPUPeriod:         r.CPUPeriod,
+		NanoCPUs:          r.NanoCPUs,
+		MemoryLimit:       r.Memory,
+		MemoryReservation: r.MemoryReservation,
+	}
+	// 0 and -1 are unlimited
+	if r.PidsLimit != nil && *r.PidsLimit > 0 {
+		resources.PidsLimit = *r.PidsLimit
+	}
+	if resources == (ContainerResources{}) {
+		return nil
+	}
+	return &resources
+}
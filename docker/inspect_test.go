@@ -0,0 +1,128 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+type imageInspectorClient struct {
+	*MockClient
+	images   map[string]types.ImageInspect
+	inspects int
+}
+
+func (c *imageInspectorClient) ImageInspectWithRaw(ctx context.Context, image string) (types.ImageInspect, []byte, error) {
+	c.inspects++
+	if info, ok := c.images[image]; ok {
+		return info, nil, nil
+	}
+	return types.ImageInspect{}, nil, errors.New("no such image")
+}
+
+func TestImageDigest(t *testing.T) {
+	assert.Equal(t, "sha256:a1b2", imageDigest("nginx@sha256:a1b2"))
+	assert.Equal(t, "sha256:a1b2", imageDigest("registry:5000/nginx@sha256:a1b2"))
+	assert.Empty(t, imageDigest("nginx:1.23"))
+}
+
+func TestContainerResources(t *testing.T) {
+	assert.Nil(t, containerResources(container.Resources{}))
+
+	unlimited := int64(-1)
+	assert.Nil(t, containerResources(container.Resources{PidsLimit: &unlimited}))
+
+	pids := int64(100)
+	assert.Equal(t, &ContainerResources{
+		CPUShares:   512,
+		CPUQuota:    50000,
+		MemoryLimit: 256 << 20,
+		PidsLimit:   100,
+	}, containerResources(container.Resources{CPUShares: 512, CPUQuota: 50000, Memory: 256 << 20, PidsLimit: &pids}))
+
+	assert.Equal(t, 0.5, ContainerResources{CPUQuota: 50000}.CPULimit())
+	assert.Equal(t, 2.0, ContainerResources{CPUQuota: 100000, CPUPeriod: 50000}.CPULimit())
+	assert.Equal(t, 1.5, ContainerResources{NanoCPUs: 1500000000, CPUQuota: 50000}.CPULimit())
+	assert.Equal(t, 0.0, ContainerResources{CPUShares: 512}.CPULimit())
+}
+
+func TestWatcherInspectContainers(t *testing.T) {
+	require.NoError(t, logp.TestingSetup())
+
+	inspect := func(policy string) types.ContainerJSON {
+		return types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{
+				HostConfig: &container.HostConfig{
+					RestartPolicy: container.RestartPolicy{Name: policy},
+					Resources:     container.Resources{Memory: 128 << 20},
+				},
+			},
+		}
+	}
+	client := &imageInspectorClient{
+		MockClient: &MockClient{
+			containers: [][]types.Container{{
+				{ID: "0332dbd79e20", Names: []string{"/web"}, Image: "nginx", ImageID: "sha256:4f38"},
+				{ID: "6c9a82bf1c4d", Names: []string{"/worker"}, Image: "nginx", ImageID: "sha256:4f38"},
+				{ID: "97ac5b8e3bd4", Names: []string{"/app"}, Image: "app@sha256:c3d4", ImageID: "sha256:9e1c",
+					Mounts: []types.MountPoint{{Type: "bind", Source: "/srv", Destination: "/srv", RW: true}}},
+			}},
+			inspect: map[string]types.ContainerJSON{
+				"0332dbd79e20": inspect("always"),
+				"6c9a82bf1c4d": inspect(""),
+				"97ac5b8e3bd4": inspect("unless-stopped"),
+			},
+			done: make(chan interface{}),
+		},
+		images: map[string]types.ImageInspect{
+			"sha256:4f38": {RepoDigests: []string{"nginx@sha256:a1b2"}},
+		},
+	}
+
+	w, err := NewWatcherWithClientOptions(logp.L(), client, WatcherOptions{InspectContainers: true})
+	require.NoError(t, err)
+	watcher := runAndWait(w.(*watcher), client.done)
+
+	web := watcher.Container("0332dbd79e20")
+	assert.Equal(t, "sha256:a1b2", web.ImageDigest)
+	assert.Equal(t, &ContainerRestartPolicy{Name: "always"}, web.RestartPolicy)
+	assert.Equal(t, &ContainerResources{MemoryLimit: 128 << 20}, web.Resources)
+
+	worker := watcher.Container("6c9a82bf1c4d")
+	assert.Equal(t, "sha256:a1b2", worker.ImageDigest)
+	assert.Nil(t, worker.RestartPolicy)
+
+	app := watcher.Container("97ac5b8e3bd4")
+	assert.Equal(t, "sha256:c3d4", app.ImageDigest)
+	assert.Equal(t, []ContainerMount{{Type: "bind", Source: "/srv", Destination: "/srv", RW: true}}, app.Mounts)
+
+	// Digests are cached by image, and not inspected if known from the reference
+	assert.Equal(t, 1, client.inspects)
+}
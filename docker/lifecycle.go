@@ -0,0 +1,140 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+)
+
+// Lifecycle actions of container events, besides start, update and die
+const (
+	pauseAction   = "pause"
+	unpauseAction = "unpause"
+	oomAction     = "oom"
+)
+
+// States of containers
+const (
+	StateRunning = "running"
+	StatePaused  = "paused"
+	StateExited  = "exited"
+)
+
+// containerState updates the state of a known container and publishes it with the given topic
+func (w *watcher) containerState(event events.Message, state, topic string) {
+	container := w.Container(event.Actor.ID)
+	if container == nil {
+		return
+	}
+
+	updated := *container
+	updated.State = state
+	w.replaceContainer(&updated)
+
+	w.bus.Publish(bus.Event{
+		topic:       true,
+		"container": &updated,
+	})
+}
+
+// containerOOM publishes oom events of known containers, the container may be stopped or not
+// depending on the process killed by the OOM killer
+func (w *watcher) containerOOM(event events.Message) {
+	container := w.Container(event.Actor.ID)
+	if container == nil {
+		return
+	}
+	w.bus.Publish(bus.Event{
+		oomAction:   true,
+		"container": container,
+	})
+}
+
+// replaceContainer stores an updated copy of a known container, containers are replaced and not
+// modified as they are shared with the consumers of the events
+func (w *watcher) replaceContainer(updated *Container) {
+	w.Lock()
+	defer w.Unlock()
+	w.containers[updated.ID] = updated
+	if w.shortID && len(updated.ID) > shortIDLen {
+		w.containers[updated.ID[:shortIDLen]] = updated
+	}
+}
+
+// ContainerTermination is the termination of a stopped container
+type ContainerTermination struct {
+	// ExitCode of the main process, nil if unknown
+	ExitCode *int
+	// OOMKilled is true if the container was killed by the OOM killer
+	OOMKilled bool
+	// FinishedAt is the time the container stopped
+	FinishedAt time.Time
+}
+
+// containerTermination returns the termination of a container on die events. The container is
+// inspected to know if it was OOM killed, if it cannot be inspected the exit code and time of the
+// event are used.
+func (w *watcher) containerTermination(event events.Message) *ContainerTermination {
+	termination := &ContainerTermination{FinishedAt: eventTime(event)}
+	if code, ok := exitCode(event); ok {
+		termination.ExitCode = &code
+	}
+
+	ctx, cancel := context.WithTimeout(w.ctx, dockerRequestTimeout)
+	defer cancel()
+	info, err := w.client.ContainerInspect(ctx, event.Actor.ID)
+	if err != nil || info.ContainerJSONBase == nil || info.State == nil {
+		w.log.Debugf("unable to inspect container %s termination, using the event: %v", event.Actor.ID, err)
+		return termination
+	}
+
+	code := info.State.ExitCode
+	termination.ExitCode = &code
+	termination.OOMKilled = info.State.OOMKilled
+	if finishedAt, err := time.Parse(time.RFC3339Nano, info.State.FinishedAt); err == nil && !finishedAt.IsZero() {
+		termination.FinishedAt = finishedAt
+	}
+	return termination
+}
+
+// exitCode returns the exit code reported in the attributes of a die event
+func exitCode(event events.Message) (int, bool) {
+	code, err := strconv.Atoi(event.Actor.Attributes["exitCode"])
+	return code, err == nil
+}
+
+// eventTime returns the time of an event, or the zero time if it has none
+func eventTime(event events.Message) time.Time {
+	switch {
+	case event.TimeNano > 0:
+		return time.Unix(0, event.TimeNano).UTC()
+	case event.Time > 0:
+		return time.Unix(event.Time, 0).UTC()
+	default:
+		return time.Time{}
+	}
+}
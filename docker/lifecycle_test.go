@@ -0,0 +1,153 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/network"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+)
+
+var _ LifecycleWatcher = &watcher{}
+
+func TestWatcherLifecycleEvents(t *testing.T) {
+	watcher, clientDone := testWatcherShortID(t,
+		[][]types.Container{
+			[]types.Container{
+				types.Container{
+					ID:              "0332dbd79e20aaa",
+					Names:           []string{"/web"},
+					Image:           "nginx",
+					State:           StateRunning,
+					NetworkSettings: &types.SummaryNetworkSettings{},
+				},
+			},
+		},
+		[]interface{}{
+			events.Message{Action: "pause", Actor: events.Actor{ID: "0332dbd79e20aaa"}},
+			events.Message{Action: "unpause", Actor: events.Actor{ID: "0332dbd79e20aaa"}},
+			events.Message{Action: "oom", Actor: events.Actor{ID: "0332dbd79e20aaa"}},
+			events.Message{Action: "die", TimeNano: 1666000000000000000, Actor: events.Actor{ID: "0332dbd79e20aaa", Attributes: map[string]string{"exitCode": "137"}}},
+			// Unknown containers are ignored
+			events.Message{Action: "pause", Actor: events.Actor{ID: "6c9a82bf1c4d"}},
+		},
+		true,
+	)
+
+	pause := watcher.ListenPause()
+	defer pause.Stop()
+	unpause := watcher.ListenUnpause()
+	defer unpause.Stop()
+	oom := watcher.ListenOOM()
+	defer oom.Stop()
+	stop := watcher.ListenStop()
+	defer stop.Stop()
+
+	require.NoError(t, watcher.Start())
+	defer watcher.Stop()
+	<-clientDone
+
+	e := receive(t, pause)
+	assert.Equal(t, StatePaused, e["container"].(*Container).State)
+
+	e = receive(t, unpause)
+	assert.Equal(t, StateRunning, e["container"].(*Container).State)
+
+	e = receive(t, oom)
+	assert.Equal(t, "web", e["container"].(*Container).Name)
+
+	e = receive(t, stop)
+	assert.Equal(t, StateExited, e["container"].(*Container).State)
+	assert.Equal(t, 137, e["exit_code"])
+	// Termination from the event if the container cannot be inspected
+	exitCode := 137
+	assert.Equal(t, &ContainerTermination{ExitCode: &exitCode, FinishedAt: time.Unix(0, 1666000000000000000).UTC()}, e["termination"])
+
+	// State is also updated for the short ID
+	assert.Equal(t, StateExited, watcher.Container("0332dbd79e20").State)
+	assert.Empty(t, pause.Events())
+}
+
+func TestWatcherTermination(t *testing.T) {
+	watcher, clientDone := testWatcher(t,
+		[][]types.Container{
+			[]types.Container{
+				types.Container{
+					ID:              "0332dbd79e20",
+					Names:           []string{"/worker"},
+					Image:           "busybox",
+					NetworkSettings: &types.SummaryNetworkSettings{Networks: map[string]*network.EndpointSettings{"bridge": {IPAddress: "172.17.0.2"}}},
+				},
+			},
+		},
+		[]interface{}{
+			events.Message{Action: "die", Time: 1666000000, Actor: events.Actor{ID: "0332dbd79e20", Attributes: map[string]string{"exitCode": "137"}}},
+		},
+	)
+	watcher.client.(*MockClient).inspect = map[string]types.ContainerJSON{
+		"0332dbd79e20": {
+			ContainerJSONBase: &types.ContainerJSONBase{
+				State: &types.ContainerState{
+					Status:     StateExited,
+					ExitCode:   137,
+					OOMKilled:  true,
+					FinishedAt: "2022-10-17T09:46:39.123456789Z",
+				},
+			},
+		},
+	}
+
+	stop := watcher.ListenStop()
+	defer stop.Stop()
+
+	require.NoError(t, watcher.Start())
+	defer watcher.Stop()
+	<-clientDone
+
+	e := receive(t, stop)
+	exitCode := 137
+	expected := &ContainerTermination{
+		ExitCode:   &exitCode,
+		OOMKilled:  true,
+		FinishedAt: time.Date(2022, 10, 17, 9, 46, 39, 123456789, time.UTC),
+	}
+	assert.Equal(t, expected, e["termination"])
+	assert.Equal(t, 137, e["exit_code"])
+	assert.Equal(t, expected, watcher.Container("0332dbd79e20").Termination)
+}
+
+func receive(t *testing.T, listener bus.Listener) bus.Event {
+	t.Helper()
+	select {
+	case e := <-listener.Events():
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("event not received")
+		return nil
+	}
+}
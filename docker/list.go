@@ -0,0 +1,112 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+)
+
+// containerStatuses are the statuses of containers that can be used to filter the listing
+var containerStatuses = map[string]bool{
+	"created":    true,
+	"restarting": true,
+	"running":    true,
+	"removing":   true,
+	"paused":     true,
+	"exited":     true,
+	"dead":       true,
+}
+
+// ListOptions configures how containers are listed when the watcher starts and reconciles
+type ListOptions struct {
+	// Statuses of the containers to list, only running containers are listed by default
+	Statuses []string `config:"statuses"`
+
+	// ChunkSize is the number of containers requested at once, 0 to request all of them in a
+	// single request. Hosts with thousands of containers can list them in chunks to avoid long
+	// requests.
+	ChunkSize int `config:"chunk_size"`
+}
+
+// Validate the list options
+func (o *ListOptions) Validate() error {
+	for _, status := range o.Statuses {
+		if !containerStatuses[status] {
+			return fmt.Errorf("invalid container status %q", status)
+		}
+	}
+	if o.ChunkSize < 0 {
+		return fmt.Errorf("chunk_size must not be negative, got %d", o.ChunkSize)
+	}
+	return nil
+}
+
+// listOptions returns the options of the list API, for the chunk of containers created before
+// the given container, if any
+func (w *watcher) listOptions(before string) types.ContainerListOptions {
+	args := w.eventsFilter.listArgs()
+	for _, status := range w.list.Statuses {
+		args.Add("status", status)
+	}
+	options := types.ContainerListOptions{
+		Filters: args,
+		All:     len(w.list.Statuses) > 0,
+	}
+	if w.list.ChunkSize > 0 {
+		// The daemon lists all containers when there is a limit, unless filtered by status
+		if len(w.list.Statuses) == 0 {
+			args.Add("status", "running")
+		}
+		options.Limit = w.list.ChunkSize
+		if before != "" {
+			args.Add("before", before)
+		}
+	}
+	return options
+}
+
+// listAllContainers lists the containers matching the filters, in chunks if configured
+func (w *watcher) listAllContainers() ([]*Container, error) {
+	if w.list.ChunkSize <= 0 {
+		return w.listContainers(w.listOptions(""))
+	}
+
+	// Containers are listed from the most recently created, every chunk continues with the
+	// containers created before the last one of the previous chunk
+	var result []*Container
+	before := ""
+	for {
+		chunk, err := w.listContainers(w.listOptions(before))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, chunk...)
+		if len(chunk) < w.list.ChunkSize || chunk[len(chunk)-1].ID == before {
+			break
+		}
+		before = chunk[len(chunk)-1].ID
+		w.log.Infof("Listed %d docker containers so far", len(result))
+	}
+	w.log.Infof("Listed %d docker containers", len(result))
+	return result, nil
+}
@@ -0,0 +1,110 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+func TestWatcherChunkedListing(t *testing.T) {
+	require.NoError(t, logp.TestingSetup())
+
+	container := func(id string) types.Container {
+		return types.Container{ID: id, Names: []string{"/" + id}, NetworkSettings: &types.SummaryNetworkSettings{}}
+	}
+	client := &MockClient{
+		containers: [][]types.Container{
+			{container("e"), container("d")},
+			{container("c"), container("b")},
+			{container("a")},
+		},
+		done: make(chan interface{}),
+	}
+	w, err := NewWatcherWithClientOptions(logp.L(), client, WatcherOptions{
+		EventsFilter: EventsFilter{Labels: []string{"team=a"}},
+		List:         ListOptions{ChunkSize: 2},
+	})
+	require.NoError(t, err)
+	watcher := runAndWait(w.(*watcher), client.done)
+
+	assert.Len(t, watcher.Containers(), 5)
+	require.Len(t, client.listOptions, 3)
+	for i, before := range []string{"", "d", "b"} {
+		options := client.listOptions[i]
+		assert.Equal(t, 2, options.Limit)
+		assert.False(t, options.All)
+		assert.Equal(t, []string{"team=a"}, options.Filters.Get("label"))
+		assert.Equal(t, []string{"running"}, options.Filters.Get("status"))
+		if before == "" {
+			assert.Empty(t, options.Filters.Get("before"))
+		} else {
+			assert.Equal(t, []string{before}, options.Filters.Get("before"))
+		}
+	}
+}
+
+func TestWatcherListStatuses(t *testing.T) {
+	require.NoError(t, logp.TestingSetup())
+
+	client := &MockClient{
+		containers: [][]types.Container{{}},
+		done:       make(chan interface{}),
+	}
+	w, err := NewWatcherWithClientOptions(logp.L(), client, WatcherOptions{
+		List: ListOptions{Statuses: []string{"running", "paused"}},
+	})
+	require.NoError(t, err)
+	runAndWait(w.(*watcher), client.done)
+
+	require.Len(t, client.listOptions, 1)
+	assert.True(t, client.listOptions[0].All)
+	assert.Zero(t, client.listOptions[0].Limit)
+	assert.ElementsMatch(t, []string{"running", "paused"}, client.listOptions[0].Filters.Get("status"))
+}
+
+func TestListOptionsConfig(t *testing.T) {
+	cfg, err := config.NewConfigFrom(map[string]interface{}{
+		"list": map[string]interface{}{
+			"statuses":   []string{"running", "restarting"},
+			"chunk_size": 500,
+		},
+	})
+	require.NoError(t, err)
+	var opts WatcherOptions
+	require.NoError(t, cfg.Unpack(&opts))
+	assert.Equal(t, ListOptions{Statuses: []string{"running", "restarting"}, ChunkSize: 500}, opts.List)
+
+	for _, invalid := range []map[string]interface{}{
+		{"statuses": []string{"stopped"}},
+		{"chunk_size": -1},
+	} {
+		cfg, err := config.NewConfigFrom(map[string]interface{}{"list": invalid})
+		require.NoError(t, err)
+		assert.Error(t, cfg.Unpack(&WatcherOptions{}), invalid)
+	}
+}
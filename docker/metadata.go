@@ -0,0 +1,181 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"sort"
+
+	"github.com/docker/docker/api/types"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// GenerateMetadata returns the metadata of a container, with its labels dedotted if dedot is set
+func GenerateMetadata(container *Container, dedot bool) mapstr.M {
+	image := mapstr.M{"name": container.Image}
+	putIfNotEmpty(image, "id", container.ImageID)
+	putIfNotEmpty(image, "digest", container.ImageDigest)
+	meta := mapstr.M{
+		"id":     container.ID,
+		"name":   container.Name,
+		"image":  image,
+		"labels": DeDotLabels(container.Labels, dedot),
+	}
+	putIfNotEmpty(meta, "state", container.State)
+	if len(container.IPAddresses) > 0 {
+		meta["ip"] = container.IPAddresses
+	}
+	if networks := networksMetadata(container.Networks); len(networks) > 0 {
+		meta["networks"] = networks
+	}
+	if container.Health != nil {
+		meta["health"] = mapstr.M{
+			"status":         container.Health.Status,
+			"failing_streak": container.Health.FailingStreak,
+		}
+	}
+	if ports := portsMetadata(container.Ports); len(ports) > 0 {
+		meta["ports"] = ports
+	}
+	if mounts := mountsMetadata(container.Mounts); len(mounts) > 0 {
+		meta["mounts"] = mounts
+	}
+	if container.RestartPolicy != nil {
+		meta["restart_policy"] = mapstr.M{
+			"name":                container.RestartPolicy.Name,
+			"maximum_retry_count": container.RestartPolicy.MaximumRetryCount,
+		}
+	}
+	if t := container.Termination; t != nil {
+		termination := mapstr.M{"oom_killed": t.OOMKilled}
+		if t.ExitCode != nil {
+			termination["exit_code"] = *t.ExitCode
+		}
+		if !t.FinishedAt.IsZero() {
+			termination["finished_at"] = t.FinishedAt
+		}
+		meta["termination"] = termination
+	}
+	if container.Resources != nil {
+		meta["resources"] = resourcesMetadata(*container.Resources)
+	}
+	return meta
+}
+
+// resourcesMetadata returns the resource limits of a container, so consumers can compute the
+// utilization relative to them
+func resourcesMetadata(r ContainerResources) mapstr.M {
+	cpu := mapstr.M{}
+	putIfNotZero(cpu, "shares", r.CPUShares)
+	putIfNotZero(cpu, "quota", r.CPUQuota)
+	putIfNotZero(cpu, "period", r.CPUPeriod)
+	if limit := r.CPULimit(); limit > 0 {
+		cpu["limit"] = limit
+	}
+
+	memory := mapstr.M{}
+	putIfNotZero(memory, "limit", r.MemoryLimit)
+	putIfNotZero(memory, "reservation", r.MemoryReservation)
+
+	meta := mapstr.M{}
+	if len(cpu) > 0 {
+		meta["cpu"] = cpu
+	}
+	if len(memory) > 0 {
+		meta["memory"] = memory
+	}
+	if r.PidsLimit > 0 {
+		meta["pids"] = mapstr.M{"limit": r.PidsLimit}
+	}
+	return meta
+}
+
+// portsMetadata returns the exposed ports of a container, with the host address and port they are
+// published to, if any
+func portsMetadata(ports []types.Port) []mapstr.M {
+	result := make([]mapstr.M, 0, len(ports))
+	for _, port := range ports {
+		m := mapstr.M{
+			"port":     port.PrivatePort,
+			"protocol": port.Type,
+		}
+		if port.PublicPort != 0 {
+			published := mapstr.M{"port": port.PublicPort}
+			putIfNotEmpty(published, "ip", port.IP)
+			m["published"] = published
+		}
+		result = append(result, m)
+	}
+	return result
+}
+
+func mountsMetadata(mounts []ContainerMount) []mapstr.M {
+	result := make([]mapstr.M, 0, len(mounts))
+	for _, mount := range mounts {
+		m := mapstr.M{
+			"destination": mount.Destination,
+			"rw":          mount.RW,
+		}
+		putIfNotEmpty(m, "type", mount.Type)
+		putIfNotEmpty(m, "name", mount.Name)
+		putIfNotEmpty(m, "source", mount.Source)
+		result = append(result, m)
+	}
+	return result
+}
+
+// networksMetadata returns the list of networks of a container sorted by name, as network names
+// can contain dots
+func networksMetadata(networks map[string]ContainerNetwork) []mapstr.M {
+	names := make([]string, 0, len(networks))
+	for name := range networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]mapstr.M, 0, len(names))
+	for _, name := range names {
+		net := networks[name]
+		m := mapstr.M{"name": name}
+		putIfNotEmpty(m, "id", net.NetworkID)
+		putIfNotEmpty(m, "ip", net.IPAddress)
+		putIfNotEmpty(m, "ipv6", net.IPv6Address)
+		putIfNotEmpty(m, "gateway", net.Gateway)
+		putIfNotEmpty(m, "mac", net.MacAddress)
+		if len(net.Aliases) > 0 {
+			m["aliases"] = net.Aliases
+		}
+		result = append(result, m)
+	}
+	return result
+}
+
+func putIfNotEmpty(m mapstr.M, key, value string) {
+	if value != "" {
+		m[key] = value
+	}
+}
+
+func putIfNotZero(m mapstr.M, key string, value int64) {
+	if value != 0 {
+		m[key] = value
+	}
+}
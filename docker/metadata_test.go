@@ -0,0 +1,148 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestWatcherNetworks(t *testing.T) {
+	watcher := runAndWait(testWatcher(t,
+		[][]types.Container{
+			[]types.Container{
+				types.Container{
+					ID:     "0332dbd79e20",
+					Names:  []string{"/web"},
+					Image:  "nginx",
+					Labels: map[string]string{},
+					NetworkSettings: &types.SummaryNetworkSettings{
+						Networks: map[string]*network.EndpointSettings{
+							"app_frontend": {NetworkID: "n1", IPAddress: "172.18.0.2", Gateway: "172.18.0.1", Aliases: []string{"web", "0332dbd79e20"}},
+							"macvlan.lan":  {NetworkID: "n2", IPAddress: "192.168.1.20", Gateway: "192.168.1.1", MacAddress: "02:42:c0:a8:01:14"},
+						},
+					},
+				},
+			},
+		},
+		nil,
+	))
+
+	container := watcher.Container("0332dbd79e20")
+	assert.ElementsMatch(t, []string{"172.18.0.2", "192.168.1.20"}, container.IPAddresses)
+	assert.Equal(t, map[string]ContainerNetwork{
+		"app_frontend": {NetworkID: "n1", IPAddress: "172.18.0.2", Gateway: "172.18.0.1", Aliases: []string{"web", "0332dbd79e20"}},
+		"macvlan.lan":  {NetworkID: "n2", IPAddress: "192.168.1.20", Gateway: "192.168.1.1", MacAddress: "02:42:c0:a8:01:14"},
+	}, container.Networks)
+
+	meta := GenerateMetadata(container, true)
+	assert.Equal(t, []mapstr.M{
+		{"name": "app_frontend", "id": "n1", "ip": "172.18.0.2", "gateway": "172.18.0.1", "aliases": []string{"web", "0332dbd79e20"}},
+		{"name": "macvlan.lan", "id": "n2", "ip": "192.168.1.20", "gateway": "192.168.1.1", "mac": "02:42:c0:a8:01:14"},
+	}, meta["networks"])
+}
+
+func TestGenerateMetadata(t *testing.T) {
+	meta := GenerateMetadata(&Container{
+		ID:     "0332dbd79e20",
+		Name:   "web",
+		Image:  "nginx",
+		Labels: map[string]string{"app.kubernetes.io/name": "web"},
+		Health: &ContainerHealth{Status: HealthHealthy},
+	}, true)
+	assert.Equal(t, mapstr.M{
+		"id":     "0332dbd79e20",
+		"name":   "web",
+		"image":  mapstr.M{"name": "nginx"},
+		"labels": mapstr.M{"app_kubernetes_io/name": "web"},
+		"health": mapstr.M{"status": "healthy", "failing_streak": 0},
+	}, meta)
+}
+
+func TestGenerateMetadataPortsAndMounts(t *testing.T) {
+	meta := GenerateMetadata(&Container{
+		ID:          "0332dbd79e20",
+		Name:        "web",
+		Image:       "nginx",
+		ImageID:     "sha256:4f38",
+		ImageDigest: "sha256:a1b2",
+		Ports: []types.Port{
+			{PrivatePort: 80, PublicPort: 8080, IP: "0.0.0.0", Type: "tcp"},
+			{PrivatePort: 53, Type: "udp"},
+		},
+		Mounts: []ContainerMount{
+			{Type: "bind", Source: "/var/log/nginx", Destination: "/logs", RW: true},
+			{Type: "volume", Name: "data", Source: "/var/lib/docker/volumes/data/_data", Destination: "/data"},
+		},
+		RestartPolicy: &ContainerRestartPolicy{Name: "on-failure", MaximumRetryCount: 3},
+	}, false)
+
+	assert.Equal(t, mapstr.M{"name": "nginx", "id": "sha256:4f38", "digest": "sha256:a1b2"}, meta["image"])
+	assert.Equal(t, []mapstr.M{
+		{"port": uint16(80), "protocol": "tcp", "published": mapstr.M{"port": uint16(8080), "ip": "0.0.0.0"}},
+		{"port": uint16(53), "protocol": "udp"},
+	}, meta["ports"])
+	assert.Equal(t, []mapstr.M{
+		{"type": "bind", "source": "/var/log/nginx", "destination": "/logs", "rw": true},
+		{"type": "volume", "name": "data", "source": "/var/lib/docker/volumes/data/_data", "destination": "/data", "rw": false},
+	}, meta["mounts"])
+	assert.Equal(t, mapstr.M{"name": "on-failure", "maximum_retry_count": 3}, meta["restart_policy"])
+}
+
+func TestGenerateMetadataResources(t *testing.T) {
+	meta := GenerateMetadata(&Container{
+		ID:    "0332dbd79e20",
+		Name:  "web",
+		Image: "nginx",
+		Resources: &ContainerResources{
+			CPUShares:   512,
+			NanoCPUs:    1500000000,
+			MemoryLimit: 256 << 20,
+			PidsLimit:   100,
+		},
+	}, false)
+	assert.Equal(t, mapstr.M{
+		"cpu":    mapstr.M{"shares": int64(512), "limit": 1.5},
+		"memory": mapstr.M{"limit": int64(256 << 20)},
+		"pids":   mapstr.M{"limit": int64(100)},
+	}, meta["resources"])
+
+	assert.NotContains(t, GenerateMetadata(&Container{ID: "0332dbd79e20"}, false), "resources")
+}
+
+func TestGenerateMetadataTermination(t *testing.T) {
+	exitCode := 137
+	finishedAt := time.Date(2022, 10, 17, 9, 46, 39, 0, time.UTC)
+	meta := GenerateMetadata(&Container{
+		ID:          "0332dbd79e20",
+		Name:        "worker",
+		State:       StateExited,
+		Termination: &ContainerTermination{ExitCode: &exitCode, OOMKilled: true, FinishedAt: finishedAt},
+	}, false)
+	assert.Equal(t, StateExited, meta["state"])
+	assert.Equal(t, mapstr.M{"exit_code": 137, "oom_killed": true, "finished_at": finishedAt}, meta["termination"])
+}
@@ -0,0 +1,154 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"sync"
+
+	"github.com/elastic/elastic-agent-autodiscover/metrics"
+)
+
+// WatcherMetrics receives the metrics of a docker watcher, implementations must be safe for
+// concurrent use
+type WatcherMetrics interface {
+	// EventReceived is called for every docker event received, with its action
+	EventReceived(action string)
+
+	// Reconnected is called every time the events stream is reconnected
+	Reconnected()
+
+	// ListFailed is called when a container list request fails
+	ListFailed()
+
+	// ContainersTracked is called with the number of known containers when it changes, stopped
+	// containers are tracked until they are cleaned up
+	ContainersTracked(count int)
+}
+
+// WatcherStats are the counters of a docker watcher
+type WatcherStats struct {
+	// Events is the number of events received by action
+	Events map[string]int64
+	// Reconnects is the number of times the events stream was reconnected
+	Reconnects int64
+	// ListErrors is the number of failed container list requests
+	ListErrors int64
+	// Containers is the number of containers tracked by the watcher
+	Containers int
+}
+
+// Metrics is a WatcherMetrics keeping the counters in memory
+type Metrics struct {
+	sync.Mutex
+	stats WatcherStats
+}
+
+// NewMetrics creates an empty Metrics
+func NewMetrics() *Metrics {
+	return &Metrics{stats: WatcherStats{Events: make(map[string]int64)}}
+}
+
+// Stats returns a snapshot of the counters
+func (m *Metrics) Stats() WatcherStats {
+	m.Lock()
+	defer m.Unlock()
+
+	stats := m.stats
+	stats.Events = make(map[string]int64, len(m.stats.Events))
+	for action, count := range m.stats.Events {
+		stats.Events[action] = count
+	}
+	return stats
+}
+
+// EventReceived counts an event of the given action
+func (m *Metrics) EventReceived(action string) {
+	m.Lock()
+	defer m.Unlock()
+	m.stats.Events[action]++
+}
+
+// Reconnected counts a reconnection of the events stream
+func (m *Metrics) Reconnected() {
+	m.Lock()
+	defer m.Unlock()
+	m.stats.Reconnects++
+}
+
+// ListFailed counts a failed container list request
+func (m *Metrics) ListFailed() {
+	m.Lock()
+	defer m.Unlock()
+	m.stats.ListErrors++
+}
+
+// ContainersTracked sets the number of tracked containers
+func (m *Metrics) ContainersTracked(count int) {
+	m.Lock()
+	defer m.Unlock()
+	m.stats.Containers = count
+}
+
+// registryMetrics is a WatcherMetrics reporting to a metrics registry, labeled by the name of the
+// watcher
+type registryMetrics struct {
+	watcher    string
+	events     metrics.Counter
+	reconnects metrics.Counter
+	listErrors metrics.Counter
+	containers metrics.Gauge
+}
+
+// NewRegistryMetrics creates a WatcherMetrics reporting the metrics of the watcher with the given
+// name to a metrics registry, several watchers can report to the same registry
+func NewRegistryMetrics(r metrics.Registry, watcher string) WatcherMetrics {
+	return &registryMetrics{
+		watcher:    watcher,
+		events:     r.Counter("autodiscover_docker_events_total", "Docker events received, per action.", "watcher", "action"),
+		reconnects: r.Counter("autodiscover_docker_reconnects_total", "Reconnections of the docker events stream.", "watcher"),
+		listErrors: r.Counter("autodiscover_docker_list_errors_total", "Failed docker container list requests.", "watcher"),
+		containers: r.Gauge("autodiscover_docker_containers", "Docker containers tracked by the watcher.", "watcher"),
+	}
+}
+
+func (m *registryMetrics) EventReceived(action string) { m.events.Add(1, m.watcher, action) }
+func (m *registryMetrics) Reconnected()                { m.reconnects.Add(1, m.watcher) }
+func (m *registryMetrics) ListFailed()                 { m.listErrors.Add(1, m.watcher) }
+func (m *registryMetrics) ContainersTracked(count int) { m.containers.Set(float64(count), m.watcher) }
+
+// noopMetrics is used when no metrics are configured
+type noopMetrics struct{}
+
+func (noopMetrics) EventReceived(string)  {}
+func (noopMetrics) Reconnected()          {}
+func (noopMetrics) ListFailed()           {}
+func (noopMetrics) ContainersTracked(int) {}
+
+// trackContainers reports the number of known containers, it must be called with the lock held
+func (w *watcher) trackContainers() {
+	count := 0
+	for key, c := range w.containers {
+		if key == c.ID {
+			count++
+		}
+	}
+	w.metrics.ContainersTracked(count)
+}
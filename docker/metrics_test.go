@@ -0,0 +1,116 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-autodiscover/metrics"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+func TestWatcherMetrics(t *testing.T) {
+	require.NoError(t, logp.TestingSetup())
+
+	client := &MockClient{
+		containers: [][]types.Container{
+			{
+				{ID: "0332dbd79e20", Names: []string{"/web"}, Image: "nginx", NetworkSettings: &types.SummaryNetworkSettings{}},
+			},
+			{
+				{ID: "6c9a82bf1c4d", Names: []string{"/worker"}, Image: "nginx", NetworkSettings: &types.SummaryNetworkSettings{}},
+			},
+			// Reconciling list after reconnecting
+			{
+				{ID: "6c9a82bf1c4d", Names: []string{"/worker"}, Image: "nginx", NetworkSettings: &types.SummaryNetworkSettings{}},
+			},
+		},
+		events: []interface{}{
+			events.Message{Action: "start", Actor: events.Actor{ID: "6c9a82bf1c4d"}},
+			events.Message{Action: "oom", Actor: events.Actor{ID: "0332dbd79e20"}},
+			events.Message{Action: "die", Actor: events.Actor{ID: "0332dbd79e20"}},
+			errors.New("connection reset by peer"),
+		},
+		done: make(chan interface{}),
+	}
+
+	metrics := NewMetrics()
+	w, err := NewWatcherWithClientOptions(logp.L(), client, WatcherOptions{Metrics: metrics})
+	require.NoError(t, err)
+	watcher := w.(*watcher)
+	watcher.minBackoff = time.Millisecond
+	clock := newTestClock()
+	watcher.clock = clock
+
+	require.NoError(t, watcher.Start())
+	defer watcher.Stop()
+	<-client.done
+
+	assert.Eventually(t, func() bool {
+		return metrics.Stats().Reconnects == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	stats := metrics.Stats()
+	assert.Equal(t, map[string]int64{"start": 1, "oom": 1, "die": 1}, stats.Events)
+	assert.Equal(t, int64(0), stats.ListErrors)
+	// The stopped container is tracked until it is cleaned up
+	assert.Equal(t, 2, stats.Containers)
+
+	clock.Sleep(2 * watcher.cleanupTimeout)
+	watcher.runCleanup()
+	assert.Equal(t, 1, metrics.Stats().Containers)
+}
+
+func TestRegistryMetrics(t *testing.T) {
+	registry := metrics.NewInMemory()
+	m := NewRegistryMetrics(registry, "local")
+	m.EventReceived("start")
+	m.EventReceived("start")
+	m.Reconnected()
+	m.ListFailed()
+	m.ContainersTracked(3)
+
+	// Watchers reporting to the same registry are labeled by their names
+	NewRegistryMetrics(registry, "remote").ContainersTracked(5)
+
+	for _, v := range []struct {
+		name     string
+		labels   []string
+		expected float64
+	}{
+		{"autodiscover_docker_events_total", []string{"local", "start"}, 2},
+		{"autodiscover_docker_reconnects_total", []string{"local"}, 1},
+		{"autodiscover_docker_list_errors_total", []string{"local"}, 1},
+		{"autodiscover_docker_containers", []string{"local"}, 3},
+		{"autodiscover_docker_containers", []string{"remote"}, 5},
+	} {
+		value, ok := registry.Value(v.name, v.labels...)
+		assert.True(t, ok, v.name)
+		assert.Equal(t, v.expected, value, v.name)
+	}
+}
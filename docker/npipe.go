@@ -0,0 +1,57 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// npipeScheme is the scheme of the named pipe endpoints of the daemon on Windows, e.g.
+// "npipe:////./pipe/docker_engine"
+const npipeScheme = "npipe://"
+
+// normalizeHost translates Windows named pipe paths to the npipe endpoints understood by the
+// docker client. The pipe can be given as a path, like `\\.\pipe\docker_engine`, or as an npipe
+// endpoint using backslashes or missing the leading slashes of the pipe path.
+func normalizeHost(host string) string {
+	if strings.HasPrefix(host, `\\`) {
+		host = npipeScheme + host
+	}
+	if !strings.HasPrefix(host, npipeScheme) {
+		return host
+	}
+
+	path := strings.ReplaceAll(strings.TrimPrefix(host, npipeScheme), `\`, "/")
+	if !strings.HasPrefix(path, "//") {
+		path = "//" + strings.TrimPrefix(path, "/")
+	}
+	return npipeScheme + path
+}
+
+// validateHost returns an error if the host uses a transport not available in this platform
+func validateHost(host string) error {
+	if strings.HasPrefix(host, npipeScheme) && runtime.GOOS != "windows" {
+		return fmt.Errorf("named pipe docker host %s is only supported on windows", host)
+	}
+	return nil
+}
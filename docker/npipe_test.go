@@ -0,0 +1,53 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeHost(t *testing.T) {
+	for host, expected := range map[string]string{
+		"npipe:////./pipe/docker_engine":   "npipe:////./pipe/docker_engine",
+		"npipe://./pipe/docker_engine":     "npipe:////./pipe/docker_engine",
+		`npipe://\\.\pipe\docker_engine`:   "npipe:////./pipe/docker_engine",
+		`\\.\pipe\docker_engine`:           "npipe:////./pipe/docker_engine",
+		`\\build-host\pipe\docker_engine`:  "npipe:////build-host/pipe/docker_engine",
+		"unix:///var/run/docker.sock":      "unix:///var/run/docker.sock",
+		"tcp://docker.example.com:2376":    "tcp://docker.example.com:2376",
+		"npipe:///./pipe/podman-machine-0": "npipe:////./pipe/podman-machine-0",
+	} {
+		assert.Equal(t, expected, normalizeHost(host), host)
+	}
+}
+
+func TestValidateHost(t *testing.T) {
+	assert.NoError(t, validateHost("unix:///var/run/docker.sock"))
+	assert.NoError(t, validateHost("tcp://docker.example.com:2376"))
+	if runtime.GOOS == "windows" {
+		assert.NoError(t, validateHost("npipe:////./pipe/docker_engine"))
+	} else {
+		assert.Error(t, validateHost("npipe:////./pipe/docker_engine"))
+	}
+}
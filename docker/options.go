@@ -0,0 +1,132 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types/filters"
+)
+
+// watchedActions are the container event actions the watcher relies on, they are always requested
+// when filtering events by action
+var watchedActions = []string{"start", "update", "die", healthStatusAction, pauseAction, unpauseAction, oomAction}
+
+// WatcherOptions configures a docker watcher
+type WatcherOptions struct {
+	// Hosts are the candidate endpoints tried in order when no host is configured, the first
+	// available one is used. If empty, the DefaultHosts are tried.
+	Hosts []string `config:"hosts"`
+
+	// APIVersion pins the version of the docker API, e.g. "1.41". If the daemon doesn't support
+	// it the version is negotiated. If empty, the DOCKER_API_VERSION environment variable is used,
+	// or the version is negotiated.
+	APIVersion string `config:"api_version"`
+
+	// CleanupTimeout is the time stopped containers are kept after they are last accessed
+	CleanupTimeout time.Duration `config:"cleanup_timeout"`
+
+	// StoppedRetention is the minimum time the metadata of stopped containers is kept after they
+	// stop, even if it is not accessed, so the logs written right before exiting can still be
+	// enriched
+	StoppedRetention time.Duration `config:"stopped_retention"`
+
+	// StoreShortID makes containers also accessible by their short ID
+	StoreShortID bool `config:"store_short_id"`
+
+	// InspectContainers makes the watcher inspect every container to add the metadata not
+	// returned by the list API, like the restart policy, the resource limits and the image digest
+	InspectContainers bool `config:"inspect_containers"`
+
+	// Metrics receives the metrics of the watcher, if set
+	Metrics WatcherMetrics `config:"-"`
+
+	// OnDrop is called when events may have been lost, if set
+	OnDrop DropHandler `config:"-"`
+
+	// EventsFilter is pushed to the daemon so only the relevant events are received
+	EventsFilter EventsFilter `config:"events_filter"`
+
+	// List configures the listing of containers
+	List ListOptions `config:"list"`
+}
+
+// Validate the watcher options
+func (o *WatcherOptions) Validate() error {
+	if o.CleanupTimeout < 0 {
+		return fmt.Errorf("cleanup_timeout must not be negative, got %v", o.CleanupTimeout)
+	}
+	if o.APIVersion != "" {
+		if err := validateAPIVersion(o.APIVersion); err != nil {
+			return err
+		}
+	}
+	if o.StoppedRetention < 0 {
+		return fmt.Errorf("stopped_retention must not be negative, got %v", o.StoppedRetention)
+	}
+	return o.List.Validate()
+}
+
+// EventsFilter configures the filters of docker events applied by the daemon. The same label and
+// image filters are applied when listing containers so the watcher only knows about the containers
+// it receives events for.
+type EventsFilter struct {
+	// Labels the containers must have, all of them, as "key" or "key=value"
+	Labels []string `config:"labels"`
+
+	// Images of the containers, any of them
+	Images []string `config:"images"`
+
+	// Actions of the events to receive, e.g. "oom". The actions the watcher needs to track
+	// containers are always included.
+	Actions []string `config:"actions"`
+}
+
+// eventsArgs returns the filters of the events API
+func (f EventsFilter) eventsArgs() filters.Args {
+	args := filters.NewArgs()
+	args.Add("type", "container")
+	for _, label := range f.Labels {
+		args.Add("label", label)
+	}
+	for _, image := range f.Images {
+		args.Add("image", image)
+	}
+	if len(f.Actions) > 0 {
+		for _, action := range append(watchedActions, f.Actions...) {
+			args.Add("event", action)
+		}
+	}
+	return args
+}
+
+// listArgs returns the filters of the container list API matching the events filters
+func (f EventsFilter) listArgs() filters.Args {
+	args := filters.NewArgs()
+	for _, label := range f.Labels {
+		args.Add("label", label)
+	}
+	for _, image := range f.Images {
+		args.Add("ancestor", image)
+	}
+	return args
+}
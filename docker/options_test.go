@@ -0,0 +1,103 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+func TestEventsFilter(t *testing.T) {
+	cfg, err := config.NewConfigFrom(map[string]interface{}{
+		"labels":  []string{"co.elastic.logs/enabled=true", "team"},
+		"images":  []string{"nginx"},
+		"actions": []string{"oom"},
+	})
+	require.NoError(t, err)
+	var filter EventsFilter
+	require.NoError(t, cfg.Unpack(&filter))
+
+	events := filter.eventsArgs()
+	assert.ElementsMatch(t, []string{"container"}, events.Get("type"))
+	assert.ElementsMatch(t, []string{"co.elastic.logs/enabled=true", "team"}, events.Get("label"))
+	assert.ElementsMatch(t, []string{"nginx"}, events.Get("image"))
+	assert.ElementsMatch(t, []string{"start", "update", "die", "health_status", "pause", "unpause", "oom"}, events.Get("event"))
+
+	list := filter.listArgs()
+	assert.ElementsMatch(t, []string{"co.elastic.logs/enabled=true", "team"}, list.Get("label"))
+	assert.ElementsMatch(t, []string{"nginx"}, list.Get("ancestor"))
+
+	// No action filter by default, all container events are received
+	assert.Empty(t, EventsFilter{}.eventsArgs().Get("event"))
+}
+
+func TestWatcherOptionsConfig(t *testing.T) {
+	cfg, err := config.NewConfigFrom(map[string]interface{}{
+		"cleanup_timeout":   "2m",
+		"stopped_retention": "30s",
+		"store_short_id":    true,
+		"events_filter": map[string]interface{}{
+			"labels": []string{"team"},
+		},
+	})
+	require.NoError(t, err)
+	var opts WatcherOptions
+	require.NoError(t, cfg.Unpack(&opts))
+	assert.Equal(t, WatcherOptions{
+		CleanupTimeout:   2 * time.Minute,
+		StoppedRetention: 30 * time.Second,
+		StoreShortID:     true,
+		EventsFilter:     EventsFilter{Labels: []string{"team"}},
+	}, opts)
+
+	cfg, err = config.NewConfigFrom(map[string]interface{}{"stopped_retention": "-1s"})
+	require.NoError(t, err)
+	assert.Error(t, cfg.Unpack(&opts))
+
+	_, err = NewWatcherWithClientOptions(logp.L(), &MockClient{}, WatcherOptions{CleanupTimeout: -time.Second})
+	assert.Error(t, err)
+}
+
+func TestWatcherWithEventsFilter(t *testing.T) {
+	require.NoError(t, logp.TestingSetup())
+	client := &MockClient{
+		containers: [][]types.Container{{}},
+		done:       make(chan interface{}),
+	}
+	w, err := NewWatcherWithClientOptions(logp.L(), client, WatcherOptions{
+		EventsFilter: EventsFilter{Labels: []string{"team=a"}},
+	})
+	require.NoError(t, err)
+	runAndWait(w.(*watcher), client.done)
+
+	require.NotEmpty(t, client.listOptions)
+	assert.Equal(t, []string{"team=a"}, client.listOptions[0].Filters.Get("label"))
+	require.NotEmpty(t, client.eventsOptions)
+	assert.Equal(t, []string{"team=a"}, client.eventsOptions[0].Filters.Get("label"))
+	assert.Equal(t, defaultCleanupTimeout, w.(*watcher).cleanupTimeout)
+}
@@ -0,0 +1,94 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+const (
+	// podmanRootfulSocket is the Docker-compatible socket of Podman when running as root
+	podmanRootfulSocket = "/run/podman/podman.sock"
+
+	// podmanEngineComponent is the name of the engine component reported by Podman in the version endpoint
+	podmanEngineComponent = "Podman Engine"
+)
+
+// PodmanHosts returns the candidate endpoints of the Docker-compatible API served by Podman, the
+// rootful socket first and then the rootless one of the current user.
+func PodmanHosts() []string {
+	hosts := []string{"unix://" + podmanRootfulSocket}
+
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = fmt.Sprintf("/run/user/%d", os.Getuid())
+	}
+	return append(hosts, "unix://"+filepath.Join(runtimeDir, "podman", "podman.sock"))
+}
+
+// isPodman returns true if the version reported by the daemon belongs to Podman
+func isPodman(version types.Version) bool {
+	for _, component := range version.Components {
+		if component.Name == podmanEngineComponent {
+			return true
+		}
+	}
+	return strings.Contains(strings.ToLower(version.Platform.Name), "podman")
+}
+
+// serverVersioner retrieves the version of the daemon
+type serverVersioner interface {
+	ServerVersion(ctx context.Context) (types.Version, error)
+}
+
+// detectPodman returns true if the client is connected to Podman
+func detectPodman(ctx context.Context, c serverVersioner) bool {
+	version, err := c.ServerVersion(ctx)
+	return err == nil && isPodman(version)
+}
+
+// normalizeAction translates the event actions of Podman that differ from the Docker ones, and
+// removes the status from health_status actions
+func normalizeAction(action string) string {
+	switch {
+	case action == "died":
+		return "die"
+	case strings.HasPrefix(action, healthStatusAction):
+		return healthStatusAction
+	default:
+		return action
+	}
+}
+
+// containerName returns the first name of a container without the leading slash, Podman
+// doesn't always prefix names with it
+func containerName(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(names[0], "/")
+}
@@ -0,0 +1,102 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcherPodmanQuirks(t *testing.T) {
+	watcher := runAndWait(testWatcher(t,
+		[][]types.Container{
+			[]types.Container{
+				types.Container{
+					ID:              "0332dbd79e20",
+					Names:           []string{"containername"},
+					Image:           "docker.io/library/busybox:latest",
+					NetworkSettings: &types.SummaryNetworkSettings{},
+				},
+			},
+		},
+		[]interface{}{
+			events.Message{
+				Type:   "container",
+				Action: "died",
+				Actor: events.Actor{
+					ID:         "0332dbd79e20",
+					Attributes: map[string]string{"name": "containername", "podId": ""},
+				},
+			},
+		},
+	))
+
+	assert.Equal(t, map[string]*Container{
+		"0332dbd79e20": &Container{
+			ID:     "0332dbd79e20",
+			Name:   "containername",
+			Image:  "docker.io/library/busybox:latest",
+			Labels: map[string]string{},
+			State:  StateExited,
+			// Not inspected and no exit code in the event
+			Termination: &ContainerTermination{},
+		},
+	}, watcher.Containers())
+	assert.Len(t, watcher.deleted, 1)
+}
+
+func TestIsPodman(t *testing.T) {
+	assert.True(t, isPodman(types.Version{Components: []types.ComponentVersion{{Name: "Podman Engine", Version: "4.3.1"}}}))
+	assert.False(t, isPodman(types.Version{Components: []types.ComponentVersion{{Name: "Engine", Version: "20.10.17"}}}))
+}
+
+func TestResolveHostPodman(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets not available")
+	}
+	if socketExists(client.DefaultDockerHost) || socketExists("unix://"+podmanRootfulSocket) {
+		t.Skip("docker or rootful podman socket present in the host")
+	}
+
+	runtimeDir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+	t.Setenv("HOME", t.TempDir())
+	assert.Equal(t, client.DefaultDockerHost, resolveHost(client.DefaultDockerHost, nil))
+
+	socket := filepath.Join(runtimeDir, "podman", "podman.sock")
+	require.NoError(t, os.MkdirAll(filepath.Dir(socket), 0o700))
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	defer l.Close()
+
+	assert.Equal(t, "unix://"+socket, resolveHost(client.DefaultDockerHost, nil))
+	// Explicitly configured hosts are not replaced
+	assert.Equal(t, "tcp://docker:2375", resolveHost("tcp://docker:2375", nil))
+}
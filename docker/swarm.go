@@ -0,0 +1,313 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// Labels set by Swarm in the containers of its tasks, and by docker stack deploy in its services
+const (
+	swarmServiceIDLabel   = "com.docker.swarm.service.id"
+	swarmServiceNameLabel = "com.docker.swarm.service.name"
+	swarmTaskIDLabel      = "com.docker.swarm.task.id"
+	swarmTaskNameLabel    = "com.docker.swarm.task.name"
+	swarmNodeIDLabel      = "com.docker.swarm.node.id"
+	stackNamespaceLabel   = "com.docker.stack.namespace"
+)
+
+// SwarmClient for the swarm endpoints of the docker API
+type SwarmClient interface {
+	ServiceList(ctx context.Context, options types.ServiceListOptions) ([]swarm.Service, error)
+	TaskList(ctx context.Context, options types.TaskListOptions) ([]swarm.Task, error)
+	Events(ctx context.Context, options types.EventsOptions) (<-chan events.Message, <-chan error)
+}
+
+// Task of a swarm service retrieved by the swarm watcher
+type Task struct {
+	ID             string
+	ServiceID      string
+	ServiceName    string
+	StackNamespace string
+	Slot           int // 0 for tasks of global services
+	NodeID         string
+	ContainerID    string
+	Labels         map[string]string // labels of the service
+}
+
+// SwarmWatcher watches the services of a swarm and keeps a list of their running tasks. It must
+// run against a manager node.
+type SwarmWatcher interface {
+	// Start watching the swarm for new tasks
+	Start() error
+
+	// Stop watching the swarm
+	Stop()
+
+	// Tasks returns the running tasks, by ID
+	Tasks() map[string]*Task
+
+	// ListenStart returns a bus listener to receive task started events, with a `task` key holding it
+	ListenStart() bus.Listener
+
+	// ListenStop returns a bus listener to receive task stopped events, with a `task` key holding it
+	ListenStop() bus.Listener
+}
+
+type swarmWatcher struct {
+	sync.RWMutex
+	log     *logp.Logger
+	client  SwarmClient
+	period  time.Duration
+	ctx     context.Context
+	stop    context.CancelFunc
+	tasks   map[string]*Task
+	stopped sync.WaitGroup
+	bus     bus.Bus
+}
+
+// NewSwarmWatcher creates a SwarmWatcher that reconciles the running tasks on service and node
+// events, and every period as tasks don't have events on their own.
+func NewSwarmWatcher(log *logp.Logger, client SwarmClient, period time.Duration) (SwarmWatcher, error) {
+	if period <= 0 {
+		return nil, errors.New("swarm resync period must be positive")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &swarmWatcher{
+		log:    log,
+		client: client,
+		period: period,
+		ctx:    ctx,
+		stop:   cancel,
+		tasks:  make(map[string]*Task),
+		bus:    bus.New(log, "docker-swarm"),
+	}, nil
+}
+
+// Tasks returns the running tasks, by ID
+func (w *swarmWatcher) Tasks() map[string]*Task {
+	w.RLock()
+	defer w.RUnlock()
+	res := make(map[string]*Task, len(w.tasks))
+	for k, v := range w.tasks {
+		res[k] = v
+	}
+	return res
+}
+
+// Start watching the swarm for new tasks
+func (w *swarmWatcher) Start() error {
+	w.log.Debug("Start docker swarm tasks scanner")
+	if err := w.reconcile(); err != nil {
+		return err
+	}
+	w.stopped.Add(1)
+	go w.watch()
+	return nil
+}
+
+// Stop watching the swarm
+func (w *swarmWatcher) Stop() {
+	w.stop()
+	w.stopped.Wait()
+}
+
+func (w *swarmWatcher) watch() {
+	defer w.stopped.Done()
+
+	filter := filters.NewArgs()
+	filter.Add("type", "service")
+	filter.Add("type", "node")
+
+	ticker := time.NewTicker(w.period)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithCancel(w.ctx)
+		events, errs := w.client.Events(ctx, types.EventsOptions{Filters: filter})
+
+	loop:
+		for {
+			select {
+			case event := <-events:
+				w.log.Debugf("Got a new docker swarm event: %v", event)
+				if err := w.reconcile(); err != nil {
+					w.log.Errorf("Error listing swarm tasks: %v", err)
+				}
+			case <-ticker.C:
+				if err := w.reconcile(); err != nil {
+					w.log.Errorf("Error listing swarm tasks: %v", err)
+				}
+			case err := <-errs:
+				if errors.Is(err, context.Canceled) {
+					cancel()
+					return
+				}
+				if !errors.Is(err, io.EOF) {
+					w.log.Errorf("Error watching for docker swarm events: %+v", err)
+				}
+				break loop
+			case <-w.ctx.Done():
+				cancel()
+				w.log.Debug("Swarm watcher stopped")
+				return
+			}
+		}
+		cancel()
+
+		// Wait before trying to reconnect
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// reconcile lists the running tasks and publishes the events of the ones that started or stopped
+// since the previous listing
+func (w *swarmWatcher) reconcile() error {
+	ctx, cancel := context.WithTimeout(w.ctx, dockerRequestTimeout)
+	defer cancel()
+
+	services, err := w.client.ServiceList(ctx, types.ServiceListOptions{})
+	if err != nil {
+		return err
+	}
+	byID := make(map[string]swarm.Service, len(services))
+	for _, s := range services {
+		byID[s.ID] = s
+	}
+
+	filter := filters.NewArgs()
+	filter.Add("desired-state", "running")
+	list, err := w.client.TaskList(ctx, types.TaskListOptions{Filters: filter})
+	if err != nil {
+		return err
+	}
+
+	running := make(map[string]*Task, len(list))
+	for _, t := range list {
+		if t.Status.State != swarm.TaskStateRunning {
+			continue
+		}
+		task := &Task{
+			ID:        t.ID,
+			ServiceID: t.ServiceID,
+			Slot:      t.Slot,
+			NodeID:    t.NodeID,
+		}
+		if t.Status.ContainerStatus != nil {
+			task.ContainerID = t.Status.ContainerStatus.ContainerID
+		}
+		if service, ok := byID[t.ServiceID]; ok {
+			task.ServiceName = service.Spec.Name
+			task.StackNamespace = service.Spec.Labels[stackNamespaceLabel]
+			task.Labels = service.Spec.Labels
+		}
+		running[task.ID] = task
+	}
+
+	var started, stopped []*Task
+	w.Lock()
+	for id, t := range running {
+		if _, ok := w.tasks[id]; !ok {
+			started = append(started, t)
+		}
+	}
+	for id, t := range w.tasks {
+		if _, ok := running[id]; !ok {
+			stopped = append(stopped, t)
+		}
+	}
+	w.tasks = running
+	w.Unlock()
+
+	for _, t := range stopped {
+		w.bus.Publish(bus.Event{"stop": true, "task": t})
+	}
+	for _, t := range started {
+		w.bus.Publish(bus.Event{"start": true, "task": t})
+	}
+	return nil
+}
+
+// ListenStart returns a bus listener to receive task started events, with a `task` key holding it
+func (w *swarmWatcher) ListenStart() bus.Listener {
+	return w.bus.Subscribe("start")
+}
+
+// ListenStop returns a bus listener to receive task stopped events, with a `task` key holding it
+func (w *swarmWatcher) ListenStop() bus.Listener {
+	return w.bus.Subscribe("stop")
+}
+
+// SwarmMetadata returns the swarm service, task, node and stack of a container from the labels
+// set by Swarm, to be stored under `docker.swarm`. It returns nil for containers not created by
+// Swarm.
+func SwarmMetadata(labels map[string]string) mapstr.M {
+	serviceName, ok := labels[swarmServiceNameLabel]
+	if !ok {
+		return nil
+	}
+
+	service := mapstr.M{"name": serviceName}
+	putIfNotEmpty(service, "id", labels[swarmServiceIDLabel])
+	meta := mapstr.M{"service": service}
+
+	task := mapstr.M{}
+	putIfNotEmpty(task, "id", labels[swarmTaskIDLabel])
+	taskName := labels[swarmTaskNameLabel]
+	putIfNotEmpty(task, "name", taskName)
+	// Task names are <service>.<slot>.<task id> for replicated services, and
+	// <service>.<node id>.<task id> for global ones
+	if parts := strings.Split(strings.TrimPrefix(taskName, serviceName+"."), "."); len(parts) == 2 {
+		if slot, err := strconv.Atoi(parts[0]); err == nil {
+			task["slot"] = slot
+		}
+	}
+	if len(task) > 0 {
+		meta["task"] = task
+	}
+
+	if nodeID := labels[swarmNodeIDLabel]; nodeID != "" {
+		meta["node"] = mapstr.M{"id": nodeID}
+	}
+	if stack := labels[stackNamespaceLabel]; stack != "" {
+		meta["stack"] = mapstr.M{"namespace": stack}
+	}
+	return meta
+}
@@ -0,0 +1,146 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type mockSwarmClient struct {
+	sync.Mutex
+	services []swarm.Service
+	tasks    []swarm.Task
+	events   chan events.Message
+}
+
+func (m *mockSwarmClient) ServiceList(ctx context.Context, options types.ServiceListOptions) ([]swarm.Service, error) {
+	m.Lock()
+	defer m.Unlock()
+	return m.services, nil
+}
+
+func (m *mockSwarmClient) TaskList(ctx context.Context, options types.TaskListOptions) ([]swarm.Task, error) {
+	m.Lock()
+	defer m.Unlock()
+	return m.tasks, nil
+}
+
+func (m *mockSwarmClient) Events(ctx context.Context, options types.EventsOptions) (<-chan events.Message, <-chan error) {
+	return m.events, make(chan error)
+}
+
+func (m *mockSwarmClient) setTasks(tasks ...swarm.Task) {
+	m.Lock()
+	defer m.Unlock()
+	m.tasks = tasks
+}
+
+func runningTask(id, service string, slot int) swarm.Task {
+	return swarm.Task{
+		ID:        id,
+		ServiceID: service,
+		Slot:      slot,
+		NodeID:    "node1",
+		Status: swarm.TaskStatus{
+			State:           swarm.TaskStateRunning,
+			ContainerStatus: &swarm.ContainerStatus{ContainerID: "c-" + id},
+		},
+	}
+}
+
+func TestSwarmWatcher(t *testing.T) {
+	require.NoError(t, logp.TestingSetup())
+
+	service := swarm.Service{ID: "s1"}
+	service.Spec.Name = "shop_web"
+	service.Spec.Labels = map[string]string{"com.docker.stack.namespace": "shop"}
+	client := &mockSwarmClient{
+		services: []swarm.Service{service},
+		events:   make(chan events.Message),
+	}
+	client.setTasks(runningTask("t1", "s1", 1))
+
+	// Long period so only events trigger reconciliations
+	w, err := NewSwarmWatcher(logp.L(), client, time.Hour)
+	require.NoError(t, err)
+	start := w.ListenStart()
+	stop := w.ListenStop()
+	require.NoError(t, w.Start())
+	defer w.Stop()
+
+	event := <-start.Events()
+	assert.Equal(t, &Task{
+		ID:             "t1",
+		ServiceID:      "s1",
+		ServiceName:    "shop_web",
+		StackNamespace: "shop",
+		Slot:           1,
+		NodeID:         "node1",
+		ContainerID:    "c-t1",
+		Labels:         map[string]string{"com.docker.stack.namespace": "shop"},
+	}, event["task"])
+
+	// Scale up and replace the first task
+	client.setTasks(runningTask("t2", "s1", 1), runningTask("t3", "s1", 2))
+	client.events <- events.Message{Type: "service", Action: "update", Actor: events.Actor{ID: "s1"}}
+
+	assert.Equal(t, "t1", (<-stop.Events())["task"].(*Task).ID)
+	started := []string{(<-start.Events())["task"].(*Task).ID, (<-start.Events())["task"].(*Task).ID}
+	assert.ElementsMatch(t, []string{"t2", "t3"}, started)
+	assert.Len(t, w.Tasks(), 2)
+}
+
+func TestSwarmMetadata(t *testing.T) {
+	assert.Nil(t, SwarmMetadata(map[string]string{"foo": "bar"}))
+
+	assert.Equal(t, mapstr.M{
+		"service": mapstr.M{"name": "shop_web", "id": "s1"},
+		"task":    mapstr.M{"id": "t1", "name": "shop_web.2.t1", "slot": 2},
+		"node":    mapstr.M{"id": "node1"},
+		"stack":   mapstr.M{"namespace": "shop"},
+	}, SwarmMetadata(map[string]string{
+		"com.docker.swarm.service.name": "shop_web",
+		"com.docker.swarm.service.id":   "s1",
+		"com.docker.swarm.task.id":      "t1",
+		"com.docker.swarm.task.name":    "shop_web.2.t1",
+		"com.docker.swarm.node.id":      "node1",
+		"com.docker.stack.namespace":    "shop",
+	}))
+
+	// Tasks of global services have no slot
+	meta := SwarmMetadata(map[string]string{
+		"com.docker.swarm.service.name": "agent",
+		"com.docker.swarm.task.name":    "agent.node1.t1",
+	})
+	assert.Equal(t, mapstr.M{"name": "agent.node1.t1"}, meta["task"])
+}
@@ -0,0 +1,86 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/tlsconfig"
+)
+
+// newHTTPClient returns the HTTP client to connect to the daemon with TLS, or nil to use the
+// default one if tls is nil
+func newHTTPClient(tls *TLSConfig) (*http.Client, error) {
+	if tls == nil {
+		return nil, nil
+	}
+
+	options := tlsconfig.Options{
+		CAFile:             tls.CA,
+		CertFile:           tls.Certificate,
+		KeyFile:            tls.Key,
+		InsecureSkipVerify: tls.InsecureSkipVerify,
+	}
+
+	tlsc, err := tlsconfig.Client(options)
+	if err != nil {
+		return nil, err
+	}
+	if tls.ServerName != "" {
+		tlsc.ServerName = tls.ServerName
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: tlsc,
+		},
+	}, nil
+}
+
+// hostFromEnv returns the host to connect to, if none is configured the one of the DOCKER_HOST
+// environment variable is used, like the docker CLI does
+func hostFromEnv(host string) string {
+	if host != "" {
+		return normalizeHost(host)
+	}
+	if envHost := os.Getenv("DOCKER_HOST"); envHost != "" {
+		return normalizeHost(envHost)
+	}
+	return client.DefaultDockerHost
+}
+
+// tlsFromEnv returns the TLS config set with the DOCKER_CERT_PATH and DOCKER_TLS_VERIFY
+// environment variables, or nil if they are not set
+func tlsFromEnv() *TLSConfig {
+	certPath := os.Getenv("DOCKER_CERT_PATH")
+	if certPath == "" {
+		return nil
+	}
+	return &TLSConfig{
+		CA:                 filepath.Join(certPath, "ca.pem"),
+		Certificate:        filepath.Join(certPath, "cert.pem"),
+		Key:                filepath.Join(certPath, "key.pem"),
+		InsecureSkipVerify: os.Getenv("DOCKER_TLS_VERIFY") == "",
+	}
+}
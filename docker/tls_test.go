@@ -0,0 +1,91 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+func TestHostFromEnv(t *testing.T) {
+	t.Setenv("DOCKER_HOST", "")
+	assert.Equal(t, client.DefaultDockerHost, hostFromEnv(""))
+	assert.Equal(t, "tcp://docker:2376", hostFromEnv("tcp://docker:2376"))
+
+	t.Setenv("DOCKER_HOST", "tcp://remote:2376")
+	assert.Equal(t, "tcp://remote:2376", hostFromEnv(""))
+	assert.Equal(t, "unix:///var/run/docker.sock", hostFromEnv("unix:///var/run/docker.sock"))
+}
+
+func TestTLSFromEnv(t *testing.T) {
+	t.Setenv("DOCKER_CERT_PATH", "")
+	assert.Nil(t, tlsFromEnv())
+
+	t.Setenv("DOCKER_CERT_PATH", "/certs")
+	t.Setenv("DOCKER_TLS_VERIFY", "1")
+	assert.Equal(t, &TLSConfig{
+		CA:          filepath.Join("/certs", "ca.pem"),
+		Certificate: filepath.Join("/certs", "cert.pem"),
+		Key:         filepath.Join("/certs", "key.pem"),
+	}, tlsFromEnv())
+}
+
+func TestNewWatcherRemoteTLS(t *testing.T) {
+	require.NoError(t, logp.TestingSetup())
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/_ping":
+			w.Header().Set("Api-Version", "1.41")
+		case strings.HasSuffix(r.URL.Path, "/info"):
+			_, _ = w.Write([]byte(`{"ID":"remote"}`))
+		case strings.HasSuffix(r.URL.Path, "/version"):
+			_, _ = w.Write([]byte(`{"Version":"20.10.17","ApiVersion":"1.41"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600))
+	host := "tcp://" + strings.TrimPrefix(server.URL, "https://")
+
+	// The test certificate is valid for example.com
+	w, err := NewWatcherWithOptions(logp.L(), host, &TLSConfig{CA: ca, ServerName: "example.com"}, WatcherOptions{})
+	require.NoError(t, err)
+	assert.NotNil(t, w)
+
+	_, err = NewWatcherWithOptions(logp.L(), host, &TLSConfig{CA: ca, ServerName: "other.example.org"}, WatcherOptions{})
+	assert.Error(t, err)
+}
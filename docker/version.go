@@ -0,0 +1,111 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/docker/docker/client"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+var apiVersionRegexp = regexp.MustCompile(`^[0-9]+\.[0-9]+$`)
+
+// NewClientWithVersion builds and returns a new Docker client pinned to the given API version,
+// e.g. "1.41". If version is empty it behaves like NewClient.
+func NewClientWithVersion(host string, httpClient *http.Client, httpHeaders map[string]string, version string) (*client.Client, error) {
+	return newClientWithVersion(logp.NewLogger("docker"), host, httpClient, httpHeaders, version)
+}
+
+func newClientWithVersion(log *logp.Logger, host string, httpClient *http.Client, httpHeaders map[string]string, version string) (*client.Client, error) {
+	if version == "" {
+		return NewClientWithLogger(log, host, httpClient, httpHeaders)
+	}
+	if err := validateAPIVersion(version); err != nil {
+		return nil, err
+	}
+	return client.NewClientWithOpts(
+		client.WithHost(host),
+		client.WithHTTPClient(httpClient),
+		client.WithHTTPHeaders(httpHeaders),
+		client.WithVersion(version),
+	)
+}
+
+// validateAPIVersion returns an error if version is not a docker API version
+func validateAPIVersion(version string) error {
+	if !apiVersionRegexp.MatchString(version) {
+		return fmt.Errorf("invalid docker API version %q, expected a version like 1.41", version)
+	}
+	return nil
+}
+
+// isAPIVersionError returns true if the daemon rejected a request because of the API version of
+// the client
+func isAPIVersionError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "client version") &&
+		(strings.Contains(msg, "is too new") || strings.Contains(msg, "is too old"))
+}
+
+// connectClient returns a client connected to the daemon, checking that it is available. If the
+// API version is pinned, with the version argument or the DOCKER_API_VERSION environment
+// variable, and the daemon doesn't support it, the version is negotiated instead.
+func connectClient(log *logp.Logger, host string, httpClient *http.Client, version string) (*client.Client, error) {
+	if version == "" {
+		version = os.Getenv("DOCKER_API_VERSION")
+	}
+	c, err := newClientWithVersion(log, host, httpClient, nil, version)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = c.Info(context.Background())
+	if err != nil && version != "" && isAPIVersionError(err) {
+		log.Warnf("Docker API version %s is not supported by the daemon at %s, negotiating the version: %v", version, host, err)
+		c.Close()
+		c, err = client.NewClientWithOpts(
+			client.WithHost(host),
+			client.WithHTTPClient(httpClient),
+			client.WithAPIVersionNegotiation(),
+		)
+		if err != nil {
+			return nil, err
+		}
+		_, err = c.Info(context.Background())
+	}
+	if err != nil {
+		c.Close()
+		if isAPIVersionError(err) {
+			return nil, fmt.Errorf("docker API version %s not supported by the daemon at %s: %w", c.ClientVersion(), host, err)
+		}
+		return nil, err
+	}
+
+	log.Debugf("Connected to docker at %s using API version %s", host, c.ClientVersion())
+	return c, nil
+}
@@ -0,0 +1,105 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package docker
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/versions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// newVersionedDaemon returns a fake daemon supporting API versions up to maxVersion
+func newVersionedDaemon(t *testing.T, maxVersion string) (string, *[]string) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Api-Version", maxVersion)
+		switch {
+		case r.URL.Path == "/_ping":
+		case strings.HasSuffix(r.URL.Path, "/info"):
+			version := strings.TrimPrefix(strings.Split(r.URL.Path, "/")[1], "v")
+			if versions.GreaterThan(version, maxVersion) {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, `{"message":"client version %s is too new. Maximum supported API version is %s"}`, version, maxVersion)
+				return
+			}
+			_, _ = w.Write([]byte(`{"ID":"daemon"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return "tcp://" + strings.TrimPrefix(server.URL, "http://"), &requests
+}
+
+func TestConnectClientPinnedVersion(t *testing.T) {
+	t.Setenv("DOCKER_API_VERSION", "")
+	host, requests := newVersionedDaemon(t, "1.41")
+
+	c, err := connectClient(logp.NewLogger("docker"), host, nil, "1.40")
+	require.NoError(t, err)
+	defer c.Close()
+	assert.Equal(t, "1.40", c.ClientVersion())
+	assert.Equal(t, []string{"/v1.40/info"}, *requests)
+}
+
+func TestConnectClientNegotiationFallback(t *testing.T) {
+	t.Setenv("DOCKER_API_VERSION", "")
+	host, requests := newVersionedDaemon(t, "1.41")
+
+	c, err := connectClient(logp.NewLogger("docker"), host, nil, "1.43")
+	require.NoError(t, err)
+	defer c.Close()
+	assert.Equal(t, "1.41", c.ClientVersion())
+	assert.Equal(t, []string{"/v1.43/info", "/_ping", "/v1.41/info"}, *requests)
+
+	// Version from the environment
+	t.Setenv("DOCKER_API_VERSION", "1.43")
+	c, err = connectClient(logp.NewLogger("docker"), host, nil, "")
+	require.NoError(t, err)
+	defer c.Close()
+	assert.Equal(t, "1.41", c.ClientVersion())
+}
+
+func TestValidateAPIVersion(t *testing.T) {
+	assert.NoError(t, validateAPIVersion("1.41"))
+	assert.Error(t, validateAPIVersion("v1.41"))
+	assert.Error(t, validateAPIVersion("1"))
+
+	_, err := NewClientWithVersion("tcp://docker:2375", nil, nil, "latest")
+	assert.Error(t, err)
+	assert.Error(t, (&WatcherOptions{APIVersion: "1.41.0"}).Validate())
+}
+
+func TestIsAPIVersionError(t *testing.T) {
+	assert.True(t, isAPIVersionError(fmt.Errorf("Error response from daemon: client version 1.43 is too new. Maximum supported API version is 1.41")))
+	assert.True(t, isAPIVersionError(fmt.Errorf("Error response from daemon: client version 1.12 is too old. Minimum supported API version is 1.24, please upgrade your client to a newer version")))
+	assert.False(t, isAPIVersionError(fmt.Errorf("Cannot connect to the Docker daemon")))
+}
@@ -24,14 +24,13 @@ import (
 	"context"
 	"errors"
 	"io"
-	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/api/types/filters"
-	"github.com/docker/go-connections/tlsconfig"
 
 	"github.com/elastic/elastic-agent-autodiscover/bus"
 	"github.com/elastic/elastic-agent-libs/logp"
@@ -43,6 +42,9 @@ const (
 	dockerRequestTimeout               = 10 * time.Second
 	dockerEventsWatchPityTimerInterval = 10 * time.Second
 	dockerEventsWatchPityTimerTimeout  = 10 * time.Minute
+	defaultCleanupTimeout              = 60 * time.Second
+	dockerEventsWatchMinBackoff        = 1 * time.Second
+	dockerEventsWatchMaxBackoff        = 30 * time.Second
 )
 
 // Watcher reads docker events and keeps a list of known containers
@@ -63,14 +65,34 @@ type Watcher interface {
 	ListenStart() bus.Listener
 
 	// ListenStop returns a bus listener to receive container stopped events, with a `container` key holding it
+	// and a `termination` key with its exit code, if reported by the daemon, and termination reason
 	ListenStop() bus.Listener
 }
 
+// LifecycleWatcher is a Watcher also notifying the pause, unpause and out of memory events of
+// containers, the watchers created by this package implement it
+type LifecycleWatcher interface {
+	Watcher
+
+	// ListenPause returns a bus listener to receive container paused events, with a `container` key holding it
+	ListenPause() bus.Listener
+
+	// ListenUnpause returns a bus listener to receive container unpaused events, with a `container` key holding it
+	ListenUnpause() bus.Listener
+
+	// ListenOOM returns a bus listener to receive container out of memory events, with a `container` key holding it
+	ListenOOM() bus.Listener
+}
+
 // TLSConfig for docker socket connection
 type TLSConfig struct {
 	CA          string `config:"certificate_authority"`
 	Certificate string `config:"certificate"`
 	Key         string `config:"key"`
+	// ServerName overrides the name used to verify the certificate of the daemon
+	ServerName string `config:"server_name"`
+	// InsecureSkipVerify disables the verification of the certificate of the daemon
+	InsecureSkipVerify bool `config:"insecure_skip_verify"`
 }
 
 type watcher struct {
@@ -81,11 +103,22 @@ type watcher struct {
 	stop           context.CancelFunc
 	containers     map[string]*Container
 	deleted        map[string]time.Time // deleted annotations key -> last access time
+	stoppedAt      map[string]time.Time // deleted annotations key -> stop time
 	cleanupTimeout time.Duration
+	retention      time.Duration
 	clock          clock
 	stopped        sync.WaitGroup
 	bus            bus.Bus
 	shortID        bool // whether to store short ID in "containers" too
+	eventsFilter   EventsFilter
+	list           ListOptions
+	inspect        bool
+	metrics        WatcherMetrics
+	onDrop         DropHandler
+	minBackoff     time.Duration
+	maxBackoff     time.Duration
+	digestsMutex   sync.Mutex
+	digests        map[string]string // image ID -> digest
 }
 
 // clock is an interface used to provide mocked time on testing
@@ -107,6 +140,31 @@ type Container struct {
 	Labels      map[string]string
 	IPAddresses []string
 	Ports       []types.Port
+	State       string           // running, paused or exited
+	Health      *ContainerHealth // nil for containers without healthcheck
+	Networks    map[string]ContainerNetwork
+	ImageID     string
+	ImageDigest string // empty if the image is not referenced by digest and not inspected
+	Mounts      []ContainerMount
+
+	// RestartPolicy of the container, only set if containers are inspected
+	RestartPolicy *ContainerRestartPolicy
+
+	// Resources limits of the container, only set if containers are inspected and limited
+	Resources *ContainerResources
+
+	// Termination of the container, only set for stopped containers
+	Termination *ContainerTermination
+}
+
+// ContainerNetwork is the attachment of a container to a network
+type ContainerNetwork struct {
+	NetworkID   string
+	IPAddress   string
+	IPv6Address string
+	Gateway     string
+	MacAddress  string
+	Aliases     []string
 }
 
 // Client for docker interface
@@ -121,43 +179,64 @@ type WatcherConstructor func(logp *logp.Logger, host string, tls *TLSConfig, sto
 
 // NewWatcher returns a watcher running for the given settings
 func NewWatcher(log *logp.Logger, host string, tls *TLSConfig, storeShortID bool) (Watcher, error) {
-	var httpClient *http.Client
-	if tls != nil {
-		options := tlsconfig.Options{
-			CAFile:   tls.CA,
-			CertFile: tls.Certificate,
-			KeyFile:  tls.Key,
-		}
-
-		tlsc, err := tlsconfig.Client(options)
-		if err != nil {
-			return nil, err
-		}
+	return NewWatcherWithOptions(log, host, tls, WatcherOptions{
+		CleanupTimeout: defaultCleanupTimeout,
+		StoreShortID:   storeShortID,
+	})
+}
 
-		httpClient = &http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: tlsc,
-			},
-		}
+// NewWatcherWithOptions returns a watcher running for the given host and options
+func NewWatcherWithOptions(log *logp.Logger, host string, tls *TLSConfig, opts WatcherOptions) (Watcher, error) {
+	host = hostFromEnv(host)
+	if resolved := resolveHost(host, opts.Hosts); resolved != host {
+		log.Infof("Docker socket %v not found, using %v", host, resolved)
+		host = resolved
 	}
-
-	client, err := NewClient(host, httpClient, nil)
+	if err := validateHost(host); err != nil {
+		return nil, err
+	}
+	if tls == nil && strings.HasPrefix(host, "tcp://") {
+		tls = tlsFromEnv()
+	}
+	httpClient, err := newHTTPClient(tls)
 	if err != nil {
 		return nil, err
 	}
 
 	// Extra check to confirm that Docker is available
-	_, err = client.Info(context.Background())
+	client, err := connectClient(log, host, httpClient, opts.APIVersion)
 	if err != nil {
-		client.Close()
 		return nil, err
 	}
 
-	return NewWatcherWithClient(log, client, 60*time.Second, storeShortID)
+	ctx, cancel := context.WithTimeout(context.Background(), dockerRequestTimeout)
+	defer cancel()
+	if detectPodman(ctx, client) {
+		log.Info("Docker API is served by Podman")
+	}
+
+	return NewWatcherWithClientOptions(log, client, opts)
 }
 
 // NewWatcherWithClient creates a new Watcher from a given Docker client
 func NewWatcherWithClient(log *logp.Logger, client Client, cleanupTimeout time.Duration, storeShortID bool) (Watcher, error) {
+	return NewWatcherWithClientOptions(log, client, WatcherOptions{
+		CleanupTimeout: cleanupTimeout,
+		StoreShortID:   storeShortID,
+	})
+}
+
+// NewWatcherWithClientOptions creates a new Watcher from a given Docker client and options
+func NewWatcherWithClientOptions(log *logp.Logger, client Client, opts WatcherOptions) (Watcher, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.CleanupTimeout == 0 {
+		opts.CleanupTimeout = defaultCleanupTimeout
+	}
+	if opts.Metrics == nil {
+		opts.Metrics = noopMetrics{}
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 	return &watcher{
 		log:            log,
@@ -166,9 +245,19 @@ func NewWatcherWithClient(log *logp.Logger, client Client, cleanupTimeout time.D
 		stop:           cancel,
 		containers:     make(map[string]*Container),
 		deleted:        make(map[string]time.Time),
-		cleanupTimeout: cleanupTimeout,
+		stoppedAt:      make(map[string]time.Time),
+		cleanupTimeout: opts.CleanupTimeout,
+		retention:      opts.StoppedRetention,
 		bus:            bus.New(log, "docker"),
-		shortID:        storeShortID,
+		shortID:        opts.StoreShortID,
+		eventsFilter:   opts.EventsFilter,
+		list:           opts.List,
+		inspect:        opts.InspectContainers,
+		digests:        make(map[string]string),
+		metrics:        opts.Metrics,
+		onDrop:         opts.OnDrop,
+		minBackoff:     dockerEventsWatchMinBackoff,
+		maxBackoff:     dockerEventsWatchMaxBackoff,
 		clock:          &systemClock{},
 	}, nil
 }
@@ -214,7 +303,7 @@ func (w *watcher) Start() error {
 
 	w.Lock()
 	defer w.Unlock()
-	containers, err := w.listContainers(types.ContainerListOptions{})
+	containers, err := w.listAllContainers()
 	if err != nil {
 		return err
 	}
@@ -225,6 +314,7 @@ func (w *watcher) Start() error {
 			w.containers[c.ID[:shortIDLen]] = c
 		}
 	}
+	w.trackContainers()
 
 	// Emit all start events (avoid blocking if the bus get's blocked)
 	go func() {
@@ -251,16 +341,18 @@ func (w *watcher) Stop() {
 func (w *watcher) watch() {
 	defer w.stopped.Done()
 
-	filter := filters.NewArgs()
-	filter.Add("type", "container")
+	filter := w.eventsFilter.eventsArgs()
 
 	// Ticker to restart the watcher when no events are received after some time.
 	tickChan := time.NewTicker(dockerEventsWatchPityTimerInterval)
 	defer tickChan.Stop()
 
 	lastValidTimestamp := w.clock.Now()
+	backoff := w.minBackoff
 
+	var watchErr error
 	watch := func() bool {
+		watchErr = nil
 		lastReceivedEventTime := w.clock.Now()
 
 		w.log.Debugf("Fetching events since %s", lastValidTimestamp)
@@ -284,12 +376,23 @@ func (w *watcher) watch() {
 					lastValidTimestamp = time.Unix(event.Time, 0)
 				}
 				lastReceivedEventTime = w.clock.Now()
+				backoff = w.minBackoff
 
-				switch event.Action {
+				action := normalizeAction(event.Action)
+				w.metrics.EventReceived(action)
+				switch action {
 				case "start", "update":
 					w.containerUpdate(event)
 				case "die":
 					w.containerDelete(event)
+				case healthStatusAction:
+					w.containerHealth(event)
+				case pauseAction:
+					w.containerState(event, StatePaused, pauseAction)
+				case unpauseAction:
+					w.containerState(event, StateRunning, unpauseAction)
+				case oomAction:
+					w.containerOOM(event)
 				}
 			case err := <-errs:
 				if errors.Is(err, io.EOF) {
@@ -302,6 +405,7 @@ func (w *watcher) watch() {
 					return true
 				} else {
 					w.log.Errorf("Error watching for docker events: %+v", err)
+					watchErr = err
 				}
 				return false
 			case <-tickChan.C:
@@ -321,11 +425,97 @@ func (w *watcher) watch() {
 		if done {
 			return
 		}
-		// Wait before trying to reconnect
-		time.Sleep(1 * time.Second)
+		if watchErr == nil {
+			// The stream ended without errors, like after an EOF or an idle restart, it is resumed
+			// from the last event received so nothing is missed
+			continue
+		}
+
+		// Wait before trying to reconnect, backing off while the daemon keeps failing
+		w.log.Debugf("Reconnecting to docker events in %s", backoff)
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > w.maxBackoff {
+			backoff = w.maxBackoff
+		}
+
+		// Events may be lost while disconnected by an error
+		w.metrics.Reconnected()
+		w.dropped(DroppedEvent{Reason: DropDisconnected, Since: lastValidTimestamp, Err: watchErr})
+		if err := w.reconcile(); err != nil {
+			w.dropped(DroppedEvent{Reason: DropReconcileFailed, Since: lastValidTimestamp, Err: err})
+		}
 	}
 }
 
+// reconcile lists the running containers to recover from the events missed while the events
+// stream was disconnected, publishing start events for the unknown running containers and stop
+// events for the known containers that are not running anymore. It returns the error of the
+// listing if it fails.
+func (w *watcher) reconcile() error {
+	containers, err := w.listAllContainers()
+	if err != nil {
+		w.log.Errorf("Error listing containers to reconcile them: %v", err)
+		return err
+	}
+
+	var started, stopped []*Container
+	running := make(map[string]bool, len(containers))
+
+	w.Lock()
+	for _, c := range containers {
+		running[c.ID] = true
+		_, known := w.containers[c.ID]
+		_, deleted := w.deleted[c.ID]
+		if known && !deleted {
+			continue
+		}
+		w.containers[c.ID] = c
+		if w.shortID {
+			w.containers[c.ID[:shortIDLen]] = c
+		}
+		delete(w.deleted, c.ID)
+		delete(w.stoppedAt, c.ID)
+		started = append(started, c)
+	}
+
+	now := w.clock.Now()
+	for key, c := range w.containers {
+		if key != c.ID || running[c.ID] {
+			continue
+		}
+		if _, deleted := w.deleted[c.ID]; deleted {
+			continue
+		}
+		w.deleted[c.ID] = now
+		w.stoppedAt[c.ID] = now
+		stopped = append(stopped, c)
+	}
+	w.trackContainers()
+	w.Unlock()
+
+	if len(started) > 0 || len(stopped) > 0 {
+		w.log.Infof("Recovered %d started and %d stopped containers after reconnecting to docker events", len(started), len(stopped))
+	}
+	for _, c := range started {
+		w.bus.Publish(bus.Event{
+			"start":     true,
+			"container": c,
+		})
+	}
+	for _, c := range stopped {
+		w.bus.Publish(bus.Event{
+			"stop":      true,
+			"container": c,
+		})
+	}
+	return nil
+}
+
 func (w *watcher) containerUpdate(event events.Message) {
 	filter := filters.NewArgs()
 	filter.Add("id", event.Actor.ID)
@@ -346,6 +536,8 @@ func (w *watcher) containerUpdate(event events.Message) {
 	}
 	// un-delete if it's flagged (in case of update or recreation)
 	delete(w.deleted, event.Actor.ID)
+	delete(w.stoppedAt, event.Actor.ID)
+	w.trackContainers()
 	w.Unlock()
 
 	w.bus.Publish(bus.Event{
@@ -358,15 +550,31 @@ func (w *watcher) containerDelete(event events.Message) {
 	container := w.Container(event.Actor.ID)
 
 	w.Lock()
-	w.deleted[event.Actor.ID] = w.clock.Now()
+	now := w.clock.Now()
+	w.deleted[event.Actor.ID] = now
+	if _, ok := w.stoppedAt[event.Actor.ID]; !ok {
+		w.stoppedAt[event.Actor.ID] = now
+	}
 	w.Unlock()
 
-	if container != nil {
-		w.bus.Publish(bus.Event{
-			"stop":      true,
-			"container": container,
-		})
+	if container == nil {
+		return
 	}
+
+	updated := *container
+	updated.State = StateExited
+	updated.Termination = w.containerTermination(event)
+	w.replaceContainer(&updated)
+
+	e := bus.Event{
+		"stop":        true,
+		"container":   &updated,
+		"termination": updated.Termination,
+	}
+	if updated.Termination.ExitCode != nil {
+		e["exit_code"] = *updated.Termination.ExitCode
+	}
+	w.bus.Publish(e)
 }
 
 func (w *watcher) listContainers(options types.ContainerListOptions) ([]*Container, error) {
@@ -378,41 +586,67 @@ func (w *watcher) listContainers(options types.ContainerListOptions) ([]*Contain
 
 	containers, err := w.client.ContainerList(ctx, options)
 	if err != nil {
+		w.metrics.ListFailed()
 		return nil, err
 	}
 
 	result := make([]*Container, len(containers))
 	for idx, c := range containers {
 		var ipaddresses []string
+		var networks map[string]ContainerNetwork
 		if c.NetworkSettings != nil {
 			// Handle alternate platforms like VMWare's VIC that might not have this data.
-			for _, net := range c.NetworkSettings.Networks {
+			for name, net := range c.NetworkSettings.Networks {
+				if net == nil {
+					continue
+				}
 				if net.IPAddress != "" {
 					ipaddresses = append(ipaddresses, net.IPAddress)
 				}
+				if networks == nil {
+					networks = make(map[string]ContainerNetwork, len(c.NetworkSettings.Networks))
+				}
+				networks[name] = ContainerNetwork{
+					NetworkID:   net.NetworkID,
+					IPAddress:   net.IPAddress,
+					IPv6Address: net.GlobalIPv6Address,
+					Gateway:     net.Gateway,
+					MacAddress:  net.MacAddress,
+					Aliases:     net.Aliases,
+				}
 			}
 		}
 
 		// If there are no network interfaces, assume that the container is on host network
 		// Inspect the container directly and use the hostname as the IP address in order
-		if len(ipaddresses) == 0 {
-			log.Debugf("Inspect container %s", c.ID)
-			ctx, cancel := context.WithTimeout(w.ctx, dockerRequestTimeout)
-			defer cancel()
-			info, err := w.client.ContainerInspect(ctx, c.ID)
-			if err == nil {
-				ipaddresses = append(ipaddresses, info.Config.Hostname)
-			} else {
-				log.Warnf("unable to inspect container %s due to error %+v", c.ID, err)
-			}
+		var info *types.ContainerJSON
+		if len(ipaddresses) == 0 || w.inspect {
+			info = w.inspectContainer(c.ID)
+		}
+		if len(ipaddresses) == 0 && info != nil && info.Config != nil {
+			ipaddresses = append(ipaddresses, info.Config.Hostname)
+		}
+		labels := c.Labels
+		if labels == nil {
+			// Podman returns no labels instead of an empty map
+			labels = map[string]string{}
 		}
 		result[idx] = &Container{
 			ID:          c.ID,
-			Name:        c.Names[0][1:], // Strip '/' from container names
+			Name:        containerName(c.Names), // Strip '/' from container names
 			Image:       c.Image,
-			Labels:      c.Labels,
+			Labels:      labels,
 			Ports:       c.Ports,
+			State:       c.State,
 			IPAddresses: ipaddresses,
+			Health:      healthFromStatus(c.Status),
+			Networks:    networks,
+			ImageID:     c.ImageID,
+			ImageDigest: imageDigest(c.Image),
+			Mounts:      containerMounts(c.Mounts),
+		}
+		if w.inspect {
+			w.addInspectInfo(result[idx], info)
 		}
 	}
 
@@ -437,10 +671,13 @@ func (w *watcher) cleanupWorker() {
 func (w *watcher) runCleanup() {
 	// Check entries for timeout
 	var toDelete []string
-	timeout := w.clock.Now().Add(-w.cleanupTimeout)
+	now := w.clock.Now()
+	timeout := now.Add(-w.cleanupTimeout)
+	retention := now.Add(-w.retention)
 	w.RLock()
 	for key, lastSeen := range w.deleted {
-		if lastSeen.Before(timeout) {
+		// Stopped containers are kept while they are accessed, and at least during the retention
+		if lastSeen.Before(timeout) && !w.stoppedAt[key].After(retention) {
 			w.log.Debugf("Removing container %s after cool down timeout", key)
 			toDelete = append(toDelete, key)
 		}
@@ -461,11 +698,13 @@ func (w *watcher) runCleanup() {
 	w.Lock()
 	for _, key := range toDelete {
 		delete(w.deleted, key)
+		delete(w.stoppedAt, key)
 		delete(w.containers, key)
 		if w.shortID {
 			delete(w.containers, key[:shortIDLen])
 		}
 	}
+	w.trackContainers()
 	w.Unlock()
 }
 
@@ -478,3 +717,18 @@ func (w *watcher) ListenStart() bus.Listener {
 func (w *watcher) ListenStop() bus.Listener {
 	return w.bus.Subscribe("stop")
 }
+
+// ListenPause returns a bus listener to receive container paused events, with a `container` key holding it
+func (w *watcher) ListenPause() bus.Listener {
+	return w.bus.Subscribe(pauseAction)
+}
+
+// ListenUnpause returns a bus listener to receive container unpaused events, with a `container` key holding it
+func (w *watcher) ListenUnpause() bus.Listener {
+	return w.bus.Subscribe(unpauseAction)
+}
+
+// ListenOOM returns a bus listener to receive container out of memory events, with a `container` key holding it
+func (w *watcher) ListenOOM() bus.Listener {
+	return w.bus.Subscribe(oomAction)
+}
@@ -42,20 +42,41 @@ type MockClient struct {
 	events []interface{}
 	// done channel is closed when the client has sent all events
 	done chan interface{}
+	// inspect results to return on ContainerInspect calls, by container ID
+	inspect map[string]types.ContainerJSON
+	// options received on ContainerList and Events calls
+	listOptions   []types.ContainerListOptions
+	eventsOptions []types.EventsOptions
+	// events are sent once, done is closed on the first Events call
+	doneOnce sync.Once
+	lock     sync.Mutex
+}
+
+// eventsCalls returns the number of Events calls
+func (m *MockClient) eventsCalls() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return len(m.eventsOptions)
 }
 
 func (m *MockClient) ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+	m.listOptions = append(m.listOptions, options)
 	res := m.containers[0]
 	m.containers = m.containers[1:]
 	return res, nil
 }
 
 func (m *MockClient) Events(ctx context.Context, options types.EventsOptions) (<-chan events.Message, <-chan error) {
+	m.lock.Lock()
+	m.eventsOptions = append(m.eventsOptions, options)
+	m.lock.Unlock()
 	eventsC := make(chan events.Message)
 	errorsC := make(chan error)
 
+	pending := m.events
+	m.events = nil
 	go func() {
-		for _, event := range m.events {
+		for _, event := range pending {
 			switch e := event.(type) {
 			case events.Message:
 				eventsC <- e
@@ -63,13 +84,16 @@ func (m *MockClient) Events(ctx context.Context, options types.EventsOptions) (<
 				errorsC <- e
 			}
 		}
-		close(m.done)
+		m.doneOnce.Do(func() { close(m.done) })
 	}()
 
 	return eventsC, errorsC
 }
 
 func (m *MockClient) ContainerInspect(ctx context.Context, container string) (types.ContainerJSON, error) {
+	if info, ok := m.inspect[container]; ok {
+		return info, nil
+	}
 	return types.ContainerJSON{}, errors.New("unimplemented")
 }
 
@@ -468,6 +492,125 @@ func TestWatcherDieShortID(t *testing.T) {
 	assert.Equal(t, 0, len(watcher.Containers()))
 }
 
+func TestWatcherDieRetention(t *testing.T) {
+	watcher, clientDone := testWatcher(t,
+		[][]types.Container{
+			[]types.Container{
+				types.Container{
+					ID:              "0332dbd79e20",
+					Names:           []string{"/containername"},
+					Image:           "busybox",
+					NetworkSettings: &types.SummaryNetworkSettings{},
+				},
+			},
+		},
+		[]interface{}{
+			events.Message{
+				Action: "die",
+				Actor: events.Actor{
+					ID: "0332dbd79e20",
+				},
+			},
+		},
+	)
+	watcher.retention = 10 * watcher.cleanupTimeout
+
+	clock := newTestClock()
+	watcher.clock = clock
+
+	stopListener := watcher.ListenStop()
+
+	err := watcher.Start()
+	require.NoError(t, err)
+	defer watcher.Stop()
+
+	<-clientDone
+	<-stopListener.Events()
+
+	// Kept during the retention even if not accessed
+	clock.Sleep(5 * watcher.cleanupTimeout)
+	watcher.runCleanup()
+	assert.Equal(t, 1, len(watcher.Containers()))
+
+	// Removed after the retention
+	clock.Sleep(5*watcher.cleanupTimeout + 1*time.Second)
+	watcher.runCleanup()
+	assert.Equal(t, 0, len(watcher.Containers()))
+}
+
+func TestWatcherReconnectReconciles(t *testing.T) {
+	watcher, clientDone := testWatcher(t,
+		[][]types.Container{
+			// Initial list
+			[]types.Container{
+				types.Container{
+					ID:              "0332dbd79e20",
+					Names:           []string{"/stopped"},
+					Image:           "busybox",
+					NetworkSettings: &types.SummaryNetworkSettings{},
+				},
+				types.Container{
+					ID:              "6c9a82bf1c4d",
+					Names:           []string{"/running"},
+					Image:           "busybox",
+					NetworkSettings: &types.SummaryNetworkSettings{},
+				},
+			},
+			// List after reconnecting
+			[]types.Container{
+				types.Container{
+					ID:              "6c9a82bf1c4d",
+					Names:           []string{"/running"},
+					Image:           "busybox",
+					NetworkSettings: &types.SummaryNetworkSettings{},
+				},
+				types.Container{
+					ID:              "97ac5b8e3bd4",
+					Names:           []string{"/started"},
+					Image:           "busybox",
+					NetworkSettings: &types.SummaryNetworkSettings{},
+				},
+			},
+		},
+		[]interface{}{
+			errors.New("connection reset by peer"),
+		},
+	)
+	watcher.minBackoff = time.Millisecond
+
+	startListener := watcher.ListenStart()
+	defer startListener.Stop()
+	stopListener := watcher.ListenStop()
+	defer stopListener.Stop()
+
+	err := watcher.Start()
+	require.NoError(t, err)
+	defer watcher.Stop()
+	<-clientDone
+
+	started := map[string]bool{}
+	timeout := time.After(5 * time.Second)
+	for len(started) < 3 {
+		select {
+		case e := <-startListener.Events():
+			started[e["container"].(*Container).Name] = true
+		case <-timeout:
+			t.Fatalf("start events not received, got %v", started)
+		}
+	}
+	assert.Equal(t, map[string]bool{"stopped": true, "running": true, "started": true}, started)
+
+	select {
+	case e := <-stopListener.Events():
+		assert.Equal(t, "stopped", e["container"].(*Container).Name)
+	case <-timeout:
+		t.Fatal("stop event not received")
+	}
+
+	// Stopped container is kept until cleanup
+	assert.Len(t, watcher.Containers(), 3)
+}
+
 func testWatcher(t *testing.T, containers [][]types.Container, events []interface{}) (*watcher, chan interface{}) {
 	return testWatcherShortID(t, containers, events, false)
 }
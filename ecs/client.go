@@ -0,0 +1,151 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ecs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// metadataURIEnv is set by the ECS agent in the containers of tasks
+const metadataURIEnv = "ECS_CONTAINER_METADATA_URI_V4"
+
+const (
+	requestTimeout    = 5 * time.Second
+	defaultSyncPeriod = 10 * time.Second
+)
+
+// Config of the ECS task metadata provider
+type Config struct {
+	// URI of the task metadata endpoint, ECS_CONTAINER_METADATA_URI_V4 by default
+	URI string `config:"uri"`
+
+	// SyncPeriod is the time waited between requests to the endpoint
+	SyncPeriod time.Duration `config:"sync_period"`
+}
+
+// Validate the config
+func (c *Config) Validate() error {
+	if c.SyncPeriod < 0 {
+		return fmt.Errorf("invalid ECS sync period %v", c.SyncPeriod)
+	}
+	return nil
+}
+
+// Task metadata, as returned by the task metadata endpoint v4
+type Task struct {
+	Cluster          string
+	TaskARN          string
+	Family           string
+	Revision         string
+	DesiredStatus    string
+	KnownStatus      string
+	AvailabilityZone string
+	LaunchType       string
+	Containers       []Container
+}
+
+// Container of a task
+type Container struct {
+	DockerID      string `json:"DockerId"`
+	Name          string
+	DockerName    string
+	Image         string
+	ImageID       string
+	Labels        map[string]string
+	DesiredStatus string
+	KnownStatus   string
+	Type          string
+	ContainerARN  string
+	CreatedAt     time.Time
+	StartedAt     time.Time
+	Networks      []Network
+	Ports         []Port
+
+	// Task the container belongs to, set by the watcher
+	Task *Task `json:"-"`
+}
+
+// Network of a container
+type Network struct {
+	NetworkMode   string
+	IPv4Addresses []string
+}
+
+// Port mapping of a container
+type Port struct {
+	ContainerPort uint16
+	HostPort      uint16
+	Protocol      string
+	HostIP        string `json:"HostIp"`
+}
+
+// MetadataAPI is the task metadata endpoint
+type MetadataAPI interface {
+	// Task returns the metadata of the task
+	Task(ctx context.Context) (*Task, error)
+}
+
+type client struct {
+	http *http.Client
+	uri  string
+}
+
+// NewClient returns a client of the task metadata endpoint v4 of the config, the one in the
+// ECS_CONTAINER_METADATA_URI_V4 environment variable if not set
+func NewClient(cfg Config) (MetadataAPI, error) {
+	uri := cfg.URI
+	if uri == "" {
+		uri = os.Getenv(metadataURIEnv)
+	}
+	if uri == "" {
+		return nil, errors.New(metadataURIEnv + " is not set, not running in an ECS task")
+	}
+	return &client{
+		http: &http.Client{Timeout: requestTimeout},
+		uri:  strings.TrimSuffix(uri, "/"),
+	}, nil
+}
+
+// Task returns the metadata of the task
+func (c *client) Task(ctx context.Context) (*Task, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.uri+"/task", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ECS task metadata: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get ECS task metadata: unexpected status %s", resp.Status)
+	}
+	var task Task
+	if err := json.NewDecoder(resp.Body).Decode(&task); err != nil {
+		return nil, fmt.Errorf("failed to decode ECS task metadata: %w", err)
+	}
+	return &task, nil
+}
@@ -0,0 +1,115 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ecs
+
+import (
+	"strings"
+
+	"github.com/elastic/elastic-agent-autodiscover/utils"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// GenerateMetadata returns the metadata of a container of a task, with the ECS cloud, container
+// and orchestrator fields, and the task fields under `aws.ecs`. Labels are dedotted if dedot is
+// set.
+func GenerateMetadata(c *Container, dedot bool) mapstr.M {
+	var dedotter *utils.Dedotter
+	if dedot {
+		dedotter = utils.DefaultDedotter
+	}
+	labels := mapstr.M{}
+	for k, v := range c.Labels {
+		dedotter.Put(labels, k, v)
+	}
+
+	container := mapstr.M{
+		"id":   c.DockerID,
+		"name": c.Name,
+		"image": mapstr.M{
+			"name": c.Image,
+		},
+	}
+	if len(labels) > 0 {
+		container["labels"] = labels
+	}
+	var ips []string
+	for _, network := range c.Networks {
+		ips = append(ips, network.IPv4Addresses...)
+	}
+	if len(ips) > 0 {
+		container["ip"] = ips
+	}
+
+	meta := mapstr.M{
+		"container": container,
+		"cloud": mapstr.M{
+			"provider": "aws",
+		},
+		"orchestrator": mapstr.M{
+			"type": "ecs",
+		},
+	}
+	if task := c.Task; task != nil {
+		_, _ = meta.Put("aws.ecs", mapstr.M{
+			"cluster": mapstr.M{
+				"name": clusterName(task.Cluster),
+			},
+			"task": mapstr.M{
+				"arn":      task.TaskARN,
+				"family":   task.Family,
+				"revision": task.Revision,
+			},
+			"launch_type": task.LaunchType,
+			"container": mapstr.M{
+				"arn":  c.ContainerARN,
+				"name": c.Name,
+			},
+		})
+		_, _ = meta.Put("orchestrator.cluster.name", clusterName(task.Cluster))
+		if task.AvailabilityZone != "" {
+			_, _ = meta.Put("cloud.availability_zone", task.AvailabilityZone)
+			_, _ = meta.Put("cloud.region", region(task.AvailabilityZone))
+		}
+		if account := accountID(task.TaskARN); account != "" {
+			_, _ = meta.Put("cloud.account.id", account)
+		}
+	}
+	return meta
+}
+
+// clusterName returns the name of the cluster from its name or ARN
+func clusterName(cluster string) string {
+	if i := strings.LastIndex(cluster, "/"); i >= 0 {
+		return cluster[i+1:]
+	}
+	return cluster
+}
+
+// accountID returns the account of an ARN like arn:aws:ecs:<region>:<account>:task/...
+func accountID(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) < 6 {
+		return ""
+	}
+	return parts[4]
+}
+
+// region returns the region of an availability zone, e.g. us-east-1 for us-east-1a
+func region(zone string) string {
+	return strings.TrimRight(zone, "abcdefghijklmnopqrstuvwxyz")
+}
@@ -0,0 +1,177 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package ecs discovers the containers of the AWS ECS task the agent runs in, including Fargate
+// tasks, reading the task metadata endpoint v4. It allows agents running as sidecars to discover
+// their peers.
+package ecs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+	"github.com/elastic/elastic-agent-autodiscover/internal/poll"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// StatusRunning is the known status of running containers
+const StatusRunning = "RUNNING"
+
+// Watcher polls the task metadata endpoint and keeps a list of running containers of the task
+type Watcher interface {
+	// Start watching the task
+	Start() error
+
+	// Stop watching the task
+	Stop()
+
+	// Task returns the last metadata of the task
+	Task() *Task
+
+	// Containers returns the running containers of the task by their docker ID
+	Containers() map[string]*Container
+
+	// ListenStart returns a bus listener to receive the containers of the task that reach the
+	// RUNNING status, with a `container` key holding them
+	ListenStart() bus.Listener
+
+	// ListenStop returns a bus listener to receive the containers of the task that stop running,
+	// with a `container` key holding their last known state
+	ListenStop() bus.Listener
+}
+
+type watcher struct {
+	sync.RWMutex
+	log        *logp.Logger
+	api        MetadataAPI
+	period     time.Duration
+	ctx        context.Context
+	stop       context.CancelFunc
+	task       *Task
+	containers map[string]*Container
+	stopped    sync.WaitGroup
+	bus        bus.Bus
+}
+
+// NewWatcher creates a new Watcher polling the task metadata every sync period of the config
+func NewWatcher(log *logp.Logger, api MetadataAPI, cfg Config) (Watcher, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	period := cfg.SyncPeriod
+	if period == 0 {
+		period = defaultSyncPeriod
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &watcher{
+		log:        log,
+		api:        api,
+		period:     period,
+		ctx:        ctx,
+		stop:       cancel,
+		containers: make(map[string]*Container),
+		bus:        bus.New(log, "ecs"),
+	}, nil
+}
+
+// Task returns the last metadata of the task
+func (w *watcher) Task() *Task {
+	w.RLock()
+	defer w.RUnlock()
+	return w.task
+}
+
+// Containers returns the running containers of the task
+func (w *watcher) Containers() map[string]*Container {
+	w.RLock()
+	defer w.RUnlock()
+	res := make(map[string]*Container, len(w.containers))
+	for k, v := range w.containers {
+		res[k] = v
+	}
+	return res
+}
+
+// Start watching the task, the first request is done synchronously so errors reaching the
+// endpoint are returned
+func (w *watcher) Start() error {
+	w.log.Debug("Start ECS task watcher")
+	if err := w.sync(); err != nil {
+		return err
+	}
+
+	w.stopped.Add(1)
+	go w.watch()
+	return nil
+}
+
+// Stop watching the task
+func (w *watcher) Stop() {
+	w.stop()
+	w.stopped.Wait()
+}
+
+func (w *watcher) watch() {
+	defer w.stopped.Done()
+
+	poll.Loop(w.ctx, w.log, poll.Config{
+		Period:      w.period,
+		Description: "getting ECS task metadata",
+	}, w.sync)
+	w.log.Debug("Watcher stopped")
+}
+
+// sync gets the task metadata and publishes the events of the containers that started or
+// stopped since the previous request
+func (w *watcher) sync() error {
+	ctx, cancel := context.WithTimeout(w.ctx, requestTimeout)
+	defer cancel()
+
+	task, err := w.api.Task(ctx)
+	if err != nil {
+		return err
+	}
+
+	running := make(map[string]*Container, len(task.Containers))
+	for i := range task.Containers {
+		c := &task.Containers[i]
+		if c.KnownStatus != StatusRunning || c.DockerID == "" {
+			continue
+		}
+		c.Task = task
+		running[c.DockerID] = c
+	}
+
+	w.Lock()
+	started, stopped := poll.Diff(w.containers, running, nil)
+	w.task = task
+	w.containers = running
+	w.Unlock()
+
+	poll.Publish(w.bus, "container", started, stopped)
+	return nil
+}
+
+func (w *watcher) ListenStart() bus.Listener {
+	return w.bus.Subscribe("start")
+}
+
+func (w *watcher) ListenStop() bus.Listener {
+	return w.bus.Subscribe("stop")
+}
@@ -0,0 +1,173 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ecs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-autodiscover/internal/polltest"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const taskARN = "arn:aws:ecs:us-west-2:111122223333:task/default/158d1c8083dd49d6b527399fd6414f5c"
+
+type mockAPI struct {
+	polltest.Source[Container]
+}
+
+func (m *mockAPI) Task(ctx context.Context) (*Task, error) {
+	containers, _, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+	return &Task{
+		Cluster:          "arn:aws:ecs:us-west-2:111122223333:cluster/default",
+		TaskARN:          taskARN,
+		Family:           "web",
+		Revision:         "3",
+		AvailabilityZone: "us-west-2d",
+		LaunchType:       "FARGATE",
+		Containers:       containers,
+	}, nil
+}
+
+func container(id, name, status string) Container {
+	return Container{DockerID: id, Name: name, Image: name + ":latest", KnownStatus: status}
+}
+
+func TestWatcher(t *testing.T) {
+	api := &mockAPI{}
+	api.Set(container("c1", "nginx", StatusRunning), container("c2", "init", "STOPPED"))
+
+	w, err := NewWatcher(logp.L(), api, Config{SyncPeriod: 10 * time.Millisecond})
+	require.NoError(t, err)
+	start, stop := polltest.Start(t, w)
+
+	c := polltest.NextEvent(t, start)["container"].(*Container)
+	assert.Equal(t, "nginx", c.Name)
+	assert.Equal(t, "web", c.Task.Family)
+	assert.Len(t, w.Containers(), 1)
+	assert.Equal(t, taskARN, w.Task().TaskARN)
+
+	api.Set(container("c1", "nginx", "STOPPED"), container("c3", "agent", StatusRunning))
+	assert.Equal(t, "c3", polltest.NextEvent(t, start)["container"].(*Container).DockerID)
+	assert.Equal(t, "c1", polltest.NextEvent(t, stop)["container"].(*Container).DockerID)
+}
+
+func TestWatcherStartError(t *testing.T) {
+	polltest.StartError(t, func(err error) (polltest.Watcher, error) {
+		api := &mockAPI{}
+		api.Fail(err)
+		return NewWatcher(logp.L(), api, Config{})
+	})
+
+	_, err := NewWatcher(logp.L(), &mockAPI{}, Config{SyncPeriod: -time.Second})
+	assert.Error(t, err)
+}
+
+func TestClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v4/abc/task", r.URL.Path)
+		_, _ = w.Write([]byte(`{
+			"Cluster": "default",
+			"TaskARN": "` + taskARN + `",
+			"Family": "web",
+			"Revision": "3",
+			"Containers": [{
+				"DockerId": "c1",
+				"Name": "nginx",
+				"Labels": {"com.amazonaws.ecs.task-definition-family": "web"},
+				"KnownStatus": "RUNNING",
+				"Networks": [{"NetworkMode": "awsvpc", "IPv4Addresses": ["10.0.2.106"]}]
+			}]
+		}`))
+	}))
+	defer server.Close()
+
+	t.Setenv(metadataURIEnv, server.URL+"/v4/abc")
+	api, err := NewClient(Config{})
+	require.NoError(t, err)
+	task, err := api.Task(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "web", task.Family)
+	require.Len(t, task.Containers, 1)
+	assert.Equal(t, "c1", task.Containers[0].DockerID)
+	assert.Equal(t, []string{"10.0.2.106"}, task.Containers[0].Networks[0].IPv4Addresses)
+
+	failing := polltest.FailingServer(t, http.StatusNotFound, "not found")
+	api, err = NewClient(Config{URI: failing.URL})
+	require.NoError(t, err)
+	_, err = api.Task(context.Background())
+	assert.Error(t, err)
+
+	t.Setenv(metadataURIEnv, "")
+	_, err = NewClient(Config{})
+	assert.Error(t, err)
+}
+
+func TestGenerateMetadata(t *testing.T) {
+	api := &mockAPI{}
+	api.Set(Container{
+		DockerID:     "c1",
+		Name:         "nginx",
+		Image:        "nginx:latest",
+		ContainerARN: "arn:aws:ecs:us-west-2:111122223333:container/0206b271",
+		Labels:       map[string]string{"com.amazonaws.ecs.task-definition-family": "web"},
+		Networks:     []Network{{NetworkMode: "awsvpc", IPv4Addresses: []string{"10.0.2.106"}}},
+	})
+	task, err := api.Task(context.Background())
+	require.NoError(t, err)
+	c := &task.Containers[0]
+	c.Task = task
+
+	assert.Equal(t, mapstr.M{
+		"container": mapstr.M{
+			"id":     "c1",
+			"name":   "nginx",
+			"image":  mapstr.M{"name": "nginx:latest"},
+			"labels": mapstr.M{"com_amazonaws_ecs_task-definition-family": "web"},
+			"ip":     []string{"10.0.2.106"},
+		},
+		"cloud": mapstr.M{
+			"provider":          "aws",
+			"region":            "us-west-2",
+			"availability_zone": "us-west-2d",
+			"account":           mapstr.M{"id": "111122223333"},
+		},
+		"orchestrator": mapstr.M{
+			"type":    "ecs",
+			"cluster": mapstr.M{"name": "default"},
+		},
+		"aws": mapstr.M{
+			"ecs": mapstr.M{
+				"cluster":     mapstr.M{"name": "default"},
+				"task":        mapstr.M{"arn": taskARN, "family": "web", "revision": "3"},
+				"launch_type": "FARGATE",
+				"container":   mapstr.M{"arn": "arn:aws:ecs:us-west-2:111122223333:container/0206b271", "name": "nginx"},
+			},
+		},
+	}, GenerateMetadata(c, true))
+}
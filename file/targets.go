@@ -0,0 +1,136 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package file
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// IDKey is the key of the targets with the ID that identifies them in its file, targets without
+// it are identified by their position
+const IDKey = "id"
+
+// Target defined in a file
+type Target struct {
+	// ID of the target, unique in the directory, like <file>#<id>
+	ID string
+
+	// File the target is defined in
+	File string
+
+	// Fields of the target, as defined in the file
+	Fields mapstr.M
+
+	// hash of the fields, to detect changes
+	hash string
+}
+
+// readTargets reads the targets of a YAML or JSON file, that contains a target or a list of them
+func readTargets(path string) ([]*Target, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw interface{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, &raw)
+	} else {
+		err = yaml.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	var entries []interface{}
+	switch v := raw.(type) {
+	case nil:
+		// Empty file
+	case []interface{}:
+		entries = v
+	default:
+		entries = []interface{}{v}
+	}
+
+	name := filepath.Base(path)
+	targets := make([]*Target, 0, len(entries))
+	ids := make(map[string]bool, len(entries))
+	for i, entry := range entries {
+		fields, ok := toMapStr(entry).(mapstr.M)
+		if !ok {
+			return nil, fmt.Errorf("target %d of %s is not a mapping", i, path)
+		}
+		id := fmt.Sprintf("%s#%d", name, i)
+		if v, ok := fields[IDKey]; ok {
+			id = fmt.Sprintf("%s#%v", name, v)
+		}
+		if ids[id] {
+			return nil, fmt.Errorf("duplicated target %s in %s", id, path)
+		}
+		ids[id] = true
+
+		encoded, err := json.Marshal(fields)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target %s: %w", id, err)
+		}
+		sum := sha256.Sum256(encoded)
+		targets = append(targets, &Target{
+			ID:     id,
+			File:   path,
+			Fields: fields,
+			hash:   hex.EncodeToString(sum[:]),
+		})
+	}
+	return targets, nil
+}
+
+// toMapStr converts the maps decoded from YAML, with keys of any type, and JSON to mapstr.M
+func toMapStr(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(mapstr.M, len(v))
+		for k, value := range v {
+			m[fmt.Sprint(k)] = toMapStr(value)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(mapstr.M, len(v))
+		for k, value := range v {
+			m[k] = toMapStr(value)
+		}
+		return m
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, value := range v {
+			values[i] = toMapStr(value)
+		}
+		return values
+	default:
+		return v
+	}
+}
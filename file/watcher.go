@@ -0,0 +1,321 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package file discovers static targets defined in YAML or JSON files of a directory, watching
+// the directory for changes. It allows integrating external inventory systems that can write
+// files.
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+const (
+	defaultSyncPeriod = 5 * time.Minute
+
+	// Changes are applied after this time without new changes, files are usually written in
+	// several operations
+	debounceDelay = 100 * time.Millisecond
+)
+
+var defaultPatterns = []string{"*.yml", "*.yaml", "*.json"}
+
+// Config of the file targets provider
+type Config struct {
+	// Path of the directory with the target files
+	Path string `config:"path"`
+
+	// Patterns of the names of the target files, *.yml, *.yaml and *.json by default
+	Patterns []string `config:"patterns"`
+
+	// SyncPeriod is the time between full reads of the directory, in case some change is missed
+	SyncPeriod time.Duration `config:"sync_period"`
+}
+
+// Validate the config
+func (c *Config) Validate() error {
+	if c.Path == "" {
+		return errors.New("path of the targets directory is required")
+	}
+	for _, p := range c.Patterns {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid targets file pattern %q: %w", p, err)
+		}
+	}
+	if c.SyncPeriod < 0 {
+		return fmt.Errorf("invalid targets sync period %v", c.SyncPeriod)
+	}
+	return nil
+}
+
+// Watcher watches a directory and keeps a list of the targets defined in its files
+type Watcher interface {
+	// Start watching the directory
+	Start() error
+
+	// Stop watching the directory
+	Stop()
+
+	// Targets returns the targets by their ID
+	Targets() map[string]*Target
+
+	// ListenStart returns a bus listener to receive target added events, with a `target` key holding it
+	ListenStart() bus.Listener
+
+	// ListenStop returns a bus listener to receive target removed events, with a `target` key holding it
+	ListenStop() bus.Listener
+}
+
+type watcher struct {
+	sync.RWMutex
+	log      *logp.Logger
+	path     string
+	patterns []string
+	period   time.Duration
+	fsnotify *fsnotify.Watcher
+	ctx      context.Context
+	stop     context.CancelFunc
+	targets  map[string]*Target
+	stopped  sync.WaitGroup
+	bus      bus.Bus
+}
+
+// NewWatcher creates a new Watcher of the target files of the directory of the config
+func NewWatcher(log *logp.Logger, cfg Config) (Watcher, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	patterns := cfg.Patterns
+	if len(patterns) == 0 {
+		patterns = defaultPatterns
+	}
+	period := cfg.SyncPeriod
+	if period == 0 {
+		period = defaultSyncPeriod
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &watcher{
+		log:      log,
+		path:     cfg.Path,
+		patterns: patterns,
+		period:   period,
+		ctx:      ctx,
+		stop:     cancel,
+		targets:  make(map[string]*Target),
+		bus:      bus.New(log, "file"),
+	}, nil
+}
+
+// Targets returns the targets
+func (w *watcher) Targets() map[string]*Target {
+	w.RLock()
+	defer w.RUnlock()
+	res := make(map[string]*Target, len(w.targets))
+	for k, v := range w.targets {
+		res[k] = v
+	}
+	return res
+}
+
+// Start watching the directory, the files are read synchronously so errors reading the directory
+// are returned
+func (w *watcher) Start() error {
+	w.log.Debugf("Start watching targets in %s", w.path)
+	notify, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch %s: %w", w.path, err)
+	}
+	if err := notify.Add(w.path); err != nil {
+		notify.Close()
+		return fmt.Errorf("failed to watch %s: %w", w.path, err)
+	}
+	w.fsnotify = notify
+
+	if err := w.sync(); err != nil {
+		notify.Close()
+		return err
+	}
+
+	w.stopped.Add(1)
+	go w.watch()
+	return nil
+}
+
+// Stop watching the directory
+func (w *watcher) Stop() {
+	w.stop()
+	w.stopped.Wait()
+}
+
+func (w *watcher) watch() {
+	defer w.stopped.Done()
+	defer w.fsnotify.Close()
+
+	ticker := time.NewTicker(w.period)
+	defer ticker.Stop()
+
+	// Timer of the pending changes, stopped when there are none
+	debounce := time.NewTimer(debounceDelay)
+	if !debounce.Stop() {
+		<-debounce.C
+	}
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			w.log.Debug("Watcher stopped")
+			return
+		case e, ok := <-w.fsnotify.Events:
+			if !ok {
+				return
+			}
+			if w.matches(e.Name) {
+				debounce.Reset(debounceDelay)
+			}
+		case err, ok := <-w.fsnotify.Errors:
+			if !ok {
+				return
+			}
+			// Events can be lost on overflows, read everything again
+			w.log.Errorf("Error watching %s: %v", w.path, err)
+			debounce.Reset(debounceDelay)
+		case <-debounce.C:
+			if err := w.sync(); err != nil {
+				w.log.Errorf("Error reading targets: %v", err)
+			}
+		case <-ticker.C:
+			if err := w.sync(); err != nil {
+				w.log.Errorf("Error reading targets: %v", err)
+			}
+		}
+	}
+}
+
+// sync reads the target files and publishes the events of the targets added or removed since the
+// last read. Changed targets are removed and added again. The targets of the files that cannot
+// be read or parsed are kept, so a file written partially doesn't remove them.
+func (w *watcher) sync() error {
+	entries, err := os.ReadDir(w.path)
+	if err != nil {
+		return fmt.Errorf("failed to read targets directory: %w", err)
+	}
+
+	w.RLock()
+	previous := make(map[string][]*Target)
+	for _, t := range w.targets {
+		previous[t.File] = append(previous[t.File], t)
+	}
+	w.RUnlock()
+
+	current := make(map[string]*Target)
+	for _, entry := range entries {
+		path := filepath.Join(w.path, entry.Name())
+		if entry.IsDir() || !w.matches(path) {
+			continue
+		}
+		targets, err := readTargets(path)
+		if err != nil {
+			w.log.Errorf("Error reading targets, keeping the previous ones: %v", err)
+			targets = previous[path]
+		}
+		for _, t := range targets {
+			current[t.ID] = t
+		}
+	}
+
+	var added, removed []*Target
+	w.Lock()
+	for id, t := range current {
+		old, ok := w.targets[id]
+		if !ok {
+			added = append(added, t)
+		} else if old.hash != t.hash {
+			removed = append(removed, old)
+			added = append(added, t)
+		} else {
+			// Keep the instance that was published
+			current[id] = old
+		}
+	}
+	for id, t := range w.targets {
+		if _, ok := current[id]; !ok {
+			removed = append(removed, t)
+		}
+	}
+	w.targets = current
+	w.Unlock()
+
+	sortTargets(removed)
+	sortTargets(added)
+	for _, t := range removed {
+		w.bus.Publish(bus.Event{
+			"stop":   true,
+			"target": t,
+		})
+	}
+	for _, t := range added {
+		w.bus.Publish(bus.Event{
+			"start":  true,
+			"target": t,
+		})
+	}
+	return nil
+}
+
+// matches returns true if the file is a target file, hidden files, like the temporary files of
+// editors, are ignored
+func (w *watcher) matches(path string) bool {
+	name := filepath.Base(path)
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	for _, p := range w.patterns {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func sortTargets(targets []*Target) {
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].ID < targets[j].ID
+	})
+}
+
+// ListenStart returns a bus listener to receive target added events, with a `target` key holding it
+func (w *watcher) ListenStart() bus.Listener {
+	return w.bus.Subscribe("start")
+}
+
+// ListenStop returns a bus listener to receive target removed events, with a `target` key holding it
+func (w *watcher) ListenStop() bus.Listener {
+	return w.bus.Subscribe("stop")
+}
@@ -0,0 +1,134 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestReadTargets(t *testing.T) {
+	dir := t.TempDir()
+	write(t, dir, "redis.yml", `
+- id: cache
+  module: redis
+  hosts: ["redis:6379"]
+  1: numeric key
+- module: redis
+  hosts: ["redis-2:6379"]
+`)
+	write(t, dir, "nginx.json", `{"module": "nginx", "hosts": ["http://nginx"], "labels": {"team": "web"}}`)
+	write(t, dir, "empty.yaml", ``)
+	write(t, dir, "scalar.yml", `- just a string`)
+	write(t, dir, "duplicated.yml", "- id: a\n- id: a\n")
+
+	targets, err := readTargets(filepath.Join(dir, "redis.yml"))
+	require.NoError(t, err)
+	require.Len(t, targets, 2)
+	assert.Equal(t, "redis.yml#cache", targets[0].ID)
+	assert.Equal(t, mapstr.M{"id": "cache", "module": "redis", "hosts": []interface{}{"redis:6379"}, "1": "numeric key"}, targets[0].Fields)
+	assert.Equal(t, "redis.yml#1", targets[1].ID)
+
+	targets, err = readTargets(filepath.Join(dir, "nginx.json"))
+	require.NoError(t, err)
+	require.Len(t, targets, 1)
+	assert.Equal(t, mapstr.M{"team": "web"}, targets[0].Fields["labels"])
+
+	targets, err = readTargets(filepath.Join(dir, "empty.yaml"))
+	require.NoError(t, err)
+	assert.Empty(t, targets)
+
+	_, err = readTargets(filepath.Join(dir, "scalar.yml"))
+	assert.Error(t, err)
+	_, err = readTargets(filepath.Join(dir, "duplicated.yml"))
+	assert.Error(t, err)
+}
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	write(t, dir, "redis.yml", "- id: cache\n  module: redis\n")
+	write(t, dir, "notes.txt", "not a target")
+
+	w, err := NewWatcher(logp.L(), Config{Path: dir})
+	require.NoError(t, err)
+	start := w.ListenStart()
+	stop := w.ListenStop()
+	require.NoError(t, w.Start())
+	defer w.Stop()
+
+	assert.Equal(t, "redis.yml#cache", nextEvent(t, start)["target"].(*Target).ID)
+	assert.Len(t, w.Targets(), 1)
+
+	// Added file, ignoring hidden files
+	write(t, dir, "nginx.json", `{"module": "nginx"}`)
+	write(t, dir, ".nginx.json.swp", `{"module": "nginx"}`)
+	assert.Equal(t, "nginx.json#0", nextEvent(t, start)["target"].(*Target).ID)
+
+	// Changed target
+	write(t, dir, "redis.yml", "- id: cache\n  module: redis\n  period: 10s\n")
+	assert.Equal(t, "redis.yml#cache", nextEvent(t, stop)["target"].(*Target).ID)
+	changed := nextEvent(t, start)["target"].(*Target)
+	assert.Equal(t, "10s", changed.Fields["period"])
+
+	// Invalid file keeps its targets
+	write(t, dir, "redis.yml", "- id: cache\n  module: [redis\n")
+	time.Sleep(3 * debounceDelay)
+	assert.Len(t, w.Targets(), 2)
+
+	// Removed file
+	require.NoError(t, os.Remove(filepath.Join(dir, "nginx.json")))
+	assert.Equal(t, "nginx.json#0", nextEvent(t, stop)["target"].(*Target).ID)
+	assert.Len(t, w.Targets(), 1)
+}
+
+func TestWatcherErrors(t *testing.T) {
+	_, err := NewWatcher(logp.L(), Config{})
+	assert.Error(t, err)
+
+	_, err = NewWatcher(logp.L(), Config{Path: t.TempDir(), Patterns: []string{"["}})
+	assert.Error(t, err)
+
+	w, err := NewWatcher(logp.L(), Config{Path: filepath.Join(t.TempDir(), "missing")})
+	require.NoError(t, err)
+	assert.Error(t, w.Start())
+}
+
+func write(t *testing.T, dir, name, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+}
+
+func nextEvent(t *testing.T, l bus.Listener) bus.Event {
+	t.Helper()
+	select {
+	case e := <-l.Events():
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for event")
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package hints
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// variable matches `${key}` and `${key:default}` references
+var variable = regexp.MustCompile(`\$\{([^}:]+)(?::([^}]*))?\}`)
+
+// BuildOptions configures the rendering of hints into configurations
+type BuildOptions struct {
+	// Template is the base configuration of every input, the fields of the hints are set on top
+	// of it. It can also reference variables.
+	Template mapstr.M
+}
+
+// Build renders a hint into input configurations, expanding the variables referenced in its
+// values with the given data, e.g. `${kubernetes.pod.name}` or `${data.ports.http}`. Raw hints
+// are rendered as they are, otherwise a single configuration is built from the template and the
+// hint fields. Nothing is built for disabled hints.
+func Build(hint *Hint, vars mapstr.M, opts BuildOptions) ([]*config.C, error) {
+	if hint == nil || hint.IsDisabled() {
+		return nil, nil
+	}
+
+	var raw []mapstr.M
+	if len(hint.Raw) > 0 {
+		raw = hint.Raw
+	} else {
+		raw = []mapstr.M{hintConfig(hint, opts.Template)}
+	}
+
+	configs := make([]*config.C, 0, len(raw))
+	for _, r := range raw {
+		expanded, err := Expand(map[string]interface{}(r), vars)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build %s hints: %w", hint.Kind, err)
+		}
+		cfg, err := config.NewConfigFrom(expanded)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build %s hints: %w", hint.Kind, err)
+		}
+		configs = append(configs, cfg)
+	}
+	return configs, nil
+}
+
+// hintConfig returns the configuration of the fields of a hint on top of the template
+func hintConfig(hint *Hint, template mapstr.M) mapstr.M {
+	cfg := template.Clone()
+	if cfg == nil {
+		cfg = mapstr.M{}
+	}
+	cfg.DeepUpdate(hint.Settings.Clone())
+
+	if hint.Module != "" {
+		cfg["module"] = hint.Module
+	}
+	if hint.Package != "" {
+		cfg["package"] = hint.Package
+	}
+	if len(hint.Hosts) > 0 {
+		cfg["hosts"] = hint.Hosts
+	}
+	if len(hint.Metricsets) > 0 {
+		cfg["metricsets"] = hint.Metricsets
+	}
+	if hint.Period > 0 {
+		cfg["period"] = hint.Period.String()
+	}
+	if hint.Timeout > 0 {
+		cfg["timeout"] = hint.Timeout.String()
+	}
+	if len(hint.Processors) > 0 {
+		processors := make([]interface{}, len(hint.Processors))
+		for i, p := range hint.Processors {
+			processors[i] = map[string]interface{}(p.Clone())
+		}
+		cfg["processors"] = processors
+	}
+	return cfg
+}
+
+// Expand the variables referenced in the strings of a value, recursively in maps and lists.
+// Strings consisting of a single variable are replaced by its value keeping its type, variables
+// without value and default are an error.
+func Expand(value interface{}, vars mapstr.M) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return expandString(v, vars)
+	case mapstr.M:
+		return expandMap(v, vars)
+	case map[string]interface{}:
+		return expandMap(v, vars)
+	case []interface{}:
+		expanded := make([]interface{}, len(v))
+		for i, item := range v {
+			var err error
+			if expanded[i], err = Expand(item, vars); err != nil {
+				return nil, err
+			}
+		}
+		return expanded, nil
+	case []string:
+		expanded := make([]interface{}, len(v))
+		for i, item := range v {
+			var err error
+			if expanded[i], err = expandString(item, vars); err != nil {
+				return nil, err
+			}
+		}
+		return expanded, nil
+	default:
+		return value, nil
+	}
+}
+
+func expandMap(m map[string]interface{}, vars mapstr.M) (map[string]interface{}, error) {
+	expanded := make(map[string]interface{}, len(m))
+	for k, item := range m {
+		var err error
+		if expanded[k], err = Expand(item, vars); err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+	}
+	return expanded, nil
+}
+
+func expandString(s string, vars mapstr.M) (interface{}, error) {
+	if match := variable.FindStringSubmatchIndex(s); match != nil && match[0] == 0 && match[1] == len(s) {
+		return lookup(s, vars)
+	}
+
+	var err error
+	expanded := variable.ReplaceAllStringFunc(s, func(ref string) string {
+		value, lookupErr := lookup(ref, vars)
+		if lookupErr != nil {
+			err = lookupErr
+			return ref
+		}
+		return fmt.Sprint(value)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return expanded, nil
+}
+
+// lookup the value of a variable reference, or its default
+func lookup(ref string, vars mapstr.M) (interface{}, error) {
+	parts := variable.FindStringSubmatch(ref)
+	key := strings.TrimSpace(parts[1])
+	if value, err := vars.GetValue(key); err == nil {
+		return value, nil
+	}
+	if strings.Contains(ref, ":") {
+		return parts[2], nil
+	}
+	return nil, fmt.Errorf("variable %q cannot be resolved", key)
+}
@@ -0,0 +1,128 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package hints
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+var buildVars = mapstr.M{
+	"data": mapstr.M{
+		"host":  "10.0.0.7",
+		"port":  8080,
+		"ports": mapstr.M{"http": 8080, "metrics": 9090},
+	},
+	"kubernetes": mapstr.M{
+		"pod":       mapstr.M{"name": "nginx-6d4cf56db6-tl2xp"},
+		"namespace": "web",
+	},
+}
+
+func TestBuild(t *testing.T) {
+	h, err := Parse(map[string]string{
+		"co.elastic.metrics/module":                        "prometheus",
+		"co.elastic.metrics/hosts":                         "${data.host}:${data.ports.metrics}",
+		"co.elastic.metrics/period":                        "10s",
+		"co.elastic.metrics/metrics_path":                  "/metrics",
+		"co.elastic.metrics/processors.0.add_fields.pod":   "${kubernetes.pod.name}",
+		"co.elastic.metrics/processors.0.add_fields.owner": "${kubernetes.owner:unknown}",
+	}, Options{})
+	require.NoError(t, err)
+
+	configs, err := Build(h.Pod()["metrics"], buildVars, BuildOptions{
+		Template: mapstr.M{"enabled": true, "namespace": "${kubernetes.namespace}"},
+	})
+	require.NoError(t, err)
+	require.Len(t, configs, 1)
+
+	var cfg map[string]interface{}
+	require.NoError(t, configs[0].Unpack(&cfg))
+	assert.Equal(t, map[string]interface{}{
+		"enabled":      true,
+		"namespace":    "web",
+		"module":       "prometheus",
+		"hosts":        []interface{}{"10.0.0.7:9090"},
+		"period":       "10s",
+		"metrics_path": "/metrics",
+		"processors": []interface{}{
+			map[string]interface{}{
+				"add_fields": map[string]interface{}{"pod": "nginx-6d4cf56db6-tl2xp", "owner": "unknown"},
+			},
+		},
+	}, cfg)
+}
+
+func TestBuildRaw(t *testing.T) {
+	h, err := Parse(map[string]string{
+		"co.elastic.logs/raw": `[{"type": "filestream", "id": "${kubernetes.pod.name}"}, {"type": "tcp", "port": "${data.port}"}]`,
+	}, Options{})
+	require.NoError(t, err)
+
+	configs, err := Build(h.Pod()["logs"], buildVars, BuildOptions{Template: mapstr.M{"ignored": true}})
+	require.NoError(t, err)
+	require.Len(t, configs, 2)
+
+	id, err := configs[0].String("id", -1)
+	require.NoError(t, err)
+	assert.Equal(t, "nginx-6d4cf56db6-tl2xp", id)
+	assert.False(t, configs[0].HasField("ignored"))
+
+	// Single variables keep the type of their values
+	port, err := configs[1].Int("port", -1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(8080), port)
+}
+
+func TestBuildErrors(t *testing.T) {
+	h, err := Parse(map[string]string{
+		"co.elastic.metrics/hosts":            "${data.missing}",
+		"co.elastic.metrics.nginx/enabled":    "false",
+		"co.elastic.metrics.nginx/metricsets": "stubstatus",
+	}, Options{})
+	require.NoError(t, err)
+
+	_, err = Build(h.Pod()["metrics"], buildVars, BuildOptions{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `variable "data.missing" cannot be resolved`)
+
+	// Disabled hints build no configurations
+	configs, err := Build(h.Container("nginx")["metrics"], buildVars, BuildOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, configs)
+}
+
+func TestExpand(t *testing.T) {
+	expanded, err := Expand(map[string]interface{}{
+		"url":   "http://${data.host}:${data.port}/status",
+		"port":  "${data.port}",
+		"list":  []string{"${kubernetes.namespace}", "literal"},
+		"other": 3,
+	}, buildVars)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"url":   "http://10.0.0.7:8080/status",
+		"port":  8080,
+		"list":  []interface{}{"web", "literal"},
+		"other": 3,
+	}, expanded)
+}
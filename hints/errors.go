@@ -0,0 +1,64 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package hints
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error is an invalid hint annotation
+type Error struct {
+	// Annotation is the key of the invalid annotation
+	Annotation string
+
+	// Container is the name of the container the annotation applies to, empty for pod hints
+	Container string
+
+	// Kind and Field of the hint, if the key could be parsed
+	Kind  string
+	Field string
+
+	// Offset of the error in the value of the annotation, -1 if the error is not in a specific
+	// position of the value
+	Offset int
+
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Offset >= 0 {
+		return fmt.Sprintf("invalid hint %q at offset %d: %v", e.Annotation, e.Offset, e.Err)
+	}
+	return fmt.Sprintf("invalid hint %q: %v", e.Annotation, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Errors are all the invalid hint annotations found parsing hints
+type Errors []*Error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
@@ -0,0 +1,431 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package hints parses the `co.elastic.*` annotations of pods and containers into typed hints.
+//
+// Hints are annotations like `co.elastic.logs/multiline.pattern` for all the containers of a
+// pod, or `co.elastic.logs.nginx/multiline.pattern` for the nginx container only. The part
+// before the slash is the prefix, the kind of hint and optionally the container, the part after
+// it is the field of the hint.
+package hints
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// DefaultPrefix is the prefix of hint annotations
+const DefaultPrefix = "co.elastic"
+
+// DefaultKinds are the kinds of hints accepted by default
+var DefaultKinds = []string{"logs", "metrics", "hints"}
+
+// Options configures the parsing of hints
+type Options struct {
+	// Prefix of the annotations, DefaultPrefix if empty
+	Prefix string
+
+	// Kinds of hints accepted, DefaultKinds if empty
+	Kinds []string
+
+	// Containers are the names of the containers of the pod, if set the hints of other
+	// containers are invalid
+	Containers []string
+}
+
+// Hint is the set of hints of a kind, e.g. logs, for a pod or a container
+type Hint struct {
+	Kind string
+
+	// Enabled is set if the hints were explicitly enabled or disabled
+	Enabled *bool
+
+	Module     string
+	Package    string
+	Hosts      []string
+	Metricsets []string
+	Period     time.Duration
+	Timeout    time.Duration
+
+	// Processors in the order of their index
+	Processors []mapstr.M
+
+	// Raw configurations given as JSON
+	Raw []mapstr.M
+
+	// Settings are the other fields of the hint, nested by their dotted keys
+	Settings mapstr.M
+}
+
+// IsEnabled returns true if the hint was explicitly enabled
+func (h *Hint) IsEnabled() bool {
+	return h.Enabled != nil && *h.Enabled
+}
+
+// IsDisabled returns true if the hint was explicitly disabled
+func (h *Hint) IsDisabled() bool {
+	return h.Enabled != nil && !*h.Enabled
+}
+
+// annotation is a parsed hint annotation
+type annotation struct {
+	key   string
+	value string
+}
+
+// fields of a kind of hint, by field name
+type fields map[string]annotation
+
+// Hints of a pod and its containers
+type Hints struct {
+	pod        map[string]fields            // kind -> fields
+	containers map[string]map[string]fields // container -> kind -> fields
+}
+
+// Parse the hints in the annotations of a pod. Invalid annotations are reported in Errors and
+// skipped, the hints of the valid ones are returned anyway.
+func Parse(annotations map[string]string, opts Options) (*Hints, error) {
+	prefix := opts.Prefix
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	kinds := opts.Kinds
+	if len(kinds) == 0 {
+		kinds = DefaultKinds
+	}
+
+	h := &Hints{
+		pod:        make(map[string]fields),
+		containers: make(map[string]map[string]fields),
+	}
+	var errs Errors
+
+	// Sorted so errors are reported in a stable order
+	keys := make([]string, 0, len(annotations))
+	for key := range annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix+".") {
+			continue
+		}
+		value := annotations[key]
+		scope, field, found := strings.Cut(strings.TrimPrefix(key, prefix+"."), "/")
+		kind, container, _ := strings.Cut(scope, ".")
+
+		fail := func(offset int, err error) {
+			errs = append(errs, &Error{Annotation: key, Container: container, Kind: kind, Field: field, Offset: offset, Err: err})
+		}
+		switch {
+		case !found || field == "":
+			fail(-1, errors.New("missing hint field after /"))
+			continue
+		case !contains(kinds, kind):
+			fail(-1, fmt.Errorf("unknown kind of hint %q", kind))
+			continue
+		case strings.Contains(container, "."):
+			fail(-1, fmt.Errorf("invalid container name %q", container))
+			continue
+		case container != "" && len(opts.Containers) > 0 && !contains(opts.Containers, container):
+			fail(-1, fmt.Errorf("unknown container %q", container))
+			continue
+		}
+
+		a := annotation{key: key, value: value}
+		if err := setField(&Hint{}, field, a); err != nil {
+			errs = append(errs, withContext(err, container, kind, field))
+			continue
+		}
+
+		kindFields := h.pod
+		if container != "" {
+			if h.containers[container] == nil {
+				h.containers[container] = make(map[string]fields)
+			}
+			kindFields = h.containers[container]
+		}
+		if kindFields[kind] == nil {
+			kindFields[kind] = make(fields)
+		}
+		kindFields[kind][field] = a
+	}
+
+	if len(errs) > 0 {
+		return h, errs
+	}
+	return h, nil
+}
+
+// Pod returns the hints of the pod by kind, applying to all its containers
+func (h *Hints) Pod() map[string]*Hint {
+	return build(h.pod, nil)
+}
+
+// Container returns the hints of a container by kind, the hints of the pod overridden by the
+// ones of the container
+func (h *Hints) Container(name string) map[string]*Hint {
+	return build(h.pod, h.containers[name])
+}
+
+// Containers returns the names of the containers with their own hints
+func (h *Hints) Containers() []string {
+	names := make([]string, 0, len(h.containers))
+	for name := range h.containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// build the hints of every kind, the overrides replace the fields of the base, processors and
+// raw configurations are replaced as a whole
+func build(base, overrides map[string]fields) map[string]*Hint {
+	result := make(map[string]*Hint)
+	for _, kind := range kindsOf(base, overrides) {
+		merged := make(fields)
+		for field, a := range base[kind] {
+			merged[field] = a
+		}
+		if override := overrides[kind]; override != nil {
+			if hasGroup(override, "processors") {
+				removeGroup(merged, "processors")
+			}
+			for field, a := range override {
+				merged[field] = a
+			}
+		}
+
+		hint := &Hint{Kind: kind}
+		for _, field := range sortedFields(merged) {
+			// Fields are validated when parsed
+			_ = setField(hint, field, merged[field])
+		}
+		sortProcessors(hint)
+		result[kind] = hint
+	}
+	return result
+}
+
+// processorIndexKey keeps the index of the processors while building a hint
+const processorIndexKey = "__index"
+
+// setField sets a field in the hint from its annotation, validating its value
+func setField(h *Hint, field string, a annotation) error {
+	var err error
+	switch field {
+	case "enabled":
+		var enabled bool
+		enabled, err = strconv.ParseBool(a.value)
+		h.Enabled = &enabled
+	case "module":
+		h.Module, err = nonEmpty(a.value)
+	case "package":
+		h.Package, err = nonEmpty(a.value)
+	case "host", "hosts":
+		h.Hosts = append(h.Hosts, list(a.value)...)
+	case "metricsets":
+		h.Metricsets = list(a.value)
+	case "period":
+		h.Period, err = duration(a.value)
+	case "timeout":
+		h.Timeout, err = duration(a.value)
+	case "raw":
+		var raw []mapstr.M
+		raw, err = parseRaw(a.value)
+		h.Raw = raw
+	default:
+		if strings.HasPrefix(field, "processors.") {
+			err = addProcessor(h, strings.TrimPrefix(field, "processors."), a.value)
+			break
+		}
+		if h.Settings == nil {
+			h.Settings = mapstr.M{}
+		}
+		_, err = h.Settings.Put(field, a.value)
+	}
+	if err != nil {
+		var e *Error
+		if !errors.As(err, &e) {
+			e = &Error{Offset: -1, Err: err}
+		}
+		e.Annotation = a.key
+		return e
+	}
+	return nil
+}
+
+// addProcessor adds a processor given as `<index>.<processor>[.<setting>]`, the setting or the
+// whole processor can be given as JSON
+func addProcessor(h *Hint, field, value string) error {
+	index, processor, found := strings.Cut(field, ".")
+	n, err := strconv.Atoi(index)
+	if err != nil || n < 0 || !found || processor == "" {
+		return fmt.Errorf("processors must be given as processors.<index>.<processor>, got %q", "processors."+field)
+	}
+
+	var p mapstr.M
+	for _, existing := range h.Processors {
+		if existing[processorIndexKey] == n {
+			p = existing
+		}
+	}
+	if p == nil {
+		p = mapstr.M{processorIndexKey: n}
+		h.Processors = append(h.Processors, p)
+	}
+
+	var parsed interface{} = value
+	if strings.HasPrefix(strings.TrimSpace(value), "{") {
+		var cfg map[string]interface{}
+		if err := json.Unmarshal([]byte(value), &cfg); err != nil {
+			return jsonError(err)
+		}
+		parsed = mapstr.M(cfg)
+	}
+	_, err = p.Put(processor, parsed)
+	return err
+}
+
+func sortProcessors(h *Hint) {
+	sort.SliceStable(h.Processors, func(i, j int) bool {
+		return h.Processors[i][processorIndexKey].(int) < h.Processors[j][processorIndexKey].(int)
+	})
+	for _, p := range h.Processors {
+		delete(p, processorIndexKey)
+	}
+}
+
+// parseRaw parses a JSON object or array of objects
+func parseRaw(value string) ([]mapstr.M, error) {
+	if strings.HasPrefix(strings.TrimSpace(value), "[") {
+		var cfgs []mapstr.M
+		if err := json.Unmarshal([]byte(value), &cfgs); err != nil {
+			return nil, jsonError(err)
+		}
+		return cfgs, nil
+	}
+	var cfg mapstr.M
+	if err := json.Unmarshal([]byte(value), &cfg); err != nil {
+		return nil, jsonError(err)
+	}
+	return []mapstr.M{cfg}, nil
+}
+
+// jsonError keeps the position of JSON syntax errors
+func jsonError(err error) error {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return &Error{Offset: int(syntaxErr.Offset), Err: err}
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return &Error{Offset: int(typeErr.Offset), Err: err}
+	}
+	return &Error{Offset: -1, Err: err}
+}
+
+func withContext(err error, container, kind, field string) *Error {
+	e := err.(*Error)
+	e.Container, e.Kind, e.Field = container, kind, field
+	return e
+}
+
+func duration(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("duration must be positive, got %s", value)
+	}
+	return d, nil
+}
+
+func nonEmpty(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", errors.New("value cannot be empty")
+	}
+	return value, nil
+}
+
+func list(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func kindsOf(maps ...map[string]fields) []string {
+	var kinds []string
+	for _, m := range maps {
+		for kind := range m {
+			if !contains(kinds, kind) {
+				kinds = append(kinds, kind)
+			}
+		}
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+func sortedFields(f fields) []string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func hasGroup(f fields, group string) bool {
+	for name := range f {
+		if strings.HasPrefix(name, group+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func removeGroup(f fields, group string) {
+	for name := range f {
+		if strings.HasPrefix(name, group+".") {
+			delete(f, name)
+		}
+	}
+}
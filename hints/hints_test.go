@@ -0,0 +1,144 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package hints
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestParse(t *testing.T) {
+	annotations := map[string]string{
+		"co.elastic.logs/enabled":                        "true",
+		"co.elastic.logs/multiline.pattern":              "^\\[",
+		"co.elastic.logs/processors.1.add_fields.target": "app",
+		"co.elastic.logs/processors.0.dissect":           `{"tokenizer": "%{key} %{value}"}`,
+		"co.elastic.logs.sidecar/enabled":                "false",
+		"co.elastic.metrics/module":                      "prometheus",
+		"co.elastic.metrics/hosts":                       "${data.host}:9090, ${data.host}:9091",
+		"co.elastic.metrics/period":                      "10s",
+		"co.elastic.metrics.nginx/period":                "30s",
+		"co.elastic.metrics.nginx/module":                "nginx",
+		"co.elastic.metrics.nginx/metricsets":            "stubstatus",
+		"co.elastic.hints/package":                       "redis",
+		"kubernetes.io/psp":                              "restricted",
+	}
+
+	h, err := Parse(annotations, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"nginx", "sidecar"}, h.Containers())
+
+	enabled, disabled := true, false
+	pod := h.Pod()
+	assert.Equal(t, &Hint{
+		Kind:     "logs",
+		Enabled:  &enabled,
+		Settings: mapstr.M{"multiline": mapstr.M{"pattern": "^\\["}},
+		Processors: []mapstr.M{
+			{"dissect": mapstr.M{"tokenizer": "%{key} %{value}"}},
+			{"add_fields": mapstr.M{"target": "app"}},
+		},
+	}, pod["logs"])
+	assert.Equal(t, &Hint{
+		Kind:   "metrics",
+		Module: "prometheus",
+		Hosts:  []string{"${data.host}:9090", "${data.host}:9091"},
+		Period: 10 * time.Second,
+	}, pod["metrics"])
+	assert.Equal(t, &Hint{Kind: "hints", Package: "redis"}, pod["hints"])
+
+	// Container hints override the pod ones
+	nginx := h.Container("nginx")
+	assert.Equal(t, &Hint{
+		Kind:       "metrics",
+		Module:     "nginx",
+		Hosts:      []string{"${data.host}:9090", "${data.host}:9091"},
+		Metricsets: []string{"stubstatus"},
+		Period:     30 * time.Second,
+	}, nginx["metrics"])
+	assert.True(t, nginx["logs"].IsEnabled())
+
+	sidecar := h.Container("sidecar")
+	assert.Equal(t, &disabled, sidecar["logs"].Enabled)
+	assert.True(t, sidecar["logs"].IsDisabled())
+	assert.Len(t, sidecar["logs"].Processors, 2)
+
+	// Containers without hints get the pod ones
+	assert.Equal(t, pod, h.Container("other"))
+}
+
+func TestParseRaw(t *testing.T) {
+	h, err := Parse(map[string]string{
+		"co.elastic.logs/raw":    `[{"type": "filestream", "paths": ["/var/log/*.log"]}]`,
+		"co.elastic.metrics/raw": `{"module": "redis"}`,
+	}, Options{})
+	require.NoError(t, err)
+
+	pod := h.Pod()
+	assert.Equal(t, []mapstr.M{{"type": "filestream", "paths": []interface{}{"/var/log/*.log"}}}, pod["logs"].Raw)
+	assert.Equal(t, []mapstr.M{{"module": "redis"}}, pod["metrics"].Raw)
+}
+
+func TestParseErrors(t *testing.T) {
+	h, err := Parse(map[string]string{
+		"co.elastic.logs/enabled":               "yes please",
+		"co.elastic.logs/raw":                   `{"type": "filestream",}`,
+		"co.elastic.logs/processors.first.drop": "{}",
+		"co.elastic.metrics/period":             "-1s",
+		"co.elastic.metrics/module":             "redis",
+		"co.elastic.metrics.unknown/module":     "redis",
+		"co.elastic.traces/enabled":             "true",
+		"co.elastic.logs":                       "true",
+	}, Options{Containers: []string{"nginx"}})
+
+	var errs Errors
+	require.True(t, errors.As(err, &errs))
+	assert.Len(t, errs, 7)
+
+	byAnnotation := make(map[string]*Error)
+	for _, e := range errs {
+		byAnnotation[e.Annotation] = e
+	}
+	assert.Equal(t, 23, byAnnotation["co.elastic.logs/raw"].Offset)
+	assert.Equal(t, "raw", byAnnotation["co.elastic.logs/raw"].Field)
+	assert.Equal(t, -1, byAnnotation["co.elastic.logs/enabled"].Offset)
+	assert.Equal(t, "unknown", byAnnotation["co.elastic.metrics.unknown/module"].Container)
+	assert.Contains(t, byAnnotation["co.elastic.traces/enabled"].Error(), `unknown kind of hint "traces"`)
+	assert.Contains(t, byAnnotation["co.elastic.metrics/period"].Error(), "co.elastic.metrics/period")
+	assert.Contains(t, byAnnotation, "co.elastic.logs")
+	assert.Contains(t, byAnnotation, "co.elastic.logs/processors.first.drop")
+
+	// Valid hints are parsed anyway
+	assert.Equal(t, &Hint{Kind: "metrics", Module: "redis"}, h.Pod()["metrics"])
+}
+
+func TestParseOptions(t *testing.T) {
+	h, err := Parse(map[string]string{
+		"example.com.traces/enabled": "true",
+		"co.elastic.logs/enabled":    "true",
+	}, Options{Prefix: "example.com", Kinds: []string{"traces"}})
+	require.NoError(t, err)
+	assert.Len(t, h.Pod(), 1)
+	assert.True(t, h.Pod()["traces"].IsEnabled())
+}
@@ -0,0 +1,134 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package poll implements the loop shared by the watchers that poll an API or a system for the
+// objects they discover, and the publishing of the objects that started or stopped between polls.
+package poll
+
+import (
+	"context"
+	"time"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// Config of a polling loop
+type Config struct {
+	// Period is the time waited between syncs
+	Period time.Duration
+
+	// MaxBackoff is the maximum time waited after failed syncs, the period is doubled after each
+	// failure up to it. Failed syncs are retried after the period if it is zero.
+	MaxBackoff time.Duration
+
+	// Description of the sync in the logs of its errors, like "listing Nomad allocations"
+	Description string
+
+	// Changes notifies changes, synced after the changes delay without waiting for the period.
+	// Notifications are not received anymore after it is closed.
+	Changes <-chan struct{}
+
+	// ChangesDelay is the time waited after a change is notified before syncing, so close
+	// changes are synced at once
+	ChangesDelay time.Duration
+
+	// Subscribe returns a new channel of changes, it is called after every period while there
+	// isn't one, nil if the subscription failed
+	Subscribe func() <-chan struct{}
+}
+
+// Loop calls sync every period until the context is done, or when changes are notified
+func Loop(ctx context.Context, log *logp.Logger, cfg Config, sync func() error) {
+	changes := cfg.Changes
+	backoff := cfg.Period
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-changes:
+			if !ok {
+				log.Warnf("Subscription to changes closed, syncing every %v", cfg.Period)
+				changes = nil
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				continue
+			case <-time.After(cfg.ChangesDelay):
+			}
+		case <-time.After(backoff):
+			if cfg.Subscribe != nil && changes == nil {
+				changes = cfg.Subscribe()
+			}
+		}
+
+		if err := sync(); err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			log.Errorf("Error %s: %v", cfg.Description, err)
+			backoff *= 2
+			if backoff > cfg.MaxBackoff {
+				backoff = cfg.MaxBackoff
+			}
+			if backoff < cfg.Period {
+				backoff = cfg.Period
+			}
+			continue
+		}
+		backoff = cfg.Period
+	}
+}
+
+// Diff returns the objects started and stopped between the old and the current objects, by
+// their keys. Objects reported as changed by the changed function, if any, are stopped and
+// started again.
+func Diff[K comparable, V any](old, current map[K]V, changed func(old, new V) bool) (started, stopped []V) {
+	for key, v := range current {
+		o, ok := old[key]
+		if !ok {
+			started = append(started, v)
+		} else if changed != nil && changed(o, v) {
+			stopped = append(stopped, o)
+			started = append(started, v)
+		}
+	}
+	for key, v := range old {
+		if _, ok := current[key]; !ok {
+			stopped = append(stopped, v)
+		}
+	}
+	return started, stopped
+}
+
+// Publish publishes the stop events of the stopped objects, and then the start events of the
+// started ones, with the objects under the given key
+func Publish[V any](b bus.Bus, key string, started, stopped []V) {
+	for _, v := range stopped {
+		b.Publish(bus.Event{
+			"stop": true,
+			key:    v,
+		})
+	}
+	for _, v := range started {
+		b.Publish(bus.Event{
+			"start": true,
+			key:     v,
+		})
+	}
+}
@@ -0,0 +1,170 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package poll
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// loop runs a loop in the background, returning a function stopping it and waiting for it
+func loop(cfg Config, sync func() error) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Loop(ctx, logp.L(), cfg, sync)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestLoop(t *testing.T) {
+	synced := make(chan struct{}, 10)
+	stop := loop(Config{Period: time.Millisecond}, func() error {
+		synced <- struct{}{}
+		return nil
+	})
+	for i := 0; i < 3; i++ {
+		select {
+		case <-synced:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for sync")
+		}
+	}
+	stop()
+}
+
+func TestLoopBackoff(t *testing.T) {
+	for _, c := range []struct {
+		name       string
+		maxBackoff time.Duration
+		min, max   int64
+	}{
+		// Waits 10, 20, 40, 80 and 160ms
+		{name: "backoff", maxBackoff: time.Hour, min: 1, max: 5},
+		{name: "no backoff", maxBackoff: 0, min: 6, max: 60},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var syncs int64
+			stop := loop(Config{Period: 10 * time.Millisecond, MaxBackoff: c.maxBackoff, Description: "failing"}, func() error {
+				atomic.AddInt64(&syncs, 1)
+				return errors.New("failed")
+			})
+			time.Sleep(300 * time.Millisecond)
+			stop()
+			assert.GreaterOrEqual(t, atomic.LoadInt64(&syncs), c.min)
+			assert.LessOrEqual(t, atomic.LoadInt64(&syncs), c.max)
+		})
+	}
+}
+
+func TestLoopChanges(t *testing.T) {
+	changes := make(chan struct{})
+	resubscribed := make(chan struct{})
+	subscribed := make(chan chan struct{}, 1)
+	synced := make(chan struct{}, 10)
+	stop := loop(Config{
+		Period:  50 * time.Millisecond,
+		Changes: changes,
+		Subscribe: func() <-chan struct{} {
+			select {
+			case c := <-subscribed:
+				close(resubscribed)
+				return c
+			default:
+				return nil
+			}
+		},
+	}, func() error {
+		synced <- struct{}{}
+		return nil
+	})
+	defer stop()
+
+	wait := func(c <-chan struct{}) {
+		t.Helper()
+		select {
+		case <-c:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		}
+	}
+	drain := func() {
+		for len(synced) > 0 {
+			<-synced
+		}
+	}
+
+	changes <- struct{}{}
+	wait(synced)
+
+	// Changes are subscribed to again after the period once closed
+	close(changes)
+	next := make(chan struct{})
+	subscribed <- next
+	wait(resubscribed)
+	drain()
+	next <- struct{}{}
+	wait(synced)
+}
+
+func TestDiff(t *testing.T) {
+	old := map[string]int{"a": 1, "b": 2, "c": 3}
+	current := map[string]int{"b": 2, "c": 4, "d": 5}
+
+	started, stopped := Diff(old, current, nil)
+	assert.Equal(t, []int{5}, started)
+	assert.Equal(t, []int{1}, stopped)
+
+	started, stopped = Diff(old, current, func(old, new int) bool { return old != new })
+	sort.Ints(started)
+	sort.Ints(stopped)
+	assert.Equal(t, []int{4, 5}, started)
+	assert.Equal(t, []int{1, 3}, stopped)
+}
+
+func TestPublish(t *testing.T) {
+	b := bus.New(logp.L(), "test")
+	listener := b.Subscribe()
+	defer listener.Stop()
+
+	go Publish(b, "object", []string{"started"}, []string{"stopped"})
+	for _, expected := range []bus.Event{
+		{"stop": true, "object": "stopped"},
+		{"start": true, "object": "started"},
+	} {
+		select {
+		case e := <-listener.Events():
+			assert.Equal(t, expected, e)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for event")
+		}
+	}
+}
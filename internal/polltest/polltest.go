@@ -0,0 +1,119 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package polltest provides the fake APIs, event helpers and common tests shared by the tests of
+// the polling watchers.
+package polltest
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+)
+
+// EventTimeout is the time waited for the events of a watcher
+const EventTimeout = 5 * time.Second
+
+// Watcher is a polling watcher publishing start and stop events
+type Watcher interface {
+	Start() error
+	Stop()
+	ListenStart() bus.Listener
+	ListenStop() bus.Listener
+}
+
+// Source holds the objects listed by a fake API, tests change them while the watcher polls it.
+// It is meant to be embedded in the fakes, implementing the methods of the API with List.
+type Source[T any] struct {
+	lock  sync.Mutex
+	items []T
+	index uint64
+	err   error
+}
+
+// Set replaces the listed objects and increases the index of the listing
+func (s *Source[T]) Set(items ...T) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.items = items
+	s.index++
+}
+
+// Fail makes the listings fail with err, or succeed again if it is nil
+func (s *Source[T]) Fail(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.err = err
+}
+
+// List returns a copy of the objects, the index of the last change and the error of the listings
+func (s *Source[T]) List() ([]T, uint64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]T(nil), s.items...), s.index, s.err
+}
+
+// Start subscribes to the start and stop events of a watcher and starts it, the watcher is
+// stopped when the test finishes
+func Start(t *testing.T, w Watcher) (start, stop bus.Listener) {
+	t.Helper()
+	start = w.ListenStart()
+	stop = w.ListenStop()
+	require.NoError(t, w.Start())
+	t.Cleanup(w.Stop)
+	return start, stop
+}
+
+// NextEvent returns the next event of a listener, failing the test if there is none after
+// EventTimeout
+func NextEvent(t testing.TB, l bus.Listener) bus.Event {
+	t.Helper()
+	select {
+	case e := <-l.Events():
+		return e
+	case <-time.After(EventTimeout):
+		t.Fatal("timeout waiting for event")
+	}
+	return nil
+}
+
+// StartError checks that a watcher fails to start if its first sync fails, newWatcher creates
+// a watcher polling an API failing with err
+func StartError(t *testing.T, newWatcher func(err error) (Watcher, error)) {
+	t.Helper()
+	w, err := newWatcher(errors.New("connection refused"))
+	require.NoError(t, err)
+	assert.Error(t, w.Start())
+}
+
+// FailingServer starts an HTTP server replying to all requests with the status and message, it
+// is closed when the test finishes
+func FailingServer(t testing.TB, status int, message string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, message, status)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
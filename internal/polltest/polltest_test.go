@@ -0,0 +1,70 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package polltest
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+func TestSource(t *testing.T) {
+	var s Source[string]
+	items, index, err := s.List()
+	assert.Empty(t, items)
+	assert.Zero(t, index)
+	assert.NoError(t, err)
+
+	s.Set("a", "b")
+	items, index, err = s.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, items)
+	assert.Equal(t, uint64(1), index)
+
+	// Listings are copies
+	items[0] = "c"
+	items, _, _ = s.List()
+	assert.Equal(t, []string{"a", "b"}, items)
+
+	s.Fail(errors.New("connection refused"))
+	_, _, err = s.List()
+	assert.Error(t, err)
+}
+
+func TestNextEvent(t *testing.T) {
+	b := bus.New(logp.L(), "polltest")
+	listener := b.Subscribe()
+	defer listener.Stop()
+
+	b.Publish(bus.Event{"start": true})
+	assert.Equal(t, bus.Event{"start": true}, NextEvent(t, listener))
+}
+
+func TestFailingServer(t *testing.T) {
+	server := FailingServer(t, http.StatusForbidden, "ACL token not found")
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
@@ -0,0 +1,52 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package knative
+
+import (
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// GenerateMetadata returns the metadata of a revision under the `knative` key, with its namespace
+// under `kubernetes.namespace`
+func GenerateMetadata(r *Revision) mapstr.M {
+	revision := mapstr.M{
+		"name":     r.Name,
+		"uid":      r.UID,
+		"active":   r.Active,
+		"ready":    r.Ready,
+		"replicas": r.ActualReplicas,
+	}
+	knative := mapstr.M{
+		"revision": revision,
+	}
+	if r.Service != "" {
+		_, _ = knative.Put("service.name", r.Service)
+	}
+	if r.Configuration != "" {
+		_, _ = knative.Put("configuration.name", r.Configuration)
+		if r.Generation != "" {
+			_, _ = knative.Put("configuration.generation", r.Generation)
+		}
+	}
+	return mapstr.M{
+		"knative": knative,
+		"kubernetes": mapstr.M{
+			"namespace": r.Namespace,
+		},
+	}
+}
@@ -0,0 +1,95 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package knative
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+)
+
+// Labels set by Knative Serving in the revisions
+const (
+	serviceLabel       = "serving.knative.dev/service"
+	configurationLabel = "serving.knative.dev/configuration"
+	generationLabel    = "serving.knative.dev/configurationGeneration"
+)
+
+// RevisionsResource is the resource of the Knative Serving revisions
+var RevisionsResource = schema.GroupVersionResource{Group: "serving.knative.dev", Version: "v1", Resource: "revisions"}
+
+// Revision of a Knative service
+type Revision struct {
+	Name          string
+	Namespace     string
+	UID           string
+	Service       string
+	Configuration string
+	Generation    string
+	Labels        map[string]string
+	Annotations   map[string]string
+	// Ready is true when the revision can serve requests
+	Ready bool
+	// Active is false when the revision is scaled to zero
+	Active          bool
+	ActualReplicas  int64
+	DesiredReplicas int64
+}
+
+// newRevision parses a revision from its custom resource
+func newRevision(obj *kubernetes.CustomResource) *Revision {
+	labels := obj.GetLabels()
+	r := &Revision{
+		Name:          obj.GetName(),
+		Namespace:     obj.GetNamespace(),
+		UID:           string(obj.GetUID()),
+		Service:       labels[serviceLabel],
+		Configuration: labels[configurationLabel],
+		Generation:    labels[generationLabel],
+		Labels:        labels,
+		Annotations:   obj.GetAnnotations(),
+	}
+	actual, hasActual, _ := unstructured.NestedInt64(obj.Object, "status", "actualReplicas")
+	r.ActualReplicas = actual
+	r.DesiredReplicas, _, _ = unstructured.NestedInt64(obj.Object, "status", "desiredReplicas")
+
+	conditions := map[string]string{}
+	list, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range list {
+		condition, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		t, _ := condition["type"].(string)
+		s, _ := condition["status"].(string)
+		conditions[t] = s
+	}
+	r.Ready = conditions["Ready"] == "True"
+
+	// The Active condition is false while scaled to zero, it is unknown while activating
+	switch conditions["Active"] {
+	case "True":
+		r.Active = true
+	case "False":
+		r.Active = false
+	default:
+		r.Active = !hasActual || actual > 0
+	}
+	return r
+}
@@ -0,0 +1,188 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package knative discovers the revisions of Knative services, following their scale to zero, so
+// monitoring configurations can be paused while revisions have no replicas.
+package knative
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/client-go/dynamic"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// Watcher watches the revisions of Knative services
+type Watcher interface {
+	// Start watching the revisions
+	Start() error
+
+	// Stop watching the revisions
+	Stop()
+
+	// Revisions returns the known revisions by their UID
+	Revisions() map[string]*Revision
+
+	// ListenStart returns a bus listener to receive revision created events, with a `revision`
+	// key holding it. Revisions created while scaled to zero are paused right after.
+	ListenStart() bus.Listener
+
+	// ListenStop returns a bus listener to receive revision deleted events, with a `revision`
+	// key holding it
+	ListenStop() bus.Listener
+
+	// ListenPause returns a bus listener to receive revision scaled to zero events, with a
+	// `revision` key holding it
+	ListenPause() bus.Listener
+
+	// ListenResume returns a bus listener to receive revision activated events, with a
+	// `revision` key holding it
+	ListenResume() bus.Listener
+}
+
+type watcher struct {
+	sync.RWMutex
+	log       *logp.Logger
+	watcher   kubernetes.Watcher
+	revisions map[string]*Revision
+	bus       bus.Bus
+}
+
+// NewWatcher creates a new Watcher of the revisions of the namespace of the options, or of all
+// the namespaces
+func NewWatcher(log *logp.Logger, client dynamic.Interface, opts kubernetes.WatchOptions) (Watcher, error) {
+	rw, err := kubernetes.NewCustomResourceWatcher("knative", client, RevisionsResource, opts, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch knative revisions: %w", err)
+	}
+	w := &watcher{
+		log:       log,
+		watcher:   rw,
+		revisions: make(map[string]*Revision),
+		bus:       bus.New(log, "knative"),
+	}
+	rw.AddEventHandler(kubernetes.ResourceEventHandlerFuncs{
+		AddFunc:    w.update,
+		UpdateFunc: w.update,
+		DeleteFunc: w.delete,
+	})
+	return w, nil
+}
+
+// Start watching the revisions
+func (w *watcher) Start() error {
+	w.log.Debug("Start Knative revisions watcher")
+	return w.watcher.Start()
+}
+
+// Stop watching the revisions
+func (w *watcher) Stop() {
+	w.watcher.Stop()
+}
+
+// Revisions returns the known revisions
+func (w *watcher) Revisions() map[string]*Revision {
+	w.RLock()
+	defer w.RUnlock()
+	res := make(map[string]*Revision, len(w.revisions))
+	for k, v := range w.revisions {
+		res[k] = v
+	}
+	return res
+}
+
+// update publishes the events of revisions created, scaled to zero or activated
+func (w *watcher) update(obj interface{}) {
+	cr, ok := obj.(*kubernetes.CustomResource)
+	if !ok {
+		return
+	}
+	r := newRevision(cr)
+
+	w.Lock()
+	old, known := w.revisions[r.UID]
+	w.revisions[r.UID] = r
+	w.Unlock()
+
+	switch {
+	case !known:
+		w.bus.Publish(bus.Event{
+			"start":    true,
+			"revision": r,
+		})
+		if !r.Active {
+			w.publishPause(r)
+		}
+	case old.Active && !r.Active:
+		w.publishPause(r)
+	case !old.Active && r.Active:
+		w.bus.Publish(bus.Event{
+			"resume":   true,
+			"revision": r,
+		})
+	}
+}
+
+func (w *watcher) publishPause(r *Revision) {
+	w.bus.Publish(bus.Event{
+		"pause":    true,
+		"revision": r,
+	})
+}
+
+// delete publishes the events of deleted revisions
+func (w *watcher) delete(obj interface{}) {
+	cr, ok := obj.(*kubernetes.CustomResource)
+	if !ok {
+		return
+	}
+
+	w.Lock()
+	r, known := w.revisions[string(cr.GetUID())]
+	delete(w.revisions, string(cr.GetUID()))
+	w.Unlock()
+
+	if !known {
+		r = newRevision(cr)
+	}
+	w.bus.Publish(bus.Event{
+		"stop":     true,
+		"revision": r,
+	})
+}
+
+func (w *watcher) ListenStart() bus.Listener {
+	return w.bus.Subscribe("start")
+}
+
+func (w *watcher) ListenStop() bus.Listener {
+	return w.bus.Subscribe("stop")
+}
+
+// ListenPause returns a bus listener to receive revision scaled to zero events, with a `revision` key holding it
+func (w *watcher) ListenPause() bus.Listener {
+	return w.bus.Subscribe("pause")
+}
+
+// ListenResume returns a bus listener to receive revision activated events, with a `revision` key holding it
+func (w *watcher) ListenResume() bus.Listener {
+	return w.bus.Subscribe("resume")
+}
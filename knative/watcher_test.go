@@ -0,0 +1,143 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package knative
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	"github.com/elastic/elastic-agent-autodiscover/internal/polltest"
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func revision(name, active string, replicas int64) *kubernetes.CustomResource {
+	return &kubernetes.CustomResource{Object: map[string]interface{}{
+		"apiVersion": "serving.knative.dev/v1",
+		"kind":       "Revision",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": "default",
+			"uid":       "uid-" + name,
+			"labels": map[string]interface{}{
+				serviceLabel:       "hello",
+				configurationLabel: "hello",
+				generationLabel:    "1",
+			},
+		},
+		"status": map[string]interface{}{
+			"actualReplicas": replicas,
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Ready", "status": "True"},
+				map[string]interface{}{"type": "Active", "status": active},
+			},
+		},
+	}}
+}
+
+func TestWatcher(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{RevisionsResource: "RevisionList"}, revision("hello-00001", "True", 1))
+	revisions := client.Resource(RevisionsResource).Namespace("default")
+
+	w, err := NewWatcher(logp.L(), client, kubernetes.WatchOptions{SyncTimeout: time.Minute})
+	require.NoError(t, err)
+	start := w.ListenStart()
+	stop := w.ListenStop()
+	pause := w.ListenPause()
+	resume := w.ListenResume()
+	require.NoError(t, w.Start())
+	defer w.Stop()
+
+	r := polltest.NextEvent(t, start)["revision"].(*Revision)
+	assert.Equal(t, "hello-00001", r.Name)
+	assert.Equal(t, "hello", r.Service)
+	assert.True(t, r.Active)
+
+	// Scale to zero and activation
+	scaled := revision("hello-00001", "False", 0)
+	scaled.SetResourceVersion("2")
+	_, err = revisions.Update(context.Background(), scaled, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.False(t, polltest.NextEvent(t, pause)["revision"].(*Revision).Active)
+
+	activated := revision("hello-00001", "True", 2)
+	activated.SetResourceVersion("3")
+	_, err = revisions.Update(context.Background(), activated, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), polltest.NextEvent(t, resume)["revision"].(*Revision).ActualReplicas)
+
+	// New revision created while scaled to zero
+	_, err = revisions.Create(context.Background(), revision("hello-00002", "False", 0), metav1.CreateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "hello-00002", polltest.NextEvent(t, start)["revision"].(*Revision).Name)
+	assert.Equal(t, "hello-00002", polltest.NextEvent(t, pause)["revision"].(*Revision).Name)
+	assert.Len(t, w.Revisions(), 2)
+
+	require.NoError(t, revisions.Delete(context.Background(), "hello-00001", metav1.DeleteOptions{}))
+	assert.Equal(t, "hello-00001", polltest.NextEvent(t, stop)["revision"].(*Revision).Name)
+	assert.Len(t, w.Revisions(), 1)
+}
+
+func TestNewRevision(t *testing.T) {
+	// Activating revisions are active if they have replicas
+	r := newRevision(revision("hello-00001", "Unknown", 1))
+	assert.True(t, r.Active)
+	assert.True(t, r.Ready)
+
+	r = newRevision(revision("hello-00001", "Unknown", 0))
+	assert.False(t, r.Active)
+
+	r = newRevision(&kubernetes.CustomResource{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "new", "namespace": "default"},
+	}})
+	assert.True(t, r.Active)
+	assert.False(t, r.Ready)
+}
+
+func TestGenerateMetadata(t *testing.T) {
+	r := newRevision(revision("hello-00001", "False", 0))
+	assert.Equal(t, mapstr.M{
+		"knative": mapstr.M{
+			"service": mapstr.M{"name": "hello"},
+			"configuration": mapstr.M{
+				"name":       "hello",
+				"generation": "1",
+			},
+			"revision": mapstr.M{
+				"name":     "hello-00001",
+				"uid":      "uid-hello-00001",
+				"active":   false,
+				"ready":    true,
+				"replicas": int64(0),
+			},
+		},
+		"kubernetes": mapstr.M{
+			"namespace": "default",
+		},
+	}, GenerateMetadata(r))
+}
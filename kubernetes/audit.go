@@ -0,0 +1,225 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+const (
+	defaultAuditLimit = 10
+	defaultAuditBurst = 100
+
+	redacted = "xxxxx"
+)
+
+// AuditConfig configures the audit log of the requests made to the API server
+type AuditConfig struct {
+	// Enabled logs every request made to the API server
+	Enabled bool `config:"enabled"`
+	// Limit is the number of requests logged per second, 10 by default, the requests exceeding
+	// it are counted in the next logged request
+	Limit float32 `config:"limit" validate:"min=0"`
+	// Burst is the number of requests that can be logged at once, 100 by default
+	Burst int `config:"burst" validate:"min=0"`
+}
+
+// AuditRecord is a request made to the API server
+type AuditRecord struct {
+	Method      string
+	Namespace   string
+	Resource    string
+	Subresource string
+	Name        string
+	// Path is the path of the request, with the values of its sensitive parameters redacted
+	Path string
+	// Latency is the time until the response headers were received, watches last longer
+	Latency time.Duration
+	// Status is the status code of the response, 0 if the request failed
+	Status int
+	Err    error
+}
+
+// WrapAudit adds the audit log of the requests made to the API server to a client config, if
+// enabled. Request headers, and so tokens and credentials, are never logged.
+func WrapAudit(cfg *restclient.Config, audit AuditConfig, logger *logp.Logger) {
+	if !audit.Enabled {
+		return
+	}
+	if logger == nil {
+		logger = logp.NewLogger("kubernetes.audit")
+	}
+	limit, burst := audit.Limit, audit.Burst
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+	if burst <= 0 {
+		burst = defaultAuditBurst
+	}
+	limiter := flowcontrol.NewTokenBucketPassiveRateLimiter(limit, burst)
+	suppressed := new(uint64)
+	cfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &auditTransport{next: rt, logger: logger, limiter: limiter, suppressed: suppressed}
+	})
+}
+
+type auditTransport struct {
+	next       http.RoundTripper
+	logger     *logp.Logger
+	limiter    flowcontrol.PassiveRateLimiter
+	suppressed *uint64 // shared by the transports of the same config
+}
+
+func (t *auditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+
+	record := newAuditRecord(req, time.Since(start))
+	if resp != nil {
+		record.Status = resp.StatusCode
+	}
+	if err != nil {
+		// Transport errors can include the URL of the request
+		record.Err = redactedError{err: err, query: req.URL.RawQuery, redacted: redactQuery(req.URL.RawQuery)}
+	}
+	t.log(record)
+	return resp, err
+}
+
+func (t *auditTransport) log(record AuditRecord) {
+	if !t.limiter.TryAccept() {
+		atomic.AddUint64(t.suppressed, 1)
+		return
+	}
+
+	fields := []interface{}{
+		"method", record.Method,
+		"namespace", record.Namespace,
+		"resource", record.Resource,
+		"subresource", record.Subresource,
+		"name", record.Name,
+		"path", record.Path,
+		"latency", record.Latency,
+		"status", record.Status,
+	}
+	if suppressed := atomic.SwapUint64(t.suppressed, 0); suppressed > 0 {
+		fields = append(fields, "suppressed", suppressed)
+	}
+	if record.Err != nil {
+		fields = append(fields, "error", record.Err.Error())
+		t.logger.Warnw("Kubernetes API request failed", fields...)
+		return
+	}
+	t.logger.Infow("Kubernetes API request", fields...)
+}
+
+// newAuditRecord describes a request from its URL, following the layout of the resource paths
+// of the API server: /api/v1/namespaces/{namespace}/{resource}/{name}/{subresource}, or
+// /apis/{group}/{version}/... for the resources of API groups
+func newAuditRecord(req *http.Request, latency time.Duration) AuditRecord {
+	record := AuditRecord{
+		Method:  req.Method,
+		Path:    req.URL.Path,
+		Latency: latency,
+	}
+	if query := redactQuery(req.URL.RawQuery); query != "" {
+		record.Path += "?" + query
+	}
+
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	switch {
+	case len(parts) >= 2 && parts[0] == "api":
+		parts = parts[2:]
+	case len(parts) >= 3 && parts[0] == "apis":
+		parts = parts[3:]
+	default:
+		// Not a resource path, e.g. /version
+		return record
+	}
+	// Requests of a single namespace, e.g. /api/v1/namespaces/default, have the namespace as name
+	if len(parts) >= 3 && parts[0] == "namespaces" {
+		record.Namespace = parts[1]
+		parts = parts[2:]
+	}
+	if len(parts) > 0 {
+		record.Resource = parts[0]
+	}
+	if len(parts) > 1 {
+		record.Name = parts[1]
+	}
+	if len(parts) > 2 {
+		record.Subresource = parts[2]
+	}
+	return record
+}
+
+// redactQuery redacts the values of the query parameters that may hold credentials
+func redactQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return redacted
+	}
+	for param := range query {
+		if isSensitive(param) {
+			query[param] = []string{redacted}
+		}
+	}
+	return query.Encode()
+}
+
+func isSensitive(param string) bool {
+	param = strings.ToLower(param)
+	for _, word := range []string{"token", "password", "secret", "key"} {
+		if strings.Contains(param, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactedError is an error whose message doesn't include the sensitive query parameters of
+// a request
+type redactedError struct {
+	err      error
+	query    string
+	redacted string
+}
+
+func (e redactedError) Error() string {
+	msg := e.err.Error()
+	if e.query == "" || e.query == e.redacted {
+		return msg
+	}
+	return strings.ReplaceAll(msg, e.query, e.redacted)
+}
+
+func (e redactedError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,125 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+func TestAuditLog(t *testing.T) {
+	require.NoError(t, logp.DevelopmentSetup(logp.ToObserverOutput()))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/namespaces/default/pods/forbidden" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"kind":"PodList","apiVersion":"v1","items":[]}`))
+	}))
+	defer server.Close()
+
+	cfg := &restclient.Config{Host: server.URL, BearerToken: "secret-token"}
+	WrapAudit(cfg, AuditConfig{Enabled: true, Limit: 1, Burst: 2}, nil)
+	client, err := kubernetes.NewForConfig(cfg)
+	require.NoError(t, err)
+
+	_, err = client.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{LabelSelector: "app=nginx"})
+	require.NoError(t, err)
+	_, err = client.CoreV1().Pods("default").Get(context.Background(), "forbidden", metav1.GetOptions{})
+	require.Error(t, err)
+	// Exceeds the limit
+	_, _ = client.CoreV1().Pods("").List(context.Background(), metav1.ListOptions{})
+
+	logs := logp.ObserverLogs().TakeAll()
+	require.Len(t, logs, 2)
+	assert.Equal(t, "kubernetes.audit", logs[0].LoggerName)
+	fields := logs[0].ContextMap()
+	assert.Equal(t, "GET", fields["method"])
+	assert.Equal(t, "default", fields["namespace"])
+	assert.Equal(t, "pods", fields["resource"])
+	assert.Equal(t, "/api/v1/namespaces/default/pods?labelSelector=app%3Dnginx", fields["path"])
+	assert.EqualValues(t, http.StatusOK, fields["status"])
+	assert.Equal(t, "forbidden", logs[1].ContextMap()["name"])
+	assert.EqualValues(t, http.StatusForbidden, logs[1].ContextMap()["status"])
+	for _, entry := range logs {
+		assert.NotContains(t, entry.ContextMap(), "suppressed")
+		for _, v := range entry.ContextMap() {
+			assert.NotContains(t, fmt.Sprint(v), "secret-token")
+		}
+	}
+}
+
+func TestAuditLogSuppressed(t *testing.T) {
+	require.NoError(t, logp.DevelopmentSetup(logp.ToObserverOutput()))
+
+	transport := &auditTransport{
+		logger:     logp.NewLogger("kubernetes.audit"),
+		limiter:    flowcontrol.NewFakeNeverRateLimiter(),
+		suppressed: new(uint64),
+	}
+	transport.log(AuditRecord{Method: http.MethodGet})
+	transport.log(AuditRecord{Method: http.MethodGet})
+	assert.Equal(t, 0, logp.ObserverLogs().Len())
+
+	transport.limiter = flowcontrol.NewFakeAlwaysRateLimiter()
+	transport.log(AuditRecord{Method: http.MethodGet})
+	transport.log(AuditRecord{Method: http.MethodGet})
+	logs := logp.ObserverLogs().TakeAll()
+	require.Len(t, logs, 2)
+	assert.EqualValues(t, 2, logs[0].ContextMap()["suppressed"])
+	assert.NotContains(t, logs[1].ContextMap(), "suppressed")
+}
+
+func TestNewAuditRecord(t *testing.T) {
+	tests := map[string]AuditRecord{
+		"/api/v1/pods":                                 {Resource: "pods"},
+		"/api/v1/namespaces":                           {Resource: "namespaces"},
+		"/api/v1/namespaces/kube-system":               {Resource: "namespaces", Name: "kube-system"},
+		"/api/v1/namespaces/default/pods/nginx/status": {Namespace: "default", Resource: "pods", Name: "nginx", Subresource: "status"},
+		"/apis/apps/v1/namespaces/default/replicasets": {Namespace: "default", Resource: "replicasets"},
+		"/apis/apps/v1/deployments":                    {Resource: "deployments"},
+		"/version":                                     {},
+	}
+	for path, expected := range tests {
+		req := &http.Request{Method: http.MethodGet, URL: &url.URL{Path: path}}
+		expected.Method = http.MethodGet
+		expected.Path = path
+		assert.Equal(t, expected, newAuditRecord(req, 0), path)
+	}
+}
+
+func TestRedactQuery(t *testing.T) {
+	assert.Equal(t, "", redactQuery(""))
+	assert.Equal(t, "access_token=xxxxx&watch=true", redactQuery("watch=true&access_token=abc"))
+	assert.Equal(t, "labelSelector=app%3Dnginx", redactQuery("labelSelector=app%3Dnginx"))
+}
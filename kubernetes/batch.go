@@ -0,0 +1,151 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// EventType is the type of a watcher event
+type EventType string
+
+const (
+	// EventAdd is the type of the events of added objects
+	EventAdd EventType = "add"
+	// EventUpdate is the type of the events of updated objects
+	EventUpdate EventType = "update"
+	// EventDelete is the type of the events of deleted objects
+	EventDelete EventType = "delete"
+)
+
+// BatchEvent is a watcher event delivered in a batch
+type BatchEvent struct {
+	Type EventType
+	Obj  interface{}
+}
+
+// BatchHandler handles the events of a watcher in batches
+type BatchHandler interface {
+	// OnBatch is called with the events received during a batching window, in the order they
+	// were received. Batches are delivered one at a time and in order.
+	OnBatch(events []BatchEvent)
+}
+
+// BatchHandlerFunc is an adaptor to use a function as a BatchHandler
+type BatchHandlerFunc func(events []BatchEvent)
+
+// OnBatch calls the function
+func (f BatchHandlerFunc) OnBatch(events []BatchEvent) {
+	f(events)
+}
+
+// BatchingEventHandler is a ResourceEventHandler grouping the events received during a window, so
+// consumers can reload their configuration once per batch instead of once per object, e.g.
+// during rollouts. The window starts with the first event of every batch, and batches are
+// delivered earlier if they reach their maximum size.
+type BatchingEventHandler struct {
+	handler BatchHandler
+	window  time.Duration
+	maxSize int
+
+	// delivery serializes the delivery of batches, so they are delivered in order
+	delivery sync.Mutex
+
+	mutex   sync.Mutex
+	pending []BatchEvent
+	timer   *time.Timer
+	stopped bool
+}
+
+// NewBatchingEventHandler creates a ResourceEventHandler delivering events in batches to handler,
+// every window or when batches reach maxSize events, zero for no maximum size
+func NewBatchingEventHandler(handler BatchHandler, window time.Duration, maxSize int) (*BatchingEventHandler, error) {
+	if handler == nil {
+		return nil, fmt.Errorf("batch handler is required")
+	}
+	if window <= 0 {
+		return nil, fmt.Errorf("invalid batching window %v", window)
+	}
+	if maxSize < 0 {
+		return nil, fmt.Errorf("invalid maximum batch size %d", maxSize)
+	}
+	return &BatchingEventHandler{
+		handler: handler,
+		window:  window,
+		maxSize: maxSize,
+	}, nil
+}
+
+// OnAdd adds an add event to the current batch
+func (b *BatchingEventHandler) OnAdd(obj interface{}) {
+	b.add(BatchEvent{Type: EventAdd, Obj: obj})
+}
+
+// OnUpdate adds an update event to the current batch
+func (b *BatchingEventHandler) OnUpdate(obj interface{}) {
+	b.add(BatchEvent{Type: EventUpdate, Obj: obj})
+}
+
+// OnDelete adds a delete event to the current batch
+func (b *BatchingEventHandler) OnDelete(obj interface{}) {
+	b.add(BatchEvent{Type: EventDelete, Obj: obj})
+}
+
+func (b *BatchingEventHandler) add(event BatchEvent) {
+	b.mutex.Lock()
+	b.pending = append(b.pending, event)
+	full := b.stopped || (b.maxSize > 0 && len(b.pending) >= b.maxSize)
+	if !full && b.timer == nil {
+		b.timer = time.AfterFunc(b.window, b.Flush)
+	}
+	b.mutex.Unlock()
+
+	if full {
+		b.Flush()
+	}
+}
+
+// Flush delivers the pending events without waiting for the end of the window
+func (b *BatchingEventHandler) Flush() {
+	b.delivery.Lock()
+	defer b.delivery.Unlock()
+
+	b.mutex.Lock()
+	events := b.pending
+	b.pending = nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.mutex.Unlock()
+
+	if len(events) > 0 {
+		b.handler.OnBatch(events)
+	}
+}
+
+// Stop delivers the pending events, the events received after stopping are delivered
+// immediately in batches of one event
+func (b *BatchingEventHandler) Stop() {
+	b.mutex.Lock()
+	b.stopped = true
+	b.mutex.Unlock()
+	b.Flush()
+}
@@ -0,0 +1,102 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type batchRecorder struct {
+	sync.Mutex
+	batches [][]BatchEvent
+}
+
+func (r *batchRecorder) OnBatch(events []BatchEvent) {
+	r.Lock()
+	defer r.Unlock()
+	r.batches = append(r.batches, events)
+}
+
+func (r *batchRecorder) get() [][]BatchEvent {
+	r.Lock()
+	defer r.Unlock()
+	return append([][]BatchEvent(nil), r.batches...)
+}
+
+func TestBatchingEventHandler(t *testing.T) {
+	recorder := &batchRecorder{}
+	handler, err := NewBatchingEventHandler(recorder, 50*time.Millisecond, 0)
+	require.NoError(t, err)
+
+	pod1 := &Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod1"}}
+	pod2 := &Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod2"}}
+	handler.OnAdd(pod1)
+	handler.OnUpdate(pod1)
+	handler.OnDelete(pod2)
+	assert.Empty(t, recorder.get())
+
+	require.Eventually(t, func() bool { return len(recorder.get()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []BatchEvent{
+		{Type: EventAdd, Obj: pod1},
+		{Type: EventUpdate, Obj: pod1},
+		{Type: EventDelete, Obj: pod2},
+	}, recorder.get()[0])
+
+	// Next window starts with the next event
+	handler.OnAdd(pod2)
+	require.Eventually(t, func() bool { return len(recorder.get()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []BatchEvent{{Type: EventAdd, Obj: pod2}}, recorder.get()[1])
+}
+
+func TestBatchingEventHandlerMaxSize(t *testing.T) {
+	recorder := &batchRecorder{}
+	handler, err := NewBatchingEventHandler(recorder, time.Hour, 2)
+	require.NoError(t, err)
+
+	pod := &Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod"}}
+	handler.OnAdd(pod)
+	handler.OnUpdate(pod)
+	handler.OnUpdate(pod)
+	assert.Equal(t, [][]BatchEvent{{{Type: EventAdd, Obj: pod}, {Type: EventUpdate, Obj: pod}}}, recorder.get())
+
+	// Pending events are delivered on stop, and later events immediately
+	handler.Stop()
+	handler.OnDelete(pod)
+	assert.Equal(t, [][]BatchEvent{
+		{{Type: EventAdd, Obj: pod}, {Type: EventUpdate, Obj: pod}},
+		{{Type: EventUpdate, Obj: pod}},
+		{{Type: EventDelete, Obj: pod}},
+	}, recorder.get())
+}
+
+func TestNewBatchingEventHandlerValidation(t *testing.T) {
+	handler := BatchHandlerFunc(func([]BatchEvent) {})
+
+	_, err := NewBatchingEventHandler(nil, time.Second, 0)
+	assert.Error(t, err)
+	_, err = NewBatchingEventHandler(handler, 0, 0)
+	assert.Error(t, err)
+	_, err = NewBatchingEventHandler(handler, time.Second, -1)
+	assert.Error(t, err)
+}
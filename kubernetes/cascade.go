@@ -0,0 +1,133 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/cache"
+)
+
+// NamespaceCascadeHandler wraps the handler of the watcher of namespaces. When a namespace is
+// deleted, the objects of the namespace in the stores of the watchers, e.g. of pods and services,
+// are queued for deletion in the watchers, instead of waiting for their own delete events that
+// can be missed during the teardown of the namespace. Later events of these objects are not
+// handled, unless they are objects created again.
+func NamespaceCascadeHandler(next ResourceEventHandler, watchers ...Watcher) ResourceEventHandler {
+	if next == nil {
+		next = NoOpEventHandlerFuncs{}
+	}
+	return ResourceEventHandlerFuncs{
+		AddFunc:    next.OnAdd,
+		UpdateFunc: next.OnUpdate,
+		DeleteFunc: func(obj interface{}) {
+			next.OnDelete(obj)
+
+			if deleted, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = deleted.Obj
+			}
+			ns, ok := obj.(*Namespace)
+			if !ok {
+				return
+			}
+			for _, w := range watchers {
+				if w, ok := w.(*watcher); ok {
+					w.cascadeDelete(ns.Name)
+				}
+			}
+		},
+	}
+}
+
+// cascadeDelete queues the deletion of the objects of a deleted namespace
+func (w *watcher) cascadeDelete(namespace string) {
+	w.pruneCascaded()
+
+	var objs []interface{}
+	if indexer, ok := w.store.(cache.Indexer); ok {
+		if indexed, err := indexer.ByIndex(cache.NamespaceIndex, namespace); err == nil {
+			objs = indexed
+		}
+	}
+	if objs == nil {
+		for _, obj := range w.store.List() {
+			if o, err := meta.Accessor(obj); err == nil && o.GetNamespace() == namespace {
+				objs = append(objs, obj)
+			}
+		}
+	}
+	if len(objs) == 0 {
+		return
+	}
+
+	w.logger.Debugf("Deleting %d objects of deleted namespace %s", len(objs), namespace)
+	for _, obj := range objs {
+		o, err := meta.Accessor(obj)
+		if err != nil {
+			continue
+		}
+		key := o.GetNamespace() + "/" + o.GetName()
+
+		w.cascaded.Store(key, o.GetUID())
+
+		w.queue.Add(&item{key, obj, delete})
+		w.metrics.enqueued(delete, w.queue.Len())
+	}
+}
+
+// skipCascaded returns true if the event of an object is not handled because its deletion was
+// already queued with the deletion of its namespace
+func (w *watcher) skipCascaded(key string, obj interface{}, state string) bool {
+	uid, ok := w.cascaded.Load(key)
+	if !ok {
+		return false
+	}
+	switch state {
+	case delete:
+		w.cascaded.Delete(key)
+		return true
+	case add:
+		// Resyncs are enqueued as adds, objects created again have another UID
+		if o, err := meta.Accessor(obj); err == nil && o.GetUID() == uid {
+			return true
+		}
+		w.cascaded.Delete(key)
+		return false
+	default:
+		return true
+	}
+}
+
+// pruneCascaded forgets the objects deleted with their namespace whose own delete event was
+// missed, they are not in the store anymore or they were created again, so the entries don't
+// pile up when namespaces are deleted
+func (w *watcher) pruneCascaded() {
+	w.cascaded.Range(func(key, uid interface{}) bool {
+		obj, exists, err := w.store.GetByKey(key.(string))
+		if err != nil {
+			return true
+		}
+		if !exists {
+			w.cascaded.Delete(key)
+			return true
+		}
+		if o, err := meta.Accessor(obj); err == nil && o.GetUID() != uid {
+			w.cascaded.Delete(key)
+		}
+		return true
+	})
+}
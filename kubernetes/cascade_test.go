@@ -0,0 +1,115 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestNamespaceCascadeHandler(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	w, err := NewWatcher(client, &Pod{}, WatchOptions{}, nil)
+	require.NoError(t, err)
+	pods := w.(*watcher)
+
+	web := &Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "team-a", UID: "1"}}
+	db := &Pod{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "team-a", UID: "2"}}
+	other := &Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "team-b", UID: "3"}}
+	for _, pod := range []*Pod{web, db, other} {
+		require.NoError(t, pods.store.Add(pod))
+	}
+
+	var events []string
+	record := func(event string) func(interface{}) {
+		return func(obj interface{}) {
+			key, _ := cache.MetaNamespaceKeyFunc(obj)
+			events = append(events, event+" "+key)
+		}
+	}
+	pods.AddEventHandler(ResourceEventHandlerFuncs{AddFunc: record("add"), UpdateFunc: record("update"), DeleteFunc: record("delete")})
+
+	deletedNamespaces := 0
+	handler := NamespaceCascadeHandler(ResourceEventHandlerFuncs{DeleteFunc: func(interface{}) { deletedNamespaces++ }}, pods)
+	handler.OnDelete(cache.DeletedFinalStateUnknown{Key: "team-a", Obj: &Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}})
+	assert.Equal(t, 1, deletedNamespaces)
+	assert.Equal(t, 2, pods.queue.Len())
+	assert.True(t, pods.process(context.Background()))
+	assert.True(t, pods.process(context.Background()))
+	assert.ElementsMatch(t, []string{"delete team-a/web", "delete team-a/db"}, events)
+	events = nil
+
+	// Later events of the deleted objects are not queued
+	pods.enqueue(web, update)
+	pods.enqueue(web, add)
+	pods.enqueue(web, delete)
+	assert.Equal(t, 0, pods.queue.Len())
+
+	// Objects created again are handled
+	recreated := &Pod{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "team-a", UID: "4"}}
+	require.NoError(t, pods.store.Update(recreated))
+	pods.enqueue(recreated, add)
+	require.Equal(t, 1, pods.queue.Len())
+	assert.True(t, pods.process(context.Background()))
+	assert.Equal(t, []string{"add team-a/db"}, events)
+}
+
+func TestNamespaceCascadeHandlerPrune(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	w, err := NewWatcher(client, &Pod{}, WatchOptions{}, nil)
+	require.NoError(t, err)
+	pods := w.(*watcher)
+
+	web := &Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "team-a", UID: "1"}}
+	db := &Pod{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "team-a", UID: "2"}}
+	other := &Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "team-b", UID: "3"}}
+	for _, pod := range []*Pod{web, db, other} {
+		require.NoError(t, pods.store.Add(pod))
+	}
+
+	handler := NamespaceCascadeHandler(nil, pods)
+	handler.OnDelete(&Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}})
+	for pods.queue.Len() > 0 {
+		assert.True(t, pods.process(context.Background()))
+	}
+	assert.Equal(t, 2, cascadedLen(pods))
+
+	// The delete events of the objects are missed, one is gone and the other one was created again
+	require.NoError(t, pods.store.Delete(web))
+	require.NoError(t, pods.store.Update(&Pod{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "team-a", UID: "4"}}))
+
+	handler.OnDelete(&Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b"}})
+	_, ok := pods.cascaded.Load("team-b/web")
+	assert.True(t, ok)
+	assert.Equal(t, 1, cascadedLen(pods))
+}
+
+func cascadedLen(w *watcher) int {
+	n := 0
+	w.cascaded.Range(func(_, _ interface{}) bool {
+		n++
+		return true
+	})
+	return n
+}
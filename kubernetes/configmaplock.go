@@ -0,0 +1,150 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// Lock types removed from client-go, still supported for clusters without the Lease API
+const (
+	lockTypeConfigMaps       = "configmaps"
+	lockTypeConfigMapsLeases = "configmapsleases"
+)
+
+// newResourceLock creates the lock of the given type
+func newResourceLock(lockType, namespace, name string, client kubernetes.Interface, rlc resourcelock.ResourceLockConfig) (resourcelock.Interface, error) {
+	switch lockType {
+	case lockTypeConfigMaps:
+		return newConfigMapLock(namespace, name, client, rlc), nil
+	case lockTypeConfigMapsLeases:
+		leaseLock, err := resourcelock.New(resourcelock.LeasesResourceLock, namespace, name, client.CoreV1(), client.CoordinationV1(), rlc)
+		if err != nil {
+			return nil, err
+		}
+		return &resourcelock.MultiLock{
+			Primary:   newConfigMapLock(namespace, name, client, rlc),
+			Secondary: leaseLock,
+		}, nil
+	}
+	return resourcelock.New(lockType, namespace, name, client.CoreV1(), client.CoordinationV1(), rlc)
+}
+
+// configMapLock keeps the leader election record in an annotation of a ConfigMap
+type configMapLock struct {
+	meta       metav1.ObjectMeta
+	client     corev1client.ConfigMapsGetter
+	lockConfig resourcelock.ResourceLockConfig
+	cm         *v1.ConfigMap
+}
+
+func newConfigMapLock(namespace, name string, client kubernetes.Interface, rlc resourcelock.ResourceLockConfig) *configMapLock {
+	return &configMapLock{
+		meta:       metav1.ObjectMeta{Namespace: namespace, Name: name},
+		client:     client.CoreV1(),
+		lockConfig: rlc,
+	}
+}
+
+// Get returns the election record from the annotation of the ConfigMap
+func (l *configMapLock) Get(ctx context.Context) (*resourcelock.LeaderElectionRecord, []byte, error) {
+	cm, err := l.client.ConfigMaps(l.meta.Namespace).Get(ctx, l.meta.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	l.cm = cm
+
+	var record resourcelock.LeaderElectionRecord
+	recordBytes, found := cm.Annotations[resourcelock.LeaderElectionRecordAnnotationKey]
+	if found {
+		if err := json.Unmarshal([]byte(recordBytes), &record); err != nil {
+			return nil, nil, err
+		}
+	}
+	return &record, []byte(recordBytes), nil
+}
+
+// Create creates the ConfigMap with the election record
+func (l *configMapLock) Create(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	recordBytes, err := json.Marshal(ler)
+	if err != nil {
+		return err
+	}
+	l.cm, err = l.client.ConfigMaps(l.meta.Namespace).Create(ctx, &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      l.meta.Name,
+			Namespace: l.meta.Namespace,
+			Annotations: map[string]string{
+				resourcelock.LeaderElectionRecordAnnotationKey: string(recordBytes),
+			},
+		},
+	}, metav1.CreateOptions{})
+	return err
+}
+
+// Update updates the election record of the ConfigMap
+func (l *configMapLock) Update(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	if l.cm == nil {
+		return errors.New("configmap not initialized, call get or create first")
+	}
+	recordBytes, err := json.Marshal(ler)
+	if err != nil {
+		return err
+	}
+	if l.cm.Annotations == nil {
+		l.cm.Annotations = make(map[string]string)
+	}
+	l.cm.Annotations[resourcelock.LeaderElectionRecordAnnotationKey] = string(recordBytes)
+	cm, err := l.client.ConfigMaps(l.meta.Namespace).Update(ctx, l.cm, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	l.cm = cm
+	return nil
+}
+
+// RecordEvent records an event of the election on the ConfigMap
+func (l *configMapLock) RecordEvent(s string) {
+	if l.lockConfig.EventRecorder == nil || l.cm == nil {
+		return
+	}
+	subject := &v1.ConfigMap{ObjectMeta: l.cm.ObjectMeta}
+	// Populate the type meta, so it doesn't need to be taken from the scheme
+	subject.Kind = "ConfigMap"
+	subject.APIVersion = v1.SchemeGroupVersion.String()
+	l.lockConfig.EventRecorder.Eventf(subject, v1.EventTypeNormal, "LeaderElection", fmt.Sprintf("%v %v", l.lockConfig.Identity, s))
+}
+
+// Describe returns the namespace and name of the ConfigMap
+func (l *configMapLock) Describe() string {
+	return fmt.Sprintf("%v/%v", l.meta.Namespace, l.meta.Name)
+}
+
+// Identity returns the identity of the participant
+func (l *configMapLock) Identity() string {
+	return l.lockConfig.Identity
+}
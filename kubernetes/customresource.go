@@ -0,0 +1,73 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ParseGroupVersionResource parses resources given as `resource.group/version`, like
+// `monitoringtargets.example.com/v1`
+func ParseGroupVersionResource(s string) (schema.GroupVersionResource, error) {
+	resourceGroup, version, _ := strings.Cut(s, "/")
+	resource, group, _ := strings.Cut(resourceGroup, ".")
+	if resource == "" || version == "" || strings.Contains(version, "/") {
+		return schema.GroupVersionResource{}, fmt.Errorf("invalid custom resource %q, expected resource.group/version", s)
+	}
+	return schema.GroupVersionResource{Group: group, Version: version, Resource: resource}, nil
+}
+
+// NewCustomResourceInformer creates an informer for the instances of a custom resource definition,
+// as CustomResource objects. The node filter of the options is not supported by custom resources.
+func NewCustomResourceInformer(client dynamic.Interface, gvr schema.GroupVersionResource, opts WatchOptions, indexers cache.Indexers) cache.SharedInformer {
+	ctx := context.TODO()
+	r := client.Resource(gvr).Namespace(opts.Namespace)
+	listwatch := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return r.List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return r.Watch(ctx, options)
+		},
+	}
+
+	if indexers == nil {
+		indexers = cache.Indexers{}
+	}
+	return cache.NewSharedIndexInformer(listwatch, &CustomResource{}, opts.SyncTimeout, indexers)
+}
+
+// NewCustomResourceWatcher initializes a watcher of the instances of a custom resource definition,
+// so they can be used as discovery targets. Client returns nil for these watchers, as they use a
+// dynamic client.
+func NewCustomResourceWatcher(name string, client dynamic.Interface, gvr schema.GroupVersionResource, opts WatchOptions, indexers cache.Indexers) (Watcher, error) {
+	if gvr.Resource == "" || gvr.Version == "" {
+		return nil, fmt.Errorf("custom resource and version are required, got %q", gvr.String())
+	}
+	informer := NewCustomResourceInformer(client, gvr, opts, indexers)
+	return newInformerWatcher(name, nil, informer, &CustomResource{}, opts), nil
+}
@@ -0,0 +1,84 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestParseGroupVersionResource(t *testing.T) {
+	gvr, err := ParseGroupVersionResource("monitoringtargets.example.com/v1")
+	require.NoError(t, err)
+	assert.Equal(t, schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "monitoringtargets"}, gvr)
+
+	_, err = ParseGroupVersionResource("monitoringtargets")
+	assert.Error(t, err)
+}
+
+func TestCustomResourceWatcher(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "monitoringtargets"}
+	target := &CustomResource{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "MonitoringTarget",
+		"metadata":   map[string]interface{}{"name": "redis", "namespace": "default"},
+		"spec":       map[string]interface{}{"module": "redis"},
+	}}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvr: "MonitoringTargetList"}, target)
+
+	watcher, err := NewCustomResourceWatcher("", client, gvr, WatchOptions{Namespace: "default"}, nil)
+	require.NoError(t, err)
+	assert.Nil(t, watcher.Client())
+
+	added := make(chan *CustomResource, 2)
+	deleted := make(chan *CustomResource, 1)
+	watcher.AddEventHandler(ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { added <- obj.(*CustomResource) },
+		DeleteFunc: func(obj interface{}) { deleted <- obj.(*CustomResource) },
+	})
+	require.NoError(t, watcher.Start())
+	defer watcher.Stop()
+
+	assert.Equal(t, "redis", receive(t, added).GetName())
+
+	require.NoError(t, client.Resource(gvr).Namespace("default").Delete(context.Background(), "redis", metav1.DeleteOptions{}))
+	assert.Equal(t, "redis", receive(t, deleted).GetName())
+
+	_, err = NewCustomResourceWatcher("", client, schema.GroupVersionResource{Resource: "monitoringtargets"}, WatchOptions{}, nil)
+	assert.Error(t, err)
+}
+
+func receive(t *testing.T, c chan *CustomResource) *CustomResource {
+	t.Helper()
+	select {
+	case obj := <-c:
+		return obj
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for custom resource event")
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// maxRecentErrors is the number of errors kept by every watcher
+const maxRecentErrors = 10
+
+// WatcherError is an error of a watcher, like a failed watch request
+type WatcherError struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+	// Forbidden is true if the request was forbidden by RBAC
+	Forbidden bool `json:"forbidden,omitempty"`
+}
+
+// WatcherState is the internal state of a watcher, to debug it
+type WatcherState struct {
+	// Synced is true once the store of the watcher is synced with the API
+	Synced bool `json:"synced"`
+
+	// SyncedAt is the time when the store of the watcher was synced
+	SyncedAt time.Time `json:"synced_at"`
+
+	// Errors are the last errors of the watcher, oldest first
+	Errors []WatcherError `json:"errors,omitempty"`
+}
+
+// InspectWatcher returns the internal state of the watchers of this package, for other watchers
+// it only reports them as synced
+func InspectWatcher(w Watcher) WatcherState {
+	w2, ok := w.(*watcher)
+	if !ok {
+		return WatcherState{Synced: true}
+	}
+	return WatcherState{
+		Synced:   w2.informer.HasSynced(),
+		SyncedAt: w2.syncedAt(),
+		Errors:   w2.errors.list(),
+	}
+}
+
+// recentErrors keeps the last errors of a watcher
+type recentErrors struct {
+	sync.Mutex
+	errors []WatcherError
+	next   int
+}
+
+func (r *recentErrors) add(err error) {
+	r.Lock()
+	defer r.Unlock()
+
+	e := WatcherError{Time: time.Now(), Message: err.Error(), Forbidden: isForbidden(err)}
+	if len(r.errors) < maxRecentErrors {
+		r.errors = append(r.errors, e)
+		return
+	}
+	r.errors[r.next] = e
+	r.next = (r.next + 1) % maxRecentErrors
+}
+
+func (r *recentErrors) list() []WatcherError {
+	r.Lock()
+	defer r.Unlock()
+
+	if len(r.errors) == 0 {
+		return nil
+	}
+	ordered := make([]WatcherError, 0, len(r.errors))
+	ordered = append(ordered, r.errors[r.next:]...)
+	return append(ordered, r.errors[:r.next]...)
+}
+
+// isForbidden returns true if err is a forbidden API error, also when the informer wrapped it
+// into the message of another error
+func isForbidden(err error) bool {
+	return apierrors.IsForbidden(err) || strings.Contains(err.Error(), " is forbidden: ")
+}
@@ -0,0 +1,192 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package debug dumps the internal state of kubernetes watchers and metadata generators, to
+// attach it to the diagnostics of the agent: the sync state, store size and recent errors of
+// every watcher, the usage of the metadata caches, and the metadata generated for an object.
+//
+// A Dumper can be served with any HTTP server:
+//
+//	dumper := debug.NewDumper()
+//	dumper.AddWatcher("pod", podWatcher, podMetaGen)
+//	mux.Handle("/debug/kubernetes", dumper)
+//
+// Requests with an `uid` query parameter include the metadata of the object with that UID.
+package debug
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes/metadata"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// Dump is the internal state of the watchers and metadata generators of a Dumper
+type Dump struct {
+	Time         time.Time              `json:"time"`
+	Watchers     map[string]WatcherDump `json:"watchers"`
+	SharedCaches CacheDump              `json:"shared_caches"`
+	Sample       *Sample                `json:"sample,omitempty"`
+}
+
+// WatcherDump is the state of a watcher
+type WatcherDump struct {
+	Synced  bool                      `json:"synced"`
+	Objects int                       `json:"objects"`
+	Bytes   int64                     `json:"bytes"`
+	Queued  int                       `json:"queued"`
+	Errors  []kubernetes.WatcherError `json:"errors,omitempty"`
+	// Cache is the usage of the metadata cache of the watcher, if its generator is cached
+	Cache *CacheDump `json:"cache,omitempty"`
+}
+
+// CacheDump is the usage of a metadata cache
+type CacheDump struct {
+	Entries int   `json:"entries"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// Sample is the metadata generated for an object
+type Sample struct {
+	UID      string   `json:"uid"`
+	Watcher  string   `json:"watcher,omitempty"`
+	Metadata mapstr.M `json:"metadata,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// Dumper dumps the state of the watchers added to it, it is an http.Handler serving the dumps
+// as JSON
+type Dumper struct {
+	sync.RWMutex
+	watchers map[string]dumpedWatcher
+}
+
+type dumpedWatcher struct {
+	watcher kubernetes.Watcher
+	gen     metadata.MetaGen
+}
+
+// NewDumper creates a Dumper without watchers
+func NewDumper() *Dumper {
+	return &Dumper{watchers: make(map[string]dumpedWatcher)}
+}
+
+// AddWatcher adds a watcher to the dumps, with the generator of the metadata of its objects if
+// not nil. Adding a watcher with the name of another one replaces it.
+func (d *Dumper) AddWatcher(name string, w kubernetes.Watcher, gen metadata.MetaGen) {
+	d.Lock()
+	defer d.Unlock()
+	d.watchers[name] = dumpedWatcher{watcher: w, gen: gen}
+}
+
+// RemoveWatcher removes a watcher from the dumps, e.g. once it is stopped
+func (d *Dumper) RemoveWatcher(name string) {
+	d.Lock()
+	defer d.Unlock()
+	delete(d.watchers, name)
+}
+
+// Dump returns the state of the watchers, with the metadata generated for the object with the
+// given UID if it is not empty. Stores are listed to measure them, so dumps should not be taken
+// periodically.
+func (d *Dumper) Dump(uid string) Dump {
+	d.RLock()
+	names := make([]string, 0, len(d.watchers))
+	watchers := make(map[string]dumpedWatcher, len(d.watchers))
+	for name, w := range d.watchers {
+		names = append(names, name)
+		watchers[name] = w
+	}
+	d.RUnlock()
+	sort.Strings(names)
+
+	shared := metadata.SharedCachesUsage()
+	dump := Dump{
+		Time:         time.Now(),
+		Watchers:     make(map[string]WatcherDump, len(watchers)),
+		SharedCaches: CacheDump{Entries: shared.Entries, Bytes: shared.Bytes},
+	}
+	for _, name := range names {
+		dump.Watchers[name] = dumpWatcher(watchers[name])
+	}
+
+	if uid != "" {
+		dump.Sample = &Sample{UID: uid, Error: "no object found with this UID"}
+		for _, name := range names {
+			w := watchers[name]
+			if w.gen == nil {
+				continue
+			}
+			if obj := findByUID(w.watcher, uid); obj != nil {
+				dump.Sample = &Sample{UID: uid, Watcher: name, Metadata: w.gen.Generate(obj)}
+				break
+			}
+		}
+	}
+	return dump
+}
+
+// ServeHTTP writes the dump as JSON, with the metadata of the object of the `uid` query parameter
+func (d *Dumper) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(d.Dump(r.URL.Query().Get("uid")))
+}
+
+func dumpWatcher(w dumpedWatcher) WatcherDump {
+	state := kubernetes.InspectWatcher(w.watcher)
+	usage := kubernetes.MeasureWatcher(w.watcher)
+	dump := WatcherDump{
+		Synced:  state.Synced,
+		Objects: usage.Objects,
+		Bytes:   usage.Bytes,
+		Queued:  usage.Queued,
+		Errors:  state.Errors,
+	}
+	if cached, ok := w.gen.(metadata.CachedMetaGen); ok {
+		usage := cached.Usage()
+		dump.Cache = &CacheDump{Entries: usage.Entries, Bytes: usage.Bytes}
+	}
+	return dump
+}
+
+func findByUID(w kubernetes.Watcher, uid string) kubernetes.Resource {
+	for _, obj := range w.Store().List() {
+		resource, ok := obj.(kubernetes.Resource)
+		if !ok {
+			continue
+		}
+		if accessor, err := meta.Accessor(resource); err == nil && string(accessor.GetUID()) == uid {
+			return resource
+		}
+	}
+	return nil
+}
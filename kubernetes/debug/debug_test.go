@@ -0,0 +1,114 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package debug
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes/metadata"
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+func TestDumper(t *testing.T) {
+	pod := &kubernetes.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", UID: "a8cf6fd2", ResourceVersion: "1"}}
+	client := k8sfake.NewSimpleClientset(pod)
+	watcher, err := kubernetes.NewWatcher(client, &kubernetes.Pod{}, kubernetes.WatchOptions{}, nil)
+	require.NoError(t, err)
+	require.NoError(t, watcher.Start())
+	defer watcher.Stop()
+
+	gen, err := metadata.NewCachedMetadataGenerator(metadata.NewPodMetadataGenerator(config.NewConfig(), watcher.Store(), client, nil, nil, nil, nil, &metadata.AddResourceMetadataConfig{}), time.Minute)
+	require.NoError(t, err)
+	dumper := NewDumper()
+	dumper.AddWatcher("pod", watcher, gen)
+	dumper.AddWatcher("removed", watcher, nil)
+	dumper.RemoveWatcher("removed")
+
+	dump := dumper.Dump("")
+	assert.Nil(t, dump.Sample)
+	require.Contains(t, dump.Watchers, "pod")
+	assert.NotContains(t, dump.Watchers, "removed")
+	assert.True(t, dump.Watchers["pod"].Synced)
+	assert.Equal(t, 1, dump.Watchers["pod"].Objects)
+	assert.Greater(t, dump.Watchers["pod"].Bytes, int64(0))
+	assert.Equal(t, &CacheDump{}, dump.Watchers["pod"].Cache)
+
+	dump = dumper.Dump("a8cf6fd2")
+	require.NotNil(t, dump.Sample)
+	assert.Equal(t, "pod", dump.Sample.Watcher)
+	assert.Empty(t, dump.Sample.Error)
+	name, err := dump.Sample.Metadata.GetValue("kubernetes.pod.name")
+	require.NoError(t, err)
+	assert.Equal(t, "web", name)
+
+	// Watchers are dumped before generating the sample
+	dump = dumper.Dump("unknown")
+	assert.Equal(t, &Sample{UID: "unknown", Error: "no object found with this UID"}, dump.Sample)
+	assert.Equal(t, 1, dump.Watchers["pod"].Cache.Entries)
+}
+
+func TestDumperHandler(t *testing.T) {
+	pod := &kubernetes.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", UID: "a8cf6fd2"}}
+	client := k8sfake.NewSimpleClientset(pod)
+	watcher, err := kubernetes.NewWatcher(client, &kubernetes.Pod{}, kubernetes.WatchOptions{}, nil)
+	require.NoError(t, err)
+	require.NoError(t, watcher.Start())
+	defer watcher.Stop()
+
+	dumper := NewDumper()
+	dumper.AddWatcher("pod", watcher, metadata.NewPodMetadataGenerator(config.NewConfig(), watcher.Store(), client, nil, nil, nil, nil, &metadata.AddResourceMetadataConfig{}))
+	server := httptest.NewServer(dumper)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?uid=a8cf6fd2")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	var dump struct {
+		Watchers map[string]struct {
+			Synced  bool `json:"synced"`
+			Objects int  `json:"objects"`
+		} `json:"watchers"`
+		Sample struct {
+			Watcher  string                 `json:"watcher"`
+			Metadata map[string]interface{} `json:"metadata"`
+		} `json:"sample"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&dump))
+	assert.True(t, dump.Watchers["pod"].Synced)
+	assert.Equal(t, 1, dump.Watchers["pod"].Objects)
+	assert.Equal(t, "pod", dump.Sample.Watcher)
+	assert.Contains(t, dump.Sample.Metadata, "kubernetes")
+
+	resp, err = http.Post(server.URL, "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
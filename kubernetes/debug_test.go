@@ -0,0 +1,73 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRecentErrors(t *testing.T) {
+	var r recentErrors
+	assert.Nil(t, r.list())
+
+	for i := 0; i < maxRecentErrors+3; i++ {
+		r.add(fmt.Errorf("error %d", i))
+	}
+	list := r.list()
+	require.Len(t, list, maxRecentErrors)
+	assert.Equal(t, "error 3", list[0].Message)
+	assert.Equal(t, fmt.Sprintf("error %d", maxRecentErrors+2), list[maxRecentErrors-1].Message)
+}
+
+func TestInspectWatcher(t *testing.T) {
+	client := k8sfake.NewSimpleClientset(&Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}})
+	w, err := NewWatcher(client, &Pod{}, WatchOptions{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, WatcherState{}, InspectWatcher(w))
+
+	require.NoError(t, w.Start())
+	defer w.Stop()
+	w.(*watcher).errors.add(errors.New("watch failed"))
+
+	w.(*watcher).errors.add(apierrors.NewForbidden(v1.Resource("pods"), "", errors.New("rbac")))
+
+	state := InspectWatcher(w)
+	assert.True(t, state.Synced)
+	assert.False(t, state.SyncedAt.IsZero())
+	require.Len(t, state.Errors, 2)
+	assert.Equal(t, "watch failed", state.Errors[0].Message)
+	assert.False(t, state.Errors[0].Forbidden)
+	assert.True(t, state.Errors[1].Forbidden)
+}
+
+func TestIsForbidden(t *testing.T) {
+	forbidden := apierrors.NewForbidden(v1.Resource("pods"), "", errors.New("rbac"))
+	assert.True(t, isForbidden(forbidden))
+	// Informers wrap list errors in their messages
+	assert.True(t, isForbidden(fmt.Errorf("failed to list *v1.Pod: %v", forbidden)))
+	assert.False(t, isForbidden(errors.New("connection refused")))
+}
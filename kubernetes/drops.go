@@ -0,0 +1,68 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// DropReason is the reason why events of a watcher may have been lost
+type DropReason string
+
+const (
+	// DropDeletedFinalStateUnknown is the reason of the deletions missed while the watch was
+	// disconnected, the handlers receive the last known state of the object
+	DropDeletedFinalStateUnknown DropReason = "deleted_final_state_unknown"
+	// DropWatchExpired is the reason of the watches whose resource version expired, the changes
+	// since then are coalesced into the listing of the objects
+	DropWatchExpired DropReason = "watch_expired"
+	// DropWatchError is the reason of the failed watches, changes are missed until the objects
+	// are listed again
+	DropWatchError DropReason = "watch_error"
+	// DropObjectGone is the reason of the queued add and update events not handled because the
+	// object was deleted before, they are coalesced with its deletion
+	DropObjectGone DropReason = "object_gone"
+)
+
+// DroppedEvent describes events of a watcher that may have been lost
+type DroppedEvent struct {
+	Reason DropReason
+	// Key is the namespace/name key of the object, empty for watch failures
+	Key string
+	// Err is the error of watch failures
+	Err error
+}
+
+// DropHandler is called when events of a watcher may have been lost, it is called by the
+// goroutines of the watcher, so it must not block
+type DropHandler func(DroppedEvent)
+
+// watchDropReason returns the reason of a watch failure
+func watchDropReason(err error) DropReason {
+	if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+		return DropWatchExpired
+	}
+	return DropWatchError
+}
+
+// dropped reports possibly lost events
+func (w *watcher) dropped(e DroppedEvent) {
+	if w.onDrop != nil {
+		w.onDrop(e)
+	}
+}
@@ -0,0 +1,62 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestWatcherDrops(t *testing.T) {
+	var dropped []DroppedEvent
+	client := k8sfake.NewSimpleClientset()
+	w, err := NewWatcher(client, &Pod{}, WatchOptions{OnDrop: func(e DroppedEvent) { dropped = append(dropped, e) }}, nil)
+	require.NoError(t, err)
+	watcher := w.(*watcher)
+
+	pod := &Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+	deleted := 0
+	watcher.AddEventHandler(ResourceEventHandlerFuncs{DeleteFunc: func(interface{}) { deleted++ }})
+
+	// Added and removed from the store before being handled
+	watcher.enqueue(pod, add)
+	watcher.enqueue(cache.DeletedFinalStateUnknown{Key: "default/web", Obj: pod}, delete)
+	assert.True(t, watcher.process(context.Background()))
+	assert.True(t, watcher.process(context.Background()))
+
+	assert.Equal(t, []DroppedEvent{
+		{Reason: DropDeletedFinalStateUnknown, Key: "default/web"},
+		{Reason: DropObjectGone, Key: "default/web"},
+	}, dropped)
+	assert.Equal(t, 1, deleted)
+}
+
+func TestWatchDropReason(t *testing.T) {
+	assert.Equal(t, DropWatchExpired, watchDropReason(apierrors.NewResourceExpired("too old resource version")))
+	assert.Equal(t, DropWatchExpired, watchDropReason(apierrors.NewGone("gone")))
+	assert.Equal(t, DropWatchError, watchDropReason(apierrors.NewForbidden(v1.Resource("pods"), "", errors.New("rbac"))))
+}
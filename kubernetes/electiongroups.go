@@ -0,0 +1,196 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ElectionGroups allows a single process to participate in several independent leader elections.
+// Every named group is coordinated through its own Lease, so the leadership of different groups
+// (e.g. one per watched resource kind) can be held by different instances.
+type ElectionGroups interface {
+	// Join adds a group to contend for, if the groups are already started the election of the
+	// new group starts immediately
+	Join(group string, callbacks LeaderCallbacks) error
+
+	// Leave stops contending for a group, releasing its Lease if configured to
+	Leave(group string)
+
+	// Start contending for all the joined groups
+	Start()
+
+	// Stop contending for all the groups and leave them
+	Stop()
+
+	// IsLeader returns true if this instance holds the leadership of the group
+	IsLeader(group string) bool
+
+	// Leaders returns the last observed leader of every joined group
+	Leaders() map[string]string
+
+	// Status returns the state of this instance in every joined group
+	Status() map[string]LeaderStatus
+}
+
+type electionGroups struct {
+	sync.RWMutex
+	client   kubernetes.Interface
+	config   LeaderElectionConfig
+	electors map[string]LeaderElector // group -> elector, nil entries are groups that were left
+	started  bool
+}
+
+// NewElectionGroups creates an ElectionGroups from a base config, the Lease of every group is
+// named after the LeaseName of the config suffixed with the group name.
+func NewElectionGroups(client kubernetes.Interface, cfg LeaderElectionConfig) (ElectionGroups, error) {
+	if cfg.LeaseName == "" {
+		return nil, fmt.Errorf("leader election lease name is required")
+	}
+	return &electionGroups{
+		client:   client,
+		config:   cfg,
+		electors: make(map[string]LeaderElector),
+	}, nil
+}
+
+// Join adds a group to contend for
+func (g *electionGroups) Join(group string, callbacks LeaderCallbacks) error {
+	leaseName := g.leaseName(group)
+	if errs := validation.IsDNS1123Subdomain(leaseName); len(errs) > 0 {
+		return fmt.Errorf("invalid lease name %q for election group %q: %s", leaseName, group, strings.Join(errs, ", "))
+	}
+
+	g.Lock()
+	defer g.Unlock()
+
+	if g.electors[group] != nil {
+		return fmt.Errorf("election group %q already joined", group)
+	}
+
+	cfg := g.config
+	cfg.LeaseName = leaseName
+	elector, err := NewLeaderElector(g.client, cfg, callbacks)
+	if err != nil {
+		return fmt.Errorf("unable to join election group %q: %w", group, err)
+	}
+
+	g.electors[group] = elector
+	if g.started {
+		elector.Start()
+	}
+	return nil
+}
+
+// Leave stops contending for a group
+func (g *electionGroups) Leave(group string) {
+	g.Lock()
+	elector := g.electors[group]
+	g.electors[group] = nil
+	g.Unlock()
+
+	if elector != nil {
+		elector.Stop()
+	}
+}
+
+// Start contending for all the joined groups
+func (g *electionGroups) Start() {
+	g.Lock()
+	defer g.Unlock()
+
+	if g.started {
+		return
+	}
+	g.started = true
+	for _, elector := range g.electors {
+		if elector != nil {
+			elector.Start()
+		}
+	}
+}
+
+// Stop contending for all the groups and leave them. The groups are stopped concurrently so that
+// their Leases are released at once.
+func (g *electionGroups) Stop() {
+	g.Lock()
+	electors := g.electors
+	g.electors = make(map[string]LeaderElector)
+	g.started = false
+	g.Unlock()
+
+	// Electors are stopped without holding the lock, leading callbacks may still query the groups.
+	var wg sync.WaitGroup
+	for _, elector := range electors {
+		if elector == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(elector LeaderElector) {
+			defer wg.Done()
+			elector.Stop()
+		}(elector)
+	}
+	wg.Wait()
+}
+
+// IsLeader returns true if this instance holds the leadership of the group
+func (g *electionGroups) IsLeader(group string) bool {
+	g.RLock()
+	defer g.RUnlock()
+
+	elector := g.electors[group]
+	return elector != nil && elector.IsLeader()
+}
+
+// Leaders returns the last observed leader of every joined group
+func (g *electionGroups) Leaders() map[string]string {
+	g.RLock()
+	defer g.RUnlock()
+
+	leaders := make(map[string]string, len(g.electors))
+	for group, elector := range g.electors {
+		if elector != nil {
+			leaders[group] = elector.GetLeader()
+		}
+	}
+	return leaders
+}
+
+// Status returns the state of this instance in every joined group
+func (g *electionGroups) Status() map[string]LeaderStatus {
+	g.RLock()
+	defer g.RUnlock()
+
+	status := make(map[string]LeaderStatus, len(g.electors))
+	for group, elector := range g.electors {
+		if elector != nil {
+			status[group] = elector.Status()
+		}
+	}
+	return status
+}
+
+func (g *electionGroups) leaseName(group string) string {
+	return g.config.LeaseName + "-" + group
+}
@@ -0,0 +1,95 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestElectionGroups(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	cfg := LeaderElectionConfig{
+		LeaseName:    "autodiscover",
+		Namespace:    "kube-system",
+		LeaseTimings: LeaseTimings{LeaseDuration: 30 * time.Second, RenewDeadline: 10 * time.Second, RetryPeriod: 50 * time.Millisecond},
+	}
+
+	cfg.Identity = "agent-a"
+	a, err := NewElectionGroups(client, cfg)
+	require.NoError(t, err)
+	cfg.Identity = "agent-b"
+	b, err := NewElectionGroups(client, cfg)
+	require.NoError(t, err)
+
+	// agent-a leads pods, agent-b leads nodes
+	require.NoError(t, a.Join("pods", LeaderCallbacks{}))
+	a.Start()
+	defer a.Stop()
+	require.Eventually(t, func() bool { return a.IsLeader("pods") }, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, b.Join("nodes", LeaderCallbacks{}))
+	b.Start()
+	defer b.Stop()
+	require.Eventually(t, func() bool { return b.IsLeader("nodes") }, 5*time.Second, 10*time.Millisecond)
+
+	// Joining after start contends immediately, but leadership is already held by agent-a
+	require.NoError(t, b.Join("pods", LeaderCallbacks{}))
+	require.NoError(t, a.Join("nodes", LeaderCallbacks{}))
+	assert.Eventually(t, func() bool {
+		return b.Leaders()["pods"] == "agent-a" && a.Leaders()["nodes"] == "agent-b"
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.False(t, b.IsLeader("pods"))
+	assert.False(t, a.IsLeader("nodes"))
+	assert.Equal(t, LeaderStatus{
+		Lock:     "kube-system/autodiscover-pods",
+		Identity: "agent-b",
+		Leader:   "agent-a",
+	}, b.Status()["pods"])
+
+	// Every group has its own Lease
+	for _, name := range []string{"autodiscover-pods", "autodiscover-nodes"} {
+		_, err := client.CoordinationV1().Leases("kube-system").Get(context.Background(), name, metav1.GetOptions{})
+		assert.NoError(t, err, name)
+	}
+
+	// Leaving a group releases its Lease for the other instance
+	a.Leave("pods")
+	assert.False(t, a.IsLeader("pods"))
+	assert.NotContains(t, a.Leaders(), "pods")
+	assert.Eventually(t, func() bool { return b.IsLeader("pods") }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestElectionGroupsJoin(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	_, err := NewElectionGroups(client, LeaderElectionConfig{Namespace: "kube-system"})
+	assert.Error(t, err)
+
+	g, err := NewElectionGroups(client, LeaderElectionConfig{LeaseName: "autodiscover", Namespace: "kube-system", Identity: "agent-a"})
+	require.NoError(t, err)
+
+	assert.NoError(t, g.Join("pods", LeaderCallbacks{}))
+	assert.Error(t, g.Join("pods", LeaderCallbacks{}), "groups can only be joined once")
+	assert.Error(t, g.Join("Invalid_Group", LeaderCallbacks{}), "group must produce a valid lease name")
+}
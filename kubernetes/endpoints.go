@@ -0,0 +1,90 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+// endpointChange is the state of the updates of pods that only change their IPs
+const endpointChange = "endpoint_change"
+
+// EndpointChangeHandler is implemented by the handlers that handle the updates of pods that
+// only change their IPs apart from other updates, e.g. to dial their targets again without
+// generating their metadata again. Other handlers receive these changes as updates.
+type EndpointChangeHandler interface {
+	ResourceEventHandler
+
+	// OnEndpointChange is called with a pod whose status.podIP or status.podIPs changed, and
+	// nothing else
+	OnEndpointChange(obj interface{})
+}
+
+// OnEndpointChange calls EndpointChangeFunc if it's not nil, UpdateFunc otherwise.
+func (r ResourceEventHandlerFuncs) OnEndpointChange(obj interface{}) {
+	if r.EndpointChangeFunc != nil {
+		r.EndpointChangeFunc(obj)
+		return
+	}
+	r.OnUpdate(obj)
+}
+
+// HandleEndpointChange calls the endpoint change handler of h if it has one, or its update
+// handler otherwise, for handlers wrapping other handlers
+func HandleEndpointChange(h ResourceEventHandler, obj interface{}) {
+	if h, ok := h.(EndpointChangeHandler); ok {
+		h.OnEndpointChange(obj)
+		return
+	}
+	h.OnUpdate(obj)
+}
+
+// handleUpdate calls the handler of an update, or of an endpoint change
+func handleUpdate(h ResourceEventHandler, obj interface{}, state string) {
+	if state == endpointChange {
+		HandleEndpointChange(h, obj)
+		return
+	}
+	h.OnUpdate(obj)
+}
+
+// updateState returns the state of an update, endpoint_change if only the IPs of a pod changed
+func updateState(o, n interface{}) string {
+	old, ok := o.(*Pod)
+	if !ok {
+		return update
+	}
+	pod, ok := n.(*Pod)
+	if !ok {
+		return update
+	}
+	if old.Status.PodIP == pod.Status.PodIP && equality.Semantic.DeepEqual(old.Status.PodIPs, pod.Status.PodIPs) {
+		return update
+	}
+
+	// Compare the rest of the pod, ignoring the fields updated on every change
+	changed := old.DeepCopy()
+	changed.ResourceVersion = pod.ResourceVersion
+	changed.ManagedFields = pod.ManagedFields
+	changed.Status.PodIP = pod.Status.PodIP
+	changed.Status.PodIPs = pod.Status.PodIPs
+	if equality.Semantic.DeepEqual(changed, pod) {
+		return endpointChange
+	}
+	return update
+}
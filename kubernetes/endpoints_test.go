@@ -0,0 +1,82 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestUpdateState(t *testing.T) {
+	pod := &Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", ResourceVersion: "1"},
+		Status:     PodStatus{Phase: PodRunning, PodIP: "10.0.0.1"},
+	}
+
+	moved := pod.DeepCopy()
+	moved.ResourceVersion = "2"
+	moved.Status.PodIP = "10.0.0.2"
+	assert.Equal(t, endpointChange, updateState(pod, moved))
+
+	dualStack := pod.DeepCopy()
+	dualStack.ResourceVersion = "2"
+	dualStack.Status.PodIPs = []v1.PodIP{{IP: "10.0.0.1"}, {IP: "fd00::1"}}
+	assert.Equal(t, endpointChange, updateState(pod, dualStack))
+
+	relabeled := moved.DeepCopy()
+	relabeled.Labels = map[string]string{"app": "web"}
+	assert.Equal(t, update, updateState(pod, relabeled))
+
+	same := pod.DeepCopy()
+	same.ResourceVersion = "2"
+	same.Status.Phase = PodFailed
+	assert.Equal(t, update, updateState(pod, same))
+
+	assert.Equal(t, update, updateState(&Node{}, &Node{}))
+}
+
+func TestWatcherEndpointChange(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	w, err := NewWatcher(client, &Pod{}, WatchOptions{}, nil)
+	require.NoError(t, err)
+	watcher := w.(*watcher)
+
+	pod := &Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+	require.NoError(t, watcher.store.Add(pod))
+
+	var events []string
+	handler := ResourceEventHandlerFuncs{UpdateFunc: func(interface{}) { events = append(events, "update") }}
+	watcher.AddEventHandler(handler)
+	watcher.enqueue(pod, endpointChange)
+	assert.True(t, watcher.process(context.Background()))
+
+	handler.EndpointChangeFunc = func(interface{}) { events = append(events, "endpoint change") }
+	watcher.AddEventHandler(handler)
+	watcher.enqueue(pod, endpointChange)
+	watcher.enqueue(pod, update)
+	assert.True(t, watcher.process(context.Background()))
+	assert.True(t, watcher.process(context.Background()))
+
+	assert.Equal(t, []string{"update", "endpoint change", "update"}, events)
+}
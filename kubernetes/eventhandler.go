@@ -31,10 +31,12 @@ import (
 //      change. OnUpdate is also called when a re-list happens, and it will
 //      get called even if nothing changed. This is useful for periodically
 //      evaluating or syncing something.
-//  * OnDelete will get the final state of the item if it is known, otherwise
-//      it will get an object of type DeletedFinalStateUnknown. This can
-//      happen if the watch is closed and misses the delete event and we don't
-//      notice the deletion until the subsequent re-list.
+//  * OnDelete will get the final state of the item if it is known. If the
+//      watch is closed and misses the delete event, and we don't notice the
+//      deletion until the subsequent re-list, the watchers of this package
+//      unwrap the DeletedFinalStateUnknown of the informer and deliver its
+//      last known state, or an object of the watched type with only its
+//      namespace and name if there is none.
 // idea: allow the On* methods to return an error so that the RateLimited WorkQueue
 // idea: can requeue the failed event processing.
 type ResourceEventHandler interface {
@@ -50,6 +52,9 @@ type ResourceEventHandlerFuncs struct {
 	AddFunc    func(obj interface{})
 	UpdateFunc func(obj interface{})
 	DeleteFunc func(obj interface{})
+	// EndpointChangeFunc handles the updates of pods that only change their IPs, UpdateFunc
+	// handles them if nil
+	EndpointChangeFunc func(obj interface{})
 }
 
 // OnAdd calls AddFunc if it's not nil.
@@ -0,0 +1,162 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package integration provides a harness to test watchers and metadata generators end-to-end
+// against a real API server, the harness runs with the first cluster available of:
+//
+//   - An existing cluster, with the kubeconfig in the AUTODISCOVER_INTEGRATION_KUBECONFIG
+//     environment variable.
+//   - A control plane started with the etcd and kube-apiserver binaries of envtest, in the
+//     directory of the KUBEBUILDER_ASSETS environment variable, as set by setup-envtest.
+//   - A kind cluster created with the name in the AUTODISCOVER_INTEGRATION_KIND environment
+//     variable, with the kind binary in the PATH. The cluster is deleted when stopped.
+//
+// Tests using StartCluster are skipped without any of them, so they can be part of the unit
+// tests of downstream projects:
+//
+//	func TestPodMetadata(t *testing.T) {
+//		cluster := integration.StartCluster(t)
+//		cluster.RunPodMetadata(t, integration.PodMetadataCase{
+//			Config:     cfg,
+//			PodOptions: []kubernetestest.Option{kubernetestest.WithLabels(labels)},
+//			Check:      func(t *testing.T, pod *kubernetes.Pod, meta mapstr.M) { ... },
+//		})
+//	}
+package integration
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	k8s "k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+)
+
+// Environment variables selecting the cluster of the harness
+const (
+	KubeconfigEnv = "AUTODISCOVER_INTEGRATION_KUBECONFIG"
+	AssetsEnv     = "KUBEBUILDER_ASSETS"
+	KindEnv       = "AUTODISCOVER_INTEGRATION_KIND"
+)
+
+// Sources of the clusters of the harness
+const (
+	SourceExisting = "existing"
+	SourceEnvtest  = "envtest"
+	SourceKind     = "kind"
+)
+
+// ErrNoCluster is returned by NewCluster when no cluster is configured in the environment
+var ErrNoCluster = fmt.Errorf("no cluster configured for integration tests, set %s, %s or %s", KubeconfigEnv, AssetsEnv, KindEnv)
+
+// Cluster is a cluster of the harness
+type Cluster struct {
+	// Source is how the cluster is provided, one of SourceExisting, SourceEnvtest or SourceKind
+	Source string
+	// Kubeconfig is the path of a kubeconfig file of the cluster, e.g. for the kube_config setting
+	// of metadata generators
+	Kubeconfig string
+	Config     *restclient.Config
+	Client     k8s.Interface
+
+	stop func() error
+}
+
+// NewCluster provides a cluster as configured in the environment, it must be stopped when not
+// needed anymore. It returns ErrNoCluster if no cluster is configured.
+func NewCluster() (*Cluster, error) {
+	var (
+		c   *Cluster
+		err error
+	)
+	switch {
+	case os.Getenv(KubeconfigEnv) != "":
+		c, err = existingCluster(os.Getenv(KubeconfigEnv))
+	case os.Getenv(AssetsEnv) != "":
+		c, err = startControlPlane(os.Getenv(AssetsEnv))
+	case os.Getenv(KindEnv) != "":
+		c, err = startKind(os.Getenv(KindEnv))
+	default:
+		return nil, ErrNoCluster
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Client == nil {
+		c.Client, err = k8s.NewForConfig(c.Config)
+		if err != nil {
+			_ = c.Stop()
+			return nil, fmt.Errorf("unable to build kubernetes clientset: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// StartCluster provides a cluster for a test as configured in the environment, stopped when the
+// test finishes. The test is skipped if no cluster is configured.
+func StartCluster(t testing.TB) *Cluster {
+	t.Helper()
+	c, err := NewCluster()
+	if errors.Is(err, ErrNoCluster) {
+		t.Skip(err.Error())
+	}
+	if err != nil {
+		t.Fatalf("unable to start the %s cluster: %v", source(), err)
+	}
+	t.Cleanup(func() {
+		if err := c.Stop(); err != nil {
+			t.Errorf("unable to stop the %s cluster: %v", c.Source, err)
+		}
+	})
+	return c
+}
+
+// Stop stops the cluster if it was started by the harness
+func (c *Cluster) Stop() error {
+	if c.stop == nil {
+		return nil
+	}
+	stop := c.stop
+	c.stop = nil
+	return stop()
+}
+
+// source returns the source of the cluster configured in the environment
+func source() string {
+	switch {
+	case os.Getenv(KubeconfigEnv) != "":
+		return SourceExisting
+	case os.Getenv(AssetsEnv) != "":
+		return SourceEnvtest
+	case os.Getenv(KindEnv) != "":
+		return SourceKind
+	}
+	return ""
+}
+
+func existingCluster(kubeconfig string) (*Cluster, error) {
+	cfg, err := kubernetes.BuildConfig(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to build kube config of %s: %w", kubeconfig, err)
+	}
+	return &Cluster{Source: SourceExisting, Kubeconfig: kubeconfig, Config: cfg}, nil
+}
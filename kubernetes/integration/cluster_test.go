@@ -0,0 +1,109 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes/kubernetestest"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestNewClusterNotConfigured(t *testing.T) {
+	t.Setenv(KubeconfigEnv, "")
+	t.Setenv(AssetsEnv, "")
+	t.Setenv(KindEnv, "")
+
+	_, err := NewCluster()
+	assert.True(t, errors.Is(err, ErrNoCluster))
+}
+
+func TestNewClusterMissingBinaries(t *testing.T) {
+	t.Setenv(KubeconfigEnv, "")
+	t.Setenv(AssetsEnv, t.TempDir())
+
+	_, err := NewCluster()
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrNoCluster))
+}
+
+func TestUniqueName(t *testing.T) {
+	name := UniqueName(t)
+	assert.Regexp(t, regexp.MustCompile(`^testuniquename-[0-9a-f]{8}$`), name)
+	assert.NotEqual(t, name, UniqueName(t))
+
+	t.Run("Sub_Test/With Spaces", func(t *testing.T) {
+		assert.Regexp(t, regexp.MustCompile(`^testuniquename-sub-test-with-spaces-[0-9a-f]{8}$`), UniqueName(t))
+	})
+}
+
+func TestRecorder(t *testing.T) {
+	pod := kubernetestest.Pod("default", "web")
+	recorder := NewRecorder()
+
+	go func() {
+		recorder.OnAdd(kubernetestest.Pod("default", "db"))
+		recorder.OnUpdate(pod)
+	}()
+	assert.Equal(t, pod, recorder.WaitFor(t, kubernetestest.Update, "default", "web"))
+	assert.Len(t, recorder.Events(), 2)
+}
+
+func TestPodMetadata(t *testing.T) {
+	cluster := StartCluster(t)
+
+	cfg, err := config.NewConfigFrom(map[string]interface{}{"include_labels": []string{"app"}})
+	require.NoError(t, err)
+	cluster.RunPodMetadata(t, PodMetadataCase{
+		Config:           cfg,
+		PodOptions:       []kubernetestest.Option{kubernetestest.WithLabels(map[string]string{"app": "web", "tier": "frontend"})},
+		NamespaceOptions: []kubernetestest.Option{kubernetestest.WithLabels(map[string]string{"team": "a"})},
+		Check: func(t *testing.T, pod *kubernetes.Pod, meta mapstr.M) {
+			labels, err := meta.GetValue("kubernetes.labels")
+			require.NoError(t, err)
+			assert.Equal(t, mapstr.M{"app": "web"}, labels)
+
+			team, err := meta.GetValue("kubernetes.namespace_labels.team")
+			require.NoError(t, err)
+			assert.Equal(t, "a", team)
+		},
+	})
+}
+
+func TestWatchDeletes(t *testing.T) {
+	cluster := StartCluster(t)
+
+	namespace := cluster.Namespace(t)
+	_, pods := cluster.Watch(t, &kubernetes.Pod{}, kubernetes.WatchOptions{Namespace: namespace.Name})
+	pod := cluster.Create(t, kubernetestest.Pod(namespace.Name, "web")).(*kubernetes.Pod)
+	pods.WaitFor(t, kubernetestest.Add, namespace.Name, pod.Name)
+
+	gracePeriod := int64(0)
+	require.NoError(t, cluster.Client.CoreV1().Pods(namespace.Name).Delete(context.Background(), pod.Name, metav1.DeleteOptions{GracePeriodSeconds: &gracePeriod}))
+	deleted := pods.WaitFor(t, kubernetestest.Delete, namespace.Name, pod.Name)
+	assert.Equal(t, pod.UID, deleted.(*kubernetes.Pod).UID)
+}
@@ -0,0 +1,305 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	k8s "k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// controlPlaneTimeout is the time the API server has to become ready
+const controlPlaneTimeout = time.Minute
+
+// startControlPlane starts etcd and an API server with the binaries of envtest, like envtest does.
+// The API server authenticates a static token of a member of system:masters, it serves with a
+// self-signed certificate, and pods can be created without service accounts, as no controllers
+// run.
+func startControlPlane(assets string) (c *Cluster, err error) {
+	dir, err := os.MkdirTemp("", "autodiscover-envtest-")
+	if err != nil {
+		return nil, err
+	}
+	var processes []*process
+	stop := func() error {
+		var errs []string
+		// The API server is stopped before etcd
+		for i := len(processes) - 1; i >= 0; i-- {
+			if err := processes[i].stop(); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			errs = append(errs, err.Error())
+		}
+		if len(errs) > 0 {
+			return fmt.Errorf("%v", errs)
+		}
+		return nil
+	}
+	defer func() {
+		if err != nil {
+			_ = stop()
+		}
+	}()
+
+	ports, err := freePorts(3)
+	if err != nil {
+		return nil, err
+	}
+	etcdURL := "http://127.0.0.1:" + strconv.Itoa(ports[0])
+	peerURL := "http://127.0.0.1:" + strconv.Itoa(ports[1])
+
+	etcd, err := startProcess(filepath.Join(assets, "etcd"),
+		"--name=default",
+		"--data-dir="+filepath.Join(dir, "etcd"),
+		"--listen-client-urls="+etcdURL,
+		"--advertise-client-urls="+etcdURL,
+		"--listen-peer-urls="+peerURL,
+		"--initial-advertise-peer-urls="+peerURL,
+		"--initial-cluster=default="+peerURL,
+		"--unsafe-no-fsync=true",
+	)
+	if err != nil {
+		return nil, err
+	}
+	processes = append(processes, etcd)
+
+	token, err := writeCredentials(dir)
+	if err != nil {
+		return nil, err
+	}
+	apiserver, err := startProcess(filepath.Join(assets, "kube-apiserver"),
+		"--etcd-servers="+etcdURL,
+		"--cert-dir="+filepath.Join(dir, "certs"),
+		"--bind-address=127.0.0.1",
+		"--advertise-address=127.0.0.1",
+		"--secure-port="+strconv.Itoa(ports[2]),
+		"--service-cluster-ip-range=10.0.0.0/24",
+		"--token-auth-file="+filepath.Join(dir, "tokens.csv"),
+		"--service-account-issuer=https://kubernetes.default.svc",
+		"--service-account-key-file="+filepath.Join(dir, "sa.key"),
+		"--service-account-signing-key-file="+filepath.Join(dir, "sa.key"),
+		"--authorization-mode=RBAC",
+		"--disable-admission-plugins=ServiceAccount",
+		"--allow-privileged=true",
+	)
+	if err != nil {
+		return nil, err
+	}
+	processes = append(processes, apiserver)
+
+	cfg := &restclient.Config{
+		Host:            "https://127.0.0.1:" + strconv.Itoa(ports[2]),
+		BearerToken:     token,
+		TLSClientConfig: restclient.TLSClientConfig{Insecure: true},
+	}
+	client, err := k8s.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to build kubernetes clientset: %w", err)
+	}
+	if err := waitReady(client, apiserver, etcd); err != nil {
+		return nil, err
+	}
+
+	kubeconfig := filepath.Join(dir, "kubeconfig")
+	if err := writeKubeconfig(kubeconfig, cfg); err != nil {
+		return nil, err
+	}
+	return &Cluster{Source: SourceEnvtest, Kubeconfig: kubeconfig, Config: cfg, Client: client, stop: stop}, nil
+}
+
+// writeCredentials writes the static token file and the key of service accounts of the API
+// server, and returns the token
+func writeCredentials(dir string) (string, error) {
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(secret)
+	if err := os.WriteFile(filepath.Join(dir, "tokens.csv"), []byte(token+",admin,admin,system:masters\n"), 0600); err != nil {
+		return "", err
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", err
+	}
+	encoded := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(filepath.Join(dir, "sa.key"), encoded, 0600); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// waitReady waits for the API server to be ready, failing early if a process of the control plane
+// exits
+func waitReady(client k8s.Interface, processes ...*process) error {
+	ctx, cancel := context.WithTimeout(context.Background(), controlPlaneTimeout)
+	defer cancel()
+
+	var lastErr error
+	for {
+		for _, p := range processes {
+			if err := p.exited(); err != nil {
+				return err
+			}
+		}
+		_, lastErr = client.Discovery().RESTClient().Get().AbsPath("/readyz").DoRaw(ctx)
+		if lastErr == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("API server not ready after %s: %w", controlPlaneTimeout, lastErr)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// writeKubeconfig writes a kubeconfig file with the config of a client
+func writeKubeconfig(path string, cfg *restclient.Config) error {
+	kubeconfig := clientcmdapi.NewConfig()
+	kubeconfig.Clusters["integration"] = &clientcmdapi.Cluster{
+		Server:                cfg.Host,
+		InsecureSkipTLSVerify: cfg.Insecure,
+	}
+	kubeconfig.AuthInfos["integration"] = &clientcmdapi.AuthInfo{Token: cfg.BearerToken}
+	kubeconfig.Contexts["integration"] = &clientcmdapi.Context{Cluster: "integration", AuthInfo: "integration"}
+	kubeconfig.CurrentContext = "integration"
+	return clientcmd.WriteToFile(*kubeconfig, path)
+}
+
+// freePorts returns ports free to listen on the loopback interface
+func freePorts(n int) ([]int, error) {
+	ports := make([]int, 0, n)
+	listeners := make([]net.Listener, 0, n)
+	defer func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+	// Listeners are kept open until all the ports are found, so that they are different
+	for i := 0; i < n; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, l)
+		ports = append(ports, l.Addr().(*net.TCPAddr).Port)
+	}
+	return ports, nil
+}
+
+// process is a process of the control plane
+type process struct {
+	name   string
+	cmd    *exec.Cmd
+	output *lockedBuffer
+	done   chan struct{}
+	err    error
+}
+
+func startProcess(path string, args ...string) (*process, error) {
+	p := &process{
+		name:   filepath.Base(path),
+		cmd:    exec.Command(path, args...),
+		output: &lockedBuffer{},
+		done:   make(chan struct{}),
+	}
+	p.cmd.Stdout = p.output
+	p.cmd.Stderr = p.output
+	if err := p.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("unable to start %s: %w", p.name, err)
+	}
+	go func() {
+		p.err = p.cmd.Wait()
+		close(p.done)
+	}()
+	return p, nil
+}
+
+// exited returns an error with the output of the process if it has exited
+func (p *process) exited() error {
+	select {
+	case <-p.done:
+		return fmt.Errorf("%s exited: %v, output:\n%s", p.name, p.err, p.output.tail(2048))
+	default:
+		return nil
+	}
+}
+
+// stop terminates the process, killing it if it doesn't exit in time
+func (p *process) stop() error {
+	select {
+	case <-p.done:
+		return nil
+	default:
+	}
+	if err := p.cmd.Process.Signal(os.Interrupt); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return fmt.Errorf("unable to stop %s: %w", p.name, err)
+	}
+	select {
+	case <-p.done:
+	case <-time.After(10 * time.Second):
+		_ = p.cmd.Process.Kill()
+		<-p.done
+	}
+	return nil
+}
+
+// lockedBuffer is the output of a process, written while it may be read
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// tail returns the last bytes of the output
+func (b *lockedBuffer) tail(n int) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := b.buf.Bytes()
+	if len(out) > n {
+		out = out[len(out)-n:]
+	}
+	return string(out)
+}
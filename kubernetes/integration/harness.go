@@ -0,0 +1,232 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package integration
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes/kubernetestest"
+)
+
+// Timeout is the time the API server and the watchers have to handle the requests and events of
+// the harness
+var Timeout = 30 * time.Second
+
+// UniqueName returns a name for the resources of a test, unique across tests and runs so that
+// tests can share clusters
+func UniqueName(t testing.TB) string {
+	var name strings.Builder
+	for _, r := range strings.ToLower(t.Name()) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			name.WriteRune(r)
+		} else if name.Len() > 0 && !strings.HasSuffix(name.String(), "-") {
+			name.WriteByte('-')
+		}
+		if name.Len() >= 40 {
+			break
+		}
+	}
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return strings.TrimSuffix(name.String(), "-") + "-" + hex.EncodeToString(suffix)
+}
+
+// Namespace creates a namespace for a test, deleted when the test finishes
+func (c *Cluster) Namespace(t testing.TB, opts ...kubernetestest.Option) *kubernetes.Namespace {
+	t.Helper()
+	return c.Create(t, kubernetestest.Namespace(UniqueName(t), opts...)).(*kubernetes.Namespace)
+}
+
+// Create creates a resource, deleted when the test finishes. Pods, nodes, namespaces, services,
+// replica sets and deployments are supported.
+func (c *Cluster) Create(t testing.TB, obj kubernetes.Resource) kubernetes.Resource {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	// Fixtures have UIDs and resource versions, they are set by the API server
+	obj = obj.DeepCopyObject()
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		t.Fatalf("unable to access the metadata of %T: %v", obj, err)
+	}
+	accessor.SetUID("")
+	accessor.SetResourceVersion("")
+	namespace, name := accessor.GetNamespace(), accessor.GetName()
+
+	var (
+		created kubernetes.Resource
+		remove  func(context.Context) error
+	)
+	opts := metav1.CreateOptions{}
+	// Pods on nodes without kubelets would never be deleted gracefully
+	gracePeriod := int64(0)
+	deleteOpts := metav1.DeleteOptions{GracePeriodSeconds: &gracePeriod}
+	clientset := c.Client
+	switch o := obj.(type) {
+	case *kubernetes.Pod:
+		created, err = clientset.CoreV1().Pods(namespace).Create(ctx, o, opts)
+		remove = func(ctx context.Context) error {
+			return clientset.CoreV1().Pods(namespace).Delete(ctx, name, deleteOpts)
+		}
+	case *kubernetes.Node:
+		created, err = clientset.CoreV1().Nodes().Create(ctx, o, opts)
+		remove = func(ctx context.Context) error { return clientset.CoreV1().Nodes().Delete(ctx, name, deleteOpts) }
+	case *kubernetes.Namespace:
+		created, err = clientset.CoreV1().Namespaces().Create(ctx, o, opts)
+		remove = func(ctx context.Context) error { return clientset.CoreV1().Namespaces().Delete(ctx, name, deleteOpts) }
+	case *kubernetes.Service:
+		created, err = clientset.CoreV1().Services(namespace).Create(ctx, o, opts)
+		remove = func(ctx context.Context) error {
+			return clientset.CoreV1().Services(namespace).Delete(ctx, name, deleteOpts)
+		}
+	case *kubernetes.ReplicaSet:
+		created, err = clientset.AppsV1().ReplicaSets(namespace).Create(ctx, o, opts)
+		remove = func(ctx context.Context) error {
+			return clientset.AppsV1().ReplicaSets(namespace).Delete(ctx, name, deleteOpts)
+		}
+	case *kubernetes.Deployment:
+		created, err = clientset.AppsV1().Deployments(namespace).Create(ctx, o, opts)
+		remove = func(ctx context.Context) error {
+			return clientset.AppsV1().Deployments(namespace).Delete(ctx, name, deleteOpts)
+		}
+	default:
+		t.Fatalf("unsupported resource %T", obj)
+	}
+	if err != nil {
+		t.Fatalf("unable to create %T %s: %v", obj, key(namespace, name), err)
+	}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		// Namespaces may be left terminating, without controllers deleting their resources
+		_ = remove(ctx)
+	})
+	return created
+}
+
+// Watch starts a watcher of a resource recording its events, stopped when the test finishes
+func (c *Cluster) Watch(t testing.TB, resource kubernetes.Resource, opts kubernetes.WatchOptions) (kubernetes.Watcher, *Recorder) {
+	t.Helper()
+	if opts.SyncTimeout == 0 {
+		opts.SyncTimeout = Timeout
+	}
+	watcher, err := kubernetes.NewNamedWatcher(fmt.Sprintf("integration %T", resource), c.Client, resource, opts, nil)
+	if err != nil {
+		t.Fatalf("unable to create watcher of %T: %v", resource, err)
+	}
+	recorder := NewRecorder()
+	watcher.AddEventHandler(recorder)
+	if err := watcher.Start(); err != nil {
+		t.Fatalf("unable to start watcher of %T: %v", resource, err)
+	}
+	t.Cleanup(watcher.Stop)
+	return watcher, recorder
+}
+
+// Recorder is a ResourceEventHandler recording the events of a watcher
+type Recorder struct {
+	mu      sync.Mutex
+	events  []kubernetestest.Event
+	updated chan struct{}
+}
+
+// NewRecorder creates a Recorder
+func NewRecorder() *Recorder {
+	return &Recorder{updated: make(chan struct{})}
+}
+
+// OnAdd records an add event
+func (r *Recorder) OnAdd(obj interface{}) {
+	r.record(kubernetestest.Add, obj)
+}
+
+// OnUpdate records an update event
+func (r *Recorder) OnUpdate(obj interface{}) {
+	r.record(kubernetestest.Update, obj)
+}
+
+// OnDelete records a delete event
+func (r *Recorder) OnDelete(obj interface{}) {
+	r.record(kubernetestest.Delete, obj)
+}
+
+// Events returns the recorded events, in order
+func (r *Recorder) Events() []kubernetestest.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]kubernetestest.Event(nil), r.events...)
+}
+
+// WaitFor waits for an event of an object, failing the test if it isn't recorded in time, and
+// returns the object of the event
+func (r *Recorder) WaitFor(t testing.TB, typ kubernetestest.EventType, namespace, name string) kubernetes.Resource {
+	t.Helper()
+	timeout := time.After(Timeout)
+	for {
+		r.mu.Lock()
+		for _, event := range r.events {
+			if accessor, err := meta.Accessor(event.Obj); err == nil && event.Type == typ &&
+				accessor.GetNamespace() == namespace && accessor.GetName() == name {
+				r.mu.Unlock()
+				return event.Obj
+			}
+		}
+		updated := r.updated
+		r.mu.Unlock()
+
+		select {
+		case <-updated:
+		case <-timeout:
+			t.Fatalf("%s event of %s not recorded after %s", typ, key(namespace, name), Timeout)
+			return nil
+		}
+	}
+}
+
+func (r *Recorder) record(typ kubernetestest.EventType, obj interface{}) {
+	resource, ok := obj.(kubernetes.Resource)
+	if !ok {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, kubernetestest.Event{Type: typ, Obj: resource})
+	// Waiters are notified by closing the channel
+	close(r.updated)
+	r.updated = make(chan struct{})
+}
+
+func key(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
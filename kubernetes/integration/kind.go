@@ -0,0 +1,58 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package integration
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+)
+
+// startKind creates a kind cluster, deleted when stopped
+func startKind(name string) (*Cluster, error) {
+	path, err := exec.LookPath("kind")
+	if err != nil {
+		return nil, fmt.Errorf("kind is required to create the %q cluster: %w", name, err)
+	}
+	dir, err := os.MkdirTemp("", "autodiscover-kind-")
+	if err != nil {
+		return nil, err
+	}
+	kubeconfig := filepath.Join(dir, "kubeconfig")
+	stop := func() error {
+		defer os.RemoveAll(dir)
+		if output, err := exec.Command(path, "delete", "cluster", "--name", name).CombinedOutput(); err != nil {
+			return fmt.Errorf("unable to delete kind cluster %q: %w, output:\n%s", name, err, output)
+		}
+		return nil
+	}
+
+	if output, err := exec.Command(path, "create", "cluster", "--name", name, "--kubeconfig", kubeconfig, "--wait", controlPlaneTimeout.String()).CombinedOutput(); err != nil {
+		_ = stop()
+		return nil, fmt.Errorf("unable to create kind cluster %q: %w, output:\n%s", name, err, output)
+	}
+	cfg, err := kubernetes.BuildConfig(kubeconfig)
+	if err != nil {
+		_ = stop()
+		return nil, fmt.Errorf("unable to build kube config of kind cluster %q: %w", name, err)
+	}
+	return &Cluster{Source: SourceKind, Kubeconfig: kubeconfig, Config: cfg, stop: stop}, nil
+}
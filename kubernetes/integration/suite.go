@@ -0,0 +1,93 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package integration
+
+import (
+	"testing"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes/kubernetestest"
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes/metadata"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// PodMetadataCase is a case of RunPodMetadata
+type PodMetadataCase struct {
+	// Config is the config of the metadata generator, the default if nil
+	Config *config.C
+	// ResourceMetadata is the config of the metadata of related resources, the default if nil
+	ResourceMetadata *metadata.AddResourceMetadataConfig
+
+	// PodOptions, NodeOptions and NamespaceOptions are the options of the fixtures of the
+	// resources created with unique names, e.g. with their labels and annotations
+	PodOptions       []kubernetestest.Option
+	NodeOptions      []kubernetestest.Option
+	NamespaceOptions []kubernetestest.Option
+
+	// Check checks the metadata generated for the pod when its add event is handled, after the
+	// checks of the metadata of the harness
+	Check func(t *testing.T, pod *kubernetes.Pod, meta mapstr.M)
+}
+
+// RunPodMetadata creates a namespace, a node and a pod in them, and checks the metadata generated
+// with the stores of real watchers of them when the pod is added. The metadata must have the name
+// and UID of the pod, its namespace, and the name of its node if the metadata of nodes is enabled.
+func (c *Cluster) RunPodMetadata(t *testing.T, tc PodMetadataCase) {
+	t.Helper()
+	cfg := tc.Config
+	if cfg == nil {
+		cfg = config.NewConfig()
+	}
+	metaConf := tc.ResourceMetadata
+	if metaConf == nil {
+		metaConf = metadata.GetDefaultResourceMetadataConfig()
+	}
+
+	namespace := c.Namespace(t, tc.NamespaceOptions...)
+	node := c.Create(t, kubernetestest.Node(UniqueName(t), tc.NodeOptions...)).(*kubernetes.Node)
+	pod := kubernetestest.Pod(namespace.Name, UniqueName(t), append(append([]kubernetestest.Option(nil), tc.PodOptions...), kubernetestest.OnNode(node.Name))...)
+
+	// Watchers are started like the providers of autodiscover do, with the related resources
+	// before the pods
+	nodeWatcher, _ := c.Watch(t, &kubernetes.Node{}, kubernetes.WatchOptions{})
+	namespaceWatcher, _ := c.Watch(t, &kubernetes.Namespace{}, kubernetes.WatchOptions{})
+	podWatcher, pods := c.Watch(t, &kubernetes.Pod{}, kubernetes.WatchOptions{Namespace: namespace.Name})
+	metaGen := metadata.GetPodMetaGen(cfg, podWatcher, nodeWatcher, namespaceWatcher, nil, nil, metaConf)
+
+	c.Create(t, pod)
+	added := pods.WaitFor(t, kubernetestest.Add, pod.Namespace, pod.Name).(*kubernetes.Pod)
+	meta := metaGen.Generate(added)
+
+	expected := map[string]interface{}{
+		"kubernetes.pod.name":  added.Name,
+		"kubernetes.pod.uid":   string(added.UID),
+		"kubernetes.namespace": namespace.Name,
+	}
+	if metaConf.Node.Enabled() {
+		expected["kubernetes.node.name"] = node.Name
+	}
+	for field, value := range expected {
+		if found, err := meta.GetValue(field); err != nil || found != value {
+			t.Errorf("expected %s to be %v in the metadata of the pod, found %v: %v", field, value, found, meta.StringToPrint())
+		}
+	}
+	if tc.Check != nil {
+		tc.Check(t, added, meta)
+	}
+}
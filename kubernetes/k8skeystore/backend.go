@@ -0,0 +1,162 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package k8skeystore
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/keystore"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// ErrPermissionDenied is returned by backends when the agent is not allowed to read a secret
+var ErrPermissionDenied = errors.New("permission denied")
+
+// Backend resolves key references against an external secret store. Keys are referenced as
+// "<name>.<path>/<key>", where path is the location of the secret in the store and can contain
+// slashes, e.g. "vault.secret/data/myapp/password".
+type Backend interface {
+	// Name of the backend, used as prefix of the key references it resolves
+	Name() string
+
+	// Get returns the value of a key of the secret stored at path, namespace is the Kubernetes
+	// namespace of the event the key is resolved for. It returns keystore.ErrKeyDoesntExists if the
+	// secret or the key don't exist, and ErrPermissionDenied if access is not allowed.
+	Get(namespace, path, key string) ([]byte, error)
+}
+
+// BackendKeystoresRegistry implements a Provider for Keystore that resolves keys with a Backend
+type BackendKeystoresRegistry struct {
+	logger  *logp.Logger
+	backend Backend
+	config  Config
+	metrics *Metrics
+}
+
+// BackendKeystore allows to retrieve secrets from an external secret store for a given namespace
+type BackendKeystore struct {
+	namespace string
+	backend   Backend
+	encoding  string
+	metrics   *Metrics
+	logger    *logp.Logger
+}
+
+// NewBackendKeystoresRegistry initializes a BackendKeystoresRegistry
+func NewBackendKeystoresRegistry(logger *logp.Logger, backend Backend, cfg Config) *BackendKeystoresRegistry {
+	return &BackendKeystoresRegistry{
+		logger:  logger,
+		backend: backend,
+		config:  cfg,
+		metrics: NewMetrics(),
+	}
+}
+
+// Metrics returns the lookup counters of the keystores of the registry
+func (kr *BackendKeystoresRegistry) Metrics() *Metrics {
+	return kr.metrics
+}
+
+// GetKeystore returns a BackendKeystore for the namespace of the event.
+func (kr *BackendKeystoresRegistry) GetKeystore(event bus.Event) keystore.Keystore {
+	namespace := eventNamespace(kr.logger, event)
+	if namespace != "" {
+		return newBackendKeystore(namespace, kr.backend, kr.logger, kr.config, kr.metrics)
+	}
+	return nil
+}
+
+// NewBackendKeystore returns a new keystore backed by an external secret store
+func NewBackendKeystore(keystoreNamespace string, backend Backend, logger *logp.Logger, cfg Config) (keystore.Keystore, error) {
+	return newBackendKeystore(keystoreNamespace, backend, logger, cfg, nil), nil
+}
+
+func newBackendKeystore(keystoreNamespace string, backend Backend, logger *logp.Logger, cfg Config, metrics *Metrics) *BackendKeystore {
+	return &BackendKeystore{
+		namespace: keystoreNamespace,
+		backend:   backend,
+		encoding:  cfg.Encoding,
+		metrics:   metrics,
+		logger:    logger,
+	}
+}
+
+// Retrieve returns a SecureString with the value of a key of the external secret store. Key
+// references support the same modifiers as Kubernetes secrets.
+func (k *BackendKeystore) Retrieve(key string) (*keystore.SecureString, error) {
+	prefix := k.backend.Name() + "."
+	if !strings.HasPrefix(key, prefix) {
+		return nil, keystore.ErrKeyDoesntExists
+	}
+	ref, mods, validModifier := splitModifiers(key)
+	path, secretKey, ok := parseBackendKey(strings.TrimPrefix(ref, prefix))
+	if !ok || !validModifier {
+		k.logger.Debugf(
+			"not valid secret key: %v. Secrets should be of the following format %v",
+			key,
+			prefix+"some/path/value",
+		)
+		return nil, keystore.ErrKeyDoesntExists
+	}
+
+	value, err := k.backend.Get(k.namespace, path, secretKey)
+	switch {
+	case err == nil:
+		k.audit(path, secretKey, lookupFound)
+		return found(value, mods, k.encoding), nil
+	case errors.Is(err, keystore.ErrKeyDoesntExists):
+		k.audit(path, secretKey, lookupNotFound)
+		return missing(mods)
+	case errors.Is(err, ErrPermissionDenied):
+		k.logger.Errorf("Permission denied to get secret %v from %v: %v", path, k.backend.Name(), err)
+		k.audit(path, secretKey, lookupPermissionDenied)
+		return nil, fmt.Errorf("permission denied to get secret %v from %v: %w", path, k.backend.Name(), keystore.ErrKeyDoesntExists)
+	default:
+		k.logger.Errorf("Could not retrieve secret %v from %v: %v", path, k.backend.Name(), err)
+		k.audit(path, secretKey, lookupError)
+		return nil, keystore.ErrKeyDoesntExists
+	}
+}
+
+func (k *BackendKeystore) audit(path, key string, result lookupResult) {
+	audit(k.logger, k.metrics, k.backend.Name(), k.namespace, path, key, result)
+}
+
+// GetConfig returns config.C representation of the key / secret pair to be merged with other
+// loaded configuration.
+func (k *BackendKeystore) GetConfig() (*config.C, error) {
+	return nil, nil
+}
+
+// IsPersisted return if the keystore is physically persisted on disk.
+func (k *BackendKeystore) IsPersisted() bool {
+	return true
+}
+
+// parseBackendKey splits "some/path/value" into its path and key, the key is the last element
+func parseBackendKey(ref string) (path, key string, ok bool) {
+	i := strings.LastIndex(ref, "/")
+	if i <= 0 || i == len(ref)-1 {
+		return "", "", false
+	}
+	return ref[:i], ref[i+1:], true
+}
@@ -0,0 +1,75 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package k8skeystore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+	"github.com/elastic/elastic-agent-libs/keystore"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type mapBackend map[string]map[string]string
+
+func (b mapBackend) Name() string { return "test" }
+
+func (b mapBackend) Get(namespace, path, key string) ([]byte, error) {
+	if path == "forbidden" {
+		return nil, ErrPermissionDenied
+	}
+	secret, ok := b[namespace+"/"+path]
+	if !ok {
+		return nil, keystore.ErrKeyDoesntExists
+	}
+	value, ok := secret[key]
+	if !ok {
+		return nil, keystore.ErrKeyDoesntExists
+	}
+	return []byte(value), nil
+}
+
+func TestBackendKeystore(t *testing.T) {
+	backend := mapBackend{
+		ns + "/apps/myapp": {"password": pass},
+	}
+	kRegistry := NewBackendKeystoresRegistry(logp.NewLogger("test_k8s_secrets"), backend, Config{})
+	k := kRegistry.GetKeystore(bus.Event{"kubernetes": mapstr.M{"namespace": ns}})
+
+	assertSecret(t, k, "test.apps/myapp/password", pass)
+	assertSecret(t, k, "test.apps/myapp/username|default=elastic", "elastic")
+	assertSecret(t, k, "test.apps/myapp/password|base64", "dGVzdGluZ19wYXNzcGFzcw==")
+
+	for _, key := range []string{
+		"kubernetes.test_namespace.testing_secret.secret_value",
+		"test.apps/myapp/missing",
+		"test.apps/other/password",
+		"test.forbidden/password|optional",
+		"test.password",
+		"test.apps/myapp/",
+	} {
+		_, err := k.Retrieve(key)
+		assert.ErrorIs(t, err, keystore.ErrKeyDoesntExists, key)
+	}
+
+	assert.Equal(t, LookupStats{Lookups: 2}, kRegistry.Metrics().Stats()[ns+"/apps/myapp/password"])
+	assert.Equal(t, LookupStats{Lookups: 1, PermissionDenied: 1}, kRegistry.Metrics().Stats()[ns+"/forbidden/password"])
+}
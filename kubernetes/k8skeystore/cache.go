@@ -0,0 +1,117 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package k8skeystore
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	k8s "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// secretsCache keeps the secrets of the namespaces the keystores read from, every namespace is watched
+// by its own informer, started on the first lookup in the namespace. Updates and deletions of
+// secrets are observed by the informers, so cached values are never served once they change.
+type secretsCache struct {
+	sync.Mutex
+	client    k8s.Interface
+	logger    *logp.Logger
+	resync    time.Duration
+	informers map[string]cache.SharedInformer
+	stop      chan struct{}
+	stopped   bool
+}
+
+func newSecretsCache(client k8s.Interface, logger *logp.Logger, resync time.Duration) *secretsCache {
+	return &secretsCache{
+		client:    client,
+		logger:    logger,
+		resync:    resync,
+		informers: make(map[string]cache.SharedInformer),
+		stop:      make(chan struct{}),
+	}
+}
+
+// Get returns a secret, from the cache if the informer of its namespace is synced and knows about it,
+// or directly from the API otherwise. The returned bool reports if the secret came from the cache.
+func (c *secretsCache) Get(namespace, name string) (*v1.Secret, bool, error) {
+	if informer := c.informer(namespace); informer != nil && informer.HasSynced() {
+		obj, exists, err := informer.GetStore().GetByKey(namespace + "/" + name)
+		if err == nil && exists {
+			if secret, ok := obj.(*v1.Secret); ok {
+				return secret, true, nil
+			}
+		}
+	}
+	secret, err := c.client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	return secret, false, err
+}
+
+// Stop all the informers of the cache
+func (c *secretsCache) Stop() {
+	c.Lock()
+	defer c.Unlock()
+	if !c.stopped {
+		c.stopped = true
+		close(c.stop)
+	}
+}
+
+// informer returns the informer of a namespace, starting it if needed. It returns nil if the cache
+// is stopped.
+func (c *secretsCache) informer(namespace string) cache.SharedInformer {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.stopped {
+		return nil
+	}
+	if informer, ok := c.informers[namespace]; ok {
+		return informer
+	}
+
+	secrets := c.client.CoreV1().Secrets(namespace)
+	ctx := context.TODO()
+	listwatch := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return secrets.List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return secrets.Watch(ctx, options)
+		},
+	}
+	informer := cache.NewSharedInformer(listwatch, &v1.Secret{}, c.resync)
+	err := informer.SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+		c.logger.Debugf("Watching secrets in namespace %v failed, secrets are retrieved from the API: %v", namespace, err)
+	})
+	if err != nil {
+		c.logger.Errorf("Cannot set the watch error handler of the secrets cache of namespace %v: %v", namespace, err)
+	}
+	go informer.Run(c.stop)
+
+	c.informers[namespace] = informer
+	return informer
+}
@@ -0,0 +1,97 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package k8skeystore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+	"github.com/elastic/elastic-agent-libs/keystore"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestRetrieveWithCache(t *testing.T) {
+	logger := logp.NewLogger("test_k8s_secrets")
+	client := k8sfake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "testing_secret", Namespace: ns},
+		Data:       map[string][]byte{"secret_value": []byte(pass)},
+	})
+
+	kRegistry := NewKubernetesKeystoresRegistryWithConfig(logger, client, Config{Cache: CacheConfig{Enabled: true}})
+	defer kRegistry.Stop()
+	k1 := kRegistry.GetKeystore(bus.Event{"kubernetes": mapstr.M{"namespace": ns}})
+
+	// First lookup starts the informer and falls back to the API
+	assertSecret(t, k1, correctKey, pass)
+
+	cache := kRegistry.cache
+	require.Eventually(t, func() bool { return cache.informer(ns).HasSynced() }, 5*time.Second, 10*time.Millisecond)
+
+	gets := countGets(client)
+	assertSecret(t, k1, correctKey, pass)
+	assert.Equal(t, gets, countGets(client), "secret should be served from the cache")
+
+	// Updates invalidate the cached value
+	_, err := client.CoreV1().Secrets(ns).Update(context.Background(), &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "testing_secret", Namespace: ns},
+		Data:       map[string][]byte{"secret_value": []byte("updated")},
+	}, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		secure, err := k1.Retrieve(correctKey)
+		if err != nil {
+			return false
+		}
+		value, _ := secure.Get()
+		return string(value) == "updated"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Misses fall back to the API
+	gets = countGets(client)
+	_, err = k1.Retrieve("kubernetes.test_namespace.missing_secret.secret_value")
+	assert.Error(t, err)
+	assert.Equal(t, gets+1, countGets(client))
+}
+
+func assertSecret(t *testing.T, k keystore.Keystore, key, expected string) {
+	t.Helper()
+	secure, err := k.Retrieve(key)
+	require.NoError(t, err)
+	value, err := secure.Get()
+	require.NoError(t, err)
+	assert.Equal(t, expected, string(value))
+}
+
+func countGets(client *k8sfake.Clientset) int {
+	gets := 0
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "get" && action.GetResource().Resource == "secrets" {
+			gets++
+		}
+	}
+	return gets
+}
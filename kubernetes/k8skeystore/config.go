@@ -0,0 +1,76 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package k8skeystore
+
+import (
+	"fmt"
+	"time"
+)
+
+// Encodings of the retrieved values
+const (
+	// EncodingRaw returns values as they are stored
+	EncodingRaw = "raw"
+	// EncodingBase64 returns base64 encoded values, for binary data like PKCS#12 bundles
+	EncodingBase64 = "base64"
+	// EncodingAuto returns base64 encoded values only when they are not valid UTF-8
+	EncodingAuto = "auto"
+)
+
+// Config for the Kubernetes secrets keystore
+type Config struct {
+	// AllowedNamespaces lists the namespaces, other than the one of the event, from which
+	// secrets can be read. Secrets of these namespaces can be referenced with the
+	// `kubernetes.<namespace>/<secret>/<key>` syntax.
+	AllowedNamespaces []string `config:"allowed_namespaces"`
+
+	// Cache configures the watch based cache of secrets
+	Cache CacheConfig `config:"cache"`
+
+	// Encoding of the retrieved values, one of raw (default), base64 or auto. It can be overridden
+	// per reference with the `|raw`, `|base64` or `|auto` modifiers.
+	Encoding string `config:"encoding"`
+}
+
+// Validate the keystore config
+func (c *Config) Validate() error {
+	switch c.Encoding {
+	case "", EncodingRaw, EncodingBase64, EncodingAuto:
+		return nil
+	default:
+		return fmt.Errorf("invalid keystore encoding %q, expected one of %s, %s or %s", c.Encoding, EncodingRaw, EncodingBase64, EncodingAuto)
+	}
+}
+
+// CacheConfig for the secrets cache
+type CacheConfig struct {
+	// Enabled makes the keystore watch the secrets of the namespaces it reads from, and serve the
+	// lookups from this cache. Agents need permissions to list and watch secrets in these namespaces.
+	Enabled bool `config:"enabled"`
+
+	// Resync period of the cache informers
+	Resync time.Duration `config:"resync"`
+}
+
+func (c Config) allowedNamespaces() map[string]bool {
+	allowed := make(map[string]bool, len(c.AllowedNamespaces))
+	for _, ns := range c.AllowedNamespaces {
+		allowed[ns] = true
+	}
+	return allowed
+}
@@ -0,0 +1,158 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package k8skeystore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8s "k8s.io/client-go/kubernetes"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/keystore"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// KubernetesConfigMapsKeystoresRegistry implements a Provider for Keystore that resolves keys from
+// ConfigMaps. It is meant for non-sensitive values, secrets should be stored in Secrets.
+type KubernetesConfigMapsKeystoresRegistry struct {
+	logger  *logp.Logger
+	client  k8s.Interface
+	config  Config
+	metrics *Metrics
+}
+
+// KubernetesConfigMapsKeystore allows to retrieve values from Kubernetes ConfigMaps for a given namespace
+type KubernetesConfigMapsKeystore struct {
+	namespace         string
+	allowedNamespaces map[string]bool
+	encoding          string
+	client            k8s.Interface
+	metrics           *Metrics
+	logger            *logp.Logger
+}
+
+// NewKubernetesConfigMapsKeystoresRegistry initializes a KubernetesConfigMapsKeystoresRegistry
+func NewKubernetesConfigMapsKeystoresRegistry(logger *logp.Logger, client k8s.Interface, cfg Config) *KubernetesConfigMapsKeystoresRegistry {
+	return &KubernetesConfigMapsKeystoresRegistry{
+		logger:  logger,
+		client:  client,
+		config:  cfg,
+		metrics: NewMetrics(),
+	}
+}
+
+// Metrics returns the lookup counters of the keystores of the registry
+func (kr *KubernetesConfigMapsKeystoresRegistry) Metrics() *Metrics {
+	return kr.metrics
+}
+
+// GetKeystore returns a KubernetesConfigMapsKeystore for the namespace of the event.
+func (kr *KubernetesConfigMapsKeystoresRegistry) GetKeystore(event bus.Event) keystore.Keystore {
+	namespace := eventNamespace(kr.logger, event)
+	if namespace != "" {
+		return newKubernetesConfigMapsKeystore(namespace, kr.client, kr.logger, kr.config, kr.metrics)
+	}
+	return nil
+}
+
+// NewKubernetesConfigMapsKeystore returns a new keystore backed by the ConfigMaps of a namespace and,
+// if configured, of the allowed namespaces
+func NewKubernetesConfigMapsKeystore(keystoreNamespace string, client k8s.Interface, logger *logp.Logger, cfg Config) (keystore.Keystore, error) {
+	return newKubernetesConfigMapsKeystore(keystoreNamespace, client, logger, cfg, nil), nil
+}
+
+func newKubernetesConfigMapsKeystore(keystoreNamespace string, client k8s.Interface, logger *logp.Logger, cfg Config, metrics *Metrics) *KubernetesConfigMapsKeystore {
+	return &KubernetesConfigMapsKeystore{
+		namespace:         keystoreNamespace,
+		allowedNamespaces: cfg.allowedNamespaces(),
+		encoding:          cfg.Encoding,
+		client:            client,
+		metrics:           metrics,
+		logger:            logger,
+	}
+}
+
+// Retrieve returns a SecureString with the value of a ConfigMap key, referenced as
+// "configmap.somenamespace.someconfigmap.key" or "configmap.somenamespace/someconfigmap/key".
+func (k *KubernetesConfigMapsKeystore) Retrieve(key string) (*keystore.SecureString, error) {
+	if !strings.HasPrefix(key, "configmap.") {
+		return nil, keystore.ErrKeyDoesntExists
+	}
+	ref, mods, validModifier := splitModifiers(key)
+	ns, name, dataKey, ok := parseKey("configmap", ref)
+	if !ok || !validModifier {
+		k.logger.Debugf(
+			"not valid configmap key: %v. ConfigMap keys should be of the following format %v or %v",
+			key,
+			"configmap.somenamespace.someconfigmap.key",
+			"configmap.somenamespace/someconfigmap/key",
+		)
+		return nil, keystore.ErrKeyDoesntExists
+	}
+	if ns != k.namespace && !k.allowedNamespaces[ns] {
+		k.logger.Debugf("cannot access Kubernetes configmaps from a different namespace (%v) than: %v, and it is not in the allowed namespaces", ns, k.namespace)
+		k.audit(ns, name, dataKey, lookupPermissionDenied)
+		return nil, keystore.ErrKeyDoesntExists
+	}
+	configMap, err := k.client.CoreV1().ConfigMaps(ns).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsForbidden(err) {
+			k.logger.Errorf("Permission denied to get configmap %v/%v, check that the agent is allowed to get configmaps in namespace %v: %v", ns, name, ns, err)
+			k.audit(ns, name, dataKey, lookupPermissionDenied)
+			return nil, fmt.Errorf("permission denied to get configmap %v/%v: %w", ns, name, keystore.ErrKeyDoesntExists)
+		}
+		k.logger.Errorf("Could not retrieve configmap from k8s API: %v", err)
+		if apierrors.IsNotFound(err) {
+			k.audit(ns, name, dataKey, lookupNotFound)
+			return missing(mods)
+		}
+		k.audit(ns, name, dataKey, lookupError)
+		return nil, keystore.ErrKeyDoesntExists
+	}
+	if value, ok := configMap.Data[dataKey]; ok {
+		k.audit(ns, name, dataKey, lookupFound)
+		return found([]byte(value), mods, k.encoding), nil
+	}
+	if value, ok := configMap.BinaryData[dataKey]; ok {
+		k.audit(ns, name, dataKey, lookupFound)
+		return found(value, mods, k.encoding), nil
+	}
+	k.logger.Errorf("Could not retrieve value %v for configmap %v", dataKey, name)
+	k.audit(ns, name, dataKey, lookupNotFound)
+	return missing(mods)
+}
+
+func (k *KubernetesConfigMapsKeystore) audit(namespace, name, key string, result lookupResult) {
+	audit(k.logger, k.metrics, "configmap", namespace, name, key, result)
+}
+
+// GetConfig returns config.C representation of the key / value pair to be merged with other
+// loaded configuration.
+func (k *KubernetesConfigMapsKeystore) GetConfig() (*config.C, error) {
+	return nil, nil
+}
+
+// IsPersisted return if the keystore is physically persisted on disk.
+func (k *KubernetesConfigMapsKeystore) IsPersisted() bool {
+	return true
+}
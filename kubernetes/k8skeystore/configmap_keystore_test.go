@@ -0,0 +1,67 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package k8skeystore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+	"github.com/elastic/elastic-agent-libs/keystore"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestConfigMapsKeystoreRetrieve(t *testing.T) {
+	logger := logp.NewLogger("test_k8s_configmaps")
+	client := k8sfake.NewSimpleClientset(
+		&v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: ns},
+			Data:       map[string]string{"host": "es.example.com", "es.port": "9200"},
+			BinaryData: map[string][]byte{"blob": {0x1, 0x2}},
+		},
+		&v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "shared"},
+			Data:       map[string]string{"host": "shared.example.com"},
+		},
+	)
+
+	kRegistry := NewKubernetesConfigMapsKeystoresRegistry(logger, client, Config{AllowedNamespaces: []string{"shared"}})
+	assert.Nil(t, kRegistry.GetKeystore(bus.Event{}))
+	k := kRegistry.GetKeystore(bus.Event{"kubernetes": mapstr.M{"namespace": ns}})
+
+	assertSecret(t, k, "configmap.test_namespace.settings.host", "es.example.com")
+	assertSecret(t, k, "configmap.test_namespace/settings/es.port", "9200")
+	assertSecret(t, k, "configmap.test_namespace.settings.blob", "\x01\x02")
+	assertSecret(t, k, "configmap.shared.settings.host", "shared.example.com")
+
+	for _, key := range []string{
+		"kubernetes.test_namespace.settings.host",
+		"configmap.test_namespace.settings.missing",
+		"configmap.test_namespace.missing.host",
+		"configmap.other.settings.host",
+		"configmap.test_namespace.settings",
+	} {
+		_, err := k.Retrieve(key)
+		assert.ErrorIs(t, err, keystore.ErrKeyDoesntExists, key)
+	}
+}
@@ -19,8 +19,11 @@ package k8skeystore
 
 import (
 	"context"
+	"fmt"
 	"strings"
 
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8s "k8s.io/client-go/kubernetes"
 
@@ -33,15 +36,22 @@ import (
 
 // KubernetesKeystoresRegistry implements a Provider for Keystore.
 type KubernetesKeystoresRegistry struct {
-	logger *logp.Logger
-	client k8s.Interface
+	logger  *logp.Logger
+	client  k8s.Interface
+	config  Config
+	cache   *secretsCache
+	metrics *Metrics
 }
 
 // KubernetesSecretsKeystore allows to retrieve passwords from Kubernetes secrets for a given namespace
 type KubernetesSecretsKeystore struct {
-	namespace string
-	client    k8s.Interface
-	logger    *logp.Logger
+	namespace         string
+	allowedNamespaces map[string]bool
+	encoding          string
+	client            k8s.Interface
+	cache             *secretsCache
+	metrics           *Metrics
+	logger            *logp.Logger
 }
 
 // Factoryk8s Create the right keystore with the configured options
@@ -52,84 +62,185 @@ func Factoryk8s(keystoreNamespace string, ks8client k8s.Interface, logger *logp.
 
 // NewKubernetesKeystoresRegistry initializes a KubernetesKeystoresRegistry
 func NewKubernetesKeystoresRegistry(logger *logp.Logger, client k8s.Interface) bus.KeystoreProvider {
-	return &KubernetesKeystoresRegistry{
-		logger: logger,
-		client: client,
+	return NewKubernetesKeystoresRegistryWithConfig(logger, client, Config{})
+}
+
+// NewKubernetesKeystoresRegistryWithConfig initializes a KubernetesKeystoresRegistry with the given config.
+// If the cache is enabled, the keystores of the registry share it, and the registry must be stopped
+// with Stop when not needed anymore.
+func NewKubernetesKeystoresRegistryWithConfig(logger *logp.Logger, client k8s.Interface, cfg Config) *KubernetesKeystoresRegistry {
+	registry := &KubernetesKeystoresRegistry{
+		logger:  logger,
+		client:  client,
+		config:  cfg,
+		metrics: NewMetrics(),
+	}
+	if cfg.Cache.Enabled {
+		registry.cache = newSecretsCache(client, logger, cfg.Cache.Resync)
+	}
+	return registry
+}
+
+// Stop the secrets cache of the registry, if any. Keystores keep working after the registry is
+// stopped, retrieving secrets directly from the API.
+func (kr *KubernetesKeystoresRegistry) Stop() {
+	if kr.cache != nil {
+		kr.cache.Stop()
 	}
 }
 
+// Metrics returns the lookup counters of the keystores of the registry
+func (kr *KubernetesKeystoresRegistry) Metrics() *Metrics {
+	return kr.metrics
+}
+
 // GetKeystore return a KubernetesSecretsKeystore if it already exists for a given namespace or creates a new one.
 func (kr *KubernetesKeystoresRegistry) GetKeystore(event bus.Event) keystore.Keystore {
+	namespace := eventNamespace(kr.logger, event)
+	if namespace != "" {
+		return newKubernetesSecretsKeystore(namespace, kr.client, kr.logger, kr.config, kr.cache, kr.metrics)
+	}
+	return nil
+}
+
+// eventNamespace returns the Kubernetes namespace of an event, or an empty string if it has none.
+func eventNamespace(logger *logp.Logger, event bus.Event) string {
 	namespace := ""
 	if val, ok := event["kubernetes"]; ok {
 		kubernetesMeta, ok := val.(mapstr.M)
 		if !ok {
-			kr.logger.Debugf("Unexpected type for kubernetes: %v", kubernetesMeta)
-			return nil
+			logger.Debugf("Unexpected type for kubernetes: %v", kubernetesMeta)
+			return ""
 		}
 		ns, err := kubernetesMeta.GetValue("namespace")
 		if err != nil {
-			kr.logger.Debugf("Cannot retrieve kubernetes namespace from event: %s", event)
-			return nil
+			logger.Debugf("Cannot retrieve kubernetes namespace from event: %s", event)
+			return ""
 		}
 		namespace, ok = ns.(string)
 		if !ok {
-			return nil
+			return ""
 		}
 	}
-	if namespace != "" {
-		k8sKeystore, _ := Factoryk8s(namespace, kr.client, kr.logger)
-		return k8sKeystore
+	if namespace == "" {
+		logger.Debugf("Cannot retrieve kubernetes namespace from event: %s", event)
 	}
-	kr.logger.Debugf("Cannot retrieve kubernetes namespace from event: %s", event)
-	return nil
+	return namespace
 }
 
 // NewKubernetesSecretsKeystore returns an new k8s Keystore
 func NewKubernetesSecretsKeystore(keystoreNamespace string, ks8client k8s.Interface, logger *logp.Logger) (keystore.Keystore, error) {
+	return NewKubernetesSecretsKeystoreWithConfig(keystoreNamespace, ks8client, logger, Config{})
+}
+
+// NewKubernetesSecretsKeystoreWithConfig returns an new k8s Keystore that can also read secrets
+// from the allowed namespaces of the config
+func NewKubernetesSecretsKeystoreWithConfig(keystoreNamespace string, ks8client k8s.Interface, logger *logp.Logger, cfg Config) (keystore.Keystore, error) {
+	return newKubernetesSecretsKeystore(keystoreNamespace, ks8client, logger, cfg, nil, nil), nil
+}
+
+func newKubernetesSecretsKeystore(keystoreNamespace string, ks8client k8s.Interface, logger *logp.Logger, cfg Config, cache *secretsCache, metrics *Metrics) *KubernetesSecretsKeystore {
 	keystore := KubernetesSecretsKeystore{
-		namespace: keystoreNamespace,
-		client:    ks8client,
-		logger:    logger,
+		namespace:         keystoreNamespace,
+		allowedNamespaces: cfg.allowedNamespaces(),
+		encoding:          cfg.Encoding,
+		client:            ks8client,
+		cache:             cache,
+		metrics:           metrics,
+		logger:            logger,
 	}
-	return &keystore, nil
+	return &keystore
 }
 
 // Retrieve return a SecureString instance that will contains both the key and the secret.
 func (k *KubernetesSecretsKeystore) Retrieve(key string) (*keystore.SecureString, error) {
 	// key = "kubernetes.somenamespace.somesecret.value"
-	tokens := strings.Split(key, ".")
-	if len(tokens) > 0 && tokens[0] != "kubernetes" {
+	if !strings.HasPrefix(key, "kubernetes.") {
 		return nil, keystore.ErrKeyDoesntExists
 	}
-	if len(tokens) != 4 {
+	ref, mods, validModifier := splitModifiers(key)
+	ns, secretName, secretVar, ok := parseKey("kubernetes", ref)
+	if !ok || !validModifier {
 		k.logger.Debugf(
-			"not valid secret key: %v. Secrets should be of the following format %v",
+			"not valid secret key: %v. Secrets should be of the following format %v or %v",
 			key,
 			"kubernetes.somenamespace.somesecret.value",
+			"kubernetes.somenamespace/somesecret/value",
 		)
+		k.logger.Debugf("secret keys can be followed by the %q, %q, %q, %q or %q modifiers",
+			"|"+modifierOptional, "|"+modifierDefault+"value", "|"+EncodingRaw, "|"+EncodingBase64, "|"+EncodingAuto)
 		return nil, keystore.ErrKeyDoesntExists
 	}
-	ns := tokens[1]
-	secretName := tokens[2]
-	secretVar := tokens[3]
-	if ns != k.namespace {
-		k.logger.Debugf("cannot access Kubernetes secrets from a different namespace (%v) than: %v", ns, k.namespace)
+	if ns != k.namespace && !k.allowedNamespaces[ns] {
+		k.logger.Debugf("cannot access Kubernetes secrets from a different namespace (%v) than: %v, and it is not in the allowed namespaces", ns, k.namespace)
+		k.audit(ns, secretName, secretVar, lookupPermissionDenied)
 		return nil, keystore.ErrKeyDoesntExists
 	}
-	secretIntefrace := k.client.CoreV1().Secrets(ns)
-	ctx := context.TODO()
-	secret, err := secretIntefrace.Get(ctx, secretName, metav1.GetOptions{})
+	secret, cached, err := k.getSecret(ns, secretName)
 	if err != nil {
+		if apierrors.IsForbidden(err) {
+			k.logger.Errorf("Permission denied to get secret %v/%v, check that the agent is allowed to get secrets in namespace %v: %v", ns, secretName, ns, err)
+			k.audit(ns, secretName, secretVar, lookupPermissionDenied)
+			return nil, fmt.Errorf("permission denied to get secret %v/%v: %w", ns, secretName, keystore.ErrKeyDoesntExists)
+		}
 		k.logger.Errorf("Could not retrieve secret from k8s API: %v", err)
+		if apierrors.IsNotFound(err) {
+			k.audit(ns, secretName, secretVar, lookupNotFound)
+			return missing(mods)
+		}
+		k.audit(ns, secretName, secretVar, lookupError)
 		return nil, keystore.ErrKeyDoesntExists
 	}
 	if _, ok := secret.Data[secretVar]; !ok {
 		k.logger.Errorf("Could not retrieve value %v for secret %v", secretVar, secretName)
-		return nil, keystore.ErrKeyDoesntExists
+		k.audit(ns, secretName, secretVar, lookupNotFound)
+		return missing(mods)
+	}
+	if cached {
+		k.audit(ns, secretName, secretVar, lookupCacheHit)
+	} else {
+		k.audit(ns, secretName, secretVar, lookupFound)
 	}
 	secretString := secret.Data[secretVar]
-	return keystore.NewSecureString(secretString), nil
+	return found(secretString, mods, k.encoding), nil
+}
+
+func (k *KubernetesSecretsKeystore) getSecret(namespace, name string) (*v1.Secret, bool, error) {
+	if k.cache != nil {
+		return k.cache.Get(namespace, name)
+	}
+	secretIntefrace := k.client.CoreV1().Secrets(namespace)
+	ctx := context.TODO()
+	secret, err := secretIntefrace.Get(ctx, name, metav1.GetOptions{})
+	return secret, false, err
+}
+
+func (k *KubernetesSecretsKeystore) audit(namespace, name, key string, result lookupResult) {
+	audit(k.logger, k.metrics, "secret", namespace, name, key, result)
+}
+
+// parseKey splits a key reference into its namespace, object name and object key. Both
+// "<prefix>.somenamespace.someobject.value" and "<prefix>.somenamespace/someobject/value" are
+// supported, the latter allows to reference objects and keys containing dots.
+func parseKey(prefix, key string) (namespace, name, value string, ok bool) {
+	ref := strings.TrimPrefix(key, prefix+".")
+	if ref == key {
+		return "", "", "", false
+	}
+	sep := "."
+	if strings.Contains(ref, "/") {
+		sep = "/"
+	}
+	tokens := strings.Split(ref, sep)
+	if len(tokens) != 3 {
+		return "", "", "", false
+	}
+	for _, token := range tokens {
+		if token == "" {
+			return "", "", "", false
+		}
+	}
+	return tokens[0], tokens[1], tokens[2], true
 }
 
 // GetConfig returns config.C representation of the key / secret pair to be merged with other
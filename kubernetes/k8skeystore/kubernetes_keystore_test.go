@@ -19,17 +19,23 @@ package k8skeystore
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/elastic/elastic-agent-autodiscover/bus"
+	"github.com/elastic/elastic-agent-libs/keystore"
 	"github.com/elastic/elastic-agent-libs/logp"
 	"github.com/elastic/elastic-agent-libs/mapstr"
 
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 const (
@@ -144,3 +150,66 @@ func getKeystoreForWrongValue(t *testing.T) bus.KeystoreProvider {
 
 	return NewKubernetesKeystoresRegistry(logger, client)
 }
+
+func TestParseKey(t *testing.T) {
+	tests := map[string][]string{
+		"kubernetes.ns.secret.key":        {"ns", "secret", "key"},
+		"kubernetes.ns/secret/key":        {"ns", "secret", "key"},
+		"kubernetes.ns/my.secret/tls.key": {"ns", "my.secret", "tls.key"},
+		"kubernetes.ns.secret":            nil,
+		"kubernetes.ns/secret":            nil,
+		"kubernetes.ns//key":              nil,
+		"kubernetes.ns.secret.key.extra":  nil,
+		"configmap.ns.secret.key":         nil,
+		"kubernetes.ns/secret/key/extra":  nil,
+	}
+	for key, expected := range tests {
+		ns, secret, value, ok := parseKey("kubernetes", key)
+		if expected == nil {
+			assert.False(t, ok, key)
+			continue
+		}
+		assert.True(t, ok, key)
+		assert.Equal(t, expected, []string{ns, secret, value}, key)
+	}
+}
+
+func TestRetrieveFromAllowedNamespace(t *testing.T) {
+	logger := logp.NewLogger("test_k8s_secrets")
+	client := k8sfake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "shared.secret", Namespace: "shared"},
+		Data:       map[string][]byte{"secret_value": []byte(pass)},
+	})
+
+	// Not allowed by default
+	kRegistry := NewKubernetesKeystoresRegistry(logger, client)
+	k1 := kRegistry.GetKeystore(bus.Event{"kubernetes": mapstr.M{"namespace": ns}})
+	_, err := k1.Retrieve("kubernetes.shared/shared.secret/secret_value")
+	assert.ErrorIs(t, err, keystore.ErrKeyDoesntExists)
+
+	kRegistry = NewKubernetesKeystoresRegistryWithConfig(logger, client, Config{AllowedNamespaces: []string{"shared"}})
+	k1 = kRegistry.GetKeystore(bus.Event{"kubernetes": mapstr.M{"namespace": ns}})
+	secure, err := k1.Retrieve("kubernetes.shared/shared.secret/secret_value")
+	require.NoError(t, err)
+	secretVal, err := secure.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(pass), secretVal)
+
+	// Other namespaces are still not allowed
+	_, err = k1.Retrieve("kubernetes.other/shared.secret/secret_value")
+	assert.ErrorIs(t, err, keystore.ErrKeyDoesntExists)
+}
+
+func TestRetrieveForbidden(t *testing.T) {
+	logger := logp.NewLogger("test_k8s_secrets")
+	client := k8sfake.NewSimpleClientset()
+	client.PrependReactor("get", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(v1.Resource("secrets"), "testing_secret", errors.New("rbac"))
+	})
+
+	k1, err := NewKubernetesSecretsKeystore(ns, client, logger)
+	require.NoError(t, err)
+	_, err = k1.Retrieve(correctKey)
+	assert.ErrorIs(t, err, keystore.ErrKeyDoesntExists)
+	assert.Contains(t, err.Error(), "permission denied")
+}
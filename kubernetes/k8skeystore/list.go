@@ -0,0 +1,139 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package k8skeystore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// List returns the references of all the keys of the secrets the keystore can read, values are
+// never retrieved. Namespaces where secrets cannot be listed are skipped.
+func (k *KubernetesSecretsKeystore) List() ([]string, error) {
+	return k.ListPrefix("")
+}
+
+// ListPrefix returns the references of the keys of the secrets the keystore can read that start
+// with the given prefix, e.g. "kubernetes.somenamespace.somesecret"
+func (k *KubernetesSecretsKeystore) ListPrefix(prefix string) ([]string, error) {
+	return listReferences("kubernetes", prefix, k.namespaces(), func(namespace string) (map[string][]string, error) {
+		secrets, err := k.client.CoreV1().Secrets(namespace).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		keys := make(map[string][]string, len(secrets.Items))
+		for _, secret := range secrets.Items {
+			for key := range secret.Data {
+				keys[secret.Name] = append(keys[secret.Name], key)
+			}
+		}
+		return keys, nil
+	}, k.logger.Warnf)
+}
+
+// List returns the references of all the keys of the configmaps the keystore can read, values are
+// never retrieved. Namespaces where configmaps cannot be listed are skipped.
+func (k *KubernetesConfigMapsKeystore) List() ([]string, error) {
+	return k.ListPrefix("")
+}
+
+// ListPrefix returns the references of the keys of the configmaps the keystore can read that start
+// with the given prefix, e.g. "configmap.somenamespace.someconfigmap"
+func (k *KubernetesConfigMapsKeystore) ListPrefix(prefix string) ([]string, error) {
+	return listReferences("configmap", prefix, k.namespaces(), func(namespace string) (map[string][]string, error) {
+		configMaps, err := k.client.CoreV1().ConfigMaps(namespace).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		keys := make(map[string][]string, len(configMaps.Items))
+		for _, configMap := range configMaps.Items {
+			for key := range configMap.Data {
+				keys[configMap.Name] = append(keys[configMap.Name], key)
+			}
+			for key := range configMap.BinaryData {
+				keys[configMap.Name] = append(keys[configMap.Name], key)
+			}
+		}
+		return keys, nil
+	}, k.logger.Warnf)
+}
+
+func (k *KubernetesSecretsKeystore) namespaces() []string {
+	return readableNamespaces(k.namespace, k.allowedNamespaces)
+}
+
+func (k *KubernetesConfigMapsKeystore) namespaces() []string {
+	return readableNamespaces(k.namespace, k.allowedNamespaces)
+}
+
+// readableNamespaces returns the sorted list of namespaces a keystore can read from
+func readableNamespaces(namespace string, allowed map[string]bool) []string {
+	namespaces := []string{namespace}
+	for ns, ok := range allowed {
+		if ok && ns != namespace {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// listReferences builds the sorted references of the keys of the objects returned by list for every
+// namespace. Namespaces that cannot be listed because of missing permissions are skipped.
+func listReferences(
+	kind, prefix string,
+	namespaces []string,
+	list func(namespace string) (map[string][]string, error),
+	warnf func(string, ...interface{}),
+) ([]string, error) {
+	refs := []string{}
+	for _, ns := range namespaces {
+		keys, err := list(ns)
+		if apierrors.IsForbidden(err) {
+			warnf("Permission denied to list %v keys in namespace %v, they are not included in the list: %v", kind, ns, err)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %v keys in namespace %v: %w", kind, ns, err)
+		}
+		for name, objectKeys := range keys {
+			for _, key := range objectKeys {
+				ref := formatKey(kind, ns, name, key)
+				if strings.HasPrefix(ref, prefix) {
+					refs = append(refs, ref)
+				}
+			}
+		}
+	}
+	sort.Strings(refs)
+	return refs, nil
+}
+
+// formatKey builds the reference of a key, using the slash separated format when any of the parts
+// contains dots
+func formatKey(prefix, namespace, name, key string) string {
+	if strings.Contains(name, ".") || strings.Contains(key, ".") {
+		return prefix + "." + namespace + "/" + name + "/" + key
+	}
+	return prefix + "." + namespace + "." + name + "." + key
+}
@@ -0,0 +1,93 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package k8skeystore
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/elastic/elastic-agent-libs/keystore"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+func TestList(t *testing.T) {
+	logger := logp.NewLogger("test_k8s_secrets")
+	client := k8sfake.NewSimpleClientset(
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "testing_secret", Namespace: ns},
+			Data:       map[string][]byte{"secret_value": []byte(pass), "username": []byte("elastic")},
+		},
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "tls", Namespace: "shared"},
+			Data:       map[string][]byte{"tls.crt": []byte("crt")},
+		},
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "forbidden", Namespace: "other"},
+			Data:       map[string][]byte{"secret_value": []byte(pass)},
+		},
+		&v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: ns},
+			Data:       map[string]string{"host": "es.example.com"},
+		},
+	)
+	client.PrependReactor("list", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetNamespace() == "other" {
+			return true, nil, apierrors.NewForbidden(v1.Resource("secrets"), "", errors.New("rbac"))
+		}
+		return false, nil, nil
+	})
+
+	cfg := Config{AllowedNamespaces: []string{"shared", "other"}}
+	secrets, err := NewKubernetesSecretsKeystoreWithConfig(ns, client, logger, cfg)
+	require.NoError(t, err)
+	lister, err := keystore.AsListingKeystore(secrets)
+	require.NoError(t, err)
+
+	refs, err := lister.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"kubernetes.shared/tls/tls.crt",
+		"kubernetes.test_namespace.testing_secret.secret_value",
+		"kubernetes.test_namespace.testing_secret.username",
+	}, refs)
+
+	// All the listed references can be retrieved
+	for _, ref := range refs {
+		_, err := secrets.Retrieve(ref)
+		assert.NoError(t, err, ref)
+	}
+
+	refs, err = secrets.(*KubernetesSecretsKeystore).ListPrefix("kubernetes.test_namespace.testing_secret.u")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kubernetes.test_namespace.testing_secret.username"}, refs)
+
+	configMaps, err := NewKubernetesConfigMapsKeystore(ns, client, logger, Config{})
+	require.NoError(t, err)
+	refs, err = configMaps.(*KubernetesConfigMapsKeystore).List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"configmap.test_namespace.settings.host"}, refs)
+}
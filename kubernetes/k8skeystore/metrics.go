@@ -0,0 +1,155 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package k8skeystore
+
+import (
+	"sync"
+
+	"github.com/elastic/elastic-agent-autodiscover/metrics"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// LookupStats are the counters of the lookups of a key reference
+type LookupStats struct {
+	// Lookups is the number of times the reference was retrieved
+	Lookups int64
+	// CacheHits is the number of lookups served from the cache
+	CacheHits int64
+	// NotFound is the number of lookups of objects or keys that don't exist
+	NotFound int64
+	// PermissionDenied is the number of lookups forbidden by RBAC or by the allowed namespaces
+	PermissionDenied int64
+	// Errors is the number of lookups that failed for other reasons
+	Errors int64
+}
+
+// OtherReferences is the reference of the counters aggregating the lookups of the references
+// retrieved once the maximum number of references is reached
+const OtherReferences = "_other"
+
+// defaultMaxReferences is the number of references with their own counters
+const defaultMaxReferences = 1000
+
+// Metrics keeps the lookup counters of every key reference retrieved from the keystores of a
+// registry. References are stored as "<namespace>/<name>/<key>", values are never recorded. The
+// number of references is bounded, the lookups of new references are aggregated under
+// OtherReferences once it is reached.
+type Metrics struct {
+	sync.Mutex
+	refs    map[string]*LookupStats
+	maxRefs int
+	lookups metrics.Counter
+}
+
+// NewMetrics creates an empty Metrics
+func NewMetrics() *Metrics {
+	return &Metrics{refs: make(map[string]*LookupStats), maxRefs: defaultMaxReferences}
+}
+
+// Stats returns a snapshot of the counters of every reference
+func (m *Metrics) Stats() map[string]LookupStats {
+	m.Lock()
+	defer m.Unlock()
+
+	stats := make(map[string]LookupStats, len(m.refs))
+	for ref, s := range m.refs {
+		stats[ref] = *s
+	}
+	return stats
+}
+
+// Register reports the lookups to a metrics registry too, counted by keystore kind and result.
+// References are not used as labels, their number is not bounded.
+func (m *Metrics) Register(r metrics.Registry) {
+	lookups := r.Counter("autodiscover_keystore_lookups_total", "Keystore lookups, per keystore kind and result.", "kind", "result")
+
+	m.Lock()
+	defer m.Unlock()
+	m.lookups = lookups
+}
+
+type lookupResult int
+
+const (
+	lookupFound lookupResult = iota
+	lookupCacheHit
+	lookupNotFound
+	lookupPermissionDenied
+	lookupError
+)
+
+func (r lookupResult) String() string {
+	switch r {
+	case lookupFound:
+		return "found"
+	case lookupCacheHit:
+		return "cache_hit"
+	case lookupNotFound:
+		return "not_found"
+	case lookupPermissionDenied:
+		return "permission_denied"
+	default:
+		return "error"
+	}
+}
+
+func (m *Metrics) record(kind, namespace, name, key string, result lookupResult) {
+	if m == nil {
+		return
+	}
+	ref := namespace + "/" + name + "/" + key
+
+	m.Lock()
+	defer m.Unlock()
+
+	s, ok := m.refs[ref]
+	if !ok && len(m.refs) >= m.maxRefs {
+		ref = OtherReferences
+		s, ok = m.refs[ref]
+	}
+	if !ok {
+		s = &LookupStats{}
+		m.refs[ref] = s
+	}
+	s.Lookups++
+	switch result {
+	case lookupCacheHit:
+		s.CacheHits++
+	case lookupNotFound:
+		s.NotFound++
+	case lookupPermissionDenied:
+		s.PermissionDenied++
+	case lookupError:
+		s.Errors++
+	}
+	if m.lookups != nil {
+		m.lookups.Add(1, kind, result.String())
+	}
+}
+
+// audit records the result of the lookup of a reference, the value is never recorded
+func audit(logger *logp.Logger, metrics *Metrics, kind, namespace, name, key string, result lookupResult) {
+	metrics.record(kind, namespace, name, key, result)
+	if logger != nil && logger.IsDebug() {
+		logger.With(
+			"kubernetes.keystore.kind", kind,
+			"kubernetes.keystore.reference", namespace+"/"+name+"/"+key,
+			"kubernetes.keystore.result", result.String(),
+		).Debug("Keystore lookup")
+	}
+}
@@ -0,0 +1,97 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package k8skeystore
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+	"github.com/elastic/elastic-agent-autodiscover/metrics"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestKeystoreMetrics(t *testing.T) {
+	logger := logp.NewLogger("test_k8s_secrets")
+	client := k8sfake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "testing_secret", Namespace: ns},
+		Data:       map[string][]byte{"secret_value": []byte(pass)},
+	})
+	client.PrependReactor("get", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.(k8stesting.GetAction).GetName() == "forbidden" {
+			return true, nil, apierrors.NewForbidden(v1.Resource("secrets"), "forbidden", errors.New("rbac"))
+		}
+		return false, nil, nil
+	})
+
+	registry := NewKubernetesKeystoresRegistryWithConfig(logger, client, Config{Cache: CacheConfig{Enabled: true}})
+	defer registry.Stop()
+	lookups := metrics.NewInMemory()
+	registry.Metrics().Register(lookups)
+	k := registry.GetKeystore(bus.Event{"kubernetes": mapstr.M{"namespace": ns}})
+
+	assertSecret(t, k, correctKey, pass)
+	require.Eventually(t, func() bool { return registry.cache.informer(ns).HasSynced() }, 5*time.Second, 10*time.Millisecond)
+	assertSecret(t, k, correctKey, pass)
+	_, err := k.Retrieve("kubernetes.test_namespace.testing_secret.missing")
+	assert.Error(t, err)
+	_, err = k.Retrieve("kubernetes.test_namespace.forbidden.secret_value")
+	assert.Error(t, err)
+	_, err = k.Retrieve("kubernetes.other.testing_secret.secret_value")
+	assert.Error(t, err)
+
+	assert.Equal(t, map[string]LookupStats{
+		"test_namespace/testing_secret/secret_value": {Lookups: 2, CacheHits: 1},
+		"test_namespace/testing_secret/missing":      {Lookups: 1, NotFound: 1},
+		"test_namespace/forbidden/secret_value":      {Lookups: 1, PermissionDenied: 1},
+		"other/testing_secret/secret_value":          {Lookups: 1, PermissionDenied: 1},
+	}, registry.Metrics().Stats())
+
+	for result, expected := range map[string]float64{"found": 1, "cache_hit": 1, "not_found": 1, "permission_denied": 2} {
+		value, ok := lookups.Value("autodiscover_keystore_lookups_total", "secret", result)
+		assert.True(t, ok, result)
+		assert.Equal(t, expected, value, result)
+	}
+}
+
+func TestKeystoreMetricsMaxReferences(t *testing.T) {
+	m := NewMetrics()
+	m.maxRefs = 2
+	m.record("secret", ns, "a", "key", lookupFound)
+	m.record("secret", ns, "b", "key", lookupFound)
+	m.record("secret", ns, "c", "key", lookupNotFound)
+	m.record("secret", ns, "d", "key", lookupFound)
+	m.record("secret", ns, "a", "key", lookupCacheHit)
+
+	assert.Equal(t, map[string]LookupStats{
+		ns + "/a/key":   {Lookups: 2, CacheHits: 1},
+		ns + "/b/key":   {Lookups: 1},
+		OtherReferences: {Lookups: 2, NotFound: 1},
+	}, m.Stats())
+}
@@ -0,0 +1,109 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package k8skeystore
+
+import (
+	"encoding/base64"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/elastic/elastic-agent-libs/keystore"
+)
+
+// Key references can be followed by modifiers to resolve references to missing objects or keys,
+// or to change the encoding of the value:
+//
+//	kubernetes.somenamespace.somesecret.value|optional        resolves to an empty value
+//	kubernetes.somenamespace.somesecret.value|default=foo.bar resolves to "foo.bar"
+//	kubernetes.somenamespace.somesecret.value|base64          resolves to the base64 encoded value
+//	kubernetes.somenamespace.somesecret.value|base64|optional
+//
+// The default modifier must be the last one, its value is everything after "default=". Modifiers
+// don't apply when the lookup fails for other reasons, like missing permissions.
+const (
+	modifierSeparator = "|"
+	modifierOptional  = "optional"
+	modifierDefault   = "default="
+)
+
+// fallback is the value of a missing reference with a modifier
+type fallback struct {
+	value []byte
+}
+
+type modifiers struct {
+	fallback *fallback
+	encoding string
+}
+
+// splitModifiers returns the reference of a key without its modifiers, and the modifiers. It
+// returns false if any modifier is not valid.
+func splitModifiers(key string) (string, modifiers, bool) {
+	var m modifiers
+	ref, rest, found := strings.Cut(key, modifierSeparator)
+	for found {
+		var modifier string
+		if strings.HasPrefix(rest, modifierDefault) {
+			modifier, rest, found = rest, "", false
+		} else {
+			modifier, rest, found = strings.Cut(rest, modifierSeparator)
+		}
+		switch {
+		case modifier == modifierOptional && m.fallback == nil:
+			m.fallback = &fallback{value: []byte{}}
+		case strings.HasPrefix(modifier, modifierDefault) && m.fallback == nil:
+			m.fallback = &fallback{value: []byte(strings.TrimPrefix(modifier, modifierDefault))}
+		case (modifier == EncodingRaw || modifier == EncodingBase64 || modifier == EncodingAuto) && m.encoding == "":
+			m.encoding = modifier
+		default:
+			return ref, m, false
+		}
+	}
+	return ref, m, true
+}
+
+// missing returns the result of the lookup of a missing reference, default values are returned
+// as they are, without encoding
+func missing(m modifiers) (*keystore.SecureString, error) {
+	if m.fallback != nil {
+		return keystore.NewSecureString(m.fallback.value), nil
+	}
+	return nil, keystore.ErrKeyDoesntExists
+}
+
+// found returns the result of the lookup of an existing value, encoded with the encoding of the
+// modifiers, or the default one of the keystore
+func found(value []byte, m modifiers, defaultEncoding string) *keystore.SecureString {
+	encoding := m.encoding
+	if encoding == "" {
+		encoding = defaultEncoding
+	}
+	return keystore.NewSecureString(encode(value, encoding))
+}
+
+func encode(value []byte, encoding string) []byte {
+	switch encoding {
+	case EncodingBase64:
+		return []byte(base64.StdEncoding.EncodeToString(value))
+	case EncodingAuto:
+		if !utf8.Valid(value) {
+			return []byte(base64.StdEncoding.EncodeToString(value))
+		}
+	}
+	return value
+}
@@ -0,0 +1,139 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package k8skeystore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/keystore"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/go-ucfg"
+)
+
+func TestRetrieveWithModifiers(t *testing.T) {
+	logger := logp.NewLogger("test_k8s_secrets")
+	client := k8sfake.NewSimpleClientset(
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "testing_secret", Namespace: ns},
+			Data:       map[string][]byte{"secret_value": []byte(pass)},
+		},
+		&v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: ns},
+			Data:       map[string]string{"host": "es.example.com"},
+		},
+	)
+	secrets, err := NewKubernetesSecretsKeystore(ns, client, logger)
+	require.NoError(t, err)
+	configMaps, err := NewKubernetesConfigMapsKeystore(ns, client, logger, Config{})
+	require.NoError(t, err)
+
+	assertSecret(t, secrets, correctKey+"|optional", pass)
+	assertSecret(t, secrets, correctKey+"|default=other", pass)
+	assertSecret(t, secrets, "kubernetes.test_namespace.testing_secret.missing|optional", "")
+	assertSecret(t, secrets, "kubernetes.test_namespace.missing.secret_value|default=https://es.example.com:9200", "https://es.example.com:9200")
+	assertSecret(t, configMaps, "configmap.test_namespace/settings/port|default=9200", "9200")
+	assertSecret(t, configMaps, "configmap.test_namespace.missing.host|optional", "")
+
+	for _, key := range []string{
+		// Modifiers don't apply to not allowed namespaces
+		"kubernetes.other.testing_secret.secret_value|optional",
+		// Unknown modifier
+		"kubernetes.test_namespace.testing_secret.secret_value|required",
+	} {
+		_, err = secrets.Retrieve(key)
+		assert.ErrorIs(t, err, keystore.ErrKeyDoesntExists, key)
+	}
+}
+
+func TestResolveWithModifiers(t *testing.T) {
+	client := k8sfake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "testing_secret", Namespace: ns},
+		Data:       map[string][]byte{"secret_value": []byte(pass)},
+	})
+	secrets, err := NewKubernetesSecretsKeystore(ns, client, logp.NewLogger("test_k8s_secrets"))
+	require.NoError(t, err)
+
+	cfg, err := ucfg.NewFrom(map[string]interface{}{
+		"password": "${kubernetes.test_namespace.testing_secret.secret_value}",
+		"username": "${kubernetes.test_namespace.testing_secret.username|default=elastic}",
+		"api_key":  "${kubernetes.test_namespace.testing_secret.api_key|optional}",
+	}, ucfg.PathSep("."), ucfg.VarExp)
+	require.NoError(t, err)
+
+	var c struct {
+		Password string `config:"password"`
+		Username string `config:"username"`
+		APIKey   string `config:"api_key"`
+	}
+	require.NoError(t, cfg.Unpack(&c, ucfg.PathSep("."), ucfg.VarExp, ucfg.Resolve(keystore.ResolverWrap(secrets))))
+	assert.Equal(t, pass, c.Password)
+	assert.Equal(t, "elastic", c.Username)
+	assert.Equal(t, "", c.APIKey)
+}
+
+func TestRetrieveBinary(t *testing.T) {
+	logger := logp.NewLogger("test_k8s_secrets")
+	bundle := []byte{0x30, 0x82, 0xff, 0x00}
+	client := k8sfake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "certs", Namespace: ns},
+		Data:       map[string][]byte{"bundle.p12": bundle, "password": []byte(pass)},
+	})
+
+	raw, err := NewKubernetesSecretsKeystore(ns, client, logger)
+	require.NoError(t, err)
+	assertSecret(t, raw, "kubernetes.test_namespace/certs/bundle.p12", string(bundle))
+	assertSecret(t, raw, "kubernetes.test_namespace/certs/bundle.p12|base64", "MIL/AA==")
+	assertSecret(t, raw, "kubernetes.test_namespace/certs/bundle.p12|auto", "MIL/AA==")
+	assertSecret(t, raw, "kubernetes.test_namespace/certs/password|auto", pass)
+	assertSecret(t, raw, "kubernetes.test_namespace/certs/missing|base64|default=abc", "abc")
+
+	encoded, err := NewKubernetesSecretsKeystoreWithConfig(ns, client, logger, Config{Encoding: EncodingBase64})
+	require.NoError(t, err)
+	assertSecret(t, encoded, "kubernetes.test_namespace/certs/bundle.p12", "MIL/AA==")
+	assertSecret(t, encoded, "kubernetes.test_namespace/certs/password|raw", pass)
+
+	for _, key := range []string{
+		"kubernetes.test_namespace/certs/password|base64|raw",
+		"kubernetes.test_namespace/certs/password|optional|optional",
+		"kubernetes.test_namespace/certs/password|hex",
+	} {
+		_, err = raw.Retrieve(key)
+		assert.ErrorIs(t, err, keystore.ErrKeyDoesntExists, key)
+	}
+}
+
+func TestEncodingConfig(t *testing.T) {
+	for encoding, valid := range map[string]bool{"": true, "raw": true, "base64": true, "auto": true, "hex": false} {
+		cfg, err := config.NewConfigFrom(map[string]interface{}{"encoding": encoding})
+		require.NoError(t, err)
+		var c Config
+		err = cfg.Unpack(&c)
+		if valid {
+			assert.NoError(t, err, encoding)
+		} else {
+			assert.Error(t, err, encoding)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package k8skeystore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/go-connections/tlsconfig"
+
+	"github.com/elastic/elastic-agent-libs/keystore"
+)
+
+const (
+	defaultServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+	// NamespacePlaceholder is replaced by the namespace of the secret reference in PathPrefix
+	NamespacePlaceholder = "{namespace}"
+)
+
+// VaultConfig configures the Vault backend
+type VaultConfig struct {
+	// Address of the Vault server, e.g. https://vault.example.com:8200
+	Address string `config:"address"`
+
+	// Role to log in with the Kubernetes auth method
+	Role string `config:"role"`
+
+	// AuthPath is the mount path of the Kubernetes auth method
+	AuthPath string `config:"auth_path"`
+
+	// TokenPath is the path of the service account token used to log in
+	TokenPath string `config:"token_path"`
+
+	// KVVersion is the version of the KV secrets engine, 1 or 2
+	KVVersion int `config:"kv_version"`
+
+	// Timeout of the requests to Vault
+	Timeout time.Duration `config:"timeout"`
+
+	// PathPrefix is the prefix of the paths that can be read for references of a namespace. It
+	// must contain the {namespace} placeholder, e.g. "secret/data/{namespace}", so a namespace
+	// cannot read the secrets of the others. An empty value only allows AllowedPaths.
+	PathPrefix string `config:"path_prefix"`
+
+	// AllowedPaths maps namespaces to additional path prefixes they are allowed to read
+	AllowedPaths map[string][]string `config:"allowed_paths"`
+
+	// TLS settings of the connection to Vault
+	TLS *VaultTLSConfig `config:"ssl"`
+}
+
+// VaultTLSConfig configures the TLS connection to Vault
+type VaultTLSConfig struct {
+	CA          string `config:"certificate_authority"`
+	Certificate string `config:"certificate"`
+	Key         string `config:"key"`
+	// ServerName overrides the name used to verify the certificate of the server
+	ServerName string `config:"server_name"`
+	// InsecureSkipVerify disables the verification of the certificate of the server
+	InsecureSkipVerify bool `config:"insecure_skip_verify"`
+}
+
+// InitDefaults initializes the defaults for the config.
+func (c *VaultConfig) InitDefaults() {
+	c.AuthPath = "kubernetes"
+	c.TokenPath = defaultServiceAccountTokenPath
+	c.KVVersion = 2
+	c.Timeout = 10 * time.Second
+	c.PathPrefix = "secret/data/" + NamespacePlaceholder
+}
+
+// Validate the Vault config
+func (c *VaultConfig) Validate() error {
+	if c.Address == "" || c.Role == "" {
+		return fmt.Errorf("vault address and role are required")
+	}
+	if c.KVVersion != 1 && c.KVVersion != 2 {
+		return fmt.Errorf("invalid Vault KV version %d, expected 1 or 2", c.KVVersion)
+	}
+	if c.PathPrefix == "" && len(c.AllowedPaths) == 0 {
+		return fmt.Errorf("vault path_prefix or allowed_paths are required")
+	}
+	if c.PathPrefix != "" && !strings.Contains(c.PathPrefix, NamespacePlaceholder) {
+		return fmt.Errorf("vault path_prefix %q must contain the %s placeholder", c.PathPrefix, NamespacePlaceholder)
+	}
+	if c.TLS != nil && (c.TLS.Certificate == "") != (c.TLS.Key == "") {
+		return fmt.Errorf("vault ssl certificate and key must be set together")
+	}
+	return nil
+}
+
+// withDefaults returns the config with the defaults set for the unset fields
+func (c VaultConfig) withDefaults() VaultConfig {
+	var defaults VaultConfig
+	defaults.InitDefaults()
+	if c.AuthPath == "" {
+		c.AuthPath = defaults.AuthPath
+	}
+	if c.TokenPath == "" {
+		c.TokenPath = defaults.TokenPath
+	}
+	if c.KVVersion == 0 {
+		c.KVVersion = defaults.KVVersion
+	}
+	if c.Timeout == 0 {
+		c.Timeout = defaults.Timeout
+	}
+	if c.PathPrefix == "" && len(c.AllowedPaths) == 0 {
+		c.PathPrefix = defaults.PathPrefix
+		if c.KVVersion == 1 {
+			c.PathPrefix = "secret/" + NamespacePlaceholder
+		}
+	}
+	return c
+}
+
+// allowed returns true if the secrets of path can be read for references of namespace
+func (c VaultConfig) allowed(namespace, p string) bool {
+	p = strings.Trim(p, "/")
+	if p == "" || path.Clean(p) != p {
+		// Reject relative segments, they could escape the prefix
+		return false
+	}
+	prefixes := c.AllowedPaths[namespace]
+	if c.PathPrefix != "" && namespace != "" && !strings.ContainsAny(namespace, "/.") {
+		prefixes = append([]string{strings.ReplaceAll(c.PathPrefix, NamespacePlaceholder, namespace)}, prefixes...)
+	}
+	for _, prefix := range prefixes {
+		prefix = strings.Trim(prefix, "/")
+		if prefix != "" && (p == prefix || strings.HasPrefix(p, prefix+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// newHTTPClient returns the HTTP client to connect to Vault with the TLS settings of the config
+func (c VaultConfig) newHTTPClient() (*http.Client, error) {
+	client := &http.Client{Timeout: c.Timeout}
+	if c.TLS == nil {
+		return client, nil
+	}
+	tlsc, err := tlsconfig.Client(tlsconfig.Options{
+		CAFile:             c.TLS.CA,
+		CertFile:           c.TLS.Certificate,
+		KeyFile:            c.TLS.Key,
+		InsecureSkipVerify: c.TLS.InsecureSkipVerify,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid Vault TLS settings: %w", err)
+	}
+	if c.TLS.ServerName != "" {
+		tlsc.ServerName = c.TLS.ServerName
+	}
+	client.Transport = &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsc,
+	}
+	return client, nil
+}
+
+// vaultBackend is an example Backend that reads secrets from the KV secrets engine of HashiCorp
+// Vault, logging in with the Kubernetes auth method and the service account token of the agent.
+type vaultBackend struct {
+	sync.Mutex
+	config VaultConfig
+	client *http.Client
+
+	token       string
+	tokenExpiry time.Time
+}
+
+// NewVaultBackend creates a Backend that resolves "vault.<path>/<key>" references against Vault.
+// With KV version 2, path is the API path of the secret, e.g. "secret/data/myapp/db". Only the
+// paths allowed for the namespace of the reference can be read, see PathPrefix and AllowedPaths.
+func NewVaultBackend(cfg VaultConfig) (Backend, error) {
+	cfg = cfg.withDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	client, err := cfg.newHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	return &vaultBackend{
+		config: cfg,
+		client: client,
+	}, nil
+}
+
+// Name of the backend
+func (v *vaultBackend) Name() string {
+	return "vault"
+}
+
+// Get returns the value of a key of a Vault secret. The token is renewed once if Vault denies the
+// request, in case it was revoked before its expiration.
+func (v *vaultBackend) Get(namespace, path, key string) ([]byte, error) {
+	if !v.config.allowed(namespace, path) {
+		return nil, fmt.Errorf("vault path %q is not allowed for namespace %q: %w", path, namespace, ErrPermissionDenied)
+	}
+
+	data, err := v.read(path, false)
+	if err == ErrPermissionDenied {
+		data, err = v.read(path, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	value, ok := data[key]
+	if !ok {
+		return nil, keystore.ErrKeyDoesntExists
+	}
+	if s, ok := value.(string); ok {
+		return []byte(s), nil
+	}
+	return json.Marshal(value)
+}
+
+func (v *vaultBackend) read(path string, renew bool) (map[string]interface{}, error) {
+	token, err := v.login(renew)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, v.url(path), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := v.do(req, &body); err != nil {
+		return nil, err
+	}
+	if v.config.KVVersion == 1 {
+		return body.Data, nil
+	}
+	data, _ := body.Data["data"].(map[string]interface{})
+	if data == nil {
+		// Deleted or destroyed versions have no data
+		return nil, keystore.ErrKeyDoesntExists
+	}
+	return data, nil
+}
+
+// login returns a Vault token, logging in if there is no valid token or if renew is set
+func (v *vaultBackend) login(renew bool) (string, error) {
+	v.Lock()
+	defer v.Unlock()
+
+	if !renew && v.token != "" && (v.tokenExpiry.IsZero() || time.Now().Before(v.tokenExpiry)) {
+		return v.token, nil
+	}
+
+	jwt, err := os.ReadFile(v.config.TokenPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read service account token: %w", err)
+	}
+	payload, err := json.Marshal(map[string]string{
+		"role": v.config.Role,
+		"jwt":  strings.TrimSpace(string(jwt)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode Vault login request: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, v.url("auth/"+v.config.AuthPath+"/login"), bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("failed to create Vault login request: %w", err)
+	}
+
+	var body struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int    `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	if err := v.do(req, &body); err != nil {
+		return "", fmt.Errorf("failed to log in to Vault with role %v: %w", v.config.Role, err)
+	}
+	if body.Auth.ClientToken == "" {
+		return "", fmt.Errorf("vault login with role %v returned no token", v.config.Role)
+	}
+
+	v.token = body.Auth.ClientToken
+	// A lease duration of 0 means that the token doesn't expire, it is only renewed if Vault
+	// denies a request. Other tokens are renewed a bit before they expire.
+	v.tokenExpiry = time.Time{}
+	if body.Auth.LeaseDuration > 0 {
+		lease := time.Duration(body.Auth.LeaseDuration) * time.Second
+		v.tokenExpiry = time.Now().Add(lease - lease/10)
+	}
+	return v.token, nil
+}
+
+func (v *vaultBackend) do(req *http.Request, out interface{}) error {
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return keystore.ErrKeyDoesntExists
+	case http.StatusForbidden:
+		return ErrPermissionDenied
+	default:
+		return fmt.Errorf("unexpected Vault response status %v", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode Vault response: %w", err)
+	}
+	return nil
+}
+
+func (v *vaultBackend) url(path string) string {
+	return strings.TrimSuffix(v.config.Address, "/") + "/v1/" + strings.TrimPrefix(path, "/")
+}
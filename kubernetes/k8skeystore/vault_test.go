@@ -0,0 +1,220 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package k8skeystore
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/keystore"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// newVaultServer returns a handler of a fake Vault server with secrets in the test namespace,
+// counting the logins and issuing tokens with the given lease duration
+func newVaultServer(t *testing.T, logins *int32, leaseDuration int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/kubernetes/login":
+			var login map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&login))
+			if login["role"] != "agent" || login["jwt"] != "sa-token" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			atomic.AddInt32(logins, 1)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"auth": map[string]interface{}{"client_token": "vault-token", "lease_duration": leaseDuration},
+			})
+		case "/v1/secret/data/" + ns + "/myapp", "/v1/secret/data/shared/myapp", "/v1/secret/data/other_namespace/myapp":
+			if r.Header.Get("X-Vault-Token") != "vault-token" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{
+					"data": map[string]interface{}{"password": pass, "port": 9200},
+				},
+			})
+		case "/v1/secret/data/" + ns + "/restricted":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+func writeVaultToken(t *testing.T) string {
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenPath, []byte("sa-token\n"), 0o600))
+	return tokenPath
+}
+
+func TestVaultBackend(t *testing.T) {
+	var logins int32
+	server := httptest.NewServer(newVaultServer(t, &logins, 3600))
+	defer server.Close()
+
+	backend, err := NewVaultBackend(VaultConfig{Address: server.URL, Role: "agent", TokenPath: writeVaultToken(t)})
+	require.NoError(t, err)
+	k, err := NewBackendKeystore(ns, backend, logp.NewLogger("test_k8s_secrets"), Config{})
+	require.NoError(t, err)
+
+	assertSecret(t, k, "vault.secret/data/"+ns+"/myapp/password", pass)
+	assertSecret(t, k, "vault.secret/data/"+ns+"/myapp/port", "9200")
+	assertSecret(t, k, "vault.secret/data/"+ns+"/other/password|optional", "")
+	_, err = k.Retrieve("vault.secret/data/" + ns + "/myapp/missing")
+	assert.ErrorIs(t, err, keystore.ErrKeyDoesntExists)
+	_, err = k.Retrieve("vault.secret/data/" + ns + "/restricted/password")
+	assert.ErrorIs(t, err, keystore.ErrKeyDoesntExists)
+	assert.Contains(t, err.Error(), "permission denied")
+
+	// The token is reused until it expires, and renewed once when access is denied
+	assert.Equal(t, int32(2), atomic.LoadInt32(&logins))
+}
+
+func TestVaultBackendAllowedPaths(t *testing.T) {
+	var logins int32
+	server := httptest.NewServer(newVaultServer(t, &logins, 3600))
+	defer server.Close()
+
+	backend, err := NewVaultBackend(VaultConfig{
+		Address:      server.URL,
+		Role:         "agent",
+		TokenPath:    writeVaultToken(t),
+		PathPrefix:   "secret/data/" + NamespacePlaceholder,
+		AllowedPaths: map[string][]string{ns: {"secret/data/shared"}},
+	})
+	require.NoError(t, err)
+	k, err := NewBackendKeystore(ns, backend, logp.NewLogger("test_k8s_secrets"), Config{})
+	require.NoError(t, err)
+
+	assertSecret(t, k, "vault.secret/data/"+ns+"/myapp/password", pass)
+	assertSecret(t, k, "vault.secret/data/shared/myapp/password", pass)
+
+	// Paths of other namespaces, or escaping the allowed prefixes, are rejected before reaching Vault
+	for _, key := range []string{
+		"vault.secret/data/other_namespace/myapp/password",
+		"vault.secret/data/" + ns + "/../other_namespace/myapp/password",
+		"vault.secret/data/" + ns + "_suffix/myapp/password",
+		"vault.secret/data/sharedsuffix/myapp/password",
+	} {
+		_, err = k.Retrieve(key)
+		assert.ErrorIs(t, err, keystore.ErrKeyDoesntExists, key)
+		assert.Contains(t, err.Error(), "permission denied", key)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&logins))
+
+	// Other namespaces can only read their own paths
+	other, err := NewBackendKeystore("other_namespace", backend, logp.NewLogger("test_k8s_secrets"), Config{})
+	require.NoError(t, err)
+	assertSecret(t, other, "vault.secret/data/other_namespace/myapp/password", pass)
+	_, err = other.Retrieve("vault.secret/data/shared/myapp/password")
+	assert.Contains(t, err.Error(), "permission denied")
+
+	_, err = backend.Get(ns, "secret/data/other_namespace/myapp", "password")
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	assert.Contains(t, err.Error(), "not allowed for namespace")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&logins))
+}
+
+func TestVaultBackendNonExpiringToken(t *testing.T) {
+	var logins int32
+	server := httptest.NewServer(newVaultServer(t, &logins, 0))
+	defer server.Close()
+
+	backend, err := NewVaultBackend(VaultConfig{Address: server.URL, Role: "agent", TokenPath: writeVaultToken(t)})
+	require.NoError(t, err)
+	k, err := NewBackendKeystore(ns, backend, logp.NewLogger("test_k8s_secrets"), Config{})
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		assertSecret(t, k, "vault.secret/data/"+ns+"/myapp/password", pass)
+	}
+	// Tokens without lease duration are reused
+	assert.Equal(t, int32(1), atomic.LoadInt32(&logins))
+}
+
+func TestVaultBackendTLS(t *testing.T) {
+	var logins int32
+	server := httptest.NewTLSServer(newVaultServer(t, &logins, 3600))
+	defer server.Close()
+
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caPath, ca, 0o600))
+
+	for name, c := range map[string]struct {
+		tls *VaultTLSConfig
+		ok  bool
+	}{
+		"no CA":    {nil, false},
+		"CA":       {&VaultTLSConfig{CA: caPath}, true},
+		"insecure": {&VaultTLSConfig{InsecureSkipVerify: true}, true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			backend, err := NewVaultBackend(VaultConfig{Address: server.URL, Role: "agent", TokenPath: writeVaultToken(t), TLS: c.tls})
+			require.NoError(t, err)
+			_, err = backend.Get(ns, "secret/data/"+ns+"/myapp", "password")
+			if c.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+
+	_, err := NewVaultBackend(VaultConfig{Address: server.URL, Role: "agent", TLS: &VaultTLSConfig{CA: filepath.Join(t.TempDir(), "missing.pem")}})
+	assert.Error(t, err)
+}
+
+func TestVaultConfig(t *testing.T) {
+	cfg, err := config.NewConfigFrom(map[string]interface{}{
+		"address": "https://vault.example.com:8200",
+		"role":    "agent",
+	})
+	require.NoError(t, err)
+	var c VaultConfig
+	require.NoError(t, cfg.Unpack(&c))
+	assert.Equal(t, "kubernetes", c.AuthPath)
+	assert.Equal(t, 2, c.KVVersion)
+	assert.Equal(t, "secret/data/{namespace}", c.PathPrefix)
+
+	for _, raw := range []map[string]interface{}{
+		{"address": "https://vault.example.com:8200"},
+		{"address": "https://vault.example.com:8200", "role": "agent", "kv_version": 3},
+		{"address": "https://vault.example.com:8200", "role": "agent", "path_prefix": "secret/data"},
+		{"address": "https://vault.example.com:8200", "role": "agent", "path_prefix": ""},
+		{"address": "https://vault.example.com:8200", "role": "agent", "ssl.certificate": "cert.pem"},
+	} {
+		cfg, err := config.NewConfigFrom(raw)
+		require.NoError(t, err)
+		var c VaultConfig
+		assert.Error(t, cfg.Unpack(&c))
+	}
+}
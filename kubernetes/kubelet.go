@@ -0,0 +1,322 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	defaultKubeletHost       = "https://localhost:10250"
+	defaultKubeletTokenFile  = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	defaultKubeletSyncPeriod = 10 * time.Second
+
+	kubeletRequestTimeout = 30 * time.Second
+)
+
+// KubeletConfig of the client of the kubelet API, it authenticates with a bearer token, like the
+// one of the service account of the agent, or with a client certificate, like the one of the node
+type KubeletConfig struct {
+	// Host of the kubelet API, https://localhost:10250 by default
+	Host string `config:"host"`
+
+	// TokenFile with the bearer token, the token of the service account of the pod by default if
+	// no client certificate is configured. The file is read again when the token is rotated.
+	TokenFile string `config:"token_file"`
+
+	// CertFile and KeyFile of the client certificate, like the kubelet-client-current.pem of the node
+	CertFile string `config:"ssl.certificate"`
+	KeyFile  string `config:"ssl.key"`
+
+	// CAFile to verify the serving certificate of the kubelet, that is usually self signed
+	CAFile string `config:"ssl.certificate_authority"`
+
+	// InsecureSkipVerify disables the verification of the serving certificate of the kubelet
+	InsecureSkipVerify bool `config:"ssl.insecure_skip_verify"`
+
+	// SyncPeriod is the time waited between listings of the pods
+	SyncPeriod time.Duration `config:"sync_period"`
+}
+
+// Validate the config
+func (c *KubeletConfig) Validate() error {
+	if c.Host != "" {
+		if _, err := url.Parse(c.Host); err != nil {
+			return fmt.Errorf("invalid kubelet host: %w", err)
+		}
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return fmt.Errorf("both kubelet ssl.certificate and ssl.key are required")
+	}
+	if c.SyncPeriod < 0 {
+		return fmt.Errorf("invalid kubelet sync period %v", c.SyncPeriod)
+	}
+	return nil
+}
+
+// KubeletClient lists the pods of the kubelet API
+type KubeletClient interface {
+	// Pods returns the pods running in the node of the kubelet
+	Pods(ctx context.Context) (*PodList, error)
+}
+
+type kubeletClient struct {
+	http *http.Client
+	host string
+}
+
+// NewKubeletClient returns a client of the kubelet API
+func NewKubeletClient(cfg KubeletConfig) (KubeletClient, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	host := cfg.Host
+	if host == "" {
+		host = defaultKubeletHost
+	}
+	tokenFile := cfg.TokenFile
+	if tokenFile == "" && cfg.CertFile == "" {
+		tokenFile = defaultKubeletTokenFile
+	}
+
+	transport, err := restclient.TransportFor(&restclient.Config{
+		BearerTokenFile: tokenFile,
+		TLSClientConfig: restclient.TLSClientConfig{
+			CertFile: cfg.CertFile,
+			KeyFile:  cfg.KeyFile,
+			CAFile:   cfg.CAFile,
+			Insecure: cfg.InsecureSkipVerify,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to build kubelet client: %w", err)
+	}
+	return &kubeletClient{
+		http: &http.Client{Transport: transport, Timeout: kubeletRequestTimeout},
+		host: strings.TrimSuffix(host, "/"),
+	}, nil
+}
+
+// Pods returns the pods running in the node of the kubelet
+func (c *kubeletClient) Pods(ctx context.Context) (*PodList, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.host+"/pods", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list kubelet pods: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("failed to list kubelet pods: unexpected status %s: %s", resp.Status, body)
+	}
+	var pods PodList
+	if err := json.NewDecoder(resp.Body).Decode(&pods); err != nil {
+		return nil, fmt.Errorf("failed to decode kubelet pods: %w", err)
+	}
+	return &pods, nil
+}
+
+// NewKubeletPodInformer creates an informer of the pods listed by the kubelet every period. The
+// kubelet API doesn't support watches, so listings are compared to generate the watch events.
+func NewKubeletPodInformer(kubelet KubeletClient, period time.Duration, opts WatchOptions, indexers cache.Indexers) cache.SharedInformer {
+	if period <= 0 {
+		period = defaultKubeletSyncPeriod
+	}
+	lw := &kubeletListWatch{kubelet: kubelet, period: period, namespace: opts.Namespace}
+
+	if indexers == nil {
+		indexers = cache.Indexers{}
+	}
+	return cache.NewSharedIndexInformer(lw, &Pod{}, opts.SyncTimeout, indexers)
+}
+
+// NewKubeletPodWatcher initializes a watcher of the pods of the local node listed by the kubelet,
+// for agents without permissions to watch the API server. Pods are the same objects returned by
+// the API server, so the pod metadata generators can be used with these watchers. Client returns
+// nil for these watchers.
+//
+// The statuses of the pods of the kubelet can change without a new resource version, pods are
+// considered updated when their resource version or their status change, unless IsUpdated is set.
+func NewKubeletPodWatcher(name string, kubelet KubeletClient, period time.Duration, opts WatchOptions, indexers cache.Indexers) (Watcher, error) {
+	if kubelet == nil {
+		return nil, fmt.Errorf("kubelet client is required")
+	}
+	if opts.IsUpdated == nil {
+		opts.IsUpdated = func(o, n interface{}) bool {
+			old, _ := o.(*Pod)
+			new, _ := n.(*Pod)
+			if old == nil || new == nil {
+				return true
+			}
+			return old.ResourceVersion != new.ResourceVersion || !equality.Semantic.DeepEqual(old.Status, new.Status)
+		}
+	}
+	informer := NewKubeletPodInformer(kubelet, period, opts, indexers)
+	return newInformerWatcher(name, nil, informer, &Pod{}, opts), nil
+}
+
+// kubeletListWatch lists the pods of the kubelet and watches them polling the kubelet
+type kubeletListWatch struct {
+	kubelet   KubeletClient
+	period    time.Duration
+	namespace string
+
+	mutex sync.Mutex
+	known map[string]*Pod
+}
+
+func (lw *kubeletListWatch) pods(ctx context.Context) (map[string]*Pod, *PodList, error) {
+	list, err := lw.kubelet.Pods(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	filtered := &PodList{}
+	pods := make(map[string]*Pod, len(list.Items))
+	for i := range list.Items {
+		pod := &list.Items[i]
+		if lw.namespace != "" && pod.Namespace != lw.namespace {
+			continue
+		}
+		filtered.Items = append(filtered.Items, *pod)
+		pods[pod.Namespace+"/"+pod.Name] = pod
+	}
+	return pods, filtered, nil
+}
+
+// List the pods of the kubelet
+func (lw *kubeletListWatch) List(options metav1.ListOptions) (runtime.Object, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), kubeletRequestTimeout)
+	defer cancel()
+
+	pods, list, err := lw.pods(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lw.mutex.Lock()
+	lw.known = pods
+	lw.mutex.Unlock()
+	return list, nil
+}
+
+// Watch the pods of the kubelet, from the last listing
+func (lw *kubeletListWatch) Watch(options metav1.ListOptions) (watch.Interface, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &kubeletWatch{
+		lw:     lw,
+		ctx:    ctx,
+		cancel: cancel,
+		result: make(chan watch.Event),
+	}
+	go w.run()
+	return w, nil
+}
+
+type kubeletWatch struct {
+	lw     *kubeletListWatch
+	ctx    context.Context
+	cancel context.CancelFunc
+	result chan watch.Event
+}
+
+func (w *kubeletWatch) Stop() {
+	w.cancel()
+}
+
+func (w *kubeletWatch) ResultChan() <-chan watch.Event {
+	return w.result
+}
+
+// run polls the kubelet until stopped, sending the changes since the previous listing. Errors
+// are sent as error events, so the reflector lists the pods again after backing off.
+func (w *kubeletWatch) run() {
+	defer close(w.result)
+
+	ticker := time.NewTicker(w.lw.period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(w.ctx, kubeletRequestTimeout)
+		pods, _, err := w.lw.pods(ctx)
+		cancel()
+		if err != nil {
+			if w.ctx.Err() == nil {
+				status := &metav1.Status{Status: metav1.StatusFailure, Message: err.Error(), Reason: metav1.StatusReasonServiceUnavailable}
+				w.send(watch.Event{Type: watch.Error, Object: status})
+			}
+			return
+		}
+
+		w.lw.mutex.Lock()
+		known := w.lw.known
+		w.lw.known = pods
+		w.lw.mutex.Unlock()
+
+		var events []watch.Event
+		for key, pod := range pods {
+			old, ok := known[key]
+			if !ok {
+				events = append(events, watch.Event{Type: watch.Added, Object: pod})
+			} else if !equality.Semantic.DeepEqual(old, pod) {
+				events = append(events, watch.Event{Type: watch.Modified, Object: pod})
+			}
+		}
+		for key, pod := range known {
+			if _, ok := pods[key]; !ok {
+				events = append(events, watch.Event{Type: watch.Deleted, Object: pod})
+			}
+		}
+		for _, e := range events {
+			if !w.send(e) {
+				return
+			}
+		}
+	}
+}
+
+func (w *kubeletWatch) send(e watch.Event) bool {
+	select {
+	case w.result <- e:
+		return true
+	case <-w.ctx.Done():
+		return false
+	}
+}
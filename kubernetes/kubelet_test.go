@@ -0,0 +1,157 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type mockKubelet struct {
+	sync.Mutex
+	pods []Pod
+	err  error
+}
+
+func (m *mockKubelet) Pods(ctx context.Context) (*PodList, error) {
+	m.Lock()
+	defer m.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &PodList{Items: append([]Pod(nil), m.pods...)}, nil
+}
+
+func (m *mockKubelet) set(pods ...Pod) {
+	m.Lock()
+	defer m.Unlock()
+	m.pods = pods
+}
+
+func kubeletPod(namespace, name string, phase v1.PodPhase) Pod {
+	return Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, UID: types.UID("uid-" + name), ResourceVersion: "1"},
+		Status:     v1.PodStatus{Phase: phase},
+	}
+}
+
+func TestKubeletPodWatcher(t *testing.T) {
+	kubelet := &mockKubelet{}
+	kubelet.set(kubeletPod("default", "web", v1.PodRunning), kubeletPod("kube-system", "proxy", v1.PodRunning))
+
+	watcher, err := NewKubeletPodWatcher("", kubelet, 10*time.Millisecond, WatchOptions{Namespace: "default"}, nil)
+	require.NoError(t, err)
+	assert.Nil(t, watcher.Client())
+
+	added := make(chan *Pod, 2)
+	updated := make(chan *Pod, 2)
+	deleted := make(chan *Pod, 2)
+	watcher.AddEventHandler(ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { added <- obj.(*Pod) },
+		UpdateFunc: func(obj interface{}) { updated <- obj.(*Pod) },
+		DeleteFunc: func(obj interface{}) { deleted <- obj.(*Pod) },
+	})
+	require.NoError(t, watcher.Start())
+	defer watcher.Stop()
+
+	assert.Equal(t, "web", receivePod(t, added).Name)
+	assert.Len(t, watcher.Store().List(), 1)
+
+	// Status changes without a new resource version are updates
+	kubelet.set(kubeletPod("default", "web", v1.PodSucceeded), kubeletPod("default", "db", v1.PodRunning))
+	assert.Equal(t, "db", receivePod(t, added).Name)
+	assert.Equal(t, v1.PodSucceeded, receivePod(t, updated).Status.Phase)
+
+	// Pods are listed again after errors
+	kubelet.Lock()
+	kubelet.err = errors.New("connection refused")
+	kubelet.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	kubelet.Lock()
+	kubelet.err = nil
+	kubelet.Unlock()
+
+	kubelet.set(kubeletPod("default", "db", v1.PodRunning))
+	assert.Equal(t, "web", receivePod(t, deleted).Name)
+	assert.Len(t, watcher.Store().List(), 1)
+
+	_, err = NewKubeletPodWatcher("", nil, time.Second, WatchOptions{}, nil)
+	assert.Error(t, err)
+}
+
+func TestKubeletClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "/pods", r.URL.Path)
+		_ = json.NewEncoder(w).Encode(PodList{Items: []Pod{kubeletPod("default", "web", v1.PodRunning)}})
+	}))
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("secret"), 0600))
+
+	client, err := NewKubeletClient(KubeletConfig{Host: server.URL, TokenFile: tokenFile, InsecureSkipVerify: true})
+	require.NoError(t, err)
+	pods, err := client.Pods(context.Background())
+	require.NoError(t, err)
+	require.Len(t, pods.Items, 1)
+	assert.Equal(t, "web", pods.Items[0].Name)
+
+	// Serving certificate is not trusted
+	client, err = NewKubeletClient(KubeletConfig{Host: server.URL, TokenFile: tokenFile})
+	require.NoError(t, err)
+	_, err = client.Pods(context.Background())
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(tokenFile, []byte("wrong"), 0600))
+	client, err = NewKubeletClient(KubeletConfig{Host: server.URL, TokenFile: tokenFile, InsecureSkipVerify: true})
+	require.NoError(t, err)
+	_, err = client.Pods(context.Background())
+	assert.Error(t, err)
+
+	_, err = NewKubeletClient(KubeletConfig{CertFile: "kubelet-client.pem"})
+	assert.Error(t, err)
+}
+
+func receivePod(t *testing.T, c chan *Pod) *Pod {
+	t.Helper()
+	select {
+	case obj := <-c:
+		return obj
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for pod event")
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package kubernetestest provides fixtures of Kubernetes resources and a fake Watcher delivering
+// scripted events, to unit test the consumers of the kubernetes package without a cluster:
+//
+//	pod := kubernetestest.Pod("default", "web", kubernetestest.WithLabels(map[string]string{"app": "web"}))
+//	watcher := kubernetestest.NewWatcher(nil, kubernetestest.Added(pod))
+//	watcher.AddEventHandler(handler)
+//	watcher.Start() // handler.OnAdd(pod)
+//	watcher.Delete(pod) // handler.OnDelete(pod)
+package kubernetestest
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+)
+
+const (
+	// DefaultNode is the node of the Pod fixtures
+	DefaultNode = "node-1"
+	// DefaultNodeIP is the internal IP of the Node fixtures and the host IP of the Pod fixtures
+	DefaultNodeIP = "192.168.0.10"
+	// DefaultPodIP is the IP of the Pod fixtures
+	DefaultPodIP = "10.0.0.10"
+	// DefaultImage is the image of the container of the Pod fixtures
+	DefaultImage = "docker.io/library/app:1.0"
+)
+
+// Created is the creation timestamp of the fixtures
+var Created = metav1.NewTime(time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+// Option modifies a fixture, the options that don't apply to its kind are ignored
+type Option func(kubernetes.Resource)
+
+// WithLabels adds labels to a fixture
+func WithLabels(labels map[string]string) Option {
+	return func(obj kubernetes.Resource) {
+		accessor, _ := meta.Accessor(obj)
+		accessor.SetLabels(merge(accessor.GetLabels(), labels))
+	}
+}
+
+// WithAnnotations adds annotations to a fixture
+func WithAnnotations(annotations map[string]string) Option {
+	return func(obj kubernetes.Resource) {
+		accessor, _ := meta.Accessor(obj)
+		accessor.SetAnnotations(merge(accessor.GetAnnotations(), annotations))
+	}
+}
+
+// WithOwner adds a controller owner reference to a fixture, e.g. a ReplicaSet of a Pod
+func WithOwner(apiVersion, kind, name string) Option {
+	return func(obj kubernetes.Resource) {
+		accessor, _ := meta.Accessor(obj)
+		controller := true
+		accessor.SetOwnerReferences(append(accessor.GetOwnerReferences(), metav1.OwnerReference{
+			APIVersion: apiVersion,
+			Kind:       kind,
+			Name:       name,
+			UID:        UID(kind, accessor.GetNamespace(), name),
+			Controller: &controller,
+		}))
+	}
+}
+
+// OnNode sets the node of a Pod fixture
+func OnNode(node string) Option {
+	return func(obj kubernetes.Resource) {
+		if pod, ok := obj.(*kubernetes.Pod); ok {
+			pod.Spec.NodeName = node
+		}
+	}
+}
+
+// WithContainers replaces the containers of a Pod fixture with running containers of the default
+// image with the given names
+func WithContainers(names ...string) Option {
+	return func(obj kubernetes.Resource) {
+		if pod, ok := obj.(*kubernetes.Pod); ok {
+			pod.Spec.Containers = nil
+			pod.Status.ContainerStatuses = nil
+			for _, name := range names {
+				addContainer(pod, name)
+			}
+		}
+	}
+}
+
+// UID returns the UID of a fixture, it is derived from its kind, namespace and name so that the
+// same fixture always has the same UID
+func UID(kind, namespace, name string) types.UID {
+	sum := sha256.Sum256([]byte(kind + "/" + namespace + "/" + name))
+	return types.UID(fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16]))
+}
+
+// Pod returns a running Pod with a single running container named "app" on the DefaultNode
+func Pod(namespace, name string, opts ...Option) *kubernetes.Pod {
+	pod := &kubernetes.Pod{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: objectMeta("Pod", namespace, name),
+		Spec:       kubernetes.PodSpec{NodeName: DefaultNode},
+		Status: kubernetes.PodStatus{
+			Phase:     v1.PodRunning,
+			HostIP:    DefaultNodeIP,
+			PodIP:     DefaultPodIP,
+			PodIPs:    []v1.PodIP{{IP: DefaultPodIP}},
+			StartTime: &Created,
+			Conditions: []v1.PodCondition{
+				{Type: v1.PodReady, Status: v1.ConditionTrue, LastTransitionTime: Created},
+			},
+		},
+	}
+	addContainer(pod, "app")
+	return apply(pod, opts).(*kubernetes.Pod)
+}
+
+// Node returns a ready Node with the DefaultNodeIP as internal IP
+func Node(name string, opts ...Option) *kubernetes.Node {
+	node := &kubernetes.Node{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Node"},
+		ObjectMeta: objectMeta("Node", "", name),
+		Status: v1.NodeStatus{
+			Addresses: []v1.NodeAddress{
+				{Type: v1.NodeInternalIP, Address: DefaultNodeIP},
+				{Type: v1.NodeHostName, Address: name},
+			},
+			Conditions: []v1.NodeCondition{
+				{Type: v1.NodeReady, Status: v1.ConditionTrue, LastHeartbeatTime: Created, LastTransitionTime: Created},
+			},
+		},
+	}
+	node.Labels = map[string]string{"kubernetes.io/hostname": name}
+	return apply(node, opts).(*kubernetes.Node)
+}
+
+// Namespace returns an active Namespace
+func Namespace(name string, opts ...Option) *kubernetes.Namespace {
+	namespace := &kubernetes.Namespace{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
+		ObjectMeta: objectMeta("Namespace", "", name),
+		Status:     v1.NamespaceStatus{Phase: v1.NamespaceActive},
+	}
+	namespace.Labels = map[string]string{"kubernetes.io/metadata.name": name}
+	return apply(namespace, opts).(*kubernetes.Namespace)
+}
+
+func objectMeta(kind, namespace, name string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:              name,
+		Namespace:         namespace,
+		UID:               UID(kind, namespace, name),
+		ResourceVersion:   "1",
+		CreationTimestamp: Created,
+	}
+}
+
+func addContainer(pod *kubernetes.Pod, name string) {
+	pod.Spec.Containers = append(pod.Spec.Containers, kubernetes.Container{Name: name, Image: DefaultImage})
+	sum := sha256.Sum256([]byte(string(pod.UID) + "/" + name))
+	pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, kubernetes.PodContainerStatus{
+		Name:        name,
+		Image:       DefaultImage,
+		ImageID:     fmt.Sprintf("%s@sha256:%x", DefaultImage, sha256.Sum256([]byte(DefaultImage))),
+		ContainerID: fmt.Sprintf("containerd://%x", sum),
+		Ready:       true,
+		State:       v1.ContainerState{Running: &v1.ContainerStateRunning{StartedAt: Created}},
+	})
+}
+
+func apply(obj kubernetes.Resource, opts []Option) kubernetes.Resource {
+	for _, opt := range opts {
+		opt(obj)
+	}
+	return obj
+}
+
+func merge(dst, src map[string]string) map[string]string {
+	if dst == nil {
+		dst = make(map[string]string, len(src))
+	}
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
@@ -0,0 +1,72 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetestest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+)
+
+func TestPod(t *testing.T) {
+	pod := Pod("default", "web",
+		WithLabels(map[string]string{"app": "web"}),
+		WithAnnotations(map[string]string{"owner": "team-a"}),
+		WithOwner("apps/v1", "ReplicaSet", "web-7d9f8c6b5"),
+		OnNode("node-2"),
+		WithContainers("app", "sidecar"),
+	)
+
+	assert.Equal(t, "web", pod.Name)
+	assert.Equal(t, "default", pod.Namespace)
+	assert.Equal(t, UID("Pod", "default", "web"), pod.UID)
+	assert.Equal(t, map[string]string{"app": "web"}, pod.Labels)
+	assert.Equal(t, map[string]string{"owner": "team-a"}, pod.Annotations)
+	require.Len(t, pod.OwnerReferences, 1)
+	assert.Equal(t, "ReplicaSet", pod.OwnerReferences[0].Kind)
+	assert.True(t, *pod.OwnerReferences[0].Controller)
+	assert.Equal(t, "node-2", pod.Spec.NodeName)
+	assert.Equal(t, v1.PodRunning, pod.Status.Phase)
+	require.Len(t, pod.Status.ContainerStatuses, 2)
+	for i, name := range []string{"app", "sidecar"} {
+		assert.Equal(t, name, pod.Spec.Containers[i].Name)
+		assert.Equal(t, name, pod.Status.ContainerStatuses[i].Name)
+		assert.NotEmpty(t, kubernetes.ContainerID(pod.Status.ContainerStatuses[i]))
+	}
+
+	// Fixtures are the same every time
+	assert.Equal(t, Pod("default", "web"), Pod("default", "web"))
+	assert.NotEqual(t, Pod("default", "web").UID, Pod("other", "web").UID)
+}
+
+func TestNodeAndNamespace(t *testing.T) {
+	node := Node("node-1", WithLabels(map[string]string{"zone": "a"}))
+	assert.Equal(t, map[string]string{"kubernetes.io/hostname": "node-1", "zone": "a"}, node.Labels)
+	assert.Equal(t, DefaultNodeIP, node.Status.Addresses[0].Address)
+	assert.Empty(t, node.Namespace)
+
+	// Options of pods are ignored
+	namespace := Namespace("default", OnNode("node-2"), WithContainers("app"))
+	assert.Equal(t, "default", namespace.Name)
+	assert.Equal(t, v1.NamespaceActive, namespace.Status.Phase)
+	assert.Equal(t, UID("Namespace", "", "default"), namespace.UID)
+}
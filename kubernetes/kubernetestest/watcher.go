@@ -0,0 +1,223 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetestest
+
+import (
+	"sync"
+
+	k8s "k8s.io/client-go/kubernetes"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+)
+
+// EventType is the type of an event delivered by a Watcher
+type EventType string
+
+// Types of the events delivered by a Watcher
+const (
+	Add    EventType = "add"
+	Update EventType = "update"
+	Delete EventType = "delete"
+)
+
+// Event is an event of a Watcher
+type Event struct {
+	Type EventType
+	Obj  kubernetes.Resource
+}
+
+// Added returns an add event of an object
+func Added(obj kubernetes.Resource) Event {
+	return Event{Type: Add, Obj: obj}
+}
+
+// Updated returns an update event of an object
+func Updated(obj kubernetes.Resource) Event {
+	return Event{Type: Update, Obj: obj}
+}
+
+// Deleted returns a delete event of an object
+func Deleted(obj kubernetes.Resource) Event {
+	return Event{Type: Delete, Obj: obj}
+}
+
+// Watcher is a fake kubernetes.Watcher delivering scripted events. The events are applied to its
+// store and delivered synchronously to its handler, in order. The events played before the
+// watcher is started are delivered when it is started, like the objects listed by the informers
+// of the real watchers.
+type Watcher struct {
+	mu       sync.Mutex
+	client   k8s.Interface
+	store    cache.Store
+	handler  kubernetes.ResourceEventHandler
+	pending  []Event
+	started  bool
+	stopped  bool
+	startErr error
+
+	// delivering serializes the delivery of the events, the handler is called without holding mu
+	// so that it can use the watcher
+	delivering sync.Mutex
+}
+
+// NewWatcher creates a Watcher with the events to deliver when it is started, the client is a
+// fake clientset if nil
+func NewWatcher(client k8s.Interface, script ...Event) *Watcher {
+	if client == nil {
+		client = k8sfake.NewSimpleClientset()
+	}
+	return &Watcher{
+		client:  client,
+		store:   cache.NewStore(cache.MetaNamespaceKeyFunc),
+		pending: script,
+	}
+}
+
+// Start delivers the pending events, or returns the error set with FailStart
+func (w *Watcher) Start() error {
+	w.mu.Lock()
+	if w.startErr != nil {
+		err := w.startErr
+		w.mu.Unlock()
+		return err
+	}
+	w.started = true
+	w.stopped = false
+	w.mu.Unlock()
+	w.deliver()
+	return nil
+}
+
+// Stop stops delivering events, the events played after stopping are pending until the watcher
+// is started again
+func (w *Watcher) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.started = false
+	w.stopped = true
+}
+
+// AddEventHandler sets the handler of the events, replacing the previous one as the real watchers
+// do
+func (w *Watcher) AddEventHandler(h kubernetes.ResourceEventHandler) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.handler = h
+}
+
+// Store returns the store with the objects of the delivered events
+func (w *Watcher) Store() cache.Store {
+	return w.store
+}
+
+// Client returns the client of the watcher
+func (w *Watcher) Client() k8s.Interface {
+	return w.client
+}
+
+// FailStart makes Start return an error, e.g. to test the handling of sync timeouts
+func (w *Watcher) FailStart(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.startErr = err
+}
+
+// Play delivers events, or keeps them pending if the watcher is not started
+func (w *Watcher) Play(events ...Event) {
+	w.mu.Lock()
+	w.pending = append(w.pending, events...)
+	started := w.started
+	w.mu.Unlock()
+	if started {
+		w.deliver()
+	}
+}
+
+// Add plays an add event of an object
+func (w *Watcher) Add(obj kubernetes.Resource) {
+	w.Play(Added(obj))
+}
+
+// Update plays an update event of an object
+func (w *Watcher) Update(obj kubernetes.Resource) {
+	w.Play(Updated(obj))
+}
+
+// Delete plays a delete event of an object
+func (w *Watcher) Delete(obj kubernetes.Resource) {
+	w.Play(Deleted(obj))
+}
+
+// Started returns true if the watcher is started
+func (w *Watcher) Started() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.started
+}
+
+// Stopped returns true if the watcher has been stopped and not started again
+func (w *Watcher) Stopped() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.stopped
+}
+
+// Pending returns the number of events not delivered yet
+func (w *Watcher) Pending() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.pending)
+}
+
+// deliver delivers the pending events while the watcher is started
+func (w *Watcher) deliver() {
+	w.delivering.Lock()
+	defer w.delivering.Unlock()
+
+	for {
+		w.mu.Lock()
+		if !w.started || len(w.pending) == 0 {
+			w.mu.Unlock()
+			return
+		}
+		event := w.pending[0]
+		w.pending = w.pending[1:]
+		handler := w.handler
+		w.mu.Unlock()
+
+		switch event.Type {
+		case Add:
+			_ = w.store.Add(event.Obj)
+			if handler != nil {
+				handler.OnAdd(event.Obj)
+			}
+		case Update:
+			_ = w.store.Update(event.Obj)
+			if handler != nil {
+				handler.OnUpdate(event.Obj)
+			}
+		case Delete:
+			_ = w.store.Delete(event.Obj)
+			if handler != nil {
+				handler.OnDelete(event.Obj)
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetestest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+)
+
+func TestWatcher(t *testing.T) {
+	pod := Pod("default", "web")
+	updated := Pod("default", "web", WithLabels(map[string]string{"app": "web"}))
+	other := Pod("default", "db")
+
+	var w kubernetes.Watcher = NewWatcher(nil, Added(pod), Added(other))
+	watcher := w.(*Watcher)
+
+	var events []Event
+	watcher.AddEventHandler(kubernetes.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			events = append(events, Added(obj.(kubernetes.Resource)))
+			// Handlers can use the watcher
+			assert.NotEmpty(t, watcher.Store().List())
+		},
+		UpdateFunc: func(obj interface{}) { events = append(events, Updated(obj.(kubernetes.Resource))) },
+		DeleteFunc: func(obj interface{}) { events = append(events, Deleted(obj.(kubernetes.Resource))) },
+	})
+	assert.NotNil(t, watcher.Client())
+
+	// Events are pending until the watcher is started
+	watcher.Update(updated)
+	assert.Empty(t, events)
+	assert.Equal(t, 3, watcher.Pending())
+
+	require.NoError(t, watcher.Start())
+	assert.True(t, watcher.Started())
+	assert.Equal(t, []Event{Added(pod), Added(other), Updated(updated)}, events)
+	assert.Equal(t, 0, watcher.Pending())
+
+	obj, found, err := watcher.Store().GetByKey("default/web")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, updated, obj)
+
+	events = nil
+	watcher.Delete(other)
+	assert.Equal(t, []Event{Deleted(other)}, events)
+	assert.Len(t, watcher.Store().List(), 1)
+
+	watcher.Stop()
+	assert.True(t, watcher.Stopped())
+	watcher.Delete(updated)
+	assert.Equal(t, 1, watcher.Pending())
+}
+
+func TestWatcherFailStart(t *testing.T) {
+	watcher := NewWatcher(nil, Added(Pod("default", "web")))
+	watcher.FailStart(errors.New("timeout syncing"))
+
+	assert.Error(t, watcher.Start())
+	assert.False(t, watcher.Started())
+	assert.Empty(t, watcher.Store().List())
+}
@@ -0,0 +1,478 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// LockTypeAuto selects the lock type depending on the availability of the Lease API
+const LockTypeAuto = "auto"
+
+const (
+	defaultLeaseDuration = 15 * time.Second
+	defaultRenewDeadline = 10 * time.Second
+	defaultRetryPeriod   = 2 * time.Second
+)
+
+// LeaderElector participates in a Lease based leader election
+type LeaderElector interface {
+	// Start participating in the election, leadership is contended again every time it is lost
+	Start()
+
+	// Stop participating in the election
+	Stop()
+
+	// IsLeader returns true if this participant is holding the Lease
+	IsLeader() bool
+
+	// GetLeader returns the identity of the last observed leader
+	GetLeader() string
+
+	// Status returns the current state of the participant
+	Status() LeaderStatus
+}
+
+// LeaderStatus describes the state of a leader election participant
+type LeaderStatus struct {
+	// Lock is the namespace/name of the resource used as lock
+	Lock string
+	// Identity of this participant
+	Identity string
+	// Leader is the identity of the last observed leader
+	Leader string
+	// IsLeader is true if this participant holds the lock
+	IsLeader bool
+}
+
+// LeaderElectionConfig configures a Lease based leader election
+type LeaderElectionConfig struct {
+	// LeaseName is the name of the Lease used as lock
+	LeaseName string `config:"leader_lease"`
+	// Namespace of the Lease, defaults to the namespace of the running pod
+	Namespace string `config:"namespace"`
+	// Identity of this participant, if not set it is composed from the pod name and, optionally, UID
+	Identity string `config:"identity"`
+	// IdentityHostname overrides the pod name used to compose the identity, that otherwise is
+	// taken from the POD_NAME environment variable or the hostname
+	IdentityHostname string `config:"leader_identity_hostname"`
+	// IdentityPodUID appends the pod UID to the composed identity, so that a restarted pod with
+	// the same name is distinguishable. It is taken from the POD_UID environment variable or
+	// queried to the API server.
+	IdentityPodUID bool `config:"leader_identity_pod_uid"`
+	// LockType is the kind of resource used as lock, one of leases (default), configmapsleases,
+	// configmaps or auto. The configmapsleases type is meant for migrations from the ConfigMap
+	// lock, auto uses a Lease when the API is available and allowed, and falls back to a
+	// ConfigMap otherwise.
+	LockType string `config:"leader_lock_type"`
+	// ReleaseOnStop releases the Lease when the elector is stopped, so another participant can
+	// acquire it without waiting for it to expire. It is enabled if not set.
+	ReleaseOnStop *bool `config:"leader_release_on_stop"`
+
+	LeaseTimings `config:",inline"`
+}
+
+// InitDefaults initializes the defaults for the config.
+func (c *LeaderElectionConfig) InitDefaults() {
+	c.LockType = resourcelock.LeasesResourceLock
+	c.LeaseTimings.InitDefaults()
+}
+
+// releaseOnStop returns true if the Lease is released when the elector is stopped
+func (c *LeaderElectionConfig) releaseOnStop() bool {
+	return c.ReleaseOnStop == nil || *c.ReleaseOnStop
+}
+
+// Validate checks the lock type and the timings of the config.
+func (c *LeaderElectionConfig) Validate() error {
+	if err := validateLockType(c.LockType); err != nil {
+		return err
+	}
+	return c.LeaseTimings.Validate()
+}
+
+// LeaseTimings controls how often Leases are acquired and renewed. Shorter durations reduce
+// the failover gap when a holder goes away, at the cost of more requests to the API server.
+type LeaseTimings struct {
+	// LeaseDuration is the time non-holders wait before forcing the acquisition of a Lease
+	LeaseDuration time.Duration `config:"leader_leaseduration"`
+	// RenewDeadline is the time the holder retries renewing a Lease before giving it up
+	RenewDeadline time.Duration `config:"leader_renewdeadline"`
+	// RetryPeriod is the time to wait between attempts to acquire or renew a Lease
+	RetryPeriod time.Duration `config:"leader_retryperiod"`
+}
+
+// InitDefaults initializes the defaults for the config.
+func (t *LeaseTimings) InitDefaults() {
+	t.LeaseDuration = defaultLeaseDuration
+	t.RenewDeadline = defaultRenewDeadline
+	t.RetryPeriod = defaultRetryPeriod
+}
+
+// Validate checks that the timings keep the holder able to renew before the Lease expires. Leases
+// store their duration in seconds, so the lease duration must be at least one second.
+func (t *LeaseTimings) Validate() error {
+	if t.LeaseDuration <= 0 || t.RenewDeadline <= 0 || t.RetryPeriod <= 0 {
+		return fmt.Errorf("lease duration (%s), renew deadline (%s) and retry period (%s) must be greater than zero",
+			t.LeaseDuration, t.RenewDeadline, t.RetryPeriod)
+	}
+	if t.LeaseDuration < time.Second {
+		return fmt.Errorf("lease duration (%s) must be at least 1s", t.LeaseDuration)
+	}
+	if t.LeaseDuration <= t.RenewDeadline {
+		return fmt.Errorf("lease duration (%s) must be greater than renew deadline (%s)", t.LeaseDuration, t.RenewDeadline)
+	}
+	if t.RenewDeadline <= time.Duration(leaderelection.JitterFactor*float64(t.RetryPeriod)) {
+		return fmt.Errorf("renew deadline (%s) must be greater than %v times the retry period (%s)",
+			t.RenewDeadline, leaderelection.JitterFactor, t.RetryPeriod)
+	}
+	return nil
+}
+
+// withDefaults returns the timings with the unset values replaced by the defaults
+func (t LeaseTimings) withDefaults() LeaseTimings {
+	if t.LeaseDuration == 0 {
+		t.LeaseDuration = defaultLeaseDuration
+	}
+	if t.RenewDeadline == 0 {
+		t.RenewDeadline = defaultRenewDeadline
+	}
+	if t.RetryPeriod == 0 {
+		t.RetryPeriod = defaultRetryPeriod
+	}
+	return t
+}
+
+// LeaderCallbacks are invoked asynchronously on leadership transitions, all of them are optional
+type LeaderCallbacks struct {
+	// OnStartedLeading is called when leadership is acquired, ctx is cancelled when it is lost
+	OnStartedLeading func(ctx context.Context)
+	// OnStoppedLeading is called when leadership is lost or the elector is stopped
+	OnStoppedLeading func()
+	// OnNewLeader is called when a different leader is observed
+	OnNewLeader func(identity string)
+}
+
+type leaderElector struct {
+	elector       *leaderelection.LeaderElector
+	lock          resourcelock.Interface
+	timings       LeaseTimings
+	releaseOnStop bool
+	ctx           context.Context
+	stop          context.CancelFunc
+	stopped       sync.WaitGroup
+	logger        *logp.Logger
+
+	// leading tracks the running OnStartedLeading callbacks, the Lease is only released once
+	// they are done so that no two participants act as leaders at the same time.
+	leadingMutex sync.Mutex
+	leading      sync.WaitGroup
+	done         bool
+}
+
+// NewLeaderElector creates a LeaderElector contending for the Lease described in the config.
+// Unset timings take the default values.
+func NewLeaderElector(client kubernetes.Interface, cfg LeaderElectionConfig, callbacks LeaderCallbacks) (LeaderElector, error) {
+	timings := cfg.LeaseTimings.withDefaults()
+	if err := timings.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid leader election timings: %w", err)
+	}
+
+	lock, err := newLock(client, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	l := &leaderElector{
+		lock:          lock,
+		timings:       timings,
+		releaseOnStop: cfg.releaseOnStop(),
+		ctx:           ctx,
+		stop:          cancel,
+		logger:        logp.NewLogger("kubernetes.leaderelection"),
+	}
+
+	le, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: timings.LeaseDuration,
+		RenewDeadline: timings.RenewDeadline,
+		RetryPeriod:   timings.RetryPeriod,
+		Name:          cfg.LeaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				if !l.startLeading() {
+					return
+				}
+				defer l.leading.Done()
+
+				l.logger.Debugf("leader lease %s acquired by %s", lock.Describe(), lock.Identity())
+				if callbacks.OnStartedLeading != nil {
+					callbacks.OnStartedLeading(ctx)
+				}
+			},
+			OnStoppedLeading: func() {
+				l.logger.Debugf("leader lease %s not held by %s", lock.Describe(), lock.Identity())
+				if callbacks.OnStoppedLeading != nil {
+					callbacks.OnStoppedLeading()
+				}
+			},
+			OnNewLeader: func(identity string) {
+				if callbacks.OnNewLeader != nil {
+					callbacks.OnNewLeader(identity)
+				}
+			},
+		},
+	})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("unable to create leader elector: %w", err)
+	}
+	l.elector = le
+	l.logger.Infof("Participating in leader election for %s as %s", lock.Describe(), lock.Identity())
+
+	return l, nil
+}
+
+// Start participating in the election
+func (l *leaderElector) Start() {
+	l.stopped.Add(1)
+	go func() {
+		defer l.stopped.Done()
+		// Run returns when leadership is lost, keep contending until stopped.
+		for l.ctx.Err() == nil {
+			l.elector.Run(l.ctx)
+		}
+
+		l.leadingMutex.Lock()
+		l.done = true
+		l.leadingMutex.Unlock()
+		l.leading.Wait()
+
+		if l.releaseOnStop {
+			l.release()
+		}
+	}()
+}
+
+// Stop participating in the election, it waits for the OnStartedLeading callback to return and,
+// if configured to, releases the Lease.
+func (l *leaderElector) Stop() {
+	l.stop()
+	l.stopped.Wait()
+}
+
+// startLeading registers a running OnStartedLeading callback, it returns false if the elector is
+// already stopped and the callback must not run.
+func (l *leaderElector) startLeading() bool {
+	l.leadingMutex.Lock()
+	defer l.leadingMutex.Unlock()
+	if l.done {
+		return false
+	}
+	l.leading.Add(1)
+	return true
+}
+
+// release gives up the Lease if it is still held by this participant
+func (l *leaderElector) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), l.timings.RenewDeadline)
+	defer cancel()
+
+	record, _, err := l.lock.Get(ctx)
+	if err != nil {
+		l.logger.Errorf("unable to get leader lease %s to release it: %v", l.lock.Describe(), err)
+		return
+	}
+	if record.HolderIdentity != l.lock.Identity() {
+		return
+	}
+
+	now := metav1.Now()
+	err = l.lock.Update(ctx, resourcelock.LeaderElectionRecord{
+		LeaderTransitions:    record.LeaderTransitions,
+		LeaseDurationSeconds: 1,
+		RenewTime:            now,
+		AcquireTime:          now,
+	})
+	if err != nil {
+		l.logger.Errorf("unable to release leader lease %s: %v", l.lock.Describe(), err)
+		return
+	}
+	l.logger.Debugf("leader lease %s released by %s", l.lock.Describe(), l.lock.Identity())
+}
+
+// IsLeader returns true if this participant is holding the Lease
+func (l *leaderElector) IsLeader() bool {
+	return l.elector.IsLeader()
+}
+
+// GetLeader returns the identity of the last observed leader
+func (l *leaderElector) GetLeader() string {
+	return l.elector.GetLeader()
+}
+
+// Status returns the current state of the participant
+func (l *leaderElector) Status() LeaderStatus {
+	return LeaderStatus{
+		Lock:     l.lock.Describe(),
+		Identity: l.lock.Identity(),
+		Leader:   l.elector.GetLeader(),
+		IsLeader: l.elector.IsLeader(),
+	}
+}
+
+// newLock creates the resource lock for the config, filling the namespace, identity and lock type defaults
+func newLock(client kubernetes.Interface, cfg LeaderElectionConfig) (resourcelock.Interface, error) {
+	if cfg.LeaseName == "" {
+		return nil, fmt.Errorf("leader election lease name is required")
+	}
+
+	namespace, err := leaseNamespace(cfg.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := leaseIdentity(client, namespace, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	lockType := cfg.LockType
+	switch lockType {
+	case "":
+		lockType = resourcelock.LeasesResourceLock
+	case LockTypeAuto:
+		lockType = detectLockType(client, namespace, cfg.LeaseName)
+	}
+	if err := validateLockType(lockType); err != nil {
+		return nil, err
+	}
+
+	return newResourceLock(lockType, namespace, cfg.LeaseName, client,
+		resourcelock.ResourceLockConfig{
+			Identity: identity,
+		})
+}
+
+func validateLockType(lockType string) error {
+	switch lockType {
+	case "", LockTypeAuto,
+		resourcelock.LeasesResourceLock,
+		lockTypeConfigMapsLeases,
+		lockTypeConfigMaps:
+		return nil
+	}
+	return fmt.Errorf("unsupported leader election lock type %q", lockType)
+}
+
+// detectLockType returns the Lease lock if the coordination.k8s.io Lease API is served and
+// this client is allowed to use it. Otherwise it falls back to a ConfigMap based lock, the
+// *leases lock types can't be used as fallback because they also need the Lease API.
+func detectLockType(client kubernetes.Interface, namespace, name string) string {
+	logger := logp.NewLogger("kubernetes.leaderelection")
+
+	resources, err := client.Discovery().ServerResourcesForGroupVersion(coordinationv1.SchemeGroupVersion.String())
+	if err != nil {
+		logger.Infof("Lease API not available (%v), using %s lock for %s/%s", err, lockTypeConfigMaps, namespace, name)
+		return lockTypeConfigMaps
+	}
+
+	served := false
+	for _, r := range resources.APIResources {
+		if r.Name == "leases" {
+			served = true
+			break
+		}
+	}
+	if !served {
+		logger.Infof("Lease API not served, using %s lock for %s/%s", lockTypeConfigMaps, namespace, name)
+		return lockTypeConfigMaps
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), defaultRenewDeadline)
+	defer cancel()
+	_, err = client.CoordinationV1().Leases(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsForbidden(err) {
+		logger.Infof("Access to Leases is forbidden (%v), using %s lock for %s/%s", err, lockTypeConfigMaps, namespace, name)
+		return lockTypeConfigMaps
+	}
+	return resourcelock.LeasesResourceLock
+}
+
+func leaseNamespace(namespace string) (string, error) {
+	if namespace != "" {
+		return namespace, nil
+	}
+	namespace, err := InClusterNamespace()
+	if err != nil {
+		return "", fmt.Errorf("leader election namespace not set and it could not be discovered: %w", err)
+	}
+	return namespace, nil
+}
+
+// leaseIdentity returns the configured identity or composes it from the pod name and UID
+func leaseIdentity(client kubernetes.Interface, namespace string, cfg LeaderElectionConfig) (string, error) {
+	if cfg.Identity != "" {
+		return cfg.Identity, nil
+	}
+
+	name := cfg.IdentityHostname
+	if name == "" {
+		name = os.Getenv("POD_NAME")
+	}
+	if name == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return "", fmt.Errorf("leader election identity not set and hostname could not be retrieved: %w", err)
+		}
+		name = hostname
+	}
+	if !cfg.IdentityPodUID {
+		return name, nil
+	}
+
+	uid := os.Getenv("POD_UID")
+	if uid == "" {
+		podNamespace, err := InClusterNamespace()
+		if err != nil {
+			podNamespace = namespace
+		}
+		ctx, cancel := context.WithTimeout(context.TODO(), defaultRenewDeadline)
+		defer cancel()
+		pod, err := client.CoreV1().Pods(podNamespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", fmt.Errorf("unable to get the UID of pod %s/%s for the leader election identity: %w", podNamespace, name, err)
+		}
+		uid = string(pod.UID)
+	}
+	return name + "_" + uid, nil
+}
@@ -0,0 +1,379 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+func TestLeaderElector(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+
+	started := make(chan struct{})
+	stopped := make(chan struct{})
+	elector, err := NewLeaderElector(client, LeaderElectionConfig{
+		LeaseName: "autodiscover-leader",
+		Namespace: "kube-system",
+		Identity:  "agent-a",
+	}, LeaderCallbacks{
+		OnStartedLeading: func(context.Context) { close(started) },
+		OnStoppedLeading: func() { close(stopped) },
+	})
+	require.NoError(t, err)
+
+	elector.Start()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("leadership was not acquired")
+	}
+	assert.True(t, elector.IsLeader())
+	assert.Equal(t, "agent-a", elector.GetLeader())
+	assert.Equal(t, LeaderStatus{
+		Lock:     "kube-system/autodiscover-leader",
+		Identity: "agent-a",
+		Leader:   "agent-a",
+		IsLeader: true,
+	}, elector.Status())
+
+	elector.Stop()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stopped leading callback was not called")
+	}
+}
+
+func TestLeaderElectorRequiresLeaseName(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	_, err := NewLeaderElector(client, LeaderElectionConfig{Namespace: "kube-system", Identity: "agent-a"}, LeaderCallbacks{})
+	assert.Error(t, err)
+}
+
+func TestLeaseTimingsConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      map[string]interface{}
+		expected LeaseTimings
+		err      bool
+	}{
+		{
+			name:     "defaults",
+			raw:      map[string]interface{}{"leader_lease": "autodiscover"},
+			expected: LeaseTimings{LeaseDuration: 15 * time.Second, RenewDeadline: 10 * time.Second, RetryPeriod: 2 * time.Second},
+		},
+		{
+			name: "custom timings",
+			raw: map[string]interface{}{
+				"leader_lease":         "autodiscover",
+				"leader_leaseduration": "6s",
+				"leader_renewdeadline": "4s",
+				"leader_retryperiod":   "1s",
+			},
+			expected: LeaseTimings{LeaseDuration: 6 * time.Second, RenewDeadline: 4 * time.Second, RetryPeriod: time.Second},
+		},
+		{
+			name: "renew deadline longer than lease duration",
+			raw: map[string]interface{}{
+				"leader_leaseduration": "5s",
+				"leader_renewdeadline": "10s",
+			},
+			err: true,
+		},
+		{
+			name: "retry period too close to renew deadline",
+			raw: map[string]interface{}{
+				"leader_renewdeadline": "2s",
+				"leader_retryperiod":   "2s",
+			},
+			err: true,
+		},
+		{
+			name: "sub-second lease duration",
+			raw: map[string]interface{}{
+				"leader_leaseduration": "800ms",
+				"leader_renewdeadline": "500ms",
+				"leader_retryperiod":   "100ms",
+			},
+			err: true,
+		},
+		{
+			name: "negative retry period",
+			raw:  map[string]interface{}{"leader_retryperiod": "-1s"},
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := config.NewConfigFrom(test.raw)
+			require.NoError(t, err)
+
+			var c LeaderElectionConfig
+			err = cfg.Unpack(&c)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, c.LeaseTimings)
+			assert.Nil(t, c.ReleaseOnStop)
+			assert.True(t, c.releaseOnStop())
+		})
+	}
+}
+
+func TestLeaderElectorInvalidTimings(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	_, err := NewLeaderElector(client, LeaderElectionConfig{
+		LeaseName:    "autodiscover-leader",
+		Namespace:    "kube-system",
+		Identity:     "agent-a",
+		LeaseTimings: LeaseTimings{LeaseDuration: time.Second, RenewDeadline: 2 * time.Second},
+	}, LeaderCallbacks{})
+	assert.Error(t, err)
+}
+
+func TestLeaderElectorReleaseOnStop(t *testing.T) {
+	keep := false
+	// The Lease is released if not configured
+	for _, releaseOnStop := range []*bool{nil, &keep} {
+		release := releaseOnStop == nil
+		client := k8sfake.NewSimpleClientset()
+		timings := LeaseTimings{LeaseDuration: 30 * time.Second, RenewDeadline: 10 * time.Second, RetryPeriod: 50 * time.Millisecond}
+
+		callbackDone := false
+		a, err := NewLeaderElector(client, LeaderElectionConfig{
+			LeaseName:     "autodiscover-leader",
+			Namespace:     "kube-system",
+			Identity:      "agent-a",
+			ReleaseOnStop: releaseOnStop,
+			LeaseTimings:  timings,
+		}, LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				<-ctx.Done()
+				time.Sleep(50 * time.Millisecond)
+				callbackDone = true
+			},
+		})
+		require.NoError(t, err)
+		b, err := NewLeaderElector(client, LeaderElectionConfig{
+			LeaseName:     "autodiscover-leader",
+			Namespace:     "kube-system",
+			Identity:      "agent-b",
+			ReleaseOnStop: releaseOnStop,
+			LeaseTimings:  timings,
+		}, LeaderCallbacks{})
+		require.NoError(t, err)
+
+		a.Start()
+		require.Eventually(t, a.IsLeader, 5*time.Second, 10*time.Millisecond)
+		b.Start()
+
+		a.Stop()
+		// Leading callback has finished before releasing
+		assert.True(t, callbackDone)
+
+		if release {
+			assert.Eventually(t, b.IsLeader, 5*time.Second, 10*time.Millisecond)
+		} else {
+			time.Sleep(500 * time.Millisecond)
+			assert.False(t, b.IsLeader())
+			assert.Equal(t, "agent-a", b.GetLeader())
+		}
+		b.Stop()
+	}
+}
+
+func TestDetectLockType(t *testing.T) {
+	leasesResources := []*metav1.APIResourceList{
+		{
+			GroupVersion: "coordination.k8s.io/v1",
+			APIResources: []metav1.APIResource{{Name: "leases", Namespaced: true, Kind: "Lease"}},
+		},
+	}
+
+	// Lease API not served
+	client := k8sfake.NewSimpleClientset()
+	assert.Equal(t, lockTypeConfigMaps, detectLockType(client, "kube-system", "autodiscover"))
+
+	// Lease API served and allowed
+	client = k8sfake.NewSimpleClientset()
+	client.Resources = leasesResources
+	assert.Equal(t, resourcelock.LeasesResourceLock, detectLockType(client, "kube-system", "autodiscover"))
+
+	// Lease API served but forbidden
+	client = k8sfake.NewSimpleClientset()
+	client.Resources = leasesResources
+	client.PrependReactor("get", "leases", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(coordinationv1.Resource("leases"), "autodiscover", errors.New("rbac"))
+	})
+	assert.Equal(t, lockTypeConfigMaps, detectLockType(client, "kube-system", "autodiscover"))
+}
+
+func TestLeaderElectorFallbackLock(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	elector, err := NewLeaderElector(client, LeaderElectionConfig{
+		LeaseName: "autodiscover-leader",
+		Namespace: "kube-system",
+		Identity:  "agent-a",
+		LockType:  LockTypeAuto,
+	}, LeaderCallbacks{})
+	require.NoError(t, err)
+
+	elector.Start()
+	defer elector.Stop()
+	require.Eventually(t, elector.IsLeader, 5*time.Second, 10*time.Millisecond)
+
+	cm, err := client.CoreV1().ConfigMaps("kube-system").Get(context.Background(), "autodiscover-leader", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, cm.Annotations[resourcelock.LeaderElectionRecordAnnotationKey], "agent-a")
+}
+
+func TestLeaderElectorMigrationLock(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	elector, err := NewLeaderElector(client, LeaderElectionConfig{
+		LeaseName: "autodiscover-leader",
+		Namespace: "kube-system",
+		Identity:  "agent-a",
+		LockType:  lockTypeConfigMapsLeases,
+	}, LeaderCallbacks{})
+	require.NoError(t, err)
+
+	elector.Start()
+	defer elector.Stop()
+	require.Eventually(t, elector.IsLeader, 5*time.Second, 10*time.Millisecond)
+
+	// Both locks are held during the migration
+	cm, err := client.CoreV1().ConfigMaps("kube-system").Get(context.Background(), "autodiscover-leader", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, cm.Annotations[resourcelock.LeaderElectionRecordAnnotationKey], "agent-a")
+	lease, err := client.CoordinationV1().Leases("kube-system").Get(context.Background(), "autodiscover-leader", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "agent-a", *lease.Spec.HolderIdentity)
+}
+
+func TestLockTypeConfig(t *testing.T) {
+	for lockType, valid := range map[string]bool{
+		"leases":           true,
+		"configmapsleases": true,
+		"endpointsleases":  false,
+		"configmaps":       true,
+		"endpoints":        false,
+		"auto":             true,
+		"secrets":          false,
+	} {
+		cfg, err := config.NewConfigFrom(map[string]interface{}{"leader_lock_type": lockType})
+		require.NoError(t, err)
+
+		var c LeaderElectionConfig
+		err = cfg.Unpack(&c)
+		if valid {
+			assert.NoError(t, err, lockType)
+		} else {
+			assert.Error(t, err, lockType)
+		}
+	}
+}
+
+func TestLeaseIdentity(t *testing.T) {
+	client := k8sfake.NewSimpleClientset(&Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "agent-pod", Namespace: "kube-system", UID: "4b3e5a7c"},
+	})
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		cfg      LeaderElectionConfig
+		env      map[string]string
+		expected string
+		err      bool
+	}{
+		{
+			name:     "explicit identity",
+			cfg:      LeaderElectionConfig{Identity: "agent-a", IdentityHostname: "ignored", IdentityPodUID: true},
+			expected: "agent-a",
+		},
+		{
+			name:     "hostname",
+			expected: hostname,
+		},
+		{
+			name:     "pod name from environment",
+			env:      map[string]string{"POD_NAME": "agent-pod"},
+			expected: "agent-pod",
+		},
+		{
+			name:     "hostname override",
+			cfg:      LeaderElectionConfig{IdentityHostname: "agent-host"},
+			env:      map[string]string{"POD_NAME": "agent-pod"},
+			expected: "agent-host",
+		},
+		{
+			name:     "pod UID from environment",
+			cfg:      LeaderElectionConfig{IdentityPodUID: true},
+			env:      map[string]string{"POD_NAME": "agent-pod", "POD_UID": "9f2c"},
+			expected: "agent-pod_9f2c",
+		},
+		{
+			name:     "pod UID from API",
+			cfg:      LeaderElectionConfig{IdentityHostname: "agent-pod", IdentityPodUID: true},
+			expected: "agent-pod_4b3e5a7c",
+		},
+		{
+			name: "pod UID of unknown pod",
+			cfg:  LeaderElectionConfig{IdentityHostname: "unknown", IdentityPodUID: true},
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("POD_NAME", "")
+			t.Setenv("POD_UID", "")
+			for k, v := range test.env {
+				t.Setenv(k, v)
+			}
+
+			identity, err := leaseIdentity(client, "kube-system", test.cfg)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, identity)
+		})
+	}
+}
@@ -0,0 +1,257 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+	"github.com/elastic/elastic-agent-autodiscover/utils"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// cacheShards is the number of shards of the cached metadata, every one with its own lock so
+// generations of different resources don't contend
+const cacheShards = 32
+
+// CachedMetaGen is a MetaGen caching the metadata generated for every version of the resources.
+// Callers receive copies of the cached metadata, they can modify them and release them with
+// Release.
+type CachedMetaGen interface {
+	MetaGen
+
+	// Invalidate removes the cached metadata of a resource
+	Invalidate(obj kubernetes.Resource)
+
+	// Purge removes the cached metadata of all the resources, e.g. when the metadata of their
+	// namespaces or nodes changes
+	Purge()
+
+	// InvalidationHandler wraps the handler of the watcher of the resources to invalidate their
+	// metadata when they are updated or deleted
+	InvalidationHandler(next kubernetes.ResourceEventHandler) kubernetes.ResourceEventHandler
+
+	// PurgeHandler wraps the handler of the watcher of resources whose metadata is included in
+	// the metadata of the cached resources, like namespaces or nodes, to purge the cache when
+	// they are updated or deleted
+	PurgeHandler(next kubernetes.ResourceEventHandler) kubernetes.ResourceEventHandler
+
+	// Usage returns the approximate memory usage of the cached metadata
+	Usage() CacheUsage
+}
+
+type cacheEntry struct {
+	version string
+	expires time.Time
+	k8s     mapstr.M
+	full    mapstr.M
+}
+
+type cacheShard struct {
+	sync.RWMutex
+	entries   map[string]*cacheEntry // UID -> entry
+	lastSweep time.Time
+}
+
+type cachedMetaGen struct {
+	MetaGen
+	ttl time.Duration
+	now func() time.Time
+
+	shards [cacheShards]cacheShard
+}
+
+// NewCachedMetadataGenerator wraps a MetaGen to cache the metadata of resources by their UID and
+// resource version for a ttl. Calls with FieldOptions are not cached, as they can add any field.
+func NewCachedMetadataGenerator(gen MetaGen, ttl time.Duration) (CachedMetaGen, error) {
+	if gen == nil {
+		return nil, fmt.Errorf("metadata generator is required")
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("invalid metadata cache ttl %v", ttl)
+	}
+	c := &cachedMetaGen{
+		MetaGen: gen,
+		ttl:     ttl,
+		now:     time.Now,
+	}
+	for i := range c.shards {
+		c.shards[i].entries = make(map[string]*cacheEntry)
+	}
+	return c, nil
+}
+
+// shard returns the shard of the cached metadata of a UID
+func (c *cachedMetaGen) shard(uid string) *cacheShard {
+	return &c.shards[utils.StringHash(uid)%cacheShards]
+}
+
+// Generate returns the cached metadata of the resource, generating it if needed
+func (c *cachedMetaGen) Generate(obj kubernetes.Resource, opts ...FieldOptions) mapstr.M {
+	if len(opts) > 0 {
+		return c.MetaGen.Generate(obj, opts...)
+	}
+	return c.get(obj, false, func() mapstr.M { return c.MetaGen.Generate(obj) })
+}
+
+// GenerateK8s returns the cached kubernetes metadata of the resource, generating it if needed
+func (c *cachedMetaGen) GenerateK8s(obj kubernetes.Resource, opts ...FieldOptions) mapstr.M {
+	if len(opts) > 0 {
+		return c.MetaGen.GenerateK8s(obj, opts...)
+	}
+	return c.get(obj, true, func() mapstr.M { return c.MetaGen.GenerateK8s(obj) })
+}
+
+// get returns a copy of the cached metadata of a resource if it was generated for the same
+// version and it has not expired, or of the generated one otherwise
+func (c *cachedMetaGen) get(obj kubernetes.Resource, k8s bool, generate func() mapstr.M) mapstr.M {
+	accessor, err := meta.Accessor(obj)
+	if err != nil || accessor.GetUID() == "" {
+		return generate()
+	}
+	uid, version := string(accessor.GetUID()), accessor.GetResourceVersion()
+	now := c.now()
+	shard := c.shard(uid)
+
+	shard.RLock()
+	entry, ok := shard.entries[uid]
+	if ok && (entry.version != version || now.After(entry.expires)) {
+		ok = false
+	}
+	if ok {
+		cached := entry.full
+		if k8s {
+			cached = entry.k8s
+		}
+		if cached != nil {
+			shard.RUnlock()
+			return cloneMap(cached)
+		}
+	}
+	shard.RUnlock()
+
+	// Metadata is generated without holding the lock, it can query other generators
+	generated := generate()
+	if generated == nil {
+		return nil
+	}
+
+	shard.Lock()
+	defer shard.Unlock()
+	entry, ok = shard.entries[uid]
+	if !ok || entry.version != version || now.After(entry.expires) {
+		entry = &cacheEntry{version: version, expires: now.Add(c.ttl)}
+		shard.entries[uid] = entry
+	}
+	if k8s {
+		entry.k8s = generated
+	} else {
+		entry.full = generated
+	}
+	shard.sweep(now, c.ttl)
+	return cloneMap(generated)
+}
+
+// sweep removes the expired entries of the shard, at most once per ttl. It must be called
+// holding the lock of the shard.
+func (s *cacheShard) sweep(now time.Time, ttl time.Duration) {
+	if now.Sub(s.lastSweep) < ttl {
+		return
+	}
+	s.lastSweep = now
+	for uid, entry := range s.entries {
+		if now.After(entry.expires) {
+			delete(s.entries, uid)
+		}
+	}
+}
+
+// Invalidate removes the cached metadata of a resource
+func (c *cachedMetaGen) Invalidate(obj kubernetes.Resource) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return
+	}
+	uid := string(accessor.GetUID())
+	shard := c.shard(uid)
+	shard.Lock()
+	delete(shard.entries, uid)
+	shard.Unlock()
+}
+
+// Purge removes the cached metadata of all the resources
+func (c *cachedMetaGen) Purge() {
+	for i := range c.shards {
+		shard := &c.shards[i]
+		shard.Lock()
+		shard.entries = make(map[string]*cacheEntry)
+		shard.Unlock()
+	}
+}
+
+// InvalidationHandler wraps a handler to invalidate the metadata of updated or deleted resources
+func (c *cachedMetaGen) InvalidationHandler(next kubernetes.ResourceEventHandler) kubernetes.ResourceEventHandler {
+	return c.handler(next, func(obj interface{}) {
+		if r, ok := resourceOf(obj); ok {
+			c.Invalidate(r)
+		}
+	})
+}
+
+// PurgeHandler wraps a handler to purge the cache when other resources are updated or deleted
+func (c *cachedMetaGen) PurgeHandler(next kubernetes.ResourceEventHandler) kubernetes.ResourceEventHandler {
+	return c.handler(next, func(interface{}) {
+		c.Purge()
+	})
+}
+
+// handler calls a func before the update, endpoint change and delete handlers of next
+func (c *cachedMetaGen) handler(next kubernetes.ResourceEventHandler, f func(obj interface{})) kubernetes.ResourceEventHandler {
+	if next == nil {
+		next = kubernetes.NoOpEventHandlerFuncs{}
+	}
+	return kubernetes.ResourceEventHandlerFuncs{
+		AddFunc: next.OnAdd,
+		UpdateFunc: func(obj interface{}) {
+			f(obj)
+			next.OnUpdate(obj)
+		},
+		EndpointChangeFunc: func(obj interface{}) {
+			f(obj)
+			kubernetes.HandleEndpointChange(next, obj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			f(obj)
+			next.OnDelete(obj)
+		},
+	}
+}
+
+// resourceOf returns the resource of a watcher event, also of deleted objects in unknown state
+func resourceOf(obj interface{}) (kubernetes.Resource, bool) {
+	if deleted, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = deleted.Obj
+	}
+	r, ok := obj.(kubernetes.Resource)
+	return r, ok
+}
@@ -0,0 +1,261 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// countingMetaGen counts the generations of the wrapped MetaGen
+type countingMetaGen struct {
+	MetaGen
+	generations int
+}
+
+func (c *countingMetaGen) Generate(obj kubernetes.Resource, opts ...FieldOptions) mapstr.M {
+	c.generations++
+	return c.MetaGen.Generate(obj, opts...)
+}
+
+func (c *countingMetaGen) GenerateK8s(obj kubernetes.Resource, opts ...FieldOptions) mapstr.M {
+	c.generations++
+	return c.MetaGen.GenerateK8s(obj, opts...)
+}
+
+func TestCachedMetadataGenerator(t *testing.T) {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "web",
+			Namespace:       "default",
+			UID:             types.UID(uid),
+			ResourceVersion: "1",
+			Labels:          map[string]string{"app": "web"},
+		},
+	}
+	gen := &countingMetaGen{MetaGen: NewPodMetadataGenerator(config.NewConfig(), nil, k8sfake.NewSimpleClientset(), nil, nil, nil, nil, &AddResourceMetadataConfig{})}
+	c, err := NewCachedMetadataGenerator(gen, time.Minute)
+	require.NoError(t, err)
+	now := time.Now()
+	c.(*cachedMetaGen).now = func() time.Time { return now }
+
+	expected := gen.MetaGen.GenerateK8s(pod)
+	assert.Equal(t, expected, c.GenerateK8s(pod))
+	assert.Equal(t, expected, c.GenerateK8s(pod))
+	assert.Equal(t, gen.MetaGen.Generate(pod), c.Generate(pod))
+	c.Generate(pod)
+	assert.Equal(t, 2, gen.generations)
+
+	// Calls with options are not cached
+	c.GenerateK8s(pod, WithFields("foo", "bar"))
+	assert.Equal(t, 3, gen.generations)
+
+	// New versions
+	updated := pod.DeepCopy()
+	updated.ResourceVersion = "2"
+	updated.Labels["app"] = "api"
+	labels, err := c.GenerateK8s(updated).GetValue("labels.app")
+	require.NoError(t, err)
+	assert.Equal(t, "api", labels)
+	assert.Equal(t, 4, gen.generations)
+
+	// Expiration
+	now = now.Add(2 * time.Minute)
+	c.GenerateK8s(updated)
+	assert.Equal(t, 5, gen.generations)
+
+	// Invalidation and purge
+	c.Invalidate(updated)
+	c.GenerateK8s(updated)
+	assert.Equal(t, 6, gen.generations)
+	c.Purge()
+	c.GenerateK8s(updated)
+	assert.Equal(t, 7, gen.generations)
+
+	_, err = NewCachedMetadataGenerator(gen, 0)
+	assert.Error(t, err)
+}
+
+func TestCachedMetadataGeneratorCopies(t *testing.T) {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "web",
+			Namespace:       "default",
+			UID:             types.UID(uid),
+			ResourceVersion: "1",
+			Labels:          map[string]string{"app": "web"},
+		},
+	}
+	gen := &countingMetaGen{MetaGen: NewPodMetadataGenerator(config.NewConfig(), nil, k8sfake.NewSimpleClientset(), nil, nil, nil, nil, &AddResourceMetadataConfig{})}
+	c, err := NewCachedMetadataGenerator(gen, time.Minute)
+	require.NoError(t, err)
+	expected := gen.MetaGen.GenerateK8s(pod)
+
+	// Both the generated and the cached metadata are copies owned by the caller
+	for i := 0; i < 2; i++ {
+		meta := c.GenerateK8s(pod)
+		meta["pod"] = "modified"
+		_, err = meta.Put("labels.app", "modified")
+		require.NoError(t, err)
+		Release(meta)
+	}
+	assert.Equal(t, expected, c.GenerateK8s(pod))
+	assert.Equal(t, 1, gen.generations)
+}
+
+func TestCachedMetadataGeneratorHandlers(t *testing.T) {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", UID: types.UID(uid), ResourceVersion: "1"},
+	}
+	gen := &countingMetaGen{MetaGen: NewPodMetadataGenerator(config.NewConfig(), nil, k8sfake.NewSimpleClientset(), nil, nil, nil, nil, &AddResourceMetadataConfig{})}
+	c, err := NewCachedMetadataGenerator(gen, time.Minute)
+	require.NoError(t, err)
+
+	var updated, deleted int
+	next := kubernetes.ResourceEventHandlerFuncs{
+		UpdateFunc: func(interface{}) { updated++ },
+		DeleteFunc: func(interface{}) { deleted++ },
+	}
+
+	c.GenerateK8s(pod)
+	handler := c.InvalidationHandler(next)
+	handler.OnAdd(pod)
+	c.GenerateK8s(pod)
+	assert.Equal(t, 1, gen.generations)
+
+	handler.OnUpdate(pod)
+	c.GenerateK8s(pod)
+	assert.Equal(t, 2, gen.generations)
+
+	handler.OnDelete(cache.DeletedFinalStateUnknown{Key: "default/web", Obj: pod})
+	c.GenerateK8s(pod)
+	assert.Equal(t, 3, gen.generations)
+
+	c.PurgeHandler(nil).OnUpdate(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}})
+	c.GenerateK8s(pod)
+	assert.Equal(t, 4, gen.generations)
+	assert.Equal(t, 1, updated)
+	assert.Equal(t, 1, deleted)
+}
+
+// BenchmarkCachedMetadataGeneratorParallel measures concurrent generations of the metadata of
+// many pods while their watcher invalidates it
+func BenchmarkCachedMetadataGeneratorParallel(b *testing.B) {
+	pods := make([]*v1.Pod, 1024)
+	for i := range pods {
+		pods[i] = &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            fmt.Sprintf("web-%d", i),
+				Namespace:       "default",
+				UID:             types.UID(fmt.Sprintf("uid-%d", i)),
+				ResourceVersion: "1",
+				Labels:          map[string]string{"app": "web"},
+			},
+		}
+	}
+	gen := NewPodMetadataGenerator(config.NewConfig(), nil, k8sfake.NewSimpleClientset(), nil, nil, nil, nil, &AddResourceMetadataConfig{})
+	c, err := NewCachedMetadataGenerator(gen, time.Minute)
+	require.NoError(b, err)
+	handler := c.InvalidationHandler(nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := rand.Intn(len(pods))
+		for pb.Next() {
+			pod := pods[i%len(pods)]
+			if i%16 == 0 {
+				handler.OnUpdate(pod)
+			}
+			c.GenerateK8s(pod)
+			i++
+		}
+	})
+}
+
+// keptMetaGen returns the same metadata for every name, keeping references to it as caching
+// generators do
+type keptMetaGen struct {
+	MetaGen
+	meta mapstr.M
+}
+
+func (k *keptMetaGen) GenerateFromName(string, ...FieldOptions) mapstr.M {
+	return k.meta
+}
+
+func TestReleaseWithCachedGenerators(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	cfg := config.NewConfig()
+	namespaces := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	require.NoError(t, namespaces.Add(&v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: defaultNs, UID: types.UID(uid), Labels: map[string]string{"team": "web"}},
+	}))
+	nodes := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	require.NoError(t, nodes.Add(&v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "testnode", UID: types.UID(uid), Labels: map[string]string{"zone": "a"}},
+	}))
+	cachedNamespaces, err := NewCachedMetadataGenerator(NewNamespaceMetadataGenerator(cfg, namespaces, client), time.Minute)
+	require.NoError(t, err)
+	cachedNodes, err := NewCachedMetadataGenerator(NewNodeMetadataGenerator(cfg, nodes, client), time.Minute)
+	require.NoError(t, err)
+	keptNamespace := &keptMetaGen{meta: mapstr.M{
+		"namespace_uid":    uid,
+		"namespace_labels": mapstr.M{"team": "web"},
+	}}
+	keptNode := &keptMetaGen{meta: mapstr.M{
+		"node": mapstr.M{"name": "testnode", "uid": uid, "labels": mapstr.M{"zone": "a"}},
+	}}
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", UID: types.UID(uid), Namespace: defaultNs},
+		Spec:       v1.PodSpec{NodeName: "testnode"},
+	}
+	for name, gens := range map[string]struct{ namespace, node MetaGen }{
+		"cached": {cachedNamespaces, cachedNodes},
+		"kept":   {keptNamespace, keptNode},
+	} {
+		t.Run(name, func(t *testing.T) {
+			metagen := NewPodMetadataGenerator(cfg, nil, client, gens.node, gens.namespace, nil, nil, addResourceMetadata)
+			for i := 0; i < 3; i++ {
+				meta := metagen.GenerateK8s(pod)
+				assert.Equal(t, mapstr.M{"team": "web"}, meta["namespace_labels"])
+				labels, err := meta.GetValue("node.labels")
+				require.NoError(t, err)
+				assert.Equal(t, mapstr.M{"zone": "a"}, labels)
+				Release(meta)
+			}
+		})
+	}
+	assert.Equal(t, mapstr.M{"team": "web"}, keptNamespace.meta["namespace_labels"])
+	assert.Equal(t, mapstr.M{"zone": "a"}, keptNode.meta["node"].(mapstr.M)["labels"])
+}
@@ -0,0 +1,156 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"sort"
+	"time"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type canonical struct {
+	gen MetaGen
+}
+
+// NewCanonicalMetadataGenerator wraps a MetaGen to return the metadata in canonical form, see
+// Canonical, e.g. to compare it with golden files or deduplicate it. The metadata is copied, so
+// it is not affected by the release of the maps of the wrapped generator.
+func NewCanonicalMetadataGenerator(gen MetaGen) MetaGen {
+	return &canonical{gen: gen}
+}
+
+// Generate generates the canonical metadata of a resource
+func (c *canonical) Generate(obj kubernetes.Resource, opts ...FieldOptions) mapstr.M {
+	return c.canonical(c.gen.Generate(obj, opts...))
+}
+
+// GenerateFromName generates the canonical metadata of a resource from its name
+func (c *canonical) GenerateFromName(name string, opts ...FieldOptions) mapstr.M {
+	return c.canonical(c.gen.GenerateFromName(name, opts...))
+}
+
+// GenerateK8s generates the canonical kubernetes metadata of a resource
+func (c *canonical) GenerateK8s(obj kubernetes.Resource, opts ...FieldOptions) mapstr.M {
+	return c.canonical(c.gen.GenerateK8s(obj, opts...))
+}
+
+// GenerateECS generates the canonical ECS metadata of a resource
+func (c *canonical) GenerateECS(obj kubernetes.Resource) mapstr.M {
+	return c.canonical(c.gen.GenerateECS(obj))
+}
+
+func (c *canonical) canonical(meta mapstr.M) mapstr.M {
+	if meta == nil {
+		return nil
+	}
+	out := Canonical(meta)
+	releaseGenerated(c.gen, meta)
+	return out
+}
+
+// Canonical returns a copy of metadata in canonical form, with the same types for the same
+// values whatever generated them: nested maps are mapstr.M, lists are []interface{}, integers
+// are int64 or uint64, floats are float64 and times are in UTC. Canonical metadata is encoded
+// byte-identical by AppendJSON and json.Marshal, that write the keys of maps sorted, and can be
+// walked in order with SortedKeys.
+func Canonical(meta mapstr.M) mapstr.M {
+	if meta == nil {
+		return nil
+	}
+	return canonicalValue(meta).(mapstr.M)
+}
+
+// SortedKeys returns the keys of a map sorted
+func SortedKeys(m mapstr.M) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func canonicalValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case mapstr.M:
+		return canonicalMap(v)
+	case map[string]interface{}:
+		return canonicalMap(v)
+	case map[string]string:
+		out := make(mapstr.M, len(v))
+		for k, s := range v {
+			out[k] = s
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = canonicalValue(e)
+		}
+		return out
+	case []string:
+		out := make([]interface{}, len(v))
+		for i, s := range v {
+			out[i] = s
+		}
+		return out
+	case []mapstr.M:
+		out := make([]interface{}, len(v))
+		for i, m := range v {
+			out[i] = canonicalMap(m)
+		}
+		return out
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint:
+		return uint64(v)
+	case uint8:
+		return uint64(v)
+	case uint16:
+		return uint64(v)
+	case uint32:
+		return uint64(v)
+	case float32:
+		return float64(v)
+	case time.Time:
+		return v.UTC()
+	case *time.Time:
+		if v == nil {
+			return nil
+		}
+		return v.UTC()
+	default:
+		return v
+	}
+}
+
+func canonicalMap(m map[string]interface{}) mapstr.M {
+	out := make(mapstr.M, len(m))
+	for k, v := range m {
+		out[k] = canonicalValue(v)
+	}
+	return out
+}
@@ -0,0 +1,91 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestCanonical(t *testing.T) {
+	local := time.FixedZone("local", 3600)
+	meta := mapstr.M{
+		"int":     int32(1),
+		"uint":    uint16(2),
+		"float":   float32(0.5),
+		"strings": []string{"b", "a"},
+		"time":    time.Date(2022, 1, 2, 3, 4, 5, 0, local),
+		"nested":  map[string]interface{}{"labels": map[string]string{"app": "nginx"}},
+		"list":    []mapstr.M{{"name": "x"}},
+	}
+	assert.Equal(t, mapstr.M{
+		"int":     int64(1),
+		"uint":    uint64(2),
+		"float":   float64(0.5),
+		"strings": []interface{}{"b", "a"},
+		"time":    time.Date(2022, 1, 2, 2, 4, 5, 0, time.UTC),
+		"nested":  mapstr.M{"labels": mapstr.M{"app": "nginx"}},
+		"list":    []interface{}{mapstr.M{"name": "x"}},
+	}, Canonical(meta))
+	assert.Nil(t, Canonical(nil))
+
+	assert.Equal(t, []string{"float", "int", "list", "nested", "strings", "time", "uint"}, SortedKeys(meta))
+}
+
+func TestCanonicalMetadataGenerator(t *testing.T) {
+	cfg, err := config.NewConfigFrom(map[string]interface{}{"include_annotations": []string{"app"}})
+	require.NoError(t, err)
+	metagen := NewCanonicalMetadataGenerator(NewPodMetadataGenerator(cfg, nil, k8sfake.NewSimpleClientset(), nil, nil, nil, nil, addResourceMetadata))
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			UID:         types.UID(uid),
+			Namespace:   defaultNs,
+			Labels:      map[string]string{"app.kubernetes.io/name": "nginx", "tier": "web", "app": "frontend"},
+			Annotations: map[string]string{"app": "production"},
+		},
+		Spec: v1.PodSpec{NodeName: "testnode"},
+	}
+
+	var encoded []byte
+	for i := 0; i < 10; i++ {
+		meta := metagen.Generate(pod)
+		data, err := AppendJSON(nil, meta)
+		require.NoError(t, err)
+		marshaled, err := json.Marshal(meta)
+		require.NoError(t, err)
+		assert.Equal(t, string(marshaled), string(data))
+		if encoded != nil {
+			assert.Equal(t, string(encoded), string(data))
+		}
+		encoded = data
+	}
+	assert.Nil(t, metagen.GenerateFromName("unknown"))
+}
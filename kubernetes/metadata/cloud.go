@@ -0,0 +1,59 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type cloudMetaGen struct {
+	MetaGen
+	cloud mapstr.M
+}
+
+// WithCloudMetadata wraps a MetaGen to merge cloud fields, like the ones returned by cloud.Fetch,
+// into the ECS metadata it generates. It is meant for the resources scheduled in the node the
+// agent runs in, e.g. the node and pods of watchers scoped to the local node. The fields of the
+// resources take precedence over the cloud ones.
+func WithCloudMetadata(gen MetaGen, cloud mapstr.M) MetaGen {
+	if gen == nil || len(cloud) == 0 {
+		return gen
+	}
+	return &cloudMetaGen{MetaGen: gen, cloud: cloud}
+}
+
+// Generate generates the metadata of the resource with the cloud fields
+func (c *cloudMetaGen) Generate(obj kubernetes.Resource, opts ...FieldOptions) mapstr.M {
+	meta := c.MetaGen.Generate(obj, opts...)
+	if meta == nil {
+		return nil
+	}
+	meta.DeepUpdateNoOverwrite(c.cloud.Clone())
+	return meta
+}
+
+// GenerateECS generates the ECS metadata of the resource with the cloud fields
+func (c *cloudMetaGen) GenerateECS(obj kubernetes.Resource) mapstr.M {
+	meta := c.MetaGen.GenerateECS(obj)
+	if meta == nil {
+		meta = mapstr.M{}
+	}
+	meta.DeepUpdateNoOverwrite(c.cloud.Clone())
+	return meta
+}
@@ -0,0 +1,77 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestWithCloudMetadata(t *testing.T) {
+	cloud := mapstr.M{
+		"cloud": mapstr.M{
+			"provider": "aws",
+			"region":   "us-east-1",
+			"instance": mapstr.M{"id": "i-0abc"},
+		},
+	}
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			UID:  types.UID(uid),
+		},
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Node",
+			APIVersion: "v1",
+		},
+	}
+
+	cfg := config.NewConfig()
+	gen := NewNodeMetadataGenerator(cfg, nil, k8sfake.NewSimpleClientset())
+	assert.Equal(t, gen, WithCloudMetadata(gen, nil))
+
+	metagen := WithCloudMetadata(gen, cloud)
+	assert.Equal(t, mapstr.M{
+		"kubernetes": mapstr.M{
+			"node": mapstr.M{
+				"name": name,
+				"uid":  uid,
+			},
+		},
+		"cloud": mapstr.M{
+			"provider": "aws",
+			"region":   "us-east-1",
+			"instance": mapstr.M{"id": "i-0abc"},
+		},
+	}, metagen.Generate(node))
+	assert.Equal(t, cloud, metagen.GenerateECS(node))
+
+	// Generated metadata doesn't share the maps of the cloud fields
+	meta := metagen.GenerateECS(node)
+	_, _ = meta.Put("cloud.region", "eu-west-1")
+	region, _ := cloud.GetValue("cloud.region")
+	assert.Equal(t, "us-east-1", region)
+}
@@ -18,18 +18,55 @@
 package metadata
 
 import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
 	"github.com/elastic/elastic-agent-libs/config"
 )
 
+// configKeys are the settings of Config, and the enabled setting of the configs of related
+// resources
+var configKeys = map[string]bool{
+	"kube_config":                  true,
+	"include_labels":               true,
+	"exclude_labels":               true,
+	"include_annotations":          true,
+	"labels.dedot":                 true,
+	"annotations.dedot":            true,
+	"labels.max_value_length":      true,
+	"annotations.max_value_length": true,
+	"large_cluster":                true,
+	"enabled":                      true,
+}
+
 // Config declares supported configuration for metadata generation
 type Config struct {
-	KubeConfig         string   `config:"kube_config"`
+	KubeConfig string `config:"kube_config"`
+
+	// IncludeLabels, ExcludeLabels and IncludeAnnotations are keys of labels and annotations, they
+	// can have `*` wildcards, like `app.kubernetes.io/*`. Excluded labels are matched with the
+	// dedotted keys if labels are dedotted.
 	IncludeLabels      []string `config:"include_labels"`
 	ExcludeLabels      []string `config:"exclude_labels"`
 	IncludeAnnotations []string `config:"include_annotations"`
 
 	LabelsDedot      bool `config:"labels.dedot"`
 	AnnotationsDedot bool `config:"annotations.dedot"`
+
+	// LabelsMaxValueLength and AnnotationsMaxValueLength are the maximum length in bytes of the
+	// values of labels and annotations, like the last applied configuration stamped by some
+	// operators. Longer values are truncated and marked with TruncatedMarker, and counted in
+	// Truncations. Values are not truncated if 0.
+	LabelsMaxValueLength      int `config:"labels.max_value_length" validate:"min=0"`
+	AnnotationsMaxValueLength int `config:"annotations.max_value_length" validate:"min=0"`
+
+	// LargeCluster bounds the load of the API server in large clusters. Related resources, like
+	// namespaces, nodes and owners, are only looked up in the stores of the watchers, and the
+	// cluster is identified only from the kube config, without requesting the kubeadm-config
+	// ConfigMap for every generator. Skipped lookups are counted in Lookups.
+	LargeCluster bool `config:"large_cluster"`
 }
 
 // AddResourceMetadataConfig allows adding config for enriching additional resources
@@ -40,17 +77,197 @@ type AddResourceMetadataConfig struct {
 	CronJob    bool      `config:"cronjob"`
 }
 
+// EffectiveResourceMetadataConfig is an AddResourceMetadataConfig resolved with the defaults
+type EffectiveResourceMetadataConfig struct {
+	// Node and Namespace are the configs of the metadata of nodes and namespaces, nil if disabled
+	Node       *Config `json:"node,omitempty"`
+	Namespace  *Config `json:"namespace,omitempty"`
+	Deployment bool    `json:"deployment"`
+	CronJob    bool    `json:"cronjob"`
+}
+
+// Validate rejects the unknown settings of the configs of the metadata of nodes and namespaces,
+// see ValidateConfig
+func (c *AddResourceMetadataConfig) Validate() error {
+	if err := validateConfigKeys(c.Node); err != nil {
+		return err
+	}
+	return validateConfigKeys(c.Namespace)
+}
+
+// Effective returns the config resolved with the defaults
+func (c *AddResourceMetadataConfig) Effective() (EffectiveResourceMetadataConfig, error) {
+	effective := EffectiveResourceMetadataConfig{Deployment: c.Deployment, CronJob: c.CronJob}
+	for _, related := range []struct {
+		name   string
+		cfg    *config.C
+		config **Config
+	}{
+		{"node", c.Node, &effective.Node},
+		{"namespace", c.Namespace, &effective.Namespace},
+	} {
+		if !related.cfg.Enabled() {
+			continue
+		}
+		resolved, err := EffectiveConfig(related.cfg)
+		if err != nil {
+			return EffectiveResourceMetadataConfig{}, fmt.Errorf("invalid %s metadata config: %w", related.name, err)
+		}
+		*related.config = &resolved
+	}
+	return effective, nil
+}
+
 // InitDefaults initializes the defaults for the config.
 func (c *Config) InitDefaults() {
 	c.LabelsDedot = true
 	c.AnnotationsDedot = true
 }
 
+// Validate checks the keys of the labels and annotations. It is called when the config is
+// unpacked.
+func (c *Config) Validate() error {
+	for _, setting := range []struct {
+		name string
+		keys []string
+	}{
+		{"include_labels", c.IncludeLabels},
+		{"exclude_labels", c.ExcludeLabels},
+		{"include_annotations", c.IncludeAnnotations},
+	} {
+		for _, key := range setting.keys {
+			if err := validateKey(key); err != nil {
+				return fmt.Errorf("invalid key %q in %s: %w", key, setting.name, err)
+			}
+		}
+	}
+
+	excluded := make(map[string]struct{}, len(c.ExcludeLabels))
+	for _, key := range c.ExcludeLabels {
+		excluded[key] = struct{}{}
+	}
+	for _, key := range c.IncludeLabels {
+		if _, found := excluded[key]; found {
+			return fmt.Errorf("label %q is both in include_labels and exclude_labels, remove it from one of them", key)
+		}
+	}
+	if !c.LabelsDedot {
+		return nil
+	}
+	// Excluded labels are matched with the dedotted keys
+	for _, key := range c.ExcludeLabels {
+		if strings.Contains(key, ".") && !strings.Contains(key, "*") {
+			return fmt.Errorf("label %q in exclude_labels is never matched as labels are dedotted, use %q or disable labels.dedot", key, strings.ReplaceAll(key, ".", "_"))
+		}
+	}
+	return nil
+}
+
+// validateKey checks that a key of labels or annotations only has the characters allowed in
+// the keys of Kubernetes, and wildcards
+func validateKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("keys cannot be empty")
+	}
+	for _, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == '/', r == '*':
+		default:
+			return fmt.Errorf("keys can only have alphanumeric characters, '-', '_', '.', '/' and '*' wildcards")
+		}
+	}
+	if strings.Count(key, "/") > 1 {
+		return fmt.Errorf("keys can only have one '/' between their prefix and name")
+	}
+	return nil
+}
+
+// ValidateConfig checks a config of a metadata generator strictly, rejecting the settings that
+// are not settings of Config, e.g. misspelled ones. It is not done when the config is unpacked,
+// as the config of generators is often part of a larger config.
+func ValidateConfig(cfg *config.C) error {
+	if err := validateConfigKeys(cfg); err != nil {
+		return err
+	}
+	var c Config
+	return c.Unmarshal(cfg)
+}
+
+// validateConfigKeys rejects the unknown settings of a config, the keys of nested configs
+// include the path of the config
+func validateConfigKeys(cfg *config.C) error {
+	if cfg == nil {
+		return nil
+	}
+	prefix := ""
+	if path := cfg.Path(); path != "" {
+		prefix = path + "."
+	}
+	var unknown []string
+	for _, key := range cfg.FlattenedKeys() {
+		setting := settingOf(strings.TrimPrefix(key, prefix))
+		if !configKeys[setting] {
+			unknown = append(unknown, prefix+setting)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		known := make([]string, 0, len(configKeys))
+		for key := range configKeys {
+			known = append(known, key)
+		}
+		sort.Strings(known)
+		return fmt.Errorf("unknown metadata settings %s, valid settings are %s", strings.Join(unknown, ", "), strings.Join(known, ", "))
+	}
+	return nil
+}
+
+// settingOf returns the setting of a flattened key, without the indexes of lists
+func settingOf(key string) string {
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		if _, err := strconv.Atoi(part); err == nil {
+			return strings.Join(parts[:i], ".")
+		}
+	}
+	return key
+}
+
+// EffectiveConfig returns the config of a metadata generator resolved with the defaults
+func EffectiveConfig(cfg *config.C) (Config, error) {
+	var c Config
+	c.InitDefaults()
+	if cfg == nil {
+		return c, nil
+	}
+	if err := c.Unmarshal(cfg); err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
+
 // Unmarshal unpacks a Config into the metagen Config
 func (c *Config) Unmarshal(cfg *config.C) error {
 	return cfg.Unpack(c)
 }
 
+// GetLargeClusterResourceMetadataConfig returns the preset of the configuration of the metadata of
+// related resources for large clusters, enriching them with the large cluster mode. The config of
+// the generators of the main resources must also set `large_cluster: true`.
+func GetLargeClusterResourceMetadataConfig() *AddResourceMetadataConfig {
+	metaConfig := Config{}
+	metaConfig.InitDefaults()
+	metaConfig.LargeCluster = true
+	metaCfg, _ := config.NewConfigFrom(&metaConfig)
+	return &AddResourceMetadataConfig{
+		Node:       metaCfg,
+		Namespace:  metaCfg,
+		Deployment: true,
+		CronJob:    true,
+	}
+}
+
 func GetDefaultResourceMetadataConfig() *AddResourceMetadataConfig {
 	metaConfig := Config{}
 	metaConfig.InitDefaults()
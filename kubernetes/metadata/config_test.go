@@ -0,0 +1,132 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := map[string]struct {
+		raw map[string]interface{}
+		err string
+	}{
+		"valid": {
+			raw: map[string]interface{}{
+				"include_labels":      []string{"app.kubernetes.io/*", "tier"},
+				"exclude_labels":      []string{"app_kubernetes_io/version"},
+				"include_annotations": []string{"prometheus.io/scrape"},
+			},
+		},
+		"empty key": {
+			raw: map[string]interface{}{"include_labels": []string{""}},
+			err: `invalid key "" in include_labels: keys cannot be empty`,
+		},
+		"invalid characters": {
+			raw: map[string]interface{}{"include_annotations": []string{"app name"}},
+			err: `invalid key "app name" in include_annotations`,
+		},
+		"several slashes": {
+			raw: map[string]interface{}{"exclude_labels": []string{"a/b/c"}},
+			err: `invalid key "a/b/c" in exclude_labels`,
+		},
+		"included and excluded": {
+			raw: map[string]interface{}{"include_labels": []string{"tier"}, "exclude_labels": []string{"tier"}},
+			err: `label "tier" is both in include_labels and exclude_labels`,
+		},
+		"dotted excluded label with dedot": {
+			raw: map[string]interface{}{"exclude_labels": []string{"app.kubernetes.io/version"}},
+			err: `use "app_kubernetes_io/version" or disable labels.dedot`,
+		},
+		"dotted excluded label without dedot": {
+			raw: map[string]interface{}{"exclude_labels": []string{"app.kubernetes.io/version"}, "labels.dedot": false},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := config.NewConfigFrom(test.raw)
+			require.NoError(t, err)
+			var c Config
+			err = c.Unmarshal(cfg)
+			if test.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.err)
+		})
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	cfg, err := config.NewConfigFrom(map[string]interface{}{
+		"include_labels": []string{"app"},
+		"labels.dedot":   false,
+		"enabled":        true,
+	})
+	require.NoError(t, err)
+	assert.NoError(t, ValidateConfig(cfg))
+
+	cfg, err = config.NewConfigFrom(map[string]interface{}{
+		"include_label": []string{"app"},
+		"labels.dedto":  false,
+	})
+	require.NoError(t, err)
+	err = ValidateConfig(cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown metadata settings include_label, labels.dedto, valid settings are ")
+}
+
+func TestAddResourceMetadataConfig(t *testing.T) {
+	cfg, err := config.NewConfigFrom(map[string]interface{}{
+		"node":       map[string]interface{}{"include_labels": []string{"zone"}},
+		"namespace":  map[string]interface{}{"enabled": false},
+		"deployment": true,
+	})
+	require.NoError(t, err)
+	var c AddResourceMetadataConfig
+	require.NoError(t, cfg.Unpack(&c))
+
+	effective, err := c.Effective()
+	require.NoError(t, err)
+	assert.Equal(t, EffectiveResourceMetadataConfig{
+		Node:       &Config{IncludeLabels: []string{"zone"}, LabelsDedot: true, AnnotationsDedot: true},
+		Deployment: true,
+	}, effective)
+
+	cfg, err = config.NewConfigFrom(map[string]interface{}{
+		"node": map[string]interface{}{"include_lables": []string{"zone"}},
+	})
+	require.NoError(t, err)
+	err = cfg.Unpack(&c)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown metadata settings node.include_lables")
+
+	effective, err = GetDefaultResourceMetadataConfig().Effective()
+	require.NoError(t, err)
+	require.NotNil(t, effective.Namespace)
+	assert.True(t, effective.Namespace.LabelsDedot)
+	assert.Empty(t, effective.Namespace.IncludeLabels)
+	assert.True(t, effective.CronJob)
+}
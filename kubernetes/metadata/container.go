@@ -0,0 +1,42 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// WithContainer adds the metadata of a container of the pod under container: its name, image,
+// type, and its ID and runtime once it has been created.
+func WithContainer(c *kubernetes.ContainerInPod) FieldOptions {
+	return func(meta mapstr.M) {
+		container := mapstr.M{
+			"name":  c.Spec.Name,
+			"image": c.Spec.Image,
+			"type":  string(c.Type),
+		}
+		if c.ID != "" {
+			container["id"] = c.ID
+		}
+		if c.Runtime != "" {
+			container["runtime"] = c.Runtime
+		}
+		meta["container"] = container
+	}
+}
@@ -0,0 +1,66 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestWithContainer(t *testing.T) {
+	always := v1.ContainerRestartPolicyAlways
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			UID:       types.UID(uid),
+			Namespace: defaultNs,
+		},
+		Spec: v1.PodSpec{
+			NodeName:       "testnode",
+			Containers:     []v1.Container{{Name: "nginx", Image: "nginx:1.25"}},
+			InitContainers: []v1.Container{{Name: "proxy", Image: "envoy:1.28", RestartPolicy: &always}},
+		},
+		Status: v1.PodStatus{
+			InitContainerStatuses: []v1.ContainerStatus{{Name: "proxy", ContainerID: "containerd://abc"}},
+		},
+	}
+
+	metaGen := NewPodMetadataGenerator(config.NewConfig(), nil, k8sfake.NewSimpleClientset(), nil, nil, nil, nil, addResourceMetadata)
+	containers := kubernetes.GetContainersInPod(pod)
+
+	meta := metaGen.Generate(pod, WithContainer(containers[0]))
+	assert.Equal(t, mapstr.M{"name": "nginx", "image": "nginx:1.25", "type": "container"}, getNested(meta, "kubernetes", "container"))
+
+	meta = metaGen.Generate(pod, WithContainer(containers[1]))
+	assert.Equal(t, mapstr.M{
+		"name":    "proxy",
+		"image":   "envoy:1.28",
+		"type":    "sidecar",
+		"id":      "abc",
+		"runtime": "containerd",
+	}, getNested(meta, "kubernetes", "container"))
+}
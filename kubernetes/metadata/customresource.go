@@ -0,0 +1,139 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"strings"
+
+	k8s "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type customResource struct {
+	store      cache.Store
+	kind       string
+	specFields []string
+	resource   *Resource
+}
+
+// NewCustomResourceMetadataGenerator creates a metagen for the instances of a custom resource
+// definition. The spec of the resources is rendered under `<kind>.spec`, limited to the given
+// fields, in dotted notation, if any. The kind is the lowercase kind of the objects if empty.
+func NewCustomResourceMetadataGenerator(cfg *config.C, kind string, specFields []string, resources cache.Store, namespace MetaGen, client k8s.Interface) MetaGen {
+	return &customResource{
+		resource:   NewNamespaceAwareResourceMetadataGenerator(cfg, client, namespace),
+		store:      resources,
+		kind:       strings.ToLower(kind),
+		specFields: specFields,
+	}
+}
+
+// Generate generates custom resource metadata from a resource object
+func (c *customResource) Generate(obj kubernetes.Resource, opts ...FieldOptions) mapstr.M {
+	ecsFields := c.GenerateECS(obj)
+	meta := mapstr.M{
+		"kubernetes": c.GenerateK8s(obj, opts...),
+	}
+	meta.DeepUpdate(ecsFields)
+	return meta
+}
+
+// GenerateECS generates custom resource ECS metadata from a resource object
+func (c *customResource) GenerateECS(obj kubernetes.Resource) mapstr.M {
+	return c.resource.GenerateECS(obj)
+}
+
+// GenerateK8s generates custom resource metadata from a resource object
+func (c *customResource) GenerateK8s(obj kubernetes.Resource, opts ...FieldOptions) mapstr.M {
+	cr, ok := obj.(*kubernetes.CustomResource)
+	if !ok {
+		return nil
+	}
+
+	kind := c.kind
+	if kind == "" {
+		kind = strings.ToLower(cr.GetKind())
+	}
+	out := c.resource.GenerateK8s(kind, obj, opts...)
+
+	spec, ok := cr.Object["spec"].(map[string]interface{})
+	if !ok {
+		return out
+	}
+	specMeta := toMapStr(spec)
+	if len(c.specFields) > 0 {
+		subset := mapstr.M{}
+		for _, field := range c.specFields {
+			if value, err := specMeta.GetValue(field); err == nil {
+				_, _ = subset.Put(field, value)
+			}
+		}
+		specMeta = subset
+	}
+	if len(specMeta) > 0 {
+		_, _ = out.Put(kind+".spec", specMeta)
+	}
+	return out
+}
+
+// GenerateFromName generates custom resource metadata from its name
+func (c *customResource) GenerateFromName(name string, opts ...FieldOptions) mapstr.M {
+	if c.store == nil {
+		return nil
+	}
+
+	if obj, ok, _ := c.store.GetByKey(name); ok {
+		cr, ok := obj.(*kubernetes.CustomResource)
+		if !ok {
+			return nil
+		}
+
+		return c.GenerateK8s(cr, opts...)
+	}
+
+	return nil
+}
+
+// toMapStr converts the nested maps of an unstructured object to mapstr.M, copying them so the
+// metadata doesn't share maps with the objects in the store
+func toMapStr(in map[string]interface{}) mapstr.M {
+	out := make(mapstr.M, len(in))
+	for k, v := range in {
+		out[k] = toMapStrValue(v)
+	}
+	return out
+}
+
+func toMapStrValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return toMapStr(v)
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, value := range v {
+			values[i] = toMapStrValue(value)
+		}
+		return values
+	default:
+		return v
+	}
+}
@@ -0,0 +1,110 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func monitoringTarget() *kubernetes.CustomResource {
+	return &kubernetes.CustomResource{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "MonitoringTarget",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": defaultNs,
+			"uid":       uid,
+			"labels":    map[string]interface{}{"team": "payments"},
+		},
+		"spec": map[string]interface{}{
+			"module": "redis",
+			"hosts":  []interface{}{"redis:6379"},
+			"options": map[string]interface{}{
+				"period": "10s",
+				"tls":    true,
+			},
+		},
+	}}
+}
+
+func TestCustomResource_Generate(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	cfg := config.NewConfig()
+
+	metagen := NewCustomResourceMetadataGenerator(cfg, "", nil, nil, nil, client)
+	assert.Equal(t, mapstr.M{
+		"kubernetes": mapstr.M{
+			"monitoringtarget": mapstr.M{
+				"name": name,
+				"uid":  uid,
+				"spec": mapstr.M{
+					"module":  "redis",
+					"hosts":   []interface{}{"redis:6379"},
+					"options": mapstr.M{"period": "10s", "tls": true},
+				},
+			},
+			"namespace": defaultNs,
+			"labels":    mapstr.M{"team": "payments"},
+		},
+	}, metagen.Generate(monitoringTarget()))
+
+	// Subset of the spec
+	metagen = NewCustomResourceMetadataGenerator(cfg, "target", []string{"module", "options.period", "missing"}, nil, nil, client)
+	assert.Equal(t, mapstr.M{
+		"target": mapstr.M{
+			"name": name,
+			"uid":  uid,
+			"spec": mapstr.M{
+				"module":  "redis",
+				"options": mapstr.M{"period": "10s"},
+			},
+		},
+		"namespace": defaultNs,
+		"labels":    mapstr.M{"team": "payments"},
+	}, metagen.GenerateK8s(monitoringTarget()))
+
+	// Other resources are ignored
+	assert.Nil(t, metagen.GenerateK8s(&kubernetes.Pod{}))
+}
+
+func TestCustomResource_GenerateFromName(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	target := monitoringTarget()
+	require.NoError(t, store.Add(target))
+
+	metagen := NewCustomResourceMetadataGenerator(config.NewConfig(), "", []string{"module"}, store, nil, client)
+	meta := metagen.GenerateFromName(defaultNs + "/" + name)
+	module, err := meta.GetValue("monitoringtarget.spec.module")
+	require.NoError(t, err)
+	assert.Equal(t, "redis", module)
+	assert.Nil(t, metagen.GenerateFromName(defaultNs+"/missing"))
+
+	// Metadata doesn't share maps with the stored object
+	_, _ = meta.Put("monitoringtarget.spec.module", "changed")
+	assert.Equal(t, "redis", target.Object["spec"].(map[string]interface{})["module"])
+}
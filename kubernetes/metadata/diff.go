@@ -0,0 +1,101 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// Diff is the difference between the metadata generated for two versions of a resource
+type Diff struct {
+	// Changed has the fields added or changed in the new metadata, nested as in the metadata, it
+	// can be applied with DeepUpdate
+	Changed mapstr.M
+
+	// Removed has the dotted keys of the fields of the old metadata missing in the new one,
+	// sorted, they can be applied with Delete
+	Removed []string
+}
+
+// Empty returns true if the metadata didn't change
+func (d Diff) Empty() bool {
+	return len(d.Changed) == 0 && len(d.Removed) == 0
+}
+
+// Apply updates metadata generated for the old version of a resource to the new one
+func (d Diff) Apply(meta mapstr.M) {
+	for _, key := range d.Removed {
+		_ = meta.Delete(key)
+	}
+	meta.DeepUpdate(d.Changed)
+}
+
+// GenerateDiff generates the metadata of the old and new versions of a resource, and returns
+// only the fields that changed between them, so consumers applying metadata to running inputs
+// on update events don't need to compare the full metadata
+func GenerateDiff(gen MetaGen, oldObj, newObj kubernetes.Resource, opts ...FieldOptions) Diff {
+	return DiffMetadata(gen.Generate(oldObj, opts...), gen.Generate(newObj, opts...))
+}
+
+// DiffMetadata returns the fields changed between two versions of metadata. Values other than
+// nested maps, like slices, are compared as a whole. Changed shares these values with the new
+// metadata.
+func DiffMetadata(oldMeta, newMeta mapstr.M) Diff {
+	var diff Diff
+	diff.Changed = diffMaps(oldMeta, newMeta, "", &diff.Removed)
+	sort.Strings(diff.Removed)
+	return diff
+}
+
+// diffMaps returns the fields of new that are not in old or have other values, and appends the
+// keys of the fields of old missing in new to removed
+func diffMaps(oldMeta, newMeta mapstr.M, prefix string, removed *[]string) mapstr.M {
+	changed := mapstr.M{}
+	for k, v := range newMeta {
+		old, found := oldMeta[k]
+		if !found {
+			changed[k] = v
+			continue
+		}
+		newNested, newIsMap := v.(mapstr.M)
+		oldNested, oldIsMap := old.(mapstr.M)
+		if newIsMap && oldIsMap {
+			if nested := diffMaps(oldNested, newNested, prefix+k+".", removed); len(nested) > 0 {
+				changed[k] = nested
+			}
+			continue
+		}
+		if oldIsMap {
+			// A nested map replaced by a value is removed first, DeepUpdate would merge them
+			*removed = append(*removed, prefix+k)
+		}
+		if !reflect.DeepEqual(old, v) {
+			changed[k] = v
+		}
+	}
+	for k := range oldMeta {
+		if _, found := newMeta[k]; !found {
+			*removed = append(*removed, prefix+k)
+		}
+	}
+	return changed
+}
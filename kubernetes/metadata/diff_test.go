@@ -0,0 +1,132 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestGenerateDiff(t *testing.T) {
+	cfg, err := config.NewConfigFrom(map[string]interface{}{
+		"include_annotations": []string{"owner"},
+	})
+	require.NoError(t, err)
+	metagen := NewPodMetadataGenerator(cfg, nil, k8sfake.NewSimpleClientset(), nil, nil, nil, nil, addResourceMetadata)
+
+	oldPod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web",
+			Namespace: defaultNs,
+			UID:       types.UID(uid),
+			Labels:    map[string]string{"app": "web", "version": "1", "canary": "true"},
+		},
+		Spec: v1.PodSpec{NodeName: "node-1"},
+	}
+	newPod := oldPod.DeepCopy()
+	newPod.Labels["version"] = "2"
+	delete(newPod.Labels, "canary")
+	newPod.Annotations = map[string]string{"owner": "team-a"}
+	newPod.Status.PodIP = "10.0.0.5"
+
+	diff := GenerateDiff(metagen, oldPod, newPod)
+	assert.Equal(t, mapstr.M{
+		"kubernetes": mapstr.M{
+			"labels":      mapstr.M{"version": "2"},
+			"annotations": mapstr.M{"owner": "team-a"},
+			"pod":         mapstr.M{"ip": "10.0.0.5"},
+		},
+	}, diff.Changed)
+	assert.Equal(t, []string{"kubernetes.labels.canary"}, diff.Removed)
+	assert.False(t, diff.Empty())
+
+	meta := metagen.Generate(oldPod)
+	diff.Apply(meta)
+	assert.Equal(t, metagen.Generate(newPod), meta)
+
+	assert.True(t, GenerateDiff(metagen, newPod, newPod.DeepCopy()).Empty())
+}
+
+func TestDiffMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		old     mapstr.M
+		new     mapstr.M
+		changed mapstr.M
+		removed []string
+	}{
+		{
+			name:    "no old metadata",
+			new:     mapstr.M{"a": mapstr.M{"b": 1}},
+			changed: mapstr.M{"a": mapstr.M{"b": 1}},
+		},
+		{
+			name:    "no new metadata",
+			old:     mapstr.M{"a": mapstr.M{"b": 1}, "c": 2},
+			changed: mapstr.M{},
+			removed: []string{"a", "c"},
+		},
+		{
+			name:    "slices compared as a whole",
+			old:     mapstr.M{"ips": []string{"10.0.0.1"}, "ports": []int{80}},
+			new:     mapstr.M{"ips": []string{"10.0.0.1", "10.0.0.2"}, "ports": []int{80}},
+			changed: mapstr.M{"ips": []string{"10.0.0.1", "10.0.0.2"}},
+		},
+		{
+			name:    "nested map replaced by a value",
+			old:     mapstr.M{"app": mapstr.M{"name": "web"}},
+			new:     mapstr.M{"app": "web"},
+			changed: mapstr.M{"app": "web"},
+			removed: []string{"app"},
+		},
+		{
+			name:    "value replaced by a nested map",
+			old:     mapstr.M{"app": "web"},
+			new:     mapstr.M{"app": mapstr.M{"name": "web"}},
+			changed: mapstr.M{"app": mapstr.M{"name": "web"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diff := DiffMetadata(test.old, test.new)
+			assert.Equal(t, test.changed, diff.Changed)
+			assert.Equal(t, test.removed, diff.Removed)
+
+			meta := test.old.Clone()
+			if meta == nil {
+				meta = mapstr.M{}
+			}
+			diff.Apply(meta)
+			if test.new == nil {
+				assert.Empty(t, meta)
+			} else {
+				assert.Equal(t, test.new, meta)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"reflect"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type fragment struct {
+	meta  mapstr.M
+	stale bool
+}
+
+// FragmentCache keeps the metadata of namespaces and nodes to compose it by reference in the
+// metadata of their pods, instead of generating it again for every pod. Fragments are
+// invalidated by the handlers of the namespace and node watchers, and replaced only when their
+// content changes, so updates like node heartbeats don't replace them.
+//
+// The namespace and node fields of the pod metadata are shared between pods, they must not be
+// modified, callers that need to modify the metadata must Clone it first. Release doesn't release
+// them, even after the fragments are replaced or deleted.
+type FragmentCache struct {
+	namespace MetaGen
+	node      MetaGen
+
+	mutex      sync.RWMutex
+	namespaces map[string]*fragment
+	nodes      map[string]*fragment
+}
+
+// NewFragmentCache creates a cache of the metadata of namespaces and nodes generated by some
+// generators, any of them can be nil
+func NewFragmentCache(namespace MetaGen, node MetaGen) *FragmentCache {
+	return &FragmentCache{
+		namespace:  namespace,
+		node:       node,
+		namespaces: make(map[string]*fragment),
+		nodes:      make(map[string]*fragment),
+	}
+}
+
+// Namespace returns the flattened metadata of a namespace, as merged in the metadata of its
+// resources, or nil if unknown
+func (c *FragmentCache) Namespace(name string) mapstr.M {
+	if c.namespace == nil {
+		return nil
+	}
+	return c.get(c.namespaces, name, func() mapstr.M {
+		return c.namespace.GenerateFromName(name)
+	})
+}
+
+// Node returns the metadata of a node, with its labels and annotations, as set under the `node`
+// key of the metadata of its pods, or nil if unknown
+func (c *FragmentCache) Node(name string) mapstr.M {
+	if c.node == nil {
+		return nil
+	}
+	return c.get(c.nodes, name, func() mapstr.M {
+		meta := c.node.GenerateFromName(name, WithMetadata("node"))
+		node, _ := meta["node"].(mapstr.M)
+		return node
+	})
+}
+
+func (c *FragmentCache) get(fragments map[string]*fragment, name string, generate func() mapstr.M) mapstr.M {
+	// Fragments are read by every generation and only written on updates
+	c.mutex.RLock()
+	f, ok := fragments[name]
+	if ok && !f.stale {
+		c.mutex.RUnlock()
+		return f.meta
+	}
+	c.mutex.RUnlock()
+
+	generated := generate()
+	if generated == nil {
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if f, ok := fragments[name]; ok && reflect.DeepEqual(f.meta, generated) {
+		f.stale = false
+		return f.meta
+	}
+	fragments[name] = &fragment{meta: generated}
+	return generated
+}
+
+// invalidate marks the fragment of an updated resource as stale, or removes a deleted one
+func (c *FragmentCache) invalidate(fragments map[string]*fragment, obj interface{}, deleted bool) {
+	r, ok := resourceOf(obj)
+	if !ok {
+		return
+	}
+	accessor, err := meta.Accessor(r)
+	if err != nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if deleted {
+		delete(fragments, accessor.GetName())
+	} else if f, ok := fragments[accessor.GetName()]; ok {
+		f.stale = true
+	}
+}
+
+// NamespaceHandler wraps the handler of the namespace watcher to invalidate the fragments of
+// updated or deleted namespaces
+func (c *FragmentCache) NamespaceHandler(next kubernetes.ResourceEventHandler) kubernetes.ResourceEventHandler {
+	return c.handler(next, c.namespaces)
+}
+
+// NodeHandler wraps the handler of the node watcher to invalidate the fragments of updated or
+// deleted nodes
+func (c *FragmentCache) NodeHandler(next kubernetes.ResourceEventHandler) kubernetes.ResourceEventHandler {
+	return c.handler(next, c.nodes)
+}
+
+func (c *FragmentCache) handler(next kubernetes.ResourceEventHandler, fragments map[string]*fragment) kubernetes.ResourceEventHandler {
+	if next == nil {
+		next = kubernetes.NoOpEventHandlerFuncs{}
+	}
+	return kubernetes.ResourceEventHandlerFuncs{
+		AddFunc: next.OnAdd,
+		UpdateFunc: func(obj interface{}) {
+			c.invalidate(fragments, obj, false)
+			next.OnUpdate(obj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			c.invalidate(fragments, obj, true)
+			next.OnDelete(obj)
+		},
+	}
+}
+
+// namespaceFragments is the namespace MetaGen of the resources of the pods using a FragmentCache
+type namespaceFragments struct {
+	MetaGen
+	cache *FragmentCache
+}
+
+// GenerateFromName returns the shared fragment of the namespace
+func (n *namespaceFragments) GenerateFromName(name string, opts ...FieldOptions) mapstr.M {
+	if len(opts) > 0 {
+		return n.MetaGen.GenerateFromName(name, opts...)
+	}
+	return n.cache.Namespace(name)
+}
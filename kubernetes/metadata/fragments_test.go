@@ -0,0 +1,148 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestPod_GenerateWithFragments(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	cfg := config.NewConfig()
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "testnode",
+			UID:             types.UID(uid),
+			ResourceVersion: "1",
+			Labels:          map[string]string{"nodekey": "nodevalue"},
+		},
+	}
+	namespace := &v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   defaultNs,
+			UID:    types.UID(uid),
+			Labels: map[string]string{"nskey": "nsvalue"},
+		},
+	}
+	newPod := func(name string) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, UID: types.UID(name), Namespace: defaultNs},
+			Spec:       v1.PodSpec{NodeName: "testnode"},
+		}
+	}
+
+	nodes := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	require.NoError(t, nodes.Add(node))
+	namespaces := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	require.NoError(t, namespaces.Add(namespace))
+	nodeMeta := NewNodeMetadataGenerator(cfg, nodes, client)
+	nsMeta := NewNamespaceMetadataGenerator(cfg, namespaces, client)
+
+	fragments := NewFragmentCache(nsMeta, nodeMeta)
+	metagen := NewPodMetadataGeneratorWithFragments(cfg, nil, client, fragments, nil, nil, addResourceMetadata)
+	reference := NewPodMetadataGenerator(cfg, nil, client, nodeMeta, nsMeta, nil, nil, addResourceMetadata)
+
+	// Same metadata as without fragments
+	pod1, pod2 := newPod("pod1"), newPod("pod2")
+	meta1 := metagen.GenerateK8s(pod1)
+	assert.Equal(t, reference.GenerateK8s(pod1), meta1)
+
+	// Composed by reference
+	meta2 := metagen.GenerateK8s(pod2)
+	assert.Equal(t, reflect.ValueOf(meta1["node"]).Pointer(), reflect.ValueOf(meta2["node"]).Pointer())
+	assert.Equal(t, reflect.ValueOf(meta1["namespace_labels"]).Pointer(), reflect.ValueOf(meta2["namespace_labels"]).Pointer())
+
+	// Shared fragments are not released
+	Release(meta1)
+	assert.Equal(t, mapstr.M{"nodekey": "nodevalue"}, meta2["node"].(mapstr.M)["labels"])
+
+	// Updates without changes keep the fragments
+	nodeHandler := fragments.NodeHandler(nil)
+	heartbeat := node.DeepCopy()
+	heartbeat.ResourceVersion = "2"
+	require.NoError(t, nodes.Update(heartbeat))
+	nodeHandler.OnUpdate(heartbeat)
+	assert.Equal(t, reflect.ValueOf(meta2["node"]).Pointer(), reflect.ValueOf(metagen.GenerateK8s(pod1)["node"]).Pointer())
+
+	// Updates with changes replace them, the replaced fragments are not released
+	meta3 := metagen.GenerateK8s(pod1)
+	relabeled := node.DeepCopy()
+	relabeled.ResourceVersion = "3"
+	relabeled.Labels["nodekey"] = "other"
+	require.NoError(t, nodes.Update(relabeled))
+	nodeHandler.OnUpdate(relabeled)
+	labels, err := metagen.GenerateK8s(pod1).GetValue("node.labels.nodekey")
+	require.NoError(t, err)
+	assert.Equal(t, "other", labels)
+	Release(meta3)
+	assert.Equal(t, "nodevalue", meta2["node"].(mapstr.M)["labels"].(mapstr.M)["nodekey"])
+
+	// Deleted namespaces, their fragments are not released
+	meta4 := metagen.GenerateK8s(pod1)
+	require.NoError(t, namespaces.Delete(namespace))
+	fragments.NamespaceHandler(nil).OnDelete(namespace)
+	assert.NotContains(t, metagen.GenerateK8s(pod1), "namespace_labels")
+	Release(meta4)
+	assert.Equal(t, mapstr.M{"nskey": "nsvalue"}, meta2["namespace_labels"])
+}
+
+// BenchmarkFragmentCacheParallel measures concurrent reads of the fragments of some nodes while
+// their watcher updates them
+func BenchmarkFragmentCacheParallel(b *testing.B) {
+	client := k8sfake.NewSimpleClientset()
+	cfg := config.NewConfig()
+	nodes := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	names := make([]string, 64)
+	for i := range names {
+		names[i] = fmt.Sprintf("node-%d", i)
+		require.NoError(b, nodes.Add(&v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: names[i], UID: types.UID(names[i]), Labels: map[string]string{"zone": "a"}},
+		}))
+	}
+	fragments := NewFragmentCache(nil, NewNodeMetadataGenerator(cfg, nodes, client))
+	handler := fragments.NodeHandler(nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			name := names[i%len(names)]
+			if i%1024 == 0 {
+				obj, _, _ := nodes.GetByKey(name)
+				handler.OnUpdate(obj)
+			}
+			fragments.Node(name)
+			i++
+		}
+	})
+}
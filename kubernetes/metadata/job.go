@@ -80,7 +80,7 @@ func (jb *job) GenerateFromName(name string, opts ...FieldOptions) mapstr.M {
 		return nil
 	}
 
-	if obj, ok, _ := jb.store.GetByKey(name); ok {
+	if obj, ok := storeLookup(jb.store, name); ok {
 		jobObj, ok := obj.(*kubernetes.Job)
 		if !ok {
 			return nil
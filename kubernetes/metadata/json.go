@@ -0,0 +1,422 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const hex = "0123456789abcdef"
+
+// AppendJSON appends the JSON encoding of generated metadata to dst, as encoded by json.Marshal,
+// without reflection for the maps, strings and other basic values of the generated metadata
+func AppendJSON(dst []byte, meta mapstr.M) ([]byte, error) {
+	return appendJSONValue(dst, meta)
+}
+
+// AppendK8sJSON appends the JSON encoding of the metadata GenerateK8s would return to dst, as
+// encoded by json.Marshal. The fields of the object are written directly, without generating the
+// intermediate maps of the metadata, for consumers that serialize the metadata immediately.
+func (r *Resource) AppendK8sJSON(dst []byte, kind string, obj kubernetes.Resource, opts ...FieldOptions) ([]byte, error) {
+	if len(opts) == 0 {
+		if out, ok := r.appendK8sJSON(dst, kind, obj); ok {
+			return out, nil
+		}
+	}
+	// Options can modify any field
+	generated := r.GenerateK8s(kind, obj, opts...)
+	out, err := appendJSONValue(dst, generated)
+	Release(generated)
+	return out, err
+}
+
+// jsonFieldType is the type of a top level field of the metadata of a resource
+type jsonFieldType int
+
+const (
+	jsonString     jsonFieldType = iota // str
+	jsonValue                           // value of another generator
+	jsonKind                            // name and uid of the resource
+	jsonController                      // name of a controller of the resource
+	jsonLabels                          // labels or annotations
+)
+
+// jsonField is a top level field of the metadata of a resource
+type jsonField struct {
+	typ    jsonFieldType
+	key    string
+	str    string
+	uid    string
+	value  interface{}
+	labels []jsonLabel
+	limit  valueLimit // of the values of labels
+}
+
+type jsonLabel struct {
+	key, value string
+}
+
+// appendK8sJSON appends the metadata of the resource to dst, or returns false if some fields
+// can't be written directly, like nested labels
+func (r *Resource) appendK8sJSON(dst []byte, kind string, obj kubernetes.Resource) ([]byte, bool) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return dst, false
+	}
+	kind = strings.ToLower(kind)
+
+	var buf [16]jsonField
+	fields := buf[:0]
+	fields = append(fields, jsonField{typ: jsonKind, key: kind, str: accessor.GetName(), uid: string(accessor.GetUID())})
+
+	var nsMeta mapstr.M
+	if namespaceName := accessor.GetNamespace(); namespaceName != "" {
+		namespaceField := len(fields)
+		fields = append(fields, jsonField{typ: jsonString, key: "namespace", str: namespaceName})
+		if r.namespace != nil {
+			nsMeta = r.namespace.GenerateFromName(interner.Intern(namespaceName))
+			if _, ok := r.namespace.(*namespace); ok {
+				defer Release(nsMeta)
+			}
+			for k, v := range nsMeta {
+				// The namespace of the namespace metadata replaces the namespace of the resource
+				if k == "namespace" {
+					fields[namespaceField] = jsonField{typ: jsonValue, key: k, value: v}
+					continue
+				}
+				fields = append(fields, jsonField{typ: jsonValue, key: k, value: v})
+			}
+		}
+	}
+
+	for _, ref := range accessor.GetOwnerReferences() {
+		if ref.Controller != nil && *ref.Controller {
+			if key, ok := controllerKinds[ref.Kind]; ok {
+				fields = setJSONField(fields, jsonField{typ: jsonController, key: key, str: ref.Name})
+			}
+		}
+	}
+
+	matchers := r.keyMatchers()
+	if !r.config.LabelsDedot && matchers.excludeLabels != nil {
+		// Excluded labels may exclude nested labels
+		return dst, false
+	}
+	includeLabels := matchers.includeLabels
+	if includeLabels.empty() {
+		includeLabels = nil
+	}
+	labels, ok := filterJSONLabels(accessor.GetLabels(), includeLabels, matchers.excludeLabels, r.config.LabelsDedot)
+	if !ok {
+		return dst, false
+	}
+	if len(labels) > 0 {
+		fields = append(fields, jsonField{typ: jsonLabels, key: "labels", labels: labels, limit: r.labelsLimit()})
+	}
+	if !matchers.includeAnnotations.empty() {
+		annotations, ok := filterJSONLabels(accessor.GetAnnotations(), matchers.includeAnnotations, nil, r.config.AnnotationsDedot)
+		if !ok {
+			return dst, false
+		}
+		if len(annotations) > 0 {
+			fields = append(fields, jsonField{typ: jsonLabels, key: "annotations", labels: annotations, limit: r.annotationsLimit()})
+		}
+	}
+
+	// Fields with the same keys would be merged in the generated metadata
+	sortJSONFields(fields)
+	for i := 1; i < len(fields); i++ {
+		if fields[i].key == fields[i-1].key {
+			return dst, false
+		}
+	}
+
+	start := len(dst)
+	dst = append(dst, '{')
+	for i, field := range fields {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = appendJSONString(dst, field.key)
+		dst = append(dst, ':')
+		switch field.typ {
+		case jsonKind:
+			dst = append(dst, `{"name":`...)
+			dst = appendJSONString(dst, field.str)
+			dst = append(dst, `,"uid":`...)
+			dst = appendJSONString(dst, field.uid)
+			dst = append(dst, '}')
+		case jsonController:
+			dst = append(dst, `{"name":`...)
+			dst = appendJSONString(dst, field.str)
+			dst = append(dst, '}')
+		case jsonLabels:
+			dst = append(dst, '{')
+			for j, label := range field.labels {
+				if j > 0 {
+					dst = append(dst, ',')
+				}
+				dst = appendJSONString(dst, label.key)
+				dst = append(dst, ':')
+				// Values are truncated when written, to count them once
+				dst = appendJSONString(dst, field.limit.truncate(label.value))
+			}
+			dst = append(dst, '}')
+		case jsonValue:
+			var err error
+			if dst, err = appendJSONValue(dst, field.value); err != nil {
+				return dst[:start], false
+			}
+		default:
+			dst = appendJSONString(dst, field.str)
+		}
+	}
+	return append(dst, '}'), true
+}
+
+// setJSONField sets a field, replacing a previous field of the same type with the same key
+func setJSONField(fields []jsonField, field jsonField) []jsonField {
+	for i := range fields {
+		if fields[i].key == field.key && fields[i].typ == field.typ {
+			fields[i] = field
+			return fields
+		}
+	}
+	return append(fields, field)
+}
+
+// sortJSONFields sorts the fields by key, as json.Marshal sorts the keys of maps. The fields are
+// few, an insertion sort doesn't allocate.
+func sortJSONFields(fields []jsonField) {
+	for i := 1; i < len(fields); i++ {
+		for j := i; j > 0 && fields[j].key < fields[j-1].key; j-- {
+			fields[j], fields[j-1] = fields[j-1], fields[j]
+		}
+	}
+}
+
+// filterJSONLabels returns the labels or annotations included and not excluded with their keys in
+// the metadata, sorted, or false if some of them would be nested
+func filterJSONLabels(input map[string]string, include, exclude *keyMatcher, dedot bool) ([]jsonLabel, bool) {
+	var labels []jsonLabel
+	add := func(key, value string) bool {
+		if dedot {
+			dedotted, nested := dedottedKeys.get(key)
+			if nested {
+				return false
+			}
+			key = dedotted
+		} else if strings.IndexByte(key, '.') >= 0 {
+			return false
+		}
+		if exclude != nil && exclude.Match(key) {
+			return true
+		}
+		if labels == nil {
+			labels = make([]jsonLabel, 0, len(input))
+		}
+		labels = append(labels, jsonLabel{key: key, value: value})
+		return true
+	}
+
+	if include != nil && !include.hasPatterns() {
+		for _, key := range include.keys {
+			if value, ok := input[key]; ok && !add(key, value) {
+				return nil, false
+			}
+		}
+	} else {
+		for k, v := range input {
+			if (include == nil || include.Match(k)) && !add(k, v) {
+				return nil, false
+			}
+		}
+	}
+
+	sort.Slice(labels, func(i, j int) bool { return labels[i].key < labels[j].key })
+	for i := 1; i < len(labels); i++ {
+		// Keys dedotted to the same key, only one of them is kept in the generated metadata
+		if labels[i].key == labels[i-1].key {
+			return nil, false
+		}
+	}
+	return labels, true
+}
+
+// appendJSONValue appends the JSON encoding of a value, as encoded by json.Marshal
+func appendJSONValue(dst []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(dst, "null"...), nil
+	case string:
+		return appendJSONString(dst, v), nil
+	case bool:
+		return strconv.AppendBool(dst, v), nil
+	case int:
+		return strconv.AppendInt(dst, int64(v), 10), nil
+	case int32:
+		return strconv.AppendInt(dst, int64(v), 10), nil
+	case int64:
+		return strconv.AppendInt(dst, v, 10), nil
+	case uint32:
+		return strconv.AppendUint(dst, uint64(v), 10), nil
+	case uint64:
+		return strconv.AppendUint(dst, v, 10), nil
+	case mapstr.M:
+		return appendJSONMap(dst, v)
+	case map[string]interface{}:
+		return appendJSONMap(dst, v)
+	case map[string]string:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		dst = append(dst, '{')
+		for i, k := range keys {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = appendJSONString(dst, k)
+			dst = append(dst, ':')
+			dst = appendJSONString(dst, v[k])
+		}
+		return append(dst, '}'), nil
+	case []string:
+		if v == nil {
+			return append(dst, "null"...), nil
+		}
+		dst = append(dst, '[')
+		for i, s := range v {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = appendJSONString(dst, s)
+		}
+		return append(dst, ']'), nil
+	case []interface{}:
+		if v == nil {
+			return append(dst, "null"...), nil
+		}
+		dst = append(dst, '[')
+		for i, item := range v {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			var err error
+			if dst, err = appendJSONValue(dst, item); err != nil {
+				return dst, err
+			}
+		}
+		return append(dst, ']'), nil
+	}
+
+	// Other values, like floats or structs, are encoded by encoding/json
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, encoded...), nil
+}
+
+func appendJSONMap(dst []byte, m map[string]interface{}) ([]byte, error) {
+	if m == nil {
+		return append(dst, "null"...), nil
+	}
+	var buf [16]string
+	keys := buf[:0]
+	for k := range m {
+		keys = append(keys, k)
+	}
+	if len(keys) > 1 {
+		sort.Strings(keys)
+	}
+	dst = append(dst, '{')
+	for i, k := range keys {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = appendJSONString(dst, k)
+		dst = append(dst, ':')
+		var err error
+		if dst, err = appendJSONValue(dst, m[k]); err != nil {
+			return dst, err
+		}
+	}
+	return append(dst, '}'), nil
+}
+
+// appendJSONString appends a quoted string, escaped as json.Marshal escapes it, including the
+// HTML characters. Control characters other than \n, \r and \t are escaped as \u00XX.
+func appendJSONString(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' && b != '<' && b != '>' && b != '&' {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch b {
+			case '\\', '"':
+				dst = append(dst, '\\', b)
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hex[b>>4], hex[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		c, size := utf8.DecodeRuneInString(s[i:])
+		if c == utf8.RuneError && size == 1 {
+			// Invalid UTF-8 is replaced by the replacement character
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		// Line and paragraph separators are escaped for JSONP
+		if c == '\u2028' || c == '\u2029' {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hex[c&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
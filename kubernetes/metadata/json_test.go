@@ -0,0 +1,229 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestAppendJSON(t *testing.T) {
+	meta := mapstr.M{
+		"kubernetes": mapstr.M{
+			"pod":    mapstr.M{"name": "web", "uid": uid, "ip": "10.0.0.5"},
+			"labels": mapstr.M{"app": "<web> & \"api\"", "line": "a\nb\tc ", "invalid": "\xff"},
+			"node":   map[string]interface{}{"name": "node-1", "ready": true, "cpu": 4, "load": 0.5},
+			"ports":  []interface{}{int64(80), uint64(443)},
+			"ips":    []string{"10.0.0.5"},
+			"none":   nil,
+			"empty":  mapstr.M{},
+		},
+		"selector": map[string]string{"b": "2", "a": "1"},
+	}
+	expected, err := json.Marshal(meta)
+	require.NoError(t, err)
+
+	encoded, err := AppendJSON([]byte("prefix "), meta)
+	require.NoError(t, err)
+	assert.Equal(t, "prefix "+string(expected), string(encoded))
+
+	_, err = AppendJSON(nil, mapstr.M{"invalid": make(chan int)})
+	assert.Error(t, err)
+}
+
+func TestAppendJSONStringControlCharacters(t *testing.T) {
+	assert.Equal(t, `"a\u0008b\u000cc\u0001\u001f\n\r\t"`, string(appendJSONString(nil, "a\bb\fc\x01\x1f\n\r\t")))
+}
+
+func TestResource_AppendK8sJSON(t *testing.T) {
+	boolean := true
+	namespaces := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	require.NoError(t, namespaces.Add(&v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        defaultNs,
+			UID:         types.UID(uid),
+			Labels:      map[string]string{"team": "web"},
+			Annotations: map[string]string{"owner": "team-a"},
+		},
+	}))
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web-7d9f8c6b5-x7k2p",
+			Namespace: defaultNs,
+			UID:       types.UID(uid),
+			Labels: map[string]string{
+				"app.kubernetes.io/name": "web",
+				"tier":                   "<frontend>",
+				"pod-template-hash":      "7d9f8c6b5",
+			},
+			Annotations: map[string]string{"prometheus.io/scrape": "true", "owner": "team-b"},
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "ReplicaSet", Name: "web-7d9f8c6b5", Controller: &boolean},
+				{Kind: "Node", Name: "node-1", Controller: &boolean},
+			},
+		},
+	}
+	unnamespaced := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", UID: types.UID(uid)}}
+
+	tests := []struct {
+		name   string
+		config map[string]interface{}
+		kind   string
+		obj    kubernetes.Resource
+		direct bool
+	}{
+		{
+			name:   "defaults",
+			config: map[string]interface{}{},
+			direct: true,
+		},
+		{
+			name: "filtered labels and annotations",
+			config: map[string]interface{}{
+				"include_labels":      []string{"app.kubernetes.io/*"},
+				"exclude_labels":      []string{"tier"},
+				"include_annotations": []string{"prometheus.io/scrape", "owner"},
+			},
+			direct: true,
+		},
+		{
+			name: "nested labels",
+			config: map[string]interface{}{
+				"labels.dedot":        false,
+				"include_annotations": []string{"prometheus.io/scrape"},
+			},
+		},
+		{
+			name: "nested labels with exclusions",
+			config: map[string]interface{}{
+				"labels.dedot":   false,
+				"exclude_labels": []string{"app"},
+			},
+		},
+		{
+			name:   "not namespaced",
+			config: map[string]interface{}{},
+			kind:   "node",
+			obj:    unnamespaced,
+			direct: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := config.NewConfigFrom(test.config)
+			require.NoError(t, err)
+			client := k8sfake.NewSimpleClientset()
+			metagen := NewNamespaceAwareResourceMetadataGenerator(cfg, client, NewNamespaceMetadataGenerator(cfg, namespaces, client))
+
+			kind, obj := "pod", kubernetes.Resource(pod)
+			if test.obj != nil {
+				kind, obj = test.kind, test.obj
+			}
+			expected, err := json.Marshal(metagen.GenerateK8s(kind, obj))
+			require.NoError(t, err)
+
+			encoded, err := metagen.AppendK8sJSON(nil, kind, obj)
+			require.NoError(t, err)
+			assert.Equal(t, string(expected), string(encoded))
+
+			_, direct := metagen.appendK8sJSON(nil, kind, obj)
+			assert.Equal(t, test.direct, direct)
+
+			view, err := json.Marshal(metagen.GenerateK8sView(kind, obj))
+			require.NoError(t, err)
+			assert.Equal(t, string(expected), string(view))
+
+			// Options are applied
+			encoded, err = metagen.AppendK8sJSON(nil, kind, obj, WithFields("foo", "bar"))
+			require.NoError(t, err)
+			assert.Contains(t, string(encoded), `"foo":"bar"`)
+		})
+	}
+}
+
+func BenchmarkResourceMarshalJSON(b *testing.B) {
+	metagen, pod := newBenchmarkResourceGenerator(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		meta := metagen.GenerateK8s("pod", pod)
+		if _, err := json.Marshal(meta); err != nil {
+			b.Fatal(err)
+		}
+		Release(meta)
+	}
+}
+
+func BenchmarkResourceAppendK8sJSON(b *testing.B) {
+	metagen, pod := newBenchmarkResourceGenerator(b)
+	var buf []byte
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		var err error
+		if buf, err = metagen.AppendK8sJSON(buf[:0], "pod", pod); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func newBenchmarkResourceGenerator(b *testing.B) (*Resource, *v1.Pod) {
+	cfg, err := config.NewConfigFrom(map[string]interface{}{
+		"include_annotations": []string{"prometheus.io/scrape"},
+	})
+	require.NoError(b, err)
+	namespaces := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	require.NoError(b, namespaces.Add(&v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: defaultNs, UID: types.UID(uid), Labels: map[string]string{"team": "web"}},
+	}))
+	client := k8sfake.NewSimpleClientset()
+	metagen := NewNamespaceAwareResourceMetadataGenerator(cfg, client, NewNamespaceMetadataGenerator(cfg, namespaces, client))
+
+	boolean := true
+	return metagen, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web-7d9f8c6b5-x7k2p",
+			Namespace: defaultNs,
+			UID:       types.UID(uid),
+			Labels: map[string]string{
+				"app.kubernetes.io/name":      "web",
+				"app.kubernetes.io/component": "frontend",
+				"pod-template-hash":           "7d9f8c6b5",
+				"tier":                        "web",
+			},
+			Annotations:     map[string]string{"prometheus.io/scrape": "true"},
+			OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web-7d9f8c6b5", Controller: &boolean}},
+		},
+	}
+}
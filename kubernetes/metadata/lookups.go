@@ -0,0 +1,63 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"sync/atomic"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+// LookupStats are the counters of the lookups of the related resources of the generated metadata,
+// like namespaces, nodes and owners
+type LookupStats struct {
+	// Lookups is the number of lookups of related resources in the stores of the watchers
+	Lookups uint64
+
+	// Misses is the number of related resources not found in the stores, they are not requested
+	// to the API server
+	Misses uint64
+
+	// SkippedAPILookups is the number of API requests skipped in large cluster mode
+	SkippedAPILookups uint64
+}
+
+var lookupCounters struct {
+	lookups atomic.Uint64
+	misses  atomic.Uint64
+	skipped atomic.Uint64
+}
+
+// Lookups returns the counters of the lookups of related resources of all the generators
+func Lookups() LookupStats {
+	return LookupStats{
+		Lookups:           lookupCounters.lookups.Load(),
+		Misses:            lookupCounters.misses.Load(),
+		SkippedAPILookups: lookupCounters.skipped.Load(),
+	}
+}
+
+// storeLookup looks up a related resource in the store of its watcher, counting the misses
+func storeLookup(store cache.Store, key string) (interface{}, bool) {
+	lookupCounters.lookups.Add(1)
+	obj, ok, _ := store.GetByKey(key)
+	if !ok {
+		lookupCounters.misses.Add(1)
+	}
+	return obj, ok
+}
@@ -0,0 +1,71 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+func TestLargeClusterMode(t *testing.T) {
+	t.Setenv("KUBECONFIG", "")
+	client := k8sfake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "kubeadm-config", Namespace: "kube-system"},
+		Data: map[string]string{
+			"ClusterConfiguration": "clusterName: devcluster\ncontrolPlaneEndpoint: 10.0.0.1:6443\n",
+		},
+	})
+
+	cfg := config.NewConfig()
+	clusterInfo, err := GetKubernetesClusterIdentifier(cfg, client)
+	require.NoError(t, err)
+	assert.Equal(t, ClusterInfo{URL: "10.0.0.1:6443", Name: "devcluster"}, clusterInfo)
+
+	// The kubeadm-config ConfigMap is not requested
+	before := Lookups()
+	largeCluster, err := config.NewConfigFrom(map[string]interface{}{"large_cluster": true})
+	require.NoError(t, err)
+	client.ClearActions()
+	_, err = GetKubernetesClusterIdentifier(largeCluster, client)
+	assert.Error(t, err)
+	assert.Empty(t, client.Actions())
+	assert.Equal(t, before.SkippedAPILookups+1, Lookups().SkippedAPILookups)
+
+	// Related resources are only looked up in the stores
+	namespaces := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	require.NoError(t, namespaces.Add(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: defaultNs}}))
+	metaCfg := GetLargeClusterResourceMetadataConfig()
+	nsMeta := NewNamespaceMetadataGenerator(metaCfg.Namespace, namespaces, client)
+	client.ClearActions()
+
+	before = Lookups()
+	assert.NotNil(t, nsMeta.GenerateFromName(defaultNs))
+	assert.Nil(t, nsMeta.GenerateFromName("unknown"))
+	assert.Empty(t, client.Actions())
+	after := Lookups()
+	assert.Equal(t, before.Lookups+2, after.Lookups)
+	assert.Equal(t, before.Misses+1, after.Misses)
+}
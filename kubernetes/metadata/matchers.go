@@ -0,0 +1,102 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/match"
+)
+
+// keyMatcher matches the keys of labels and annotations with the keys of the include and exclude
+// settings, compiled once per generator. Keys can have `*` wildcards, all the keys with wildcards
+// are compiled in a single matcher.
+type keyMatcher struct {
+	keys     []string // keys without wildcards, in configuration order
+	exact    map[string]struct{}
+	patterns *match.ExactMatcher
+}
+
+// compileKeyMatcher compiles a list of keys, possibly with wildcards
+func compileKeyMatcher(keys []string) *keyMatcher {
+	m := &keyMatcher{exact: make(map[string]struct{}, len(keys))}
+	var patterns []string
+	for _, key := range keys {
+		if !strings.Contains(key, "*") {
+			if _, found := m.exact[key]; !found {
+				m.keys = append(m.keys, key)
+				m.exact[key] = struct{}{}
+			}
+			continue
+		}
+		parts := strings.Split(key, "*")
+		for i := range parts {
+			parts[i] = regexp.QuoteMeta(parts[i])
+		}
+		patterns = append(patterns, strings.Join(parts, ".*"))
+	}
+	if len(patterns) > 0 {
+		// Patterns are quoted, they always compile
+		patterns := match.MustCompileExact("^(?:" + strings.Join(patterns, "|") + ")$")
+		m.patterns = &patterns
+	}
+	return m
+}
+
+// empty returns true if no key can match
+func (m *keyMatcher) empty() bool {
+	return m == nil || (len(m.keys) == 0 && m.patterns == nil)
+}
+
+// hasPatterns returns true if some keys have wildcards
+func (m *keyMatcher) hasPatterns() bool {
+	return m != nil && m.patterns != nil
+}
+
+// Match returns true if the key is one of the keys or matches one of the patterns
+func (m *keyMatcher) Match(key string) bool {
+	if m == nil {
+		return false
+	}
+	if _, found := m.exact[key]; found {
+		return true
+	}
+	return m.patterns != nil && m.patterns.MatchString(key)
+}
+
+// resourceMatchers are the compiled keys of the config of a resource generator
+type resourceMatchers struct {
+	includeLabels      *keyMatcher
+	excludeLabels      *keyMatcher // nil if no label is excluded
+	includeAnnotations *keyMatcher
+}
+
+// keyMatchers returns the compiled keys of the config of the generator, compiled the first time
+// they are used
+func (r *Resource) keyMatchers() *resourceMatchers {
+	r.matchersOnce.Do(func() {
+		r.matchers.includeLabels = compileKeyMatcher(r.config.IncludeLabels)
+		r.matchers.excludeLabels = compileKeyMatcher(r.config.ExcludeLabels)
+		r.matchers.includeAnnotations = compileKeyMatcher(r.config.IncludeAnnotations)
+		if r.matchers.excludeLabels.empty() {
+			r.matchers.excludeLabels = nil
+		}
+	})
+	return &r.matchers
+}
@@ -0,0 +1,108 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestKeyMatcher(t *testing.T) {
+	m := compileKeyMatcher([]string{"app", "app.kubernetes.io/*", "*.example.com/team", "app"})
+	assert.Equal(t, []string{"app"}, m.keys)
+	assert.True(t, m.hasPatterns())
+
+	for key, matches := range map[string]bool{
+		"app":                         true,
+		"app.kubernetes.io/name":      true,
+		"app.kubernetes.io/":          true,
+		"corp.example.com/team":       true,
+		"tier":                        false,
+		"appXkubernetes.io/name":      false,
+		"my.app.kubernetes.io/name":   false,
+		"corp.example.com/team-owner": false,
+	} {
+		assert.Equal(t, matches, m.Match(key), key)
+	}
+
+	m = compileKeyMatcher(nil)
+	assert.True(t, m.empty())
+	assert.False(t, m.Match("app"))
+}
+
+func TestResource_GenerateWithKeyPatterns(t *testing.T) {
+	cfg, err := config.NewConfigFrom(map[string]interface{}{
+		"include_labels":      []string{"app.kubernetes.io/*", "tier"},
+		"exclude_labels":      []string{"*/instance"},
+		"include_annotations": []string{"prometheus.io/*"},
+	})
+	require.NoError(t, err)
+	metagen := NewResourceMetadataGenerator(cfg, k8sfake.NewSimpleClientset())
+	require.NotNil(t, metagen)
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web",
+			Namespace: defaultNs,
+			UID:       types.UID(uid),
+			Labels: map[string]string{
+				"app.kubernetes.io/name":     "web",
+				"app.kubernetes.io/instance": "web-1",
+				"tier":                       "frontend",
+				"pod-template-hash":          "7d9f8c6b5",
+			},
+			Annotations: map[string]string{
+				"prometheus.io/scrape": "true",
+				"prometheus.io/port":   "9090",
+				"owner":                "team-a",
+			},
+		},
+	}
+
+	meta := metagen.GenerateK8s("pod", pod)
+	assert.Equal(t, mapstr.M{
+		"app_kubernetes_io/name": "web",
+		"tier":                   "frontend",
+	}, meta["labels"])
+	assert.Equal(t, mapstr.M{
+		"prometheus_io/scrape": "true",
+		"prometheus_io/port":   "9090",
+	}, meta["annotations"])
+
+	// The view uses the same matchers
+	view := metagen.GenerateK8sView("pod", pod)
+	value, err := view.GetValue("labels.tier")
+	require.NoError(t, err)
+	assert.Equal(t, "frontend", value)
+	_, err = view.GetValue("labels.app_kubernetes_io/instance")
+	assert.Error(t, err)
+	value, err = view.GetValue("annotations.prometheus_io/port")
+	require.NoError(t, err)
+	assert.Equal(t, "9090", value)
+	_, err = view.GetValue("annotations.owner")
+	assert.Error(t, err)
+}
@@ -134,6 +134,10 @@ func GetKubernetesClusterIdentifier(cfg *config.C, client k8sclient.Interface) (
 	if err == nil {
 		return clusterInfo, nil
 	}
+	if c.LargeCluster {
+		lookupCounters.skipped.Add(1)
+		return ClusterInfo{}, fmt.Errorf("unable to retrieve cluster identifiers from kube config, kubeadm-config is not requested in large cluster mode")
+	}
 	// try with kubeadm-config configmap
 	clusterInfo, err = getClusterInfoFromKubeadmConfigMap(client)
 	if err == nil {
@@ -0,0 +1,199 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadatatest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes/metadata"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// UpdateEnv is the environment variable updating the golden files when set to true, like the
+// -metadatatest.update flag, for the packages of a run that don't define the flag
+const UpdateEnv = "METADATATEST_UPDATE"
+
+var update = flag.Bool("metadatatest.update", false, "update the golden files of generated metadata")
+
+// diffContext is the number of unchanged lines around the changed lines of diffs
+const diffContext = 3
+
+// RenderJSON renders metadata as canonical JSON, with the values of metadata.Canonical, sorted
+// keys and an indentation of two spaces, so that renderings of the same metadata are equal
+func RenderJSON(meta mapstr.M) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(metadata.Canonical(meta)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GoldenPath returns the path of the golden file of a test, named after the test in the
+// testdata directory
+func GoldenPath(t testing.TB) string {
+	return filepath.Join("testdata", strings.ReplaceAll(t.Name(), "/", "_")+".golden.json")
+}
+
+// AssertGolden compares metadata rendered with RenderJSON with a golden file, and fails the
+// test with a diff between them if they are different. Golden files are written instead, when
+// the tests run with the -metadatatest.update flag or the UpdateEnv environment variable.
+func AssertGolden(t testing.TB, path string, meta mapstr.M) bool {
+	t.Helper()
+	rendered, err := RenderJSON(meta)
+	if err != nil {
+		t.Errorf("unable to render metadata: %v", err)
+		return false
+	}
+
+	if updating() {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Errorf("unable to create the directory of golden file %s: %v", path, err)
+			return false
+		}
+		if err := os.WriteFile(path, rendered, 0644); err != nil {
+			t.Errorf("unable to update golden file %s: %v", path, err)
+			return false
+		}
+		t.Logf("updated golden file %s", path)
+		return true
+	}
+
+	golden, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		t.Errorf("golden file %s not found, run the tests with -metadatatest.update to create it, generated metadata:\n%s", path, rendered)
+		return false
+	}
+	if err != nil {
+		t.Errorf("unable to read golden file %s: %v", path, err)
+		return false
+	}
+	if bytes.Equal(golden, rendered) {
+		return true
+	}
+	t.Errorf("generated metadata differs from golden file %s (-golden +generated), run the tests with -metadatatest.update to update it:\n%s", path, Diff(string(golden), string(rendered)))
+	return false
+}
+
+func updating() bool {
+	if *update {
+		return true
+	}
+	value := strings.ToLower(os.Getenv(UpdateEnv))
+	return value == "true" || value == "1"
+}
+
+// Diff returns a line diff of two texts, with the removed lines prefixed with "-", the added
+// lines prefixed with "+", and the unchanged lines around them, or "" if they are equal
+func Diff(a, b string) string {
+	if a == b {
+		return ""
+	}
+	aLines := splitLines(a)
+	bLines := splitLines(b)
+
+	// Lengths of the longest common subsequences of the suffixes of the lines
+	lcs := make([][]int, len(aLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bLines)+1)
+	}
+	for i := len(aLines) - 1; i >= 0; i-- {
+		for j := len(bLines) - 1; j >= 0; j-- {
+			switch {
+			case aLines[i] == bLines[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	type line struct {
+		op   byte
+		text string
+	}
+	var lines []line
+	i, j := 0, 0
+	for i < len(aLines) || j < len(bLines) {
+		switch {
+		case i < len(aLines) && j < len(bLines) && aLines[i] == bLines[j]:
+			lines = append(lines, line{' ', aLines[i]})
+			i++
+			j++
+		case j >= len(bLines) || (i < len(aLines) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, line{'-', aLines[i]})
+			i++
+		default:
+			lines = append(lines, line{'+', bLines[j]})
+			j++
+		}
+	}
+
+	// Unchanged lines are only kept around the changed ones
+	var out strings.Builder
+	skipped := false
+	for k, l := range lines {
+		if l.op == ' ' && !changedAround(k, len(lines), func(n int) bool { return lines[n].op != ' ' }) {
+			skipped = true
+			continue
+		}
+		if skipped {
+			out.WriteString("  ...\n")
+			skipped = false
+		}
+		text := l.text
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		fmt.Fprintf(&out, "%c %s", l.op, text)
+	}
+	if skipped {
+		out.WriteString("  ...\n")
+	}
+	return out.String()
+}
+
+// splitLines splits a text in lines, keeping their line breaks
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// changedAround returns true if a line is at most diffContext lines away from a changed line
+func changedAround(k, n int, changed func(int) bool) bool {
+	for d := k - diffContext; d <= k+diffContext; d++ {
+		if d >= 0 && d < n && changed(d) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadatatest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes/kubernetestest"
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes/metadata"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestRenderJSON(t *testing.T) {
+	a, err := RenderJSON(mapstr.M{"b": 1, "a": map[string]interface{}{"html": "<b>"}})
+	require.NoError(t, err)
+	b, err := RenderJSON(mapstr.M{"a": mapstr.M{"html": "<b>"}, "b": int64(1)})
+	require.NoError(t, err)
+	assert.Equal(t, "{\n  \"a\": {\n    \"html\": \"<b>\"\n  },\n  \"b\": 1\n}\n", string(a))
+	assert.Equal(t, a, b)
+}
+
+func TestDiff(t *testing.T) {
+	assert.Equal(t, "", Diff("a\n", "a\n"))
+
+	var a, b []string
+	for i := 0; i < 20; i++ {
+		a = append(a, fmt.Sprint(i))
+		b = append(b, fmt.Sprint(i))
+	}
+	b[10] = "ten"
+	b = append(b[:15], b[16:]...)
+	assert.Equal(t, strings.Join([]string{
+		"  ...",
+		"  7",
+		"  8",
+		"  9",
+		"- 10",
+		"+ ten",
+		"  11",
+		"  12",
+		"  13",
+		"  14",
+		"- 15",
+		"  16",
+		"  17",
+		"  18",
+		"  ...",
+		"",
+	}, "\n"), Diff(strings.Join(a, "\n")+"\n", strings.Join(b, "\n")+"\n"))
+}
+
+// recorder records the errors of a test
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Logf(string, ...interface{}) {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertGolden(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "testdata", "meta.golden.json")
+	meta := mapstr.M{"pod": mapstr.M{"name": "web"}, "labels": mapstr.M{"app": "web"}}
+
+	// Missing golden files fail
+	r := &recorder{TB: t}
+	assert.False(t, AssertGolden(r, path, meta))
+	require.Len(t, r.errors, 1)
+	assert.Contains(t, r.errors[0], "not found")
+
+	t.Setenv(UpdateEnv, "true")
+	assert.True(t, AssertGolden(t, path, meta))
+	t.Setenv(UpdateEnv, "")
+	assert.True(t, AssertGolden(t, path, meta))
+
+	r = &recorder{TB: t}
+	meta.Put("labels.app", "db")
+	assert.False(t, AssertGolden(r, path, meta))
+	require.Len(t, r.errors, 1)
+	assert.Contains(t, r.errors[0], "-     \"app\": \"web\"\n+     \"app\": \"db\"\n")
+
+	golden, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(golden), `"app": "web"`)
+}
+
+func TestGoldenPodMetadata(t *testing.T) {
+	pod := kubernetestest.Pod("default", "web",
+		kubernetestest.WithLabels(map[string]string{"app.kubernetes.io/name": "web", "tier": "frontend"}),
+		kubernetestest.WithAnnotations(map[string]string{"prometheus.io/scrape": "true"}),
+		kubernetestest.WithOwner("apps/v1", "ReplicaSet", "web-7d9f8c6b5"),
+	)
+	pods := kubernetestest.NewWatcher(nil, kubernetestest.Added(pod))
+	require.NoError(t, pods.Start())
+
+	for name, settings := range map[string]map[string]interface{}{
+		"defaults": {},
+		"filtered": {
+			"include_labels":      []string{"app.kubernetes.io/*"},
+			"include_annotations": []string{"prometheus.io/scrape"},
+		},
+		"not dedotted": {
+			"labels.dedot":        false,
+			"include_annotations": []string{"prometheus.io/scrape"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := config.NewConfigFrom(settings)
+			require.NoError(t, err)
+			metaGen := metadata.NewPodMetadataGenerator(cfg, pods.Store(), pods.Client(), nil, nil, nil, nil, metadata.GetDefaultResourceMetadataConfig())
+			AssertGolden(t, GoldenPath(t), metaGen.Generate(pod))
+		})
+	}
+}
@@ -0,0 +1,185 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package metadatatest provides a fake metadata.MetaGen, to unit test the enrichment of events
+// with the metadata of Kubernetes resources without the generators of the metadata package, and
+// AssertGolden, to compare the metadata of the generators with golden files:
+//
+//	watcher := kubernetestest.NewWatcher(nil, kubernetestest.Added(pod))
+//	metagen := &metadatatest.MetaGen{K8sFunc: metadatatest.Basic("pod"), Store: watcher.Store()}
+//	metagen.GenerateFromName("default/web") // {"pod": {"name": "web", "uid": ...}, "namespace": "default"}
+package metadatatest
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes/metadata"
+	"github.com/elastic/elastic-agent-autodiscover/utils"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// Methods of metadata.MetaGen recorded in the calls of a MetaGen
+const (
+	Generate         = "Generate"
+	GenerateFromName = "GenerateFromName"
+	GenerateK8s      = "GenerateK8s"
+	GenerateECS      = "GenerateECS"
+)
+
+// Call is a call to a method of a MetaGen
+type Call struct {
+	Method string
+	// Obj is the resource of the call, or the resource found by name of GenerateFromName calls
+	Obj kubernetes.Resource
+	// Name is the name of GenerateFromName calls
+	Name string
+}
+
+// MetaGen is a fake metadata.MetaGen generating metadata with functions, and recording its calls.
+// The zero value generates no metadata.
+type MetaGen struct {
+	// K8sFunc generates the kubernetes metadata of a resource, the field options are applied to
+	// it, GenerateK8s returns nil if nil
+	K8sFunc func(obj kubernetes.Resource) mapstr.M
+
+	// ECSFunc generates the ECS metadata of a resource, GenerateECS returns nil if nil
+	ECSFunc func(obj kubernetes.Resource) mapstr.M
+
+	// Store has the resources of GenerateFromName by key, like the stores of watchers,
+	// GenerateFromName returns nil if nil
+	Store cache.Store
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+// Generate generates the kubernetes metadata under the kubernetes key, and the ECS metadata
+func (m *MetaGen) Generate(obj kubernetes.Resource, opts ...metadata.FieldOptions) mapstr.M {
+	m.record(Call{Method: Generate, Obj: obj})
+	out := mapstr.M{}
+	if k8sMeta := m.generateK8s(obj, opts); k8sMeta != nil {
+		out["kubernetes"] = k8sMeta
+	}
+	if m.ECSFunc != nil {
+		out.DeepUpdate(m.ECSFunc(obj))
+	}
+	return out
+}
+
+// GenerateFromName generates the kubernetes metadata of a resource of the store
+func (m *MetaGen) GenerateFromName(name string, opts ...metadata.FieldOptions) mapstr.M {
+	var obj kubernetes.Resource
+	if m.Store != nil {
+		if found, ok, _ := m.Store.GetByKey(name); ok {
+			obj, _ = found.(kubernetes.Resource)
+		}
+	}
+	m.record(Call{Method: GenerateFromName, Obj: obj, Name: name})
+	if obj == nil {
+		return nil
+	}
+	return m.generateK8s(obj, opts)
+}
+
+// GenerateK8s generates the kubernetes metadata of a resource
+func (m *MetaGen) GenerateK8s(obj kubernetes.Resource, opts ...metadata.FieldOptions) mapstr.M {
+	m.record(Call{Method: GenerateK8s, Obj: obj})
+	return m.generateK8s(obj, opts)
+}
+
+// GenerateECS generates the ECS metadata of a resource
+func (m *MetaGen) GenerateECS(obj kubernetes.Resource) mapstr.M {
+	m.record(Call{Method: GenerateECS, Obj: obj})
+	if m.ECSFunc == nil {
+		return nil
+	}
+	return m.ECSFunc(obj)
+}
+
+// Calls returns the calls to the methods of the generator, in order
+func (m *MetaGen) Calls() []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Call(nil), m.calls...)
+}
+
+// Reset forgets the recorded calls
+func (m *MetaGen) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = nil
+}
+
+func (m *MetaGen) generateK8s(obj kubernetes.Resource, opts []metadata.FieldOptions) mapstr.M {
+	if m.K8sFunc == nil {
+		return nil
+	}
+	meta := m.K8sFunc(obj)
+	if meta == nil {
+		return nil
+	}
+	for _, opt := range opts {
+		opt(meta)
+	}
+	return meta
+}
+
+func (m *MetaGen) record(call Call) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, call)
+}
+
+// Static returns a K8sFunc generating copies of the same metadata for every resource
+func Static(meta mapstr.M) func(kubernetes.Resource) mapstr.M {
+	return func(kubernetes.Resource) mapstr.M {
+		return meta.Clone()
+	}
+}
+
+// Basic returns a K8sFunc generating the name and UID of resources of a kind, and their namespace
+// and labels with dedotted keys, as the generators of the metadata package do with the default
+// config
+func Basic(kind string) func(kubernetes.Resource) mapstr.M {
+	return func(obj kubernetes.Resource) mapstr.M {
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return nil
+		}
+		out := mapstr.M{
+			kind: mapstr.M{
+				"name": accessor.GetName(),
+				"uid":  string(accessor.GetUID()),
+			},
+		}
+		if namespace := accessor.GetNamespace(); namespace != "" {
+			out["namespace"] = namespace
+		}
+		if labels := accessor.GetLabels(); len(labels) > 0 {
+			labelsMeta := make(mapstr.M, len(labels))
+			for k, v := range labels {
+				labelsMeta[utils.DeDot(k)] = v
+			}
+			out["labels"] = labelsMeta
+		}
+		return out
+	}
+}
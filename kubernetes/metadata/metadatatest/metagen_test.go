@@ -0,0 +1,94 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadatatest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes/kubernetestest"
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes/metadata"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestMetaGen(t *testing.T) {
+	pod := kubernetestest.Pod("default", "web", kubernetestest.WithLabels(map[string]string{"app.kubernetes.io/name": "web"}))
+	watcher := kubernetestest.NewWatcher(nil, kubernetestest.Added(pod))
+	require.NoError(t, watcher.Start())
+
+	var metagen metadata.MetaGen = &MetaGen{
+		K8sFunc: Basic("pod"),
+		ECSFunc: Static(mapstr.M{"orchestrator": mapstr.M{"type": "kubernetes"}}),
+		Store:   watcher.Store(),
+	}
+	expected := mapstr.M{
+		"pod":       mapstr.M{"name": "web", "uid": string(pod.UID)},
+		"namespace": "default",
+		"labels":    mapstr.M{"app_kubernetes_io/name": "web"},
+	}
+
+	assert.Equal(t, expected, metagen.GenerateK8s(pod))
+	assert.Equal(t, mapstr.M{
+		"kubernetes":   expected,
+		"orchestrator": mapstr.M{"type": "kubernetes"},
+	}, metagen.Generate(pod))
+	assert.Equal(t, expected, metagen.GenerateFromName("default/web"))
+	assert.Nil(t, metagen.GenerateFromName("default/unknown"))
+
+	// Field options are applied to the kubernetes metadata
+	withNode := metagen.GenerateK8s(pod, func(m mapstr.M) { m["node"] = mapstr.M{"name": "node-1"} })
+	assert.Equal(t, mapstr.M{"name": "node-1"}, withNode["node"])
+
+	fake := metagen.(*MetaGen)
+	assert.Equal(t, []Call{
+		{Method: GenerateK8s, Obj: pod},
+		{Method: Generate, Obj: pod},
+		{Method: GenerateFromName, Obj: pod, Name: "default/web"},
+		{Method: GenerateFromName, Name: "default/unknown"},
+		{Method: GenerateK8s, Obj: pod},
+	}, fake.Calls())
+	fake.Reset()
+	assert.Empty(t, fake.Calls())
+}
+
+func TestMetaGenZeroValue(t *testing.T) {
+	var metagen MetaGen
+	pod := kubernetestest.Pod("default", "web")
+	assert.Nil(t, metagen.GenerateK8s(pod))
+	assert.Nil(t, metagen.GenerateECS(pod))
+	assert.Nil(t, metagen.GenerateFromName("default/web"))
+	assert.Equal(t, mapstr.M{}, metagen.Generate(pod))
+}
+
+func TestMetaGenAsRelatedGenerator(t *testing.T) {
+	pod := kubernetestest.Pod("default", "web")
+	pods := kubernetestest.NewWatcher(nil, kubernetestest.Added(pod))
+	require.NoError(t, pods.Start())
+
+	node := &MetaGen{K8sFunc: Static(mapstr.M{"node": mapstr.M{"name": kubernetestest.DefaultNode}})}
+	metagen := metadata.NewPodMetadataGenerator(config.NewConfig(), pods.Store(), pods.Client(), node, nil, nil, nil, metadata.GetDefaultResourceMetadataConfig())
+
+	meta := metagen.GenerateK8s(pod)
+	name, err := meta.GetValue("node.name")
+	require.NoError(t, err)
+	assert.Equal(t, kubernetestest.DefaultNode, name)
+	assert.NotEmpty(t, node.Calls())
+}
@@ -83,7 +83,7 @@ func (n *namespace) GenerateFromName(name string, opts ...FieldOptions) mapstr.M
 		return nil
 	}
 
-	if obj, ok, _ := n.store.GetByKey(name); ok {
+	if obj, ok := storeLookup(n.store, name); ok {
 		no, ok := obj.(*kubernetes.Namespace)
 		if !ok {
 			return nil
@@ -96,35 +96,32 @@ func (n *namespace) GenerateFromName(name string, opts ...FieldOptions) mapstr.M
 }
 
 func flattenMetadata(in mapstr.M) mapstr.M {
-	out := mapstr.M{}
-	rawFields, err := in.GetValue(resource)
-	if err != nil {
-		return nil
-	}
-
-	fields, ok := rawFields.(mapstr.M)
+	fields, ok := in[resource].(mapstr.M)
 	if !ok {
 		return nil
 	}
+
+	out := newMap()
 	for k, v := range fields {
-		if k == "name" {
+		switch k {
+		case "name":
 			out[resource] = v
-		} else {
+		case "uid":
+			out[resource+"_uid"] = v
+		default:
 			out[resource+"_"+k] = v
 		}
 	}
 
-	populateFromKeys := []string{"labels", "annotations"}
-	for _, key := range populateFromKeys {
-		rawValues, err := in.GetValue(key)
-		if err != nil {
-			continue
-		}
-		values, ok := rawValues.(mapstr.M)
-		if ok {
-			out[resource+"_"+key] = values
-		}
+	if labels, ok := in["labels"].(mapstr.M); ok {
+		out[resource+"_labels"] = labels
+	}
+	if annotations, ok := in["annotations"].(mapstr.M); ok {
+		out[resource+"_annotations"] = annotations
 	}
 
+	// Values and nested maps have been moved to out
+	releaseMap(fields)
+	releaseMap(in)
 	return out
 }
@@ -84,7 +84,7 @@ func (n *node) GenerateFromName(name string, opts ...FieldOptions) mapstr.M {
 		return nil
 	}
 
-	if obj, ok, _ := n.store.GetByKey(name); ok {
+	if obj, ok := storeLookup(n.store, name); ok {
 		no, ok := obj.(*kubernetes.Node)
 		if !ok {
 			return nil
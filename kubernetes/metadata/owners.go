@@ -0,0 +1,129 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"sync"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+)
+
+// maxUnknownOwners is the maximum number of pods with unknown owners kept to retry them
+const maxUnknownOwners = 10000
+
+// unknownOwners keeps the pods whose replicaset or job was not found when generating their
+// metadata, because the owner is not in the store yet, e.g. the store is not synced, so that
+// their metadata can be generated again once it is
+type unknownOwners struct {
+	sync.Mutex
+	pods  map[string]map[string]*kubernetes.Pod // owner kind/namespace/name -> pod name -> pod
+	count int
+}
+
+func newUnknownOwners() *unknownOwners {
+	return &unknownOwners{pods: make(map[string]map[string]*kubernetes.Pod)}
+}
+
+// add keeps a pod whose owner of the given kind was not found
+func (u *unknownOwners) add(kind, owner string, pod *kubernetes.Pod) {
+	key := kind + "/" + owner
+	u.Lock()
+	defer u.Unlock()
+
+	pods, ok := u.pods[key]
+	if !ok {
+		if u.count >= maxUnknownOwners {
+			return
+		}
+		pods = make(map[string]*kubernetes.Pod)
+		u.pods[key] = pods
+	}
+	if _, ok := pods[pod.Name]; !ok {
+		if u.count >= maxUnknownOwners {
+			return
+		}
+		u.count++
+	}
+	pods[pod.Name] = pod
+}
+
+// take returns and forgets the pods waiting for an owner
+func (u *unknownOwners) take(kind, owner string) []*kubernetes.Pod {
+	key := kind + "/" + owner
+	u.Lock()
+	defer u.Unlock()
+
+	pods := u.pods[key]
+	if len(pods) == 0 {
+		return nil
+	}
+	delete(u.pods, key)
+	u.count -= len(pods)
+
+	taken := make([]*kubernetes.Pod, 0, len(pods))
+	for _, pod := range pods {
+		taken = append(taken, pod)
+	}
+	return taken
+}
+
+// RetryUnknownOwners wraps the handler of the watcher of replicasets or jobs. When a replicaset
+// or a job is added to its store, retry is called with the pods whose metadata was generated by
+// the pod metagen without deployment or cronjob because their owner was not found yet, e.g. as
+// the store was not synced, so their metadata can be generated again. Cached pod metadata is
+// invalidated before retrying. Nothing is retried if gen is not a pod metagen.
+func RetryUnknownOwners(gen MetaGen, next kubernetes.ResourceEventHandler, retry func(pod *kubernetes.Pod)) kubernetes.ResourceEventHandler {
+	if next == nil {
+		next = kubernetes.NoOpEventHandlerFuncs{}
+	}
+	cached, _ := gen.(*cachedMetaGen)
+	if cached != nil {
+		gen = cached.MetaGen
+	}
+	p, ok := gen.(*pod)
+	if !ok {
+		return next
+	}
+
+	resolved := func(obj interface{}) {
+		var pods []*kubernetes.Pod
+		switch owner := obj.(type) {
+		case *kubernetes.ReplicaSet:
+			pods = p.unknownOwners.take("replicaset", owner.Namespace+"/"+owner.Name)
+		case *kubernetes.Job:
+			pods = p.unknownOwners.take("job", owner.Namespace+"/"+owner.Name)
+		}
+		for _, pod := range pods {
+			if cached != nil {
+				cached.Invalidate(pod)
+			}
+			retry(pod)
+		}
+	}
+	return kubernetes.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			next.OnAdd(obj)
+			resolved(obj)
+		},
+		UpdateFunc: func(obj interface{}) {
+			next.OnUpdate(obj)
+			resolved(obj)
+		},
+		DeleteFunc: next.OnDelete,
+	}
+}
@@ -0,0 +1,127 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+func TestPodUnknownOwners(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	controller := true
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			UID:       types.UID(uid),
+			Namespace: defaultNs,
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps", Kind: "ReplicaSet", Name: "nginx-rs", Controller: &controller},
+			},
+		},
+	}
+	replicaset := func(owners ...metav1.OwnerReference) *appsv1.ReplicaSet {
+		return &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+			Name:            "nginx-rs",
+			UID:             types.UID(uid),
+			Namespace:       defaultNs,
+			OwnerReferences: owners,
+		}}
+	}
+
+	cfg, err := config.NewConfigFrom(map[string]interface{}{})
+	require.NoError(t, err)
+	replicaSets := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	podGen := NewPodMetadataGenerator(cfg, nil, client, nil, nil, NewReplicasetMetadataGenerator(cfg, replicaSets, client), nil, addResourceMetadata)
+	metagen, err := NewCachedMetadataGenerator(podGen, time.Minute)
+	require.NoError(t, err)
+
+	// Replicaset store is not synced, the owner is unknown
+	meta := metagen.GenerateK8s(pod)
+	assert.Equal(t, "nginx-rs", getNested(meta, "replicaset", "name"))
+	assert.NotContains(t, meta, "deployment")
+
+	var retried []*kubernetes.Pod
+	var added []interface{}
+	handler := RetryUnknownOwners(metagen, kubernetes.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) { added = append(added, obj) },
+	}, func(pod *kubernetes.Pod) {
+		retried = append(retried, pod)
+	})
+
+	rs := replicaset(metav1.OwnerReference{APIVersion: "apps", Kind: "Deployment", Name: "nginx", Controller: &controller})
+	require.NoError(t, replicaSets.Add(rs))
+	handler.OnAdd(rs)
+	assert.Equal(t, []interface{}{rs}, added)
+	require.Equal(t, []*kubernetes.Pod{pod}, retried)
+	assert.Equal(t, "nginx", getNested(metagen.GenerateK8s(pod), "deployment", "name"))
+
+	// Pods are retried once
+	handler.OnUpdate(rs)
+	assert.Len(t, retried, 1)
+}
+
+func TestPodOrphanedReplicaSet(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	controller := true
+	po := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			UID:       types.UID(uid),
+			Namespace: defaultNs,
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps", Kind: "ReplicaSet", Name: "nginx-rs", Controller: &controller},
+			},
+		},
+	}
+
+	cfg, err := config.NewConfigFrom(map[string]interface{}{})
+	require.NoError(t, err)
+	replicaSets := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	require.NoError(t, replicaSets.Add(&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "nginx-rs", Namespace: defaultNs}}))
+	metagen := NewPodMetadataGenerator(cfg, nil, client, nil, nil, NewReplicasetMetadataGenerator(cfg, replicaSets, client), nil, addResourceMetadata)
+
+	meta := metagen.GenerateK8s(po)
+	assert.Equal(t, "nginx-rs", getNested(meta, "replicaset", "name"))
+	assert.NotContains(t, meta, "deployment")
+	assert.Empty(t, metagen.(*pod).unknownOwners.pods)
+}
+
+func TestUnknownOwnersLimit(t *testing.T) {
+	owners := newUnknownOwners()
+	for i := 0; i < maxUnknownOwners+10; i++ {
+		owners.add("replicaset", "ns/rs", &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprint("pod-", i)}})
+	}
+	assert.Equal(t, maxUnknownOwners, owners.count)
+	assert.Len(t, owners.take("replicaset", "ns/rs"), maxUnknownOwners)
+	assert.Equal(t, 0, owners.count)
+	assert.Nil(t, owners.take("replicaset", "ns/rs"))
+}
@@ -32,8 +32,10 @@ type pod struct {
 	node                MetaGen
 	replicaset          MetaGen
 	job                 MetaGen
+	fragments           *FragmentCache
 	resource            *Resource
 	addResourceMetadata *AddResourceMetadataConfig
+	unknownOwners       *unknownOwners
 }
 
 // NewPodMetadataGenerator creates a metagen for pod resources
@@ -55,6 +57,36 @@ func NewPodMetadataGenerator(
 		job:                 job,
 		client:              client,
 		addResourceMetadata: addResourceMetadata,
+		unknownOwners:       newUnknownOwners(),
+	}
+}
+
+// NewPodMetadataGeneratorWithFragments creates a metagen for pod resources composing the shared
+// namespace and node metadata of a FragmentCache, see FragmentCache for the restrictions on the
+// generated metadata
+func NewPodMetadataGeneratorWithFragments(
+	cfg *config.C,
+	pods cache.Store,
+	client k8s.Interface,
+	fragments *FragmentCache,
+	replicaset MetaGen,
+	job MetaGen,
+	addResourceMetadata *AddResourceMetadataConfig) MetaGen {
+
+	var namespace MetaGen
+	if fragments.namespace != nil {
+		namespace = &namespaceFragments{MetaGen: fragments.namespace, cache: fragments}
+	}
+	return &pod{
+		resource:            NewNamespaceAwareResourceMetadataGenerator(cfg, client, namespace),
+		store:               pods,
+		node:                fragments.node,
+		replicaset:          replicaset,
+		job:                 job,
+		fragments:           fragments,
+		client:              client,
+		addResourceMetadata: addResourceMetadata,
+		unknownOwners:       newUnknownOwners(),
 	}
 }
 
@@ -70,10 +102,11 @@ func NewPodMetadataGenerator(
 // GenerateK8s method while fields that are part of ECS are generated by GenerateECS method
 func (p *pod) Generate(obj kubernetes.Resource, opts ...FieldOptions) mapstr.M {
 	ecsFields := p.GenerateECS(obj)
-	meta := mapstr.M{
-		"kubernetes": p.GenerateK8s(obj, opts...),
-	}
+	meta := newMap()
+	meta["kubernetes"] = p.GenerateK8s(obj, opts...)
 	meta.DeepUpdate(ecsFields)
+	// Nested maps are now part of meta
+	releaseMap(ecsFields)
 	return meta
 }
 
@@ -93,52 +126,64 @@ func (p *pod) GenerateK8s(obj kubernetes.Resource, opts ...FieldOptions) mapstr.
 
 	// check if Pod is handled by a ReplicaSet which is controlled by a Deployment.
 	// The hierarchy there is Deployment->ReplicaSet->Pod.
-	if p.addResourceMetadata.Deployment {
-		if p.replicaset != nil {
-			rsName, _ := out.GetValue("replicaset.name")
-			if rsName, ok := rsName.(string); ok {
-				meta := p.replicaset.GenerateFromName(po.Namespace + "/" + rsName)
-				deploymentName, _ := meta.GetValue("deployment.name")
-				if deploymentName != "" {
-					_, _ = out.Put("deployment.name", deploymentName)
-				}
-			}
+	if p.addResourceMetadata.Deployment && p.replicaset != nil {
+		if rsName, ok := getNested(out, "replicaset", "name").(string); ok {
+			p.putOwner(out, po, p.replicaset, "replicaset", rsName, "deployment")
 		}
 	}
 
 	// check if Pod is handled by a Job which is controlled by a CronJob.
 	// The hierarchy there is CronJob->Job->Pod
-	if p.addResourceMetadata.CronJob {
-		if p.job != nil {
-			jobName, _ := out.GetValue("job.name")
-			if jobName, ok := jobName.(string); ok {
-				meta := p.job.GenerateFromName(po.Namespace + "/" + jobName)
-				cronjobName, _ := meta.GetValue("cronjob.name")
-				if cronjobName != "" {
-					_, _ = out.Put("cronjob.name", cronjobName)
-				}
-			}
+	if p.addResourceMetadata.CronJob && p.job != nil {
+		if jobName, ok := getNested(out, "job", "name").(string); ok {
+			p.putOwner(out, po, p.job, "job", jobName, "cronjob")
 		}
 	}
 
-	if p.node != nil {
+	if p.fragments != nil && p.node != nil {
+		if node := p.fragments.Node(po.Spec.NodeName); node != nil {
+			out["node"] = node
+		} else {
+			putNested(out, po.Spec.NodeName, "node", "name")
+		}
+	} else if p.node != nil {
 		meta := p.node.GenerateFromName(po.Spec.NodeName, WithMetadata("node"))
 		if meta != nil {
-			_, _ = out.Put("node", meta["node"])
+			nodeMeta := meta["node"]
+			if nested, ok := nodeMeta.(mapstr.M); ok {
+				nodeMeta = ownedMetadata(p.node, nested)
+			}
+			out["node"] = nodeMeta
 		} else {
-			_, _ = out.Put("node.name", po.Spec.NodeName)
+			putNested(out, po.Spec.NodeName, "node", "name")
 		}
 	} else {
-		_, _ = out.Put("node.name", po.Spec.NodeName)
+		putNested(out, po.Spec.NodeName, "node", "name")
 	}
 
 	if po.Status.PodIP != "" {
-		_, _ = out.Put("pod.ip", po.Status.PodIP)
+		putNested(out, po.Status.PodIP, "pod", "ip")
 	}
 
 	return out
 }
 
+// putOwner adds the name of the controller of the owner of a pod, e.g. the deployment of its
+// replicaset. Nothing is added if the owner has no such controller, or if the owner is unknown,
+// then the pod is kept to retry it once the owner is found, see RetryUnknownOwners.
+func (p *pod) putOwner(out mapstr.M, po *kubernetes.Pod, gen MetaGen, kind, name, controller string) {
+	owner := po.Namespace + "/" + name
+	meta := gen.GenerateFromName(owner)
+	if meta == nil {
+		p.unknownOwners.add(kind, owner, po)
+		return
+	}
+	if controllerName, ok := getNested(meta, controller, "name").(string); ok && controllerName != "" {
+		putNested(out, controllerName, controller, "name")
+	}
+	releaseGenerated(gen, meta)
+}
+
 // GenerateFromName generates pod metadata from a pod name
 func (p *pod) GenerateFromName(name string, opts ...FieldOptions) mapstr.M {
 	if p.store == nil {
@@ -842,3 +842,85 @@ func TestPod_GenerateWithNodeNamespaceWithAddResourceConfig(t *testing.T) {
 		})
 	}
 }
+
+// BenchmarkGeneratePodMetadata measures the generation of the metadata of a pod of a deployment,
+// with its node and namespace, guarding the allocations of the generation path
+func BenchmarkGeneratePodMetadata(b *testing.B) {
+	metagen, pod := newBenchmarkPodGenerator(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		Release(metagen.Generate(pod))
+	}
+}
+
+// BenchmarkGeneratePodMetadataParallel measures concurrent generations of pod metadata, sharing
+// the interned labels and the node and namespace generators
+func BenchmarkGeneratePodMetadataParallel(b *testing.B) {
+	metagen, pod := newBenchmarkPodGenerator(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			Release(metagen.Generate(pod))
+		}
+	})
+}
+
+func newBenchmarkPodGenerator(b *testing.B) (MetaGen, *v1.Pod) {
+	boolean := true
+	client := k8sfake.NewSimpleClientset()
+	cfg, err := config.NewConfigFrom(map[string]interface{}{
+		"include_annotations": []string{"app", "prometheus.io/scrape"},
+	})
+	require.NoError(b, err)
+
+	labels := map[string]string{
+		"app.kubernetes.io/name":      "nginx",
+		"app.kubernetes.io/component": "frontend",
+		"app.kubernetes.io/part-of":   "store",
+		"pod-template-hash":           "7d9f8c6b5",
+		"tier":                        "web",
+	}
+	nodes := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	require.NoError(b, nodes.Add(&v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "node-1",
+			UID:    types.UID(uid),
+			Labels: map[string]string{"kubernetes.io/os": "linux", "topology.kubernetes.io/zone": "us-east-1a"},
+		},
+		Status: v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeHostName, Address: "node-1"}}},
+	}))
+	namespaces := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	require.NoError(b, namespaces.Add(&v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: defaultNs, UID: types.UID(uid), Labels: map[string]string{"team": "web"}},
+	}))
+	replicaSets := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	require.NoError(b, replicaSets.Add(&appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "nginx-7d9f8c6b5",
+			Namespace:       defaultNs,
+			OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "nginx", Controller: &boolean}},
+		},
+	}))
+
+	metagen := NewPodMetadataGenerator(cfg, nil, client,
+		NewNodeMetadataGenerator(cfg, nodes, client),
+		NewNamespaceMetadataGenerator(cfg, namespaces, client),
+		NewReplicasetMetadataGenerator(cfg, replicaSets, client), nil, addResourceMetadata)
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "nginx-7d9f8c6b5-x7k2p",
+			UID:             types.UID(uid),
+			Namespace:       defaultNs,
+			Labels:          labels,
+			Annotations:     map[string]string{"app": "production", "prometheus.io/scrape": "true", "kubectl.kubernetes.io/restartedAt": "2022-01-01"},
+			OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "nginx-7d9f8c6b5", Controller: &boolean}},
+		},
+		Spec:   v1.PodSpec{NodeName: "node-1"},
+		Status: v1.PodStatus{PodIP: "10.0.0.5"},
+	}
+	return metagen, pod
+}
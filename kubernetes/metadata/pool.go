@@ -0,0 +1,109 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"sync"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// mapPool keeps the maps of released metadata to reuse them
+var mapPool = sync.Pool{
+	New: func() interface{} { return mapstr.M{} },
+}
+
+// newMap returns an empty map, reusing a released one if possible
+func newMap() mapstr.M {
+	return mapPool.Get().(mapstr.M)
+}
+
+// releaseMap empties a map and keeps it to be reused, not its nested maps
+func releaseMap(m mapstr.M) {
+	if m == nil {
+		return
+	}
+	for k := range m {
+		delete(m, k)
+	}
+	mapPool.Put(m)
+}
+
+// cloneMap copies a map and its nested maps into maps that can be released
+func cloneMap(m mapstr.M) mapstr.M {
+	out := newMap()
+	for k, v := range m {
+		if nested, ok := v.(mapstr.M); ok {
+			v = cloneMap(nested)
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// composedKeys are the keys of the namespace and node metadata composed in the metadata of other
+// resources. A FragmentCache composes them by reference, so the same maps can be part of the
+// metadata of many resources, including fragments replaced or deleted since then, and they are
+// never released.
+var composedKeys = map[string]bool{
+	"node":                  true,
+	"namespace_labels":      true,
+	"namespace_annotations": true,
+}
+
+// Release returns the maps of metadata generated by the generators of this package to be reused
+// by the next generations. It is optional, but it reduces the allocations of consumers that
+// generate metadata for every event. Neither the metadata nor any of its nested maps can be used
+// after releasing it. The maps of composed namespace and node metadata are not released, they
+// can be fragments shared by a FragmentCache.
+func Release(meta mapstr.M) {
+	for k, v := range meta {
+		if nested, ok := v.(mapstr.M); ok && !composedKeys[k] {
+			Release(nested)
+		}
+	}
+	releaseMap(meta)
+}
+
+// isPackageGenerator returns true if the metadata of the generator is generated by this package
+// for every call, other generators may keep references to the maps they return, like a
+// FragmentCache
+func isPackageGenerator(gen MetaGen) bool {
+	switch gen.(type) {
+	case *replicaset, *job, *node, *namespace:
+		return true
+	}
+	return false
+}
+
+// releaseGenerated releases intermediate metadata if it was generated by a generator of this
+// package
+func releaseGenerated(gen MetaGen, meta mapstr.M) {
+	if isPackageGenerator(gen) {
+		Release(meta)
+	}
+}
+
+// ownedMetadata returns metadata that can be composed in metadata to be released, the metadata
+// of other generators is cloned
+func ownedMetadata(gen MetaGen, meta mapstr.M) mapstr.M {
+	if isPackageGenerator(gen) {
+		return meta
+	}
+	return cloneMap(meta)
+}
@@ -0,0 +1,111 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+func newPooledTestGenerator(t testing.TB) (MetaGen, *v1.Pod) {
+	boolean := true
+	client := k8sfake.NewSimpleClientset()
+	cfg, err := config.NewConfigFrom(map[string]interface{}{
+		"include_annotations": []string{"app"},
+	})
+	require.NoError(t, err)
+
+	namespaces := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	require.NoError(t, namespaces.Add(&v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: defaultNs, UID: types.UID(uid), Labels: map[string]string{"team": "web"}},
+	}))
+	replicaSets := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	require.NoError(t, replicaSets.Add(&appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "nginx-rs",
+			Namespace: defaultNs,
+			Labels:    map[string]string{"app": "nginx"},
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "Deployment", Name: "nginx-deployment", Controller: &boolean},
+			},
+		},
+	}))
+
+	metagen := NewPodMetadataGenerator(cfg, nil, client, nil,
+		NewNamespaceMetadataGenerator(cfg, namespaces, client),
+		NewReplicasetMetadataGenerator(cfg, replicaSets, client), nil, addResourceMetadata)
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "nginx-rs-x7k2p",
+			UID:         types.UID(uid),
+			Namespace:   defaultNs,
+			Labels:      map[string]string{"app.kubernetes.io/name": "nginx", "tier": "frontend"},
+			Annotations: map[string]string{"app": "production"},
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "ReplicaSet", Name: "nginx-rs", Controller: &boolean},
+			},
+		},
+		Spec:   v1.PodSpec{NodeName: "testnode"},
+		Status: v1.PodStatus{PodIP: "127.0.0.5"},
+	}
+	return metagen, pod
+}
+
+func TestRelease(t *testing.T) {
+	metagen, pod := newPooledTestGenerator(t)
+
+	expected := metagen.GenerateK8s(pod)
+	deployment, err := expected.GetValue("deployment.name")
+	require.NoError(t, err)
+	assert.Equal(t, "nginx-deployment", deployment)
+	assert.NotEmpty(t, expected["namespace_labels"])
+
+	// Metadata generated with released maps is the same
+	for i := 0; i < 10; i++ {
+		meta := metagen.GenerateK8s(pod)
+		assert.Equal(t, expected, meta)
+		Release(meta)
+	}
+}
+
+func BenchmarkPodGenerateK8s(b *testing.B) {
+	metagen, pod := newPooledTestGenerator(b)
+
+	for name, release := range map[string]bool{"released": true, "not released": false} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				meta := metagen.GenerateK8s(pod)
+				if release {
+					Release(meta)
+				}
+			}
+		})
+	}
+}
@@ -82,7 +82,7 @@ func (rs *replicaset) GenerateFromName(name string, opts ...FieldOptions) mapstr
 		return nil
 	}
 
-	if obj, ok, _ := rs.store.GetByKey(name); ok {
+	if obj, ok := storeLookup(rs.store, name); ok {
 		replicaSet, ok := obj.(*kubernetes.ReplicaSet)
 		if !ok {
 			return nil
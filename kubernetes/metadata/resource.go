@@ -19,6 +19,7 @@ package metadata
 
 import (
 	"strings"
+	"sync"
 
 	"k8s.io/apimachinery/pkg/api/meta"
 	k8s "k8s.io/client-go/kubernetes"
@@ -32,11 +33,35 @@ import (
 
 const deploymentType = "Deployment"
 
+const (
+	// dedottedKeysSize is the number of dedotted keys of labels and annotations kept, split in
+	// dedotCacheShards shards
+	dedottedKeysSize = 16 * 1024
+	dedotCacheShards = 16
+)
+
+// interner deduplicates the keys and values of labels and annotations, repeated across objects
+var interner = utils.DefaultInterner
+
+// controllerKinds are the kinds of the controllers added to the metadata, with their keys
+var controllerKinds = map[string]string{
+	// grow this list as we keep adding more `state_*` metricsets
+	deploymentType: "deployment",
+	"ReplicaSet":   "replicaset",
+	"StatefulSet":  "statefulset",
+	"DaemonSet":    "daemonset",
+	"Job":          "job",
+	"CronJob":      "cronjob",
+}
+
 // Resource generates metadata for any kubernetes resource
 type Resource struct {
 	config      *Config
 	clusterInfo ClusterInfo
 	namespace   MetaGen
+
+	matchersOnce sync.Once
+	matchers     resourceMatchers
 }
 
 // NewResourceMetadataGenerator creates a metadata generator for a generic resource
@@ -76,21 +101,22 @@ func NewNamespaceAwareResourceMetadataGenerator(cfg *config.C, client k8s.Interf
 // For retrieving metadata without 'kubernetes.' prefix one should call GenerateK8s instead.
 func (r *Resource) Generate(kind string, obj kubernetes.Resource, opts ...FieldOptions) mapstr.M {
 	ecsFields := r.GenerateECS(obj)
-	meta := mapstr.M{
-		"kubernetes": r.GenerateK8s(kind, obj, opts...),
-	}
+	meta := newMap()
+	meta["kubernetes"] = r.GenerateK8s(kind, obj, opts...)
 	meta.DeepUpdate(ecsFields)
+	// Nested maps are now part of meta
+	releaseMap(ecsFields)
 	return meta
 }
 
 // GenerateECS generates ECS metadata from a resource object
 func (r *Resource) GenerateECS(obj kubernetes.Resource) mapstr.M {
-	ecsMeta := mapstr.M{}
+	ecsMeta := newMap()
 	if r.clusterInfo.URL != "" {
-		_, _ = ecsMeta.Put("orchestrator.cluster.url", r.clusterInfo.URL)
+		putNested(ecsMeta, r.clusterInfo.URL, "orchestrator", "cluster", "url")
 	}
 	if r.clusterInfo.Name != "" {
-		_, _ = ecsMeta.Put("orchestrator.cluster.name", r.clusterInfo.Name)
+		putNested(ecsMeta, r.clusterInfo.Name, "orchestrator", "cluster", "name")
 	}
 	return ecsMeta
 }
@@ -102,35 +128,47 @@ func (r *Resource) GenerateK8s(kind string, obj kubernetes.Resource, options ...
 		return nil
 	}
 
-	var labelMap mapstr.M
-	if len(r.config.IncludeLabels) == 0 {
-		labelMap = GenerateMap(accessor.GetLabels(), r.config.LabelsDedot)
-	} else {
-		labelMap = generateMapSubset(accessor.GetLabels(), r.config.IncludeLabels, r.config.LabelsDedot)
+	matchers := r.keyMatchers()
+	includeLabels := matchers.includeLabels
+	if includeLabels.empty() {
+		includeLabels = nil
 	}
+	labelMap := generateFilteredMap(accessor.GetLabels(), includeLabels, matchers.excludeLabels, r.config.LabelsDedot, r.labelsLimit())
 
-	// Exclude any labels that are present in the exclude_labels config
-	for _, label := range r.config.ExcludeLabels {
-		_ = labelMap.Delete(label)
+	// Labels not dedotted are nested, excluded keys also exclude the labels nested in them
+	if !r.config.LabelsDedot && matchers.excludeLabels != nil {
+		for _, label := range matchers.excludeLabels.keys {
+			_ = labelMap.Delete(label)
+		}
 	}
 
-	annotationsMap := generateMapSubset(accessor.GetAnnotations(), r.config.IncludeAnnotations, r.config.AnnotationsDedot)
-
-	meta := mapstr.M{
-		strings.ToLower(kind): mapstr.M{
-			"name": accessor.GetName(),
-			"uid":  string(accessor.GetUID()),
-		},
+	var annotationsMap mapstr.M
+	if matchers.includeAnnotations.empty() {
+		annotationsMap = newMap()
+	} else {
+		annotationsMap = generateFilteredMap(accessor.GetAnnotations(), matchers.includeAnnotations, nil, r.config.AnnotationsDedot, r.annotationsLimit())
 	}
 
-	namespaceName := accessor.GetNamespace()
-	if namespaceName != "" {
-		_ = safemapstr.Put(meta, "namespace", namespaceName)
+	kindMeta := newMap()
+	kindMeta["name"] = accessor.GetName()
+	kindMeta["uid"] = string(accessor.GetUID())
+	meta := newMap()
+	meta[strings.ToLower(kind)] = kindMeta
+
+	if namespaceName := accessor.GetNamespace(); namespaceName != "" {
+		namespaceValue := interner.InternValue(namespaceName)
+		meta["namespace"] = namespaceValue
 
 		if r.namespace != nil {
-			nsMeta := r.namespace.GenerateFromName(namespaceName)
-			if nsMeta != nil {
+			nsMeta := r.namespace.GenerateFromName(namespaceValue.(string))
+			if _, shared := r.namespace.(*namespaceFragments); shared && nsMeta != nil {
+				// Shared fragments are composed by reference, they are never released
 				meta.DeepUpdate(nsMeta)
+			} else if nsMeta != nil {
+				nsMeta = ownedMetadata(r.namespace, nsMeta)
+				meta.DeepUpdate(nsMeta)
+				// Nested maps are now part of meta
+				releaseMap(nsMeta)
 			}
 		}
 	}
@@ -138,25 +176,22 @@ func (r *Resource) GenerateK8s(kind string, obj kubernetes.Resource, options ...
 	// Add controller metadata if present
 	for _, ref := range accessor.GetOwnerReferences() {
 		if ref.Controller != nil && *ref.Controller {
-			switch ref.Kind {
-			// grow this list as we keep adding more `state_*` metricsets
-			case deploymentType,
-				"ReplicaSet",
-				"StatefulSet",
-				"DaemonSet",
-				"Job",
-				"CronJob":
-				_ = safemapstr.Put(meta, strings.ToLower(ref.Kind)+".name", ref.Name)
+			if key, ok := controllerKinds[ref.Kind]; ok {
+				putNested(meta, ref.Name, key, "name")
 			}
 		}
 	}
 
 	if len(labelMap) != 0 {
-		_ = safemapstr.Put(meta, "labels", labelMap)
+		meta["labels"] = labelMap
+	} else {
+		releaseMap(labelMap)
 	}
 
 	if len(annotationsMap) != 0 {
-		_ = safemapstr.Put(meta, "annotations", annotationsMap)
+		meta["annotations"] = annotationsMap
+	} else {
+		releaseMap(annotationsMap)
 	}
 
 	for _, option := range options {
@@ -167,7 +202,7 @@ func (r *Resource) GenerateK8s(kind string, obj kubernetes.Resource, options ...
 }
 
 func generateMapSubset(input map[string]string, keys []string, dedot bool) mapstr.M {
-	output := mapstr.M{}
+	output := newMap()
 	if input == nil {
 		return output
 	}
@@ -175,32 +210,151 @@ func generateMapSubset(input map[string]string, keys []string, dedot bool) mapst
 	for _, key := range keys {
 		value, ok := input[key]
 		if ok {
-			if dedot {
-				dedotKey := utils.DeDot(key)
-				_, _ = output.Put(dedotKey, value)
-			} else {
-				_ = safemapstr.Put(output, key, value)
+			putLabel(output, key, value, dedot, nil, valueLimit{})
+		}
+	}
+
+	return output
+}
+
+// generateFilteredMap generates a map with the entries of the input included and not excluded,
+// all the entries are included if include is nil. Values longer than the limit are truncated.
+func generateFilteredMap(input map[string]string, include, exclude *keyMatcher, dedot bool, limit valueLimit) mapstr.M {
+	output := newMap()
+	if input == nil {
+		return output
+	}
+
+	// Without patterns only the included keys need to be looked up, in configuration order
+	if include != nil && !include.hasPatterns() {
+		for _, key := range include.keys {
+			if value, ok := input[key]; ok {
+				putLabel(output, key, value, dedot, exclude, limit)
 			}
 		}
+		return output
 	}
 
+	for k, v := range input {
+		if include == nil || include.Match(k) {
+			putLabel(output, k, v, dedot, exclude, limit)
+		}
+	}
 	return output
 }
 
 func GenerateMap(input map[string]string, dedot bool) mapstr.M {
-	output := mapstr.M{}
+	output := newMap()
 	if input == nil {
 		return output
 	}
 
 	for k, v := range input {
-		if dedot {
-			label := utils.DeDot(k)
-			_, _ = output.Put(label, v)
+		putLabel(output, k, v, dedot, nil, valueLimit{})
+	}
+
+	return output
+}
+
+// putLabel sets a label or annotation in the output, dedotting its key if enabled, unless its key
+// is excluded, and truncating its value if longer than the limit. Keys without dots are set
+// directly, only the others need to be split into nested maps.
+func putLabel(output mapstr.M, key, value string, dedot bool, exclude *keyMatcher, limit valueLimit) {
+	if dedot {
+		key, nested := dedottedKeys.get(key)
+		if exclude != nil && exclude.Match(key) {
+			return
+		}
+		valueOf := interner.InternValue(limit.truncate(value))
+		if nested {
+			_, _ = output.Put(key, valueOf)
 		} else {
-			_ = safemapstr.Put(output, k, v)
+			output[key] = valueOf
 		}
+		return
+	}
+	if exclude != nil && exclude.Match(key) {
+		return
 	}
+	valueOf := interner.InternValue(limit.truncate(value))
+	if _, exists := output[key]; exists || strings.IndexByte(key, '.') >= 0 {
+		_ = safemapstr.Put(output, interner.Intern(key), valueOf)
+		return
+	}
+	output[interner.Intern(key)] = valueOf
+}
 
-	return output
+// putNested sets a value in nested maps under the given keys, like mapstr.M.Put does with dotted
+// keys but without splitting them. Values of intermediate keys that are not maps are replaced.
+func putNested(m mapstr.M, value interface{}, keys ...string) {
+	last := len(keys) - 1
+	for _, key := range keys[:last] {
+		nested, ok := m[key].(mapstr.M)
+		if !ok {
+			nested = newMap()
+			m[key] = nested
+		}
+		m = nested
+	}
+	m[keys[last]] = value
+}
+
+// getNested returns the value in nested maps under the given keys, nil if there is none, like
+// mapstr.M.GetValue does with dotted keys
+func getNested(m mapstr.M, keys ...string) interface{} {
+	last := len(keys) - 1
+	for _, key := range keys[:last] {
+		nested, ok := m[key].(mapstr.M)
+		if !ok {
+			return nil
+		}
+		m = nested
+	}
+	return m[keys[last]]
+}
+
+// dedottedKeys keeps the keys of labels and annotations dedotted by the default dedotter, repeated
+// across objects
+var dedottedKeys = &dedotCache{}
+
+// dedotCache keeps dedotted keys, and whether they still have dots and must be nested. It is split
+// in shards with their own locks, reset when full.
+type dedotCache struct {
+	shards [dedotCacheShards]dedotCacheShard
+}
+
+type dedotCacheShard struct {
+	sync.RWMutex
+	keys map[string]dedottedKey
+}
+
+type dedottedKey struct {
+	key    string
+	nested bool
+}
+
+// get returns the dedotted key, and whether it still has dots
+func (c *dedotCache) get(key string) (string, bool) {
+	shard := &c.shards[utils.StringHash(key)%dedotCacheShards]
+	shard.RLock()
+	dedotted, ok := shard.keys[key]
+	shard.RUnlock()
+	if ok {
+		return dedotted.key, dedotted.nested
+	}
+
+	dedotted.key = key
+	if strings.IndexByte(key, '.') >= 0 {
+		dedotted.key = utils.DefaultDedotter.DeDot(key)
+		dedotted.nested = strings.IndexByte(dedotted.key, '.') >= 0
+	}
+	dedotted.key = interner.Intern(dedotted.key)
+
+	shard.Lock()
+	defer shard.Unlock()
+	if shard.keys == nil || len(shard.keys) >= dedottedKeysSize/dedotCacheShards {
+		shard.keys = make(map[string]dedottedKey)
+	}
+	shard.keys[interner.Intern(key)] = dedotted
+	return dedotted.key, dedotted.nested
 }
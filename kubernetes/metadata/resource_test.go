@@ -18,6 +18,8 @@
 package metadata
 
 import (
+	"fmt"
+	"runtime"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -30,6 +32,7 @@ import (
 	"k8s.io/client-go/tools/cache"
 
 	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+	"github.com/elastic/elastic-agent-autodiscover/utils"
 	"github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/mapstr"
 	"github.com/elastic/go-ucfg"
@@ -262,3 +265,85 @@ func TestNamespaceAwareResource_GenerateWithNamespace(t *testing.T) {
 		})
 	}
 }
+
+// BenchmarkGenerateMapInterned measures the memory retained by the label maps of many pods with
+// repeated labels, as decoded objects have their own copies of the same strings
+func BenchmarkGenerateMapInterned(b *testing.B) {
+	const pods = 2000
+	labels := func(i int) map[string]string {
+		copied := func(s string) string { return string([]byte(s)) }
+		return map[string]string{
+			copied("app.kubernetes.io/name"):       copied("frontend-application"),
+			copied("app.kubernetes.io/component"):  copied("web-server"),
+			copied("app.kubernetes.io/part-of"):    copied("online-store"),
+			copied("app.kubernetes.io/managed-by"): copied("helm"),
+			copied("environment"):                  copied("production"),
+			copied("pod-template-hash"):            fmt.Sprintf("%08x", i%10),
+		}
+	}
+
+	for name, i := range map[string]*utils.Interner{
+		"interned":     utils.NewInterner(1024),
+		"not interned": utils.NewInterner(0),
+	} {
+		b.Run(name, func(b *testing.B) {
+			defer func(original *utils.Interner) { interner = original }(interner)
+			interner = i
+
+			var retained float64
+			for n := 0; n < b.N; n++ {
+				runtime.GC()
+				var before runtime.MemStats
+				runtime.ReadMemStats(&before)
+
+				inputs := make([]map[string]string, pods)
+				for p := range inputs {
+					inputs[p] = labels(p)
+				}
+				maps := make([]mapstr.M, pods)
+				for p := range maps {
+					maps[p] = GenerateMap(inputs[p], true)
+				}
+				// Decoded objects are replaced by newer versions, only the metadata is kept
+				inputs = nil
+				runtime.GC()
+				var after runtime.MemStats
+				runtime.ReadMemStats(&after)
+				runtime.KeepAlive(maps)
+
+				retained += float64(after.HeapAlloc) - float64(before.HeapAlloc)
+			}
+			b.ReportMetric(retained/float64(b.N)/pods, "retained-B/pod")
+		})
+	}
+}
+
+func TestGenerateMapKeys(t *testing.T) {
+	labels := map[string]string{
+		"app":                    "nginx",
+		"app.kubernetes.io/name": "nginx",
+		"tier":                   "web",
+	}
+
+	assert.Equal(t, mapstr.M{
+		"app":                    "nginx",
+		"app_kubernetes_io/name": "nginx",
+		"tier":                   "web",
+	}, GenerateMap(labels, true))
+
+	// Keys are cached once dedotted
+	assert.Equal(t, mapstr.M{
+		"app":                    "nginx",
+		"app_kubernetes_io/name": "nginx",
+		"tier":                   "web",
+	}, GenerateMap(labels, true))
+
+	// Conflicting keys are not overwritten without dedotting
+	assert.Equal(t, mapstr.M{
+		"app": mapstr.M{
+			"value":      "nginx",
+			"kubernetes": mapstr.M{"io/name": "nginx"},
+		},
+		"tier": "web",
+	}, generateMapSubset(labels, []string{"app.kubernetes.io/name", "app", "tier"}, false))
+}
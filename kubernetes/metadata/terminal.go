@@ -0,0 +1,75 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// WithTerminalState adds the final state of a deleted pod to its metadata: the deletion
+// timestamp and phase of the pod, and the type, reason and exit code of its terminated
+// containers under pod.termination.
+func WithTerminalState(state kubernetes.PodTerminalState) FieldOptions {
+	return func(meta mapstr.M) {
+		if state.DeletionTimestamp != nil {
+			putNested(meta, *state.DeletionTimestamp, "pod", "deletion_timestamp")
+		}
+		if state.Phase != "" {
+			putNested(meta, state.Phase, "pod", "phase")
+		}
+		if state.Reason != "" {
+			putNested(meta, state.Reason, "pod", "termination", "reason")
+		}
+		if state.Message != "" {
+			putNested(meta, state.Message, "pod", "termination", "message")
+		}
+		for _, c := range state.Containers {
+			container := mapstr.M{
+				"type":        string(c.Type),
+				"exit_code":   c.ExitCode,
+				"restarts":    c.Restarts,
+				"finished_at": c.FinishedAt,
+			}
+			if c.Reason != "" {
+				container["reason"] = c.Reason
+			}
+			if c.Message != "" {
+				container["message"] = c.Message
+			}
+			if c.Signal != 0 {
+				container["signal"] = c.Signal
+			}
+			putNested(meta, container, "pod", "termination", "containers", c.Name)
+		}
+	}
+}
+
+// PodDeleteFunc returns a delete callback for the watchers of pods, to use as the DeleteFunc of
+// kubernetes.ResourceEventHandlerFuncs. It calls fn with every deleted pod and its final metadata
+// snapshot, generated with the terminal state of the pod, to enrich its last events after the
+// pod is gone.
+func PodDeleteFunc(gen MetaGen, fn func(pod *kubernetes.Pod, meta mapstr.M)) func(obj interface{}) {
+	return func(obj interface{}) {
+		pod, ok := obj.(*kubernetes.Pod)
+		if !ok {
+			return
+		}
+		fn(pod, gen.Generate(pod, WithTerminalState(kubernetes.GetPodTerminalState(pod))))
+	}
+}
@@ -0,0 +1,106 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestPodDeleteFunc(t *testing.T) {
+	deletion := metav1.NewTime(time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC))
+	finished := metav1.NewTime(deletion.Add(-time.Second))
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			UID:               types.UID(uid),
+			Namespace:         defaultNs,
+			DeletionTimestamp: &deletion,
+		},
+		Spec: v1.PodSpec{
+			NodeName:   "testnode",
+			Containers: []v1.Container{{Name: "nginx"}, {Name: "sidecar"}},
+		},
+		Status: v1.PodStatus{
+			Phase:  v1.PodFailed,
+			Reason: "Evicted",
+			ContainerStatuses: []v1.ContainerStatus{
+				{
+					Name:         "nginx",
+					RestartCount: 2,
+					State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{
+						Reason:     "OOMKilled",
+						ExitCode:   137,
+						Signal:     9,
+						FinishedAt: finished,
+					}},
+				},
+				{
+					Name:  "sidecar",
+					State: v1.ContainerState{Running: &v1.ContainerStateRunning{}},
+				},
+			},
+		},
+	}
+
+	cfg, err := config.NewConfigFrom(map[string]interface{}{})
+	require.NoError(t, err)
+	metagen := NewPodMetadataGenerator(cfg, nil, k8sfake.NewSimpleClientset(), nil, nil, nil, nil, addResourceMetadata)
+
+	var deleted *kubernetes.Pod
+	var meta mapstr.M
+	handler := kubernetes.ResourceEventHandlerFuncs{DeleteFunc: PodDeleteFunc(metagen, func(pod *kubernetes.Pod, m mapstr.M) {
+		deleted = pod
+		meta = m
+	})}
+	handler.OnDelete("not a pod")
+	assert.Nil(t, deleted)
+
+	handler.OnDelete(pod)
+	assert.Same(t, pod, deleted)
+	assert.Equal(t, mapstr.M{
+		"name":               name,
+		"uid":                uid,
+		"deletion_timestamp": deletion.Time,
+		"phase":              "Failed",
+		"termination": mapstr.M{
+			"reason": "Evicted",
+			"containers": mapstr.M{
+				"nginx": mapstr.M{
+					"type":        "container",
+					"reason":      "OOMKilled",
+					"exit_code":   int32(137),
+					"signal":      int32(9),
+					"restarts":    int32(2),
+					"finished_at": finished.Time,
+				},
+			},
+		},
+	}, getNested(meta, "kubernetes", "pod"))
+}
@@ -0,0 +1,78 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// TruncatedMarker is appended to the values of labels and annotations truncated to their maximum
+// length
+const TruncatedMarker = "...(truncated)"
+
+// TruncationStats are the counters of the values of labels and annotations truncated in the
+// generated metadata
+type TruncationStats struct {
+	Labels      uint64
+	Annotations uint64
+}
+
+var truncationCounters struct {
+	labels      atomic.Uint64
+	annotations atomic.Uint64
+}
+
+// Truncations returns the counters of the values truncated by all the generators
+func Truncations() TruncationStats {
+	return TruncationStats{
+		Labels:      truncationCounters.labels.Load(),
+		Annotations: truncationCounters.annotations.Load(),
+	}
+}
+
+// valueLimit is the maximum length of the values of labels or annotations, with the counter of
+// the truncated ones
+type valueLimit struct {
+	max     int
+	counter *atomic.Uint64
+}
+
+func (r *Resource) labelsLimit() valueLimit {
+	return valueLimit{max: r.config.LabelsMaxValueLength, counter: &truncationCounters.labels}
+}
+
+func (r *Resource) annotationsLimit() valueLimit {
+	return valueLimit{max: r.config.AnnotationsMaxValueLength, counter: &truncationCounters.annotations}
+}
+
+// truncate truncates a value longer than the limit, without splitting multi-byte characters, and
+// appends the TruncatedMarker to it. Values are not truncated without limit.
+func (l valueLimit) truncate(value string) string {
+	if l.max <= 0 || len(value) <= l.max {
+		return value
+	}
+	end := l.max
+	for end > 0 && !utf8.RuneStart(value[end]) {
+		end--
+	}
+	if l.counter != nil {
+		l.counter.Add(1)
+	}
+	return value[:end] + TruncatedMarker
+}
@@ -0,0 +1,115 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestValueLimitTruncate(t *testing.T) {
+	for _, test := range []struct {
+		max      int
+		value    string
+		expected string
+	}{
+		{max: 0, value: "frontend", expected: "frontend"},
+		{max: 8, value: "frontend", expected: "frontend"},
+		{max: 5, value: "frontend", expected: "front" + TruncatedMarker},
+		// Multi-byte characters are not split
+		{max: 2, value: "añejo", expected: "a" + TruncatedMarker},
+		{max: 3, value: "añejo", expected: "añ" + TruncatedMarker},
+	} {
+		assert.Equal(t, test.expected, valueLimit{max: test.max}.truncate(test.value), test)
+	}
+}
+
+func TestResource_GenerateTruncatedValues(t *testing.T) {
+	cfg, err := config.NewConfigFrom(map[string]interface{}{
+		"include_annotations":          []string{"kubectl.kubernetes.io/last-applied-configuration", "owner"},
+		"labels.max_value_length":      4,
+		"annotations.max_value_length": 16,
+	})
+	require.NoError(t, err)
+	metagen := NewResourceMetadataGenerator(cfg, k8sfake.NewSimpleClientset())
+
+	lastApplied := `{"apiVersion":"v1","kind":"Pod","metadata":{"name":"web"}}`
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web",
+			Namespace: defaultNs,
+			UID:       types.UID(uid),
+			Labels:    map[string]string{"tier": "frontend", "app": "web"},
+			Annotations: map[string]string{
+				"kubectl.kubernetes.io/last-applied-configuration": lastApplied,
+				"owner": "team-a",
+			},
+		},
+	}
+
+	before := Truncations()
+	meta := metagen.GenerateK8s("pod", pod)
+	assert.Equal(t, mapstr.M{
+		"tier": "fron" + TruncatedMarker,
+		"app":  "web",
+	}, meta["labels"])
+	assert.Equal(t, mapstr.M{
+		"kubectl_kubernetes_io/last-applied-configuration": lastApplied[:16] + TruncatedMarker,
+		"owner": "team-a",
+	}, meta["annotations"])
+	after := Truncations()
+	assert.Equal(t, uint64(1), after.Labels-before.Labels)
+	assert.Equal(t, uint64(1), after.Annotations-before.Annotations)
+
+	// The metadata encoded directly is truncated too
+	encoded, err := metagen.AppendK8sJSON(nil, "pod", pod)
+	require.NoError(t, err)
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.Equal(t, "fron"+TruncatedMarker, decoded["labels"].(map[string]interface{})["tier"])
+	assert.True(t, strings.HasSuffix(decoded["annotations"].(map[string]interface{})["kubectl_kubernetes_io/last-applied-configuration"].(string), TruncatedMarker))
+	assert.Equal(t, uint64(1), Truncations().Labels-after.Labels)
+
+	// And the values of views
+	view := metagen.GenerateK8sView("pod", pod)
+	value, err := view.GetValue("labels.tier")
+	require.NoError(t, err)
+	assert.Equal(t, "fron"+TruncatedMarker, value)
+}
+
+func TestConfigMaxValueLength(t *testing.T) {
+	cfg, err := config.NewConfigFrom(map[string]interface{}{"labels.max_value_length": -1})
+	require.NoError(t, err)
+	var c Config
+	assert.Error(t, c.Unmarshal(cfg))
+
+	cfg, err = config.NewConfigFrom(map[string]interface{}{"annotations.max_value_length": 1024})
+	require.NoError(t, err)
+	assert.NoError(t, ValidateConfig(cfg))
+}
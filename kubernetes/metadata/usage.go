@@ -0,0 +1,114 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const (
+	// mapOverhead and mapEntryOverhead are the approximate sizes of a map, and of the key and
+	// value headers of its entries
+	mapOverhead      = 48
+	mapEntryOverhead = 32
+
+	// dedotEntrySize is the size of the key and value headers of a cached dedotted key
+	dedotEntrySize = 40
+)
+
+// CacheUsage is the approximate memory usage of a cache of metadata
+type CacheUsage struct {
+	// Entries is the number of entries of the cache
+	Entries int
+
+	// Bytes is the approximate size of the entries, strings shared between entries, like the
+	// interned keys and values of labels, are counted in every entry
+	Bytes int64
+}
+
+// ApproxMetadataSize returns the approximate memory size of generated metadata
+func ApproxMetadataSize(meta mapstr.M) int64 {
+	if meta == nil {
+		return 0
+	}
+	size := int64(mapOverhead)
+	for k, v := range meta {
+		size += mapEntryOverhead + int64(len(k))
+		switch v := v.(type) {
+		case string:
+			size += int64(len(v))
+		case mapstr.M:
+			size += ApproxMetadataSize(v)
+		case map[string]interface{}:
+			size += ApproxMetadataSize(v)
+		case []string:
+			for _, s := range v {
+				size += 16 + int64(len(s))
+			}
+		}
+	}
+	return size
+}
+
+// Usage returns the approximate memory usage of the cached metadata
+func (c *cachedMetaGen) Usage() CacheUsage {
+	var usage CacheUsage
+	for i := range c.shards {
+		shard := &c.shards[i]
+		shard.RLock()
+		for _, entry := range shard.entries {
+			usage.Entries++
+			usage.Bytes += ApproxMetadataSize(entry.k8s) + ApproxMetadataSize(entry.full)
+		}
+		shard.RUnlock()
+	}
+	return usage
+}
+
+// Usage returns the approximate memory usage of the fragments of namespaces and nodes
+func (c *FragmentCache) Usage() CacheUsage {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	var usage CacheUsage
+	for _, fragments := range []map[string]*fragment{c.namespaces, c.nodes} {
+		for _, f := range fragments {
+			usage.Entries++
+			usage.Bytes += ApproxMetadataSize(f.meta)
+		}
+	}
+	return usage
+}
+
+// SharedCachesUsage returns the approximate memory usage of the caches shared by all the
+// generators, the interned strings and the dedotted keys of labels and annotations
+func SharedCachesUsage() CacheUsage {
+	usage := CacheUsage{
+		Entries: interner.Len(),
+		Bytes:   interner.Bytes(),
+	}
+	for i := range dedottedKeys.shards {
+		shard := &dedottedKeys.shards[i]
+		shard.RLock()
+		// Keys are interned, only the headers of the entries are counted
+		usage.Entries += len(shard.keys)
+		usage.Bytes += int64(len(shard.keys)) * dedotEntrySize
+		shard.RUnlock()
+	}
+	return usage
+}
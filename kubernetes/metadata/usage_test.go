@@ -0,0 +1,70 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestApproxMetadataSize(t *testing.T) {
+	assert.Equal(t, int64(0), ApproxMetadataSize(nil))
+	assert.Equal(t, int64(mapOverhead), ApproxMetadataSize(mapstr.M{}))
+	assert.Equal(t,
+		int64(mapOverhead+mapEntryOverhead+len("pod")+mapOverhead+mapEntryOverhead+len("name")+len("web")),
+		ApproxMetadataSize(mapstr.M{"pod": mapstr.M{"name": "web"}}))
+}
+
+func TestCacheUsage(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	gen, err := NewCachedMetadataGenerator(NewPodMetadataGenerator(config.NewConfig(), nil, client, nil, nil, nil, nil, &AddResourceMetadataConfig{}), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, CacheUsage{}, gen.Usage())
+
+	for _, name := range []string{"web", "api"} {
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: defaultNs, UID: types.UID(name), ResourceVersion: "1"}}
+		gen.GenerateK8s(pod)
+		gen.Generate(pod)
+	}
+	usage := gen.Usage()
+	assert.Equal(t, 2, usage.Entries)
+	assert.Greater(t, usage.Bytes, int64(0))
+
+	gen.Purge()
+	assert.Equal(t, CacheUsage{}, gen.Usage())
+
+	nodes := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	require.NoError(t, nodes.Add(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", UID: types.UID(uid)}}))
+	fragments := NewFragmentCache(nil, NewNodeMetadataGenerator(config.NewConfig(), nodes, client))
+	fragments.Node("node-1")
+	fragments.Node("unknown")
+	assert.Equal(t, CacheUsage{Entries: 1, Bytes: ApproxMetadataSize(fragments.Node("node-1"))}, fragments.Usage())
+
+	assert.Greater(t, SharedCachesUsage().Entries, 0)
+}
@@ -0,0 +1,155 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/elastic/elastic-agent-autodiscover/kubernetes"
+	"github.com/elastic/elastic-agent-autodiscover/utils"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// View is a lazily evaluated view of the metadata of a resource, as generated by GenerateK8s.
+// The name, uid, namespace, labels and annotations of the resource are read directly from the
+// object, the metadata is only generated when other fields are read or the view is serialized.
+// The object must not be modified while the view is in use.
+type View struct {
+	resource *Resource
+	kind     string
+	obj      kubernetes.Resource
+	accessor metav1.Object
+	options  []FieldOptions
+
+	once sync.Once
+	meta mapstr.M
+}
+
+// GenerateK8sView returns a lazily evaluated view of the metadata GenerateK8s would return, for
+// consumers reading only a few fields of the metadata
+func (r *Resource) GenerateK8sView(kind string, obj kubernetes.Resource, options ...FieldOptions) *View {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil
+	}
+	return &View{resource: r, kind: kind, obj: obj, accessor: accessor, options: options}
+}
+
+// GetValue returns the value of a dotted key of the metadata
+func (v *View) GetValue(key string) (interface{}, error) {
+	if value, ok := v.direct(key); ok {
+		return value, nil
+	}
+	return v.Materialize().GetValue(key)
+}
+
+// direct reads a key from the object without generating the metadata, if possible
+func (v *View) direct(key string) (interface{}, bool) {
+	// Options can modify any field
+	if len(v.options) > 0 {
+		return nil, false
+	}
+
+	kind := strings.ToLower(v.kind)
+	switch key {
+	case kind + ".name":
+		return v.accessor.GetName(), true
+	case kind + ".uid":
+		return string(v.accessor.GetUID()), true
+	case "namespace":
+		if ns := v.accessor.GetNamespace(); ns != "" {
+			return ns, true
+		}
+		return nil, false
+	}
+
+	if label, ok := cutPrefix(key, "labels."); ok && v.resource.config.LabelsDedot {
+		return v.label(label)
+	}
+	if annotation, ok := cutPrefix(key, "annotations."); ok && v.resource.config.AnnotationsDedot {
+		return v.annotation(annotation)
+	}
+	return nil, false
+}
+
+// label returns the value of a dedotted label, only if the label is in the metadata
+func (v *View) label(dedotted string) (interface{}, bool) {
+	matchers := v.resource.keyMatchers()
+	if matchers.excludeLabels != nil && matchers.excludeLabels.Match(dedotted) {
+		return nil, false
+	}
+	for k, value := range v.accessor.GetLabels() {
+		if utils.DeDot(k) != dedotted {
+			continue
+		}
+		if !matchers.includeLabels.empty() && !matchers.includeLabels.Match(k) {
+			continue
+		}
+		return v.resource.labelsLimit().truncate(value), true
+	}
+	return nil, false
+}
+
+// annotation returns the value of a dedotted annotation, only if the annotation is in the metadata
+func (v *View) annotation(dedotted string) (interface{}, bool) {
+	include := v.resource.keyMatchers().includeAnnotations
+	if include.empty() {
+		return nil, false
+	}
+	for k, value := range v.accessor.GetAnnotations() {
+		if utils.DeDot(k) == dedotted && include.Match(k) {
+			return v.resource.annotationsLimit().truncate(value), true
+		}
+	}
+	return nil, false
+}
+
+// Materialize returns the metadata of the resource, generated the first time it is called
+func (v *View) Materialize() mapstr.M {
+	v.once.Do(func() {
+		v.meta = v.resource.GenerateK8s(v.kind, v.obj, v.options...)
+	})
+	return v.meta
+}
+
+// MarshalJSON serializes the metadata, writing the fields of the object directly if possible
+func (v *View) MarshalJSON() ([]byte, error) {
+	if len(v.options) == 0 {
+		if out, ok := v.resource.appendK8sJSON(nil, v.kind, v.obj); ok {
+			return out, nil
+		}
+	}
+	return json.Marshal(v.Materialize())
+}
+
+// String returns the metadata as a string
+func (v *View) String() string {
+	return v.Materialize().String()
+}
+
+func cutPrefix(s, prefix string) (string, bool) {
+	if !strings.HasPrefix(s, prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
@@ -0,0 +1,108 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestView(t *testing.T) {
+	boolean := true
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			UID:       types.UID(uid),
+			Namespace: defaultNs,
+			Labels: map[string]string{
+				"app.kubernetes.io/name": "nginx",
+				"tier":                   "frontend",
+				"secret":                 "hidden",
+			},
+			Annotations: map[string]string{
+				"co.elastic.logs/enabled": "true",
+				"other":                   "ignored",
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "ReplicaSet", Name: "nginx-6d4cf56db6", Controller: &boolean},
+			},
+		},
+	}
+	metagen := &Resource{config: &Config{
+		LabelsDedot:        true,
+		AnnotationsDedot:   true,
+		ExcludeLabels:      []string{"secret"},
+		IncludeAnnotations: []string{"co.elastic.logs/enabled"},
+	}}
+
+	view := metagen.GenerateK8sView("Pod", pod)
+	for key, expected := range map[string]interface{}{
+		"pod.name":                            name,
+		"pod.uid":                             uid,
+		"namespace":                           defaultNs,
+		"labels.app_kubernetes_io/name":       "nginx",
+		"labels.tier":                         "frontend",
+		"annotations.co_elastic_logs/enabled": "true",
+	} {
+		value, ok := view.direct(key)
+		assert.True(t, ok, key)
+		assert.Equal(t, expected, value, key)
+	}
+	assert.Nil(t, view.meta)
+
+	// Fields not in the metadata are not read directly
+	for _, key := range []string{"labels.secret", "annotations.other", "replicaset.name", "labels.missing"} {
+		_, ok := view.direct(key)
+		assert.False(t, ok, key)
+	}
+
+	value, err := view.GetValue("replicaset.name")
+	require.NoError(t, err)
+	assert.Equal(t, "nginx-6d4cf56db6", value)
+	_, err = view.GetValue("labels.secret")
+	assert.Error(t, err)
+
+	generated := metagen.GenerateK8s("Pod", pod)
+	assert.Equal(t, generated, view.Materialize())
+
+	serialized, err := json.Marshal(view)
+	require.NoError(t, err)
+	expected, err := json.Marshal(generated)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(expected), string(serialized))
+}
+
+func TestViewWithOptions(t *testing.T) {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, UID: types.UID(uid), Namespace: defaultNs}}
+	metagen := &Resource{config: &Config{LabelsDedot: true}}
+
+	view := metagen.GenerateK8sView("Pod", pod, func(m mapstr.M) {
+		_, _ = m.Put("pod.name", "renamed")
+	})
+	value, err := view.GetValue("pod.name")
+	require.NoError(t, err)
+	assert.Equal(t, "renamed", value)
+}
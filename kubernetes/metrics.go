@@ -0,0 +1,70 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"time"
+
+	"github.com/elastic/elastic-agent-autodiscover/metrics"
+)
+
+// watcherMetrics reports the metrics of a watcher, labeled by the name of the watcher
+type watcherMetrics struct {
+	name           string
+	events         metrics.Counter
+	filtered       metrics.Counter
+	queueDepth     metrics.Gauge
+	handleDuration metrics.Histogram
+	synced         metrics.Gauge
+}
+
+func newWatcherMetrics(r metrics.Registry, name string) *watcherMetrics {
+	if r == nil {
+		r = metrics.Noop()
+	}
+	return &watcherMetrics{
+		name:           name,
+		events:         r.Counter("autodiscover_kubernetes_watcher_events_total", "Events queued by the watcher, per event type.", "watcher", "type"),
+		filtered:       r.Counter("autodiscover_kubernetes_watcher_filtered_updates_total", "Updates not queued because they only change insignificant fields.", "watcher"),
+		queueDepth:     r.Gauge("autodiscover_kubernetes_watcher_queue_depth", "Events queued by the watcher and not handled yet.", "watcher"),
+		handleDuration: r.Histogram("autodiscover_kubernetes_watcher_handle_duration_seconds", "Time spent by the event handlers of the watcher, per event type.", nil, "watcher", "type"),
+		synced:         r.Gauge("autodiscover_kubernetes_watcher_synced", "Whether the store of the watcher is synced, 1 if it is.", "watcher"),
+	}
+}
+
+func (m *watcherMetrics) enqueued(state string, depth int) {
+	m.events.Add(1, m.name, state)
+	m.queueDepth.Set(float64(depth), m.name)
+}
+
+func (m *watcherMetrics) filteredUpdate() {
+	m.filtered.Add(1, m.name)
+}
+
+func (m *watcherMetrics) handled(state string, start time.Time, depth int) {
+	m.handleDuration.Observe(time.Since(start).Seconds(), m.name, state)
+	m.queueDepth.Set(float64(depth), m.name)
+}
+
+func (m *watcherMetrics) setSynced(synced bool) {
+	value := 0.0
+	if synced {
+		value = 1
+	}
+	m.synced.Set(value, m.name)
+}
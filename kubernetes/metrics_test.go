@@ -0,0 +1,64 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/elastic/elastic-agent-autodiscover/metrics"
+)
+
+func TestWatcherMetrics(t *testing.T) {
+	client := k8sfake.NewSimpleClientset(&Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", ResourceVersion: "1"}})
+	registry := metrics.NewInMemory()
+
+	watcher, err := NewNamedWatcher("pods", client, &Pod{}, WatchOptions{Metrics: registry}, nil)
+	require.NoError(t, err)
+	added := make(chan struct{}, 1)
+	watcher.AddEventHandler(ResourceEventHandlerFuncs{
+		AddFunc: func(interface{}) { added <- struct{}{} },
+	})
+	require.NoError(t, watcher.Start())
+
+	select {
+	case <-added:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for add event")
+	}
+	synced, _ := registry.Value("autodiscover_kubernetes_watcher_synced", "pods")
+	assert.Equal(t, float64(1), synced)
+	events, _ := registry.Value("autodiscover_kubernetes_watcher_events_total", "pods", add)
+	assert.Equal(t, float64(1), events)
+	assert.Eventually(t, func() bool {
+		handled, _ := registry.Value("autodiscover_kubernetes_watcher_handle_duration_seconds", "pods", add)
+		return handled == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	depth, ok := registry.Value("autodiscover_kubernetes_watcher_queue_depth", "pods")
+	assert.True(t, ok)
+	assert.Equal(t, float64(0), depth)
+
+	watcher.Stop()
+	synced, _ = registry.Value("autodiscover_kubernetes_watcher_synced", "pods")
+	assert.Equal(t, float64(0), synced)
+}
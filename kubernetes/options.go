@@ -20,4 +20,6 @@ package kubernetes
 type KubeClientOptions struct {
 	QPS   float32 `config:"qps"`
 	Burst int     `config:"burst"`
+	// Audit logs the requests made to the API server
+	Audit AuditConfig `config:"audit"`
 }
@@ -0,0 +1,123 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// forbiddenMessage matches the messages of the forbidden errors of the API server
+var forbiddenMessage = regexp.MustCompile(`cannot (\S+) resource "([^"]*)" in API group "([^"]*)"(?: in the namespace "([^"]*)")?`)
+
+// MissingPermission is an RBAC permission the agent lacks
+type MissingPermission struct {
+	Verb     string `json:"verb"`
+	Group    string `json:"group,omitempty"`
+	Resource string `json:"resource"`
+	// Namespace is the namespace of the denied request, empty at the cluster scope
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// String returns the permission in the format of the RBAC rules, e.g. "list apps/replicasets"
+func (p MissingPermission) String() string {
+	s := p.Verb + " "
+	if p.Group != "" {
+		s += p.Group + "/"
+	}
+	s += p.Resource
+	if p.Namespace != "" {
+		s += " in namespace " + p.Namespace
+	}
+	return s
+}
+
+// PermissionReporter collects the RBAC permissions missing for the requests of the watchers, and
+// logs a single warning for every one of them instead of the errors of every retried request.
+// The metadata requiring the resources of failed watchers is not generated, the other fields are.
+type PermissionReporter struct {
+	logger *logp.Logger
+
+	mutex   sync.Mutex
+	missing map[MissingPermission]struct{}
+}
+
+// NewPermissionReporter creates a PermissionReporter logging with the given logger, a logger
+// named "kubernetes" is used if nil
+func NewPermissionReporter(logger *logp.Logger) *PermissionReporter {
+	if logger == nil {
+		logger = logp.NewLogger("kubernetes")
+	}
+	return &PermissionReporter{logger: logger, missing: make(map[MissingPermission]struct{})}
+}
+
+// Report records the permission missing for a forbidden request, it returns false if err is not
+// a forbidden error. A warning is logged the first time a permission is reported.
+func (r *PermissionReporter) Report(err error) bool {
+	if r == nil || err == nil || !isForbidden(err) {
+		return false
+	}
+
+	permission := MissingPermission{Verb: "unknown", Resource: "unknown"}
+	if m := forbiddenMessage.FindStringSubmatch(err.Error()); m != nil {
+		permission = MissingPermission{Verb: m[1], Resource: m[2], Group: m[3], Namespace: m[4]}
+	}
+
+	r.mutex.Lock()
+	_, known := r.missing[permission]
+	r.missing[permission] = struct{}{}
+	r.mutex.Unlock()
+	if known {
+		return true
+	}
+
+	missing := r.Missing()
+	all := make([]string, len(missing))
+	for i, p := range missing {
+		all[i] = p.String()
+	}
+	r.logger.Warnw("Missing RBAC permission, the metadata requiring it will not be available",
+		"permission", permission.String(),
+		"missing_permissions", all,
+		"error", err.Error())
+	return true
+}
+
+// Missing returns the missing permissions reported, sorted
+func (r *PermissionReporter) Missing() []MissingPermission {
+	if r == nil {
+		return nil
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if len(r.missing) == 0 {
+		return nil
+	}
+	missing := make([]MissingPermission, 0, len(r.missing))
+	for p := range r.missing {
+		missing = append(missing, p)
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		return missing[i].String() < missing[j].String()
+	})
+	return missing
+}
@@ -0,0 +1,83 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+func TestPermissionReporter(t *testing.T) {
+	require.NoError(t, logp.DevelopmentSetup(logp.ToObserverOutput()))
+	reporter := NewPermissionReporter(nil)
+
+	replicasets := fmt.Errorf("failed to list *v1.ReplicaSet: %v", errors.New(`replicasets.apps is forbidden: User "system:serviceaccount:kube-system:agent" cannot list resource "replicasets" in API group "apps" at the cluster scope`))
+	namespaced := apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "", errors.New(`User "agent" cannot watch resource "pods" in API group "" in the namespace "default"`))
+
+	assert.False(t, reporter.Report(nil))
+	assert.False(t, reporter.Report(errors.New("connection refused")))
+	assert.True(t, reporter.Report(replicasets))
+	assert.True(t, reporter.Report(replicasets))
+	assert.True(t, reporter.Report(namespaced))
+
+	assert.Equal(t, []MissingPermission{
+		{Verb: "list", Group: "apps", Resource: "replicasets"},
+		{Verb: "watch", Resource: "pods", Namespace: "default"},
+	}, reporter.Missing())
+
+	// A single warning per missing permission
+	logs := logp.ObserverLogs().TakeAll()
+	require.Len(t, logs, 2)
+	assert.Equal(t, "list apps/replicasets", logs[0].ContextMap()["permission"])
+	assert.Equal(t, "watch pods in namespace default", logs[1].ContextMap()["permission"])
+	assert.Equal(t, []interface{}{"list apps/replicasets", "watch pods in namespace default"}, logs[1].ContextMap()["missing_permissions"])
+
+	var nilReporter *PermissionReporter
+	assert.False(t, nilReporter.Report(replicasets))
+	assert.Nil(t, nilReporter.Missing())
+}
+
+func TestWatcherPermissions(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	client.PrependReactor("list", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "nodes"}, "", errors.New(`User "agent" cannot list resource "nodes" in API group "" at the cluster scope`))
+	})
+
+	reporter := NewPermissionReporter(nil)
+	w, err := NewWatcher(client, &Node{}, WatchOptions{Permissions: reporter}, nil)
+	require.NoError(t, err)
+	go func() { _ = w.Start() }()
+	defer w.Stop()
+
+	assert.Eventually(t, func() bool {
+		return len(reporter.Missing()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []MissingPermission{{Verb: "list", Resource: "nodes"}}, reporter.Missing())
+}
@@ -0,0 +1,422 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// shardingGroupLabel is set on membership Leases to find the live members of a sharding group
+const shardingGroupLabel = "elastic-agent-autodiscover/sharding-group"
+
+// Sharder splits the responsibility of cluster-scope watches across several instances.
+// Objects are assigned to shards by hashing their namespace (or their name for cluster
+// scoped objects), and every shard is coordinated through its own Lease. Live instances
+// balance the shards among them, so each one only handles the events of its shards.
+type Sharder interface {
+	// Start contending for shards
+	Start()
+
+	// Stop releases all the held shards
+	Stop()
+
+	// Owns returns true if the object belongs to a shard held by this instance, it can be
+	// used as the FilterFunc of a FilteringResourceEventHandler
+	Owns(obj interface{}) bool
+
+	// OwnedShards returns the sorted list of shards held by this instance
+	OwnedShards() []int
+}
+
+// ShardingConfig configures how watched objects are split across instances
+type ShardingConfig struct {
+	// Shards is the number of shards objects are split into
+	Shards int `config:"shards"`
+	// LeasePrefix is used to name the Leases coordinating the shards, it identifies the sharding group
+	LeasePrefix string `config:"lease_prefix"`
+	// Namespace of the Leases, defaults to the namespace of the running pod
+	Namespace string `config:"namespace"`
+	// Identity of this instance, if not set it is composed as for LeaderElectionConfig
+	Identity string `config:"identity"`
+	// IdentityHostname overrides the pod name used to compose the identity
+	IdentityHostname string `config:"leader_identity_hostname"`
+	// IdentityPodUID appends the pod UID to the composed identity
+	IdentityPodUID bool `config:"leader_identity_pod_uid"`
+
+	LeaseTimings `config:",inline"`
+}
+
+type sharder struct {
+	sync.RWMutex
+	client    kubernetes.Interface
+	config    ShardingConfig
+	namespace string
+	identity  string
+	owned     map[int]bool          // shard -> held, false entries are not held
+	electors  map[int]*shardElector // shard -> running election, nil entries are not running
+	onChange  func(owned []int)
+	changed   chan struct{} // coalesces the changes of owned shards not notified yet
+	closed    sync.Once
+	notified  sync.WaitGroup
+	ctx       context.Context
+	stop      context.CancelFunc
+	stopped   sync.WaitGroup
+	logger    *logp.Logger
+	timings   LeaseTimings
+}
+
+// shardElector holds the election of a single shard
+type shardElector struct {
+	shard  int
+	cancel context.CancelFunc
+}
+
+// NewSharder creates a Sharder for the given config. onChange, if not nil, is called with the new
+// list of owned shards every time this instance acquires or loses a shard, so that consumers can
+// re-evaluate the objects they are handling. Calls are sequential and in order, changes happening
+// while a call is running are coalesced in the next one, with the latest list of owned shards.
+// Unset timings take the default values.
+func NewSharder(client kubernetes.Interface, cfg ShardingConfig, onChange func(owned []int)) (Sharder, error) {
+	if cfg.Shards < 1 {
+		return nil, fmt.Errorf("number of shards must be greater than zero, got %d", cfg.Shards)
+	}
+	if cfg.LeasePrefix == "" {
+		return nil, fmt.Errorf("sharding lease prefix is required")
+	}
+	timings := cfg.LeaseTimings.withDefaults()
+	if err := timings.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid sharding lease timings: %w", err)
+	}
+
+	namespace, err := leaseNamespace(cfg.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := leaseIdentity(client, namespace, LeaderElectionConfig{
+		Identity:         cfg.Identity,
+		IdentityHostname: cfg.IdentityHostname,
+		IdentityPodUID:   cfg.IdentityPodUID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	return &sharder{
+		client:    client,
+		config:    cfg,
+		namespace: namespace,
+		identity:  identity,
+		owned:     make(map[int]bool),
+		electors:  make(map[int]*shardElector),
+		onChange:  onChange,
+		changed:   make(chan struct{}, 1),
+		ctx:       ctx,
+		stop:      cancel,
+		logger:    logp.NewLogger("kubernetes.sharding"),
+		timings:   timings,
+	}, nil
+}
+
+// ShardOf returns the shard an object belongs to. Namespaced objects are assigned by namespace so
+// that all the objects of a namespace are handled by the same instance.
+func ShardOf(obj interface{}, shards int) int {
+	if deleted, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = deleted.Obj
+	}
+	if shards <= 1 {
+		return 0
+	}
+
+	key := ""
+	if o, ok := obj.(metav1.Object); ok {
+		key = o.GetNamespace()
+		if key == "" {
+			key = o.GetName()
+		}
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(shards))
+}
+
+// Start contending for shards
+func (s *sharder) Start() {
+	if s.onChange != nil {
+		s.notified.Add(1)
+		go s.notifier()
+	}
+	s.stopped.Add(1)
+	go func() {
+		defer s.stopped.Done()
+		wait.Until(s.rebalance, s.timings.RetryPeriod, s.ctx.Done())
+	}()
+}
+
+// Stop releases all the held shards
+func (s *sharder) Stop() {
+	s.stop()
+	s.stopped.Wait()
+
+	// No more changes after the elections are stopped, the notifier delivers the pending one
+	s.closed.Do(func() { close(s.changed) })
+	s.notified.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timings.RenewDeadline)
+	defer cancel()
+	err := s.client.CoordinationV1().Leases(s.namespace).Delete(ctx, s.memberLeaseName(), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		s.logger.Debugf("unable to delete membership lease %s: %v", s.memberLeaseName(), err)
+	}
+}
+
+// Owns returns true if the object belongs to a shard held by this instance
+func (s *sharder) Owns(obj interface{}) bool {
+	shard := ShardOf(obj, s.config.Shards)
+
+	s.RLock()
+	defer s.RUnlock()
+	return s.owned[shard]
+}
+
+// OwnedShards returns the sorted list of shards held by this instance
+func (s *sharder) OwnedShards() []int {
+	s.RLock()
+	defer s.RUnlock()
+	return s.ownedShards()
+}
+
+func (s *sharder) ownedShards() []int {
+	owned := make([]int, 0, len(s.owned))
+	for shard, held := range s.owned {
+		if held {
+			owned = append(owned, shard)
+		}
+	}
+	sort.Ints(owned)
+	return owned
+}
+
+// rebalance renews the membership of this instance and adjusts the set of contended shards so
+// that every live member holds at most its fair share.
+func (s *sharder) rebalance() {
+	members, err := s.renewMembership()
+	if err != nil {
+		s.logger.Errorf("unable to renew sharding membership: %v", err)
+		members = 1
+	}
+	target := (s.config.Shards + members - 1) / members
+
+	s.Lock()
+	defer s.Unlock()
+
+	owned := s.ownedShards()
+	if len(owned) > target {
+		// Release the highest shards, other members contend for them.
+		for _, shard := range owned[target:] {
+			s.logger.Debugf("releasing shard %d, %d members share %d shards", shard, members, s.config.Shards)
+			s.electors[shard].cancel()
+			s.electors[shard] = nil
+			s.owned[shard] = false
+		}
+		s.notify()
+		return
+	}
+
+	for shard := 0; shard < s.config.Shards; shard++ {
+		if s.owned[shard] {
+			continue
+		}
+		e := s.electors[shard]
+		contending := e != nil
+		switch {
+		case len(owned) < target && !contending:
+			if err := s.contend(shard); err != nil {
+				s.logger.Errorf("unable to contend for shard %d: %v", shard, err)
+			}
+		case len(owned) >= target && contending:
+			e.cancel()
+			s.electors[shard] = nil
+		}
+	}
+}
+
+// contend starts the election of a shard, it must be called with the lock held
+func (s *sharder) contend(shard int) error {
+	// Membership is tracked with Leases, so shards are always locked with Leases too.
+	lock, err := newLock(s.client, LeaderElectionConfig{
+		LeaseName: fmt.Sprintf("%s-%d", s.config.LeasePrefix, shard),
+		Namespace: s.namespace,
+		Identity:  s.identity,
+		LockType:  resourcelock.LeasesResourceLock,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	e := &shardElector{shard: shard, cancel: cancel}
+	le, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   s.timings.LeaseDuration,
+		RenewDeadline:   s.timings.RenewDeadline,
+		RetryPeriod:     s.timings.RetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            lock.Describe(),
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(context.Context) { s.acquired(e) },
+			OnStoppedLeading: func() { s.lost(e) },
+		},
+	})
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	s.electors[shard] = e
+	s.stopped.Add(1)
+	go func() {
+		defer s.stopped.Done()
+		le.Run(ctx)
+	}()
+	return nil
+}
+
+func (s *sharder) acquired(e *shardElector) {
+	s.Lock()
+	defer s.Unlock()
+
+	// The election may have been cancelled in the meantime, it releases the Lease in that case.
+	if s.electors[e.shard] != e || s.ctx.Err() != nil {
+		return
+	}
+	s.logger.Debugf("shard %d acquired by %s", e.shard, s.identity)
+	s.owned[e.shard] = true
+	s.notify()
+}
+
+func (s *sharder) lost(e *shardElector) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.electors[e.shard] != e {
+		return
+	}
+	s.electors[e.shard] = nil
+	if s.owned[e.shard] {
+		s.logger.Debugf("shard %d lost by %s", e.shard, s.identity)
+		s.owned[e.shard] = false
+		s.notify()
+	}
+}
+
+// notify signals a change of the owned shards to the notifier, without blocking
+func (s *sharder) notify() {
+	select {
+	case s.changed <- struct{}{}:
+	default:
+		// A change is already pending, the notifier will read the latest owned shards
+	}
+}
+
+// notifier calls the change callback with the owned shards after every change, outside of the lock
+func (s *sharder) notifier() {
+	defer s.notified.Done()
+	for range s.changed {
+		s.onChange(s.OwnedShards())
+	}
+}
+
+func (s *sharder) memberLeaseName() string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(s.identity))
+	return fmt.Sprintf("%s-member-%08x", s.config.LeasePrefix, h.Sum32())
+}
+
+// renewMembership renews the membership Lease of this instance and returns the number of live members
+func (s *sharder) renewMembership() (int, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, s.timings.RenewDeadline)
+	defer cancel()
+
+	leases := s.client.CoordinationV1().Leases(s.namespace)
+	now := metav1.NewMicroTime(time.Now())
+	// Rounded up, so members are not considered gone before their lease duration
+	duration := int32((s.timings.LeaseDuration + time.Second - 1) / time.Second)
+
+	lease, err := leases.Get(ctx, s.memberLeaseName(), metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		_, err = leases.Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      s.memberLeaseName(),
+				Namespace: s.namespace,
+				Labels:    map[string]string{shardingGroupLabel: s.config.LeasePrefix},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &s.identity,
+				LeaseDurationSeconds: &duration,
+				RenewTime:            &now,
+			},
+		}, metav1.CreateOptions{})
+	case err == nil:
+		lease.Spec.HolderIdentity = &s.identity
+		lease.Spec.LeaseDurationSeconds = &duration
+		lease.Spec.RenewTime = &now
+		_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	list, err := leases.List(ctx, metav1.ListOptions{LabelSelector: shardingGroupLabel + "=" + s.config.LeasePrefix})
+	if err != nil {
+		return 0, err
+	}
+
+	members := 0
+	for _, l := range list.Items {
+		if l.Spec.RenewTime == nil || l.Spec.LeaseDurationSeconds == nil {
+			continue
+		}
+		expiry := l.Spec.RenewTime.Add(time.Duration(*l.Spec.LeaseDurationSeconds) * time.Second)
+		if expiry.After(now.Time) {
+			members++
+		}
+	}
+	if members == 0 {
+		members = 1
+	}
+	return members, nil
+}
@@ -0,0 +1,182 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestShardOf(t *testing.T) {
+	pod1 := &Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "ns"}}
+	pod2 := &Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod2", Namespace: "ns"}}
+	node := &Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}}
+
+	for i := 0; i < 10; i++ {
+		shard := ShardOf(node, 7)
+		assert.True(t, shard >= 0 && shard < 7)
+		assert.Equal(t, shard, ShardOf(node, 7))
+	}
+
+	// All the objects in a namespace belong to the same shard
+	assert.Equal(t, ShardOf(pod1, 16), ShardOf(pod2, 16))
+	assert.Equal(t, ShardOf(pod1, 16), ShardOf(cache.DeletedFinalStateUnknown{Key: "ns/pod1", Obj: pod1}, 16))
+	assert.Equal(t, 0, ShardOf(pod1, 1))
+}
+
+func TestNewSharderValidation(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+
+	_, err := NewSharder(client, ShardingConfig{Shards: 0, LeasePrefix: "autodiscover", Namespace: "kube-system", Identity: "a"}, nil)
+	assert.Error(t, err)
+
+	_, err = NewSharder(client, ShardingConfig{Shards: 2, Namespace: "kube-system", Identity: "a"}, nil)
+	assert.Error(t, err)
+
+	_, err = NewSharder(client, ShardingConfig{Shards: 2, LeasePrefix: "autodiscover", Namespace: "kube-system", Identity: "a"}, nil)
+	assert.NoError(t, err)
+}
+
+func TestSharderSingleInstanceOwnsAllShards(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	s := newTestSharder(t, client, "agent-a", 3)
+
+	s.Start()
+	assert.Eventually(t, func() bool {
+		return len(s.OwnedShards()) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.True(t, s.Owns(&Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "ns"}}))
+
+	s.Stop()
+	assert.Empty(t, s.OwnedShards())
+
+	// Leases are released on stop
+	leases, err := client.CoordinationV1().Leases("kube-system").List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	for _, l := range leases.Items {
+		if l.Spec.HolderIdentity != nil {
+			assert.Empty(t, *l.Spec.HolderIdentity, l.Name)
+		}
+	}
+}
+
+func TestSharderSplitsShardsBetweenInstances(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	a := newTestSharder(t, client, "agent-a", 4)
+	b := newTestSharder(t, client, "agent-b", 4)
+
+	a.Start()
+	defer a.Stop()
+	assert.Eventually(t, func() bool {
+		return len(a.OwnedShards()) == 4
+	}, 5*time.Second, 10*time.Millisecond)
+
+	b.Start()
+	defer b.Stop()
+	assert.Eventually(t, func() bool {
+		return len(a.OwnedShards()) == 2 && len(b.OwnedShards()) == 2
+	}, 10*time.Second, 10*time.Millisecond)
+
+	for _, shard := range a.OwnedShards() {
+		assert.NotContains(t, b.OwnedShards(), shard)
+	}
+}
+
+func TestSharderNotifiesChangesInOrder(t *testing.T) {
+	var lock sync.Mutex
+	var calls [][]int
+	running := int32(0)
+	onChange := func(owned []int) {
+		// Calls never overlap
+		assert.Equal(t, int32(1), atomic.AddInt32(&running, 1))
+		defer atomic.AddInt32(&running, -1)
+		lock.Lock()
+		defer lock.Unlock()
+		calls = append(calls, owned)
+	}
+	last := func() []int {
+		lock.Lock()
+		defer lock.Unlock()
+		if len(calls) == 0 {
+			return nil
+		}
+		return calls[len(calls)-1]
+	}
+
+	client := k8sfake.NewSimpleClientset()
+	s := newTestSharderWithCallback(t, client, "agent-a", 3, onChange)
+	s.Start()
+	assert.Eventually(t, func() bool {
+		return len(last()) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The last notification is the empty list of shards after they are released
+	s.Stop()
+	assert.Equal(t, []int{}, last())
+}
+
+func TestSharderMembershipLeaseDuration(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	s, err := NewSharder(client, ShardingConfig{
+		Shards:       2,
+		LeasePrefix:  "autodiscover",
+		Namespace:    "kube-system",
+		Identity:     "agent-a",
+		LeaseTimings: LeaseTimings{LeaseDuration: 1500 * time.Millisecond, RenewDeadline: time.Second, RetryPeriod: 50 * time.Millisecond},
+	}, nil)
+	require.NoError(t, err)
+
+	members, err := s.(*sharder).renewMembership()
+	require.NoError(t, err)
+	assert.Equal(t, 1, members)
+
+	// Lease durations are rounded up to whole seconds
+	lease, err := client.CoordinationV1().Leases("kube-system").Get(context.Background(), s.(*sharder).memberLeaseName(), metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), *lease.Spec.LeaseDurationSeconds)
+}
+
+func newTestSharder(t *testing.T, client kubernetes.Interface, identity string, shards int) Sharder {
+	return newTestSharderWithCallback(t, client, identity, shards, nil)
+}
+
+func newTestSharderWithCallback(t *testing.T, client kubernetes.Interface, identity string, shards int, onChange func([]int)) Sharder {
+	s, err := NewSharder(client, ShardingConfig{
+		Shards:      shards,
+		LeasePrefix: "autodiscover",
+		Namespace:   "kube-system",
+		Identity:    identity,
+		LeaseTimings: LeaseTimings{
+			LeaseDuration: 2 * time.Second,
+			RenewDeadline: time.Second,
+			RetryPeriod:   50 * time.Millisecond,
+		},
+	}, onChange)
+	require.NoError(t, err)
+	return s
+}
@@ -0,0 +1,57 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// SignificantChange is a significance function for WatchOptions.IsSignificant, it returns false
+// for the updates that only change fields irrelevant to metadata: the resource version and
+// managed fields of objects, and the heartbeat and probe times of the conditions of nodes and pods.
+func SignificantChange(o, n interface{}) bool {
+	old, ok := o.(runtime.Object)
+	if !ok {
+		return true
+	}
+	updated, ok := n.(runtime.Object)
+	if !ok {
+		return true
+	}
+	old, updated = old.DeepCopyObject(), updated.DeepCopyObject()
+	for _, obj := range []runtime.Object{old, updated} {
+		if o, err := meta.Accessor(obj); err == nil {
+			o.SetResourceVersion("")
+			o.SetManagedFields(nil)
+		}
+		switch obj := obj.(type) {
+		case *Node:
+			for i := range obj.Status.Conditions {
+				obj.Status.Conditions[i].LastHeartbeatTime = metav1.Time{}
+			}
+		case *Pod:
+			for i := range obj.Status.Conditions {
+				obj.Status.Conditions[i].LastProbeTime = metav1.Time{}
+			}
+		}
+	}
+	return !equality.Semantic.DeepEqual(old, updated)
+}
@@ -0,0 +1,120 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/elastic/elastic-agent-autodiscover/metrics"
+)
+
+func TestSignificantChange(t *testing.T) {
+	node := &Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node", ResourceVersion: "1", Labels: map[string]string{"zone": "a"}},
+		Status: v1.NodeStatus{Conditions: []v1.NodeCondition{
+			{Type: v1.NodeReady, Status: v1.ConditionTrue, LastHeartbeatTime: metav1.NewTime(time.Unix(1, 0))},
+		}},
+	}
+
+	heartbeat := node.DeepCopy()
+	heartbeat.ResourceVersion = "2"
+	heartbeat.ManagedFields = []metav1.ManagedFieldsEntry{{Manager: "kubelet"}}
+	heartbeat.Status.Conditions[0].LastHeartbeatTime = metav1.NewTime(time.Unix(2, 0))
+	assert.False(t, SignificantChange(node, heartbeat))
+
+	notReady := heartbeat.DeepCopy()
+	notReady.Status.Conditions[0].Status = v1.ConditionFalse
+	assert.True(t, SignificantChange(node, notReady))
+
+	relabeled := heartbeat.DeepCopy()
+	relabeled.Labels["zone"] = "b"
+	assert.True(t, SignificantChange(node, relabeled))
+
+	// Objects are not modified
+	assert.Equal(t, "2", heartbeat.ResourceVersion)
+	assert.Equal(t, int64(2), heartbeat.Status.Conditions[0].LastHeartbeatTime.Unix())
+
+	pod := &Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", ResourceVersion: "1"}}
+	probed := pod.DeepCopy()
+	probed.ResourceVersion = "2"
+	probed.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, LastProbeTime: metav1.NewTime(time.Unix(1, 0))}}
+	assert.True(t, SignificantChange(pod, probed))
+	reprobed := probed.DeepCopy()
+	reprobed.Status.Conditions[0].LastProbeTime = metav1.NewTime(time.Unix(2, 0))
+	assert.False(t, SignificantChange(probed, reprobed))
+
+	assert.True(t, SignificantChange("not", "objects"))
+}
+
+func TestWatcherFiltersInsignificantUpdates(t *testing.T) {
+	node := &Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node", ResourceVersion: "1"},
+		Status: v1.NodeStatus{Conditions: []v1.NodeCondition{
+			{Type: v1.NodeReady, Status: v1.ConditionTrue, LastHeartbeatTime: metav1.NewTime(time.Unix(1, 0))},
+		}},
+	}
+	client := k8sfake.NewSimpleClientset(node)
+	registry := metrics.NewInMemory()
+
+	var mutex sync.Mutex
+	var dropped []DroppedEvent
+	w, err := NewNamedWatcher("nodes", client, &Node{}, WatchOptions{
+		IsSignificant: SignificantChange,
+		Metrics:       registry,
+		OnDrop: func(e DroppedEvent) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			dropped = append(dropped, e)
+		},
+	}, nil)
+	require.NoError(t, err)
+	updated := make(chan struct{}, 1)
+	w.AddEventHandler(ResourceEventHandlerFuncs{
+		UpdateFunc: func(interface{}) { updated <- struct{}{} },
+	})
+	require.NoError(t, w.Start())
+	defer w.Stop()
+
+	heartbeat := node.DeepCopy()
+	heartbeat.ResourceVersion = "2"
+	heartbeat.Status.Conditions[0].LastHeartbeatTime = metav1.NewTime(time.Unix(2, 0))
+	_, err = client.CoreV1().Nodes().Update(context.Background(), heartbeat, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		filtered, _ := registry.Value("autodiscover_kubernetes_watcher_filtered_updates_total", "nodes")
+		return filtered == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	select {
+	case <-updated:
+		t.Fatal("insignificant update handled")
+	default:
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Empty(t, dropped)
+}
@@ -0,0 +1,79 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import "time"
+
+// PodTerminalState is the final state of a pod, as known when it is deleted
+type PodTerminalState struct {
+	// DeletionTimestamp is the time the pod was requested to be deleted at, nil if it was not
+	DeletionTimestamp *time.Time
+	Phase             string
+	Reason            string
+	Message           string
+	// Containers are the containers of the pod that have terminated
+	Containers []ContainerTerminalState
+}
+
+// ContainerTerminalState is the last termination of a container
+type ContainerTerminalState struct {
+	Name       string
+	Type       ContainerType
+	ID         string
+	Reason     string
+	Message    string
+	ExitCode   int32
+	Signal     int32
+	Restarts   int32
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// GetPodTerminalState returns the final state of a pod, to enrich the last events of a pod
+// being deleted. Containers that are still running are not included.
+func GetPodTerminalState(pod *Pod) PodTerminalState {
+	state := PodTerminalState{
+		Phase:   string(pod.Status.Phase),
+		Reason:  pod.Status.Reason,
+		Message: pod.Status.Message,
+	}
+	if ts := pod.GetDeletionTimestamp(); ts != nil {
+		deletion := ts.Time
+		state.DeletionTimestamp = &deletion
+	}
+
+	for _, c := range GetContainersInPod(pod) {
+		terminated := c.Status.State.Terminated
+		if terminated == nil {
+			continue
+		}
+		state.Containers = append(state.Containers, ContainerTerminalState{
+			Name:       c.Spec.Name,
+			Type:       c.Type,
+			ID:         c.ID,
+			Reason:     terminated.Reason,
+			Message:    terminated.Message,
+			ExitCode:   terminated.ExitCode,
+			Signal:     terminated.Signal,
+			Restarts:   c.Status.RestartCount,
+			StartedAt:  terminated.StartedAt.Time,
+			FinishedAt: terminated.FinishedAt.Time,
+		})
+	}
+	return state
+}
@@ -29,6 +29,7 @@ import (
 	rbacv1 "k8s.io/api/rbac/v1"
 	storagev1 "k8s.io/api/storage/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -41,6 +42,9 @@ type ObjectMeta = metav1.ObjectMeta
 // Pod data
 type Pod = v1.Pod
 
+// PodList data
+type PodList = v1.PodList
+
 // PodSpec data
 type PodSpec = v1.PodSpec
 
@@ -116,6 +120,9 @@ type PodSecurityPolicy = policyv1beta1.PodSecurityPolicy
 // NetworkPolicy data
 type NetworkPolicy = networkingv1.NetworkPolicy
 
+// CustomResource data, instances of custom resource definitions are handled as unstructured objects
+type CustomResource = unstructured.Unstructured
+
 const (
 	// PodPending phase
 	PodPending = v1.PodPending
@@ -0,0 +1,106 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+)
+
+// StoreUsage is the approximate memory usage of the objects of a store
+type StoreUsage struct {
+	// Objects is the number of objects in the store
+	Objects int
+
+	// Bytes is the approximate size of the objects, as the size of their protobuf encoding, or of
+	// the keys and values of unstructured objects. Objects are larger in memory, but the size
+	// grows with it.
+	Bytes int64
+}
+
+// WatcherUsage is the approximate memory usage of a watcher
+type WatcherUsage struct {
+	StoreUsage
+
+	// Queued is the number of events queued to be handled
+	Queued int
+}
+
+// sizer is implemented by the protobuf generated API types
+type sizer interface {
+	Size() int
+}
+
+// MeasureStore returns the approximate memory usage of the objects of a store, it lists all the
+// objects, so it should not be called on every event
+func MeasureStore(store cache.Store) StoreUsage {
+	var usage StoreUsage
+	if store == nil {
+		return usage
+	}
+	for _, obj := range store.List() {
+		usage.Objects++
+		usage.Bytes += ApproxObjectSize(obj)
+	}
+	return usage
+}
+
+// MeasureWatcher returns the approximate memory usage of the store of a watcher and the number
+// of events queued by watchers of this package
+func MeasureWatcher(w Watcher) WatcherUsage {
+	usage := WatcherUsage{StoreUsage: MeasureStore(w.Store())}
+	if w, ok := w.(*watcher); ok {
+		usage.Queued = w.queue.Len()
+	}
+	return usage
+}
+
+// ApproxObjectSize returns the approximate size of an API object, zero if unknown
+func ApproxObjectSize(obj interface{}) int64 {
+	switch obj := obj.(type) {
+	case sizer:
+		return int64(obj.Size())
+	case *unstructured.Unstructured:
+		return approxValueSize(obj.Object)
+	case cache.DeletedFinalStateUnknown:
+		return ApproxObjectSize(obj.Obj)
+	}
+	return 0
+}
+
+// approxValueSize returns the approximate size of the keys and values of unstructured content
+func approxValueSize(v interface{}) int64 {
+	switch v := v.(type) {
+	case string:
+		return int64(len(v))
+	case map[string]interface{}:
+		var size int64
+		for k, value := range v {
+			size += int64(len(k)) + approxValueSize(value)
+		}
+		return size
+	case []interface{}:
+		var size int64
+		for _, value := range v {
+			size += approxValueSize(value)
+		}
+		return size
+	}
+	// Numbers and booleans
+	return 8
+}
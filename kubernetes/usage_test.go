@@ -0,0 +1,65 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestMeasureStore(t *testing.T) {
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	assert.Equal(t, StoreUsage{}, MeasureStore(store))
+
+	pod := &Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Labels: map[string]string{"app": "web"}}}
+	require.NoError(t, store.Add(pod))
+	usage := MeasureStore(store)
+	assert.Equal(t, 1, usage.Objects)
+	assert.Equal(t, int64(pod.Size()), usage.Bytes)
+
+	// Larger objects use more memory
+	large := pod.DeepCopy()
+	large.Name = "large"
+	large.Annotations = map[string]string{}
+	for _, k := range []string{"a", "b", "c", "d"} {
+		large.Annotations[k] = "a long annotation value of the large pod"
+	}
+	require.NoError(t, store.Add(large))
+	usage = MeasureStore(store)
+	assert.Equal(t, 2, usage.Objects)
+	assert.Greater(t, usage.Bytes, 2*int64(pod.Size()))
+
+	assert.Equal(t, StoreUsage{}, MeasureStore(nil))
+}
+
+func TestApproxObjectSize(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":     "Widget",
+		"metadata": map[string]interface{}{"name": "w"},
+		"spec":     map[string]interface{}{"replicas": int64(3), "ports": []interface{}{"http"}},
+	}}
+	// Keys and values: kind Widget metadata name w spec replicas 8 ports http
+	assert.Equal(t, int64(4+6+8+4+1+4+8+8+5+4), ApproxObjectSize(obj))
+	assert.Equal(t, ApproxObjectSize(obj), ApproxObjectSize(cache.DeletedFinalStateUnknown{Obj: obj}))
+	assert.Equal(t, int64(0), ApproxObjectSize("unknown"))
+}
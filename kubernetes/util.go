@@ -25,7 +25,9 @@ import (
 	"os"
 	"strings"
 
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	restclient "k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -75,6 +77,7 @@ func GetKubernetesClient(kubeconfig string, opt KubeClientOptions) (kubernetes.I
 	}
 	cfg.QPS = opt.QPS
 	cfg.Burst = opt.Burst
+	WrapAudit(cfg, opt.Audit, nil)
 	client, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("unable to build kubernetes clientset: %w", err)
@@ -83,6 +86,27 @@ func GetKubernetesClient(kubeconfig string, opt KubeClientOptions) (kubernetes.I
 	return client, nil
 }
 
+// GetKubernetesDynamicClient returns a dynamic client, used to watch custom resources
+func GetKubernetesDynamicClient(kubeconfig string, opt KubeClientOptions) (dynamic.Interface, error) {
+	if kubeconfig == "" {
+		kubeconfig = GetKubeConfigEnvironmentVariable()
+	}
+
+	cfg, err := BuildConfig(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to build kube config due to error: %w", err)
+	}
+	cfg.QPS = opt.QPS
+	cfg.Burst = opt.Burst
+	WrapAudit(cfg, opt.Audit, nil)
+	client, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to build kubernetes dynamic client: %w", err)
+	}
+
+	return client, nil
+}
+
 // BuildConfig is a helper function that builds configs from a kubeconfig filepath.
 // If kubeconfigPath is not passed in we fallback to inClusterConfig.
 // If inClusterConfig fails, we fallback to the default config.
@@ -226,29 +250,48 @@ func InClusterNamespace() (string, error) {
 	return strings.TrimSpace(string(data)), nil
 }
 
+// ContainerType is the kind of a container in a pod
+type ContainerType string
+
+const (
+	// ContainerTypeContainer is a regular container of a pod
+	ContainerTypeContainer ContainerType = "container"
+	// ContainerTypeInit is an init container, that runs to completion before the regular ones
+	ContainerTypeInit ContainerType = "init"
+	// ContainerTypeSidecar is a restartable init container (restartPolicy Always), that keeps
+	// running along with the regular containers
+	ContainerTypeSidecar ContainerType = "sidecar"
+	// ContainerTypeEphemeral is an ephemeral container, added to a running pod for debugging
+	ContainerTypeEphemeral ContainerType = "ephemeral"
+)
+
 type ContainerInPod struct {
 	ID      string
 	Runtime string
+	Type    ContainerType
 	Spec    Container
 	Status  PodContainerStatus
 }
 
 // GetContainersInPod returns all the containers defined in a pod and their statuses.
-// It includes init and ephemeral containers.
+// It includes init, sidecar and ephemeral containers.
 func GetContainersInPod(pod *Pod) []*ContainerInPod {
 	containers := make([]*ContainerInPod, len(pod.Spec.Containers)+len(pod.Spec.InitContainers)+len(pod.Spec.EphemeralContainers))
 	idx := 0
 	for _, c := range pod.Spec.Containers {
-		containers[idx] = &ContainerInPod{Spec: c}
+		containers[idx] = &ContainerInPod{Spec: c, Type: ContainerTypeContainer}
 		idx++
 	}
 	for _, c := range pod.Spec.InitContainers {
-		containers[idx] = &ContainerInPod{Spec: c}
+		containers[idx] = &ContainerInPod{Spec: c, Type: ContainerTypeInit}
+		if c.RestartPolicy != nil && *c.RestartPolicy == v1.ContainerRestartPolicyAlways {
+			containers[idx].Type = ContainerTypeSidecar
+		}
 		idx++
 	}
 	for _, c := range pod.Spec.EphemeralContainers {
 		c := Container(c.EphemeralContainerCommon)
-		containers[idx] = &ContainerInPod{Spec: c}
+		containers[idx] = &ContainerInPod{Spec: c, Type: ContainerTypeEphemeral}
 		idx++
 	}
 
@@ -321,3 +321,61 @@ func (hd *mockDiscoveryUtils) GetNamespace() (string, error) {
 func (hd *mockDiscoveryUtils) GetPodName() (string, error) {
 	return hd.podname, nil
 }
+
+func TestGetContainersInPod(t *testing.T) {
+	running := core.ContainerState{Running: &core.ContainerStateRunning{}}
+	waiting := core.ContainerState{Waiting: &core.ContainerStateWaiting{Reason: "PodInitializing"}}
+	completed := core.ContainerState{Terminated: &core.ContainerStateTerminated{ExitCode: 0}}
+	always := core.ContainerRestartPolicyAlways
+
+	pod := &Pod{
+		Spec: core.PodSpec{
+			Containers:     []core.Container{{Name: "app"}},
+			InitContainers: []core.Container{{Name: "migrate"}, {Name: "proxy", RestartPolicy: &always}},
+			EphemeralContainers: []core.EphemeralContainer{
+				{EphemeralContainerCommon: core.EphemeralContainerCommon{Name: "debug"}},
+			},
+		},
+		Status: core.PodStatus{
+			Phase: core.PodRunning,
+			ContainerStatuses: []core.ContainerStatus{
+				{Name: "app", ContainerID: "containerd://abc", State: running},
+			},
+			InitContainerStatuses: []core.ContainerStatus{
+				{Name: "migrate", ContainerID: "containerd://def", State: completed},
+				{Name: "proxy", ContainerID: "containerd://ghi", State: running},
+			},
+		},
+	}
+
+	types := func(pod *Pod) map[string]ContainerType {
+		types := make(map[string]ContainerType)
+		for _, c := range GetContainersInPod(pod) {
+			types[c.Spec.Name] = c.Type
+		}
+		return types
+	}
+
+	containers := GetContainersInPod(pod)
+	assert.Len(t, containers, 4)
+	assert.Equal(t, "abc", containers[0].ID)
+	assert.Equal(t, "containerd", containers[0].Runtime)
+	assert.Equal(t, map[string]ContainerType{
+		"app":     ContainerTypeContainer,
+		"migrate": ContainerTypeInit,
+		"proxy":   ContainerTypeSidecar,
+		"debug":   ContainerTypeEphemeral,
+	}, types(pod))
+
+	// Sidecars are classified by their restart policy, whatever their state
+	pod.Status.Phase = core.PodPending
+	pod.Status.ContainerStatuses[0].State = waiting
+	pod.Status.InitContainerStatuses[0].State = running
+	pod.Status.InitContainerStatuses[1].State = waiting
+	assert.Equal(t, ContainerTypeInit, types(pod)["migrate"])
+	assert.Equal(t, ContainerTypeSidecar, types(pod)["proxy"])
+
+	pod.Status.Phase = core.PodSucceeded
+	pod.Status.InitContainerStatuses[1].State = completed
+	assert.Equal(t, ContainerTypeSidecar, types(pod)["proxy"])
+}
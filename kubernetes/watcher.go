@@ -20,6 +20,8 @@ package kubernetes
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"sync"
 	"time"
 
 	"k8s.io/apimachinery/pkg/api/meta"
@@ -30,6 +32,8 @@ import (
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 
+	"github.com/elastic/elastic-agent-autodiscover/metrics"
+	"github.com/elastic/elastic-agent-autodiscover/utils"
 	"github.com/elastic/elastic-agent-libs/logp"
 )
 
@@ -74,6 +78,23 @@ type WatchOptions struct {
 	IsUpdated func(old, new interface{}) bool
 	// HonorReSyncs allows resync events to be requeued on the worker
 	HonorReSyncs bool
+	// IsSignificant drops the updates for which it returns false, e.g. SignificantChange to drop
+	// the updates that don't change metadata, they are counted in the metrics and not reported
+	// to OnDrop, as they are not lost
+	IsSignificant func(old, new interface{}) bool
+	// Metrics receives the queued and filtered events, queue depth, handling durations and sync
+	// state of the watcher, labeled with the name of the watcher, if set
+	Metrics metrics.Registry
+	// Logger is the logger of the watcher, e.g. the watcher logger of utils.Loggers, a logger
+	// named "kubernetes" is used if nil
+	Logger *logp.Logger
+	// OnDrop is called when events may have been lost, with the reason, if set
+	OnDrop DropHandler
+	// Watchdog logs the handlers of the events that take too long, if set
+	Watchdog *utils.Watchdog
+	// Permissions collects the RBAC permissions missing for the requests of the watcher, their
+	// errors are then reported once instead of logged on every retry, if set
+	Permissions *PermissionReporter
 }
 
 type item struct {
@@ -85,12 +106,23 @@ type item struct {
 type watcher struct {
 	client   kubernetes.Interface
 	informer cache.SharedInformer
+	objType  reflect.Type
 	store    cache.Store
 	queue    workqueue.Interface
 	ctx      context.Context
 	stop     context.CancelFunc
 	handler  ResourceEventHandler
 	logger   *logp.Logger
+	metrics  *watcherMetrics
+	errors   recentErrors
+	onDrop   DropHandler
+	watchdog *utils.Watchdog
+	perms    *PermissionReporter
+
+	syncMutex sync.Mutex
+	synced    time.Time
+
+	cascaded sync.Map // key -> UID of the objects deleted with their namespace
 }
 
 // NewWatcher initializes the watcher client to provide a events handler for
@@ -104,16 +136,18 @@ func NewWatcher(client kubernetes.Interface, resource Resource, opts WatchOption
 // client's workqueue that is used by the watcher. Workqueue name is important for exposing workqueue
 // metrics, if it is empty, its metrics will not be logged by the k8s client.
 func NewNamedWatcher(name string, client kubernetes.Interface, resource Resource, opts WatchOptions, indexers cache.Indexers) (Watcher, error) {
-	var store cache.Store
-	var queue workqueue.Interface
-
 	informer, _, err := NewInformer(client, resource, opts, indexers)
 	if err != nil {
 		return nil, err
 	}
+	return newInformerWatcher(name, client, informer, resource, opts), nil
+}
 
-	store = informer.GetStore()
-	queue = workqueue.NewNamed(name)
+// newInformerWatcher creates a watcher queueing the events of an informer of resources of the
+// type of resource
+func newInformerWatcher(name string, client kubernetes.Interface, informer cache.SharedInformer, resource Resource, opts WatchOptions) *watcher {
+	store := informer.GetStore()
+	queue := workqueue.NewNamed(name)
 
 	if opts.IsUpdated == nil {
 		opts.IsUpdated = func(o, n interface{}) bool {
@@ -125,18 +159,38 @@ func NewNamedWatcher(name string, client kubernetes.Interface, resource Resource
 		}
 	}
 
+	logger := opts.Logger
+	if logger == nil {
+		logger = logp.NewLogger("kubernetes")
+	}
+
 	ctx, cancel := context.WithCancel(context.TODO())
 	w := &watcher{
 		client:   client,
 		informer: informer,
+		objType:  reflect.TypeOf(resource),
 		store:    store,
 		queue:    queue,
 		ctx:      ctx,
 		stop:     cancel,
-		logger:   logp.NewLogger("kubernetes"),
+		logger:   logger,
 		handler:  NoOpEventHandlerFuncs{},
+		metrics:  newWatcherMetrics(opts.Metrics, name),
+		onDrop:   opts.OnDrop,
+		watchdog: opts.Watchdog,
+		perms:    opts.Permissions,
 	}
 
+	// The informer is not running yet, so setting the handler cannot fail
+	_ = w.informer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+		w.errors.add(err)
+		w.dropped(DroppedEvent{Reason: watchDropReason(err), Err: err})
+		if w.perms.Report(err) {
+			return
+		}
+		cache.DefaultWatchErrorHandler(r, err)
+	})
+
 	w.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(o interface{}) {
 			w.enqueue(o, add)
@@ -146,7 +200,12 @@ func NewNamedWatcher(name string, client kubernetes.Interface, resource Resource
 		},
 		UpdateFunc: func(o, n interface{}) {
 			if opts.IsUpdated(o, n) {
-				w.enqueue(n, update)
+				if opts.IsSignificant != nil && !opts.IsSignificant(o, n) {
+					// Filtered updates are not lost, the next significant update carries them
+					w.metrics.filteredUpdate()
+					return
+				}
+				w.enqueue(n, updateState(o, n))
 			} else if opts.HonorReSyncs {
 				// HonorReSyncs ensure that at the time when the kubernetes client does a "resync", i.e, a full list of all
 				// objects we make sure that autodiscover processes them. Why is this necessary? An effective control loop works
@@ -160,7 +219,7 @@ func NewNamedWatcher(name string, client kubernetes.Interface, resource Resource
 		},
 	})
 
-	return w, nil
+	return w
 }
 
 // AddEventHandler adds a resource handler to process each request that is coming into the watcher
@@ -183,10 +242,16 @@ func (w *watcher) Start() error {
 	go w.informer.Run(w.ctx.Done())
 
 	if !cache.WaitForCacheSync(w.ctx.Done(), w.informer.HasSynced) {
-		return fmt.Errorf("kubernetes informer unable to sync cache")
+		err := fmt.Errorf("kubernetes informer unable to sync cache")
+		w.errors.add(err)
+		return err
 	}
 
 	w.logger.Debugf("cache sync done")
+	w.metrics.setSynced(true)
+	w.syncMutex.Lock()
+	w.synced = time.Now()
+	w.syncMutex.Unlock()
 
 	// Wrap the process function with wait.Until so that if the controller crashes, it starts up again after a second.
 	go wait.Until(func() {
@@ -200,6 +265,14 @@ func (w *watcher) Start() error {
 func (w *watcher) Stop() {
 	w.queue.ShutDown()
 	w.stop()
+	w.metrics.setSynced(false)
+}
+
+// syncedAt returns the time when the store was synced, zero if it is not synced yet
+func (w *watcher) syncedAt() time.Time {
+	w.syncMutex.Lock()
+	defer w.syncMutex.Unlock()
+	return w.synced
 }
 
 // enqueue takes the most recent object that was received, figures out the namespace/name of the object
@@ -212,9 +285,38 @@ func (w *watcher) enqueue(obj interface{}, state string) {
 	}
 	if deleted, ok := obj.(cache.DeletedFinalStateUnknown); ok {
 		w.logger.Debugf("Enqueued DeletedFinalStateUnknown contained object: %+v", deleted.Obj)
-		obj = deleted.Obj
+		w.dropped(DroppedEvent{Reason: DropDeletedFinalStateUnknown, Key: key})
+		obj = w.deletedObject(key, deleted.Obj)
+	}
+	if w.skipCascaded(key, obj, state) {
+		return
 	}
 	w.queue.Add(&item{key, obj, state})
+	w.metrics.enqueued(state, w.queue.Len())
+}
+
+// deletedObject returns the last known state of an object deleted while the watch was disconnected,
+// or an object of the type of the watcher with only its namespace and name if it is unknown, so
+// delete handlers always receive objects of the resource of the watcher
+func (w *watcher) deletedObject(key string, last interface{}) interface{} {
+	if last != nil && (w.objType == nil || reflect.TypeOf(last) == w.objType) {
+		return last
+	}
+	if w.objType == nil || w.objType.Kind() != reflect.Ptr {
+		return last
+	}
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return last
+	}
+	obj := reflect.New(w.objType.Elem()).Interface()
+	o, err := meta.Accessor(obj)
+	if err != nil {
+		return last
+	}
+	o.SetNamespace(namespace)
+	o.SetName(name)
+	return obj
 }
 
 // process gets the top of the work queue and processes the object that is received.
@@ -237,9 +339,15 @@ func (w *watcher) process(_ context.Context) bool {
 		return false
 	}
 
+	start := time.Now()
+	defer func() { w.metrics.handled(entry.state, start, w.queue.Len()) }()
+	defer w.watchdog.Watch(entry.state + " of " + key)()
+
 	o, exists, err := w.store.GetByKey(key)
 	if err != nil {
-		utilruntime.HandleError(fmt.Errorf("getting object %#v from cache: %w", obj, err))
+		err = fmt.Errorf("getting object %#v from cache: %w", obj, err)
+		w.errors.add(err)
+		utilruntime.HandleError(err)
 		return true
 	}
 	if !exists {
@@ -247,6 +355,8 @@ func (w *watcher) process(_ context.Context) bool {
 			w.logger.Debugf("Object %+v was not found in the store, deleting anyway!", key)
 			// delete anyway in order to clean states
 			w.handler.OnDelete(entry.objectRaw)
+		} else {
+			w.dropped(DroppedEvent{Reason: DropObjectGone, Key: key})
 		}
 		return true
 	}
@@ -254,8 +364,8 @@ func (w *watcher) process(_ context.Context) bool {
 	switch entry.state {
 	case add:
 		w.handler.OnAdd(o)
-	case update:
-		w.handler.OnUpdate(o)
+	case update, endpointChange:
+		handleUpdate(w.handler, o, entry.state)
 	case delete:
 		w.handler.OnDelete(o)
 	}
@@ -0,0 +1,77 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kubernetes
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/elastic/elastic-agent-autodiscover/utils"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+func TestWatcherLogger(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+
+	w, err := NewWatcher(client, &Pod{}, WatchOptions{}, nil)
+	require.NoError(t, err)
+	assert.NotNil(t, w.(*watcher).logger)
+
+	logger := utils.NewLoggers(logp.NewLogger("autodiscover"), utils.LoggingConfig{}).Logger(utils.SubsystemWatcher)
+	w, err = NewWatcher(client, &Pod{}, WatchOptions{Logger: logger}, nil)
+	require.NoError(t, err)
+	assert.Same(t, logger, w.(*watcher).logger)
+}
+
+func TestWatcherDeletedFinalStateUnknown(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	w, err := NewWatcher(client, &Pod{}, WatchOptions{}, nil)
+	require.NoError(t, err)
+	watcher := w.(*watcher)
+
+	var deleted []interface{}
+	watcher.AddEventHandler(ResourceEventHandlerFuncs{DeleteFunc: func(obj interface{}) { deleted = append(deleted, obj) }})
+
+	pod := &Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", UID: "1"}}
+	watcher.enqueue(cache.DeletedFinalStateUnknown{Key: "default/web", Obj: pod}, delete)
+	watcher.enqueue(cache.DeletedFinalStateUnknown{Key: "default/db"}, delete)
+	watcher.enqueue(cache.DeletedFinalStateUnknown{Key: "default/api", Obj: "unexpected"}, delete)
+	for i := 0; i < 3; i++ {
+		assert.True(t, watcher.process(context.Background()))
+	}
+
+	assert.Equal(t, []interface{}{
+		pod,
+		&Pod{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"}},
+		&Pod{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default"}},
+	}, deleted)
+
+	// Custom resources
+	watcher.objType = reflect.TypeOf(&CustomResource{})
+	cr, ok := watcher.deletedObject("default/backup", nil).(*CustomResource)
+	require.True(t, ok)
+	assert.Equal(t, "backup", cr.GetName())
+	assert.Equal(t, "default", cr.GetNamespace())
+}
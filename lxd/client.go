@@ -0,0 +1,231 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package lxd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"time"
+)
+
+const (
+	defaultSyncPeriod = 5 * time.Second
+
+	requestTimeout = 30 * time.Second
+
+	// baseURL of the requests, the host is ignored as requests are sent to the socket
+	baseURL = "http://lxd"
+)
+
+// defaultSockets are the sockets tried in order when none is configured, the one of the snap
+// package first
+var defaultSockets = []string{
+	"/var/snap/lxd/common/lxd/unix.socket",
+	"/var/lib/lxd/unix.socket",
+}
+
+// Config of the LXD provider
+type Config struct {
+	// Socket is the path of the unix socket of the LXD daemon, by default the one in $LXD_DIR or
+	// the first existing default socket
+	Socket string `config:"socket"`
+
+	// Project whose instances are discovered, the default project if empty
+	Project string `config:"project"`
+
+	// ConfigKeys are glob patterns of the config keys of the instances to add to their metadata
+	ConfigKeys []string `config:"config_keys"`
+
+	// SyncPeriod is the time waited between listings of the instances
+	SyncPeriod time.Duration `config:"sync_period"`
+}
+
+// Validate the config
+func (c *Config) Validate() error {
+	for _, p := range c.ConfigKeys {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid lxd config key pattern %q: %w", p, err)
+		}
+	}
+	if c.SyncPeriod < 0 {
+		return fmt.Errorf("invalid lxd sync period %v", c.SyncPeriod)
+	}
+	return nil
+}
+
+// API is the subset of the LXD REST API used by the watcher
+type API interface {
+	// Instances returns the containers and virtual machines of the project, with their state
+	Instances(ctx context.Context) ([]Instance, error)
+}
+
+type client struct {
+	http    *http.Client
+	project string
+}
+
+// NewClient returns a client of the LXD REST API listening in the unix socket of the config
+func NewClient(cfg Config) (API, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	socket := cfg.Socket
+	if socket == "" {
+		socket = defaultSocket()
+	}
+	dialer := &net.Dialer{}
+	return &client{
+		http: &http.Client{
+			Timeout: requestTimeout,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+		project: cfg.Project,
+	}, nil
+}
+
+func defaultSocket() string {
+	if dir := os.Getenv("LXD_DIR"); dir != "" {
+		return path.Join(dir, "unix.socket")
+	}
+	for _, socket := range defaultSockets {
+		if _, err := os.Stat(socket); err == nil {
+			return socket
+		}
+	}
+	return defaultSockets[len(defaultSockets)-1]
+}
+
+// response is the envelope of all the responses of the API
+type response struct {
+	Type      string          `json:"type"`
+	Error     string          `json:"error"`
+	ErrorCode int             `json:"error_code"`
+	Metadata  json.RawMessage `json:"metadata"`
+}
+
+// instance as returned by the API with recursion=2
+type instance struct {
+	Name           string            `json:"name"`
+	Project        string            `json:"project"`
+	Type           string            `json:"type"`
+	Status         string            `json:"status"`
+	Architecture   string            `json:"architecture"`
+	Location       string            `json:"location"`
+	Profiles       []string          `json:"profiles"`
+	ExpandedConfig map[string]string `json:"expanded_config"`
+	CreatedAt      time.Time         `json:"created_at"`
+	LastUsedAt     time.Time         `json:"last_used_at"`
+	State          *struct {
+		Pid     int64 `json:"pid"`
+		Network map[string]struct {
+			Addresses []struct {
+				Family  string `json:"family"`
+				Address string `json:"address"`
+				Scope   string `json:"scope"`
+			} `json:"addresses"`
+		} `json:"network"`
+	} `json:"state"`
+}
+
+// Instances returns the containers and virtual machines of the project, with their state
+func (c *client) Instances(ctx context.Context) ([]Instance, error) {
+	query := url.Values{"recursion": {"2"}}
+	if c.project != "" {
+		query.Set("project", c.project)
+	}
+	var list []instance
+	if err := c.get(ctx, "/1.0/instances?"+query.Encode(), &list); err != nil {
+		return nil, fmt.Errorf("failed to list lxd instances: %w", err)
+	}
+
+	instances := make([]Instance, 0, len(list))
+	for _, i := range list {
+		instances = append(instances, newInstance(i))
+	}
+	return instances, nil
+}
+
+func (c *client) get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var r response
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<20)).Decode(&r); err != nil {
+		return fmt.Errorf("unexpected response with status %s: %w", resp.Status, err)
+	}
+	if r.Type == "error" {
+		return fmt.Errorf("%s (%d)", r.Error, r.ErrorCode)
+	}
+	if r.Type != "sync" {
+		return errors.New("unexpected response type " + r.Type)
+	}
+	return json.Unmarshal(r.Metadata, v)
+}
+
+func newInstance(i instance) Instance {
+	res := Instance{
+		Name:         i.Name,
+		Project:      i.Project,
+		Type:         i.Type,
+		Status:       i.Status,
+		Architecture: i.Architecture,
+		Location:     i.Location,
+		Profiles:     i.Profiles,
+		Config:       i.ExpandedConfig,
+		CreatedAt:    i.CreatedAt,
+		LastUsedAt:   i.LastUsedAt,
+	}
+	if res.Project == "" {
+		res.Project = "default"
+	}
+	if i.State != nil {
+		res.PID = i.State.Pid
+		for name, n := range i.State.Network {
+			if name == "lo" {
+				continue
+			}
+			for _, a := range n.Addresses {
+				if a.Scope == "global" {
+					res.IPs = append(res.IPs, a.Address)
+				}
+			}
+		}
+		sort.Strings(res.IPs)
+	}
+	return res
+}
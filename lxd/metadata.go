@@ -0,0 +1,75 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package lxd
+
+import (
+	"path"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// GenerateMetadata returns the metadata of an instance under the `lxd` key, with the config keys
+// matching some glob patterns, and the ECS container fields for containers
+func GenerateMetadata(i *Instance, configKeys []string) mapstr.M {
+	instance := mapstr.M{
+		"name":   i.Name,
+		"type":   i.Type,
+		"status": i.Status,
+	}
+	if i.Architecture != "" {
+		instance["architecture"] = i.Architecture
+	}
+	if i.Location != "" && i.Location != "none" {
+		instance["location"] = i.Location
+	}
+	if len(i.Profiles) > 0 {
+		instance["profiles"] = append([]string(nil), i.Profiles...)
+	}
+	if len(i.IPs) > 0 {
+		instance["ip"] = append([]string(nil), i.IPs...)
+	}
+
+	config := mapstr.M{}
+	for k, v := range i.Config {
+		for _, p := range configKeys {
+			if ok, _ := path.Match(p, k); ok {
+				// Keys are kept as they are, they are namespaced with dots like user.foo
+				config[k] = v
+				break
+			}
+		}
+	}
+	if len(config) > 0 {
+		instance["config"] = config
+	}
+
+	meta := mapstr.M{
+		"lxd": mapstr.M{
+			"project":  i.Project,
+			"instance": instance,
+		},
+	}
+	if i.Type == TypeContainer {
+		meta["container"] = mapstr.M{
+			"id":      i.Name,
+			"name":    i.Name,
+			"runtime": "lxd",
+		}
+	}
+	return meta
+}
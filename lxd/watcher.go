@@ -0,0 +1,194 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package lxd discovers the containers and virtual machines running in a LXD host, polling the
+// LXD REST API through its unix socket.
+package lxd
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+	"github.com/elastic/elastic-agent-autodiscover/internal/poll"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+const (
+	// Instance types
+	TypeContainer      = "container"
+	TypeVirtualMachine = "virtual-machine"
+
+	// StatusRunning is the status of running instances
+	StatusRunning = "Running"
+
+	maxBackoff = time.Minute
+)
+
+// Instance of LXD, a container or a virtual machine
+type Instance struct {
+	Name         string
+	Project      string
+	Type         string
+	Status       string
+	Architecture string
+	// Location is the cluster member running the instance
+	Location string
+	Profiles []string
+	// Config of the instance, expanded with the config of its profiles
+	Config     map[string]string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	// PID of the init process of containers or of the hypervisor of virtual machines
+	PID int64
+	// IPs are the global addresses of the instance
+	IPs []string
+}
+
+// instanceKey identifies an instance, names are unique per project
+func instanceKey(i *Instance) string {
+	return i.Project + "/" + i.Name
+}
+
+// Watcher polls the API and keeps a list of the running instances
+type Watcher interface {
+	// Start watching the instances
+	Start() error
+
+	// Stop watching the instances
+	Stop()
+
+	// Instances returns the running instances by project and name
+	Instances() map[string]*Instance
+
+	// ListenStart returns a bus listener to receive instance started events, with an `instance`
+	// key holding it. Restarted instances are stopped and started again.
+	ListenStart() bus.Listener
+
+	// ListenStop returns a bus listener to receive instance stopped events, with an `instance`
+	// key holding it
+	ListenStop() bus.Listener
+}
+
+type watcher struct {
+	sync.RWMutex
+	log       *logp.Logger
+	api       API
+	period    time.Duration
+	ctx       context.Context
+	stop      context.CancelFunc
+	instances map[string]*Instance
+	stopped   sync.WaitGroup
+	bus       bus.Bus
+}
+
+// NewWatcher creates a new Watcher of the instances of the API
+func NewWatcher(log *logp.Logger, api API, cfg Config) (Watcher, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	period := cfg.SyncPeriod
+	if period == 0 {
+		period = defaultSyncPeriod
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &watcher{
+		log:       log,
+		api:       api,
+		period:    period,
+		ctx:       ctx,
+		stop:      cancel,
+		instances: make(map[string]*Instance),
+		bus:       bus.New(log, "lxd"),
+	}, nil
+}
+
+// Instances returns the running instances
+func (w *watcher) Instances() map[string]*Instance {
+	w.RLock()
+	defer w.RUnlock()
+	res := make(map[string]*Instance, len(w.instances))
+	for k, v := range w.instances {
+		res[k] = v
+	}
+	return res
+}
+
+// Start watching the instances, the first listing is done synchronously so errors reaching the
+// daemon are returned
+func (w *watcher) Start() error {
+	w.log.Debug("Start LXD instances watcher")
+	if err := w.sync(); err != nil {
+		return err
+	}
+
+	w.stopped.Add(1)
+	go w.watch()
+	return nil
+}
+
+// Stop watching the instances
+func (w *watcher) Stop() {
+	w.stop()
+	w.stopped.Wait()
+}
+
+func (w *watcher) watch() {
+	defer w.stopped.Done()
+
+	poll.Loop(w.ctx, w.log, poll.Config{
+		Period:      w.period,
+		MaxBackoff:  maxBackoff,
+		Description: "listing LXD instances",
+	}, w.sync)
+	w.log.Debug("Watcher stopped")
+}
+
+// sync lists the instances and publishes the events of the instances that started or stopped
+// since the last listing. Instances whose PID changed were restarted between listings.
+func (w *watcher) sync() error {
+	instances, err := w.api.Instances(w.ctx)
+	if err != nil {
+		return err
+	}
+
+	running := make(map[string]*Instance)
+	for i := range instances {
+		if instances[i].Status == StatusRunning {
+			running[instanceKey(&instances[i])] = &instances[i]
+		}
+	}
+
+	w.Lock()
+	started, stopped := poll.Diff(w.instances, running, func(old, i *Instance) bool {
+		return old.PID != i.PID
+	})
+	w.instances = running
+	w.Unlock()
+
+	poll.Publish(w.bus, "instance", started, stopped)
+	return nil
+}
+
+func (w *watcher) ListenStart() bus.Listener {
+	return w.bus.Subscribe("start")
+}
+
+func (w *watcher) ListenStop() bus.Listener {
+	return w.bus.Subscribe("stop")
+}
@@ -0,0 +1,191 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package lxd
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-autodiscover/internal/polltest"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type mockAPI struct {
+	polltest.Source[Instance]
+}
+
+func (m *mockAPI) Instances(ctx context.Context) ([]Instance, error) {
+	instances, _, err := m.List()
+	return instances, err
+}
+
+func running(name string, pid int64) Instance {
+	return Instance{Name: name, Project: "default", Type: TypeContainer, Status: StatusRunning, PID: pid}
+}
+
+func TestWatcher(t *testing.T) {
+	api := &mockAPI{}
+	api.Set(running("web", 100), Instance{Name: "db", Project: "default", Status: "Stopped"})
+
+	w, err := NewWatcher(logp.L(), api, Config{SyncPeriod: 10 * time.Millisecond})
+	require.NoError(t, err)
+	start, stop := polltest.Start(t, w)
+
+	assert.Equal(t, "web", polltest.NextEvent(t, start)["instance"].(*Instance).Name)
+	assert.Len(t, w.Instances(), 1)
+
+	// Start of a stopped instance
+	api.Set(running("web", 100), running("db", 200))
+	assert.Equal(t, "db", polltest.NextEvent(t, start)["instance"].(*Instance).Name)
+
+	// Restart between listings
+	api.Set(running("web", 101), running("db", 200))
+	assert.Equal(t, int64(100), polltest.NextEvent(t, stop)["instance"].(*Instance).PID)
+	assert.Equal(t, int64(101), polltest.NextEvent(t, start)["instance"].(*Instance).PID)
+
+	// Stop
+	api.Set(running("web", 101))
+	assert.Equal(t, "db", polltest.NextEvent(t, stop)["instance"].(*Instance).Name)
+	assert.Contains(t, w.Instances(), "default/web")
+}
+
+func TestWatcherStartError(t *testing.T) {
+	polltest.StartError(t, func(err error) (polltest.Watcher, error) {
+		api := &mockAPI{}
+		api.Fail(err)
+		return NewWatcher(logp.L(), api, Config{})
+	})
+
+	_, err := NewWatcher(logp.L(), &mockAPI{}, Config{ConfigKeys: []string{"[user"}})
+	assert.Error(t, err)
+}
+
+func TestClient(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "unix.socket")
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/1.0/instances" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"type":"error","error":"not found","error_code":404}`))
+			return
+		}
+		assert.Equal(t, "2", r.URL.Query().Get("recursion"))
+		if r.URL.Query().Get("project") != "web" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"type":"error","error":"Project not found","error_code":404}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"type":"sync","status":"Success","status_code":200,"metadata":[{
+			"name": "c1",
+			"project": "web",
+			"type": "container",
+			"status": "Running",
+			"architecture": "x86_64",
+			"location": "none",
+			"profiles": ["default", "monitored"],
+			"expanded_config": {"user.team": "web", "volatile.base_image": "abc"},
+			"state": {
+				"pid": 1234,
+				"network": {
+					"eth0": {"addresses": [
+						{"family": "inet6", "address": "fe80::1", "scope": "link"},
+						{"family": "inet", "address": "10.0.0.5", "scope": "global"}
+					]},
+					"lo": {"addresses": [{"family": "inet", "address": "127.0.0.1", "scope": "local"}]}
+				}
+			}
+		}]}`))
+	}))
+	server.Listener = l
+	server.Start()
+	defer server.Close()
+
+	api, err := NewClient(Config{Socket: socket, Project: "web"})
+	require.NoError(t, err)
+	instances, err := api.Instances(context.Background())
+	require.NoError(t, err)
+	require.Len(t, instances, 1)
+	assert.Equal(t, Instance{
+		Name:         "c1",
+		Project:      "web",
+		Type:         TypeContainer,
+		Status:       StatusRunning,
+		Architecture: "x86_64",
+		Location:     "none",
+		Profiles:     []string{"default", "monitored"},
+		Config:       map[string]string{"user.team": "web", "volatile.base_image": "abc"},
+		PID:          1234,
+		IPs:          []string{"10.0.0.5"},
+	}, instances[0])
+
+	api, err = NewClient(Config{Socket: socket, Project: "unknown"})
+	require.NoError(t, err)
+	_, err = api.Instances(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Project not found")
+}
+
+func TestGenerateMetadata(t *testing.T) {
+	i := &Instance{
+		Name:         "c1",
+		Project:      "default",
+		Type:         TypeContainer,
+		Status:       StatusRunning,
+		Architecture: "x86_64",
+		Location:     "none",
+		Profiles:     []string{"default"},
+		Config:       map[string]string{"user.team": "web", "volatile.base_image": "abc"},
+		IPs:          []string{"10.0.0.5"},
+	}
+	assert.Equal(t, mapstr.M{
+		"lxd": mapstr.M{
+			"project": "default",
+			"instance": mapstr.M{
+				"name":         "c1",
+				"type":         "container",
+				"status":       "Running",
+				"architecture": "x86_64",
+				"profiles":     []string{"default"},
+				"ip":           []string{"10.0.0.5"},
+				"config":       mapstr.M{"user.team": "web"},
+			},
+		},
+		"container": mapstr.M{
+			"id":      "c1",
+			"name":    "c1",
+			"runtime": "lxd",
+		},
+	}, GenerateMetadata(i, []string{"user.*"}))
+
+	// Virtual machines are not containers
+	i.Type = TypeVirtualMachine
+	meta := GenerateMetadata(i, nil)
+	assert.NotContains(t, meta, "container")
+	_, err := meta.GetValue("lxd.instance.config")
+	assert.Error(t, err)
+}
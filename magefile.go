@@ -22,6 +22,8 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"os/exec"
 	"path/filepath"
 
 	// mage:import
@@ -36,13 +38,63 @@ var Aliases = map[string]interface{}{
 	"lint": mage.Linter.All,
 }
 
+// modules are the directories of the Go modules of the repository, the main one first
+var modules = []string{".", filepath.Join("metrics", "prometheus")}
+
 // Check runs all the checks
 func Check() error {
-	mg.Deps(mage.Deps.CheckModuleTidy, CheckLicenseHeaders)
+	mg.Deps(mage.Deps.CheckModuleTidy, TidySubmodules, CheckLicenseHeaders)
 	mg.Deps(mage.CheckNoChanges)
 	return nil
 }
 
+// TidySubmodules runs go mod tidy in the modules other than the main one
+func TidySubmodules() error {
+	for _, dir := range modules[1:] {
+		if err := goCmd(dir, "mod", "tidy"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Build builds and vets the packages of all the modules
+func Build() error {
+	for _, dir := range modules {
+		if err := goCmd(dir, "build", "./..."); err != nil {
+			return err
+		}
+		if err := goCmd(dir, "vet", "./..."); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Test runs the tests of all the modules
+func Test() error {
+	for _, dir := range modules {
+		if err := goCmd(dir, "test", "./..."); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// goCmd runs a go command in the directory of a module, without updating its go.mod and go.sum
+func goCmd(dir string, args ...string) error {
+	fmt.Printf(">> go %v (%s)\n", args, dir)
+	cmd := exec.Command(mg.GoCmd(), args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=readonly")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("go %v failed in %s: %w", args, dir, err)
+	}
+	return nil
+}
+
 // Fmt formats code and adds license headers.
 func Fmt() {
 	mg.Deps(AddLicenseHeaders)
@@ -0,0 +1,304 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metrics
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Kind is the kind of a metric
+type Kind string
+
+// Kinds of metrics, named like the Prometheus metric types
+const (
+	KindCounter   Kind = "counter"
+	KindGauge     Kind = "gauge"
+	KindHistogram Kind = "histogram"
+)
+
+var (
+	metricNameRegexp = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRegexp  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// Family is a snapshot of a metric with the values of all its label values
+type Family struct {
+	Name   string
+	Help   string
+	Kind   Kind
+	Labels []string
+	// Buckets are the upper bounds of the buckets of histograms
+	Buckets []float64
+	// Samples are sorted by their label values
+	Samples []Sample
+}
+
+// Sample is the value of a metric for some label values
+type Sample struct {
+	LabelValues []string
+	// Value is the value of counters and gauges
+	Value float64
+	// Count and Sum are the number and sum of the values observed by histograms
+	Count uint64
+	Sum   float64
+	// BucketCounts are the cumulative counts of the observed values lower or equal to the
+	// upper bound of every bucket of histograms
+	BucketCounts []uint64
+}
+
+// InMemory is a Registry keeping the values of the metrics in memory
+type InMemory struct {
+	sync.Mutex
+	families map[string]*family
+}
+
+// NewInMemory creates an empty InMemory registry
+func NewInMemory() *InMemory {
+	return &InMemory{families: make(map[string]*family)}
+}
+
+// Counter creates a counter, it panics if the name or the labels are invalid, or a metric of
+// another kind or labels exists with the same name
+func (r *InMemory) Counter(name, help string, labels ...string) Counter {
+	return r.register(name, help, KindCounter, nil, labels)
+}
+
+// Gauge creates a gauge, it panics if the name or the labels are invalid, or a metric of
+// another kind or labels exists with the same name
+func (r *InMemory) Gauge(name, help string, labels ...string) Gauge {
+	return r.register(name, help, KindGauge, nil, labels)
+}
+
+// Histogram creates a histogram, it panics if the name, the buckets or the labels are invalid,
+// or a metric of another kind, buckets or labels exists with the same name
+func (r *InMemory) Histogram(name, help string, buckets []float64, labels ...string) Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("buckets of histogram %q are not sorted", name))
+	}
+	return r.register(name, help, KindHistogram, buckets, labels)
+}
+
+// Snapshot returns the values of all the metrics, sorted by name
+func (r *InMemory) Snapshot() []Family {
+	r.Lock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.Unlock()
+
+	snapshot := make([]Family, len(families))
+	for i, f := range families {
+		snapshot[i] = f.snapshot()
+	}
+	sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].Name < snapshot[j].Name })
+	return snapshot
+}
+
+// Value returns the value of a counter or gauge for the label values, or the number of values
+// observed by a histogram, it returns false if the metric has no value for the label values
+func (r *InMemory) Value(name string, labelValues ...string) (float64, bool) {
+	r.Lock()
+	f, ok := r.families[name]
+	r.Unlock()
+	if !ok {
+		return 0, false
+	}
+
+	f.Lock()
+	defer f.Unlock()
+	s, ok := f.series[seriesKey(labelValues)]
+	if !ok {
+		return 0, false
+	}
+	if f.kind == KindHistogram {
+		return float64(s.count), true
+	}
+	return s.value, true
+}
+
+func (r *InMemory) register(name, help string, kind Kind, buckets []float64, labels []string) *family {
+	if !metricNameRegexp.MatchString(name) {
+		panic(fmt.Sprintf("invalid metric name %q", name))
+	}
+	for _, label := range labels {
+		if !labelNameRegexp.MatchString(label) || strings.HasPrefix(label, "__") || (kind == KindHistogram && label == "le") {
+			panic(fmt.Sprintf("invalid label %q of metric %q", label, name))
+		}
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	if f, ok := r.families[name]; ok {
+		if f.kind != kind || !equalStrings(f.labels, labels) || !equalFloats(f.buckets, buckets) {
+			panic(fmt.Sprintf("metric %q already exists as a %s with labels %v", name, f.kind, f.labels))
+		}
+		return f
+	}
+	f := &family{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  append([]string(nil), labels...),
+		buckets: append([]float64(nil), buckets...),
+		series:  make(map[string]*series),
+	}
+	r.families[name] = f
+	return f
+}
+
+// family implements the counters, gauges and histograms
+type family struct {
+	sync.Mutex
+	name    string
+	help    string
+	kind    Kind
+	labels  []string
+	buckets []float64
+	series  map[string]*series
+}
+
+type series struct {
+	labelValues  []string
+	value        float64
+	count        uint64
+	sum          float64
+	bucketCounts []uint64
+}
+
+func (f *family) Add(delta float64, labelValues ...string) {
+	if f.kind == KindCounter && delta < 0 {
+		return
+	}
+	f.Lock()
+	defer f.Unlock()
+	f.get(labelValues).value += delta
+}
+
+func (f *family) Set(value float64, labelValues ...string) {
+	f.Lock()
+	defer f.Unlock()
+	f.get(labelValues).value = value
+}
+
+func (f *family) Delete(labelValues ...string) {
+	f.Lock()
+	defer f.Unlock()
+	delete(f.series, seriesKey(labelValues))
+}
+
+func (f *family) Observe(value float64, labelValues ...string) {
+	f.Lock()
+	defer f.Unlock()
+
+	s := f.get(labelValues)
+	s.count++
+	s.sum += value
+	// Counts are kept per bucket and accumulated in snapshots
+	if i := sort.SearchFloat64s(f.buckets, value); i < len(f.buckets) {
+		s.bucketCounts[i]++
+	}
+}
+
+// get returns the series of the label values, it must be called with the lock held
+func (f *family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metric %q has %d labels, got %d values", f.name, len(f.labels), len(labelValues)))
+	}
+	key := seriesKey(labelValues)
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if f.kind == KindHistogram {
+			s.bucketCounts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (f *family) snapshot() Family {
+	f.Lock()
+	defer f.Unlock()
+
+	snapshot := Family{
+		Name:    f.name,
+		Help:    f.help,
+		Kind:    f.kind,
+		Labels:  f.labels,
+		Buckets: f.buckets,
+		Samples: make([]Sample, 0, len(f.series)),
+	}
+	for _, s := range f.series {
+		sample := Sample{
+			LabelValues: s.labelValues,
+			Value:       s.value,
+			Count:       s.count,
+			Sum:         s.sum,
+		}
+		if s.bucketCounts != nil {
+			sample.BucketCounts = make([]uint64, len(s.bucketCounts))
+			var cumulative uint64
+			for i, count := range s.bucketCounts {
+				cumulative += count
+				sample.BucketCounts[i] = cumulative
+			}
+		}
+		snapshot.Samples = append(snapshot.Samples, sample)
+	}
+	sort.Slice(snapshot.Samples, func(i, j int) bool {
+		return seriesKey(snapshot.Samples[i].LabelValues) < seriesKey(snapshot.Samples[j].LabelValues)
+	})
+	return snapshot
+}
+
+func seriesKey(labelValues []string) string {
+	return strings.Join(labelValues, "\xff")
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalFloats(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,111 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInMemory(t *testing.T) {
+	r := NewInMemory()
+
+	events := r.Counter("events_total", "Events.", "type")
+	events.Add(1, "add")
+	events.Add(2, "add")
+	events.Add(1, "delete")
+	events.Add(-1, "delete")
+
+	queue := r.Gauge("queue_depth", "Queue depth.", "listener")
+	queue.Set(5, "a")
+	queue.Add(-2, "a")
+	queue.Set(1, "b")
+	queue.Delete("b")
+
+	durations := r.Histogram("duration_seconds", "Durations.", []float64{0.1, 1})
+	durations.Observe(0.05)
+	durations.Observe(0.1)
+	durations.Observe(0.5)
+	durations.Observe(3)
+
+	assert.Equal(t, []Family{
+		{
+			Name:    "duration_seconds",
+			Help:    "Durations.",
+			Kind:    KindHistogram,
+			Buckets: []float64{0.1, 1},
+			Samples: []Sample{{Count: 4, Sum: 3.65, BucketCounts: []uint64{2, 3}}},
+		},
+		{
+			Name:   "events_total",
+			Help:   "Events.",
+			Kind:   KindCounter,
+			Labels: []string{"type"},
+			Samples: []Sample{
+				{LabelValues: []string{"add"}, Value: 3},
+				{LabelValues: []string{"delete"}, Value: 1},
+			},
+		},
+		{
+			Name:    "queue_depth",
+			Help:    "Queue depth.",
+			Kind:    KindGauge,
+			Labels:  []string{"listener"},
+			Samples: []Sample{{LabelValues: []string{"a"}, Value: 3}},
+		},
+	}, r.Snapshot())
+
+	value, ok := r.Value("events_total", "add")
+	assert.True(t, ok)
+	assert.Equal(t, float64(3), value)
+	value, ok = r.Value("duration_seconds")
+	assert.True(t, ok)
+	assert.Equal(t, float64(4), value)
+	_, ok = r.Value("queue_depth", "b")
+	assert.False(t, ok)
+	_, ok = r.Value("unknown")
+	assert.False(t, ok)
+}
+
+func TestInMemoryRegistration(t *testing.T) {
+	r := NewInMemory()
+
+	// Metrics with the same name, kind and labels are shared
+	r.Counter("events_total", "Events.", "type").Add(1, "add")
+	r.Counter("events_total", "Events.", "type").Add(1, "add")
+	assert.Equal(t, float64(2), r.Snapshot()[0].Samples[0].Value)
+
+	assert.Panics(t, func() { r.Gauge("events_total", "Events.", "type") })
+	assert.Panics(t, func() { r.Counter("events_total", "Events.") })
+	assert.Panics(t, func() { r.Counter("invalid-name", "") })
+	assert.Panics(t, func() { r.Counter("valid", "", "invalid-label") })
+	assert.Panics(t, func() { r.Histogram("histogram", "", nil, "le") })
+	assert.Panics(t, func() { r.Histogram("histogram", "", []float64{1, 0.5}) })
+	assert.Panics(t, func() { r.Counter("events_total", "Events.", "type").Add(1) })
+
+	assert.Equal(t, DefaultBuckets, r.Histogram("histogram", "", nil).(*family).buckets)
+}
+
+func TestNoop(t *testing.T) {
+	r := Noop()
+	r.Counter("events_total", "").Add(1, "add")
+	r.Gauge("queue_depth", "").Set(1)
+	r.Gauge("queue_depth", "").Delete()
+	r.Histogram("duration_seconds", "", nil).Observe(1)
+}
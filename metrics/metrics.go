@@ -0,0 +1,87 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package metrics defines the minimal metrics interface used by the watchers, the bus, the
+// docker watcher and the keystores, so their metrics can be reported to any monitoring system.
+//
+// Metrics are created from a Registry with a name, a help text and the names of their labels,
+// values are reported with the values of the labels in the same order:
+//
+//	events := registry.Counter("autodiscover_bus_events_published_total", "Published events.", "topic")
+//	events.Add(1, "kubernetes")
+//
+// InMemory keeps the metrics in memory, and PrometheusHandler exposes them in the Prometheus
+// text format. Applications already using the Prometheus client can instead use the Registry of
+// the github.com/elastic/elastic-agent-autodiscover/metrics/prometheus module, registering the
+// metrics in their own registerer.
+package metrics
+
+// Registry creates metrics, implementations must be safe for concurrent use. Creating a metric
+// with the name of an existing metric of the same kind and labels returns the existing one.
+type Registry interface {
+	// Counter creates a counter, a value that only increases
+	Counter(name, help string, labels ...string) Counter
+
+	// Gauge creates a gauge, a value that can go up and down
+	Gauge(name, help string, labels ...string) Gauge
+
+	// Histogram creates a histogram counting the observed values in buckets of the given upper
+	// bounds, DefaultBuckets are used if buckets is empty
+	Histogram(name, help string, buckets []float64, labels ...string) Histogram
+}
+
+// Counter is a value that only increases
+type Counter interface {
+	// Add increases the counter of the label values by delta, negative deltas are ignored
+	Add(delta float64, labelValues ...string)
+}
+
+// Gauge is a value that can go up and down
+type Gauge interface {
+	// Set sets the gauge of the label values
+	Set(value float64, labelValues ...string)
+
+	// Add adds delta to the gauge of the label values
+	Add(delta float64, labelValues ...string)
+
+	// Delete removes the gauge of the label values, for labels of resources that are gone
+	Delete(labelValues ...string)
+}
+
+// Histogram counts observed values in buckets
+type Histogram interface {
+	// Observe adds a value to the histogram of the label values
+	Observe(value float64, labelValues ...string)
+}
+
+// DefaultBuckets are the default buckets of histograms, suited to durations in seconds
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Noop returns a Registry of metrics that discard their values
+func Noop() Registry {
+	return noop{}
+}
+
+type noop struct{}
+
+func (noop) Counter(string, string, ...string) Counter                { return noop{} }
+func (noop) Gauge(string, string, ...string) Gauge                    { return noop{} }
+func (noop) Histogram(string, string, []float64, ...string) Histogram { return noop{} }
+func (noop) Add(float64, ...string)                                   {}
+func (noop) Set(float64, ...string)                                   {}
+func (noop) Delete(...string)                                         {}
+func (noop) Observe(float64, ...string)                               {}
@@ -0,0 +1,194 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package prometheus implements the metrics.Registry of the watchers, the bus and the keystores
+// with collectors of the Prometheus client, registered in the registerer of the caller, so they
+// are exposed with the other metrics of the process.
+//
+// It is a separate module so the main module doesn't depend on the Prometheus client.
+package prometheus
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	promclient "github.com/prometheus/client_golang/prometheus"
+
+	"github.com/elastic/elastic-agent-autodiscover/metrics"
+)
+
+// Registry is a metrics.Registry creating the metrics as collectors of a Prometheus registerer
+type Registry struct {
+	registerer promclient.Registerer
+
+	lock       sync.Mutex
+	collectors map[string]*collector
+}
+
+type collector struct {
+	kind    metrics.Kind
+	labels  []string
+	buckets []float64
+	vec     promclient.Collector
+}
+
+// NewRegistry creates a Registry registering the collectors of its metrics in r, like
+// prometheus.DefaultRegisterer
+func NewRegistry(r promclient.Registerer) *Registry {
+	return &Registry{registerer: r, collectors: make(map[string]*collector)}
+}
+
+// Counter creates a counter, it panics if the name or the labels are invalid, or a metric of
+// another kind or labels exists with the same name
+func (r *Registry) Counter(name, help string, labels ...string) metrics.Counter {
+	c := r.register(name, metrics.KindCounter, nil, labels, func() promclient.Collector {
+		return promclient.NewCounterVec(promclient.CounterOpts{Name: name, Help: help}, labels)
+	})
+	return counter{c.(*promclient.CounterVec)}
+}
+
+// Gauge creates a gauge, it panics if the name or the labels are invalid, or a metric of
+// another kind or labels exists with the same name
+func (r *Registry) Gauge(name, help string, labels ...string) metrics.Gauge {
+	c := r.register(name, metrics.KindGauge, nil, labels, func() promclient.Collector {
+		return promclient.NewGaugeVec(promclient.GaugeOpts{Name: name, Help: help}, labels)
+	})
+	return gauge{c.(*promclient.GaugeVec)}
+}
+
+// Histogram creates a histogram, it panics if the name, the buckets or the labels are invalid,
+// or a metric of another kind, buckets or labels exists with the same name
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) metrics.Histogram {
+	if len(buckets) == 0 {
+		buckets = metrics.DefaultBuckets
+	}
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("buckets of histogram %q are not sorted", name))
+	}
+	c := r.register(name, metrics.KindHistogram, buckets, labels, func() promclient.Collector {
+		return promclient.NewHistogramVec(promclient.HistogramOpts{Name: name, Help: help, Buckets: buckets}, labels)
+	})
+	return histogram{c.(*promclient.HistogramVec)}
+}
+
+// register returns the collector of a metric, creating and registering it if it doesn't exist.
+// Collectors already registered by the caller with the same description are reused.
+func (r *Registry) register(name string, kind metrics.Kind, buckets []float64, labels []string, create func() promclient.Collector) promclient.Collector {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if c, ok := r.collectors[name]; ok {
+		if c.kind != kind || !equal(c.labels, labels) || !equalBuckets(c.buckets, buckets) {
+			panic(fmt.Sprintf("metric %q already exists as a %s with labels %s", name, c.kind, strings.Join(c.labels, ",")))
+		}
+		return c.vec
+	}
+
+	vec := create()
+	if err := r.registerer.Register(vec); err != nil {
+		var already promclient.AlreadyRegisteredError
+		if !errors.As(err, &already) {
+			panic(fmt.Sprintf("cannot register metric %q: %v", name, err))
+		}
+		// Same name, help and labels, the collector must also be of the same type to be reused
+		existing := already.ExistingCollector
+		if fmt.Sprintf("%T", existing) != fmt.Sprintf("%T", vec) {
+			panic(fmt.Sprintf("metric %q already registered with a collector of type %T", name, existing))
+		}
+		vec = existing
+	}
+	r.collectors[name] = &collector{
+		kind:    kind,
+		labels:  append([]string(nil), labels...),
+		buckets: append([]float64(nil), buckets...),
+		vec:     vec,
+	}
+	return vec
+}
+
+// Unregister removes the collectors of all the metrics of the registry from the registerer
+func (r *Registry) Unregister() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for name, c := range r.collectors {
+		r.registerer.Unregister(c.vec)
+		delete(r.collectors, name)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalBuckets(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type counter struct {
+	vec *promclient.CounterVec
+}
+
+// Add increases the counter, negative deltas are ignored
+func (c counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+	c.vec.WithLabelValues(labelValues...).Add(delta)
+}
+
+type gauge struct {
+	vec *promclient.GaugeVec
+}
+
+func (g gauge) Set(value float64, labelValues ...string) {
+	g.vec.WithLabelValues(labelValues...).Set(value)
+}
+
+func (g gauge) Add(delta float64, labelValues ...string) {
+	g.vec.WithLabelValues(labelValues...).Add(delta)
+}
+
+func (g gauge) Delete(labelValues ...string) {
+	g.vec.DeleteLabelValues(labelValues...)
+}
+
+type histogram struct {
+	vec *promclient.HistogramVec
+}
+
+func (h histogram) Observe(value float64, labelValues ...string) {
+	h.vec.WithLabelValues(labelValues...).Observe(value)
+}
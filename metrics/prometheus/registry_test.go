@@ -0,0 +1,104 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package prometheus
+
+import (
+	"strings"
+	"testing"
+
+	promclient "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+	"github.com/elastic/elastic-agent-autodiscover/metrics"
+)
+
+var _ metrics.Registry = &Registry{}
+
+func TestRegistry(t *testing.T) {
+	reg := promclient.NewRegistry()
+	r := NewRegistry(reg)
+
+	events := r.Counter("test_events_total", "Events.", "type")
+	events.Add(2, "add")
+	events.Add(-1, "add")
+	r.Counter("test_events_total", "Events.", "type").Add(1, "add")
+
+	queue := r.Gauge("test_queue_depth", "Queue depth.", "queue")
+	queue.Set(5, "a")
+	queue.Add(-2, "a")
+	queue.Set(1, "b")
+	queue.Delete("b")
+
+	r.Histogram("test_duration_seconds", "Durations.", []float64{0.1, 1}).Observe(0.5)
+
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP test_duration_seconds Durations.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{le="0.1"} 0
+test_duration_seconds_bucket{le="1"} 1
+test_duration_seconds_bucket{le="+Inf"} 1
+test_duration_seconds_sum 0.5
+test_duration_seconds_count 1
+# HELP test_events_total Events.
+# TYPE test_events_total counter
+test_events_total{type="add"} 3
+# HELP test_queue_depth Queue depth.
+# TYPE test_queue_depth gauge
+test_queue_depth{queue="a"} 3
+`)))
+
+	assert.Panics(t, func() { r.Gauge("test_events_total", "Events.", "type") })
+	assert.Panics(t, func() { r.Counter("test_events_total", "Events.", "other") })
+	assert.Panics(t, func() { r.Histogram("test_unsorted", "Unsorted.", []float64{1, 0.1}) })
+	assert.Panics(t, func() { r.Counter("invalid name", "Invalid.") })
+
+	r.Unregister()
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	assert.Empty(t, families)
+}
+
+func TestRegistryExistingCollectors(t *testing.T) {
+	reg := promclient.NewRegistry()
+
+	// Metrics registered by several registries in the same registerer share the collectors
+	NewRegistry(reg).Counter("test_events_total", "Events.").Add(1)
+	NewRegistry(reg).Counter("test_events_total", "Events.").Add(1)
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP test_events_total Events.
+# TYPE test_events_total counter
+test_events_total 2
+`)))
+
+	assert.Panics(t, func() { NewRegistry(reg).Counter("test_events_total", "Other help.") })
+}
+
+func TestBusMetrics(t *testing.T) {
+	reg := promclient.NewRegistry()
+	m := bus.NewRegistryMetrics(NewRegistry(reg), "test")
+	m.Published("kubernetes")
+
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP autodiscover_bus_events_published_total Events published to the bus, per topic.
+# TYPE autodiscover_bus_events_published_total counter
+autodiscover_bus_events_published_total{bus="test",topic="kubernetes"} 1
+`), "autodiscover_bus_events_published_total"))
+}
@@ -0,0 +1,62 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrometheusHandler(t *testing.T) {
+	r := NewInMemory()
+	r.Counter("events_total", "Events\nreceived.", "type").Add(2, `a "quoted"\value`)
+	r.Gauge("queue_depth", "Queue depth.").Set(3)
+	durations := r.Histogram("duration_seconds", "Durations.", []float64{0.5, 1}, "watcher")
+	durations.Observe(0.25, "pod")
+	durations.Observe(2, "pod")
+
+	server := httptest.NewServer(PrometheusHandler(r))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, PrometheusContentType, resp.Header.Get("Content-Type"))
+	assert.Equal(t, `# HELP duration_seconds Durations.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{watcher="pod",le="0.5"} 1
+duration_seconds_bucket{watcher="pod",le="1"} 1
+duration_seconds_bucket{watcher="pod",le="+Inf"} 2
+duration_seconds_sum{watcher="pod"} 2.25
+duration_seconds_count{watcher="pod"} 2
+# HELP events_total Events\nreceived.
+# TYPE events_total counter
+events_total{type="a \"quoted\"\\value"} 2
+# HELP queue_depth Queue depth.
+# TYPE queue_depth gauge
+queue_depth 3
+`, string(body))
+}
@@ -0,0 +1,168 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package nomad
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAddress  = "http://127.0.0.1:4646"
+	defaultWaitTime = 5 * time.Minute
+
+	indexHeader = "X-Nomad-Index"
+	tokenHeader = "X-Nomad-Token"
+)
+
+// Config of the connection to the Nomad API
+type Config struct {
+	// Address of the Nomad agent, NOMAD_ADDR or http://127.0.0.1:4646 by default
+	Address string `config:"address"`
+
+	// Region and Namespace of the allocations, the ones of the agent by default. Namespace can be
+	// `*` to watch all namespaces.
+	Region    string `config:"region"`
+	Namespace string `config:"namespace"`
+
+	// SecretID is the ACL token, NOMAD_TOKEN by default
+	SecretID string `config:"secret_id"`
+
+	// Node is the ID or name of the node whose allocations are watched, all the nodes by default
+	Node string `config:"node"`
+
+	// WaitTime is the maximum time blocking queries wait for changes
+	WaitTime time.Duration `config:"wait_time"`
+
+	// SyncPeriod is the time waited between queries
+	SyncPeriod time.Duration `config:"sync_period"`
+}
+
+// Validate the config
+func (c *Config) Validate() error {
+	if c.WaitTime < 0 {
+		return fmt.Errorf("invalid nomad wait time %v", c.WaitTime)
+	}
+	if c.SyncPeriod < 0 {
+		return fmt.Errorf("invalid nomad sync period %v", c.SyncPeriod)
+	}
+	if c.Address != "" {
+		if _, err := url.Parse(c.Address); err != nil {
+			return fmt.Errorf("invalid nomad address: %w", err)
+		}
+	}
+	return nil
+}
+
+// API is the subset of the Nomad API used by the watcher
+type API interface {
+	// Allocations returns the allocations and the index of the last change, blocking until there
+	// are changes after the given index if it is not zero
+	Allocations(ctx context.Context, index uint64) ([]Allocation, uint64, error)
+}
+
+type client struct {
+	http     *http.Client
+	address  string
+	query    url.Values
+	secretID string
+	wait     time.Duration
+}
+
+// NewClient returns a client of the Nomad HTTP API
+func NewClient(cfg Config) (API, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	address := cfg.Address
+	if address == "" {
+		address = os.Getenv("NOMAD_ADDR")
+	}
+	if address == "" {
+		address = defaultAddress
+	}
+	secretID := cfg.SecretID
+	if secretID == "" {
+		secretID = os.Getenv("NOMAD_TOKEN")
+	}
+	wait := cfg.WaitTime
+	if wait == 0 {
+		wait = defaultWaitTime
+	}
+
+	query := url.Values{}
+	if cfg.Region != "" {
+		query.Set("region", cfg.Region)
+	}
+	if cfg.Namespace != "" {
+		query.Set("namespace", cfg.Namespace)
+	}
+	return &client{
+		// Blocking queries can take up to the wait time plus a jitter of wait/16
+		http:     &http.Client{Timeout: wait + wait/16 + 10*time.Second},
+		address:  strings.TrimSuffix(address, "/"),
+		query:    query,
+		secretID: secretID,
+		wait:     wait,
+	}, nil
+}
+
+// Allocations returns the allocations and the index of the last change
+func (c *client) Allocations(ctx context.Context, index uint64) ([]Allocation, uint64, error) {
+	query := url.Values{}
+	for k, v := range c.query {
+		query[k] = v
+	}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", c.wait.String())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.address+"/v1/allocations?"+query.Encode(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if c.secretID != "" {
+		req.Header.Set(tokenHeader, c.secretID)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list nomad allocations: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("failed to list nomad allocations: unexpected status %s", resp.Status)
+	}
+
+	var allocations []Allocation
+	if err := json.NewDecoder(resp.Body).Decode(&allocations); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode nomad allocations: %w", err)
+	}
+	lastIndex, _ := strconv.ParseUint(resp.Header.Get(indexHeader), 10, 64)
+	return allocations, lastIndex, nil
+}
@@ -0,0 +1,61 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package nomad
+
+import (
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// GenerateMetadata returns the metadata of a task, under the `nomad` key, and the ECS
+// orchestrator fields
+func GenerateMetadata(task *Task) mapstr.M {
+	alloc := task.Allocation
+	meta := mapstr.M{
+		"nomad": mapstr.M{
+			"namespace": alloc.Namespace,
+			"job": mapstr.M{
+				"name": alloc.JobID,
+				"type": alloc.JobType,
+			},
+			"task": mapstr.M{
+				"name":  task.Name,
+				"group": alloc.TaskGroup,
+			},
+			"allocation": mapstr.M{
+				"id":     alloc.ID,
+				"name":   alloc.Name,
+				"status": alloc.ClientStatus,
+			},
+			"node": mapstr.M{
+				"id":   alloc.NodeID,
+				"name": alloc.NodeName,
+			},
+		},
+		"orchestrator": mapstr.M{
+			"type": "nomad",
+			"resource": mapstr.M{
+				"type": "task",
+				"name": task.Name,
+			},
+		},
+	}
+	if alloc.Namespace != "" {
+		_, _ = meta.Put("orchestrator.namespace", alloc.Namespace)
+	}
+	return meta
+}
@@ -0,0 +1,229 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package nomad discovers the tasks running in Nomad allocations, watching the allocations with
+// blocking queries to the Nomad API.
+package nomad
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+	"github.com/elastic/elastic-agent-autodiscover/internal/poll"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+const (
+	// Allocation and task states
+	StatusRunning = "running"
+
+	defaultSyncPeriod = time.Second
+	maxBackoff        = 30 * time.Second
+)
+
+// Allocation of a task group, as listed by the Nomad API
+type Allocation struct {
+	ID           string
+	Name         string
+	Namespace    string
+	EvalID       string
+	NodeID       string
+	NodeName     string
+	JobID        string
+	JobType      string
+	JobVersion   uint64
+	TaskGroup    string
+	ClientStatus string
+	TaskStates   map[string]TaskState
+	CreateIndex  uint64
+	ModifyIndex  uint64
+}
+
+// TaskState is the state of a task in an allocation
+type TaskState struct {
+	State      string
+	Failed     bool
+	Restarts   uint64
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// Task running in an allocation
+type Task struct {
+	Name       string
+	State      TaskState
+	Allocation *Allocation
+}
+
+// taskKey identifies a task of an allocation
+func taskKey(allocID, task string) string {
+	return allocID + "/" + task
+}
+
+// Watcher watches the Nomad allocations and keeps a list of running tasks
+type Watcher interface {
+	// Start watching the allocations
+	Start() error
+
+	// Stop watching the allocations
+	Stop()
+
+	// Tasks returns the running tasks, by allocation ID and task name
+	Tasks() map[string]*Task
+
+	// ListenStart returns a bus listener to receive the tasks that start running in the
+	// allocations of the node, with a `task` key holding them
+	ListenStart() bus.Listener
+
+	// ListenStop returns a bus listener to receive the tasks that stop running, or whose
+	// allocation stops or leaves the node, with a `task` key holding them
+	ListenStop() bus.Listener
+}
+
+type watcher struct {
+	sync.RWMutex
+	log     *logp.Logger
+	api     API
+	node    string
+	period  time.Duration
+	ctx     context.Context
+	stop    context.CancelFunc
+	index   uint64
+	tasks   map[string]*Task
+	stopped sync.WaitGroup
+	bus     bus.Bus
+}
+
+// NewWatcher creates a new Watcher of the allocations of the API, filtered by the node of the
+// config
+func NewWatcher(log *logp.Logger, api API, cfg Config) (Watcher, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	period := cfg.SyncPeriod
+	if period == 0 {
+		period = defaultSyncPeriod
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &watcher{
+		log:    log,
+		api:    api,
+		node:   cfg.Node,
+		period: period,
+		ctx:    ctx,
+		stop:   cancel,
+		tasks:  make(map[string]*Task),
+		bus:    bus.New(log, "nomad"),
+	}, nil
+}
+
+// Tasks returns the running tasks
+func (w *watcher) Tasks() map[string]*Task {
+	w.RLock()
+	defer w.RUnlock()
+	res := make(map[string]*Task, len(w.tasks))
+	for k, v := range w.tasks {
+		res[k] = v
+	}
+	return res
+}
+
+// Start watching the allocations, the first listing is done synchronously so errors connecting
+// to the API are returned
+func (w *watcher) Start() error {
+	w.log.Debug("Start Nomad allocations watcher")
+	if err := w.sync(); err != nil {
+		return err
+	}
+
+	w.stopped.Add(1)
+	go w.watch()
+	return nil
+}
+
+// Stop watching the allocations
+func (w *watcher) Stop() {
+	w.stop()
+	w.stopped.Wait()
+}
+
+func (w *watcher) watch() {
+	defer w.stopped.Done()
+
+	poll.Loop(w.ctx, w.log, poll.Config{
+		Period:      w.period,
+		MaxBackoff:  maxBackoff,
+		Description: "listing Nomad allocations",
+	}, w.sync)
+	w.log.Debug("Watcher stopped")
+}
+
+// sync lists the allocations, blocking until there are changes after the last listing, and
+// publishes the events of the tasks that started or stopped
+func (w *watcher) sync() error {
+	allocations, index, err := w.api.Allocations(w.ctx, w.index)
+	if err != nil {
+		// Start over with a full listing
+		w.index = 0
+		return err
+	}
+	// The index can go backwards if the state of the servers is restored
+	if index < w.index {
+		index = 0
+	}
+	w.index = index
+
+	running := make(map[string]*Task)
+	for i := range allocations {
+		alloc := &allocations[i]
+		if alloc.ClientStatus != StatusRunning || !w.onNode(alloc) {
+			continue
+		}
+		for name, state := range alloc.TaskStates {
+			if state.State == StatusRunning {
+				running[taskKey(alloc.ID, name)] = &Task{Name: name, State: state, Allocation: alloc}
+			}
+		}
+	}
+
+	w.Lock()
+	started, stopped := poll.Diff(w.tasks, running, nil)
+	w.tasks = running
+	w.Unlock()
+
+	poll.Publish(w.bus, "task", started, stopped)
+	return nil
+}
+
+func (w *watcher) onNode(alloc *Allocation) bool {
+	return w.node == "" || alloc.NodeID == w.node || alloc.NodeName == w.node
+}
+
+func (w *watcher) ListenStart() bus.Listener {
+	return w.bus.Subscribe("start")
+}
+
+func (w *watcher) ListenStop() bus.Listener {
+	return w.bus.Subscribe("stop")
+}
+
+func (t *Task) String() string {
+	return fmt.Sprintf("%s[%s]", t.Allocation.Name, t.Name)
+}
@@ -0,0 +1,161 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package nomad
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-autodiscover/internal/polltest"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type mockAPI struct {
+	polltest.Source[Allocation]
+}
+
+func (m *mockAPI) Allocations(ctx context.Context, index uint64) ([]Allocation, uint64, error) {
+	return m.List()
+}
+
+func allocation(id, node string, tasks map[string]string) Allocation {
+	states := make(map[string]TaskState, len(tasks))
+	for name, state := range tasks {
+		states[name] = TaskState{State: state}
+	}
+	return Allocation{
+		ID:           id,
+		Name:         "web.frontend[0]",
+		Namespace:    "default",
+		NodeID:       node,
+		NodeName:     "node-" + node,
+		JobID:        "web",
+		JobType:      "service",
+		TaskGroup:    "frontend",
+		ClientStatus: StatusRunning,
+		TaskStates:   states,
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	api := &mockAPI{}
+	api.Set(
+		allocation("a1", "n1", map[string]string{"nginx": "running", "init": "dead"}),
+		allocation("b2", "n2", map[string]string{"redis": "running"}),
+	)
+
+	w, err := NewWatcher(logp.L(), api, Config{Node: "n1", SyncPeriod: 10 * time.Millisecond})
+	require.NoError(t, err)
+	start, stop := polltest.Start(t, w)
+
+	task := polltest.NextEvent(t, start)["task"].(*Task)
+	assert.Equal(t, "nginx", task.Name)
+	assert.Equal(t, "a1", task.Allocation.ID)
+	assert.Len(t, w.Tasks(), 1)
+	assert.Contains(t, w.Tasks(), "a1/nginx")
+
+	// Task stopped and new allocation of the node, matched by its name
+	byName := allocation("c3", "n3", map[string]string{"nginx": "running"})
+	byName.NodeName = "n1"
+	api.Set(allocation("a1", "n1", map[string]string{"nginx": "dead"}), byName)
+
+	assert.Equal(t, "c3", polltest.NextEvent(t, start)["task"].(*Task).Allocation.ID)
+	assert.Equal(t, "a1", polltest.NextEvent(t, stop)["task"].(*Task).Allocation.ID)
+}
+
+func TestWatcherStartError(t *testing.T) {
+	polltest.StartError(t, func(err error) (polltest.Watcher, error) {
+		api := &mockAPI{}
+		api.Fail(err)
+		return NewWatcher(logp.L(), api, Config{})
+	})
+
+	_, err := NewWatcher(logp.L(), &mockAPI{}, Config{SyncPeriod: -time.Second})
+	assert.Error(t, err)
+}
+
+func TestClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/allocations", r.URL.Path)
+		assert.Equal(t, "secret", r.Header.Get(tokenHeader))
+		assert.Equal(t, "apps", r.URL.Query().Get("namespace"))
+		if r.URL.Query().Get("index") != "" {
+			assert.Equal(t, "42", r.URL.Query().Get("index"))
+			assert.Equal(t, "1m0s", r.URL.Query().Get("wait"))
+		}
+		w.Header().Set(indexHeader, "43")
+		_ = json.NewEncoder(w).Encode([]map[string]interface{}{
+			{
+				"ID":           "a1",
+				"JobID":        "web",
+				"ClientStatus": "running",
+				"TaskStates": map[string]interface{}{
+					"nginx": map[string]interface{}{"State": "running", "StartedAt": "2022-06-01T10:00:00Z"},
+				},
+			},
+		})
+	}))
+	defer server.Close()
+
+	api, err := NewClient(Config{Address: server.URL, Namespace: "apps", SecretID: "secret", WaitTime: time.Minute})
+	require.NoError(t, err)
+
+	for _, index := range []uint64{0, 42} {
+		allocations, lastIndex, err := api.Allocations(context.Background(), index)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(43), lastIndex)
+		require.Len(t, allocations, 1)
+		assert.Equal(t, "web", allocations[0].JobID)
+		assert.Equal(t, "running", allocations[0].TaskStates["nginx"].State)
+		assert.Equal(t, 2022, allocations[0].TaskStates["nginx"].StartedAt.Year())
+	}
+
+	// Errors of the API
+	failing := polltest.FailingServer(t, http.StatusForbidden, "ACL token not found")
+	api, err = NewClient(Config{Address: failing.URL})
+	require.NoError(t, err)
+	_, _, err = api.Allocations(context.Background(), 0)
+	assert.Error(t, err)
+}
+
+func TestGenerateMetadata(t *testing.T) {
+	alloc := allocation("a1", "n1", map[string]string{"nginx": "running"})
+	meta := GenerateMetadata(&Task{Name: "nginx", Allocation: &alloc})
+	assert.Equal(t, mapstr.M{
+		"nomad": mapstr.M{
+			"namespace":  "default",
+			"job":        mapstr.M{"name": "web", "type": "service"},
+			"task":       mapstr.M{"name": "nginx", "group": "frontend"},
+			"allocation": mapstr.M{"id": "a1", "name": "web.frontend[0]", "status": "running"},
+			"node":       mapstr.M{"id": "n1", "name": "node-n1"},
+		},
+		"orchestrator": mapstr.M{
+			"type":      "nomad",
+			"namespace": "default",
+			"resource":  mapstr.M{"type": "task", "name": "nginx"},
+		},
+	}, meta)
+}
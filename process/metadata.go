@@ -0,0 +1,52 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package process
+
+import (
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// GenerateMetadata returns the metadata of a process under `process`. The arguments are not
+// included, only the hash of the command line, as they could contain secrets.
+func GenerateMetadata(p *Process) mapstr.M {
+	meta := mapstr.M{
+		"pid":  p.PID,
+		"name": p.Name,
+		"parent": mapstr.M{
+			"pid": p.PPID,
+		},
+		"command_line_hash": p.CmdlineHash,
+	}
+	if p.Exe != "" {
+		meta["executable"] = p.Exe
+	}
+	if len(p.Ports) > 0 {
+		ports := make([]mapstr.M, len(p.Ports))
+		for i, port := range p.Ports {
+			ports[i] = mapstr.M{
+				"protocol": port.Protocol,
+				"address":  port.Address,
+				"port":     port.Port,
+			}
+		}
+		meta["ports"] = ports
+	}
+	return mapstr.M{
+		"process": meta,
+	}
+}
@@ -0,0 +1,247 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package process
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Process running in the host
+type Process struct {
+	PID  int
+	PPID int
+
+	// Name is the command name of the process, truncated by the kernel to 15 characters
+	Name string
+
+	// Exe is the path of the executable, empty if it cannot be read
+	Exe  string
+	Args []string
+
+	// CmdlineHash identifies the command line of the process without exposing its arguments,
+	// that could include secrets
+	CmdlineHash string
+
+	// StartTime is the start time of the process in clock ticks after boot, with the PID it
+	// identifies the process
+	StartTime uint64
+
+	// Ports the process is listening on
+	Ports []Port
+}
+
+// Port a process is listening on
+type Port struct {
+	Protocol string
+	Address  string
+	Port     uint16
+}
+
+// procfs reads the processes of a proc filesystem
+type procfs struct {
+	root string
+}
+
+// processes returns the processes of the proc filesystem, kernel threads are skipped
+func (fs procfs) processes() ([]*Process, error) {
+	entries, err := os.ReadDir(fs.root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %w", err)
+	}
+	var processes []*Process
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		// Processes can exit while the filesystem is read, they are skipped
+		p, err := fs.process(pid)
+		if err != nil || p == nil {
+			continue
+		}
+		processes = append(processes, p)
+	}
+	return processes, nil
+}
+
+func (fs procfs) process(pid int) (*Process, error) {
+	dir := filepath.Join(fs.root, strconv.Itoa(pid))
+
+	cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline"))
+	if err != nil {
+		return nil, err
+	}
+	cmdline = bytes.TrimRight(cmdline, "\x00")
+	if len(cmdline) == 0 {
+		// Kernel thread or zombie
+		return nil, nil
+	}
+
+	stat, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return nil, err
+	}
+	name, ppid, startTime, err := parseStat(stat)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stat of process %d: %w", pid, err)
+	}
+
+	sum := sha256.Sum256(cmdline)
+	exe, _ := os.Readlink(filepath.Join(dir, "exe"))
+	return &Process{
+		PID:         pid,
+		PPID:        ppid,
+		Name:        name,
+		Exe:         exe,
+		Args:        strings.Split(string(cmdline), "\x00"),
+		CmdlineHash: hex.EncodeToString(sum[:]),
+		StartTime:   startTime,
+	}, nil
+}
+
+// parseStat returns the command name, parent PID and start time of /proc/<pid>/stat
+func parseStat(stat []byte) (name string, ppid int, startTime uint64, err error) {
+	// The name is between parentheses and can contain spaces and parentheses
+	start := bytes.IndexByte(stat, '(')
+	end := bytes.LastIndexByte(stat, ')')
+	if start < 0 || end < start {
+		return "", 0, 0, fmt.Errorf("no command name")
+	}
+	name = string(stat[start+1 : end])
+
+	// Fields after the name, starting with the state (field 3)
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 20 {
+		return "", 0, 0, fmt.Errorf("expected at least 22 fields, found %d", len(fields)+2)
+	}
+	if ppid, err = strconv.Atoi(fields[1]); err != nil {
+		return "", 0, 0, err
+	}
+	if startTime, err = strconv.ParseUint(fields[19], 10, 64); err != nil {
+		return "", 0, 0, err
+	}
+	return name, ppid, startTime, nil
+}
+
+// listeningSockets returns the listening TCP sockets and the bound UDP sockets by their inode
+func (fs procfs) listeningSockets() map[uint64]Port {
+	sockets := make(map[uint64]Port)
+	for _, protocol := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		data, err := os.ReadFile(filepath.Join(fs.root, "net", protocol))
+		if err != nil {
+			continue
+		}
+		parseSockets(data, protocol, sockets)
+	}
+	return sockets
+}
+
+const (
+	tcpListen = "0A"
+	udpClose  = "07"
+)
+
+// parseSockets parses a /proc/net/{tcp,udp}[6] table into sockets
+func parseSockets(data []byte, protocol string, sockets map[uint64]Port) {
+	state := tcpListen
+	if strings.HasPrefix(protocol, "udp") {
+		state = udpClose
+	}
+	lines := strings.Split(string(data), "\n")
+	for _, line := range lines[1:] {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+		fields := strings.Fields(line)
+		if len(fields) < 10 || fields[3] != state {
+			continue
+		}
+		inode, err := strconv.ParseUint(fields[9], 10, 64)
+		if err != nil || inode == 0 {
+			continue
+		}
+		address, port, err := parseAddress(fields[1])
+		if err != nil {
+			continue
+		}
+		sockets[inode] = Port{Protocol: strings.TrimSuffix(protocol, "6"), Address: address, Port: port}
+	}
+}
+
+// parseAddress parses addresses like 0100007F:1F90, IPs are in host byte order per 32 bits word
+func parseAddress(s string) (string, uint16, error) {
+	hexIP, hexPort, ok := strings.Cut(s, ":")
+	if !ok {
+		return "", 0, fmt.Errorf("invalid address %q", s)
+	}
+	port, err := strconv.ParseUint(hexPort, 16, 16)
+	if err != nil {
+		return "", 0, err
+	}
+	raw, err := hex.DecodeString(hexIP)
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return "", 0, fmt.Errorf("invalid address %q", s)
+	}
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		ip[i], ip[i+1], ip[i+2], ip[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+	return ip.String(), uint16(port), nil
+}
+
+// ports returns the ports of the sockets the process has open
+func (fs procfs) ports(pid int, sockets map[uint64]Port) []Port {
+	dir := filepath.Join(fs.root, strconv.Itoa(pid), "fd")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var ports []Port
+	seen := make(map[Port]bool)
+	for _, entry := range entries {
+		link, err := os.Readlink(filepath.Join(dir, entry.Name()))
+		if err != nil || !strings.HasPrefix(link, "socket:[") {
+			continue
+		}
+		inode, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]"), 10, 64)
+		if err != nil {
+			continue
+		}
+		if port, ok := sockets[inode]; ok && !seen[port] {
+			seen[port] = true
+			ports = append(ports, port)
+		}
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		if ports[i].Port != ports[j].Port {
+			return ports[i].Port < ports[j].Port
+		}
+		if ports[i].Protocol != ports[j].Protocol {
+			return ports[i].Protocol < ports[j].Protocol
+		}
+		return ports[i].Address < ports[j].Address
+	})
+	return ports
+}
@@ -0,0 +1,261 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package process discovers the long-running processes of the host matching some patterns, for
+// workloads that don't run in containers, scanning the proc filesystem.
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+	"github.com/elastic/elastic-agent-autodiscover/internal/poll"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+const (
+	defaultProcPath   = "/proc"
+	defaultSyncPeriod = 10 * time.Second
+	defaultMinAge     = 30 * time.Second
+)
+
+// Config of the processes provider
+type Config struct {
+	// Patterns are regular expressions matched against the name, the executable and the command
+	// line of the processes, at least one is required
+	Patterns []string `config:"patterns"`
+
+	// MinAge is the time processes have to be running before they are discovered, so short-lived
+	// processes are ignored
+	MinAge *time.Duration `config:"min_age"`
+
+	// ProcPath is the mount point of the proc filesystem, /proc by default, e.g. /hostfs/proc when
+	// the agent runs in a container
+	ProcPath string `config:"proc_path"`
+
+	// SyncPeriod is the time waited between scans of the processes
+	SyncPeriod time.Duration `config:"sync_period"`
+}
+
+// Validate the config
+func (c *Config) Validate() error {
+	if len(c.Patterns) == 0 {
+		return errors.New("at least one process pattern is required")
+	}
+	for _, p := range c.Patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("invalid process pattern %q: %w", p, err)
+		}
+	}
+	if c.MinAge != nil && *c.MinAge < 0 {
+		return fmt.Errorf("invalid process min age %v", *c.MinAge)
+	}
+	if c.SyncPeriod < 0 {
+		return fmt.Errorf("invalid process sync period %v", c.SyncPeriod)
+	}
+	return nil
+}
+
+// Watcher scans the processes of the host and keeps a list of the long-running processes matching
+// the patterns
+type Watcher interface {
+	// Start watching the processes
+	Start() error
+
+	// Stop watching the processes
+	Stop()
+
+	// Processes returns the discovered processes by their PID
+	Processes() map[int]*Process
+
+	// ListenStart returns a bus listener to receive the matching processes once they reach the
+	// minimum age, with a `process` key holding them. Processes are started again when their
+	// listening ports change.
+	ListenStart() bus.Listener
+
+	// ListenStop returns a bus listener to receive the matching processes that exit or whose
+	// listening ports change, with a `process` key holding their previous state
+	ListenStop() bus.Listener
+}
+
+type watcher struct {
+	sync.RWMutex
+	log      *logp.Logger
+	fs       procfs
+	patterns []*regexp.Regexp
+	minAge   time.Duration
+	period   time.Duration
+	ctx      context.Context
+	stop     context.CancelFunc
+	stopped  sync.WaitGroup
+	bus      bus.Bus
+
+	// Matching processes by key, with the time they were first seen
+	seen      map[string]time.Time
+	processes map[string]*Process
+}
+
+// NewWatcher creates a new Watcher of the processes matching the config
+func NewWatcher(log *logp.Logger, cfg Config) (Watcher, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	patterns := make([]*regexp.Regexp, len(cfg.Patterns))
+	for i, p := range cfg.Patterns {
+		patterns[i] = regexp.MustCompile(p)
+	}
+	root := cfg.ProcPath
+	if root == "" {
+		root = defaultProcPath
+	}
+	minAge := defaultMinAge
+	if cfg.MinAge != nil {
+		minAge = *cfg.MinAge
+	}
+	period := cfg.SyncPeriod
+	if period == 0 {
+		period = defaultSyncPeriod
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &watcher{
+		log:       log,
+		fs:        procfs{root: root},
+		patterns:  patterns,
+		minAge:    minAge,
+		period:    period,
+		ctx:       ctx,
+		stop:      cancel,
+		bus:       bus.New(log, "process"),
+		seen:      make(map[string]time.Time),
+		processes: make(map[string]*Process),
+	}, nil
+}
+
+// Processes returns the discovered processes
+func (w *watcher) Processes() map[int]*Process {
+	w.RLock()
+	defer w.RUnlock()
+	res := make(map[int]*Process, len(w.processes))
+	for _, p := range w.processes {
+		res[p.PID] = p
+	}
+	return res
+}
+
+// Start watching the processes, the first scan is done synchronously so errors reading the proc
+// filesystem are returned
+func (w *watcher) Start() error {
+	w.log.Debug("Start processes watcher")
+	if err := w.sync(); err != nil {
+		return err
+	}
+
+	w.stopped.Add(1)
+	go w.watch()
+	return nil
+}
+
+// Stop watching the processes
+func (w *watcher) Stop() {
+	w.stop()
+	w.stopped.Wait()
+}
+
+func (w *watcher) watch() {
+	defer w.stopped.Done()
+
+	poll.Loop(w.ctx, w.log, poll.Config{
+		Period:      w.period,
+		Description: "scanning processes",
+	}, w.sync)
+	w.log.Debug("Watcher stopped")
+}
+
+// sync scans the processes and publishes the events of the matching processes that have been
+// running for the minimum age, and of the ones that exited. Processes whose listening ports
+// change are stopped and started again with the new ports.
+func (w *watcher) sync() error {
+	processes, err := w.fs.processes()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var sockets map[uint64]Port
+	running := make(map[string]*Process)
+	seen := make(map[string]time.Time)
+	for _, p := range processes {
+		if !w.matches(p) {
+			continue
+		}
+		key := processKey(p)
+		first, ok := w.seen[key]
+		if !ok {
+			first = now
+		}
+		seen[key] = first
+		if now.Sub(first) < w.minAge {
+			continue
+		}
+		if sockets == nil {
+			sockets = w.fs.listeningSockets()
+		}
+		p.Ports = w.fs.ports(p.PID, sockets)
+		running[key] = p
+	}
+
+	w.Lock()
+	w.seen = seen
+	started, stopped := poll.Diff(w.processes, running, func(old, p *Process) bool {
+		return !reflect.DeepEqual(old.Ports, p.Ports)
+	})
+	w.processes = running
+	w.Unlock()
+
+	poll.Publish(w.bus, "process", started, stopped)
+	return nil
+}
+
+func (w *watcher) matches(p *Process) bool {
+	cmdline := strings.Join(p.Args, " ")
+	for _, pattern := range w.patterns {
+		if pattern.MatchString(p.Name) || (p.Exe != "" && pattern.MatchString(p.Exe)) || pattern.MatchString(cmdline) {
+			return true
+		}
+	}
+	return false
+}
+
+// processKey identifies a process, PIDs can be reused by processes started later
+func processKey(p *Process) string {
+	return fmt.Sprintf("%d/%d", p.PID, p.StartTime)
+}
+
+func (w *watcher) ListenStart() bus.Listener {
+	return w.bus.Subscribe("start")
+}
+
+func (w *watcher) ListenStop() bus.Listener {
+	return w.bus.Subscribe("stop")
+}
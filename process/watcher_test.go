@@ -0,0 +1,170 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package process
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-autodiscover/internal/polltest"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const tcpTable = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1001 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:8124 0100007F:1F90 01 00000000:00000000 00:00000000 00000000     0        0 1002 1 0000000000000000 20 4 30 10 -1
+`
+
+const tcp6Table = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000001000000:0CEA 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1003 1 0000000000000000 100 0 0 10 0
+`
+
+// writeProcess writes a process to a fake proc filesystem, with file descriptors for the given
+// socket inodes
+func writeProcess(t *testing.T, root string, pid int, name string, cmdline []string, startTime int, inodes ...int) {
+	t.Helper()
+	dir := filepath.Join(root, strconv.Itoa(pid))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "fd"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cmdline"), []byte(strings.Join(cmdline, "\x00")+"\x00"), 0o644))
+	stat := fmt.Sprintf("%d (%s) S 1 %d %d 0 -1 4194560 100 0 0 0 1 2 0 0 20 0 1 0 %d 1000 100", pid, name, pid, pid, startTime)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0o644))
+	for i, inode := range inodes {
+		require.NoError(t, os.Symlink(fmt.Sprintf("socket:[%d]", inode), filepath.Join(dir, "fd", strconv.Itoa(i+3))))
+	}
+}
+
+func newProcFS(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "net"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "net", "tcp"), []byte(tcpTable), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "net", "tcp6"), []byte(tcp6Table), 0o644))
+	return root
+}
+
+func TestProcFS(t *testing.T) {
+	root := newProcFS(t)
+	writeProcess(t, root, 100, "nginx: master", []string{"nginx", "-g", "daemon off;"}, 5000, 1001, 1002, 1003)
+	writeProcess(t, root, 200, "kthreadd", nil, 1)
+	require.NoError(t, os.WriteFile(filepath.Join(root, "200", "cmdline"), nil, 0o644))
+
+	fs := procfs{root: root}
+	processes, err := fs.processes()
+	require.NoError(t, err)
+	require.Len(t, processes, 1)
+
+	p := processes[0]
+	assert.Equal(t, 100, p.PID)
+	assert.Equal(t, 1, p.PPID)
+	assert.Equal(t, "nginx: master", p.Name)
+	assert.Equal(t, []string{"nginx", "-g", "daemon off;"}, p.Args)
+	assert.Equal(t, uint64(5000), p.StartTime)
+	assert.Len(t, p.CmdlineHash, 64)
+
+	assert.Equal(t, []Port{
+		{Protocol: "tcp", Address: "::1", Port: 3306},
+		{Protocol: "tcp", Address: "0.0.0.0", Port: 8080},
+	}, fs.ports(100, fs.listeningSockets()))
+}
+
+func TestParseStat(t *testing.T) {
+	name, ppid, start, err := parseStat([]byte("42 (weird (name) x) R 7 42 42 0 -1 0 0 0 0 0 0 0 0 0 20 0 1 0 123 0 0"))
+	require.NoError(t, err)
+	assert.Equal(t, "weird (name) x", name)
+	assert.Equal(t, 7, ppid)
+	assert.Equal(t, uint64(123), start)
+
+	_, _, _, err = parseStat([]byte("42 (short) R 7"))
+	assert.Error(t, err)
+}
+
+func TestWatcher(t *testing.T) {
+	root := newProcFS(t)
+	writeProcess(t, root, 100, "nginx", []string{"/usr/sbin/nginx"}, 5000, 1001)
+	writeProcess(t, root, 101, "bash", []string{"bash"}, 5001)
+
+	minAge := time.Duration(0)
+	w, err := NewWatcher(logp.L(), Config{Patterns: []string{"nginx", "^redis-server"}, MinAge: &minAge, ProcPath: root, SyncPeriod: 10 * time.Millisecond})
+	require.NoError(t, err)
+	start, stop := polltest.Start(t, w)
+
+	p := polltest.NextEvent(t, start)["process"].(*Process)
+	assert.Equal(t, 100, p.PID)
+	assert.Equal(t, []Port{{Protocol: "tcp", Address: "0.0.0.0", Port: 8080}}, p.Ports)
+	assert.Len(t, w.Processes(), 1)
+
+	// nginx exits and its PID is reused by redis
+	require.NoError(t, os.RemoveAll(filepath.Join(root, "100")))
+	writeProcess(t, root, 100, "redis-server", []string{"redis-server", "*:6379"}, 9000)
+
+	assert.Equal(t, "nginx", polltest.NextEvent(t, stop)["process"].(*Process).Name)
+	assert.Equal(t, "redis-server", polltest.NextEvent(t, start)["process"].(*Process).Name)
+}
+
+func TestWatcherMinAge(t *testing.T) {
+	root := newProcFS(t)
+	writeProcess(t, root, 100, "nginx", []string{"nginx"}, 5000)
+
+	minAge := 100 * time.Millisecond
+	w, err := NewWatcher(logp.L(), Config{Patterns: []string{"nginx"}, MinAge: &minAge, ProcPath: root, SyncPeriod: 10 * time.Millisecond})
+	require.NoError(t, err)
+	start, _ := polltest.Start(t, w)
+
+	assert.Empty(t, w.Processes())
+	started := time.Now()
+	polltest.NextEvent(t, start)
+	assert.True(t, time.Since(started) >= 90*time.Millisecond)
+}
+
+func TestConfigValidate(t *testing.T) {
+	assert.Error(t, (&Config{}).Validate())
+	assert.Error(t, (&Config{Patterns: []string{"("}}).Validate())
+	assert.NoError(t, (&Config{Patterns: []string{"nginx"}}).Validate())
+}
+
+func TestGenerateMetadata(t *testing.T) {
+	assert.Equal(t, mapstr.M{
+		"process": mapstr.M{
+			"pid":               100,
+			"name":              "nginx",
+			"parent":            mapstr.M{"pid": 1},
+			"executable":        "/usr/sbin/nginx",
+			"command_line_hash": "abc",
+			"ports": []mapstr.M{
+				{"protocol": "tcp", "address": "0.0.0.0", "port": uint16(8080)},
+			},
+		},
+	}, GenerateMetadata(&Process{
+		PID:         100,
+		PPID:        1,
+		Name:        "nginx",
+		Exe:         "/usr/sbin/nginx",
+		Args:        []string{"nginx", "-c", "secret.conf"},
+		CmdlineHash: "abc",
+		Ports:       []Port{{Protocol: "tcp", Address: "0.0.0.0", Port: 8080}},
+	}))
+}
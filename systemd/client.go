@@ -0,0 +1,231 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package systemd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSystemctl  = "systemctl"
+	defaultSyncPeriod = 10 * time.Second
+
+	// defaultResyncPeriod is the default period of the full listings of the managers notifying changes
+	defaultResyncPeriod = 5 * time.Minute
+)
+
+// unitProperties are the properties always requested for every unit
+var unitProperties = []string{"Id", "Description", "LoadState", "ActiveState", "SubState", "Slice", "ControlGroup", "MainPID"}
+
+// Config of the systemd units provider
+type Config struct {
+	// Types of the units to discover, services by default
+	Types []string `config:"types"`
+
+	// Units are glob patterns of the names of the units to discover, all by default
+	Units []string `config:"units"`
+
+	// Properties are additional unit properties added to the metadata, like `ExecMainStartTimestamp`
+	Properties []string `config:"properties"`
+
+	// User connects to the user service manager of the agent instead of the system one
+	User bool `config:"user"`
+
+	// DBusAddress is the address of the bus to connect to, like unix:path=/run/dbus/system_bus_socket,
+	// by default the system or session bus of the environment
+	DBusAddress string `config:"dbus_address"`
+
+	// Systemctl is the path of the systemctl binary, used by the manager of NewSystemctlManager
+	Systemctl string `config:"systemctl"`
+
+	// SyncPeriod is the time waited between listings of the units. Managers notifying changes, like
+	// the D-Bus one, list the units when they change, and only resync them every SyncPeriod.
+	SyncPeriod time.Duration `config:"sync_period"`
+}
+
+// Validate the config
+func (c *Config) Validate() error {
+	if c.SyncPeriod < 0 {
+		return fmt.Errorf("invalid systemd sync period %v", c.SyncPeriod)
+	}
+	for _, p := range c.Properties {
+		if p == "" || strings.ContainsAny(p, "=, ") {
+			return fmt.Errorf("invalid systemd unit property %q", p)
+		}
+	}
+	return nil
+}
+
+// Manager is the subset of the systemd manager used by the watcher
+type Manager interface {
+	// Units returns the active units of the given types, with the requested properties
+	Units(ctx context.Context, types []string, properties []string) ([]Unit, error)
+}
+
+type systemctl struct {
+	path string
+	user bool
+
+	// run executes systemctl with the given arguments, returning its output
+	run func(ctx context.Context, path string, args ...string) ([]byte, error)
+}
+
+// NewSystemctlManager returns a Manager using systemctl, for hosts where the bus cannot be reached.
+// It doesn't notify changes, so the watcher polls it every SyncPeriod.
+func NewSystemctlManager(cfg Config) (Manager, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	path := cfg.Systemctl
+	if path == "" {
+		path = defaultSystemctl
+	}
+	return &systemctl{path: path, user: cfg.User, run: runCommand}, nil
+}
+
+func runCommand(ctx context.Context, path string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w: %s", path, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// Units returns the active units of the given types
+func (s *systemctl) Units(ctx context.Context, types []string, properties []string) ([]Unit, error) {
+	args := s.args("list-units", "--state=active", "--no-legend", "--plain", "--full", "--no-pager")
+	if len(types) > 0 {
+		args = append(args, "--type="+strings.Join(types, ","))
+	}
+	out, err := s.run(ctx, s.path, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list systemd units: %w", err)
+	}
+	var names []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		// UNIT LOAD ACTIVE SUB DESCRIPTION
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 {
+			names = append(names, fields[0])
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	props := append(append([]string(nil), unitProperties...), properties...)
+	args = s.args("show", "--no-pager", "--property="+strings.Join(props, ","))
+	args = append(args, "--")
+	args = append(args, names...)
+	out, err = s.run(ctx, s.path, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the properties of systemd units: %w", err)
+	}
+	return parseShow(out, properties)
+}
+
+func (s *systemctl) args(command string, args ...string) []string {
+	if s.user {
+		return append([]string{"--user", command}, args...)
+	}
+	return append([]string{command}, args...)
+}
+
+// parseShow parses the output of `systemctl show`, blocks of `Property=value` lines separated by
+// empty lines, one per unit
+func parseShow(out []byte, properties []string) ([]Unit, error) {
+	var units []Unit
+	var props map[string]string
+	flush := func() error {
+		if props == nil {
+			return nil
+		}
+		unit, err := newUnit(props, properties)
+		if err != nil {
+			return err
+		}
+		units = append(units, unit)
+		props = nil
+		return nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("unexpected systemctl show line %q", line)
+		}
+		if props == nil {
+			props = make(map[string]string)
+		}
+		props[key] = value
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return units, scanner.Err()
+}
+
+func newUnit(props map[string]string, properties []string) (Unit, error) {
+	unit := Unit{
+		Name:         props["Id"],
+		Description:  props["Description"],
+		LoadState:    props["LoadState"],
+		ActiveState:  props["ActiveState"],
+		SubState:     props["SubState"],
+		Slice:        props["Slice"],
+		ControlGroup: props["ControlGroup"],
+	}
+	if unit.Name == "" {
+		return unit, errors.New("systemd unit without Id")
+	}
+	if pid := props["MainPID"]; pid != "" {
+		var err error
+		if unit.MainPID, err = strconv.Atoi(pid); err != nil {
+			return unit, fmt.Errorf("invalid main PID of systemd unit %s: %w", unit.Name, err)
+		}
+	}
+	if len(properties) > 0 {
+		unit.Properties = make(map[string]string, len(properties))
+		for _, p := range properties {
+			if value, ok := props[p]; ok {
+				unit.Properties[p] = value
+			}
+		}
+	}
+	return unit, nil
+}
@@ -0,0 +1,357 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package systemd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	sddbus "github.com/coreos/go-systemd/v22/dbus"
+	"github.com/godbus/dbus/v5"
+)
+
+// errDBusClosed is returned by Subscribe when the connection is closed while subscribing
+var errDBusClosed = errors.New("dbus connection closed")
+
+// Subscriber is implemented by the managers that notify the changes of the units, so the watcher
+// lists them when they change instead of waiting for the next sync period
+type Subscriber interface {
+	// Subscribe to the changes of the units. The returned channel receives a value after changes,
+	// several changes can be coalesced in a single value, and it is closed if the subscription
+	// fails. The subscription is cancelled with the context.
+	Subscribe(ctx context.Context) (<-chan struct{}, error)
+}
+
+// systemdConn is the subset of the go-systemd connection used by the manager
+type systemdConn interface {
+	ListUnitsContext(ctx context.Context) ([]sddbus.UnitStatus, error)
+	GetUnitTypePropertiesContext(ctx context.Context, unit string, unitType string) (map[string]interface{}, error)
+	GetUnitPropertiesContext(ctx context.Context, unit string) (map[string]interface{}, error)
+	Subscribe() error
+	SetPropertiesSubscriber(updateCh chan<- *sddbus.PropertiesUpdate, errCh chan<- error)
+	Close()
+}
+
+// connection to systemd, with a channel closed when the connection is lost
+type connection struct {
+	systemdConn
+	done <-chan struct{}
+}
+
+// unitDetails are the properties of a unit not included in the list of units
+type unitDetails struct {
+	slice        string
+	controlGroup string
+	mainPID      int
+	properties   map[string]string
+}
+
+// dbusManager is a Manager talking to systemd through D-Bus, it subscribes to the changes of the
+// units so they are only listed when they change, and caches their properties until they change
+type dbusManager struct {
+	dial func() (*connection, error)
+
+	lock    sync.Mutex
+	conn    *connection
+	changes chan struct{}
+	details map[string]unitDetails
+}
+
+// NewManager returns a Manager connected to systemd through D-Bus, to the system bus, or to the
+// session bus if User is set. It also implements Subscriber to be notified of the changes of the
+// units.
+func NewManager(cfg Config) (Manager, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	connect := dbus.ConnectSystemBus
+	switch {
+	case cfg.DBusAddress != "":
+		connect = func(opts ...dbus.ConnOption) (*dbus.Conn, error) {
+			return dbus.Connect(cfg.DBusAddress, opts...)
+		}
+	case cfg.User:
+		connect = dbus.ConnectSessionBus
+	}
+	return &dbusManager{dial: func() (*connection, error) { return dial(connect) }}, nil
+}
+
+// dial connects to systemd, go-systemd opens two connections to the bus, one for the calls and
+// another one for the signals
+func dial(connect func(opts ...dbus.ConnOption) (*dbus.Conn, error)) (*connection, error) {
+	var conns []*dbus.Conn
+	conn, err := sddbus.NewConnection(func() (*dbus.Conn, error) {
+		c, err := connect()
+		if err == nil {
+			conns = append(conns, c)
+		}
+		return c, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to systemd: %w", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-conns[0].Context().Done():
+		case <-conns[1].Context().Done():
+		}
+		conn.Close()
+		close(done)
+	}()
+	return &connection{systemdConn: conn, done: done}, nil
+}
+
+// connection returns the connection to systemd, connecting if it isn't connected
+func (m *dbusManager) connection() (*connection, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.conn != nil {
+		select {
+		case <-m.conn.done:
+			m.disconnected(m.conn)
+		default:
+			return m.conn, nil
+		}
+	}
+	conn, err := m.dial()
+	if err != nil {
+		return nil, err
+	}
+	m.conn = conn
+	return conn, nil
+}
+
+// disconnected forgets a closed connection and its subscription, it must be called with the lock
+func (m *dbusManager) disconnected(conn *connection) {
+	if m.conn != conn {
+		return
+	}
+	m.conn = nil
+	m.details = nil
+	if m.changes != nil {
+		close(m.changes)
+		m.changes = nil
+	}
+}
+
+// Subscribe to the changes of the units, signaled by systemd when the properties of a unit change
+func (m *dbusManager) Subscribe(ctx context.Context) (<-chan struct{}, error) {
+	conn, err := m.connection()
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Subscribe(); err != nil {
+		return nil, fmt.Errorf("failed to subscribe to systemd signals: %w", err)
+	}
+	// Updates are dropped when the channel is full, reporting an error instead
+	updates := make(chan *sddbus.PropertiesUpdate, 64)
+	dropped := make(chan error, 1)
+	conn.SetPropertiesSubscriber(updates, dropped)
+
+	changes := make(chan struct{}, 1)
+	m.lock.Lock()
+	if m.conn != conn {
+		m.lock.Unlock()
+		return nil, errDBusClosed
+	}
+	if m.changes != nil {
+		close(m.changes)
+	}
+	m.changes = changes
+	m.details = make(map[string]unitDetails)
+	m.lock.Unlock()
+
+	go func() {
+		defer func() {
+			m.lock.Lock()
+			m.disconnected(conn)
+			m.lock.Unlock()
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				conn.Close()
+				return
+			case <-conn.done:
+				return
+			case update := <-updates:
+				m.changed(changes, update.UnitName)
+			case <-dropped:
+				// The changed unit is unknown
+				m.changed(changes, "")
+			}
+		}
+	}()
+	return changes, nil
+}
+
+// changed invalidates the cached properties of a changed unit, or of all of them if the unit is
+// unknown, and notifies the subscriber
+func (m *dbusManager) changed(changes chan struct{}, unit string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.changes != changes {
+		return
+	}
+	if unit == "" {
+		m.details = make(map[string]unitDetails)
+	} else {
+		delete(m.details, unit)
+	}
+	select {
+	case changes <- struct{}{}:
+	default:
+	}
+}
+
+// Units returns the active units of the given types
+func (m *dbusManager) Units(ctx context.Context, types []string, properties []string) ([]Unit, error) {
+	conn, err := m.connection()
+	if err != nil {
+		return nil, err
+	}
+	list, err := conn.ListUnitsContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list systemd units: %w", err)
+	}
+
+	var units []Unit
+	for _, status := range list {
+		unit := Unit{
+			Name:        status.Name,
+			Description: status.Description,
+			LoadState:   status.LoadState,
+			ActiveState: status.ActiveState,
+			SubState:    status.SubState,
+		}
+		if unit.ActiveState != "active" || unitType(unit.Name) == "" || !hasType(unit.Name, types) {
+			continue
+		}
+		details, err := m.unitDetails(ctx, conn, unit.Name, properties)
+		if err != nil {
+			return nil, err
+		}
+		unit.Slice = details.slice
+		unit.ControlGroup = details.controlGroup
+		unit.MainPID = details.mainPID
+		unit.Properties = details.properties
+		units = append(units, unit)
+	}
+	return units, nil
+}
+
+// unitDetails returns the properties of a unit not included in the list of units, cached while
+// subscribed to its changes
+func (m *dbusManager) unitDetails(ctx context.Context, conn *connection, name string, properties []string) (unitDetails, error) {
+	m.lock.Lock()
+	details, ok := m.details[name]
+	m.lock.Unlock()
+	if ok {
+		return details, nil
+	}
+
+	// Slice, ControlGroup and MainPID are properties of the interface of each unit type, like
+	// org.freedesktop.systemd1.Service
+	typ := unitType(name)
+	props, err := conn.GetUnitTypePropertiesContext(ctx, name, strings.ToUpper(typ[:1])+typ[1:])
+	if err != nil {
+		return details, fmt.Errorf("failed to get the properties of systemd unit %s: %w", name, err)
+	}
+	details.slice = propertyString(props["Slice"])
+	details.controlGroup = propertyString(props["ControlGroup"])
+	if pid, ok := props["MainPID"].(uint32); ok {
+		details.mainPID = int(pid)
+	}
+
+	if len(properties) > 0 {
+		var unitProps map[string]interface{}
+		details.properties = make(map[string]string, len(properties))
+		for _, p := range properties {
+			value, ok := props[p]
+			if !ok {
+				if unitProps == nil {
+					if unitProps, err = conn.GetUnitPropertiesContext(ctx, name); err != nil {
+						return details, fmt.Errorf("failed to get the properties of systemd unit %s: %w", name, err)
+					}
+				}
+				if value, ok = unitProps[p]; !ok {
+					continue
+				}
+			}
+			details.properties[p] = propertyString(value)
+		}
+	}
+
+	m.lock.Lock()
+	if m.details != nil && m.conn == conn {
+		m.details[name] = details
+	}
+	m.lock.Unlock()
+	return details, nil
+}
+
+// propertyString formats a property value like systemctl show does for the basic types, booleans
+// as yes or no, and arrays separated by spaces
+func propertyString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		if v {
+			return "yes"
+		}
+		return "no"
+	case dbus.Variant:
+		return propertyString(v.Value())
+	case []string:
+		return strings.Join(v, " ")
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, e := range v {
+			values = append(values, propertyString(e))
+		}
+		return strings.Join(values, " ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// unitType returns the type of a unit, like service for nginx.service
+func unitType(name string) string {
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+func hasType(name string, types []string) bool {
+	if len(types) == 0 {
+		return true
+	}
+	typ := unitType(name)
+	for _, t := range types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,267 @@
+package systemd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	sddbus "github.com/coreos/go-systemd/v22/dbus"
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSystemd serves the calls of the D-Bus manager like systemd does through go-systemd
+type fakeSystemd struct {
+	lock      sync.Mutex
+	units     []sddbus.UnitStatus
+	typeProps map[string]map[string]interface{}
+	unitProps map[string]map[string]interface{}
+	calls     []string
+	conn      *fakeConn
+	dials     int
+}
+
+func newFakeSystemd() *fakeSystemd {
+	return &fakeSystemd{typeProps: map[string]map[string]interface{}{}, unitProps: map[string]map[string]interface{}{}}
+}
+
+// manager returns a dbusManager connecting to the fake
+func (s *fakeSystemd) manager() *dbusManager {
+	return &dbusManager{dial: func() (*connection, error) {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		s.dials++
+		s.conn = &fakeConn{systemd: s, done: make(chan struct{})}
+		return &connection{systemdConn: s.conn, done: s.conn.done}, nil
+	}}
+}
+
+// setUnit adds or replaces a unit, with the properties of its type interface
+func (s *fakeSystemd) setUnit(name, activeState string, props map[string]interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	status := sddbus.UnitStatus{Name: name, Description: "Unit " + name, LoadState: "loaded", ActiveState: activeState, SubState: "running"}
+	replaced := false
+	for i, u := range s.units {
+		if u.Name == name {
+			s.units[i] = status
+			replaced = true
+		}
+	}
+	if !replaced {
+		s.units = append(s.units, status)
+	}
+	s.typeProps[name] = props
+	s.unitProps[name] = map[string]interface{}{"ActiveEnterTimestamp": uint64(1654077600000000)}
+}
+
+func (s *fakeSystemd) served() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+func (s *fakeSystemd) call(method string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.calls = append(s.calls, method)
+}
+
+// changed notifies the change of the properties of a unit to the subscribed connection
+func (s *fakeSystemd) changed(name string) {
+	s.lock.Lock()
+	conn := s.conn
+	s.lock.Unlock()
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	if conn.updates != nil {
+		conn.updates <- &sddbus.PropertiesUpdate{UnitName: name}
+	}
+}
+
+func (s *fakeSystemd) disconnect() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.conn.Close()
+}
+
+type fakeConn struct {
+	systemd *fakeSystemd
+	done    chan struct{}
+	once    sync.Once
+
+	lock    sync.Mutex
+	updates chan<- *sddbus.PropertiesUpdate
+}
+
+func (c *fakeConn) ListUnitsContext(context.Context) ([]sddbus.UnitStatus, error) {
+	c.systemd.call("ListUnits")
+	c.systemd.lock.Lock()
+	defer c.systemd.lock.Unlock()
+	return append([]sddbus.UnitStatus(nil), c.systemd.units...), nil
+}
+
+func (c *fakeConn) GetUnitTypePropertiesContext(_ context.Context, unit string, unitType string) (map[string]interface{}, error) {
+	c.systemd.call("GetUnitTypeProperties " + unitType)
+	c.systemd.lock.Lock()
+	defer c.systemd.lock.Unlock()
+	props, ok := c.systemd.typeProps[unit]
+	if !ok {
+		return nil, errors.New("Unknown unit " + unit)
+	}
+	return props, nil
+}
+
+func (c *fakeConn) GetUnitPropertiesContext(_ context.Context, unit string) (map[string]interface{}, error) {
+	c.systemd.call("GetUnitProperties")
+	c.systemd.lock.Lock()
+	defer c.systemd.lock.Unlock()
+	return c.systemd.unitProps[unit], nil
+}
+
+func (c *fakeConn) Subscribe() error {
+	c.systemd.call("Subscribe")
+	return nil
+}
+
+func (c *fakeConn) SetPropertiesSubscriber(updateCh chan<- *sddbus.PropertiesUpdate, _ chan<- error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.updates = updateCh
+}
+
+func (c *fakeConn) Close() {
+	c.once.Do(func() { close(c.done) })
+}
+
+func count(calls []string, method string) int {
+	n := 0
+	for _, c := range calls {
+		if c == method {
+			n++
+		}
+	}
+	return n
+}
+
+func nextChange(t *testing.T, changes <-chan struct{}) {
+	t.Helper()
+	select {
+	case _, ok := <-changes:
+		require.True(t, ok, "subscription closed")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for change")
+	}
+}
+
+func TestDBusManager(t *testing.T) {
+	systemd := newFakeSystemd()
+	systemd.setUnit("nginx.service", "active", map[string]interface{}{
+		"Slice":        "system.slice",
+		"ControlGroup": "/system.slice/nginx.service",
+		"MainPID":      uint32(1234),
+	})
+	systemd.setUnit("sshd.service", "inactive", nil)
+	systemd.setUnit("docker.socket", "active", map[string]interface{}{"Slice": "system.slice"})
+
+	m := systemd.manager()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	units, err := m.Units(ctx, []string{"service"}, []string{"ActiveEnterTimestamp", "Missing"})
+	require.NoError(t, err)
+	assert.Equal(t, []Unit{{
+		Name:         "nginx.service",
+		Description:  "Unit nginx.service",
+		LoadState:    "loaded",
+		ActiveState:  "active",
+		SubState:     "running",
+		Slice:        "system.slice",
+		ControlGroup: "/system.slice/nginx.service",
+		MainPID:      1234,
+		Properties:   map[string]string{"ActiveEnterTimestamp": "1654077600000000"},
+	}}, units)
+	assert.Equal(t, []string{"ListUnits", "GetUnitTypeProperties Service", "GetUnitProperties"}, systemd.served())
+
+	// Without subscription, properties are retrieved in every listing, the properties of the unit
+	// interface only when requested
+	_, err = m.Units(ctx, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count(systemd.served(), "GetUnitTypeProperties Service")+count(systemd.served(), "GetUnitTypeProperties Socket"))
+
+	changes, err := m.Subscribe(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count(systemd.served(), "Subscribe"))
+
+	// While subscribed, properties are cached until the unit changes
+	units, err = m.Units(ctx, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, units, 2)
+	_, err = m.Units(ctx, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count(systemd.served(), "GetUnitTypeProperties Service"))
+
+	systemd.setUnit("nginx.service", "active", map[string]interface{}{"MainPID": uint32(1300)})
+	systemd.changed("nginx.service")
+	nextChange(t, changes)
+	units, err = m.Units(ctx, []string{"service"}, nil)
+	require.NoError(t, err)
+	require.Len(t, units, 1)
+	assert.Equal(t, 1300, units[0].MainPID)
+	assert.Equal(t, 4, count(systemd.served(), "GetUnitTypeProperties Service"))
+
+	// The subscription is closed when the connection is lost, and the manager reconnects
+	systemd.disconnect()
+	select {
+	case _, ok := <-changes:
+		if ok {
+			_, ok = <-changes
+		}
+		assert.False(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription not closed")
+	}
+	_, err = m.Units(ctx, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, systemd.dials)
+
+	// Cancelling the subscription closes the connection
+	_, err = m.Subscribe(ctx)
+	require.NoError(t, err)
+	cancel()
+	select {
+	case <-systemd.conn.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection not closed")
+	}
+}
+
+func TestDBusManagerErrors(t *testing.T) {
+	m, err := NewManager(Config{DBusAddress: "unix:path=/missing/bus"})
+	require.NoError(t, err)
+	_, err = m.Units(context.Background(), nil, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to connect to systemd")
+
+	_, err = NewManager(Config{SyncPeriod: -1})
+	assert.Error(t, err)
+
+	systemd := newFakeSystemd()
+	systemd.setUnit("nginx.service", "active", nil)
+	delete(systemd.typeProps, "nginx.service")
+	_, err = systemd.manager().Units(context.Background(), nil, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to get the properties of systemd unit nginx.service: Unknown unit")
+}
+
+func TestPropertyString(t *testing.T) {
+	assert.Equal(t, "", propertyString(nil))
+	assert.Equal(t, "yes", propertyString(true))
+	assert.Equal(t, "1654077600000000", propertyString(uint64(1654077600000000)))
+	assert.Equal(t, "nginx.service www.service", propertyString([]string{"nginx.service", "www.service"}))
+	assert.Equal(t, "no", propertyString(dbus.MakeVariant(false)))
+	assert.Equal(t, "-2 1.5", propertyString([]interface{}{int32(-2), 1.5}))
+}
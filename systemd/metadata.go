@@ -0,0 +1,55 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package systemd
+
+import (
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// GenerateMetadata returns the metadata of a unit under `systemd`, with the requested properties
+// of the unit under `systemd.properties`
+func GenerateMetadata(unit *Unit) mapstr.M {
+	meta := mapstr.M{
+		"unit":  unit.Name,
+		"state": unit.SubState,
+	}
+	if unit.Description != "" {
+		meta["description"] = unit.Description
+	}
+	if unit.Slice != "" {
+		meta["slice"] = unit.Slice
+	}
+	if unit.ControlGroup != "" {
+		meta["cgroup"] = mapstr.M{"path": unit.ControlGroup}
+	}
+	if len(unit.Properties) > 0 {
+		props := mapstr.M{}
+		for k, v := range unit.Properties {
+			props[k] = v
+		}
+		meta["properties"] = props
+	}
+
+	res := mapstr.M{
+		"systemd": meta,
+	}
+	if unit.MainPID > 0 {
+		res["process"] = mapstr.M{"pid": unit.MainPID}
+	}
+	return res
+}
@@ -0,0 +1,240 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package systemd discovers the services and other units running in the host, outside of
+// containers, subscribing to the changes of the units in the systemd service manager through
+// D-Bus, or polling it with systemctl.
+package systemd
+
+import (
+	"context"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-autodiscover/bus"
+	"github.com/elastic/elastic-agent-autodiscover/internal/poll"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+const (
+	maxBackoff = 2 * time.Minute
+
+	// changesDelay is the time waited after a change is notified before listing the units, so the
+	// changes of the units starting or stopping together are listed at once
+	changesDelay = 200 * time.Millisecond
+)
+
+// Unit is a systemd unit
+type Unit struct {
+	Name         string
+	Description  string
+	LoadState    string
+	ActiveState  string
+	SubState     string
+	Slice        string
+	ControlGroup string
+	MainPID      int
+
+	// Properties requested in the config
+	Properties map[string]string
+}
+
+// Watcher watches the service manager and keeps a list of the active units
+type Watcher interface {
+	// Start watching the units
+	Start() error
+
+	// Stop watching the units
+	Stop()
+
+	// Units returns the active units by their name
+	Units() map[string]*Unit
+
+	// ListenStart returns a bus listener to receive the units that become active, with a `unit`
+	// key holding them. Units are started again when their main PID changes.
+	ListenStart() bus.Listener
+
+	// ListenStop returns a bus listener to receive the units that are no longer active or whose
+	// main PID changes, with a `unit` key holding their previous state
+	ListenStop() bus.Listener
+}
+
+type watcher struct {
+	sync.RWMutex
+	log        *logp.Logger
+	manager    Manager
+	types      []string
+	patterns   []string
+	properties []string
+	period     time.Duration
+	ctx        context.Context
+	stop       context.CancelFunc
+	units      map[string]*Unit
+	stopped    sync.WaitGroup
+	bus        bus.Bus
+}
+
+// NewWatcher creates a new Watcher of the units of the manager matching the config
+func NewWatcher(log *logp.Logger, manager Manager, cfg Config) (Watcher, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	for _, p := range cfg.Units {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, err
+		}
+	}
+	types := cfg.Types
+	if len(types) == 0 {
+		types = []string{"service"}
+	}
+	period := cfg.SyncPeriod
+	if period == 0 {
+		period = defaultSyncPeriod
+		if _, ok := manager.(Subscriber); ok {
+			period = defaultResyncPeriod
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &watcher{
+		log:        log,
+		manager:    manager,
+		types:      types,
+		patterns:   cfg.Units,
+		properties: cfg.Properties,
+		period:     period,
+		ctx:        ctx,
+		stop:       cancel,
+		units:      make(map[string]*Unit),
+		bus:        bus.New(log, "systemd"),
+	}, nil
+}
+
+// Units returns the active units
+func (w *watcher) Units() map[string]*Unit {
+	w.RLock()
+	defer w.RUnlock()
+	res := make(map[string]*Unit, len(w.units))
+	for k, v := range w.units {
+		res[k] = v
+	}
+	return res
+}
+
+// Start watching the units, the first listing is done synchronously so errors reaching the
+// service manager are returned. Managers notifying changes are subscribed to before it, so no
+// change is missed.
+func (w *watcher) Start() error {
+	w.log.Debug("Start systemd units watcher")
+	subscriber, _ := w.manager.(Subscriber)
+	var changes <-chan struct{}
+	if subscriber != nil {
+		changes = w.subscribe(subscriber)
+	}
+	if err := w.sync(); err != nil {
+		return err
+	}
+
+	w.stopped.Add(1)
+	go w.watch(subscriber, changes)
+	return nil
+}
+
+// Stop watching the units
+func (w *watcher) Stop() {
+	w.stop()
+	w.stopped.Wait()
+}
+
+// watch lists the units when the subscriber notifies changes and every sync period. Closed or
+// failed subscriptions are retried every sync period.
+func (w *watcher) watch(subscriber Subscriber, changes <-chan struct{}) {
+	defer w.stopped.Done()
+
+	cfg := poll.Config{
+		Period:       w.period,
+		MaxBackoff:   maxBackoff,
+		Description:  "listing systemd units",
+		Changes:      changes,
+		ChangesDelay: changesDelay,
+	}
+	if subscriber != nil {
+		cfg.Subscribe = func() <-chan struct{} { return w.subscribe(subscriber) }
+	}
+	poll.Loop(w.ctx, w.log, cfg, w.sync)
+	w.log.Debug("Watcher stopped")
+}
+
+func (w *watcher) subscribe(subscriber Subscriber) <-chan struct{} {
+	changes, err := subscriber.Subscribe(w.ctx)
+	if err != nil {
+		if w.ctx.Err() == nil {
+			w.log.Errorf("Error subscribing to systemd changes, polling units every %v: %v", w.period, err)
+		}
+		return nil
+	}
+	return changes
+}
+
+// sync lists the units and publishes the events of the ones that started or stopped since the
+// last listing. Units whose main process changed, e.g. restarted services, are stopped and
+// started again.
+func (w *watcher) sync() error {
+	units, err := w.manager.Units(w.ctx, w.types, w.properties)
+	if err != nil {
+		return err
+	}
+
+	active := make(map[string]*Unit)
+	for i := range units {
+		unit := &units[i]
+		if unit.ActiveState == "active" && w.matches(unit.Name) {
+			active[unit.Name] = unit
+		}
+	}
+
+	w.Lock()
+	started, stopped := poll.Diff(w.units, active, func(old, unit *Unit) bool {
+		return old.MainPID != unit.MainPID
+	})
+	w.units = active
+	w.Unlock()
+
+	poll.Publish(w.bus, "unit", started, stopped)
+	return nil
+}
+
+func (w *watcher) matches(name string) bool {
+	if len(w.patterns) == 0 {
+		return true
+	}
+	for _, p := range w.patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *watcher) ListenStart() bus.Listener {
+	return w.bus.Subscribe("start")
+}
+
+func (w *watcher) ListenStop() bus.Listener {
+	return w.bus.Subscribe("stop")
+}
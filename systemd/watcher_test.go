@@ -0,0 +1,194 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package systemd
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-autodiscover/internal/polltest"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type mockManager struct {
+	polltest.Source[Unit]
+}
+
+func (m *mockManager) Units(ctx context.Context, types []string, properties []string) ([]Unit, error) {
+	units, _, err := m.List()
+	return units, err
+}
+
+// subscribingManager notifies the changes of its units
+type subscribingManager struct {
+	mockManager
+	changes chan struct{}
+}
+
+func (m *subscribingManager) Subscribe(ctx context.Context) (<-chan struct{}, error) {
+	return m.changes, nil
+}
+
+func (m *subscribingManager) change(units ...Unit) {
+	m.Set(units...)
+	m.changes <- struct{}{}
+}
+
+func unit(name string, pid int) Unit {
+	return Unit{Name: name, ActiveState: "active", SubState: "running", MainPID: pid}
+}
+
+func TestWatcher(t *testing.T) {
+	m := &mockManager{}
+	m.Set(unit("nginx.service", 10), unit("sshd.service", 20))
+
+	w, err := NewWatcher(logp.L(), m, Config{Units: []string{"nginx*", "redis*"}, SyncPeriod: 10 * time.Millisecond})
+	require.NoError(t, err)
+	start, stop := polltest.Start(t, w)
+
+	assert.Equal(t, "nginx.service", polltest.NextEvent(t, start)["unit"].(*Unit).Name)
+	assert.Len(t, w.Units(), 1)
+
+	// nginx restarted
+	m.Set(unit("nginx.service", 11), unit("sshd.service", 20))
+	assert.Equal(t, 10, polltest.NextEvent(t, stop)["unit"].(*Unit).MainPID)
+	assert.Equal(t, 11, polltest.NextEvent(t, start)["unit"].(*Unit).MainPID)
+
+	// nginx stopped, redis started
+	m.Set(unit("redis.service", 30))
+	assert.Equal(t, "redis.service", polltest.NextEvent(t, start)["unit"].(*Unit).Name)
+	assert.Equal(t, "nginx.service", polltest.NextEvent(t, stop)["unit"].(*Unit).Name)
+}
+
+func TestWatcherSubscription(t *testing.T) {
+	m := &subscribingManager{changes: make(chan struct{}, 1)}
+	m.Set(unit("nginx.service", 10))
+
+	// Units are listed when they change, without waiting for the sync period
+	w, err := NewWatcher(logp.L(), m, Config{SyncPeriod: time.Hour})
+	require.NoError(t, err)
+	start, stop := polltest.Start(t, w)
+	assert.Equal(t, "nginx.service", polltest.NextEvent(t, start)["unit"].(*Unit).Name)
+
+	m.change(unit("nginx.service", 10), unit("redis.service", 30))
+	assert.Equal(t, "redis.service", polltest.NextEvent(t, start)["unit"].(*Unit).Name)
+
+	m.change(unit("redis.service", 30))
+	assert.Equal(t, "nginx.service", polltest.NextEvent(t, stop)["unit"].(*Unit).Name)
+
+	// Subscribers are only resynced periodically by default
+	w, err = NewWatcher(logp.L(), m, Config{})
+	require.NoError(t, err)
+	assert.Equal(t, defaultResyncPeriod, w.(*watcher).period)
+}
+
+func TestWatcherStartError(t *testing.T) {
+	polltest.StartError(t, func(err error) (polltest.Watcher, error) {
+		manager := &mockManager{}
+		manager.Fail(err)
+		return NewWatcher(logp.L(), manager, Config{})
+	})
+
+	_, err := NewWatcher(logp.L(), &mockManager{}, Config{Units: []string{"["}})
+	assert.Error(t, err)
+
+	_, err = NewWatcher(logp.L(), &mockManager{}, Config{Properties: []string{"Bad,Property"}})
+	assert.Error(t, err)
+}
+
+func TestSystemctl(t *testing.T) {
+	var calls [][]string
+	s := &systemctl{path: "systemctl", user: true, run: func(ctx context.Context, path string, args ...string) ([]byte, error) {
+		calls = append(calls, args)
+		if args[1] == "list-units" {
+			return []byte("nginx.service loaded active running A high performance web server\n" +
+				"sshd.service  loaded active running OpenBSD Secure Shell server\n"), nil
+		}
+		return []byte(strings.Join([]string{
+			"Id=nginx.service",
+			"Description=A high performance web server",
+			"LoadState=loaded",
+			"ActiveState=active",
+			"SubState=running",
+			"Slice=system.slice",
+			"ControlGroup=/system.slice/nginx.service",
+			"MainPID=1234",
+			"ExecMainStartTimestamp=Wed 2022-06-01 10:00:00 UTC",
+			"",
+			"Id=sshd.service",
+			"ActiveState=active",
+			"MainPID=0",
+			"",
+		}, "\n")), nil
+	}}
+
+	units, err := s.Units(context.Background(), []string{"service"}, []string{"ExecMainStartTimestamp"})
+	require.NoError(t, err)
+	require.Len(t, units, 2)
+	assert.Equal(t, Unit{
+		Name:         "nginx.service",
+		Description:  "A high performance web server",
+		LoadState:    "loaded",
+		ActiveState:  "active",
+		SubState:     "running",
+		Slice:        "system.slice",
+		ControlGroup: "/system.slice/nginx.service",
+		MainPID:      1234,
+		Properties:   map[string]string{"ExecMainStartTimestamp": "Wed 2022-06-01 10:00:00 UTC"},
+	}, units[0])
+	assert.Equal(t, "sshd.service", units[1].Name)
+	assert.Empty(t, units[1].Properties)
+
+	require.Len(t, calls, 2)
+	assert.Equal(t, []string{"--user", "list-units", "--state=active", "--no-legend", "--plain", "--full", "--no-pager", "--type=service"}, calls[0])
+	assert.Equal(t, []string{"--user", "show", "--no-pager",
+		"--property=Id,Description,LoadState,ActiveState,SubState,Slice,ControlGroup,MainPID,ExecMainStartTimestamp",
+		"--", "nginx.service", "sshd.service"}, calls[1])
+
+	_, err = parseShow([]byte("Id=a.service\nnot a property\n"), nil)
+	assert.Error(t, err)
+}
+
+func TestGenerateMetadata(t *testing.T) {
+	assert.Equal(t, mapstr.M{
+		"systemd": mapstr.M{
+			"unit":        "nginx.service",
+			"state":       "running",
+			"description": "A high performance web server",
+			"slice":       "system.slice",
+			"cgroup":      mapstr.M{"path": "/system.slice/nginx.service"},
+			"properties":  mapstr.M{"ExecMainStartTimestamp": "Wed 2022-06-01 10:00:00 UTC"},
+		},
+		"process": mapstr.M{"pid": 1234},
+	}, GenerateMetadata(&Unit{
+		Name:         "nginx.service",
+		Description:  "A high performance web server",
+		ActiveState:  "active",
+		SubState:     "running",
+		Slice:        "system.slice",
+		ControlGroup: "/system.slice/nginx.service",
+		MainPID:      1234,
+		Properties:   map[string]string{"ExecMainStartTimestamp": "Wed 2022-06-01 10:00:00 UTC"},
+	}))
+}
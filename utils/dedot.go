@@ -0,0 +1,73 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package utils
+
+import (
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/safemapstr"
+)
+
+// Dedotter replaces the dots in keys, so they are not interpreted as nested objects
+type Dedotter struct {
+	// Replacement of the dots, `_` by default
+	Replacement rune
+
+	// MaxDepth is the number of nesting levels kept, the first MaxDepth-1 dots of keys are kept
+	// and the rest replaced, e.g. `a.b_c` for `a.b.c` with a MaxDepth of 2. All dots are
+	// replaced if it is 0 or 1.
+	MaxDepth int
+}
+
+// DefaultDedotter replaces all the dots with `_`
+var DefaultDedotter = &Dedotter{}
+
+func (d *Dedotter) replacement() string {
+	if d.Replacement == 0 {
+		return "_"
+	}
+	return string(d.Replacement)
+}
+
+// DeDot replaces the dots of a key
+func (d *Dedotter) DeDot(key string) string {
+	if d.MaxDepth <= 1 {
+		return strings.ReplaceAll(key, ".", d.replacement())
+	}
+	parts := strings.SplitN(key, ".", d.MaxDepth)
+	last := len(parts) - 1
+	parts[last] = strings.ReplaceAll(parts[last], ".", d.replacement())
+	return strings.Join(parts, ".")
+}
+
+// ReDot reverses DeDot, replacing the replacements with dots. Keys that contained the
+// replacement before being dedotted cannot be restored.
+func (d *Dedotter) ReDot(key string) string {
+	return strings.ReplaceAll(key, d.replacement(), ".")
+}
+
+// Put sets a value in a map under the dedotted key, nesting it by the dots kept. With a nil
+// Dedotter keys are used as they are, with safemapstr avoiding conflicts between nested keys.
+func (d *Dedotter) Put(m mapstr.M, key string, value interface{}) {
+	if d == nil {
+		_ = safemapstr.Put(m, key, value)
+		return
+	}
+	_, _ = m.Put(d.DeDot(key), value)
+}
@@ -0,0 +1,66 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestDedotter(t *testing.T) {
+	tests := []struct {
+		dedotter *Dedotter
+		key      string
+		dedotted string
+		redotted string
+	}{
+		{DefaultDedotter, "app.kubernetes.io/name", "app_kubernetes_io/name", "app.kubernetes.io/name"},
+		{DefaultDedotter, "nodots", "nodots", "nodots"},
+		{DefaultDedotter, "my_label.key", "my_label_key", "my.label.key"},
+		{&Dedotter{Replacement: '-'}, "app.kubernetes.io/name", "app-kubernetes-io/name", "app.kubernetes.io/name"},
+		{&Dedotter{MaxDepth: 2}, "a.b.c.d", "a.b_c_d", "a.b.c.d"},
+		{&Dedotter{MaxDepth: 3}, "a.b.c.d", "a.b.c_d", "a.b.c.d"},
+		{&Dedotter{MaxDepth: 3}, "a.b", "a.b", "a.b"},
+		{&Dedotter{MaxDepth: 1, Replacement: '·'}, "a.b", "a·b", "a.b"},
+	}
+
+	for _, test := range tests {
+		dedotted := test.dedotter.DeDot(test.key)
+		assert.Equal(t, test.dedotted, dedotted, test.key)
+		assert.Equal(t, test.redotted, test.dedotter.ReDot(dedotted), test.key)
+	}
+
+	assert.Equal(t, "a_b", DeDot("a.b"))
+	assert.Equal(t, "a.b", ReDot("a_b"))
+}
+
+func TestDedotterPut(t *testing.T) {
+	m := mapstr.M{}
+	(&Dedotter{MaxDepth: 2}).Put(m, "app.kubernetes.io/name", "nginx")
+	assert.Equal(t, mapstr.M{"app": mapstr.M{"kubernetes_io/name": "nginx"}}, m)
+
+	// Without dedotter conflicting keys are kept with safemapstr
+	m = mapstr.M{}
+	var dedotter *Dedotter
+	dedotter.Put(m, "app", "nginx")
+	dedotter.Put(m, "app.version", "1.0")
+	assert.Equal(t, mapstr.M{"app": mapstr.M{"value": "nginx", "version": "1.0"}}, m)
+}
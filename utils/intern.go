@@ -0,0 +1,150 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package utils
+
+import "sync"
+
+const (
+	// defaultInternerSize is the number of strings kept by the default interner
+	defaultInternerSize = 64 * 1024
+
+	// maxInternLength is the length of the longest string interned, longer strings are rarely
+	// repeated
+	maxInternLength = 256
+
+	// internerShardSize is the minimum number of strings kept by every shard of an interner, and
+	// maxInternerShards the maximum number of shards
+	internerShardSize = 1024
+	maxInternerShards = 32
+)
+
+// Interner deduplicates strings, so repeated strings like the keys and values of labels of
+// thousands of pods share their memory. The interner is reset when it is full, so unique values
+// don't grow it indefinitely. Large interners are split in shards with their own locks, so
+// concurrent generations don't contend on them.
+type Interner struct {
+	shards []internerShard
+	size   int
+}
+
+type internerShard struct {
+	sync.RWMutex
+	// strings keeps the interned strings boxed, so storing them in maps of interfaces doesn't
+	// allocate them again
+	strings map[string]interface{}
+	size    int
+}
+
+// DefaultInterner is the interner used by metadata generation
+var DefaultInterner = NewInterner(defaultInternerSize)
+
+// NewInterner returns an interner that keeps up to size strings, strings are not interned if
+// size is zero
+func NewInterner(size int) *Interner {
+	shards := size / internerShardSize
+	if shards > maxInternerShards {
+		shards = maxInternerShards
+	}
+	if shards < 1 {
+		shards = 1
+	}
+	i := &Interner{
+		shards: make([]internerShard, shards),
+		size:   size,
+	}
+	for n := range i.shards {
+		i.shards[n].strings = make(map[string]interface{})
+		i.shards[n].size = size / shards
+	}
+	return i
+}
+
+// Intern returns the interned copy of a string
+func (i *Interner) Intern(s string) string {
+	if i == nil || i.size <= 0 || len(s) > maxInternLength {
+		return s
+	}
+	return i.InternValue(s).(string)
+}
+
+// InternValue returns the interned copy of a string as an interface value, to be stored in maps
+// of interfaces like mapstr.M without allocating it again
+func (i *Interner) InternValue(s string) interface{} {
+	if i == nil || i.size <= 0 || len(s) > maxInternLength {
+		return s
+	}
+
+	shard := &i.shards[0]
+	if len(i.shards) > 1 {
+		shard = &i.shards[StringHash(s)%uint32(len(i.shards))]
+	}
+	return shard.intern(s)
+}
+
+func (s *internerShard) intern(str string) interface{} {
+	s.RLock()
+	interned, ok := s.strings[str]
+	s.RUnlock()
+	if ok {
+		return interned
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if interned, ok := s.strings[str]; ok {
+		return interned
+	}
+	if len(s.strings) >= s.size {
+		s.strings = make(map[string]interface{})
+	}
+	interned = str
+	s.strings[str] = interned
+	return interned
+}
+
+// Len returns the number of strings interned
+func (i *Interner) Len() int {
+	n := 0
+	for s := range i.shards {
+		shard := &i.shards[s]
+		shard.RLock()
+		n += len(shard.strings)
+		shard.RUnlock()
+	}
+	return n
+}
+
+// Bytes returns the size of the strings interned
+func (i *Interner) Bytes() int64 {
+	var n int64
+	for s := range i.shards {
+		shard := &i.shards[s]
+		shard.RLock()
+		for str := range shard.strings {
+			n += int64(len(str))
+		}
+		shard.RUnlock()
+	}
+	return n
+}
+
+// Intern returns the copy of a string interned by the default interner
+func Intern(s string) string {
+	return DefaultInterner.Intern(s)
+}
@@ -0,0 +1,107 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package utils
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterner(t *testing.T) {
+	interner := NewInterner(2)
+
+	a := interner.Intern(string([]byte("app.kubernetes.io/name")))
+	b := interner.Intern(string([]byte("app.kubernetes.io/name")))
+	assert.Equal(t, a, b)
+	assert.Equal(t, stringData(a), stringData(b))
+	assert.Equal(t, 1, interner.Len())
+
+	// Reset when full
+	interner.Intern("nginx")
+	interner.Intern("redis")
+	assert.Equal(t, 1, interner.Len())
+
+	// Long strings are not interned
+	long := strings.Repeat("x", maxInternLength+1)
+	interner.Intern(long)
+	assert.Equal(t, 1, interner.Len())
+
+	// Disabled interner
+	disabled := NewInterner(0)
+	assert.Equal(t, "nginx", disabled.Intern("nginx"))
+	assert.Equal(t, 0, disabled.Len())
+}
+
+func stringData(s string) uintptr {
+	return (*reflect.StringHeader)(unsafe.Pointer(&s)).Data
+}
+
+func TestInternerValue(t *testing.T) {
+	interner := NewInterner(8)
+
+	a := interner.InternValue(string([]byte("nginx")))
+	b := interner.InternValue(string([]byte("nginx")))
+	assert.Equal(t, "nginx", a)
+	assert.Equal(t, stringData(a.(string)), stringData(b.(string)))
+	assert.Equal(t, stringData(a.(string)), stringData(interner.Intern("nginx")))
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = interner.InternValue("nginx")
+	})
+	assert.Equal(t, float64(0), allocs)
+}
+
+func TestInternerShards(t *testing.T) {
+	interner := NewInterner(defaultInternerSize)
+	assert.Len(t, interner.shards, maxInternerShards)
+
+	for i := 0; i < 100; i++ {
+		value := fmt.Sprintf("value-%d", i)
+		assert.Equal(t, stringData(interner.Intern(value)), stringData(interner.Intern(string([]byte(value)))))
+	}
+	assert.Equal(t, 100, interner.Len())
+}
+
+func TestStringHash(t *testing.T) {
+	assert.Equal(t, uint32(2166136261), StringHash(""))
+	assert.Equal(t, uint32(0xe40c292c), StringHash("a"))
+	assert.Equal(t, StringHash("app.kubernetes.io/name"), StringHash(string([]byte("app.kubernetes.io/name"))))
+}
+
+func BenchmarkInternerParallel(b *testing.B) {
+	interner := NewInterner(defaultInternerSize)
+	values := make([]string, 4096)
+	for i := range values {
+		values[i] = fmt.Sprintf("value-%d", i%1024)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			_ = interner.InternValue(values[i%len(values)])
+			i++
+		}
+	})
+}
@@ -17,10 +17,13 @@
 
 package utils
 
-import "strings"
-
 // DeDot a string by replacing all . with _
 // This helps when sending data to Elasticsearch to prevent object and key collisions.
 func DeDot(s string) string {
-	return strings.Replace(s, ".", "_", -1)
+	return DefaultDedotter.DeDot(s)
+}
+
+// ReDot a string dedotted with DeDot by replacing all _ with .
+func ReDot(s string) string {
+	return DefaultDedotter.ReDot(s)
 }
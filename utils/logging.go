@@ -0,0 +1,152 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// Subsystems with their own loggers
+const (
+	SubsystemWatcher  = "watcher"
+	SubsystemMetadata = "metadata"
+	SubsystemDocker   = "docker"
+	SubsystemBus      = "bus"
+)
+
+var subsystems = map[string]struct{}{
+	SubsystemWatcher:  {},
+	SubsystemMetadata: {},
+	SubsystemDocker:   {},
+	SubsystemBus:      {},
+}
+
+// LoggingConfig sets the levels of the loggers of the subsystems, independently of the level
+// of the base logger:
+//
+//	levels:
+//	  watcher: debug
+//	  metadata: warning
+type LoggingConfig struct {
+	Levels map[string]logp.Level `config:"levels"`
+}
+
+// Validate checks that the levels are set for known subsystems
+func (c *LoggingConfig) Validate() error {
+	for subsystem := range c.Levels {
+		if _, ok := subsystems[subsystem]; !ok {
+			known := make([]string, 0, len(subsystems))
+			for s := range subsystems {
+				known = append(known, s)
+			}
+			sort.Strings(known)
+			return fmt.Errorf("unknown logging subsystem %q, expected one of %s", subsystem, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
+
+// Loggers are the loggers of the subsystems, by default they are named after the subsystem
+// from a base logger, with the level configured for the subsystem. Loggers can also be injected.
+type Loggers struct {
+	sync.RWMutex
+	base     *logp.Logger
+	levels   map[string]logp.Level
+	injected map[string]*logp.Logger
+}
+
+// NewLoggers creates the loggers of the subsystems from a base logger, logp.L() if nil
+func NewLoggers(base *logp.Logger, cfg LoggingConfig) *Loggers {
+	if base == nil {
+		base = logp.L()
+	}
+	levels := make(map[string]logp.Level, len(cfg.Levels))
+	for subsystem, level := range cfg.Levels {
+		levels[subsystem] = level
+	}
+	return &Loggers{
+		base:     base,
+		levels:   levels,
+		injected: make(map[string]*logp.Logger),
+	}
+}
+
+// Inject sets the logger of a subsystem, it is used as is, without the configured level
+func (l *Loggers) Inject(subsystem string, logger *logp.Logger) {
+	l.Lock()
+	defer l.Unlock()
+	l.injected[subsystem] = logger
+}
+
+// Logger returns the logger of a subsystem
+func (l *Loggers) Logger(subsystem string) *logp.Logger {
+	l.RLock()
+	defer l.RUnlock()
+
+	if logger, ok := l.injected[subsystem]; ok {
+		return logger
+	}
+	logger := l.base.Named(subsystem)
+	if level, ok := l.levels[subsystem]; ok {
+		logger = WithLevel(logger, level)
+	}
+	return logger
+}
+
+// WithLevel returns a logger logging the entries of the given level and above, also when the
+// level is more verbose than the level of the global logger. Debug entries are written also
+// when the logger is not in the debug selectors.
+func WithLevel(logger *logp.Logger, level logp.Level) *logp.Logger {
+	return logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &levelCore{Core: core, level: level.ZapLevel()}
+	}))
+}
+
+// levelCore overrides the level of a core, the entries it enables are written to the core
+// without checking them with it
+type levelCore struct {
+	zapcore.Core
+	level zapcore.Level
+}
+
+func (c *levelCore) Enabled(level zapcore.Level) bool {
+	return c.level.Enabled(level)
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), level: c.level}
+}
+
+func (c *levelCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *levelCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(entry, fields)
+}
@@ -0,0 +1,72 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+func TestLoggers(t *testing.T) {
+	require.NoError(t, logp.DevelopmentSetup(logp.ToObserverOutput(), logp.WithLevel(logp.InfoLevel)))
+
+	loggers := NewLoggers(logp.NewLogger("autodiscover"), LoggingConfig{Levels: map[string]logp.Level{
+		SubsystemWatcher:  logp.DebugLevel,
+		SubsystemMetadata: logp.ErrorLevel,
+	}})
+	loggers.Logger(SubsystemWatcher).Debug("watcher debug")
+	loggers.Logger(SubsystemWatcher).With("key", "value").Debug("watcher debug with fields")
+	loggers.Logger(SubsystemMetadata).Warn("metadata warning")
+	loggers.Logger(SubsystemMetadata).Error("metadata error")
+	loggers.Logger(SubsystemBus).Debug("bus debug")
+	loggers.Logger(SubsystemBus).Info("bus info")
+
+	logs := logp.ObserverLogs().TakeAll()
+	var messages []string
+	for _, entry := range logs {
+		messages = append(messages, entry.LoggerName+": "+entry.Message)
+	}
+	assert.Equal(t, []string{
+		"autodiscover.watcher: watcher debug",
+		"autodiscover.watcher: watcher debug with fields",
+		"autodiscover.metadata: metadata error",
+		"autodiscover.bus: bus info",
+	}, messages)
+	assert.Equal(t, "value", logs[1].ContextMap()["key"])
+
+	injected := logp.NewLogger("custom")
+	loggers.Inject(SubsystemDocker, injected)
+	assert.Same(t, injected, loggers.Logger(SubsystemDocker))
+}
+
+func TestLoggingConfig(t *testing.T) {
+	cfg, err := config.NewConfigFrom(map[string]interface{}{"levels": map[string]interface{}{"watcher": "debug", "docker": "warning"}})
+	require.NoError(t, err)
+	var c LoggingConfig
+	require.NoError(t, cfg.Unpack(&c))
+	assert.Equal(t, map[string]logp.Level{SubsystemWatcher: logp.DebugLevel, SubsystemDocker: logp.WarnLevel}, c.Levels)
+
+	cfg, err = config.NewConfigFrom(map[string]interface{}{"levels": map[string]interface{}{"unknown": "debug"}})
+	require.NoError(t, err)
+	assert.Error(t, cfg.Unpack(&c))
+}
@@ -0,0 +1,126 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package utils
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// maxStackSize is the size of the buffer of the goroutine stacks captured by watchdogs
+const maxStackSize = 1 << 20
+
+// WatchdogConfig configures the detection of slow event handlers
+type WatchdogConfig struct {
+	// Threshold is the duration after which a handler is considered slow, handlers are not
+	// watched if it is zero
+	Threshold time.Duration `config:"threshold" validate:"min=0"`
+
+	// CaptureStack logs the stack of the goroutine of the slow handlers while they are running.
+	// Watching handlers becomes more expensive, as the goroutine of every handler is identified.
+	CaptureStack bool `config:"capture_stack"`
+}
+
+// Watchdog logs the event handlers that run for longer than a threshold, to diagnose the
+// consumers that block the delivery of events. A nil Watchdog doesn't watch anything.
+type Watchdog struct {
+	logger *logp.Logger
+	config WatchdogConfig
+}
+
+// NewWatchdog creates a Watchdog logging the slow handlers with the given logger
+func NewWatchdog(logger *logp.Logger, cfg WatchdogConfig) *Watchdog {
+	if logger == nil {
+		logger = logp.NewLogger("watchdog")
+	}
+	return &Watchdog{logger: logger, config: cfg}
+}
+
+// Watch starts watching a handler handling an event, done must be called when it returns. It
+// must be called from the goroutine running the handler. A warning is logged when the handler
+// exceeds the threshold, with its stack if configured, and another one when it returns.
+func (w *Watchdog) Watch(handler string) (done func()) {
+	if w == nil || w.config.Threshold <= 0 {
+		return func() {}
+	}
+
+	goroutine := ""
+	if w.config.CaptureStack {
+		goroutine = currentGoroutine()
+	}
+
+	start := time.Now()
+	var mutex sync.Mutex
+	slow := false
+	timer := time.AfterFunc(w.config.Threshold, func() {
+		mutex.Lock()
+		slow = true
+		mutex.Unlock()
+
+		if goroutine == "" {
+			w.logger.Warnf("Handler %s has been running for more than %s", handler, w.config.Threshold)
+			return
+		}
+		w.logger.Warnw("Handler "+handler+" has been running for more than "+w.config.Threshold.String(),
+			"stack", goroutineStack(goroutine))
+	})
+
+	return func() {
+		timer.Stop()
+		mutex.Lock()
+		defer mutex.Unlock()
+		if slow {
+			w.logger.Warnf("Slow handler %s returned after %s", handler, time.Since(start))
+		}
+	}
+}
+
+// currentGoroutine returns the header of the stack of the current goroutine, like "goroutine 42"
+func currentGoroutine() string {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	header := buf[:n]
+	if i := bytes.IndexByte(header, '['); i > 0 {
+		header = bytes.TrimSpace(header[:i])
+	}
+	// Validate that it is a goroutine header
+	if _, err := strconv.Atoi(string(bytes.TrimPrefix(header, []byte("goroutine ")))); err != nil {
+		return ""
+	}
+	return string(header)
+}
+
+// goroutineStack returns the stack of the goroutine with the given header, or an empty string if
+// it is not running anymore
+func goroutineStack(goroutine string) string {
+	buf := make([]byte, maxStackSize)
+	buf = buf[:runtime.Stack(buf, true)]
+
+	prefix := []byte(goroutine + " [")
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		if bytes.HasPrefix(stack, prefix) {
+			return string(stack)
+		}
+	}
+	return ""
+}
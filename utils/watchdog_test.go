@@ -0,0 +1,66 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+func TestWatchdog(t *testing.T) {
+	require.NoError(t, logp.DevelopmentSetup(logp.ToObserverOutput()))
+
+	watchdog := NewWatchdog(logp.NewLogger("watchdog"), WatchdogConfig{Threshold: 10 * time.Millisecond, CaptureStack: true})
+
+	// Fast handlers are not logged
+	watchdog.Watch("fast")()
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 0, logp.ObserverLogs().Len())
+
+	done := watchdog.Watch("slow")
+	require.Eventually(t, func() bool {
+		return logp.ObserverLogs().Len() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	done()
+
+	logs := logp.ObserverLogs().TakeAll()
+	require.Len(t, logs, 2)
+	assert.Equal(t, "Handler slow has been running for more than 10ms", logs[0].Message)
+	assert.Contains(t, logs[0].ContextMap()["stack"], "utils.TestWatchdog")
+	assert.Contains(t, logs[1].Message, "Slow handler slow returned after")
+
+	// Nil and disabled watchdogs don't watch anything
+	for _, watchdog := range []*Watchdog{nil, NewWatchdog(nil, WatchdogConfig{})} {
+		done := watchdog.Watch("disabled")
+		time.Sleep(20 * time.Millisecond)
+		done()
+	}
+	assert.Equal(t, 0, logp.ObserverLogs().Len())
+}
+
+func TestCurrentGoroutine(t *testing.T) {
+	goroutine := currentGoroutine()
+	assert.Regexp(t, `^goroutine \d+$`, goroutine)
+	assert.Contains(t, goroutineStack(goroutine), "utils.TestCurrentGoroutine")
+	assert.Empty(t, goroutineStack("goroutine 0"))
+}